@@ -0,0 +1,41 @@
+// Package cache keeps recently read users close at hand, so reads that
+// repeat often, like a profile page fetching its user on every render,
+// don't all reach the database.
+//
+// Values are stored encoded, so a Cache can keep them anywhere: LRU keeps
+// them in the memory of the process, and a shared store, like Redis, can be
+// plugged in by implementing Cache
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+// Entry is a value stored in a Cache. It is fresh until FreshUntil, and
+// stale afterwards, until the Cache drops it
+type Entry struct {
+	Value      []byte    `json:"value"`
+	FreshUntil time.Time `json:"freshUntil"`
+}
+
+// Fresh reports whether the entry is still fresh at now
+func (e *Entry) Fresh(now time.Time) bool {
+	return now.Before(e.FreshUntil)
+}
+
+// Cache stores entries by key. Failures of a Cache are never fatal: reads
+// fall back to the repository it sits in front of.
+//
+// A Redis Cache would e.g. store entries with SET key value PX keepFor, and
+// drop them with DEL
+type Cache interface {
+	// Get returns the entry stored at key, fresh or stale, or nil when
+	// there is none
+	Get(ctx context.Context, key string) (*Entry, error)
+	// Set stores e at key, replacing any entry stored there, and keeps it
+	// for keepFor at most
+	Set(ctx context.Context, key string, e *Entry, keepFor time.Duration) error
+	// Delete drops the entry stored at key, if any
+	Delete(ctx context.Context, key string) error
+}
@@ -0,0 +1,112 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// LRU is a Cache kept in the memory of the process. It holds up to Size
+// entries, dropping the least recently used one to make room for new ones.
+// Its entries are only seen by the process holding them, so changes made by
+// other processes show up once the entries expire
+type LRU struct {
+	size int
+
+	mu      sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+	now     func() time.Time
+}
+
+// lruItem is an element of LRU.order, most recently used first
+type lruItem struct {
+	key       string
+	entry     Entry
+	expiresAt time.Time
+}
+
+// NewLRU creates an empty LRU holding up to size entries
+func NewLRU(size int) *LRU {
+	return &LRU{
+		size:    size,
+		order:   list.New(),
+		entries: map[string]*list.Element{},
+		now:     time.Now,
+	}
+}
+
+// Get returns the entry stored at key, or nil when there is none or it
+// expired
+func (c *LRU) Get(ctx context.Context, key string) (*Entry, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+
+	if !ok {
+		return nil, nil
+	}
+
+	item := el.Value.(*lruItem)
+
+	if !c.now().Before(item.expiresAt) {
+		c.remove(el)
+		return nil, nil
+	}
+
+	c.order.MoveToFront(el)
+
+	entry := item.entry
+
+	return &entry, nil
+}
+
+// Set stores e at key for keepFor at most
+func (c *LRU) Set(ctx context.Context, key string, e *Entry, keepFor time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	item := &lruItem{key: key, entry: *e, expiresAt: c.now().Add(keepFor)}
+
+	if el, ok := c.entries[key]; ok {
+		el.Value = item
+		c.order.MoveToFront(el)
+
+		return nil
+	}
+
+	c.entries[key] = c.order.PushFront(item)
+
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+
+	return nil
+}
+
+// Delete drops the entry stored at key
+func (c *LRU) Delete(ctx context.Context, key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+
+	return nil
+}
+
+// Len returns how many entries are stored, expired ones included
+func (c *LRU) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.order.Len()
+}
+
+func (c *LRU) remove(el *list.Element) {
+	c.order.Remove(el)
+	delete(c.entries, el.Value.(*lruItem).key)
+}
@@ -0,0 +1,98 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLRU(t *testing.T) {
+	ctx := context.Background()
+
+	entry := func(value string) *Entry {
+		return &Entry{Value: []byte(value), FreshUntil: time.Now().Add(time.Minute)}
+	}
+
+	t.Run("Drops the least recently used entry when full", func(t *testing.T) {
+		c := NewLRU(2)
+
+		assert.NoError(t, c.Set(ctx, "a", entry("a"), time.Minute))
+		assert.NoError(t, c.Set(ctx, "b", entry("b"), time.Minute))
+
+		// reading a makes b the least recently used
+		got, err := c.Get(ctx, "a")
+
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("a"), got.Value)
+
+		assert.NoError(t, c.Set(ctx, "c", entry("c"), time.Minute))
+
+		got, _ = c.Get(ctx, "b")
+		assert.Nil(t, got)
+
+		got, _ = c.Get(ctx, "a")
+		assert.NotNil(t, got)
+
+		got, _ = c.Get(ctx, "c")
+		assert.NotNil(t, got)
+
+		assert.Equal(t, 2, c.Len())
+	})
+
+	t.Run("Replaces entries", func(t *testing.T) {
+		c := NewLRU(2)
+
+		assert.NoError(t, c.Set(ctx, "a", entry("old"), time.Minute))
+		assert.NoError(t, c.Set(ctx, "a", entry("new"), time.Minute))
+
+		got, _ := c.Get(ctx, "a")
+
+		assert.Equal(t, []byte("new"), got.Value)
+		assert.Equal(t, 1, c.Len())
+	})
+
+	t.Run("Expires entries", func(t *testing.T) {
+		c := NewLRU(2)
+
+		now := time.Now()
+		c.now = func() time.Time { return now }
+
+		assert.NoError(t, c.Set(ctx, "a", entry("a"), time.Minute))
+
+		now = now.Add(59 * time.Second)
+
+		got, _ := c.Get(ctx, "a")
+		assert.NotNil(t, got)
+
+		now = now.Add(time.Second)
+
+		got, _ = c.Get(ctx, "a")
+		assert.Nil(t, got)
+		assert.Equal(t, 0, c.Len())
+	})
+
+	t.Run("Deletes entries", func(t *testing.T) {
+		c := NewLRU(2)
+
+		assert.NoError(t, c.Set(ctx, "a", entry("a"), time.Minute))
+		assert.NoError(t, c.Delete(ctx, "a"))
+		assert.NoError(t, c.Delete(ctx, "missing"))
+
+		got, _ := c.Get(ctx, "a")
+		assert.Nil(t, got)
+	})
+
+	t.Run("Entries are copies", func(t *testing.T) {
+		c := NewLRU(2)
+
+		assert.NoError(t, c.Set(ctx, "a", entry("a"), time.Minute))
+
+		got, _ := c.Get(ctx, "a")
+		got.FreshUntil = time.Time{}
+
+		got, _ = c.Get(ctx, "a")
+		assert.True(t, got.Fresh(time.Now()))
+	})
+}
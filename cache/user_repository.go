@@ -0,0 +1,269 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	model "github.com/klasrak/users-api/models"
+	"github.com/klasrak/users-api/rerrors"
+	"github.com/klasrak/users-api/service"
+	"github.com/klasrak/users-api/utils"
+	"golang.org/x/sync/singleflight"
+)
+
+// UserRepository is a service.UserRepository keeping the users read by id
+// in Cache. Users are read from the wrapped repository once their entry is
+// TTL old, always from the primary database, and concurrent reads of the
+// same user missing the cache share a single read. Stale entries are kept for StaleFor more, and served when
+// the repository fails, e.g. while the database is briefly unavailable.
+//
+// Changing a user drops its entry once the transaction making the change
+// ends, committed or not, and keeps reads in flight by then from caching
+// the user as it was before. Every other method goes straight to the
+// wrapped repository
+type UserRepository struct {
+	service.UserRepository
+
+	Cache    Cache
+	TTL      time.Duration
+	StaleFor time.Duration
+
+	group singleflight.Group
+
+	mu sync.Mutex
+	// loads are the reads in flight, by key
+	loads map[string]*load
+}
+
+// load is a read of a user in flight. It is stale once the user changed
+// after it started, and then must not be cached
+type load struct {
+	stale bool
+}
+
+// loadTimeout bounds a read shared by concurrent callers, which runs on its
+// own so a caller giving up doesn't fail the others
+const loadTimeout = 5 * time.Second
+
+// GetByID fetches a user by id, from the cache while its entry is fresh.
+// Deleted users, read by admins, and reads that must see every write (see
+// utils.WithReadYourWrites) always go to the repository
+func (r *UserRepository) GetByID(ctx context.Context, id uuid.UUID, includeDeleted bool) (*model.User, error) {
+	if includeDeleted || utils.ReadYourWrites(ctx) {
+		return r.UserRepository.GetByID(ctx, id, includeDeleted)
+	}
+
+	key := userKey(id.String())
+
+	cached, fresh := r.get(ctx, key)
+
+	if fresh {
+		return cached, nil
+	}
+
+	ch := r.group.DoChan(key, func() (interface{}, error) {
+		l := r.begin(key)
+
+		ctx, cancel := context.WithTimeout(detached{ctx}, loadTimeout)
+		defer cancel()
+
+		// what is cached is served for TTL, so it must not be read from
+		// a replica lagging behind the change that dropped the entry
+		ctx = utils.WithReadYourWrites(ctx)
+
+		u, err := r.UserRepository.GetByID(ctx, id, false)
+
+		if err != nil {
+			r.end(key, l)
+			return nil, err
+		}
+
+		r.finish(ctx, key, l, u)
+
+		return u, nil
+	})
+
+	var res singleflight.Result
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res = <-ch:
+	}
+
+	v, err := res.Val, res.Err
+
+	if err != nil {
+		// not found and the like are answers, only failures are hidden
+		if cached != nil && rerrors.Status(err) == http.StatusInternalServerError {
+			log.Printf("unable to read user %s, serving a stale one from the cache: %v\n", id, err)
+			return cached, nil
+		}
+
+		return nil, err
+	}
+
+	// callers sharing the read must not share the user
+	u := *v.(*model.User)
+
+	return &u, nil
+}
+
+// Update replaces every field of a user, dropping its entry
+func (r *UserRepository) Update(ctx context.Context, u *model.User) (*model.User, error) {
+	defer r.invalidate(ctx, u.UID.String())
+
+	return r.UserRepository.Update(ctx, u)
+}
+
+// Delete marks a user as deleted, dropping its entry
+func (r *UserRepository) Delete(ctx context.Context, id string) error {
+	defer r.invalidate(ctx, id)
+
+	return r.UserRepository.Delete(ctx, id)
+}
+
+// Restore undoes the deletion of a user, dropping its entry
+func (r *UserRepository) Restore(ctx context.Context, id string) (*model.User, error) {
+	defer r.invalidate(ctx, id)
+
+	return r.UserRepository.Restore(ctx, id)
+}
+
+// Purge removes a user for good, dropping its entry
+func (r *UserRepository) Purge(ctx context.Context, id string) error {
+	defer r.invalidate(ctx, id)
+
+	return r.UserRepository.Purge(ctx, id)
+}
+
+// get returns the user cached at key, if any, and whether it is fresh
+func (r *UserRepository) get(ctx context.Context, key string) (*model.User, bool) {
+	entry, err := r.Cache.Get(ctx, key)
+
+	if err != nil {
+		log.Printf("unable to read %s from the cache: %v\n", key, err)
+		return nil, false
+	}
+
+	if entry == nil {
+		return nil, false
+	}
+
+	u := &model.User{}
+
+	if err := json.Unmarshal(entry.Value, u); err != nil {
+		log.Printf("unable to decode %s from the cache: %v\n", key, err)
+		return nil, false
+	}
+
+	return u, entry.Fresh(time.Now())
+}
+
+// set caches u at key
+func (r *UserRepository) set(ctx context.Context, key string, u *model.User) {
+	value, err := json.Marshal(u)
+
+	if err != nil {
+		log.Printf("unable to encode %s for the cache: %v\n", key, err)
+		return
+	}
+
+	entry := &Entry{Value: value, FreshUntil: time.Now().Add(r.TTL)}
+
+	if err := r.Cache.Set(ctx, key, entry, r.TTL+r.StaleFor); err != nil {
+		log.Printf("unable to write %s to the cache: %v\n", key, err)
+	}
+}
+
+// begin records a read of the user cached at key
+func (r *UserRepository) begin(key string) *load {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.loads == nil {
+		r.loads = make(map[string]*load)
+	}
+
+	l := &load{}
+	r.loads[key] = l
+
+	return l
+}
+
+// end forgets the read l of the user cached at key
+func (r *UserRepository) end(key string, l *load) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.loads[key] == l {
+		delete(r.loads, key)
+	}
+}
+
+// finish ends the read l, caching the user u it read at key unless the
+// user changed in the meantime
+func (r *UserRepository) finish(ctx context.Context, key string, l *load, u *model.User) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.loads[key] == l {
+		delete(r.loads, key)
+	}
+
+	if !l.stale {
+		r.set(ctx, key, u)
+	}
+}
+
+// invalidate drops the entry of the user with the given id once the
+// transaction ctx runs within ends, changes committed or not, and marks the
+// read of that user in flight by then as stale
+func (r *UserRepository) invalidate(ctx context.Context, id string) {
+	uid, err := uuid.Parse(id)
+
+	if err != nil {
+		return
+	}
+
+	key := userKey(uid.String())
+
+	utils.AfterTx(ctx, func() {
+		r.mu.Lock()
+
+		if l, ok := r.loads[key]; ok {
+			l.stale = true
+		}
+
+		r.mu.Unlock()
+
+		// later reads must not join the stale one
+		r.group.Forget(key)
+
+		if err := r.Cache.Delete(detached{ctx}, key); err != nil {
+			log.Printf("unable to drop %s from the cache: %v\n", key, err)
+		}
+	})
+}
+
+// detached carries the values of a context, but neither its deadline nor
+// its cancellation
+type detached struct {
+	context.Context
+}
+
+func (detached) Deadline() (time.Time, bool) { return time.Time{}, false }
+
+func (detached) Done() <-chan struct{} { return nil }
+
+func (detached) Err() error { return nil }
+
+// userKey is the key the user with the given id is cached at
+func userKey(id string) string {
+	return "users:" + id
+}
@@ -0,0 +1,386 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/klasrak/users-api/mocks"
+	model "github.com/klasrak/users-api/models"
+	"github.com/klasrak/users-api/rerrors"
+	"github.com/klasrak/users-api/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestUserRepository(t *testing.T) {
+	ctx := context.Background()
+
+	newUser := func() *model.User {
+		return &model.User{
+			UID:       uuid.New(),
+			Name:      "João",
+			Email:     "joao@mail.com",
+			Cpf:       "313.716.772-80",
+			BirthDate: time.Date(1990, 1, 31, 0, 0, 0, 0, time.UTC),
+			Version:   1,
+		}
+	}
+
+	newRepository := func(users *mocks.MockUserRepository) *UserRepository {
+		return &UserRepository{
+			UserRepository: users,
+			Cache:          NewLRU(10),
+			TTL:            time.Minute,
+			StaleFor:       time.Hour,
+		}
+	}
+
+	// stale caches u as read an hour ago, TTL and all
+	stale := func(r *UserRepository, u *model.User) {
+		value, _ := json.Marshal(u)
+
+		r.Cache.Set(ctx, userKey(u.UID.String()), &Entry{Value: value, FreshUntil: time.Now().Add(-time.Hour)}, time.Hour)
+	}
+
+	t.Run("Serves fresh users from the cache", func(t *testing.T) {
+		users := new(mocks.MockUserRepository)
+		r := newRepository(users)
+
+		u := newUser()
+
+		users.On("GetByID", mock.Anything, u.UID, false).Return(u, nil).Once()
+
+		for i := 0; i < 3; i++ {
+			got, err := r.GetByID(ctx, u.UID, false)
+
+			assert.NoError(t, err)
+			assert.Equal(t, u, got)
+		}
+
+		users.AssertExpectations(t)
+	})
+
+	t.Run("Concurrent misses share a single read", func(t *testing.T) {
+		users := new(mocks.MockUserRepository)
+		r := newRepository(users)
+
+		u := newUser()
+		release := make(chan struct{})
+
+		users.On("GetByID", mock.Anything, u.UID, false).
+			Run(func(mock.Arguments) { <-release }).
+			Return(u, nil).
+			Once()
+
+		var wg sync.WaitGroup
+
+		got := make([]*model.User, 10)
+
+		for i := range got {
+			wg.Add(1)
+
+			go func(i int) {
+				defer wg.Done()
+				got[i], _ = r.GetByID(ctx, u.UID, false)
+			}(i)
+		}
+
+		time.Sleep(20 * time.Millisecond)
+		close(release)
+		wg.Wait()
+
+		for _, g := range got {
+			assert.Equal(t, u, g)
+		}
+
+		// every caller gets a user of its own
+		got[0].Name = "Maria"
+		assert.Equal(t, "João", got[1].Name)
+
+		users.AssertExpectations(t)
+	})
+
+	t.Run("Reads stale users again", func(t *testing.T) {
+		users := new(mocks.MockUserRepository)
+		r := newRepository(users)
+
+		u := newUser()
+		stale(r, u)
+
+		updated := *u
+		updated.Version = 2
+
+		users.On("GetByID", mock.Anything, u.UID, false).Return(&updated, nil).Once()
+
+		got, err := r.GetByID(ctx, u.UID, false)
+
+		assert.NoError(t, err)
+		assert.Equal(t, 2, got.Version)
+		users.AssertExpectations(t)
+	})
+
+	t.Run("Serves stale users when the repository fails", func(t *testing.T) {
+		users := new(mocks.MockUserRepository)
+		r := newRepository(users)
+
+		u := newUser()
+		stale(r, u)
+
+		users.On("GetByID", mock.Anything, u.UID, false).Return(nil, rerrors.NewInternal())
+
+		got, err := r.GetByID(ctx, u.UID, false)
+
+		assert.NoError(t, err)
+		assert.Equal(t, u, got)
+	})
+
+	t.Run("Doesn't hide users that are gone", func(t *testing.T) {
+		users := new(mocks.MockUserRepository)
+		r := newRepository(users)
+
+		u := newUser()
+		stale(r, u)
+
+		users.On("GetByID", mock.Anything, u.UID, false).Return(nil, rerrors.NewNotFound("id", u.UID.String()))
+
+		_, err := r.GetByID(ctx, u.UID, false)
+
+		assert.Equal(t, rerrors.NewNotFound("id", u.UID.String()), err)
+	})
+
+	t.Run("Failures without a cached user", func(t *testing.T) {
+		users := new(mocks.MockUserRepository)
+		r := newRepository(users)
+
+		id := uuid.New()
+
+		users.On("GetByID", mock.Anything, id, false).Return(nil, rerrors.NewInternal())
+
+		_, err := r.GetByID(ctx, id, false)
+
+		assert.Equal(t, rerrors.NewInternal(), err)
+	})
+
+	t.Run("Bypasses the cache", func(t *testing.T) {
+		users := new(mocks.MockUserRepository)
+		r := newRepository(users)
+
+		u := newUser()
+
+		users.On("GetByID", mock.Anything, u.UID, false).Return(u, nil).Once()
+		users.On("GetByID", mock.Anything, u.UID, true).Return(u, nil).Twice()
+
+		r.GetByID(ctx, u.UID, false)
+
+		// deleted users are never cached
+		r.GetByID(ctx, u.UID, true)
+		r.GetByID(ctx, u.UID, true)
+
+		users.On("GetByID", mock.Anything, u.UID, false).Return(u, nil).Once()
+
+		// reads that must see every write skip fresh entries
+		r.GetByID(utils.WithReadYourWrites(ctx), u.UID, false)
+
+		users.AssertExpectations(t)
+	})
+
+	t.Run("Cache fills read the primary", func(t *testing.T) {
+		users := new(mocks.MockUserRepository)
+		r := newRepository(users)
+
+		u := newUser()
+
+		primary := mock.MatchedBy(func(ctx context.Context) bool {
+			return utils.ReadYourWrites(ctx)
+		})
+
+		users.On("GetByID", primary, u.UID, false).Return(u, nil).Once()
+
+		_, err := r.GetByID(ctx, u.UID, false)
+
+		assert.NoError(t, err)
+		users.AssertExpectations(t)
+	})
+
+	t.Run("Changes drop cached users", func(t *testing.T) {
+		changes := map[string]func(r *UserRepository, users *mocks.MockUserRepository, u *model.User) error{
+			"Update": func(r *UserRepository, users *mocks.MockUserRepository, u *model.User) error {
+				users.On("Update", mock.Anything, u).Return(u, nil)
+				_, err := r.Update(ctx, u)
+				return err
+			},
+			"Delete": func(r *UserRepository, users *mocks.MockUserRepository, u *model.User) error {
+				users.On("Delete", mock.Anything, u.UID.String()).Return(nil)
+				return r.Delete(ctx, u.UID.String())
+			},
+			"Restore": func(r *UserRepository, users *mocks.MockUserRepository, u *model.User) error {
+				users.On("Restore", mock.Anything, u.UID.String()).Return(u, nil)
+				_, err := r.Restore(ctx, u.UID.String())
+				return err
+			},
+			"Purge": func(r *UserRepository, users *mocks.MockUserRepository, u *model.User) error {
+				users.On("Purge", mock.Anything, u.UID.String()).Return(nil)
+				return r.Purge(ctx, u.UID.String())
+			},
+		}
+
+		for name, change := range changes {
+			t.Run(name, func(t *testing.T) {
+				users := new(mocks.MockUserRepository)
+				r := newRepository(users)
+
+				u := newUser()
+
+				users.On("GetByID", mock.Anything, u.UID, false).Return(u, nil).Twice()
+
+				r.GetByID(ctx, u.UID, false)
+
+				assert.NoError(t, change(r, users, u))
+
+				r.GetByID(ctx, u.UID, false)
+
+				users.AssertExpectations(t)
+			})
+		}
+	})
+
+	t.Run("Changes drop cached users once transactions end", func(t *testing.T) {
+		users := new(mocks.MockUserRepository)
+		r := newRepository(users)
+
+		u := newUser()
+
+		users.On("GetByID", mock.Anything, u.UID, false).Return(u, nil).Once()
+		users.On("Update", mock.Anything, u).Return(u, nil)
+
+		r.GetByID(ctx, u.UID, false)
+
+		txCtx, ended := utils.WithTxEnd(ctx)
+
+		r.Update(txCtx, u)
+
+		// until the change is committed, others still read the user as it was
+		r.GetByID(ctx, u.UID, false)
+		users.AssertExpectations(t)
+
+		ended()
+
+		users.On("GetByID", mock.Anything, u.UID, false).Return(u, nil).Once()
+
+		r.GetByID(ctx, u.UID, false)
+
+		users.AssertExpectations(t)
+	})
+
+	t.Run("Failed changes drop cached users too", func(t *testing.T) {
+		users := new(mocks.MockUserRepository)
+		r := newRepository(users)
+
+		u := newUser()
+
+		users.On("GetByID", mock.Anything, u.UID, false).Return(u, nil).Twice()
+		users.On("Delete", mock.Anything, u.UID.String()).Return(rerrors.NewInternal())
+
+		r.GetByID(ctx, u.UID, false)
+
+		assert.Error(t, r.Delete(ctx, u.UID.String()))
+
+		r.GetByID(ctx, u.UID, false)
+
+		users.AssertExpectations(t)
+	})
+
+	t.Run("Reads racing with changes aren't cached", func(t *testing.T) {
+		users := new(mocks.MockUserRepository)
+		r := newRepository(users)
+
+		u := newUser()
+		reading, release := make(chan struct{}), make(chan struct{})
+
+		users.On("GetByID", mock.Anything, u.UID, false).
+			Run(func(mock.Arguments) {
+				close(reading)
+				<-release
+			}).
+			Return(u, nil).
+			Once()
+		users.On("Update", mock.Anything, u).Return(u, nil)
+
+		done := make(chan struct{})
+
+		go func() {
+			defer close(done)
+			r.GetByID(ctx, u.UID, false)
+		}()
+
+		<-reading
+
+		r.Update(ctx, u)
+
+		close(release)
+		<-done
+
+		users.On("GetByID", mock.Anything, u.UID, false).Return(u, nil).Once()
+
+		r.GetByID(ctx, u.UID, false)
+
+		users.AssertExpectations(t)
+	})
+
+	t.Run("Callers giving up don't fail the others", func(t *testing.T) {
+		users := new(mocks.MockUserRepository)
+		r := newRepository(users)
+
+		u := newUser()
+		reading, release := make(chan struct{}), make(chan struct{})
+
+		users.On("GetByID", mock.Anything, u.UID, false).
+			Run(func(mock.Arguments) {
+				close(reading)
+				<-release
+			}).
+			Return(u, nil).
+			Once()
+
+		first, cancel := context.WithCancel(ctx)
+
+		var firstErr error
+
+		done := make(chan struct{})
+
+		go func() {
+			defer close(done)
+			_, firstErr = r.GetByID(first, u.UID, false)
+		}()
+
+		<-reading
+
+		var (
+			got       *model.User
+			secondErr error
+		)
+
+		second := make(chan struct{})
+
+		go func() {
+			defer close(second)
+			got, secondErr = r.GetByID(ctx, u.UID, false)
+		}()
+
+		cancel()
+		<-done
+
+		assert.Equal(t, context.Canceled, firstErr)
+
+		close(release)
+		<-second
+
+		assert.NoError(t, secondErr)
+		assert.Equal(t, u, got)
+		users.AssertExpectations(t)
+	})
+}
@@ -1,60 +1,519 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/go-sql-driver/mysql"
 	"github.com/jmoiron/sqlx"
-	_ "github.com/lib/pq"
+	"github.com/klasrak/users-api/repository"
+	"github.com/lib/pq"
+)
+
+// defaultSQLitePath is where the SQLite database is kept when SQLITE_PATH is not set
+const defaultSQLitePath = "users.db"
+
+// Connection pool settings used when not set in the environment
+const (
+	defaultMaxOpenConns    = 25
+	defaultMaxIdleConns    = 10
+	defaultConnMaxLifetime = 30 * time.Minute
+	defaultConnMaxIdleTime = 5 * time.Minute
+)
+
+// defaultConnectTimeout is how long to wait at startup for the database to
+// accept connections when DATABASE_CONNECT_TIMEOUT is not set
+const defaultConnectTimeout = 30 * time.Second
+
+// Bounds of the delay between attempts to connect at startup, which doubles
+// after every failed attempt
+const (
+	minConnectDelay = 250 * time.Millisecond
+	maxConnectDelay = 5 * time.Second
 )
 
 type DatabaseSources struct {
 	DB *sqlx.DB
+	// Driver is the database DB is connected to, one of the repository
+	// package drivers
+	Driver string
+	// Replica is an optional read replica of DB, and ReplicaMaxLag how far
+	// behind DB it may fall before reads stop being sent to it
+	Replica       *sqlx.DB
+	ReplicaMaxLag time.Duration
+	// migrationDSN, when set, is where migrations connect to instead of
+	// DB, as the MySQL ones need statements holding several queries
+	migrationDSN string
 }
 
+// Initialize connects to the database at DATABASE_URL or, when it is not
+// set, to the one chosen by DATABASE_DRIVER: PostgreSQL (the default),
+// SQLite or MySQL, configured by their own variables. Every variable may be
+// read from a file instead (see envReader).
+//
+// Databases started along with the API may not accept connections right
+// away, so connecting is retried until DATABASE_CONNECT_TIMEOUT
 func (ds *DatabaseSources) Initialize() error {
 	log.Println("Connecting to database")
 
-	// ####### PostgreSQL #######
-	pgHost := os.Getenv("POSTGRES_HOST")
-	pgPort := os.Getenv("POSTGRES_PORT")
-	pgUser := os.Getenv("POSTGRES_USER")
-	pgPassword := os.Getenv("POSTGRES_PASSWORD")
-	pgDB := os.Getenv("POSTGRES_DATABASE")
-	pgSSL := os.Getenv("POSTGRES_SSL")
-
-	pgConnectionString := fmt.Sprintf(
-		"host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
-		pgHost,
-		pgPort,
-		pgUser,
-		pgPassword,
-		pgDB,
-		pgSSL,
+	var (
+		db  *sqlx.DB
+		err error
 	)
 
-	log.Println("Starting postgres connection")
-	db, err := sqlx.Open("postgres", pgConnectionString)
+	env := &envReader{}
+
+	ds.Driver = env.get("DATABASE_DRIVER")
+	databaseURL := env.get("DATABASE_URL")
+	pool := readPoolConfig(env)
+	connectTimeout := env.duration("DATABASE_CONNECT_TIMEOUT", defaultConnectTimeout)
+
+	if env.err != nil {
+		return env.err
+	}
+
+	if databaseURL != "" {
+		ds.Driver, db, err = ds.openURL(databaseURL, ds.Driver)
+	} else {
+		switch ds.Driver {
+		case repository.DriverPostgres, "":
+			ds.Driver = repository.DriverPostgres
+			db, err = openPostgres(env)
+
+		case repository.DriverSQLite:
+			db, err = openSQLite(env)
+
+		case repository.DriverMySQL:
+			db, err = ds.openMySQL(env)
+
+		default:
+			return fmt.Errorf(
+				"unknown DATABASE_DRIVER %q, expected %s, %s or %s",
+				ds.Driver,
+				repository.DriverPostgres,
+				repository.DriverSQLite,
+				repository.DriverMySQL,
+			)
+		}
+	}
 
 	if err != nil {
 		return fmt.Errorf("error opening db: %w", err)
 	}
 
+	pool.apply(db)
+
 	// Verify database connection is working
-	if err := db.Ping(); err != nil {
+	if err := waitForDB(db, connectTimeout); err != nil {
+		db.Close()
 		return fmt.Errorf("error connecting to db: %w", err)
 	}
 
 	ds.DB = db
 
+	if err := ds.initializeReplica(env); err != nil {
+		return err
+	}
+
+	if ds.Replica != nil {
+		pool.apply(ds.Replica)
+	}
+
 	return nil
 }
 
+// initializeReplica connects to the read replica at POSTGRES_REPLICA_DSN, if
+// any. Only the connection is opened: an unreachable replica is not an
+// error, reads go to the primary until it becomes healthy
+func (ds *DatabaseSources) initializeReplica(env *envReader) error {
+	dsn := env.get("POSTGRES_REPLICA_DSN")
+	maxLag := env.duration("POSTGRES_REPLICA_MAX_LAG", 0)
+
+	if env.err != nil {
+		return env.err
+	}
+
+	if dsn == "" {
+		return nil
+	}
+
+	if ds.Driver != repository.DriverPostgres {
+		return fmt.Errorf("POSTGRES_REPLICA_DSN is only supported with the %s driver", repository.DriverPostgres)
+	}
+
+	log.Println("Starting postgres replica connection")
+
+	replica, err := sqlx.Open("postgres", dsn)
+
+	if err != nil {
+		return fmt.Errorf("error opening replica: %w", err)
+	}
+
+	ds.Replica = replica
+	ds.ReplicaMaxLag = maxLag
+
+	return nil
+}
+
+// openURL opens the database at rawURL, whose scheme tells its driver:
+// postgres:// (or postgresql://), mysql:// or sqlite:// followed by the
+// path of the database file. driver, when set, must agree with the scheme
+func (ds *DatabaseSources) openURL(rawURL, driver string) (string, *sqlx.DB, error) {
+	u, err := url.Parse(rawURL)
+
+	if err != nil {
+		// the error would hold the URL, password included
+		return "", nil, errors.New("invalid DATABASE_URL")
+	}
+
+	schemes := map[string]string{
+		"postgres":   repository.DriverPostgres,
+		"postgresql": repository.DriverPostgres,
+		"mysql":      repository.DriverMySQL,
+		"sqlite":     repository.DriverSQLite,
+		"sqlite3":    repository.DriverSQLite,
+	}
+
+	urlDriver, ok := schemes[u.Scheme]
+
+	if !ok {
+		return "", nil, fmt.Errorf("unknown DATABASE_URL scheme %q, expected postgres, mysql or sqlite", u.Scheme)
+	}
+
+	if driver != "" && driver != urlDriver {
+		return "", nil, fmt.Errorf("DATABASE_DRIVER is %s, but DATABASE_URL points to a %s database", driver, urlDriver)
+	}
+
+	var db *sqlx.DB
+
+	switch urlDriver {
+	case repository.DriverPostgres:
+		log.Println("Starting postgres connection")
+		db, err = sqlx.Open("postgres", rawURL)
+
+	case repository.DriverMySQL:
+		cfg := mysql.NewConfig()
+
+		// the driver reads the remaining settings from the query
+		// string, as in its own data source names
+		if u.RawQuery != "" {
+			if cfg, err = mysql.ParseDSN("/?" + u.RawQuery); err != nil {
+				return "", nil, fmt.Errorf("invalid DATABASE_URL parameters: %w", err)
+			}
+		}
+
+		cfg.User = u.User.Username()
+		cfg.Passwd, _ = u.User.Password()
+		cfg.Net = "tcp"
+		cfg.Addr = u.Host
+		cfg.DBName = strings.TrimPrefix(u.Path, "/")
+
+		if u.Port() == "" {
+			cfg.Addr = net.JoinHostPort(u.Hostname(), "3306")
+		}
+
+		db, err = ds.openMySQLConfig(cfg)
+
+	case repository.DriverSQLite:
+		// sqlite://users.db and sqlite:///var/lib/users.db are relative
+		// and absolute paths, which URLs can't tell apart
+		path := strings.TrimPrefix(strings.TrimPrefix(rawURL, u.Scheme+":"), "//")
+
+		if i := strings.IndexByte(path, '?'); i >= 0 {
+			path = path[:i]
+		}
+
+		log.Printf("Opening sqlite database at %s\n", path)
+		db, err = sqlx.Open(repository.SQLiteDriver, repository.SQLiteDSN(path))
+	}
+
+	return urlDriver, db, err
+}
+
+func openPostgres(env *envReader) (*sqlx.DB, error) {
+	// ####### PostgreSQL #######
+	pgHost := env.get("POSTGRES_HOST")
+	pgPort := env.get("POSTGRES_PORT")
+	pgUser := env.get("POSTGRES_USER")
+	pgPassword := env.get("POSTGRES_PASSWORD")
+	pgDB := env.get("POSTGRES_DATABASE")
+	pgSSL := env.get("POSTGRES_SSL")
+
+	if env.err != nil {
+		return nil, env.err
+	}
+
+	// a URL escapes every part, so passwords may hold any character
+	pgURL := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(pgUser, pgPassword),
+		Host:     net.JoinHostPort(pgHost, pgPort),
+		Path:     "/" + pgDB,
+		RawQuery: url.Values{"sslmode": {pgSSL}}.Encode(),
+	}
+
+	log.Println("Starting postgres connection")
+	return sqlx.Open("postgres", pgURL.String())
+}
+
+func openSQLite(env *envReader) (*sqlx.DB, error) {
+	path := env.get("SQLITE_PATH")
+
+	if env.err != nil {
+		return nil, env.err
+	}
+
+	if path == "" {
+		path = defaultSQLitePath
+	}
+
+	log.Printf("Opening sqlite database at %s\n", path)
+	return sqlx.Open(repository.SQLiteDriver, repository.SQLiteDSN(path))
+}
+
+func (ds *DatabaseSources) openMySQL(env *envReader) (*sqlx.DB, error) {
+	// ####### MySQL #######
+	cfg := mysql.NewConfig()
+
+	cfg.User = env.get("MYSQL_USER")
+	cfg.Passwd = env.get("MYSQL_PASSWORD")
+	cfg.Net = "tcp"
+	cfg.Addr = net.JoinHostPort(env.get("MYSQL_HOST"), env.get("MYSQL_PORT"))
+	cfg.DBName = env.get("MYSQL_DATABASE")
+
+	if env.err != nil {
+		return nil, env.err
+	}
+
+	return ds.openMySQLConfig(cfg)
+}
+
+// openMySQLConfig opens the MySQL database cfg points to, and keeps where
+// migrations should connect to it
+func (ds *DatabaseSources) openMySQLConfig(cfg *mysql.Config) (*sqlx.DB, error) {
+	ds.migrationDSN = repository.MySQLMigrationDSN(cfg)
+
+	log.Println("Starting mysql connection")
+	return sqlx.Open("mysql", repository.MySQLDSN(cfg))
+}
+
+// migrationDB returns the database migrations run against, and a function
+// releasing it once they are done. It is DB itself, unless migrations need
+// a connection of their own
+func (ds *DatabaseSources) migrationDB() (*sqlx.DB, func(), error) {
+	if ds.migrationDSN == "" {
+		return ds.DB, func() {}, nil
+	}
+
+	db, err := sqlx.Open("mysql", ds.migrationDSN)
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("error opening db for migrations: %w", err)
+	}
+
+	// migrations run one at a time, on a single connection
+	db.SetMaxOpenConns(1)
+
+	return db, func() { db.Close() }, nil
+}
+
+// poolConfig holds the connection pool settings of a database
+type poolConfig struct {
+	maxOpenConns    int
+	maxIdleConns    int
+	connMaxLifetime time.Duration
+	connMaxIdleTime time.Duration
+}
+
+// readPoolConfig reads the connection pool settings from the environment
+func readPoolConfig(env *envReader) poolConfig {
+	return poolConfig{
+		maxOpenConns:    env.int("DATABASE_MAX_OPEN_CONNS", defaultMaxOpenConns),
+		maxIdleConns:    env.int("DATABASE_MAX_IDLE_CONNS", defaultMaxIdleConns),
+		connMaxLifetime: env.duration("DATABASE_CONN_MAX_LIFETIME", defaultConnMaxLifetime),
+		connMaxIdleTime: env.duration("DATABASE_CONN_MAX_IDLE_TIME", defaultConnMaxIdleTime),
+	}
+}
+
+// apply sets the pool of db up
+func (p poolConfig) apply(db *sqlx.DB) {
+	db.SetMaxOpenConns(p.maxOpenConns)
+	db.SetMaxIdleConns(p.maxIdleConns)
+	db.SetConnMaxLifetime(p.connMaxLifetime)
+	db.SetConnMaxIdleTime(p.connMaxIdleTime)
+}
+
+// waitForDB pings db until it accepts connections, waiting longer after
+// every failed attempt, and gives up after timeout. A wrong password or a
+// database that doesn't exist is not retried: the database is up, and
+// trying again won't help
+func waitForDB(db *sqlx.DB, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	delay := minConnectDelay
+
+	for attempt := 1; ; attempt++ {
+		err := db.PingContext(ctx)
+
+		if err == nil || isPermanent(err) {
+			return err
+		}
+
+		log.Printf("database is not available (attempt %d), retrying in %v: %v\n", attempt, delay, err)
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("database not available after %v: %w", timeout, err)
+		case <-time.After(delay):
+		}
+
+		if delay *= 2; delay > maxConnectDelay {
+			delay = maxConnectDelay
+		}
+	}
+}
+
+// isPermanent reports whether err, sent by the database server, tells that
+// connecting will keep failing, like invalid credentials or an unknown
+// database. A server starting up, out of connections or briefly unreachable
+// may still accept them later
+func isPermanent(err error) bool {
+	var pqErr *pq.Error
+
+	if errors.As(err, &pqErr) {
+		// 28: invalid authorization, 3D000: invalid catalog name
+		return pqErr.Code.Class() == "28" || pqErr.Code == "3D000"
+	}
+
+	var myErr *mysql.MySQLError
+
+	if errors.As(err, &myErr) {
+		// access denied, unknown database
+		return myErr.Number == 1045 || myErr.Number == 1049
+	}
+
+	return false
+}
+
 func (ds *DatabaseSources) Close() error {
 	if err := ds.DB.Close(); err != nil {
-		return fmt.Errorf("error closing postgres: %w", err)
+		return fmt.Errorf("error closing %s: %w", ds.Driver, err)
+	}
+
+	if ds.Replica != nil {
+		if err := ds.Replica.Close(); err != nil {
+			return fmt.Errorf("error closing %s replica: %w", ds.Driver, err)
+		}
 	}
 
 	return nil
 }
+
+// envReader reads configuration from environment variables, keeping the
+// first error found so it can be checked once after reading everything.
+//
+// Every variable NAME may be read from a file instead, whose path is set in
+// NAME_FILE, as Docker and Kubernetes mount secrets: e.g. with
+// POSTGRES_PASSWORD_FILE=/run/secrets/db-password the password never shows
+// up in the environment
+type envReader struct {
+	err error
+}
+
+// get returns the value of the variable name, or "" when it is not set
+func (e *envReader) get(name string) string {
+	value := os.Getenv(name)
+	file := os.Getenv(name + "_FILE")
+
+	if file == "" {
+		return value
+	}
+
+	if value != "" {
+		e.setErr(fmt.Errorf("only one of %s and %s_FILE may be set", name, name))
+		return ""
+	}
+
+	content, err := os.ReadFile(file)
+
+	if err != nil {
+		e.setErr(fmt.Errorf("error reading %s_FILE: %w", name, err))
+		return ""
+	}
+
+	// editors and echo leave a newline at the end of the file
+	return strings.TrimRight(string(content), "\r\n")
+}
+
+// int returns the value of the variable name as a number, or fallback when
+// it is not set
+func (e *envReader) int(name string, fallback int) int {
+	value := e.get(name)
+
+	if value == "" {
+		return fallback
+	}
+
+	n, err := strconv.Atoi(value)
+
+	if err != nil || n < 0 {
+		e.setErr(fmt.Errorf("invalid %s %q, expected a number", name, value))
+		return fallback
+	}
+
+	return n
+}
+
+// duration returns the value of the variable name as a duration, e.g. 30s,
+// or fallback when it is not set
+func (e *envReader) duration(name string, fallback time.Duration) time.Duration {
+	value := e.get(name)
+
+	if value == "" {
+		return fallback
+	}
+
+	d, err := time.ParseDuration(value)
+
+	if err != nil || d <= 0 {
+		e.setErr(fmt.Errorf("invalid %s %q, expected a duration like 30s", name, value))
+		return fallback
+	}
+
+	return d
+}
+
+// bool returns the value of the variable name as a boolean, e.g. true, or
+// fallback when it is not set
+func (e *envReader) bool(name string, fallback bool) bool {
+	value := e.get(name)
+
+	if value == "" {
+		return fallback
+	}
+
+	b, err := strconv.ParseBool(value)
+
+	if err != nil {
+		e.setErr(fmt.Errorf("invalid %s %q, expected true or false", name, value))
+		return fallback
+	}
+
+	return b
+}
+
+// setErr keeps err unless an error was found before
+func (e *envReader) setErr(err error) {
+	if e.err == nil {
+		e.err = err
+	}
+}
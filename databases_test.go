@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWaitForDB(t *testing.T) {
+	newDB := func(t *testing.T) (*sqlx.DB, sqlmock.Sqlmock) {
+		db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		}
+
+		sqlxDB := sqlx.NewDb(db, "sqlmock")
+
+		t.Cleanup(func() { sqlxDB.Close() })
+
+		return sqlxDB, mock
+	}
+
+	t.Run("Waits for a database starting up", func(t *testing.T) {
+		db, mock := newDB(t)
+
+		mock.ExpectPing().WillReturnError(&pq.Error{Code: "57P03", Message: "the database system is starting up"})
+		mock.ExpectPing()
+
+		assert.NoError(t, waitForDB(db, 5*time.Second))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Gives up on errors retrying won't fix", func(t *testing.T) {
+		for name, err := range map[string]error{
+			"wrong password":         &pq.Error{Code: "28P01"},
+			"unknown database":       &pq.Error{Code: "3D000"},
+			"mysql access denied":    &mysql.MySQLError{Number: 1045},
+			"mysql unknown database": &mysql.MySQLError{Number: 1049},
+		} {
+			t.Run(name, func(t *testing.T) {
+				db, mock := newDB(t)
+
+				mock.ExpectPing().WillReturnError(err)
+
+				assert.True(t, errors.Is(waitForDB(db, 5*time.Second), err))
+				assert.NoError(t, mock.ExpectationsWereMet())
+			})
+		}
+	})
+
+	t.Run("Gives up after the timeout", func(t *testing.T) {
+		db, mock := newDB(t)
+
+		for i := 0; i < 2; i++ {
+			mock.ExpectPing().WillReturnError(&pq.Error{Code: "53300", Message: "too many connections"})
+		}
+
+		assert.Error(t, waitForDB(db, 100*time.Millisecond))
+	})
+}
@@ -27,9 +27,133 @@ var doc = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
+        "/audit": {
+            "get": {
+                "description": "List the changes made to users, oldest first: who made each change, within which request,\nand the value of every changed field before and after it. Entries are hash-chained,\nso any tampering with the log can be detected. Requires the X-Admin-Token header.\nTo fetch the next page, pass the id of the last entry as after.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "audit"
+                ],
+                "summary": "List the audit log",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "only changes to this user",
+                        "name": "user_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "only changes made by this actor",
+                        "name": "actor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "only changes made at or after this time, in RFC3339 format",
+                        "name": "since",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "only entries after the entry with this id",
+                        "name": "after",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "page size (default 100, max 1000)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "admin token",
+                        "name": "X-Admin-Token",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/model.AuditPage"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request. Invalid filter or pagination",
+                        "schema": {
+                            "$ref": "#/definitions/rerrors.Error"
+                        }
+                    },
+                    "403": {
+                        "description": "Missing or invalid admin token",
+                        "schema": {
+                            "$ref": "#/definitions/rerrors.Error"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/rerrors.Error"
+                        }
+                    }
+                }
+            }
+        },
+        "/audit/verify": {
+            "get": {
+                "description": "Read the whole audit log, checking its hash chain: valid is false when any entry was changed,\nremoved or inserted since it was appended, and error tells the first one. Keep last_hash elsewhere\nto tell later whether entries were removed from the end. Requires the X-Admin-Token header.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "audit"
+                ],
+                "summary": "Verify the audit log",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "admin token",
+                        "name": "X-Admin-Token",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/model.AuditVerification"
+                        }
+                    },
+                    "403": {
+                        "description": "Missing or invalid admin token",
+                        "schema": {
+                            "$ref": "#/definitions/rerrors.Error"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/rerrors.Error"
+                        }
+                    }
+                }
+            }
+        },
         "/users": {
             "get": {
-                "description": "Fetch all users from database. Can filter by name.",
+                "description": "Fetch a page of users from database. Can filter by name or by a filter expression\ncombining comparisons on id, name, email, cpf and birthdate with and, or, not and parentheses.\nOperators: eq (=), ne (!=), gt (>), ge (>=), lt (<), le (<=), contains, starts_with, ends_with, between and in.\nPages are walked either by cursor (limit and cursor) or by offset (page and per_page).\nOffset pages include the total count, also sent in the X-Total-Count header.\nCan be sorted by id, name, email, cpf and birthdate. Names are sorted with pt-BR collation.\nDeleted users are only listed when include_deleted is true.",
                 "consumes": [
                     "application/json"
                 ],
@@ -46,20 +170,72 @@ var doc = `{
                         "description": "search by name",
                         "name": "name",
                         "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "filter expression, e.g. email ends_with '@acme.com.br' and birthdate between 1980-01-01 and 1990-12-31",
+                        "name": "filter",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "page size (default 50, max 1000)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "next_cursor returned by the previous page",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "page number, starting at 1",
+                        "name": "page",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "page size (default 50, max 1000)",
+                        "name": "per_page",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "comma separated fields to sort by, prefixed by - for descending order, e.g. name,-birthdate",
+                        "name": "sort",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "also list deleted users",
+                        "name": "include_deleted",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "array",
-                            "items": {
-                                "$ref": "#/definitions/model.User"
+                            "$ref": "#/definitions/model.UserPage"
+                        },
+                        "headers": {
+                            "Link": {
+                                "type": "string",
+                                "description": "RFC 8288 pagination links"
+                            },
+                            "X-Total-Count": {
+                                "type": "integer",
+                                "description": "total number of users, offset pagination only"
                             }
                         }
                     },
-                    "204": {
-                        "description": ""
+                    "400": {
+                        "description": "Bad Request. Invalid pagination, sort or filter",
+                        "schema": {
+                            "$ref": "#/definitions/rerrors.Error"
+                        }
                     },
                     "500": {
                         "description": "Internal Server Error",
@@ -97,6 +273,12 @@ var doc = `{
                         "description": "Created",
                         "schema": {
                             "$ref": "#/definitions/model.User"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "version of the user"
+                            }
                         }
                     },
                     "400": {
@@ -120,52 +302,146 @@ var doc = `{
                 }
             }
         },
-        "/users/{id}": {
+        "/users/export": {
             "get": {
-                "description": "Get a single user by ID",
+                "description": "Download every user matching the same filters as the listing, as CSV or newline delimited JSON.\nUsers are streamed as they are read from the database, with chunked encoding. The status is sent\nalong with the first user, so a failure after that is reported in the X-Export-Error trailer",
+                "produces": [
+                    "text/csv",
+                    "application/x-ndjson"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Export users",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "csv (default) or ndjson",
+                        "name": "format",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "search by name",
+                        "name": "name",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "filter expression, e.g. email ends_with '@acme.com.br' and birthdate between 1980-01-01 and 1990-12-31",
+                        "name": "filter",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "comma separated fields to sort by, prefixed by - for descending order, e.g. name,-birthdate",
+                        "name": "sort",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "also export deleted users",
+                        "name": "include_deleted",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Users",
+                        "schema": {
+                            "type": "file"
+                        },
+                        "headers": {
+                            "X-Export-Error": {
+                                "type": "string",
+                                "description": "trailer set when the export failed midway"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid format, filter or sort",
+                        "schema": {
+                            "$ref": "#/definitions/rerrors.Error"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/rerrors.Error"
+                        }
+                    }
+                }
+            }
+        },
+        "/users/import": {
+            "post": {
+                "description": "Create the users listed in a CSV file, one per line after a header line naming the columns.\nmapping is a JSON object telling which user field (name, email, cpf or birthdate) each column holds;\nwithout it columns must be named after the fields. Columns may be separated by commas or semicolons,\nand birthdates written as 2006-01-02 or 02/01/2006. Users are validated as in Create, and lines that\ncan't be imported are listed in the CSV report returned, with the reason. The rest are imported at once",
                 "consumes": [
-                    "application/json"
+                    "multipart/form-data"
                 ],
                 "produces": [
-                    "application/json"
+                    "text/csv"
                 ],
                 "tags": [
                     "user"
                 ],
-                "summary": "Get a single user by ID",
-                "operationId": "string",
+                "summary": "Import users from CSV",
                 "parameters": [
                     {
-                        "type": "string",
-                        "description": "User ID",
-                        "name": "id",
-                        "in": "path",
+                        "type": "file",
+                        "description": "CSV file",
+                        "name": "file",
+                        "in": "formData",
                         "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Field held by each column, as a JSON object",
+                        "name": "mapping",
+                        "in": "formData"
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "OK",
+                        "description": "Rejected lines, as CSV",
                         "schema": {
-                            "$ref": "#/definitions/model.User"
+                            "type": "file"
+                        },
+                        "headers": {
+                            "X-Imported-Count": {
+                                "type": "integer",
+                                "description": "number of users imported"
+                            },
+                            "X-Rejected-Count": {
+                                "type": "integer",
+                                "description": "number of lines rejected"
+                            }
                         }
                     },
                     "400": {
-                        "description": "Bad Request. Invalid ID",
+                        "description": "Missing or unreadable file, invalid mapping",
                         "schema": {
                             "$ref": "#/definitions/rerrors.Error"
                         }
                     },
-                    "404": {
-                        "description": "User Not Found",
+                    "409": {
+                        "description": "A user was taken while importing",
+                        "schema": {
+                            "$ref": "#/definitions/rerrors.Error"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
                         "schema": {
                             "$ref": "#/definitions/rerrors.Error"
                         }
                     }
                 }
-            },
-            "put": {
-                "description": "Update user",
+            }
+        },
+        "/users/search": {
+            "get": {
+                "description": "Full-text search over user names and e-mails, ignoring accents.\nEvery word is matched as a prefix, so partial names are found. Results are ranked by relevance\nand the matching parts of the name and e-mail are highlighted with <mark> tags.",
                 "consumes": [
                     "application/json"
                 ],
@@ -175,40 +451,34 @@ var doc = `{
                 "tags": [
                     "user"
                 ],
-                "summary": "Update user",
-                "operationId": "string",
+                "summary": "Search users",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "User ID",
-                        "name": "id",
-                        "in": "path",
+                        "description": "search terms",
+                        "name": "q",
+                        "in": "query",
                         "required": true
                     },
                     {
-                        "description": "Update user",
-                        "name": "user",
-                        "in": "body",
-                        "schema": {
-                            "$ref": "#/definitions/handlers.updatePayload"
-                        }
+                        "type": "integer",
+                        "description": "maximum number of results (default 20, max 100)",
+                        "name": "limit",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/model.User"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/model.UserSearchResult"
+                            }
                         }
                     },
                     "400": {
-                        "description": "Validation error",
-                        "schema": {
-                            "$ref": "#/definitions/rerrors.Error"
-                        }
-                    },
-                    "409": {
-                        "description": "Unique Violation",
+                        "description": "Bad Request. Missing search terms or invalid limit",
                         "schema": {
                             "$ref": "#/definitions/rerrors.Error"
                         }
@@ -220,9 +490,11 @@ var doc = `{
                         }
                     }
                 }
-            },
-            "delete": {
-                "description": "Delete user",
+            }
+        },
+        "/users/{id}": {
+            "get": {
+                "description": "Get a single user by ID. Deleted users are not found unless include_deleted is true.\nWith as_of, the user is returned as it was at that time, rebuilt from the audit log",
                 "consumes": [
                     "application/json"
                 ],
@@ -232,7 +504,7 @@ var doc = `{
                 "tags": [
                     "user"
                 ],
-                "summary": "Delete user",
+                "summary": "Get a single user by ID",
                 "operationId": "string",
                 "parameters": [
                     {
@@ -241,23 +513,1024 @@ var doc = `{
                         "name": "id",
                         "in": "path",
                         "required": true
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "also find deleted users",
+                        "name": "include_deleted",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "point in time to return the user as of, in RFC3339 format",
+                        "name": "as_of",
+                        "in": "query"
                     }
                 ],
                 "responses": {
-                    "204": {
-                        "description": ""
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/model.User"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "version of the user, to be sent back in If-Match when updating it. Not sent with as_of"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request. Invalid ID or as_of",
+                        "schema": {
+                            "$ref": "#/definitions/rerrors.Error"
+                        }
                     },
                     "404": {
                         "description": "User Not Found",
                         "schema": {
                             "$ref": "#/definitions/rerrors.Error"
                         }
-                    }
-                }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/rerrors.Error"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "description": "Replace every field of a user; to change only some of them, use PATCH. The If-Match header\nmust carry the ETag of the user being updated, so changes made by someone else in the meantime\nare never overwritten.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Update user",
+                "operationId": "string",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag of the user being updated",
+                        "name": "If-Match",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "Update user",
+                        "name": "user",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.updatePayload"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/model.User"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "new version of the user"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Validation error",
+                        "schema": {
+                            "$ref": "#/definitions/rerrors.Error"
+                        }
+                    },
+                    "404": {
+                        "description": "User Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/rerrors.Error"
+                        }
+                    },
+                    "409": {
+                        "description": "Unique Violation",
+                        "schema": {
+                            "$ref": "#/definitions/rerrors.Error"
+                        }
+                    },
+                    "412": {
+                        "description": "User changed since it was read",
+                        "schema": {
+                            "$ref": "#/definitions/rerrors.Error"
+                        }
+                    },
+                    "428": {
+                        "description": "Missing If-Match header",
+                        "schema": {
+                            "$ref": "#/definitions/rerrors.Error"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/rerrors.Error"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Mark a user as deleted. Deleted users can be restored until they are purged.\nWith purge=true the user is removed for good, which requires the X-Admin-Token header.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Delete user",
+                "operationId": "string",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "remove the user permanently (admin only)",
+                        "name": "purge",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "admin token, required to purge",
+                        "name": "X-Admin-Token",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": ""
+                    },
+                    "400": {
+                        "description": "Bad Request. Invalid ID",
+                        "schema": {
+                            "$ref": "#/definitions/rerrors.Error"
+                        }
+                    },
+                    "403": {
+                        "description": "Missing or invalid admin token",
+                        "schema": {
+                            "$ref": "#/definitions/rerrors.Error"
+                        }
+                    },
+                    "404": {
+                        "description": "User Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/rerrors.Error"
+                        }
+                    }
+                }
+            },
+            "patch": {
+                "description": "Change some fields of a user with a JSON Merge Patch (RFC 7396, sent as application/merge-patch+json)\nor a JSON Patch (RFC 6902, sent as application/json-patch+json). The patch applies to the user as\nreturned by GET, and the result must be a valid user. A failed JSON Patch test fails the whole patch\nwith a conflict. As with PUT, the If-Match header must carry the ETag of the user being patched.",
+                "consumes": [
+                    "application/merge-patch+json",
+                    "application/json-patch+json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Patch user",
+                "operationId": "string",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag of the user being patched",
+                        "name": "If-Match",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "Merge patch object or array of JSON Patch operations",
+                        "name": "patch",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "object"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/model.User"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "new version of the user"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid patch or patched user",
+                        "schema": {
+                            "$ref": "#/definitions/rerrors.Error"
+                        }
+                    },
+                    "404": {
+                        "description": "User Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/rerrors.Error"
+                        }
+                    },
+                    "409": {
+                        "description": "Failed test operation or unique violation",
+                        "schema": {
+                            "$ref": "#/definitions/rerrors.Error"
+                        }
+                    },
+                    "412": {
+                        "description": "User changed since it was read",
+                        "schema": {
+                            "$ref": "#/definitions/rerrors.Error"
+                        }
+                    },
+                    "415": {
+                        "description": "Unsupported patch format",
+                        "schema": {
+                            "$ref": "#/definitions/rerrors.Error"
+                        }
+                    },
+                    "428": {
+                        "description": "Missing If-Match header",
+                        "schema": {
+                            "$ref": "#/definitions/rerrors.Error"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/rerrors.Error"
+                        }
+                    }
+                }
+            }
+        },
+        "/users/{id}/history": {
+            "get": {
+                "description": "Get every version of a user, newest first, along with when, by whom and within which request it was\nchanged, and the value of every changed field before and after the change. Versions are rebuilt\nfrom the audit log, so changes made before it existed are not listed",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Get the history of a user",
+                "operationId": "string",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/model.UserHistory"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request. Invalid ID",
+                        "schema": {
+                            "$ref": "#/definitions/rerrors.Error"
+                        }
+                    },
+                    "404": {
+                        "description": "User Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/rerrors.Error"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/rerrors.Error"
+                        }
+                    }
+                }
+            }
+        },
+        "/users/{id}/restore": {
+            "post": {
+                "description": "Undo the deletion of a user",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Restore user",
+                "operationId": "string",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/model.User"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "version of the user"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request. Invalid ID",
+                        "schema": {
+                            "$ref": "#/definitions/rerrors.Error"
+                        }
+                    },
+                    "404": {
+                        "description": "Deleted User Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/rerrors.Error"
+                        }
+                    },
+                    "409": {
+                        "description": "E-mail or CPF taken by another user",
+                        "schema": {
+                            "$ref": "#/definitions/rerrors.Error"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/rerrors.Error"
+                        }
+                    }
+                }
+            }
+        },
+        "/users:batch": {
+            "post": {
+                "description": "Add several users to database, reporting the outcome of each of them in the order they were sent.\nUsers are validated as in Create. With atomic set, either every user is created or none is,\nand users left out because of another one fail with 424. Otherwise each user is created on its own",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Create users in batch",
+                "parameters": [
+                    {
+                        "description": "Add users",
+                        "name": "users",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.createBatchPayload"
+                        }
+                    }
+                ],
+                "responses": {
+                    "207": {
+                        "description": "Multi-Status",
+                        "schema": {
+                            "$ref": "#/definitions/model.BatchResults"
+                        }
+                    },
+                    "400": {
+                        "description": "Empty or too large batch",
+                        "schema": {
+                            "$ref": "#/definitions/rerrors.Error"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/rerrors.Error"
+                        }
+                    }
+                }
+            }
+        },
+        "/users:batchDelete": {
+            "post": {
+                "description": "Delete several users, picked either by id or with a filter expression as in user listings,\nreporting the outcome of each of them. Each user is deleted on its own, as in DELETE /users/{id}.\nWith dry_run set, nothing is written and the users that would have been deleted are reported",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Delete users in batch",
+                "parameters": [
+                    {
+                        "description": "Users",
+                        "name": "batch",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.batchDeletePayload"
+                        }
+                    }
+                ],
+                "responses": {
+                    "207": {
+                        "description": "Multi-Status",
+                        "schema": {
+                            "$ref": "#/definitions/model.BatchResults"
+                        }
+                    },
+                    "400": {
+                        "description": "Missing or too many users",
+                        "schema": {
+                            "$ref": "#/definitions/rerrors.Error"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/rerrors.Error"
+                        }
+                    }
+                }
+            }
+        },
+        "/users:batchUpdate": {
+            "post": {
+                "description": "Apply the same patch to several users, picked either by id or with a filter expression as in user listings,\nreporting the outcome of each of them. The patch is either a JSON Merge Patch object or a JSON Patch array,\nand each user is patched on its own, as in PATCH /users/{id} but regardless of its version.\nWith dry_run set, nothing is written and the changes that would have been made are reported",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Update users in batch",
+                "parameters": [
+                    {
+                        "description": "Users and patch",
+                        "name": "batch",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.batchUpdatePayload"
+                        }
+                    }
+                ],
+                "responses": {
+                    "207": {
+                        "description": "Multi-Status",
+                        "schema": {
+                            "$ref": "#/definitions/model.BatchResults"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid patch, missing or too many users",
+                        "schema": {
+                            "$ref": "#/definitions/rerrors.Error"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/rerrors.Error"
+                        }
+                    }
+                }
+            }
+        },
+        "/webhooks": {
+            "get": {
+                "description": "List the webhooks events are delivered to, oldest first, without their secrets.\nRequires the X-Admin-Token header.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "List webhooks",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "admin token",
+                        "name": "X-Admin-Token",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/model.Webhook"
+                            }
+                        }
+                    },
+                    "403": {
+                        "description": "Missing or invalid admin token",
+                        "schema": {
+                            "$ref": "#/definitions/rerrors.Error"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/rerrors.Error"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Subscribe an http or https endpoint to events: user.created, user.updated and user.deleted.\nEvery delivery is POSTed with an X-Webhook-Signature header, sha256= followed by the hex encoded\nHMAC-SHA256 of the body keyed with the secret of the webhook, which is only returned here.\nRequires the X-Admin-Token header.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "Create webhook",
+                "parameters": [
+                    {
+                        "description": "Add webhook",
+                        "name": "webhook",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/model.WebhookParams"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "admin token",
+                        "name": "X-Admin-Token",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/model.Webhook"
+                        }
+                    },
+                    "400": {
+                        "description": "Validation error",
+                        "schema": {
+                            "$ref": "#/definitions/rerrors.Error"
+                        }
+                    },
+                    "403": {
+                        "description": "Missing or invalid admin token",
+                        "schema": {
+                            "$ref": "#/definitions/rerrors.Error"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/rerrors.Error"
+                        }
+                    }
+                }
+            }
+        },
+        "/webhooks/{id}": {
+            "get": {
+                "description": "Get a webhook, without its secret. Requires the X-Admin-Token header.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "Get webhook",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Webhook ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "admin token",
+                        "name": "X-Admin-Token",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/model.Webhook"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request. Invalid ID",
+                        "schema": {
+                            "$ref": "#/definitions/rerrors.Error"
+                        }
+                    },
+                    "403": {
+                        "description": "Missing or invalid admin token",
+                        "schema": {
+                            "$ref": "#/definitions/rerrors.Error"
+                        }
+                    },
+                    "404": {
+                        "description": "Webhook Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/rerrors.Error"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "description": "Replace the URL and events of a webhook. Set active to false to disable it, or to true to enable it\nagain, which clears its failures and resumes its pending deliveries. Requires the X-Admin-Token header.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "Update webhook",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Webhook ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Update webhook",
+                        "name": "webhook",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/model.WebhookParams"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "admin token",
+                        "name": "X-Admin-Token",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/model.Webhook"
+                        }
+                    },
+                    "400": {
+                        "description": "Validation error",
+                        "schema": {
+                            "$ref": "#/definitions/rerrors.Error"
+                        }
+                    },
+                    "403": {
+                        "description": "Missing or invalid admin token",
+                        "schema": {
+                            "$ref": "#/definitions/rerrors.Error"
+                        }
+                    },
+                    "404": {
+                        "description": "Webhook Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/rerrors.Error"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Remove a webhook along with its deliveries. Requires the X-Admin-Token header.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "Delete webhook",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Webhook ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "admin token",
+                        "name": "X-Admin-Token",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": ""
+                    },
+                    "400": {
+                        "description": "Bad Request. Invalid ID",
+                        "schema": {
+                            "$ref": "#/definitions/rerrors.Error"
+                        }
+                    },
+                    "403": {
+                        "description": "Missing or invalid admin token",
+                        "schema": {
+                            "$ref": "#/definitions/rerrors.Error"
+                        }
+                    },
+                    "404": {
+                        "description": "Webhook Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/rerrors.Error"
+                        }
+                    }
+                }
+            }
+        },
+        "/webhooks/{id}/deliveries": {
+            "get": {
+                "description": "List the deliveries of events to a webhook, newest first, with the outcome of their last attempt.\nTo fetch the next page, pass the created_at of the last delivery as before.\nRequires the X-Admin-Token header.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "List webhook deliveries",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Webhook ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "only deliveries in this status: pending, succeeded or failed",
+                        "name": "status",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "only deliveries created before this time, in RFC3339 format",
+                        "name": "before",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "page size (default 50, max 1000)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "admin token",
+                        "name": "X-Admin-Token",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/model.WebhookDeliveryPage"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request. Invalid filter or pagination",
+                        "schema": {
+                            "$ref": "#/definitions/rerrors.Error"
+                        }
+                    },
+                    "403": {
+                        "description": "Missing or invalid admin token",
+                        "schema": {
+                            "$ref": "#/definitions/rerrors.Error"
+                        }
+                    },
+                    "404": {
+                        "description": "Webhook Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/rerrors.Error"
+                        }
+                    }
+                }
+            }
+        },
+        "/webhooks/{id}/deliveries/{delivery_id}/redeliver": {
+            "post": {
+                "description": "Deliver the event of a delivery to its webhook again, as a new delivery. Requires the X-Admin-Token header.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "Redeliver event",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Webhook ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Delivery ID",
+                        "name": "delivery_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "admin token",
+                        "name": "X-Admin-Token",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/model.WebhookDelivery"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request. Invalid ID",
+                        "schema": {
+                            "$ref": "#/definitions/rerrors.Error"
+                        }
+                    },
+                    "403": {
+                        "description": "Missing or invalid admin token",
+                        "schema": {
+                            "$ref": "#/definitions/rerrors.Error"
+                        }
+                    },
+                    "404": {
+                        "description": "Delivery Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/rerrors.Error"
+                        }
+                    }
+                }
             }
         }
     },
     "definitions": {
+        "handlers.batchDeletePayload": {
+            "type": "object",
+            "properties": {
+                "dry_run": {
+                    "type": "boolean"
+                },
+                "filter": {
+                    "type": "string"
+                },
+                "ids": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "handlers.batchUpdatePayload": {
+            "type": "object",
+            "required": [
+                "patch"
+            ],
+            "properties": {
+                "dry_run": {
+                    "type": "boolean"
+                },
+                "filter": {
+                    "type": "string"
+                },
+                "ids": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "patch": {
+                    "type": "object"
+                }
+            }
+        },
+        "handlers.createBatchPayload": {
+            "type": "object",
+            "required": [
+                "users"
+            ],
+            "properties": {
+                "atomic": {
+                    "type": "boolean"
+                },
+                "users": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/handlers.createPayload"
+                    }
+                }
+            }
+        },
         "handlers.createPayload": {
             "type": "object",
             "required": [
@@ -283,6 +1556,12 @@ var doc = `{
         },
         "handlers.updatePayload": {
             "type": "object",
+            "required": [
+                "birthdate",
+                "cpf",
+                "email",
+                "name"
+            ],
             "properties": {
                 "birthdate": {
                     "type": "string"
@@ -298,6 +1577,123 @@ var doc = `{
                 }
             }
         },
+        "model.AuditEntry": {
+            "type": "object",
+            "properties": {
+                "action": {
+                    "type": "string"
+                },
+                "actor": {
+                    "type": "string"
+                },
+                "changes": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "$ref": "#/definitions/model.FieldChange"
+                    }
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "hash": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "prev_hash": {
+                    "type": "string"
+                },
+                "request_id": {
+                    "type": "string"
+                },
+                "user_id": {
+                    "type": "string"
+                }
+            }
+        },
+        "model.AuditPage": {
+            "type": "object",
+            "properties": {
+                "data": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.AuditEntry"
+                    }
+                }
+            }
+        },
+        "model.AuditVerification": {
+            "type": "object",
+            "properties": {
+                "entries": {
+                    "type": "integer"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "last_hash": {
+                    "type": "string"
+                },
+                "valid": {
+                    "type": "boolean"
+                }
+            }
+        },
+        "model.BatchResult": {
+            "type": "object",
+            "properties": {
+                "changes": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "$ref": "#/definitions/model.FieldChange"
+                    }
+                },
+                "error": {
+                    "$ref": "#/definitions/rerrors.Error"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "index": {
+                    "type": "integer"
+                },
+                "status": {
+                    "type": "integer"
+                }
+            }
+        },
+        "model.BatchResults": {
+            "type": "object",
+            "properties": {
+                "data": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.BatchResult"
+                    }
+                },
+                "dry_run": {
+                    "type": "boolean"
+                },
+                "failed": {
+                    "type": "integer"
+                },
+                "succeeded": {
+                    "type": "integer"
+                }
+            }
+        },
+        "model.FieldChange": {
+            "type": "object",
+            "properties": {
+                "after": {
+                    "type": "string"
+                },
+                "before": {
+                    "type": "string"
+                }
+            }
+        },
         "model.User": {
             "type": "object",
             "properties": {
@@ -307,14 +1703,226 @@ var doc = `{
                 "cpf": {
                     "type": "string"
                 },
+                "deleted_at": {
+                    "type": "string"
+                },
+                "email": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "version": {
+                    "type": "integer"
+                }
+            }
+        },
+        "model.UserHistory": {
+            "type": "object",
+            "properties": {
+                "data": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.UserRevision"
+                    }
+                }
+            }
+        },
+        "model.UserPage": {
+            "type": "object",
+            "properties": {
+                "data": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.User"
+                    }
+                },
+                "next_cursor": {
+                    "type": "string"
+                },
+                "page": {
+                    "type": "integer"
+                },
+                "per_page": {
+                    "type": "integer"
+                },
+                "total": {
+                    "type": "integer"
+                }
+            }
+        },
+        "model.UserRevision": {
+            "type": "object",
+            "properties": {
+                "action": {
+                    "type": "string"
+                },
+                "actor": {
+                    "type": "string"
+                },
+                "changed_at": {
+                    "type": "string"
+                },
+                "changes": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "$ref": "#/definitions/model.FieldChange"
+                    }
+                },
+                "request_id": {
+                    "type": "string"
+                },
+                "user": {
+                    "$ref": "#/definitions/model.User"
+                }
+            }
+        },
+        "model.UserSearchResult": {
+            "type": "object",
+            "properties": {
+                "birthdate": {
+                    "type": "string"
+                },
+                "cpf": {
+                    "type": "string"
+                },
+                "deleted_at": {
+                    "type": "string"
+                },
                 "email": {
                     "type": "string"
                 },
+                "email_highlight": {
+                    "type": "string"
+                },
                 "id": {
                     "type": "string"
                 },
                 "name": {
                     "type": "string"
+                },
+                "name_highlight": {
+                    "type": "string"
+                },
+                "rank": {
+                    "type": "number"
+                },
+                "version": {
+                    "type": "integer"
+                }
+            }
+        },
+        "model.Webhook": {
+            "type": "object",
+            "properties": {
+                "active": {
+                    "type": "boolean"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "disabled_reason": {
+                    "type": "string"
+                },
+                "events": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "failures": {
+                    "type": "integer"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "secret": {
+                    "type": "string"
+                },
+                "updated_at": {
+                    "type": "string"
+                },
+                "url": {
+                    "type": "string"
+                }
+            }
+        },
+        "model.WebhookDelivery": {
+            "type": "object",
+            "properties": {
+                "attempts": {
+                    "type": "integer"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "delivered_at": {
+                    "type": "string"
+                },
+                "event_id": {
+                    "type": "string"
+                },
+                "event_type": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "last_error": {
+                    "type": "string"
+                },
+                "next_attempt_at": {
+                    "type": "string"
+                },
+                "payload": {
+                    "type": "object"
+                },
+                "redelivery_of": {
+                    "type": "string"
+                },
+                "response_code": {
+                    "type": "integer"
+                },
+                "status": {
+                    "type": "string"
+                },
+                "webhook_id": {
+                    "type": "string"
+                }
+            }
+        },
+        "model.WebhookDeliveryPage": {
+            "type": "object",
+            "properties": {
+                "data": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.WebhookDelivery"
+                    }
+                }
+            }
+        },
+        "model.WebhookParams": {
+            "type": "object",
+            "required": [
+                "events",
+                "url"
+            ],
+            "properties": {
+                "active": {
+                    "type": "boolean"
+                },
+                "events": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "url": {
+                    "type": "string"
                 }
             }
         },
@@ -0,0 +1,95 @@
+// Package filter implements the small expression language accepted by the
+// filter parameter of listings, e.g.
+//
+//	email ends_with "@acme.com.br" and birthdate between 1980-01-01 and 1990-12-31
+//
+// Expressions are parsed into an AST which storage backends compile into
+// their own query language. Positions are 1-based byte offsets into the
+// expression, used to point clients at the offending token
+package filter
+
+// Operators supported by comparisons
+const (
+	Eq         = "eq"
+	Ne         = "ne"
+	Gt         = "gt"
+	Ge         = "ge"
+	Lt         = "lt"
+	Le         = "le"
+	Contains   = "contains"
+	StartsWith = "starts_with"
+	EndsWith   = "ends_with"
+	Between    = "between"
+	In         = "in"
+)
+
+// symbols maps the symbolic spelling of operators to their names
+var symbols = map[string]string{
+	"=":  Eq,
+	"==": Eq,
+	"!=": Ne,
+	"<>": Ne,
+	">":  Gt,
+	">=": Ge,
+	"<":  Lt,
+	"<=": Le,
+}
+
+// operators is the set of operator names
+var operators = map[string]bool{
+	Eq: true, Ne: true, Gt: true, Ge: true, Lt: true, Le: true,
+	Contains: true, StartsWith: true, EndsWith: true, Between: true, In: true,
+}
+
+// Node is a node of a parsed filter expression
+type Node interface {
+	Pos() int
+}
+
+// And matches when both sides match
+type And struct {
+	Left, Right Node
+	At          int
+}
+
+// Or matches when either side matches
+type Or struct {
+	Left, Right Node
+	At          int
+}
+
+// Not matches when Expr does not match
+type Not struct {
+	Expr Node
+	At   int
+}
+
+// Comparison compares a field against one or more values. Between has two
+// values, In has one or more and every other operator has exactly one
+type Comparison struct {
+	Field  string
+	At     int
+	Op     string
+	OpAt   int
+	Values []Value
+}
+
+// Value is a literal in a comparison. Quoted tells whether it was written as
+// a quoted string rather than a bare word such as a date or a number
+type Value struct {
+	Text   string
+	Quoted bool
+	At     int
+}
+
+// Pos returns the position of the node
+func (n *And) Pos() int { return n.At }
+
+// Pos returns the position of the node
+func (n *Or) Pos() int { return n.At }
+
+// Pos returns the position of the node
+func (n *Not) Pos() int { return n.At }
+
+// Pos returns the position of the node
+func (n *Comparison) Pos() int { return n.At }
@@ -0,0 +1,117 @@
+package filter
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokWord
+	tokString
+	tokSymbol
+	tokLParen
+	tokRParen
+	tokComma
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// lex splits an expression into tokens
+func lex(s string) ([]token, error) {
+	var tokens []token
+
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+
+		switch {
+		case unicode.IsSpace(r):
+			i += size
+
+		case r == '(':
+			tokens = append(tokens, token{tokLParen, "(", i + 1})
+			i++
+
+		case r == ')':
+			tokens = append(tokens, token{tokRParen, ")", i + 1})
+			i++
+
+		case r == ',':
+			tokens = append(tokens, token{tokComma, ",", i + 1})
+			i++
+
+		case r == '"' || r == '\'':
+			text, n, err := lexString(s[i:], r, i+1)
+
+			if err != nil {
+				return nil, err
+			}
+
+			tokens = append(tokens, token{tokString, text, i + 1})
+			i += n
+
+		case strings.ContainsRune("=!<>", r):
+			n := 1
+
+			if i+1 < len(s) && strings.ContainsRune("=>", rune(s[i+1])) {
+				n = 2
+			}
+
+			tokens = append(tokens, token{tokSymbol, s[i : i+n], i + 1})
+			i += n
+
+		case isWordRune(r):
+			start := i
+
+			for i < len(s) {
+				r, size := utf8.DecodeRuneInString(s[i:])
+
+				if !isWordRune(r) {
+					break
+				}
+
+				i += size
+			}
+
+			tokens = append(tokens, token{tokWord, s[start:i], start + 1})
+
+		default:
+			return nil, errorf(i+1, "unexpected character %q", r)
+		}
+	}
+
+	return append(tokens, token{tokEOF, "", len(s) + 1}), nil
+}
+
+// lexString reads a string quoted by quote, where backslash escapes the next
+// character. It returns the unquoted text and the number of bytes consumed
+func lexString(s string, quote rune, pos int) (string, int, error) {
+	var b strings.Builder
+
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\' && i+1 < len(s):
+			i++
+			b.WriteByte(s[i])
+		case rune(c) == quote:
+			return b.String(), i + 1, nil
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	return "", 0, errorf(pos, "unterminated string")
+}
+
+// isWordRune reports whether r can be part of a bare word: field names,
+// keywords, operators, numbers, dates and unquoted values
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("_-.:@+", r)
+}
@@ -0,0 +1,286 @@
+package filter
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/klasrak/users-api/rerrors"
+)
+
+// MaxLength is the longest expression Parse accepts
+const MaxLength = 2048
+
+// Parse parses a filter expression. The grammar, from lowest to highest
+// precedence, is:
+//
+//	expr       = and { "or" and }
+//	and        = unary { "and" unary }
+//	unary      = "not" unary | "(" expr ")" | comparison
+//	comparison = field op value
+//	           | field "between" value "and" value
+//	           | field "in" "(" value { "," value } ")"
+//
+// Keywords and operators are case insensitive. Errors are rerrors.BadRequest
+// and carry the position of the offending token
+func Parse(s string) (Node, error) {
+	if len(s) > MaxLength {
+		return nil, errorf(MaxLength+1, "filter is longer than %d characters", MaxLength)
+	}
+
+	tokens, err := lex(s)
+
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+
+	if p.peek().kind == tokEOF {
+		return nil, errorf(1, "empty filter")
+	}
+
+	n, err := p.parseOr()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, errorf(t.pos, "unexpected %s", describe(t))
+	}
+
+	return n, nil
+}
+
+// Errorf creates a rerrors.BadRequest pointing at position pos of the filter.
+// It's exported so that backends report compile errors the same way
+func Errorf(pos int, format string, args ...interface{}) *rerrors.Error {
+	return errorf(pos, format, args...)
+}
+
+func errorf(pos int, format string, args ...interface{}) *rerrors.Error {
+	return rerrors.NewBadRequest(fmt.Sprintf("invalid filter at position %d: %s", pos, fmt.Sprintf(format, args...)))
+}
+
+type parser struct {
+	tokens []token
+	i      int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.i]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.i]
+
+	if t.kind != tokEOF {
+		p.i++
+	}
+
+	return t
+}
+
+// keyword reports whether the next token is the bare word kw, consuming it if so
+func (p *parser) keyword(kw string) (token, bool) {
+	t := p.peek()
+
+	if t.kind == tokWord && strings.EqualFold(t.text, kw) {
+		return p.next(), true
+	}
+
+	return t, false
+}
+
+func (p *parser) parseOr() (Node, error) {
+	left, err := p.parseAnd()
+
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		t, ok := p.keyword("or")
+
+		if !ok {
+			return left, nil
+		}
+
+		right, err := p.parseAnd()
+
+		if err != nil {
+			return nil, err
+		}
+
+		left = &Or{Left: left, Right: right, At: t.pos}
+	}
+}
+
+func (p *parser) parseAnd() (Node, error) {
+	left, err := p.parseUnary()
+
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		t, ok := p.keyword("and")
+
+		if !ok {
+			return left, nil
+		}
+
+		right, err := p.parseUnary()
+
+		if err != nil {
+			return nil, err
+		}
+
+		left = &And{Left: left, Right: right, At: t.pos}
+	}
+}
+
+func (p *parser) parseUnary() (Node, error) {
+	if t, ok := p.keyword("not"); ok {
+		n, err := p.parseUnary()
+
+		if err != nil {
+			return nil, err
+		}
+
+		return &Not{Expr: n, At: t.pos}, nil
+	}
+
+	if t := p.peek(); t.kind == tokLParen {
+		p.next()
+
+		n, err := p.parseOr()
+
+		if err != nil {
+			return nil, err
+		}
+
+		if t := p.next(); t.kind != tokRParen {
+			return nil, errorf(t.pos, "expected \")\" but found %s", describe(t))
+		}
+
+		return n, nil
+	}
+
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (Node, error) {
+	field := p.next()
+
+	if field.kind != tokWord || isKeyword(field.text) {
+		return nil, errorf(field.pos, "expected a field name but found %s", describe(field))
+	}
+
+	opTok := p.next()
+
+	var op string
+
+	switch {
+	case opTok.kind == tokSymbol && symbols[opTok.text] != "":
+		op = symbols[opTok.text]
+	case opTok.kind == tokWord && operators[strings.ToLower(opTok.text)]:
+		op = strings.ToLower(opTok.text)
+	case opTok.kind == tokEOF:
+		return nil, errorf(opTok.pos, "expected an operator after %q", field.text)
+	default:
+		return nil, errorf(opTok.pos, "unknown operator %q", opTok.text)
+	}
+
+	c := &Comparison{Field: field.text, At: field.pos, Op: op, OpAt: opTok.pos}
+
+	switch op {
+	case Between:
+		low, err := p.parseValue()
+
+		if err != nil {
+			return nil, err
+		}
+
+		if t, ok := p.keyword("and"); !ok {
+			return nil, errorf(t.pos, "expected \"and\" in between but found %s", describe(t))
+		}
+
+		high, err := p.parseValue()
+
+		if err != nil {
+			return nil, err
+		}
+
+		c.Values = []Value{low, high}
+
+	case In:
+		if t := p.next(); t.kind != tokLParen {
+			return nil, errorf(t.pos, "expected \"(\" after in but found %s", describe(t))
+		}
+
+		for {
+			v, err := p.parseValue()
+
+			if err != nil {
+				return nil, err
+			}
+
+			c.Values = append(c.Values, v)
+
+			t := p.next()
+
+			if t.kind == tokRParen {
+				break
+			}
+
+			if t.kind != tokComma {
+				return nil, errorf(t.pos, "expected \",\" or \")\" but found %s", describe(t))
+			}
+		}
+
+	default:
+		v, err := p.parseValue()
+
+		if err != nil {
+			return nil, err
+		}
+
+		c.Values = []Value{v}
+	}
+
+	return c, nil
+}
+
+func (p *parser) parseValue() (Value, error) {
+	t := p.next()
+
+	switch {
+	case t.kind == tokString:
+		return Value{Text: t.text, Quoted: true, At: t.pos}, nil
+	case t.kind == tokWord && !isKeyword(t.text):
+		return Value{Text: t.text, At: t.pos}, nil
+	default:
+		return Value{}, errorf(t.pos, "expected a value but found %s", describe(t))
+	}
+}
+
+func isKeyword(s string) bool {
+	switch strings.ToLower(s) {
+	case "and", "or", "not":
+		return true
+	}
+
+	return false
+}
+
+func describe(t token) string {
+	switch t.kind {
+	case tokEOF:
+		return "end of filter"
+	case tokString:
+		return fmt.Sprintf("string %q", t.text)
+	default:
+		return fmt.Sprintf("%q", t.text)
+	}
+}
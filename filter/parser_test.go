@@ -0,0 +1,87 @@
+package filter
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/klasrak/users-api/rerrors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	t.Run("Success comparisons joined by and", func(t *testing.T) {
+		n, err := Parse(`email ends_with "@acme.com.br" and birthdate between 1980-01-01 and 1990-12-31`)
+
+		assert.NoError(t, err)
+		assert.Equal(t, &And{
+			Left: &Comparison{
+				Field: "email", At: 1, Op: EndsWith, OpAt: 7,
+				Values: []Value{{Text: "@acme.com.br", Quoted: true, At: 17}},
+			},
+			Right: &Comparison{
+				Field: "birthdate", At: 36, Op: Between, OpAt: 46,
+				Values: []Value{{Text: "1980-01-01", At: 54}, {Text: "1990-12-31", At: 69}},
+			},
+			At: 32,
+		}, n)
+	})
+
+	t.Run("Success precedence and grouping", func(t *testing.T) {
+		n, err := Parse(`name = 'Ana' or name = "Bia" and not (cpf != 1)`)
+
+		assert.NoError(t, err)
+
+		or, ok := n.(*Or)
+
+		assert.True(t, ok)
+		assert.Equal(t, "Ana", or.Left.(*Comparison).Values[0].Text)
+
+		and, ok := or.Right.(*And)
+
+		assert.True(t, ok)
+		assert.Equal(t, Ne, and.Right.(*Not).Expr.(*Comparison).Op)
+	})
+
+	t.Run("Success in list and escaped quotes", func(t *testing.T) {
+		n, err := Parse(`name IN ("Ana \"Bia\"", 'Zé')`)
+
+		assert.NoError(t, err)
+
+		c := n.(*Comparison)
+
+		assert.Equal(t, In, c.Op)
+		assert.Equal(t, []Value{{Text: `Ana "Bia"`, Quoted: true, At: 10}, {Text: "Zé", Quoted: true, At: 25}}, c.Values)
+	})
+
+	t.Run("Success symbolic operators", func(t *testing.T) {
+		for symbol, op := range symbols {
+			n, err := Parse("birthdate" + symbol + "1990-01-01")
+
+			assert.NoError(t, err)
+			assert.Equal(t, op, n.(*Comparison).Op)
+		}
+	})
+
+	t.Run("Errors report the position of the bad token", func(t *testing.T) {
+		for expr, message := range map[string]string{
+			``:                               "invalid filter at position 1: empty filter",
+			`name like "x"`:                  `invalid filter at position 6: unknown operator "like"`,
+			`name = "x" and`:                 "invalid filter at position 15: expected a field name but found end of filter",
+			`name = "x`:                      "invalid filter at position 8: unterminated string",
+			`(name = "x"`:                    `invalid filter at position 12: expected ")" but found end of filter`,
+			`name = "x")`:                    `invalid filter at position 11: unexpected ")"`,
+			`birthdate between 1 or 2`:       `invalid filter at position 21: expected "and" in between but found "or"`,
+			`name in "x"`:                    `invalid filter at position 9: expected "(" after in but found string "x"`,
+			`name = x; drop table users`:     `invalid filter at position 9: unexpected character ';'`,
+			`name`:                           `invalid filter at position 5: expected an operator after "name"`,
+			`name = and`:                     `invalid filter at position 8: expected a value but found "and"`,
+			strings.Repeat("a", MaxLength+1): "invalid filter at position 2049: filter is longer than 2048 characters",
+		} {
+			_, err := Parse(expr)
+
+			assert.Error(t, err, expr)
+			assert.Equal(t, rerrors.BadRequest, err.(*rerrors.Error).Type)
+			assert.Equal(t, "Bad request. Reason: "+message, err.Error(), expr)
+		}
+	})
+}
@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	model "github.com/klasrak/users-api/models"
+	"github.com/klasrak/users-api/rerrors"
+)
+
+// ListAudit godoc
+// @Summary List the audit log
+// @Description List the changes made to users, oldest first: who made each change, within which request,
+// @Description and the value of every changed field before and after it. Entries are hash-chained,
+// @Description so any tampering with the log can be detected. Requires the X-Admin-Token header.
+// @Description To fetch the next page, pass the id of the last entry as after.
+// @Tags audit
+// @Accept  json
+// @Produce  json
+// @Param user_id query string false "only changes to this user"
+// @Param actor query string false "only changes made by this actor"
+// @Param since query string false "only changes made at or after this time, in RFC3339 format"
+// @Param after query int false "only entries after the entry with this id"
+// @Param limit query int false "page size (default 100, max 1000)"
+// @Param X-Admin-Token header string true "admin token"
+// @Success 200 {object} model.AuditPage
+// @Failure 400 {object} rerrors.Error "Bad Request. Invalid filter or pagination"
+// @Failure 403 {object} rerrors.Error "Missing or invalid admin token"
+// @Failure 500 {object} rerrors.Error "Internal Server Error"
+// @Router /audit [get]
+func (h *Handler) ListAudit(c *gin.Context) {
+	if !h.isAdmin(c) {
+		err := rerrors.NewForbidden("the audit log requires a valid admin token")
+		log.Printf("Failed to list audit log: %v\n", err)
+
+		c.JSON(err.Status(), gin.H{
+			"error": err,
+		})
+
+		return
+	}
+
+	params, err := auditListParams(c)
+
+	if err != nil {
+		log.Printf("Failed to list audit log: %v\n", err.Error())
+
+		c.JSON(rerrors.Status(err), gin.H{
+			"error": err,
+		})
+
+		return
+	}
+
+	page, err := h.AuditService.List(c.Request.Context(), params)
+
+	if err != nil {
+		log.Printf("Failed to list audit log: %v\n", err.Error())
+
+		c.JSON(rerrors.Status(err), gin.H{
+			"error": err,
+		})
+
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+// VerifyAudit godoc
+// @Summary Verify the audit log
+// @Description Read the whole audit log, checking its hash chain: valid is false when any entry was changed,
+// @Description removed or inserted since it was appended, and error tells the first one. Keep last_hash elsewhere
+// @Description to tell later whether entries were removed from the end. Requires the X-Admin-Token header.
+// @Tags audit
+// @Accept  json
+// @Produce  json
+// @Param X-Admin-Token header string true "admin token"
+// @Success 200 {object} model.AuditVerification
+// @Failure 403 {object} rerrors.Error "Missing or invalid admin token"
+// @Failure 500 {object} rerrors.Error "Internal Server Error"
+// @Router /audit/verify [get]
+func (h *Handler) VerifyAudit(c *gin.Context) {
+	if !h.isAdmin(c) {
+		err := rerrors.NewForbidden("the audit log requires a valid admin token")
+		log.Printf("Failed to verify audit log: %v\n", err)
+
+		c.JSON(err.Status(), gin.H{
+			"error": err,
+		})
+
+		return
+	}
+
+	v, err := h.AuditService.Verify(c.Request.Context())
+
+	if err != nil {
+		log.Printf("Failed to verify audit log: %v\n", err.Error())
+
+		c.JSON(rerrors.Status(err), gin.H{
+			"error": err,
+		})
+
+		return
+	}
+
+	if !v.Valid {
+		log.Printf("Audit log was tampered with: %s\n", v.Error)
+	}
+
+	c.JSON(http.StatusOK, v)
+}
+
+// auditListParams reads the filters of an audit log listing
+func auditListParams(c *gin.Context) (model.AuditListParams, error) {
+	params := model.AuditListParams{
+		Actor: c.Query("actor"),
+	}
+
+	if v := c.Query("user_id"); v != "" {
+		id, err := uuid.Parse(v)
+
+		if err != nil {
+			return params, rerrors.NewBadRequest("user_id must be a valid id")
+		}
+
+		params.UserID = &id
+	}
+
+	since, err := queryTime(c, "since")
+
+	if err != nil {
+		return params, err
+	}
+
+	params.Since = since
+
+	after, err := queryInt(c, "after")
+
+	if err != nil {
+		return params, err
+	}
+
+	params.After = int64(after)
+
+	if params.Limit, err = queryInt(c, "limit"); err != nil {
+		return params, err
+	}
+
+	return params, nil
+}
@@ -0,0 +1,443 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/klasrak/users-api/mocks"
+	model "github.com/klasrak/users-api/models"
+	"github.com/klasrak/users-api/rerrors"
+	"github.com/klasrak/users-api/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestAuditHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	t.Run("ListAudit", func(t *testing.T) {
+		t.Run("Success", func(t *testing.T) {
+			mockAuditService := new(mocks.MockAuditService)
+
+			h := &Handler{
+				AuditService: mockAuditService,
+				AdminToken:   "secret",
+			}
+
+			c := &MockedContainer{
+				Handler: h,
+			}
+
+			router := &MockedRouter{}
+
+			router.Initialize(c)
+
+			uid := uuid.New()
+			since := time.Date(2022, 5, 1, 0, 0, 0, 0, time.UTC)
+
+			page := &model.AuditPage{Data: []model.AuditEntry{{ID: 11, UserID: uid, Actor: "maria", Action: model.AuditCreate}}}
+
+			mockAuditService.On("List", mock.Anything, model.AuditListParams{
+				UserID: &uid,
+				Actor:  "maria",
+				Since:  since,
+				After:  10,
+				Limit:  50,
+			}).Return(page, nil)
+
+			rr := httptest.NewRecorder()
+			request, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("http://localhost:8080/api/v1/audit?user_id=%s&actor=maria&since=2022-05-01T00:00:00Z&after=10&limit=50", uid), nil)
+			request.Header.Set("X-Admin-Token", "secret")
+
+			router.r.ServeHTTP(rr, request)
+
+			respBody, _ := json.Marshal(page)
+
+			assert.Equal(t, http.StatusOK, rr.Code)
+			assert.Equal(t, respBody, rr.Body.Bytes())
+			mockAuditService.AssertExpectations(t)
+		})
+
+		t.Run("Requires admin token", func(t *testing.T) {
+			for name, tc := range map[string]struct {
+				adminToken string
+				header     string
+			}{
+				"missing token":  {adminToken: "secret"},
+				"wrong token":    {adminToken: "secret", header: "guess"},
+				"audit disabled": {},
+			} {
+				t.Run(name, func(t *testing.T) {
+					mockAuditService := new(mocks.MockAuditService)
+
+					h := &Handler{
+						AuditService: mockAuditService,
+						AdminToken:   tc.adminToken,
+					}
+
+					c := &MockedContainer{
+						Handler: h,
+					}
+
+					router := &MockedRouter{}
+
+					router.Initialize(c)
+
+					rr := httptest.NewRecorder()
+					request, _ := http.NewRequest(http.MethodGet, "http://localhost:8080/api/v1/audit", nil)
+
+					if tc.header != "" {
+						request.Header.Set("X-Admin-Token", tc.header)
+					}
+
+					router.r.ServeHTTP(rr, request)
+
+					assert.Equal(t, http.StatusForbidden, rr.Code)
+					mockAuditService.AssertNotCalled(t, "List", mock.Anything, mock.Anything)
+				})
+			}
+		})
+
+		t.Run("Bad request", func(t *testing.T) {
+			for name, query := range map[string]string{
+				"invalid user_id": "user_id=42",
+				"invalid since":   "since=2022-05-01",
+				"invalid after":   "after=first",
+				"invalid limit":   "limit=many",
+			} {
+				t.Run(name, func(t *testing.T) {
+					mockAuditService := new(mocks.MockAuditService)
+
+					h := &Handler{
+						AuditService: mockAuditService,
+						AdminToken:   "secret",
+					}
+
+					c := &MockedContainer{
+						Handler: h,
+					}
+
+					router := &MockedRouter{}
+
+					router.Initialize(c)
+
+					rr := httptest.NewRecorder()
+					request, _ := http.NewRequest(http.MethodGet, "http://localhost:8080/api/v1/audit?"+query, nil)
+					request.Header.Set("X-Admin-Token", "secret")
+
+					router.r.ServeHTTP(rr, request)
+
+					assert.Equal(t, http.StatusBadRequest, rr.Code)
+					mockAuditService.AssertNotCalled(t, "List", mock.Anything, mock.Anything)
+				})
+			}
+		})
+
+		t.Run("Internal Server Error", func(t *testing.T) {
+			mockAuditService := new(mocks.MockAuditService)
+
+			h := &Handler{
+				AuditService: mockAuditService,
+				AdminToken:   "secret",
+			}
+
+			c := &MockedContainer{
+				Handler: h,
+			}
+
+			router := &MockedRouter{}
+
+			router.Initialize(c)
+
+			mockAuditService.On("List", mock.Anything, model.AuditListParams{}).Return(nil, rerrors.NewInternal())
+
+			rr := httptest.NewRecorder()
+			request, _ := http.NewRequest(http.MethodGet, "http://localhost:8080/api/v1/audit", nil)
+			request.Header.Set("X-Admin-Token", "secret")
+
+			router.r.ServeHTTP(rr, request)
+
+			assert.Equal(t, http.StatusInternalServerError, rr.Code)
+			mockAuditService.AssertExpectations(t)
+		})
+	})
+
+	t.Run("VerifyAudit", func(t *testing.T) {
+		t.Run("Success", func(t *testing.T) {
+			mockAuditService := new(mocks.MockAuditService)
+
+			h := &Handler{
+				AuditService: mockAuditService,
+				AdminToken:   "secret",
+			}
+
+			c := &MockedContainer{
+				Handler: h,
+			}
+
+			router := &MockedRouter{}
+
+			router.Initialize(c)
+
+			v := &model.AuditVerification{Entries: 12, LastHash: "abc", Error: "audit entry 7 does not match its hash"}
+
+			mockAuditService.On("Verify", mock.Anything).Return(v, nil)
+
+			rr := httptest.NewRecorder()
+			request, _ := http.NewRequest(http.MethodGet, "http://localhost:8080/api/v1/audit/verify", nil)
+			request.Header.Set("X-Admin-Token", "secret")
+
+			router.r.ServeHTTP(rr, request)
+
+			respBody, _ := json.Marshal(v)
+
+			assert.Equal(t, http.StatusOK, rr.Code)
+			assert.Equal(t, respBody, rr.Body.Bytes())
+			mockAuditService.AssertExpectations(t)
+		})
+
+		t.Run("Requires admin token", func(t *testing.T) {
+			mockAuditService := new(mocks.MockAuditService)
+
+			h := &Handler{
+				AuditService: mockAuditService,
+				AdminToken:   "secret",
+			}
+
+			c := &MockedContainer{
+				Handler: h,
+			}
+
+			router := &MockedRouter{}
+
+			router.Initialize(c)
+
+			rr := httptest.NewRecorder()
+			request, _ := http.NewRequest(http.MethodGet, "http://localhost:8080/api/v1/audit/verify", nil)
+			request.Header.Set("X-Admin-Token", "guess")
+
+			router.r.ServeHTTP(rr, request)
+
+			assert.Equal(t, http.StatusForbidden, rr.Code)
+			mockAuditService.AssertNotCalled(t, "Verify", mock.Anything)
+		})
+
+		t.Run("Internal Server Error", func(t *testing.T) {
+			mockAuditService := new(mocks.MockAuditService)
+
+			h := &Handler{
+				AuditService: mockAuditService,
+				AdminToken:   "secret",
+			}
+
+			c := &MockedContainer{
+				Handler: h,
+			}
+
+			router := &MockedRouter{}
+
+			router.Initialize(c)
+
+			mockAuditService.On("Verify", mock.Anything).Return(nil, rerrors.NewInternal())
+
+			rr := httptest.NewRecorder()
+			request, _ := http.NewRequest(http.MethodGet, "http://localhost:8080/api/v1/audit/verify", nil)
+			request.Header.Set("X-Admin-Token", "secret")
+
+			router.r.ServeHTTP(rr, request)
+
+			assert.Equal(t, http.StatusInternalServerError, rr.Code)
+			mockAuditService.AssertExpectations(t)
+		})
+	})
+
+	t.Run("RequestContext", func(t *testing.T) {
+		t.Run("Passes actor and request ID on", func(t *testing.T) {
+			mockUserService := new(mocks.MockUserService)
+
+			h := &Handler{
+				UserService:  mockUserService,
+				GatewayToken: "gateway",
+			}
+
+			c := &MockedContainer{
+				Handler: h,
+			}
+
+			router := &MockedRouter{}
+
+			router.Initialize(c)
+
+			uid := uuid.New()
+
+			mockUserService.On("Delete", mock.MatchedBy(func(ctx context.Context) bool {
+				return utils.Actor(ctx) == "maria" && utils.RequestID(ctx) == "req-1"
+			}), uid.String()).Return(nil)
+
+			rr := httptest.NewRecorder()
+			request, _ := http.NewRequest(http.MethodDelete, fmt.Sprintf("http://localhost:8080/api/v1/users/%s", uid), nil)
+			request.Header.Set("X-Gateway-Token", "gateway")
+			request.Header.Set("X-Actor", "maria")
+			request.Header.Set("X-Request-ID", "req-1")
+
+			router.r.ServeHTTP(rr, request)
+
+			assert.Equal(t, http.StatusNoContent, rr.Code)
+			assert.Equal(t, "req-1", rr.Header().Get("X-Request-ID"))
+			mockUserService.AssertExpectations(t)
+		})
+
+		t.Run("Defaults", func(t *testing.T) {
+			mockUserService := new(mocks.MockUserService)
+
+			h := &Handler{
+				UserService: mockUserService,
+			}
+
+			c := &MockedContainer{
+				Handler: h,
+			}
+
+			router := &MockedRouter{}
+
+			router.Initialize(c)
+
+			uid := uuid.New()
+
+			var requestID string
+
+			mockUserService.On("Delete", mock.MatchedBy(func(ctx context.Context) bool {
+				requestID = utils.RequestID(ctx)
+				return utils.Actor(ctx) == "unauthenticated" && !utils.ReadYourWrites(ctx)
+			}), uid.String()).Return(nil)
+
+			rr := httptest.NewRecorder()
+			request, _ := http.NewRequest(http.MethodDelete, fmt.Sprintf("http://localhost:8080/api/v1/users/%s", uid), nil)
+
+			router.r.ServeHTTP(rr, request)
+
+			assert.Equal(t, http.StatusNoContent, rr.Code)
+			assert.NotEmpty(t, requestID)
+			assert.Equal(t, requestID, rr.Header().Get("X-Request-ID"))
+			mockUserService.AssertExpectations(t)
+		})
+
+		t.Run("Actors are only trusted from the gateway", func(t *testing.T) {
+			for name, tc := range map[string]struct {
+				gatewayToken string
+				headers      map[string]string
+				actor        string
+			}{
+				"no token": {
+					gatewayToken: "gateway",
+					headers:      map[string]string{"X-Actor": "maria"},
+					actor:        "unauthenticated",
+				},
+				"wrong token": {
+					gatewayToken: "gateway",
+					headers:      map[string]string{"X-Actor": "maria", "X-Gateway-Token": "guess"},
+					actor:        "unauthenticated",
+				},
+				"no gateway": {
+					headers: map[string]string{"X-Actor": "maria", "X-Gateway-Token": ""},
+					actor:   "unauthenticated",
+				},
+				"gateway without a user": {
+					gatewayToken: "gateway",
+					headers:      map[string]string{"X-Gateway-Token": "gateway"},
+					actor:        "anonymous",
+				},
+			} {
+				t.Run(name, func(t *testing.T) {
+					mockUserService := new(mocks.MockUserService)
+
+					h := &Handler{
+						UserService:  mockUserService,
+						GatewayToken: tc.gatewayToken,
+					}
+
+					c := &MockedContainer{
+						Handler: h,
+					}
+
+					router := &MockedRouter{}
+
+					router.Initialize(c)
+
+					uid := uuid.New()
+
+					mockUserService.On("Delete", mock.MatchedBy(func(ctx context.Context) bool {
+						return utils.Actor(ctx) == tc.actor
+					}), uid.String()).Return(nil)
+
+					rr := httptest.NewRecorder()
+					request, _ := http.NewRequest(http.MethodDelete, fmt.Sprintf("http://localhost:8080/api/v1/users/%s", uid), nil)
+
+					for k, v := range tc.headers {
+						request.Header.Set(k, v)
+					}
+
+					router.r.ServeHTTP(rr, request)
+
+					assert.Equal(t, http.StatusNoContent, rr.Code)
+					mockUserService.AssertExpectations(t)
+				})
+			}
+		})
+
+		t.Run("Browsers may not send an actor", func(t *testing.T) {
+			router := &MockedRouter{}
+
+			router.Initialize(&MockedContainer{Handler: &Handler{}})
+
+			rr := httptest.NewRecorder()
+			request, _ := http.NewRequest(http.MethodOptions, "http://localhost:8080/api/v1/users", nil)
+			request.Header.Set("Origin", "https://example.com")
+			request.Header.Set("Access-Control-Request-Method", http.MethodDelete)
+			request.Header.Set("Access-Control-Request-Headers", "X-Actor")
+
+			router.r.ServeHTTP(rr, request)
+
+			assert.NotContains(t, strings.ToLower(rr.Header().Get("Access-Control-Allow-Headers")), "x-actor")
+		})
+
+		t.Run("Read your writes", func(t *testing.T) {
+			mockUserService := new(mocks.MockUserService)
+
+			h := &Handler{
+				UserService: mockUserService,
+			}
+
+			c := &MockedContainer{
+				Handler: h,
+			}
+
+			router := &MockedRouter{}
+
+			router.Initialize(c)
+
+			uid := uuid.New()
+
+			mockUserService.On("Delete", mock.MatchedBy(func(ctx context.Context) bool {
+				return utils.ReadYourWrites(ctx)
+			}), uid.String()).Return(nil)
+
+			rr := httptest.NewRecorder()
+			request, _ := http.NewRequest(http.MethodDelete, fmt.Sprintf("http://localhost:8080/api/v1/users/%s", uid), nil)
+			request.Header.Set("X-Read-Your-Writes", "true")
+
+			router.r.ServeHTTP(rr, request)
+
+			assert.Equal(t, http.StatusNoContent, rr.Code)
+			mockUserService.AssertExpectations(t)
+		})
+	})
+}
@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	model "github.com/klasrak/users-api/models"
+	"github.com/klasrak/users-api/rerrors"
+)
+
+// setETag sends the version of a user as its entity tag
+func setETag(c *gin.Context, u *model.User) {
+	c.Header("ETag", fmt.Sprintf(`"%d"`, u.Version))
+}
+
+// ifMatchVersion reads the user version a request is based on from its
+// If-Match header, returning 0 when the header is absent. Weak tags are
+// accepted since versions are the only validator users have
+func ifMatchVersion(c *gin.Context) (int, error) {
+	v := strings.TrimSpace(c.GetHeader("If-Match"))
+
+	if v == "" {
+		return 0, nil
+	}
+
+	tag := strings.TrimPrefix(v, "W/")
+
+	if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+		return 0, rerrors.NewPreconditionFailed(fmt.Sprintf("If-Match %s does not match the user version", v))
+	}
+
+	version, err := strconv.Atoi(tag[1 : len(tag)-1])
+
+	if err != nil || version <= 0 {
+		return 0, rerrors.NewPreconditionFailed(fmt.Sprintf("If-Match %s does not match the user version", v))
+	}
+
+	return version, nil
+}
@@ -1,6 +1,30 @@
 package handlers
 
+import (
+	"crypto/subtle"
+
+	"github.com/gin-gonic/gin"
+)
+
 // Handler is a struct for injected services
 type Handler struct {
-	UserService UserService
+	UserService    UserService
+	AuditService   AuditService
+	WebhookService WebhookService
+	// AdminToken grants access to admin-only operations when sent in the
+	// X-Admin-Token header. Those operations are disabled when it is empty
+	AdminToken string
+	// GatewayToken is sent by the gateway in front of the API in the
+	// X-Gateway-Token header, vouching for the actor it sets in X-Actor
+	// (see RequestContext)
+	GatewayToken string
+}
+
+// isAdmin reports whether the request carries the admin token
+func (h *Handler) isAdmin(c *gin.Context) bool {
+	if h.AdminToken == "" {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(c.GetHeader("X-Admin-Token")), []byte(h.AdminToken)) == 1
 }
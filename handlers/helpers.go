@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -32,7 +33,7 @@ func bindData(c *gin.Context, req interface{}) bool {
 			for _, err := range errs {
 				invalidArgs = append(invalidArgs, invalidArgument{
 					err.Field(),
-					err.Value().(string),
+					fmt.Sprint(err.Value()),
 					err.Tag(),
 					err.Param(),
 				})
@@ -66,3 +67,37 @@ func bindData(c *gin.Context, req interface{}) bool {
 
 	return true
 }
+
+// queryBool reads an optional boolean query parameter, returning false when it is absent
+func queryBool(c *gin.Context, key string) (bool, error) {
+	v := c.Query(key)
+
+	if v == "" {
+		return false, nil
+	}
+
+	b, err := strconv.ParseBool(v)
+
+	if err != nil {
+		return false, rerrors.NewBadRequest(fmt.Sprintf("%s must be true or false", key))
+	}
+
+	return b, nil
+}
+
+// queryTime reads an optional RFC3339 time query parameter, returning the zero time when it is absent
+func queryTime(c *gin.Context, key string) (time.Time, error) {
+	v := c.Query(key)
+
+	if v == "" {
+		return time.Time{}, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, v)
+
+	if err != nil {
+		return time.Time{}, rerrors.NewBadRequest(fmt.Sprintf("%s must be in RFC3339 format: %s", key, time.RFC3339))
+	}
+
+	return t, nil
+}
@@ -2,15 +2,44 @@ package handlers
 
 import (
 	"context"
+	"time"
 
 	model "github.com/klasrak/users-api/models"
 )
 
 // UserService represents the user service implementation
 type UserService interface {
-	GetAll(ctx context.Context, name string) ([]model.User, error)
-	GetByID(ctx context.Context, id string) (*model.User, error)
+	GetAll(ctx context.Context, params model.UserListParams) (*model.UserPage, error)
+	Export(ctx context.Context, params model.UserListParams, fn func(u *model.User) error) error
+	Search(ctx context.Context, q string, limit int) ([]model.UserSearchResult, error)
+	GetByID(ctx context.Context, id string, includeDeleted bool) (*model.User, error)
+	GetAsOf(ctx context.Context, id string, at time.Time, includeDeleted bool) (*model.User, error)
+	History(ctx context.Context, id string) (*model.UserHistory, error)
 	Create(ctx context.Context, u *model.User) (*model.User, error)
-	Update(ctx context.Context, id string, u *model.User) (*model.User, error)
+	CreateBatch(ctx context.Context, users []*model.User, atomic bool) (*model.BatchResults, error)
+	Import(ctx context.Context, rows []model.ImportRow) (*model.ImportReport, error)
+	Update(ctx context.Context, id string, u *model.User, version int) (*model.User, error)
+	Patch(ctx context.Context, id string, patch *model.UserPatch, version int) (*model.User, error)
+	UpdateBatch(ctx context.Context, sel model.BatchSelector, patch *model.UserPatch, dryRun bool) (*model.BatchResults, error)
 	Delete(ctx context.Context, id string) error
+	DeleteBatch(ctx context.Context, sel model.BatchSelector, dryRun bool) (*model.BatchResults, error)
+	Restore(ctx context.Context, id string) (*model.User, error)
+	Purge(ctx context.Context, id string) error
+}
+
+// AuditService represents the audit service implementation
+type AuditService interface {
+	List(ctx context.Context, params model.AuditListParams) (*model.AuditPage, error)
+	Verify(ctx context.Context) (*model.AuditVerification, error)
+}
+
+// WebhookService represents the webhook service implementation
+type WebhookService interface {
+	List(ctx context.Context) ([]model.Webhook, error)
+	GetByID(ctx context.Context, id string) (*model.Webhook, error)
+	Create(ctx context.Context, params *model.WebhookParams) (*model.Webhook, error)
+	Update(ctx context.Context, id string, params *model.WebhookParams) (*model.Webhook, error)
+	Delete(ctx context.Context, id string) error
+	Deliveries(ctx context.Context, id string, params model.WebhookDeliveryListParams) (*model.WebhookDeliveryPage, error)
+	Redeliver(ctx context.Context, id, deliveryID string) (*model.WebhookDelivery, error)
 }
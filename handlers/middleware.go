@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/klasrak/users-api/utils"
+)
+
+// maxRequestIDLength bounds request IDs sent by clients
+const maxRequestIDLength = 128
+
+// Actors recorded for requests that don't tell who is making them
+const (
+	// anonymousActor is recorded when the gateway forwards a request
+	// without an authenticated user
+	anonymousActor = "anonymous"
+	// unauthenticatedActor is recorded when the request did not come
+	// through the gateway, whatever X-Actor it claims
+	unauthenticatedActor = "unauthenticated"
+)
+
+// RequestContext stores who is making each request and the ID of the request
+// in its context, so services can record them. The actor is taken from the
+// X-Actor header set by the gateway authenticating users, and only trusted
+// when the request also carries gatewayToken in X-Gateway-Token: anyone
+// else is recorded as unauthenticated. With no gatewayToken, X-Actor is
+// never trusted.
+//
+// The request ID is taken from X-Request-ID, or generated when missing, and
+// is sent back in the response. Clients that must see their own writes,
+// e.g. reading a user right after updating it, send X-Read-Your-Writes: true
+// to keep their reads off lagging replicas
+func RequestContext(gatewayToken string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := strings.TrimSpace(c.GetHeader("X-Request-ID"))
+
+		if requestID == "" || len(requestID) > maxRequestIDLength {
+			requestID = uuid.NewString()
+		}
+
+		actor := unauthenticatedActor
+
+		if gatewayToken != "" && subtle.ConstantTimeCompare([]byte(c.GetHeader("X-Gateway-Token")), []byte(gatewayToken)) == 1 {
+			if actor = strings.TrimSpace(c.GetHeader("X-Actor")); actor == "" {
+				actor = anonymousActor
+			}
+		}
+
+		ctx := utils.WithRequestID(c.Request.Context(), requestID)
+		ctx = utils.WithActor(ctx, actor)
+
+		if ryw, _ := strconv.ParseBool(c.GetHeader("X-Read-Your-Writes")); ryw {
+			ctx = utils.WithReadYourWrites(ctx)
+		}
+
+		c.Request = c.Request.WithContext(ctx)
+		c.Header("X-Request-ID", requestID)
+
+		c.Next()
+	}
+}
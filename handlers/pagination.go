@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	model "github.com/klasrak/users-api/models"
+	"github.com/klasrak/users-api/rerrors"
+)
+
+// queryInt reads an optional integer query parameter, returning 0 when it is absent
+func queryInt(c *gin.Context, key string) (int, error) {
+	v := c.Query(key)
+
+	if v == "" {
+		return 0, nil
+	}
+
+	n, err := strconv.Atoi(v)
+
+	if err != nil {
+		return 0, rerrors.NewBadRequest(fmt.Sprintf("%s must be a number", key))
+	}
+
+	return n, nil
+}
+
+// setPaginationHeaders adds RFC 8288 Link headers to a listing response.
+// Offset paginated pages also get first/prev/last links and X-Total-Count
+func setPaginationHeaders(c *gin.Context, page *model.UserPage) {
+	var links []string
+
+	link := func(rel string, set map[string]string) {
+		u := *c.Request.URL
+		q := u.Query()
+
+		for k, v := range set {
+			q.Set(k, v)
+		}
+
+		u.RawQuery = q.Encode()
+
+		links = append(links, fmt.Sprintf(`<%s>; rel="%s"`, (&url.URL{Path: u.Path, RawQuery: u.RawQuery}).String(), rel))
+	}
+
+	if page.Total != nil {
+		c.Header("X-Total-Count", strconv.Itoa(*page.Total))
+
+		perPage := strconv.Itoa(page.PerPage)
+		last := page.LastPage()
+
+		link("first", map[string]string{"page": "1", "per_page": perPage})
+
+		if page.Page > 1 {
+			link("prev", map[string]string{"page": strconv.Itoa(minInt(page.Page-1, last)), "per_page": perPage})
+		}
+
+		if page.Page < last {
+			link("next", map[string]string{"page": strconv.Itoa(page.Page + 1), "per_page": perPage})
+		}
+
+		link("last", map[string]string{"page": strconv.Itoa(last), "per_page": perPage})
+	}
+
+	if page.NextCursor != "" {
+		link("next", map[string]string{"cursor": page.NextCursor})
+	}
+
+	if len(links) > 0 {
+		c.Header("Link", strings.Join(links, ", "))
+	}
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+
+	return b
+}
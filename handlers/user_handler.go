@@ -1,8 +1,14 @@
 package handlers
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -17,30 +23,108 @@ type createPayload struct {
 	Birthdate time.Time `json:"birthdate" binding:"required"`
 }
 
+type createBatchPayload struct {
+	Users  []createPayload `json:"users" binding:"required"`
+	Atomic bool            `json:"atomic"`
+}
+
+type batchUpdatePayload struct {
+	IDs    []string        `json:"ids"`
+	Filter string          `json:"filter"`
+	Patch  json.RawMessage `json:"patch" binding:"required" swaggertype:"object"`
+	DryRun bool            `json:"dry_run"`
+}
+
+type batchDeletePayload struct {
+	IDs    []string `json:"ids"`
+	Filter string   `json:"filter"`
+	DryRun bool     `json:"dry_run"`
+}
+
 type updatePayload struct {
-	Name      string    `json:"name,omitempty"`
-	Email     string    `json:"email,omitempty"`
-	Cpf       string    `json:"cpf,omitempty"`
-	Birthdate time.Time `json:"birthdate,omitempty"`
+	Name      string    `json:"name" binding:"required"`
+	Email     string    `json:"email" binding:"required,email"`
+	Cpf       string    `json:"cpf" binding:"required"`
+	Birthdate time.Time `json:"birthdate" binding:"required"`
 }
 
 // GetAll godoc
 // @Summary Get all users
-// @Description Fetch all users from database. Can filter by name.
+// @Description Fetch a page of users from database. Can filter by name or by a filter expression
+// @Description combining comparisons on id, name, email, cpf and birthdate with and, or, not and parentheses.
+// @Description Operators: eq (=), ne (!=), gt (>), ge (>=), lt (<), le (<=), contains, starts_with, ends_with, between and in.
+// @Description Pages are walked either by cursor (limit and cursor) or by offset (page and per_page).
+// @Description Offset pages include the total count, also sent in the X-Total-Count header.
+// @Description Can be sorted by id, name, email, cpf and birthdate. Names are sorted with pt-BR collation.
+// @Description Deleted users are only listed when include_deleted is true.
 // @Tags user
 // @Accept  json
 // @Produce  json
 // @Param name query string false "search by name"
-// @Success 200 {object} []model.User
-// @Success 204
+// @Param filter query string false "filter expression, e.g. email ends_with '@acme.com.br' and birthdate between 1980-01-01 and 1990-12-31"
+// @Param limit query int false "page size (default 50, max 1000)"
+// @Param cursor query string false "next_cursor returned by the previous page"
+// @Param page query int false "page number, starting at 1"
+// @Param per_page query int false "page size (default 50, max 1000)"
+// @Param sort query string false "comma separated fields to sort by, prefixed by - for descending order, e.g. name,-birthdate"
+// @Param include_deleted query bool false "also list deleted users"
+// @Success 200 {object} model.UserPage
+// @Header 200 {string} Link "RFC 8288 pagination links"
+// @Header 200 {integer} X-Total-Count "total number of users, offset pagination only"
+// @Failure 400 {object} rerrors.Error "Bad Request. Invalid pagination, sort or filter"
 // @Failure 500 {object} rerrors.Error "Internal Server Error"
 // @Router /users [get]
 func (h *Handler) GetAll(c *gin.Context) {
 	ctx := c.Request.Context()
 
-	name := c.Query("name")
+	params := model.UserListParams{
+		Name:   c.Query("name"),
+		Filter: c.Query("filter"),
+		Cursor: c.Query("cursor"),
+	}
+
+	var err error
+
+	if params.Sort, err = model.ParseUserSort(c.Query("sort")); err != nil {
+		log.Printf("Failed to get all users: %v\n", err.Error())
+
+		c.JSON(rerrors.Status(err), gin.H{
+			"error": err,
+		})
+
+		return
+	}
+
+	for _, p := range []struct {
+		key string
+		dst *int
+	}{
+		{"limit", &params.Limit},
+		{"page", &params.Page},
+		{"per_page", &params.PerPage},
+	} {
+		if *p.dst, err = queryInt(c, p.key); err != nil {
+			log.Printf("Failed to get all users: %v\n", err.Error())
+
+			c.JSON(rerrors.Status(err), gin.H{
+				"error": err,
+			})
+
+			return
+		}
+	}
+
+	if params.IncludeDeleted, err = queryBool(c, "include_deleted"); err != nil {
+		log.Printf("Failed to get all users: %v\n", err.Error())
+
+		c.JSON(rerrors.Status(err), gin.H{
+			"error": err,
+		})
 
-	users, err := h.UserService.GetAll(ctx, name)
+		return
+	}
+
+	page, err := h.UserService.GetAll(ctx, params)
 
 	if err != nil {
 		log.Printf("Failed to get all users: %v\n", err.Error())
@@ -52,31 +136,243 @@ func (h *Handler) GetAll(c *gin.Context) {
 		return
 	}
 
-	if len(users) == 0 {
-		c.JSON(http.StatusNoContent, nil)
+	setPaginationHeaders(c, page)
+
+	c.JSON(http.StatusOK, page)
+}
+
+// exportFlushSize is the number of users written between flushes of an
+// export, so clients get rows as they are read
+const exportFlushSize = 1000
+
+// Export godoc
+// @Summary Export users
+// @Description Download every user matching the same filters as the listing, as CSV or newline delimited JSON.
+// @Description Users are streamed as they are read from the database, with chunked encoding. The status is sent
+// @Description along with the first user, so a failure after that is reported in the X-Export-Error trailer
+// @Tags user
+// @Produce  text/csv
+// @Produce  application/x-ndjson
+// @Param format query string false "csv (default) or ndjson"
+// @Param name query string false "search by name"
+// @Param filter query string false "filter expression, e.g. email ends_with '@acme.com.br' and birthdate between 1980-01-01 and 1990-12-31"
+// @Param sort query string false "comma separated fields to sort by, prefixed by - for descending order, e.g. name,-birthdate"
+// @Param include_deleted query bool false "also export deleted users"
+// @Success 200 {file} file "Users"
+// @Header 200 {string} X-Export-Error "trailer set when the export failed midway"
+// @Failure 400 {object} rerrors.Error "Invalid format, filter or sort"
+// @Failure 500 {object} rerrors.Error "Internal Server Error"
+// @Router /users/export [get]
+func (h *Handler) Export(c *gin.Context) {
+	params := model.UserListParams{
+		Name:   c.Query("name"),
+		Filter: c.Query("filter"),
+	}
+
+	var err error
+
+	if params.Sort, err = model.ParseUserSort(c.Query("sort")); err != nil {
+		log.Printf("failed to export users: %v\n", err.Error())
+
+		c.JSON(rerrors.Status(err), gin.H{
+			"error": err,
+		})
+		return
+	}
+
+	if params.IncludeDeleted, err = queryBool(c, "include_deleted"); err != nil {
+		log.Printf("failed to export users: %v\n", err.Error())
+
+		c.JSON(rerrors.Status(err), gin.H{
+			"error": err,
+		})
+		return
+	}
+
+	format := c.DefaultQuery("format", model.ExportCSV)
+
+	uw, err := model.NewUserWriter(c.Writer, format)
+
+	if err != nil {
+		log.Printf("failed to export users: %v\n", err.Error())
+
+		c.JSON(rerrors.Status(err), gin.H{
+			"error": err,
+		})
+		return
+	}
+
+	started := false
+
+	// the response starts with the first user, so errors found before it,
+	// such as an invalid filter, still get a proper status
+	start := func() {
+		started = true
+
+		c.Header("Content-Type", uw.ContentType())
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="users.%s"`, format))
+		c.Header("Trailer", "X-Export-Error")
+		c.Status(http.StatusOK)
+	}
+
+	written := 0
+
+	err = h.UserService.Export(c.Request.Context(), params, func(u *model.User) error {
+		if !started {
+			start()
+		}
+
+		if err := uw.Write(u); err != nil {
+			return err
+		}
+
+		if written++; written%exportFlushSize == 0 {
+			if err := uw.Flush(); err != nil {
+				return err
+			}
+
+			c.Writer.Flush()
+		}
+
+		return nil
+	})
+
+	if err != nil && !started {
+		log.Printf("failed to export users: %v\n", err.Error())
+
+		c.JSON(rerrors.Status(err), gin.H{
+			"error": err,
+		})
+		return
+	}
+
+	if !started {
+		start()
+	}
+
+	if err == nil {
+		err = uw.Flush()
+	}
+
+	if err != nil {
+		log.Printf("failed to export users after %d of them: %v\n", written, err.Error())
+
+		c.Writer.Header().Set("X-Export-Error", err.Error())
+		return
+	}
+
+	c.Writer.Flush()
+}
+
+// Search godoc
+// @Summary Search users
+// @Description Full-text search over user names and e-mails, ignoring accents.
+// @Description Every word is matched as a prefix, so partial names are found. Results are ranked by relevance
+// @Description and the matching parts of the name and e-mail are highlighted with <mark> tags.
+// @Tags user
+// @Accept  json
+// @Produce  json
+// @Param q query string true "search terms"
+// @Param limit query int false "maximum number of results (default 20, max 100)"
+// @Success 200 {object} []model.UserSearchResult
+// @Failure 400 {object} rerrors.Error "Bad Request. Missing search terms or invalid limit"
+// @Failure 500 {object} rerrors.Error "Internal Server Error"
+// @Router /users/search [get]
+func (h *Handler) Search(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	limit, err := queryInt(c, "limit")
+
+	if err != nil {
+		log.Printf("Failed to search users: %v\n", err.Error())
+
+		c.JSON(rerrors.Status(err), gin.H{
+			"error": err,
+		})
+
+		return
+	}
+
+	results, err := h.UserService.Search(ctx, c.Query("q"), limit)
+
+	if err != nil {
+		log.Printf("Failed to search users: %v\n", err.Error())
+
+		c.JSON(rerrors.Status(err), gin.H{
+			"error": err,
+		})
+
 		return
 	}
 
-	c.JSON(http.StatusOK, users)
+	c.JSON(http.StatusOK, results)
 }
 
 // GetByID godoc
 // @Summary Get a single user by ID
-// @Description Get a single user by ID
+// @Description Get a single user by ID. Deleted users are not found unless include_deleted is true.
+// @Description With as_of, the user is returned as it was at that time, rebuilt from the audit log
 // @Tags user
 // @ID string
 // @Accept  json
 // @Produce  json
 // @Param id path string true "User ID"
+// @Param include_deleted query bool false "also find deleted users"
+// @Param as_of query string false "point in time to return the user as of, in RFC3339 format"
 // @Success 200 {object} model.User
-// @Failure 400 {object} rerrors.Error "Bad Request. Invalid ID"
+// @Header 200 {string} ETag "version of the user, to be sent back in If-Match when updating it. Not sent with as_of"
+// @Failure 400 {object} rerrors.Error "Bad Request. Invalid ID or as_of"
 // @Failure 404 {object} rerrors.Error "User Not Found"
+// @Failure 500 {object} rerrors.Error "Internal Server Error"
 // @Router /users/{id} [get]
 func (h *Handler) GetByID(c *gin.Context) {
 	ctx := c.Request.Context()
 	id := c.Param("id")
 
-	user, err := h.UserService.GetByID(ctx, id)
+	includeDeleted, err := queryBool(c, "include_deleted")
+
+	if err != nil {
+		log.Printf("Failed to get user: %v\n", err.Error())
+
+		c.JSON(rerrors.Status(err), gin.H{
+			"error": err,
+		})
+
+		return
+	}
+
+	asOf, err := queryTime(c, "as_of")
+
+	if err != nil {
+		log.Printf("Failed to get user: %v\n", err.Error())
+
+		c.JSON(rerrors.Status(err), gin.H{
+			"error": err,
+		})
+
+		return
+	}
+
+	if !asOf.IsZero() {
+		user, err := h.UserService.GetAsOf(ctx, id, asOf, includeDeleted)
+
+		if err != nil {
+			log.Printf("Failed to get user: %v\n", err.Error())
+
+			c.JSON(rerrors.Status(err), gin.H{
+				"error": err,
+			})
+
+			return
+		}
+
+		// a past version is no base for updates, so no ETag is sent
+		c.JSON(http.StatusOK, user)
+
+		return
+	}
+
+	user, err := h.UserService.GetByID(ctx, id, includeDeleted)
 
 	if err != nil {
 		log.Printf("Failed to get user: %v\n", err.Error())
@@ -88,9 +384,42 @@ func (h *Handler) GetByID(c *gin.Context) {
 		return
 	}
 
+	setETag(c, user)
+
 	c.JSON(http.StatusOK, user)
 }
 
+// History godoc
+// @Summary Get the history of a user
+// @Description Get every version of a user, newest first, along with when, by whom and within which request it was
+// @Description changed, and the value of every changed field before and after the change. Versions are rebuilt
+// @Description from the audit log, so changes made before it existed are not listed
+// @Tags user
+// @ID string
+// @Accept  json
+// @Produce  json
+// @Param id path string true "User ID"
+// @Success 200 {object} model.UserHistory
+// @Failure 400 {object} rerrors.Error "Bad Request. Invalid ID"
+// @Failure 404 {object} rerrors.Error "User Not Found"
+// @Failure 500 {object} rerrors.Error "Internal Server Error"
+// @Router /users/{id}/history [get]
+func (h *Handler) History(c *gin.Context) {
+	history, err := h.UserService.History(c.Request.Context(), c.Param("id"))
+
+	if err != nil {
+		log.Printf("Failed to get user history: %v\n", err.Error())
+
+		c.JSON(rerrors.Status(err), gin.H{
+			"error": err,
+		})
+
+		return
+	}
+
+	c.JSON(http.StatusOK, history)
+}
+
 // Create godoc
 // @Summary Create user
 // @Description Add user to database
@@ -99,6 +428,7 @@ func (h *Handler) GetByID(c *gin.Context) {
 // @Produce  json
 // @Param user body createPayload true "Add user"
 // @Success 201 {object} model.User
+// @Header 201 {string} ETag "version of the user"
 // @Failure 400 {object} rerrors.Error "Validation error"
 // @Failure 409 {object} rerrors.Error "Unique Violation"
 // @Failure 500 {object} rerrors.Error "Internal Server Error"
@@ -134,21 +464,298 @@ func (h *Handler) Create(c *gin.Context) {
 		return
 	}
 
+	setETag(c, user)
+
 	c.JSON(http.StatusCreated, user)
 }
 
+// UsersMethod dispatches custom methods on the users collection, such as
+// POST /users:batch, which gin can't route on their own
+func (h *Handler) UsersMethod(c *gin.Context) {
+	switch strings.TrimPrefix(c.Param("method"), ":") {
+	case "batch":
+		h.CreateBatch(c)
+	case "batchUpdate":
+		h.UpdateBatch(c)
+	case "batchDelete":
+		h.DeleteBatch(c)
+	default:
+		err := rerrors.NewNotFound("method", c.Param("method"))
+		log.Printf("failed to route users method: %v\n", err.Error())
+
+		c.JSON(err.Status(), gin.H{
+			"error": err,
+		})
+	}
+}
+
+// CreateBatch godoc
+// @Summary Create users in batch
+// @Description Add several users to database, reporting the outcome of each of them in the order they were sent.
+// @Description Users are validated as in Create. With atomic set, either every user is created or none is,
+// @Description and users left out because of another one fail with 424. Otherwise each user is created on its own
+// @Tags user
+// @Accept  json
+// @Produce  json
+// @Param users body createBatchPayload true "Add users"
+// @Success 207 {object} model.BatchResults
+// @Failure 400 {object} rerrors.Error "Empty or too large batch"
+// @Failure 500 {object} rerrors.Error "Internal Server Error"
+// @Router /users:batch [post]
+func (h *Handler) CreateBatch(c *gin.Context) {
+	var req createBatchPayload
+
+	// Bind incoming json to struct and check for validation errors
+	ok := bindData(c, &req)
+
+	if !ok {
+		log.Println("failed to bind data")
+		return
+	}
+
+	users := make([]*model.User, len(req.Users))
+
+	for i, u := range req.Users {
+		users[i] = &model.User{
+			Name:      u.Name,
+			Email:     u.Email,
+			Cpf:       u.Cpf,
+			BirthDate: u.Birthdate,
+		}
+	}
+
+	results, err := h.UserService.CreateBatch(c.Request.Context(), users, req.Atomic)
+
+	if err != nil {
+		log.Printf("failed to create users: %v\n", err.Error())
+
+		c.JSON(rerrors.Status(err), gin.H{
+			"error": err,
+		})
+		return
+	}
+
+	c.JSON(http.StatusMultiStatus, results)
+}
+
+// UpdateBatch godoc
+// @Summary Update users in batch
+// @Description Apply the same patch to several users, picked either by id or with a filter expression as in user listings,
+// @Description reporting the outcome of each of them. The patch is either a JSON Merge Patch object or a JSON Patch array,
+// @Description and each user is patched on its own, as in PATCH /users/{id} but regardless of its version.
+// @Description With dry_run set, nothing is written and the changes that would have been made are reported
+// @Tags user
+// @Accept  json
+// @Produce  json
+// @Param batch body batchUpdatePayload true "Users and patch"
+// @Success 207 {object} model.BatchResults
+// @Failure 400 {object} rerrors.Error "Invalid patch, missing or too many users"
+// @Failure 500 {object} rerrors.Error "Internal Server Error"
+// @Router /users:batchUpdate [post]
+func (h *Handler) UpdateBatch(c *gin.Context) {
+	var req batchUpdatePayload
+
+	// Bind incoming json to struct and check for validation errors
+	ok := bindData(c, &req)
+
+	if !ok {
+		log.Println("failed to bind data")
+		return
+	}
+
+	mediaType := model.MergePatchMediaType
+
+	if bytes.HasPrefix(bytes.TrimSpace(req.Patch), []byte("[")) {
+		mediaType = model.JSONPatchMediaType
+	}
+
+	patch, err := model.ParseUserPatch(mediaType, req.Patch)
+
+	if err != nil {
+		log.Printf("failed to update users: %v\n", err.Error())
+
+		c.JSON(rerrors.Status(err), gin.H{
+			"error": err,
+		})
+		return
+	}
+
+	sel := model.BatchSelector{IDs: req.IDs, Filter: req.Filter}
+
+	results, err := h.UserService.UpdateBatch(c.Request.Context(), sel, patch, req.DryRun)
+
+	if err != nil {
+		log.Printf("failed to update users: %v\n", err.Error())
+
+		c.JSON(rerrors.Status(err), gin.H{
+			"error": err,
+		})
+		return
+	}
+
+	c.JSON(http.StatusMultiStatus, results)
+}
+
+// DeleteBatch godoc
+// @Summary Delete users in batch
+// @Description Delete several users, picked either by id or with a filter expression as in user listings,
+// @Description reporting the outcome of each of them. Each user is deleted on its own, as in DELETE /users/{id}.
+// @Description With dry_run set, nothing is written and the users that would have been deleted are reported
+// @Tags user
+// @Accept  json
+// @Produce  json
+// @Param batch body batchDeletePayload true "Users"
+// @Success 207 {object} model.BatchResults
+// @Failure 400 {object} rerrors.Error "Missing or too many users"
+// @Failure 500 {object} rerrors.Error "Internal Server Error"
+// @Router /users:batchDelete [post]
+func (h *Handler) DeleteBatch(c *gin.Context) {
+	var req batchDeletePayload
+
+	// Bind incoming json to struct and check for validation errors
+	ok := bindData(c, &req)
+
+	if !ok {
+		log.Println("failed to bind data")
+		return
+	}
+
+	sel := model.BatchSelector{IDs: req.IDs, Filter: req.Filter}
+
+	results, err := h.UserService.DeleteBatch(c.Request.Context(), sel, req.DryRun)
+
+	if err != nil {
+		log.Printf("failed to delete users: %v\n", err.Error())
+
+		c.JSON(rerrors.Status(err), gin.H{
+			"error": err,
+		})
+		return
+	}
+
+	c.JSON(http.StatusMultiStatus, results)
+}
+
+// Import godoc
+// @Summary Import users from CSV
+// @Description Create the users listed in a CSV file, one per line after a header line naming the columns.
+// @Description mapping is a JSON object telling which user field (name, email, cpf or birthdate) each column holds;
+// @Description without it columns must be named after the fields. Columns may be separated by commas or semicolons,
+// @Description and birthdates written as 2006-01-02 or 02/01/2006. Users are validated as in Create, and lines that
+// @Description can't be imported are listed in the CSV report returned, with the reason. The rest are imported at once
+// @Tags user
+// @Accept  multipart/form-data
+// @Produce  text/csv
+// @Param file formData file true "CSV file"
+// @Param mapping formData string false "Field held by each column, as a JSON object"
+// @Success 200 {file} file "Rejected lines, as CSV"
+// @Header 200 {integer} X-Imported-Count "number of users imported"
+// @Header 200 {integer} X-Rejected-Count "number of lines rejected"
+// @Failure 400 {object} rerrors.Error "Missing or unreadable file, invalid mapping"
+// @Failure 409 {object} rerrors.Error "A user was taken while importing"
+// @Failure 500 {object} rerrors.Error "Internal Server Error"
+// @Router /users/import [post]
+func (h *Handler) Import(c *gin.Context) {
+	fh, err := c.FormFile("file")
+
+	if err != nil {
+		err := rerrors.NewBadRequest("file is required")
+		log.Printf("failed to import users: %v\n", err.Error())
+
+		c.JSON(err.Status(), gin.H{
+			"error": err,
+		})
+		return
+	}
+
+	var mapping map[string]string
+
+	if m := c.PostForm("mapping"); m != "" {
+		if err := json.Unmarshal([]byte(m), &mapping); err != nil {
+			err := rerrors.NewBadRequest("mapping must be a JSON object of column names to fields")
+			log.Printf("failed to import users: %v\n", err.Error())
+
+			c.JSON(err.Status(), gin.H{
+				"error": err,
+			})
+			return
+		}
+	}
+
+	f, err := fh.Open()
+
+	if err != nil {
+		err := rerrors.NewBadRequest("unable to read file")
+		log.Printf("failed to import users: %v\n", err.Error())
+
+		c.JSON(err.Status(), gin.H{
+			"error": err,
+		})
+		return
+	}
+
+	defer f.Close()
+
+	rows, err := model.ReadUserCSV(f, mapping)
+
+	if err != nil {
+		log.Printf("failed to import users: %v\n", err.Error())
+
+		c.JSON(rerrors.Status(err), gin.H{
+			"error": err,
+		})
+		return
+	}
+
+	report, err := h.UserService.Import(c.Request.Context(), rows)
+
+	if err != nil {
+		log.Printf("failed to import users: %v\n", err.Error())
+
+		c.JSON(rerrors.Status(err), gin.H{
+			"error": err,
+		})
+		return
+	}
+
+	var buf bytes.Buffer
+
+	if err := report.WriteCSV(&buf); err != nil {
+		err := rerrors.NewInternal()
+		log.Printf("failed to write import report: %v\n", err.Error())
+
+		c.JSON(err.Status(), gin.H{
+			"error": err,
+		})
+		return
+	}
+
+	c.Header("Content-Disposition", `attachment; filename="import-report.csv"`)
+	c.Header("X-Imported-Count", strconv.Itoa(report.Imported))
+	c.Header("X-Rejected-Count", strconv.Itoa(len(report.Rejected)))
+
+	c.Data(http.StatusOK, "text/csv; charset=utf-8", buf.Bytes())
+}
+
 // Update godoc
 // @Summary Update user
-// @Description Update user
+// @Description Replace every field of a user; to change only some of them, use PATCH. The If-Match header
+// @Description must carry the ETag of the user being updated, so changes made by someone else in the meantime
+// @Description are never overwritten.
 // @Tags user
 // @ID string
 // @Accept  json
 // @Produce  json
 // @Param id path string true "User ID"
-// @Param user body updatePayload false "Update user"
+// @Param If-Match header string true "ETag of the user being updated"
+// @Param user body updatePayload true "Update user"
 // @Success 200 {object} model.User
+// @Header 200 {string} ETag "new version of the user"
 // @Failure 400 {object} rerrors.Error "Validation error"
+// @Failure 404 {object} rerrors.Error "User Not Found"
 // @Failure 409 {object} rerrors.Error "Unique Violation"
+// @Failure 412 {object} rerrors.Error "User changed since it was read"
+// @Failure 428 {object} rerrors.Error "Missing If-Match header"
 // @Failure 500 {object} rerrors.Error "Internal Server Error"
 // @Router /users/{id} [put]
 func (h *Handler) Update(c *gin.Context) {
@@ -181,9 +788,20 @@ func (h *Handler) Update(c *gin.Context) {
 		BirthDate: req.Birthdate,
 	}
 
+	version, err := ifMatchVersion(c)
+
+	if err != nil {
+		log.Printf("failed to update user: %v\n", err.Error())
+
+		c.JSON(rerrors.Status(err), gin.H{
+			"error": err,
+		})
+		return
+	}
+
 	ctx := c.Request.Context()
 
-	user, err := h.UserService.Update(ctx, id, u)
+	user, err := h.UserService.Update(ctx, id, u, version)
 
 	if err != nil {
 		log.Printf("failed to update user: %v\n", err.Error())
@@ -194,18 +812,99 @@ func (h *Handler) Update(c *gin.Context) {
 		return
 	}
 
+	setETag(c, user)
+
+	c.JSON(http.StatusOK, user)
+}
+
+// Patch godoc
+// @Summary Patch user
+// @Description Change some fields of a user with a JSON Merge Patch (RFC 7396, sent as application/merge-patch+json)
+// @Description or a JSON Patch (RFC 6902, sent as application/json-patch+json). The patch applies to the user as
+// @Description returned by GET, and the result must be a valid user. A failed JSON Patch test fails the whole patch
+// @Description with a conflict. As with PUT, the If-Match header must carry the ETag of the user being patched.
+// @Tags user
+// @ID string
+// @Accept  application/merge-patch+json,application/json-patch+json
+// @Produce  json
+// @Param id path string true "User ID"
+// @Param If-Match header string true "ETag of the user being patched"
+// @Param patch body object true "Merge patch object or array of JSON Patch operations"
+// @Success 200 {object} model.User
+// @Header 200 {string} ETag "new version of the user"
+// @Failure 400 {object} rerrors.Error "Invalid patch or patched user"
+// @Failure 404 {object} rerrors.Error "User Not Found"
+// @Failure 409 {object} rerrors.Error "Failed test operation or unique violation"
+// @Failure 412 {object} rerrors.Error "User changed since it was read"
+// @Failure 415 {object} rerrors.Error "Unsupported patch format"
+// @Failure 428 {object} rerrors.Error "Missing If-Match header"
+// @Failure 500 {object} rerrors.Error "Internal Server Error"
+// @Router /users/{id} [patch]
+func (h *Handler) Patch(c *gin.Context) {
+	version, err := ifMatchVersion(c)
+
+	if err != nil {
+		log.Printf("failed to patch user: %v\n", err.Error())
+
+		c.JSON(rerrors.Status(err), gin.H{
+			"error": err,
+		})
+		return
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+
+	if err != nil {
+		err := rerrors.NewBadRequest("unable to read patch")
+		log.Printf("failed to patch user: %v\n", err.Error())
+
+		c.JSON(err.Status(), gin.H{
+			"error": err,
+		})
+		return
+	}
+
+	patch, err := model.ParseUserPatch(c.ContentType(), body)
+
+	if err != nil {
+		log.Printf("failed to patch user: %v\n", err.Error())
+
+		c.JSON(rerrors.Status(err), gin.H{
+			"error": err,
+		})
+		return
+	}
+
+	user, err := h.UserService.Patch(c.Request.Context(), c.Param("id"), patch, version)
+
+	if err != nil {
+		log.Printf("failed to patch user: %v\n", err.Error())
+
+		c.JSON(rerrors.Status(err), gin.H{
+			"error": err,
+		})
+		return
+	}
+
+	setETag(c, user)
+
 	c.JSON(http.StatusOK, user)
 }
 
 // Delete godoc
 // @Summary Delete user
-// @Description Delete user
+// @Description Mark a user as deleted. Deleted users can be restored until they are purged.
+// @Description With purge=true the user is removed for good, which requires the X-Admin-Token header.
 // @Tags user
 // @ID string
 // @Accept  json
 // @Produce  json
 // @Param id path string true "User ID"
+// @Param purge query bool false "remove the user permanently (admin only)"
+// @Param X-Admin-Token header string false "admin token, required to purge"
 // @Success 204
+// @Failure 400 {object} rerrors.Error "Bad Request. Invalid ID"
+// @Failure 403 {object} rerrors.Error "Missing or invalid admin token"
 // @Failure 404 {object} rerrors.Error "User Not Found"
 // @Router /users/{id} [delete]
 func (h *Handler) Delete(c *gin.Context) {
@@ -221,9 +920,36 @@ func (h *Handler) Delete(c *gin.Context) {
 		return
 	}
 
+	purge, err := queryBool(c, "purge")
+
+	if err != nil {
+		log.Printf("failed to delete user: %v\n", err.Error())
+
+		c.JSON(rerrors.Status(err), gin.H{
+			"error": err,
+		})
+
+		return
+	}
+
+	if purge && !h.isAdmin(c) {
+		err := rerrors.NewForbidden("purging users requires a valid admin token")
+		log.Printf("failed to purge user: %v\n", err)
+
+		c.JSON(err.Status(), gin.H{
+			"error": err,
+		})
+
+		return
+	}
+
 	ctx := c.Request.Context()
 
-	err := h.UserService.Delete(ctx, id)
+	if purge {
+		err = h.UserService.Purge(ctx, id)
+	} else {
+		err = h.UserService.Delete(ctx, id)
+	}
 
 	if err != nil {
 		log.Printf("failed to delete user: %v\n", err.Error())
@@ -237,3 +963,39 @@ func (h *Handler) Delete(c *gin.Context) {
 
 	c.JSON(http.StatusNoContent, nil)
 }
+
+// Restore godoc
+// @Summary Restore user
+// @Description Undo the deletion of a user
+// @Tags user
+// @ID string
+// @Accept  json
+// @Produce  json
+// @Param id path string true "User ID"
+// @Success 200 {object} model.User
+// @Header 200 {string} ETag "version of the user"
+// @Failure 400 {object} rerrors.Error "Bad Request. Invalid ID"
+// @Failure 404 {object} rerrors.Error "Deleted User Not Found"
+// @Failure 409 {object} rerrors.Error "E-mail or CPF taken by another user"
+// @Failure 500 {object} rerrors.Error "Internal Server Error"
+// @Router /users/{id}/restore [post]
+func (h *Handler) Restore(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := c.Param("id")
+
+	user, err := h.UserService.Restore(ctx, id)
+
+	if err != nil {
+		log.Printf("failed to restore user: %v\n", err.Error())
+
+		c.JSON(rerrors.Status(err), gin.H{
+			"error": err,
+		})
+
+		return
+	}
+
+	setETag(c, user)
+
+	c.JSON(http.StatusOK, user)
+}
@@ -4,8 +4,11 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
 	"time"
 
@@ -36,8 +39,16 @@ func (router *MockedRouter) Initialize(c *MockedContainer) {
 	r := gin.Default()
 
 	// ####### MIDDLEWARES #######
-	// CORS
-	r.Use(cors.Default())
+	// CORS, letting browsers send If-Match and read the headers of our
+	// responses. X-Actor is left out: only the gateway may send it
+	corsConfig := cors.DefaultConfig()
+	corsConfig.AllowAllOrigins = true
+	corsConfig.AddAllowHeaders("If-Match", "X-Request-ID", "X-Read-Your-Writes")
+	corsConfig.AddExposeHeaders("ETag", "Link", "X-Total-Count", "X-Request-ID", "Content-Disposition", "X-Imported-Count", "X-Rejected-Count", "X-Export-Error")
+	r.Use(cors.New(corsConfig))
+
+	// Actor and request ID, recorded in the audit log
+	r.Use(RequestContext(h.GatewayToken))
 
 	// ####### API V1 #######
 	v1Group := r.Group("/api/v1")
@@ -47,17 +58,41 @@ func (router *MockedRouter) Initialize(c *MockedContainer) {
 
 	// ## GET ##
 	usersGroup.GET("", h.GetAll)
+	usersGroup.GET("/search", h.Search)
+	usersGroup.GET("/export", h.Export)
 	usersGroup.GET("/:id", h.GetByID)
+	usersGroup.GET("/:id/history", h.History)
 
 	// ## POST ##
 	usersGroup.POST("", h.Create)
+	usersGroup.POST("/import", h.Import)
+	usersGroup.POST("/:id/restore", h.Restore)
+	v1Group.POST("/users:method", h.UsersMethod) // /users:batch, /users:batchUpdate, /users:batchDelete
 
 	// ## PUT ##
 	usersGroup.PUT("/:id", h.Update)
 
+	// ## PATCH ##
+	usersGroup.PATCH("/:id", h.Patch)
+
 	// ## DELETE ##
 	usersGroup.DELETE("/:id", h.Delete)
 
+	// ---- AUDIT RESOURCES /audit ----
+	v1Group.GET("/audit", h.ListAudit)
+	v1Group.GET("/audit/verify", h.VerifyAudit)
+
+	// ---- WEBHOOK RESOURCES /webhooks ----
+	webhooksGroup := v1Group.Group("/webhooks")
+
+	webhooksGroup.GET("", h.ListWebhooks)
+	webhooksGroup.GET("/:id", h.GetWebhook)
+	webhooksGroup.GET("/:id/deliveries", h.ListWebhookDeliveries)
+	webhooksGroup.POST("", h.CreateWebhook)
+	webhooksGroup.POST("/:id/deliveries/:delivery_id/redeliver", h.RedeliverWebhook)
+	webhooksGroup.PUT("/:id", h.UpdateWebhook)
+	webhooksGroup.DELETE("/:id", h.DeleteWebhook)
+
 	// ####### inject implementation of gin engine #######
 	router.r = r
 }
@@ -86,19 +121,21 @@ func TestUserHandler(t *testing.T) {
 			err := faker.FakeData(&users)
 			assert.NoError(t, err)
 
+			page := &model.UserPage{Data: users, NextCursor: "next"}
+
 			rr := httptest.NewRecorder()
 
 			request, _ := http.NewRequest(http.MethodGet, "http://localhost:8080/api/v1/users", nil)
 			request.Header.Set("Content-Type", "application/json")
 
-			mockUserService.On("GetAll", request.Context(), "").Return(users, nil)
+			mockUserService.On("GetAll", mock.Anything, model.UserListParams{}).Return(page, nil)
 
 			router.r.ServeHTTP(rr, request)
 
 			mockUserService.AssertNumberOfCalls(t, "GetAll", 1)
-			mockUserService.AssertCalled(t, "GetAll", request.Context(), "")
+			mockUserService.AssertCalled(t, "GetAll", mock.Anything, model.UserListParams{})
 
-			respBody, _ := json.Marshal(users)
+			respBody, _ := json.Marshal(page)
 
 			assert.Equal(t, http.StatusOK, rr.Code)
 			assert.Equal(t, respBody, rr.Body.Bytes())
@@ -133,8 +170,8 @@ func TestUserHandler(t *testing.T) {
 
 			users = append(users, user)
 
-			// err := faker.FakeData(&users)
-			// assert.NoError(t, err)
+			page := &model.UserPage{Data: users}
+			params := model.UserListParams{Name: "John Doe"}
 
 			rr := httptest.NewRecorder()
 
@@ -144,21 +181,21 @@ func TestUserHandler(t *testing.T) {
 			request.URL.RawQuery = q.Encode()
 			request.Header.Set("Content-Type", "application/json")
 
-			mockUserService.On("GetAll", mock.AnythingOfType("*context.emptyCtx"), "John Doe").Return(users, nil)
+			mockUserService.On("GetAll", mock.Anything, params).Return(page, nil)
 
 			router.r.ServeHTTP(rr, request)
 
 			mockUserService.AssertNumberOfCalls(t, "GetAll", 1)
-			mockUserService.AssertCalled(t, "GetAll", mock.AnythingOfType("*context.emptyCtx"), "John Doe")
+			mockUserService.AssertCalled(t, "GetAll", mock.Anything, params)
 
-			respBody, _ := json.Marshal(users)
+			respBody, _ := json.Marshal(page)
 
 			assert.Equal(t, http.StatusOK, rr.Code)
 			assert.Equal(t, respBody, rr.Body.Bytes())
 			mockUserService.AssertExpectations(t)
 		})
 
-		t.Run("Success no content", func(t *testing.T) {
+		t.Run("Success with limit and cursor", func(t *testing.T) {
 			mockUserService := new(mocks.MockUserService)
 
 			h := &Handler{
@@ -175,24 +212,28 @@ func TestUserHandler(t *testing.T) {
 
 			var users []model.User
 
-			rr := httptest.NewRecorder()
+			err := faker.FakeData(&users)
+			assert.NoError(t, err)
 
-			request, _ := http.NewRequest(http.MethodGet, "http://localhost:8080/api/v1/users", nil)
+			page := &model.UserPage{Data: users}
+			params := model.UserListParams{Limit: 20, Cursor: "abc"}
+
+			rr := httptest.NewRecorder()
 
+			request, _ := http.NewRequest(http.MethodGet, "http://localhost:8080/api/v1/users?limit=20&cursor=abc", nil)
 			request.Header.Set("Content-Type", "application/json")
 
-			mockUserService.On("GetAll", mock.AnythingOfType("*context.emptyCtx"), "").Return(users, nil)
+			mockUserService.On("GetAll", mock.Anything, params).Return(page, nil)
 
 			router.r.ServeHTTP(rr, request)
 
-			mockUserService.AssertNumberOfCalls(t, "GetAll", 1)
-			mockUserService.AssertCalled(t, "GetAll", mock.AnythingOfType("*context.emptyCtx"), "")
+			mockUserService.AssertCalled(t, "GetAll", mock.Anything, params)
 
-			assert.Equal(t, http.StatusNoContent, rr.Code)
+			assert.Equal(t, http.StatusOK, rr.Code)
 			mockUserService.AssertExpectations(t)
 		})
 
-		t.Run("Error", func(t *testing.T) {
+		t.Run("Success with filter and sort", func(t *testing.T) {
 			mockUserService := new(mocks.MockUserService)
 
 			h := &Handler{
@@ -207,30 +248,31 @@ func TestUserHandler(t *testing.T) {
 
 			router.Initialize(c)
 
-			var users []model.User
+			page := &model.UserPage{Data: []model.User{}}
+			params := model.UserListParams{
+				Filter: `email ends_with "@acme.com.br"`,
+				Sort:   model.Sort{{Field: "name"}, {Field: "birthdate", Desc: true}},
+			}
 
 			rr := httptest.NewRecorder()
 
-			request, _ := http.NewRequest(http.MethodGet, "http://localhost:8080/api/v1/users", nil)
-
+			request, _ := http.NewRequest(http.MethodGet, "http://localhost:8080/api/v1/users?sort=name,-birthdate", nil)
+			q := request.URL.Query()
+			q.Add("filter", params.Filter)
+			request.URL.RawQuery = q.Encode()
 			request.Header.Set("Content-Type", "application/json")
 
-			mockErrorResponse := rerrors.NewInternal()
-
-			mockUserService.On("GetAll", mock.AnythingOfType("*context.emptyCtx"), "").Return(users, mockErrorResponse)
+			mockUserService.On("GetAll", mock.Anything, params).Return(page, nil)
 
 			router.r.ServeHTTP(rr, request)
 
-			mockUserService.AssertNumberOfCalls(t, "GetAll", 1)
-			mockUserService.AssertCalled(t, "GetAll", mock.AnythingOfType("*context.emptyCtx"), "")
+			mockUserService.AssertCalled(t, "GetAll", mock.Anything, params)
 
-			assert.Equal(t, http.StatusInternalServerError, rr.Code)
+			assert.Equal(t, http.StatusOK, rr.Code)
 			mockUserService.AssertExpectations(t)
 		})
-	})
 
-	t.Run("GetByID", func(t *testing.T) {
-		t.Run("Success", func(t *testing.T) {
+		t.Run("Error invalid sort", func(t *testing.T) {
 			mockUserService := new(mocks.MockUserService)
 
 			h := &Handler{
@@ -245,37 +287,19 @@ func TestUserHandler(t *testing.T) {
 
 			router.Initialize(c)
 
-			uid, err := uuid.NewRandom()
-			assert.NoError(t, err)
-
-			user := &model.User{
-				UID:       uid,
-				Name:      faker.Name(),
-				Email:     faker.Email(),
-				Cpf:       "123.456.789-10",
-				BirthDate: time.Date(2003, 1, 1, 1, 1, 1, 1, time.UTC),
-			}
-
-			mockUserService.On("GetByID", mock.AnythingOfType("*context.emptyCtx"), uid.String()).Return(user, nil)
-
 			rr := httptest.NewRecorder()
-			request, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("http://localhost:8080/api/v1/users/%s", uid.String()), nil)
 
+			request, _ := http.NewRequest(http.MethodGet, "http://localhost:8080/api/v1/users?sort=password", nil)
 			request.Header.Set("Content-Type", "application/json")
 
 			router.r.ServeHTTP(rr, request)
 
-			mockUserService.AssertCalled(t, "GetByID", mock.AnythingOfType("*context.emptyCtx"), uid.String())
-			mockUserService.AssertNumberOfCalls(t, "GetByID", 1)
-
-			respBody, _ := json.Marshal(user)
+			mockUserService.AssertNotCalled(t, "GetAll", mock.Anything, mock.Anything)
 
-			assert.Equal(t, http.StatusOK, rr.Code)
-			assert.Equal(t, respBody, rr.Body.Bytes())
-			mockUserService.AssertExpectations(t)
+			assert.Equal(t, http.StatusBadRequest, rr.Code)
 		})
 
-		t.Run("Invalid ID", func(t *testing.T) {
+		t.Run("Error invalid limit", func(t *testing.T) {
 			mockUserService := new(mocks.MockUserService)
 
 			h := &Handler{
@@ -290,25 +314,19 @@ func TestUserHandler(t *testing.T) {
 
 			router.Initialize(c)
 
-			mockErrorResponse := rerrors.NewBadRequest("invalid id")
-
-			mockUserService.On("GetByID", mock.AnythingOfType("*context.emptyCtx"), "invalid_id").Return(nil, mockErrorResponse)
-
 			rr := httptest.NewRecorder()
-			request, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("http://localhost:8080/api/v1/users/%s", "invalid_id"), nil)
 
+			request, _ := http.NewRequest(http.MethodGet, "http://localhost:8080/api/v1/users?limit=ten", nil)
 			request.Header.Set("Content-Type", "application/json")
 
 			router.r.ServeHTTP(rr, request)
 
-			mockUserService.AssertCalled(t, "GetByID", mock.AnythingOfType("*context.emptyCtx"), "invalid_id")
-			mockUserService.AssertNumberOfCalls(t, "GetByID", 1)
+			mockUserService.AssertNotCalled(t, "GetAll", mock.Anything, mock.Anything)
 
 			assert.Equal(t, http.StatusBadRequest, rr.Code)
-			mockUserService.AssertExpectations(t)
 		})
 
-		t.Run("Error ID not found", func(t *testing.T) {
+		t.Run("Success empty page", func(t *testing.T) {
 			mockUserService := new(mocks.MockUserService)
 
 			h := &Handler{
@@ -323,30 +341,28 @@ func TestUserHandler(t *testing.T) {
 
 			router.Initialize(c)
 
-			uid, err := uuid.NewRandom()
-			assert.NoError(t, err)
-
-			mockErrorResponse := rerrors.NewNotFound("id", uid.String())
-
-			mockUserService.On("GetByID", mock.AnythingOfType("*context.emptyCtx"), "invalid_id").Return(nil, mockErrorResponse)
+			page := &model.UserPage{Data: []model.User{}}
 
 			rr := httptest.NewRecorder()
-			request, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("http://localhost:8080/api/v1/users/%s", "invalid_id"), nil)
+
+			request, _ := http.NewRequest(http.MethodGet, "http://localhost:8080/api/v1/users", nil)
 
 			request.Header.Set("Content-Type", "application/json")
 
+			mockUserService.On("GetAll", mock.Anything, model.UserListParams{}).Return(page, nil)
+
 			router.r.ServeHTTP(rr, request)
 
-			mockUserService.AssertCalled(t, "GetByID", mock.AnythingOfType("*context.emptyCtx"), "invalid_id")
-			mockUserService.AssertNumberOfCalls(t, "GetByID", 1)
+			mockUserService.AssertNumberOfCalls(t, "GetAll", 1)
+			mockUserService.AssertCalled(t, "GetAll", mock.Anything, model.UserListParams{})
 
-			assert.Equal(t, http.StatusNotFound, rr.Code)
+			assert.Equal(t, http.StatusOK, rr.Code)
+			assert.JSONEq(t, `{"data":[]}`, rr.Body.String())
+			assert.Empty(t, rr.Header().Get("Link"))
 			mockUserService.AssertExpectations(t)
 		})
-	})
 
-	t.Run("Create", func(t *testing.T) {
-		t.Run("Success", func(t *testing.T) {
+		t.Run("Success with page sets pagination headers", func(t *testing.T) {
 			mockUserService := new(mocks.MockUserService)
 
 			h := &Handler{
@@ -361,54 +377,38 @@ func TestUserHandler(t *testing.T) {
 
 			router.Initialize(c)
 
-			uid, err := uuid.NewRandom()
-			assert.NoError(t, err)
-
-			u := &model.User{
-				Name:      "John Doe",
-				Email:     "test@mail.com",
-				Cpf:       "313.716.772-80",
-				BirthDate: time.Date(2003, 1, 1, 1, 1, 1, 1, time.UTC),
-			}
+			var users []model.User
 
-			createdUser := &model.User{
-				UID:       uid,
-				Email:     u.Email,
-				Cpf:       u.Cpf,
-				BirthDate: u.BirthDate,
-			}
+			err := faker.FakeData(&users)
+			assert.NoError(t, err)
 
-			mockUserService.On("Create", mock.AnythingOfType("*context.emptyCtx"), u).Return(createdUser, nil)
+			total := 45
+			page := &model.UserPage{Data: users, Page: 2, PerPage: 10, Total: &total}
+			params := model.UserListParams{Name: "Jo", Page: 2, PerPage: 10}
 
 			rr := httptest.NewRecorder()
 
-			body, err := json.Marshal(gin.H{
-				"name":      u.Name,
-				"email":     u.Email,
-				"cpf":       u.Cpf,
-				"birthdate": u.BirthDate,
-			})
-
-			assert.NoError(t, err)
-
-			request, _ := http.NewRequest(http.MethodPost, "http://localhost:8080/api/v1/users", bytes.NewBuffer(body))
-
+			request, _ := http.NewRequest(http.MethodGet, "http://localhost:8080/api/v1/users?name=Jo&page=2&per_page=10", nil)
 			request.Header.Set("Content-Type", "application/json")
 
-			router.r.ServeHTTP(rr, request)
+			mockUserService.On("GetAll", mock.Anything, params).Return(page, nil)
 
-			mockUserService.AssertCalled(t, "Create", mock.AnythingOfType("*context.emptyCtx"), u)
-			mockUserService.AssertNumberOfCalls(t, "Create", 1)
+			router.r.ServeHTTP(rr, request)
 
-			u.UID = uid
-			respBody, _ := json.Marshal(createdUser)
+			mockUserService.AssertCalled(t, "GetAll", mock.Anything, params)
 
-			assert.Equal(t, http.StatusCreated, rr.Code)
-			assert.Equal(t, respBody, rr.Body.Bytes())
+			assert.Equal(t, http.StatusOK, rr.Code)
+			assert.Equal(t, "45", rr.Header().Get("X-Total-Count"))
+			assert.Equal(t, strings.Join([]string{
+				`</api/v1/users?name=Jo&page=1&per_page=10>; rel="first"`,
+				`</api/v1/users?name=Jo&page=1&per_page=10>; rel="prev"`,
+				`</api/v1/users?name=Jo&page=3&per_page=10>; rel="next"`,
+				`</api/v1/users?name=Jo&page=5&per_page=10>; rel="last"`,
+			}, ", "), rr.Header().Get("Link"))
 			mockUserService.AssertExpectations(t)
 		})
 
-		t.Run("Error underage", func(t *testing.T) {
+		t.Run("Success with cursor sets next link", func(t *testing.T) {
 			mockUserService := new(mocks.MockUserService)
 
 			h := &Handler{
@@ -423,42 +423,25 @@ func TestUserHandler(t *testing.T) {
 
 			router.Initialize(c)
 
-			u := &model.User{
-				Name:      "John Doe",
-				Email:     "test@mail.com",
-				Cpf:       "313.716.772-80",
-				BirthDate: time.Date(2019, 1, 1, 1, 1, 1, 1, time.UTC),
-			}
-
-			mockErrorResponse := rerrors.NewBadRequest("underage")
-
-			mockUserService.On("Create", mock.AnythingOfType("*context.emptyCtx"), u).Return(nil, mockErrorResponse)
+			page := &model.UserPage{Data: []model.User{{UID: uuid.New()}}, NextCursor: "abc"}
+			params := model.UserListParams{Limit: 1}
 
 			rr := httptest.NewRecorder()
 
-			body, err := json.Marshal(gin.H{
-				"name":      u.Name,
-				"email":     u.Email,
-				"cpf":       u.Cpf,
-				"birthdate": u.BirthDate,
-			})
-
-			assert.NoError(t, err)
-
-			request, _ := http.NewRequest(http.MethodPost, "http://localhost:8080/api/v1/users", bytes.NewBuffer(body))
-
+			request, _ := http.NewRequest(http.MethodGet, "http://localhost:8080/api/v1/users?limit=1", nil)
 			request.Header.Set("Content-Type", "application/json")
 
-			router.r.ServeHTTP(rr, request)
+			mockUserService.On("GetAll", mock.Anything, params).Return(page, nil)
 
-			mockUserService.AssertCalled(t, "Create", mock.AnythingOfType("*context.emptyCtx"), u)
-			mockUserService.AssertNumberOfCalls(t, "Create", 1)
+			router.r.ServeHTTP(rr, request)
 
-			assert.Equal(t, http.StatusBadRequest, rr.Code)
+			assert.Equal(t, http.StatusOK, rr.Code)
+			assert.Empty(t, rr.Header().Get("X-Total-Count"))
+			assert.Equal(t, `</api/v1/users?cursor=abc&limit=1>; rel="next"`, rr.Header().Get("Link"))
 			mockUserService.AssertExpectations(t)
 		})
 
-		t.Run("Error invalid cpf", func(t *testing.T) {
+		t.Run("Error", func(t *testing.T) {
 			mockUserService := new(mocks.MockUserService)
 
 			h := &Handler{
@@ -473,43 +456,27 @@ func TestUserHandler(t *testing.T) {
 
 			router.Initialize(c)
 
-			u := &model.User{
-				Name:      "John Doe",
-				Email:     "test@mail.com",
-				Cpf:       "invalid_cpf",
-				BirthDate: time.Date(2000, 1, 1, 1, 1, 1, 1, time.UTC),
-			}
-
-			mockErrorResponse := rerrors.NewBadRequest("cpf invalid")
-
-			mockUserService.On("Create", mock.AnythingOfType("*context.emptyCtx"), u).Return(nil, mockErrorResponse)
-
 			rr := httptest.NewRecorder()
 
-			body, err := json.Marshal(gin.H{
-				"name":      u.Name,
-				"email":     u.Email,
-				"cpf":       u.Cpf,
-				"birthdate": u.BirthDate,
-			})
+			request, _ := http.NewRequest(http.MethodGet, "http://localhost:8080/api/v1/users", nil)
 
-			assert.NoError(t, err)
+			request.Header.Set("Content-Type", "application/json")
 
-			request, _ := http.NewRequest(http.MethodPost, "http://localhost:8080/api/v1/users", bytes.NewBuffer(body))
+			mockErrorResponse := rerrors.NewInternal()
 
-			request.Header.Set("Content-Type", "application/json")
+			mockUserService.On("GetAll", mock.Anything, model.UserListParams{}).Return(nil, mockErrorResponse)
 
 			router.r.ServeHTTP(rr, request)
 
-			mockUserService.AssertCalled(t, "Create", mock.AnythingOfType("*context.emptyCtx"), u)
-			mockUserService.AssertNumberOfCalls(t, "Create", 1)
+			mockUserService.AssertNumberOfCalls(t, "GetAll", 1)
+			mockUserService.AssertCalled(t, "GetAll", mock.Anything, model.UserListParams{})
 
-			assert.Equal(t, http.StatusBadRequest, rr.Code)
+			assert.Equal(t, http.StatusInternalServerError, rr.Code)
 			mockUserService.AssertExpectations(t)
 		})
 	})
 
-	t.Run("Update", func(t *testing.T) {
+	t.Run("Search", func(t *testing.T) {
 		t.Run("Success", func(t *testing.T) {
 			mockUserService := new(mocks.MockUserService)
 
@@ -525,56 +492,29 @@ func TestUserHandler(t *testing.T) {
 
 			router.Initialize(c)
 
-			uid, err := uuid.NewRandom()
-			assert.NoError(t, err)
-
-			oldCpf := "313.716.772-80"
-			oldBirthdate := time.Date(2003, 1, 1, 1, 1, 1, 1, time.UTC)
-
-			u := &model.User{
-				Name:      "John Doe",
-				Email:     "test@mail.com",
-				Cpf:       "",
-				BirthDate: time.Time{},
-			}
-
-			updatedUser := &model.User{
-				UID:       uid,
-				Name:      u.Name,
-				Email:     u.Email,
-				Cpf:       oldCpf,
-				BirthDate: oldBirthdate,
-			}
-
-			mockUserService.On("Update", mock.AnythingOfType("*context.emptyCtx"), uid.String(), u).Return(updatedUser, nil)
+			results := []model.UserSearchResult{{
+				User:          model.User{UID: uuid.New(), Name: "João da Silva"},
+				Rank:          0.6,
+				NameHighlight: "<mark>João</mark> da Silva",
+			}}
 
 			rr := httptest.NewRecorder()
 
-			body, err := json.Marshal(gin.H{
-				"name":  u.Name,
-				"email": u.Email,
-			})
-
-			assert.NoError(t, err)
-
-			request, _ := http.NewRequest(http.MethodPut, fmt.Sprintf("http://localhost:8080/api/v1/users/%s", uid.String()), bytes.NewBuffer(body))
-
+			request, _ := http.NewRequest(http.MethodGet, "http://localhost:8080/api/v1/users/search?q=joao&limit=5", nil)
 			request.Header.Set("Content-Type", "application/json")
 
-			router.r.ServeHTTP(rr, request)
+			mockUserService.On("Search", mock.Anything, "joao", 5).Return(results, nil)
 
-			mockUserService.AssertCalled(t, "Update", mock.AnythingOfType("*context.emptyCtx"), uid.String(), u)
-			mockUserService.AssertNumberOfCalls(t, "Update", 1)
+			router.r.ServeHTTP(rr, request)
 
-			u.UID = uid
-			respBody, _ := json.Marshal(updatedUser)
+			respBody, _ := json.Marshal(results)
 
 			assert.Equal(t, http.StatusOK, rr.Code)
 			assert.Equal(t, respBody, rr.Body.Bytes())
 			mockUserService.AssertExpectations(t)
 		})
 
-		t.Run("Error underage", func(t *testing.T) {
+		t.Run("Error", func(t *testing.T) {
 			mockUserService := new(mocks.MockUserService)
 
 			h := &Handler{
@@ -589,45 +529,22 @@ func TestUserHandler(t *testing.T) {
 
 			router.Initialize(c)
 
-			uid, err := uuid.NewRandom()
-			assert.NoError(t, err)
-
-			u := &model.User{
-				Name:      "John Doe",
-				Email:     "test@mail.com",
-				Cpf:       "313.716.772-80",
-				BirthDate: time.Date(2019, 1, 1, 1, 1, 1, 1, time.UTC),
-			}
-
-			mockErrorResponse := rerrors.NewBadRequest("underage")
-
-			mockUserService.On("Update", mock.AnythingOfType("*context.emptyCtx"), uid.String(), u).Return(nil, mockErrorResponse)
-
 			rr := httptest.NewRecorder()
 
-			body, err := json.Marshal(gin.H{
-				"name":      u.Name,
-				"email":     u.Email,
-				"cpf":       u.Cpf,
-				"birthdate": u.BirthDate,
-			})
-
-			assert.NoError(t, err)
-
-			request, _ := http.NewRequest(http.MethodPut, fmt.Sprintf("http://localhost:8080/api/v1/users/%s", uid.String()), bytes.NewBuffer(body))
-
+			request, _ := http.NewRequest(http.MethodGet, "http://localhost:8080/api/v1/users/search", nil)
 			request.Header.Set("Content-Type", "application/json")
 
-			router.r.ServeHTTP(rr, request)
+			mockUserService.On("Search", mock.Anything, "", 0).Return(nil, rerrors.NewBadRequest("search query is required"))
 
-			mockUserService.AssertCalled(t, "Update", mock.AnythingOfType("*context.emptyCtx"), uid.String(), u)
-			mockUserService.AssertNumberOfCalls(t, "Update", 1)
+			router.r.ServeHTTP(rr, request)
 
 			assert.Equal(t, http.StatusBadRequest, rr.Code)
 			mockUserService.AssertExpectations(t)
 		})
+	})
 
-		t.Run("Error invalid email", func(t *testing.T) {
+	t.Run("GetByID", func(t *testing.T) {
+		t.Run("Success", func(t *testing.T) {
 			mockUserService := new(mocks.MockUserService)
 
 			h := &Handler{
@@ -645,40 +562,1232 @@ func TestUserHandler(t *testing.T) {
 			uid, err := uuid.NewRandom()
 			assert.NoError(t, err)
 
-			u := &model.User{
-				Name:      "John Doe",
-				Email:     "invalid_email",
-				Cpf:       "313.716.772-80",
-				BirthDate: time.Date(2000, 1, 1, 1, 1, 1, 1, time.UTC),
+			user := &model.User{
+				UID:       uid,
+				Name:      faker.Name(),
+				Email:     faker.Email(),
+				Cpf:       "123.456.789-10",
+				BirthDate: time.Date(2003, 1, 1, 1, 1, 1, 1, time.UTC),
 			}
 
-			mockErrorResponse := rerrors.NewBadRequest("invalid email")
-
-			mockUserService.On("Update", mock.AnythingOfType("*context.emptyCtx"), uid.String(), u).Return(nil, mockErrorResponse)
+			mockUserService.On("GetByID", mock.Anything, uid.String(), false).Return(user, nil)
 
 			rr := httptest.NewRecorder()
-
-			body, err := json.Marshal(gin.H{
-				"name":      u.Name,
-				"email":     u.Email,
-				"cpf":       u.Cpf,
-				"birthdate": u.BirthDate,
-			})
-
-			assert.NoError(t, err)
-
-			request, _ := http.NewRequest(http.MethodPut, fmt.Sprintf("http://localhost:8080/api/v1/users/%s", uid.String()), bytes.NewBuffer(body))
+			request, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("http://localhost:8080/api/v1/users/%s", uid.String()), nil)
 
 			request.Header.Set("Content-Type", "application/json")
 
 			router.r.ServeHTTP(rr, request)
 
-			mockUserService.AssertCalled(t, "Update", mock.AnythingOfType("*context.emptyCtx"), uid.String(), u)
-			mockUserService.AssertNumberOfCalls(t, "Update", 1)
+			mockUserService.AssertCalled(t, "GetByID", mock.Anything, uid.String(), false)
+			mockUserService.AssertNumberOfCalls(t, "GetByID", 1)
 
-			assert.Equal(t, http.StatusBadRequest, rr.Code)
-			mockUserService.AssertExpectations(t)
-		})
+			respBody, _ := json.Marshal(user)
+
+			assert.Equal(t, http.StatusOK, rr.Code)
+			assert.Equal(t, respBody, rr.Body.Bytes())
+			mockUserService.AssertExpectations(t)
+		})
+
+		t.Run("Invalid ID", func(t *testing.T) {
+			mockUserService := new(mocks.MockUserService)
+
+			h := &Handler{
+				UserService: mockUserService,
+			}
+
+			c := &MockedContainer{
+				Handler: h,
+			}
+
+			router := &MockedRouter{}
+
+			router.Initialize(c)
+
+			mockErrorResponse := rerrors.NewBadRequest("invalid id")
+
+			mockUserService.On("GetByID", mock.Anything, "invalid_id", false).Return(nil, mockErrorResponse)
+
+			rr := httptest.NewRecorder()
+			request, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("http://localhost:8080/api/v1/users/%s", "invalid_id"), nil)
+
+			request.Header.Set("Content-Type", "application/json")
+
+			router.r.ServeHTTP(rr, request)
+
+			mockUserService.AssertCalled(t, "GetByID", mock.Anything, "invalid_id", false)
+			mockUserService.AssertNumberOfCalls(t, "GetByID", 1)
+
+			assert.Equal(t, http.StatusBadRequest, rr.Code)
+			mockUserService.AssertExpectations(t)
+		})
+
+		t.Run("Error ID not found", func(t *testing.T) {
+			mockUserService := new(mocks.MockUserService)
+
+			h := &Handler{
+				UserService: mockUserService,
+			}
+
+			c := &MockedContainer{
+				Handler: h,
+			}
+
+			router := &MockedRouter{}
+
+			router.Initialize(c)
+
+			uid, err := uuid.NewRandom()
+			assert.NoError(t, err)
+
+			mockErrorResponse := rerrors.NewNotFound("id", uid.String())
+
+			mockUserService.On("GetByID", mock.Anything, "invalid_id", false).Return(nil, mockErrorResponse)
+
+			rr := httptest.NewRecorder()
+			request, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("http://localhost:8080/api/v1/users/%s", "invalid_id"), nil)
+
+			request.Header.Set("Content-Type", "application/json")
+
+			router.r.ServeHTTP(rr, request)
+
+			mockUserService.AssertCalled(t, "GetByID", mock.Anything, "invalid_id", false)
+			mockUserService.AssertNumberOfCalls(t, "GetByID", 1)
+
+			assert.Equal(t, http.StatusNotFound, rr.Code)
+			mockUserService.AssertExpectations(t)
+		})
+
+		t.Run("Success including deleted", func(t *testing.T) {
+			mockUserService := new(mocks.MockUserService)
+
+			h := &Handler{
+				UserService: mockUserService,
+			}
+
+			c := &MockedContainer{
+				Handler: h,
+			}
+
+			router := &MockedRouter{}
+
+			router.Initialize(c)
+
+			deletedAt := time.Date(2022, 5, 1, 10, 0, 0, 0, time.UTC)
+			user := &model.User{UID: uuid.New(), Name: faker.Name(), DeletedAt: &deletedAt, Version: 4}
+
+			mockUserService.On("GetByID", mock.Anything, user.UID.String(), true).Return(user, nil)
+
+			rr := httptest.NewRecorder()
+			request, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("http://localhost:8080/api/v1/users/%s?include_deleted=true", user.UID), nil)
+
+			router.r.ServeHTTP(rr, request)
+
+			respBody, _ := json.Marshal(user)
+
+			assert.Equal(t, http.StatusOK, rr.Code)
+			assert.Equal(t, respBody, rr.Body.Bytes())
+			assert.Equal(t, `"4"`, rr.Header().Get("ETag"))
+			mockUserService.AssertExpectations(t)
+		})
+	})
+
+	t.Run("GetByID as of", func(t *testing.T) {
+		t.Run("Success", func(t *testing.T) {
+			mockUserService := new(mocks.MockUserService)
+
+			h := &Handler{
+				UserService: mockUserService,
+			}
+
+			c := &MockedContainer{
+				Handler: h,
+			}
+
+			router := &MockedRouter{}
+
+			router.Initialize(c)
+
+			user := &model.User{UID: uuid.New(), Name: faker.Name(), Email: "joao@mail.com", Version: 2}
+			at := time.Date(2022, 4, 1, 12, 0, 0, 0, time.UTC)
+
+			mockUserService.On("GetAsOf", mock.Anything, user.UID.String(), at, true).Return(user, nil)
+
+			rr := httptest.NewRecorder()
+			request, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("http://localhost:8080/api/v1/users/%s?as_of=2022-04-01T12:00:00Z&include_deleted=true", user.UID), nil)
+
+			router.r.ServeHTTP(rr, request)
+
+			respBody, _ := json.Marshal(user)
+
+			assert.Equal(t, http.StatusOK, rr.Code)
+			assert.Equal(t, respBody, rr.Body.Bytes())
+			assert.Empty(t, rr.Header().Get("ETag"))
+			mockUserService.AssertExpectations(t)
+			mockUserService.AssertNotCalled(t, "GetByID", mock.Anything, mock.Anything, mock.Anything)
+		})
+
+		t.Run("Error invalid as_of", func(t *testing.T) {
+			mockUserService := new(mocks.MockUserService)
+
+			h := &Handler{
+				UserService: mockUserService,
+			}
+
+			c := &MockedContainer{
+				Handler: h,
+			}
+
+			router := &MockedRouter{}
+
+			router.Initialize(c)
+
+			rr := httptest.NewRecorder()
+			request, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("http://localhost:8080/api/v1/users/%s?as_of=last-month", uuid.New()), nil)
+
+			router.r.ServeHTTP(rr, request)
+
+			assert.Equal(t, http.StatusBadRequest, rr.Code)
+			mockUserService.AssertNotCalled(t, "GetAsOf", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+		})
+
+		t.Run("Error not found", func(t *testing.T) {
+			mockUserService := new(mocks.MockUserService)
+
+			h := &Handler{
+				UserService: mockUserService,
+			}
+
+			c := &MockedContainer{
+				Handler: h,
+			}
+
+			router := &MockedRouter{}
+
+			router.Initialize(c)
+
+			uid := uuid.New()
+
+			mockUserService.On("GetAsOf", mock.Anything, uid.String(), mock.Anything, false).Return(nil, rerrors.NewNotFound("user", uid.String()))
+
+			rr := httptest.NewRecorder()
+			request, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("http://localhost:8080/api/v1/users/%s?as_of=2020-01-01T00:00:00-03:00", uid), nil)
+
+			router.r.ServeHTTP(rr, request)
+
+			assert.Equal(t, http.StatusNotFound, rr.Code)
+			mockUserService.AssertExpectations(t)
+		})
+	})
+
+	t.Run("History", func(t *testing.T) {
+		t.Run("Success", func(t *testing.T) {
+			mockUserService := new(mocks.MockUserService)
+
+			h := &Handler{
+				UserService: mockUserService,
+			}
+
+			c := &MockedContainer{
+				Handler: h,
+			}
+
+			router := &MockedRouter{}
+
+			router.Initialize(c)
+
+			uid := uuid.New()
+			before, after := "joao@mail.com", "joao@acme.com.br"
+
+			history := &model.UserHistory{Data: []model.UserRevision{{
+				User:      &model.User{UID: uid, Email: after, Version: 2},
+				Action:    model.AuditUpdate,
+				Actor:     "maria",
+				ChangedAt: time.Date(2022, 4, 1, 12, 0, 0, 0, time.UTC),
+				Changes:   model.AuditChanges{"email": {Before: &before, After: &after}},
+			}}}
+
+			mockUserService.On("History", mock.Anything, uid.String()).Return(history, nil)
+
+			rr := httptest.NewRecorder()
+			request, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("http://localhost:8080/api/v1/users/%s/history", uid), nil)
+
+			router.r.ServeHTTP(rr, request)
+
+			respBody, _ := json.Marshal(history)
+
+			assert.Equal(t, http.StatusOK, rr.Code)
+			assert.Equal(t, respBody, rr.Body.Bytes())
+			mockUserService.AssertExpectations(t)
+		})
+
+		t.Run("Error not found", func(t *testing.T) {
+			mockUserService := new(mocks.MockUserService)
+
+			h := &Handler{
+				UserService: mockUserService,
+			}
+
+			c := &MockedContainer{
+				Handler: h,
+			}
+
+			router := &MockedRouter{}
+
+			router.Initialize(c)
+
+			uid := uuid.New()
+
+			mockUserService.On("History", mock.Anything, uid.String()).Return(nil, rerrors.NewNotFound("user", uid.String()))
+
+			rr := httptest.NewRecorder()
+			request, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("http://localhost:8080/api/v1/users/%s/history", uid), nil)
+
+			router.r.ServeHTTP(rr, request)
+
+			assert.Equal(t, http.StatusNotFound, rr.Code)
+			mockUserService.AssertExpectations(t)
+		})
+	})
+
+	t.Run("Create", func(t *testing.T) {
+		t.Run("Success", func(t *testing.T) {
+			mockUserService := new(mocks.MockUserService)
+
+			h := &Handler{
+				UserService: mockUserService,
+			}
+
+			c := &MockedContainer{
+				Handler: h,
+			}
+
+			router := &MockedRouter{}
+
+			router.Initialize(c)
+
+			uid, err := uuid.NewRandom()
+			assert.NoError(t, err)
+
+			u := &model.User{
+				Name:      "John Doe",
+				Email:     "test@mail.com",
+				Cpf:       "313.716.772-80",
+				BirthDate: time.Date(2003, 1, 1, 1, 1, 1, 1, time.UTC),
+			}
+
+			createdUser := &model.User{
+				UID:       uid,
+				Email:     u.Email,
+				Cpf:       u.Cpf,
+				BirthDate: u.BirthDate,
+			}
+
+			mockUserService.On("Create", mock.Anything, u).Return(createdUser, nil)
+
+			rr := httptest.NewRecorder()
+
+			body, err := json.Marshal(gin.H{
+				"name":      u.Name,
+				"email":     u.Email,
+				"cpf":       u.Cpf,
+				"birthdate": u.BirthDate,
+			})
+
+			assert.NoError(t, err)
+
+			request, _ := http.NewRequest(http.MethodPost, "http://localhost:8080/api/v1/users", bytes.NewBuffer(body))
+
+			request.Header.Set("Content-Type", "application/json")
+
+			router.r.ServeHTTP(rr, request)
+
+			mockUserService.AssertCalled(t, "Create", mock.Anything, u)
+			mockUserService.AssertNumberOfCalls(t, "Create", 1)
+
+			u.UID = uid
+			respBody, _ := json.Marshal(createdUser)
+
+			assert.Equal(t, http.StatusCreated, rr.Code)
+			assert.Equal(t, respBody, rr.Body.Bytes())
+			mockUserService.AssertExpectations(t)
+		})
+
+		t.Run("Error underage", func(t *testing.T) {
+			mockUserService := new(mocks.MockUserService)
+
+			h := &Handler{
+				UserService: mockUserService,
+			}
+
+			c := &MockedContainer{
+				Handler: h,
+			}
+
+			router := &MockedRouter{}
+
+			router.Initialize(c)
+
+			u := &model.User{
+				Name:      "John Doe",
+				Email:     "test@mail.com",
+				Cpf:       "313.716.772-80",
+				BirthDate: time.Date(2019, 1, 1, 1, 1, 1, 1, time.UTC),
+			}
+
+			mockErrorResponse := rerrors.NewBadRequest("underage")
+
+			mockUserService.On("Create", mock.Anything, u).Return(nil, mockErrorResponse)
+
+			rr := httptest.NewRecorder()
+
+			body, err := json.Marshal(gin.H{
+				"name":      u.Name,
+				"email":     u.Email,
+				"cpf":       u.Cpf,
+				"birthdate": u.BirthDate,
+			})
+
+			assert.NoError(t, err)
+
+			request, _ := http.NewRequest(http.MethodPost, "http://localhost:8080/api/v1/users", bytes.NewBuffer(body))
+
+			request.Header.Set("Content-Type", "application/json")
+
+			router.r.ServeHTTP(rr, request)
+
+			mockUserService.AssertCalled(t, "Create", mock.Anything, u)
+			mockUserService.AssertNumberOfCalls(t, "Create", 1)
+
+			assert.Equal(t, http.StatusBadRequest, rr.Code)
+			mockUserService.AssertExpectations(t)
+		})
+
+		t.Run("Error invalid cpf", func(t *testing.T) {
+			mockUserService := new(mocks.MockUserService)
+
+			h := &Handler{
+				UserService: mockUserService,
+			}
+
+			c := &MockedContainer{
+				Handler: h,
+			}
+
+			router := &MockedRouter{}
+
+			router.Initialize(c)
+
+			u := &model.User{
+				Name:      "John Doe",
+				Email:     "test@mail.com",
+				Cpf:       "invalid_cpf",
+				BirthDate: time.Date(2000, 1, 1, 1, 1, 1, 1, time.UTC),
+			}
+
+			mockErrorResponse := rerrors.NewBadRequest("cpf invalid")
+
+			mockUserService.On("Create", mock.Anything, u).Return(nil, mockErrorResponse)
+
+			rr := httptest.NewRecorder()
+
+			body, err := json.Marshal(gin.H{
+				"name":      u.Name,
+				"email":     u.Email,
+				"cpf":       u.Cpf,
+				"birthdate": u.BirthDate,
+			})
+
+			assert.NoError(t, err)
+
+			request, _ := http.NewRequest(http.MethodPost, "http://localhost:8080/api/v1/users", bytes.NewBuffer(body))
+
+			request.Header.Set("Content-Type", "application/json")
+
+			router.r.ServeHTTP(rr, request)
+
+			mockUserService.AssertCalled(t, "Create", mock.Anything, u)
+			mockUserService.AssertNumberOfCalls(t, "Create", 1)
+
+			assert.Equal(t, http.StatusBadRequest, rr.Code)
+			mockUserService.AssertExpectations(t)
+		})
+	})
+
+	t.Run("CreateBatch", func(t *testing.T) {
+		birthdate := time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC)
+
+		users := []*model.User{
+			{Name: "João", Email: "joao@mail.com", Cpf: "313.716.772-80", BirthDate: birthdate},
+			{Name: "Maria", Email: "maria@mail.com", Cpf: "111.111.111-11", BirthDate: birthdate},
+		}
+
+		body, _ := json.Marshal(gin.H{
+			"atomic": true,
+			"users": []gin.H{
+				{"name": users[0].Name, "email": users[0].Email, "cpf": users[0].Cpf, "birthdate": birthdate},
+				{"name": users[1].Name, "email": users[1].Email, "cpf": users[1].Cpf, "birthdate": birthdate},
+			},
+		})
+
+		t.Run("Success", func(t *testing.T) {
+			mockUserService := new(mocks.MockUserService)
+
+			router := &MockedRouter{}
+			router.Initialize(&MockedContainer{Handler: &Handler{UserService: mockUserService}})
+
+			results := []model.BatchResult{{Index: 0}, {Index: 1}}
+			results[0].Fail(rerrors.NewFailedDependency("another user in the batch is invalid"))
+			results[1].Fail(rerrors.NewBadRequest("cpf invalid"))
+			response := model.NewBatchResults(results)
+
+			mockUserService.On("CreateBatch", mock.Anything, users, true).Return(response, nil)
+
+			rr := httptest.NewRecorder()
+
+			request, _ := http.NewRequest(http.MethodPost, "http://localhost:8080/api/v1/users:batch", bytes.NewBuffer(body))
+			request.Header.Set("Content-Type", "application/json")
+
+			router.r.ServeHTTP(rr, request)
+
+			respBody, _ := json.Marshal(response)
+
+			assert.Equal(t, http.StatusMultiStatus, rr.Code)
+			assert.Equal(t, respBody, rr.Body.Bytes())
+			mockUserService.AssertExpectations(t)
+		})
+
+		t.Run("Error from service", func(t *testing.T) {
+			mockUserService := new(mocks.MockUserService)
+
+			router := &MockedRouter{}
+			router.Initialize(&MockedContainer{Handler: &Handler{UserService: mockUserService}})
+
+			mockUserService.On("CreateBatch", mock.Anything, users, true).Return(nil, rerrors.NewInternal())
+
+			rr := httptest.NewRecorder()
+
+			request, _ := http.NewRequest(http.MethodPost, "http://localhost:8080/api/v1/users:batch", bytes.NewBuffer(body))
+			request.Header.Set("Content-Type", "application/json")
+
+			router.r.ServeHTTP(rr, request)
+
+			assert.Equal(t, http.StatusInternalServerError, rr.Code)
+			mockUserService.AssertExpectations(t)
+		})
+
+		t.Run("Bad request missing users", func(t *testing.T) {
+			mockUserService := new(mocks.MockUserService)
+
+			router := &MockedRouter{}
+			router.Initialize(&MockedContainer{Handler: &Handler{UserService: mockUserService}})
+
+			rr := httptest.NewRecorder()
+
+			request, _ := http.NewRequest(http.MethodPost, "http://localhost:8080/api/v1/users:batch", strings.NewReader(`{"atomic": true}`))
+			request.Header.Set("Content-Type", "application/json")
+
+			router.r.ServeHTTP(rr, request)
+
+			assert.Equal(t, http.StatusBadRequest, rr.Code)
+			mockUserService.AssertNotCalled(t, "CreateBatch", mock.Anything, mock.Anything, mock.Anything)
+		})
+
+		t.Run("Unknown method", func(t *testing.T) {
+			mockUserService := new(mocks.MockUserService)
+
+			router := &MockedRouter{}
+			router.Initialize(&MockedContainer{Handler: &Handler{UserService: mockUserService}})
+
+			rr := httptest.NewRecorder()
+
+			request, _ := http.NewRequest(http.MethodPost, "http://localhost:8080/api/v1/users:merge", bytes.NewBuffer(body))
+			request.Header.Set("Content-Type", "application/json")
+
+			router.r.ServeHTTP(rr, request)
+
+			assert.Equal(t, http.StatusNotFound, rr.Code)
+			mockUserService.AssertNotCalled(t, "CreateBatch", mock.Anything, mock.Anything, mock.Anything)
+		})
+
+		t.Run("Create still routes", func(t *testing.T) {
+			mockUserService := new(mocks.MockUserService)
+
+			router := &MockedRouter{}
+			router.Initialize(&MockedContainer{Handler: &Handler{UserService: mockUserService}})
+
+			mockUserService.On("Create", mock.Anything, users[0]).Return(&model.User{UID: uuid.New(), Version: 1}, nil)
+
+			rr := httptest.NewRecorder()
+
+			body, _ := json.Marshal(gin.H{"name": users[0].Name, "email": users[0].Email, "cpf": users[0].Cpf, "birthdate": birthdate})
+
+			request, _ := http.NewRequest(http.MethodPost, "http://localhost:8080/api/v1/users", bytes.NewBuffer(body))
+			request.Header.Set("Content-Type", "application/json")
+
+			router.r.ServeHTTP(rr, request)
+
+			assert.Equal(t, http.StatusCreated, rr.Code)
+			mockUserService.AssertExpectations(t)
+		})
+	})
+
+	t.Run("Export", func(t *testing.T) {
+		users := []model.User{
+			{UID: uuid.MustParse("1f6f8d3c-9a3e-4a8b-8a3e-6f1d9b8c7e5a"), Name: "João", Email: "joao@acme.com.br", Cpf: "313.716.772-80", BirthDate: time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC), Version: 1},
+			{UID: uuid.MustParse("653565ef-6000-4021-8804-91f3369b3190"), Name: "Maria", Email: "maria@acme.com.br", Cpf: "182.345.015-69", BirthDate: time.Date(1987, 6, 21, 0, 0, 0, 0, time.UTC), Version: 3},
+		}
+
+		t.Run("Success CSV", func(t *testing.T) {
+			mockUserService := new(mocks.MockUserService)
+
+			router := &MockedRouter{}
+			router.Initialize(&MockedContainer{Handler: &Handler{UserService: mockUserService}})
+
+			params := model.UserListParams{
+				Filter:         `email ends_with "@acme.com.br"`,
+				Sort:           model.Sort{{Field: "name"}},
+				IncludeDeleted: true,
+			}
+
+			mockUserService.On("Export", mock.Anything, params, mock.Anything).Return(users, nil)
+
+			rr := httptest.NewRecorder()
+
+			request, _ := http.NewRequest(http.MethodGet, "http://localhost:8080/api/v1/users/export?sort=name&include_deleted=true&filter="+url.QueryEscape(params.Filter), nil)
+
+			router.r.ServeHTTP(rr, request)
+
+			assert.Equal(t, http.StatusOK, rr.Code)
+			assert.Equal(t, "text/csv; charset=utf-8", rr.Header().Get("Content-Type"))
+			assert.Equal(t, `attachment; filename="users.csv"`, rr.Header().Get("Content-Disposition"))
+			assert.Equal(t, "id,name,email,cpf,birthdate,deleted_at,version\n"+
+				"1f6f8d3c-9a3e-4a8b-8a3e-6f1d9b8c7e5a,João,joao@acme.com.br,313.716.772-80,1990-01-01,,1\n"+
+				"653565ef-6000-4021-8804-91f3369b3190,Maria,maria@acme.com.br,182.345.015-69,1987-06-21,,3\n", rr.Body.String())
+			assert.Empty(t, rr.Result().Trailer.Get("X-Export-Error"))
+			mockUserService.AssertExpectations(t)
+		})
+
+		t.Run("Success NDJSON", func(t *testing.T) {
+			mockUserService := new(mocks.MockUserService)
+
+			router := &MockedRouter{}
+			router.Initialize(&MockedContainer{Handler: &Handler{UserService: mockUserService}})
+
+			mockUserService.On("Export", mock.Anything, model.UserListParams{}, mock.Anything).Return(users, nil)
+
+			rr := httptest.NewRecorder()
+
+			request, _ := http.NewRequest(http.MethodGet, "http://localhost:8080/api/v1/users/export?format=ndjson", nil)
+
+			router.r.ServeHTTP(rr, request)
+
+			first, _ := json.Marshal(users[0])
+			second, _ := json.Marshal(users[1])
+
+			assert.Equal(t, http.StatusOK, rr.Code)
+			assert.Equal(t, "application/x-ndjson", rr.Header().Get("Content-Type"))
+			assert.Equal(t, string(first)+"\n"+string(second)+"\n", rr.Body.String())
+		})
+
+		t.Run("Success empty CSV", func(t *testing.T) {
+			mockUserService := new(mocks.MockUserService)
+
+			router := &MockedRouter{}
+			router.Initialize(&MockedContainer{Handler: &Handler{UserService: mockUserService}})
+
+			mockUserService.On("Export", mock.Anything, mock.Anything, mock.Anything).Return(nil, nil)
+
+			rr := httptest.NewRecorder()
+
+			request, _ := http.NewRequest(http.MethodGet, "http://localhost:8080/api/v1/users/export", nil)
+
+			router.r.ServeHTTP(rr, request)
+
+			assert.Equal(t, http.StatusOK, rr.Code)
+			assert.Equal(t, "id,name,email,cpf,birthdate,deleted_at,version\n", rr.Body.String())
+		})
+
+		t.Run("Bad request", func(t *testing.T) {
+			mockUserService := new(mocks.MockUserService)
+
+			router := &MockedRouter{}
+			router.Initialize(&MockedContainer{Handler: &Handler{UserService: mockUserService}})
+
+			mockUserService.On("Export", mock.Anything, mock.Anything, mock.Anything).
+				Return(nil, rerrors.NewBadRequest(`invalid filter at position 1: unknown field "salary"`))
+
+			for _, query := range []string{"format=xlsx", "sort=salary", "include_deleted=maybe", "filter=salary+gt+1000"} {
+				rr := httptest.NewRecorder()
+
+				request, _ := http.NewRequest(http.MethodGet, "http://localhost:8080/api/v1/users/export?"+query, nil)
+
+				router.r.ServeHTTP(rr, request)
+
+				assert.Equal(t, http.StatusBadRequest, rr.Code, query)
+				assert.Equal(t, "application/json; charset=utf-8", rr.Header().Get("Content-Type"), query)
+			}
+
+			mockUserService.AssertNumberOfCalls(t, "Export", 1)
+		})
+
+		t.Run("Error midway is reported in a trailer", func(t *testing.T) {
+			mockUserService := new(mocks.MockUserService)
+
+			router := &MockedRouter{}
+			router.Initialize(&MockedContainer{Handler: &Handler{UserService: mockUserService}})
+
+			mockUserService.On("Export", mock.Anything, mock.Anything, mock.Anything).Return(users, rerrors.NewInternal())
+
+			rr := httptest.NewRecorder()
+
+			request, _ := http.NewRequest(http.MethodGet, "http://localhost:8080/api/v1/users/export", nil)
+
+			router.r.ServeHTTP(rr, request)
+
+			assert.Equal(t, http.StatusOK, rr.Code)
+			assert.Equal(t, rerrors.NewInternal().Error(), rr.Result().Trailer.Get("X-Export-Error"))
+		})
+	})
+
+	t.Run("Import", func(t *testing.T) {
+		file := "Nome;E-mail;CPF;Nascimento\nJoão;joao@mail.com;313.716.772-80;01/01/1990\n"
+		mapping := `{"Nome": "name", "E-mail": "email", "CPF": "cpf", "Nascimento": "birthdate"}`
+
+		newRequest := func(fields map[string]string, file string) *http.Request {
+			var body bytes.Buffer
+
+			w := multipart.NewWriter(&body)
+
+			for k, v := range fields {
+				_ = w.WriteField(k, v)
+			}
+
+			if file != "" {
+				fw, _ := w.CreateFormFile("file", "users.csv")
+				_, _ = fw.Write([]byte(file))
+			}
+
+			_ = w.Close()
+
+			request, _ := http.NewRequest(http.MethodPost, "http://localhost:8080/api/v1/users/import", &body)
+			request.Header.Set("Content-Type", w.FormDataContentType())
+
+			return request
+		}
+
+		t.Run("Success", func(t *testing.T) {
+			mockUserService := new(mocks.MockUserService)
+
+			router := &MockedRouter{}
+			router.Initialize(&MockedContainer{Handler: &Handler{UserService: mockUserService}})
+
+			rows := []model.ImportRow{{
+				Line: 2,
+				User: &model.User{Name: "João", Email: "joao@mail.com", Cpf: "313.716.772-80", BirthDate: time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC)},
+			}}
+
+			report := &model.ImportReport{Imported: 0, Rejected: []model.ImportRejection{{Line: 2, Reason: "Bad request. Reason: underage"}}}
+
+			mockUserService.On("Import", mock.Anything, rows).Return(report, nil)
+
+			rr := httptest.NewRecorder()
+
+			router.r.ServeHTTP(rr, newRequest(map[string]string{"mapping": mapping}, file))
+
+			assert.Equal(t, http.StatusOK, rr.Code)
+			assert.Equal(t, "text/csv; charset=utf-8", rr.Header().Get("Content-Type"))
+			assert.Equal(t, `attachment; filename="import-report.csv"`, rr.Header().Get("Content-Disposition"))
+			assert.Equal(t, "0", rr.Header().Get("X-Imported-Count"))
+			assert.Equal(t, "1", rr.Header().Get("X-Rejected-Count"))
+			assert.Equal(t, "line,reason\n2,Bad request. Reason: underage\n", rr.Body.String())
+			mockUserService.AssertExpectations(t)
+		})
+
+		t.Run("Bad request", func(t *testing.T) {
+			mockUserService := new(mocks.MockUserService)
+
+			router := &MockedRouter{}
+			router.Initialize(&MockedContainer{Handler: &Handler{UserService: mockUserService}})
+
+			for _, tc := range []struct {
+				fields map[string]string
+				file   string
+			}{
+				{fields: map[string]string{"mapping": mapping}},
+				{fields: map[string]string{"mapping": "name"}, file: file},
+				{fields: map[string]string{}, file: file},
+			} {
+				rr := httptest.NewRecorder()
+
+				router.r.ServeHTTP(rr, newRequest(tc.fields, tc.file))
+
+				assert.Equal(t, http.StatusBadRequest, rr.Code)
+			}
+
+			mockUserService.AssertNotCalled(t, "Import", mock.Anything, mock.Anything)
+		})
+
+		t.Run("Error from service", func(t *testing.T) {
+			mockUserService := new(mocks.MockUserService)
+
+			router := &MockedRouter{}
+			router.Initialize(&MockedContainer{Handler: &Handler{UserService: mockUserService}})
+
+			conflict := rerrors.NewConflict("users", "imported", "Key (email)=(joao@mail.com) already exists.")
+
+			mockUserService.On("Import", mock.Anything, mock.Anything).Return(nil, conflict)
+
+			rr := httptest.NewRecorder()
+
+			router.r.ServeHTTP(rr, newRequest(map[string]string{"mapping": mapping}, file))
+
+			respBody, _ := json.Marshal(gin.H{"error": conflict})
+
+			assert.Equal(t, http.StatusConflict, rr.Code)
+			assert.Equal(t, respBody, rr.Body.Bytes())
+		})
+	})
+
+	t.Run("UpdateBatch", func(t *testing.T) {
+		uid := uuid.New()
+
+		newRequest := func(body string) *http.Request {
+			request, _ := http.NewRequest(http.MethodPost, "http://localhost:8080/api/v1/users:batchUpdate", strings.NewReader(body))
+			request.Header.Set("Content-Type", "application/json")
+			return request
+		}
+
+		t.Run("Success with merge patch", func(t *testing.T) {
+			mockUserService := new(mocks.MockUserService)
+
+			router := &MockedRouter{}
+			router.Initialize(&MockedContainer{Handler: &Handler{UserService: mockUserService}})
+
+			results := []model.BatchResult{{Index: 0}}
+			results[0].Succeed(http.StatusOK, uid)
+			response := model.NewBatchResults(results)
+			response.DryRun = true
+
+			sel := model.BatchSelector{IDs: []string{uid.String()}}
+			patch, _ := model.ParseUserPatch(model.MergePatchMediaType, []byte(`{"name": "João Silva"}`))
+
+			mockUserService.On("UpdateBatch", mock.Anything, sel, patch, true).Return(response, nil)
+
+			rr := httptest.NewRecorder()
+
+			router.r.ServeHTTP(rr, newRequest(fmt.Sprintf(`{"ids": [%q], "patch": {"name": "João Silva"}, "dry_run": true}`, uid)))
+
+			respBody, _ := json.Marshal(response)
+
+			assert.Equal(t, http.StatusMultiStatus, rr.Code)
+			assert.Equal(t, respBody, rr.Body.Bytes())
+			mockUserService.AssertExpectations(t)
+		})
+
+		t.Run("Success with json patch and filter", func(t *testing.T) {
+			mockUserService := new(mocks.MockUserService)
+
+			router := &MockedRouter{}
+			router.Initialize(&MockedContainer{Handler: &Handler{UserService: mockUserService}})
+
+			ops := `[{"op": "replace", "path": "/name", "value": "João Silva"}]`
+
+			sel := model.BatchSelector{Filter: "name = 'João'"}
+			patch, _ := model.ParseUserPatch(model.JSONPatchMediaType, []byte(ops))
+
+			mockUserService.On("UpdateBatch", mock.Anything, sel, patch, false).Return(model.NewBatchResults([]model.BatchResult{}), nil)
+
+			rr := httptest.NewRecorder()
+
+			router.r.ServeHTTP(rr, newRequest(`{"filter": "name = 'João'", "patch": `+ops+`}`))
+
+			assert.Equal(t, http.StatusMultiStatus, rr.Code)
+			mockUserService.AssertExpectations(t)
+		})
+
+		t.Run("Bad request invalid patch", func(t *testing.T) {
+			mockUserService := new(mocks.MockUserService)
+
+			router := &MockedRouter{}
+			router.Initialize(&MockedContainer{Handler: &Handler{UserService: mockUserService}})
+
+			for _, body := range []string{
+				fmt.Sprintf(`{"ids": [%q]}`, uid),
+				fmt.Sprintf(`{"ids": [%q], "patch": "name"}`, uid),
+				fmt.Sprintf(`{"ids": [%q], "patch": [{"op": "rename"}]}`, uid),
+			} {
+				rr := httptest.NewRecorder()
+
+				router.r.ServeHTTP(rr, newRequest(body))
+
+				assert.Equal(t, http.StatusBadRequest, rr.Code, body)
+			}
+
+			mockUserService.AssertNotCalled(t, "UpdateBatch", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+		})
+
+		t.Run("Error from service", func(t *testing.T) {
+			mockUserService := new(mocks.MockUserService)
+
+			router := &MockedRouter{}
+			router.Initialize(&MockedContainer{Handler: &Handler{UserService: mockUserService}})
+
+			mockUserService.On("UpdateBatch", mock.Anything, model.BatchSelector{}, mock.Anything, false).
+				Return(nil, rerrors.NewBadRequest("either ids or filter must be given"))
+
+			rr := httptest.NewRecorder()
+
+			router.r.ServeHTTP(rr, newRequest(`{"patch": {"name": "João Silva"}}`))
+
+			assert.Equal(t, http.StatusBadRequest, rr.Code)
+			mockUserService.AssertExpectations(t)
+		})
+	})
+
+	t.Run("DeleteBatch", func(t *testing.T) {
+		uid := uuid.New()
+
+		newRequest := func(body string) *http.Request {
+			request, _ := http.NewRequest(http.MethodPost, "http://localhost:8080/api/v1/users:batchDelete", strings.NewReader(body))
+			request.Header.Set("Content-Type", "application/json")
+			return request
+		}
+
+		t.Run("Success", func(t *testing.T) {
+			mockUserService := new(mocks.MockUserService)
+
+			router := &MockedRouter{}
+			router.Initialize(&MockedContainer{Handler: &Handler{UserService: mockUserService}})
+
+			results := []model.BatchResult{{Index: 0}, {Index: 1}}
+			results[0].Succeed(http.StatusNoContent, uid)
+			results[1].Fail(rerrors.NewBadRequest(`invalid id "x"`))
+			response := model.NewBatchResults(results)
+
+			sel := model.BatchSelector{IDs: []string{uid.String(), "x"}}
+
+			mockUserService.On("DeleteBatch", mock.Anything, sel, false).Return(response, nil)
+
+			rr := httptest.NewRecorder()
+
+			router.r.ServeHTTP(rr, newRequest(fmt.Sprintf(`{"ids": [%q, "x"]}`, uid)))
+
+			respBody, _ := json.Marshal(response)
+
+			assert.Equal(t, http.StatusMultiStatus, rr.Code)
+			assert.Equal(t, respBody, rr.Body.Bytes())
+			mockUserService.AssertExpectations(t)
+		})
+
+		t.Run("Error from service", func(t *testing.T) {
+			mockUserService := new(mocks.MockUserService)
+
+			router := &MockedRouter{}
+			router.Initialize(&MockedContainer{Handler: &Handler{UserService: mockUserService}})
+
+			sel := model.BatchSelector{Filter: "age > 18"}
+
+			mockUserService.On("DeleteBatch", mock.Anything, sel, true).Return(nil, rerrors.NewBadRequest("unknown field age"))
+
+			rr := httptest.NewRecorder()
+
+			router.r.ServeHTTP(rr, newRequest(`{"filter": "age > 18", "dry_run": true}`))
+
+			assert.Equal(t, http.StatusBadRequest, rr.Code)
+			mockUserService.AssertExpectations(t)
+		})
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		t.Run("Success", func(t *testing.T) {
+			mockUserService := new(mocks.MockUserService)
+
+			h := &Handler{
+				UserService: mockUserService,
+			}
+
+			c := &MockedContainer{
+				Handler: h,
+			}
+
+			router := &MockedRouter{}
+
+			router.Initialize(c)
+
+			uid, err := uuid.NewRandom()
+			assert.NoError(t, err)
+
+			u := &model.User{
+				Name:      "John Doe",
+				Email:     "test@mail.com",
+				Cpf:       "313.716.772-80",
+				BirthDate: time.Date(2003, 1, 1, 0, 0, 0, 0, time.UTC),
+			}
+
+			updatedUser := &model.User{
+				UID:       uid,
+				Name:      u.Name,
+				Email:     u.Email,
+				Cpf:       u.Cpf,
+				BirthDate: u.BirthDate,
+				Version:   2,
+			}
+
+			mockUserService.On("Update", mock.Anything, uid.String(), u, 1).Return(updatedUser, nil)
+
+			rr := httptest.NewRecorder()
+
+			body, err := json.Marshal(gin.H{
+				"name":      u.Name,
+				"email":     u.Email,
+				"cpf":       u.Cpf,
+				"birthdate": u.BirthDate,
+			})
+
+			assert.NoError(t, err)
+
+			request, _ := http.NewRequest(http.MethodPut, fmt.Sprintf("http://localhost:8080/api/v1/users/%s", uid.String()), bytes.NewBuffer(body))
+
+			request.Header.Set("Content-Type", "application/json")
+			request.Header.Set("If-Match", `"1"`)
+
+			router.r.ServeHTTP(rr, request)
+
+			mockUserService.AssertCalled(t, "Update", mock.Anything, uid.String(), u, 1)
+			mockUserService.AssertNumberOfCalls(t, "Update", 1)
+
+			u.UID = uid
+			respBody, _ := json.Marshal(updatedUser)
+
+			assert.Equal(t, http.StatusOK, rr.Code)
+			assert.Equal(t, respBody, rr.Body.Bytes())
+			assert.Equal(t, `"2"`, rr.Header().Get("ETag"))
+			mockUserService.AssertExpectations(t)
+		})
+
+		t.Run("Error missing If-Match", func(t *testing.T) {
+			mockUserService := new(mocks.MockUserService)
+
+			h := &Handler{
+				UserService: mockUserService,
+			}
+
+			c := &MockedContainer{
+				Handler: h,
+			}
+
+			router := &MockedRouter{}
+
+			router.Initialize(c)
+
+			uid := uuid.New()
+			u := &model.User{Name: "John Doe", Email: "john@mail.com", Cpf: "313.716.772-80", BirthDate: time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)}
+
+			mockUserService.On("Update", mock.Anything, uid.String(), u, 0).Return(nil, rerrors.NewPreconditionRequired("updates must state the version of the user they are based on"))
+
+			rr := httptest.NewRecorder()
+
+			request, _ := http.NewRequest(http.MethodPut, fmt.Sprintf("http://localhost:8080/api/v1/users/%s", uid), bytes.NewBufferString(`{"name": "John Doe", "email": "john@mail.com", "cpf": "313.716.772-80", "birthdate": "2000-01-01T00:00:00Z"}`))
+			request.Header.Set("Content-Type", "application/json")
+
+			router.r.ServeHTTP(rr, request)
+
+			assert.Equal(t, http.StatusPreconditionRequired, rr.Code)
+			mockUserService.AssertExpectations(t)
+		})
+
+		t.Run("Error stale If-Match", func(t *testing.T) {
+			mockUserService := new(mocks.MockUserService)
+
+			h := &Handler{
+				UserService: mockUserService,
+			}
+
+			c := &MockedContainer{
+				Handler: h,
+			}
+
+			router := &MockedRouter{}
+
+			router.Initialize(c)
+
+			uid := uuid.New()
+			u := &model.User{Name: "John Doe", Email: "john@mail.com", Cpf: "313.716.772-80", BirthDate: time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)}
+
+			mockUserService.On("Update", mock.Anything, uid.String(), u, 2).Return(nil, rerrors.NewPreconditionFailed("user is at version 3, not 2"))
+
+			rr := httptest.NewRecorder()
+
+			request, _ := http.NewRequest(http.MethodPut, fmt.Sprintf("http://localhost:8080/api/v1/users/%s", uid), bytes.NewBufferString(`{"name": "John Doe", "email": "john@mail.com", "cpf": "313.716.772-80", "birthdate": "2000-01-01T00:00:00Z"}`))
+			request.Header.Set("Content-Type", "application/json")
+			request.Header.Set("If-Match", `W/"2"`)
+
+			router.r.ServeHTTP(rr, request)
+
+			assert.Equal(t, http.StatusPreconditionFailed, rr.Code)
+			mockUserService.AssertExpectations(t)
+		})
+
+		t.Run("Error malformed If-Match", func(t *testing.T) {
+			mockUserService := new(mocks.MockUserService)
+
+			h := &Handler{
+				UserService: mockUserService,
+			}
+
+			c := &MockedContainer{
+				Handler: h,
+			}
+
+			router := &MockedRouter{}
+
+			router.Initialize(c)
+
+			for _, tag := range []string{"2", `"abc"`, `"0"`, "*"} {
+				rr := httptest.NewRecorder()
+
+				request, _ := http.NewRequest(http.MethodPut, fmt.Sprintf("http://localhost:8080/api/v1/users/%s", uuid.New()), bytes.NewBufferString(`{"name": "John Doe", "email": "john@mail.com", "cpf": "313.716.772-80", "birthdate": "2000-01-01T00:00:00Z"}`))
+				request.Header.Set("Content-Type", "application/json")
+				request.Header.Set("If-Match", tag)
+
+				router.r.ServeHTTP(rr, request)
+
+				assert.Equal(t, http.StatusPreconditionFailed, rr.Code, tag)
+			}
+
+			mockUserService.AssertNotCalled(t, "Update", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+		})
+
+		t.Run("Error underage", func(t *testing.T) {
+			mockUserService := new(mocks.MockUserService)
+
+			h := &Handler{
+				UserService: mockUserService,
+			}
+
+			c := &MockedContainer{
+				Handler: h,
+			}
+
+			router := &MockedRouter{}
+
+			router.Initialize(c)
+
+			uid, err := uuid.NewRandom()
+			assert.NoError(t, err)
+
+			u := &model.User{
+				Name:      "John Doe",
+				Email:     "test@mail.com",
+				Cpf:       "313.716.772-80",
+				BirthDate: time.Date(2019, 1, 1, 1, 1, 1, 1, time.UTC),
+			}
+
+			mockErrorResponse := rerrors.NewBadRequest("underage")
+
+			mockUserService.On("Update", mock.Anything, uid.String(), u, 1).Return(nil, mockErrorResponse)
+
+			rr := httptest.NewRecorder()
+
+			body, err := json.Marshal(gin.H{
+				"name":      u.Name,
+				"email":     u.Email,
+				"cpf":       u.Cpf,
+				"birthdate": u.BirthDate,
+			})
+
+			assert.NoError(t, err)
+
+			request, _ := http.NewRequest(http.MethodPut, fmt.Sprintf("http://localhost:8080/api/v1/users/%s", uid.String()), bytes.NewBuffer(body))
+
+			request.Header.Set("Content-Type", "application/json")
+			request.Header.Set("If-Match", `"1"`)
+
+			router.r.ServeHTTP(rr, request)
+
+			mockUserService.AssertCalled(t, "Update", mock.Anything, uid.String(), u, 1)
+			mockUserService.AssertNumberOfCalls(t, "Update", 1)
+
+			assert.Equal(t, http.StatusBadRequest, rr.Code)
+			mockUserService.AssertExpectations(t)
+		})
+
+		t.Run("Error partial user", func(t *testing.T) {
+			mockUserService := new(mocks.MockUserService)
+
+			h := &Handler{
+				UserService: mockUserService,
+			}
+
+			c := &MockedContainer{
+				Handler: h,
+			}
+
+			router := &MockedRouter{}
+
+			router.Initialize(c)
+
+			rr := httptest.NewRecorder()
+
+			request, _ := http.NewRequest(http.MethodPut, fmt.Sprintf("http://localhost:8080/api/v1/users/%s", uuid.New()), bytes.NewBufferString(`{"name": "John Doe", "email": "john@mail.com"}`))
+			request.Header.Set("Content-Type", "application/json")
+			request.Header.Set("If-Match", `"1"`)
+
+			router.r.ServeHTTP(rr, request)
+
+			assert.Equal(t, http.StatusBadRequest, rr.Code)
+			mockUserService.AssertNotCalled(t, "Update", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+		})
+
+		t.Run("Error invalid email", func(t *testing.T) {
+			mockUserService := new(mocks.MockUserService)
+
+			h := &Handler{
+				UserService: mockUserService,
+			}
+
+			c := &MockedContainer{
+				Handler: h,
+			}
+
+			router := &MockedRouter{}
+
+			router.Initialize(c)
+
+			uid, err := uuid.NewRandom()
+			assert.NoError(t, err)
+
+			u := &model.User{
+				Name:      "John Doe",
+				Email:     "invalid_email",
+				Cpf:       "313.716.772-80",
+				BirthDate: time.Date(2000, 1, 1, 1, 1, 1, 1, time.UTC),
+			}
+
+			rr := httptest.NewRecorder()
+
+			body, err := json.Marshal(gin.H{
+				"name":      u.Name,
+				"email":     u.Email,
+				"cpf":       u.Cpf,
+				"birthdate": u.BirthDate,
+			})
+
+			assert.NoError(t, err)
+
+			request, _ := http.NewRequest(http.MethodPut, fmt.Sprintf("http://localhost:8080/api/v1/users/%s", uid.String()), bytes.NewBuffer(body))
+
+			request.Header.Set("Content-Type", "application/json")
+			request.Header.Set("If-Match", `"1"`)
+
+			router.r.ServeHTTP(rr, request)
+
+			mockUserService.AssertNotCalled(t, "Update", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+
+			assert.Equal(t, http.StatusBadRequest, rr.Code)
+			mockUserService.AssertExpectations(t)
+		})
 
 		t.Run("Error invalid cpf", func(t *testing.T) {
 			mockUserService := new(mocks.MockUserService)
@@ -707,7 +1816,7 @@ func TestUserHandler(t *testing.T) {
 
 			mockErrorResponse := rerrors.NewBadRequest("cpf invalid")
 
-			mockUserService.On("Update", mock.AnythingOfType("*context.emptyCtx"), uid.String(), u).Return(nil, mockErrorResponse)
+			mockUserService.On("Update", mock.Anything, uid.String(), u, 1).Return(nil, mockErrorResponse)
 
 			rr := httptest.NewRecorder()
 
@@ -723,10 +1832,11 @@ func TestUserHandler(t *testing.T) {
 			request, _ := http.NewRequest(http.MethodPut, fmt.Sprintf("http://localhost:8080/api/v1/users/%s", uid.String()), bytes.NewBuffer(body))
 
 			request.Header.Set("Content-Type", "application/json")
+			request.Header.Set("If-Match", `"1"`)
 
 			router.r.ServeHTTP(rr, request)
 
-			mockUserService.AssertCalled(t, "Update", mock.AnythingOfType("*context.emptyCtx"), uid.String(), u)
+			mockUserService.AssertCalled(t, "Update", mock.Anything, uid.String(), u, 1)
 			mockUserService.AssertNumberOfCalls(t, "Update", 1)
 
 			assert.Equal(t, http.StatusBadRequest, rr.Code)
@@ -735,6 +1845,159 @@ func TestUserHandler(t *testing.T) {
 
 	})
 
+	t.Run("Patch", func(t *testing.T) {
+		for mediaType, body := range map[string]string{
+			"application/merge-patch+json":               `{"email": "joao@acme.com.br"}`,
+			"application/json-patch+json; charset=utf-8": `[{"op": "replace", "path": "/email", "value": "joao@acme.com.br"}]`,
+		} {
+			t.Run("Success "+mediaType, func(t *testing.T) {
+				mockUserService := new(mocks.MockUserService)
+
+				h := &Handler{
+					UserService: mockUserService,
+				}
+
+				c := &MockedContainer{
+					Handler: h,
+				}
+
+				router := &MockedRouter{}
+
+				router.Initialize(c)
+
+				uid := uuid.New()
+				patched := &model.User{UID: uid, Name: "João", Email: "joao@acme.com.br", Version: 4}
+
+				mockUserService.On("Patch", mock.Anything, uid.String(), mock.AnythingOfType("*model.UserPatch"), 3).Return(patched, nil)
+
+				rr := httptest.NewRecorder()
+				request, _ := http.NewRequest(http.MethodPatch, fmt.Sprintf("http://localhost:8080/api/v1/users/%s", uid), bytes.NewBufferString(body))
+				request.Header.Set("Content-Type", mediaType)
+				request.Header.Set("If-Match", `"3"`)
+
+				router.r.ServeHTTP(rr, request)
+
+				respBody, _ := json.Marshal(patched)
+
+				assert.Equal(t, http.StatusOK, rr.Code)
+				assert.Equal(t, respBody, rr.Body.Bytes())
+				assert.Equal(t, `"4"`, rr.Header().Get("ETag"))
+				mockUserService.AssertExpectations(t)
+			})
+		}
+
+		t.Run("Error unsupported media type", func(t *testing.T) {
+			mockUserService := new(mocks.MockUserService)
+
+			h := &Handler{
+				UserService: mockUserService,
+			}
+
+			c := &MockedContainer{
+				Handler: h,
+			}
+
+			router := &MockedRouter{}
+
+			router.Initialize(c)
+
+			rr := httptest.NewRecorder()
+			request, _ := http.NewRequest(http.MethodPatch, fmt.Sprintf("http://localhost:8080/api/v1/users/%s", uuid.New()), bytes.NewBufferString(`{"name": "João"}`))
+			request.Header.Set("Content-Type", "application/json")
+			request.Header.Set("If-Match", `"3"`)
+
+			router.r.ServeHTTP(rr, request)
+
+			assert.Equal(t, http.StatusUnsupportedMediaType, rr.Code)
+			mockUserService.AssertNotCalled(t, "Patch", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+		})
+
+		t.Run("Error malformed patch", func(t *testing.T) {
+			mockUserService := new(mocks.MockUserService)
+
+			h := &Handler{
+				UserService: mockUserService,
+			}
+
+			c := &MockedContainer{
+				Handler: h,
+			}
+
+			router := &MockedRouter{}
+
+			router.Initialize(c)
+
+			rr := httptest.NewRecorder()
+			request, _ := http.NewRequest(http.MethodPatch, fmt.Sprintf("http://localhost:8080/api/v1/users/%s", uuid.New()), bytes.NewBufferString(`{"op": "replace"}`))
+			request.Header.Set("Content-Type", "application/json-patch+json")
+			request.Header.Set("If-Match", `"3"`)
+
+			router.r.ServeHTTP(rr, request)
+
+			assert.Equal(t, http.StatusBadRequest, rr.Code)
+			mockUserService.AssertNotCalled(t, "Patch", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+		})
+
+		t.Run("Error failed test", func(t *testing.T) {
+			mockUserService := new(mocks.MockUserService)
+
+			h := &Handler{
+				UserService: mockUserService,
+			}
+
+			c := &MockedContainer{
+				Handler: h,
+			}
+
+			router := &MockedRouter{}
+
+			router.Initialize(c)
+
+			uid := uuid.New()
+
+			mockUserService.On("Patch", mock.Anything, uid.String(), mock.Anything, 3).Return(nil, rerrors.NewConflict("user", "patched", "testing value /email failed: test failed"))
+
+			rr := httptest.NewRecorder()
+			request, _ := http.NewRequest(http.MethodPatch, fmt.Sprintf("http://localhost:8080/api/v1/users/%s", uid), bytes.NewBufferString(`[{"op": "test", "path": "/email", "value": "old@mail.com"}]`))
+			request.Header.Set("Content-Type", "application/json-patch+json")
+			request.Header.Set("If-Match", `"3"`)
+
+			router.r.ServeHTTP(rr, request)
+
+			assert.Equal(t, http.StatusConflict, rr.Code)
+			mockUserService.AssertExpectations(t)
+		})
+
+		t.Run("Error missing If-Match", func(t *testing.T) {
+			mockUserService := new(mocks.MockUserService)
+
+			h := &Handler{
+				UserService: mockUserService,
+			}
+
+			c := &MockedContainer{
+				Handler: h,
+			}
+
+			router := &MockedRouter{}
+
+			router.Initialize(c)
+
+			uid := uuid.New()
+
+			mockUserService.On("Patch", mock.Anything, uid.String(), mock.Anything, 0).Return(nil, rerrors.NewPreconditionRequired("updates must state the version of the user they are based on"))
+
+			rr := httptest.NewRecorder()
+			request, _ := http.NewRequest(http.MethodPatch, fmt.Sprintf("http://localhost:8080/api/v1/users/%s", uid), bytes.NewBufferString(`{"name": "João"}`))
+			request.Header.Set("Content-Type", "application/merge-patch+json")
+
+			router.r.ServeHTTP(rr, request)
+
+			assert.Equal(t, http.StatusPreconditionRequired, rr.Code)
+			mockUserService.AssertExpectations(t)
+		})
+	})
+
 	t.Run("Delete", func(t *testing.T) {
 		t.Run("Success", func(t *testing.T) {
 			mockUserService := new(mocks.MockUserService)
@@ -754,7 +2017,7 @@ func TestUserHandler(t *testing.T) {
 			uid, err := uuid.NewRandom()
 			assert.NoError(t, err)
 
-			mockUserService.On("Delete", mock.AnythingOfType("*context.emptyCtx"), uid.String()).Return(nil)
+			mockUserService.On("Delete", mock.Anything, uid.String()).Return(nil)
 
 			rr := httptest.NewRecorder()
 			request, _ := http.NewRequest(http.MethodDelete, fmt.Sprintf("http://localhost:8080/api/v1/users/%s", uid.String()), nil)
@@ -763,7 +2026,7 @@ func TestUserHandler(t *testing.T) {
 
 			router.r.ServeHTTP(rr, request)
 
-			mockUserService.AssertCalled(t, "Delete", mock.AnythingOfType("*context.emptyCtx"), uid.String())
+			mockUserService.AssertCalled(t, "Delete", mock.Anything, uid.String())
 			mockUserService.AssertNumberOfCalls(t, "Delete", 1)
 
 			assert.Equal(t, http.StatusNoContent, rr.Code)
@@ -790,7 +2053,7 @@ func TestUserHandler(t *testing.T) {
 
 			mockErrorResponse := rerrors.NewInternal()
 
-			mockUserService.On("Delete", mock.AnythingOfType("*context.emptyCtx"), uid.String()).Return(mockErrorResponse)
+			mockUserService.On("Delete", mock.Anything, uid.String()).Return(mockErrorResponse)
 
 			rr := httptest.NewRecorder()
 			request, _ := http.NewRequest(http.MethodDelete, fmt.Sprintf("http://localhost:8080/api/v1/users/%s", uid.String()), nil)
@@ -799,11 +2062,144 @@ func TestUserHandler(t *testing.T) {
 
 			router.r.ServeHTTP(rr, request)
 
-			mockUserService.AssertCalled(t, "Delete", mock.AnythingOfType("*context.emptyCtx"), uid.String())
+			mockUserService.AssertCalled(t, "Delete", mock.Anything, uid.String())
 			mockUserService.AssertNumberOfCalls(t, "Delete", 1)
 
 			assert.Equal(t, http.StatusInternalServerError, rr.Code)
 			mockUserService.AssertExpectations(t)
 		})
+
+		t.Run("Purge", func(t *testing.T) {
+			mockUserService := new(mocks.MockUserService)
+
+			h := &Handler{
+				UserService: mockUserService,
+				AdminToken:  "secret",
+			}
+
+			c := &MockedContainer{
+				Handler: h,
+			}
+
+			router := &MockedRouter{}
+
+			router.Initialize(c)
+
+			uid := uuid.New()
+
+			mockUserService.On("Purge", mock.Anything, uid.String()).Return(nil)
+
+			rr := httptest.NewRecorder()
+			request, _ := http.NewRequest(http.MethodDelete, fmt.Sprintf("http://localhost:8080/api/v1/users/%s?purge=true", uid), nil)
+			request.Header.Set("X-Admin-Token", "secret")
+
+			router.r.ServeHTTP(rr, request)
+
+			assert.Equal(t, http.StatusNoContent, rr.Code)
+			mockUserService.AssertExpectations(t)
+			mockUserService.AssertNotCalled(t, "Delete", mock.Anything, mock.Anything)
+		})
+
+		t.Run("Purge requires admin token", func(t *testing.T) {
+			for name, tc := range map[string]struct {
+				adminToken string
+				header     string
+			}{
+				"missing token":  {adminToken: "secret"},
+				"wrong token":    {adminToken: "secret", header: "guess"},
+				"purge disabled": {},
+			} {
+				t.Run(name, func(t *testing.T) {
+					mockUserService := new(mocks.MockUserService)
+
+					h := &Handler{
+						UserService: mockUserService,
+						AdminToken:  tc.adminToken,
+					}
+
+					c := &MockedContainer{
+						Handler: h,
+					}
+
+					router := &MockedRouter{}
+
+					router.Initialize(c)
+
+					rr := httptest.NewRecorder()
+					request, _ := http.NewRequest(http.MethodDelete, fmt.Sprintf("http://localhost:8080/api/v1/users/%s?purge=true", uuid.New()), nil)
+
+					if tc.header != "" {
+						request.Header.Set("X-Admin-Token", tc.header)
+					}
+
+					router.r.ServeHTTP(rr, request)
+
+					assert.Equal(t, http.StatusForbidden, rr.Code)
+					mockUserService.AssertNotCalled(t, "Purge", mock.Anything, mock.Anything)
+					mockUserService.AssertNotCalled(t, "Delete", mock.Anything, mock.Anything)
+				})
+			}
+		})
+	})
+
+	t.Run("Restore", func(t *testing.T) {
+		t.Run("Success", func(t *testing.T) {
+			mockUserService := new(mocks.MockUserService)
+
+			h := &Handler{
+				UserService: mockUserService,
+			}
+
+			c := &MockedContainer{
+				Handler: h,
+			}
+
+			router := &MockedRouter{}
+
+			router.Initialize(c)
+
+			user := &model.User{UID: uuid.New(), Name: faker.Name()}
+
+			mockUserService.On("Restore", mock.Anything, user.UID.String()).Return(user, nil)
+
+			rr := httptest.NewRecorder()
+			request, _ := http.NewRequest(http.MethodPost, fmt.Sprintf("http://localhost:8080/api/v1/users/%s/restore", user.UID), nil)
+
+			router.r.ServeHTTP(rr, request)
+
+			respBody, _ := json.Marshal(user)
+
+			assert.Equal(t, http.StatusOK, rr.Code)
+			assert.Equal(t, respBody, rr.Body.Bytes())
+			mockUserService.AssertExpectations(t)
+		})
+
+		t.Run("Error not found", func(t *testing.T) {
+			mockUserService := new(mocks.MockUserService)
+
+			h := &Handler{
+				UserService: mockUserService,
+			}
+
+			c := &MockedContainer{
+				Handler: h,
+			}
+
+			router := &MockedRouter{}
+
+			router.Initialize(c)
+
+			uid := uuid.New()
+
+			mockUserService.On("Restore", mock.Anything, uid.String()).Return(nil, rerrors.NewNotFound("deleted user", uid.String()))
+
+			rr := httptest.NewRecorder()
+			request, _ := http.NewRequest(http.MethodPost, fmt.Sprintf("http://localhost:8080/api/v1/users/%s/restore", uid), nil)
+
+			router.r.ServeHTTP(rr, request)
+
+			assert.Equal(t, http.StatusNotFound, rr.Code)
+			mockUserService.AssertExpectations(t)
+		})
 	})
 }
@@ -0,0 +1,313 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	model "github.com/klasrak/users-api/models"
+	"github.com/klasrak/users-api/rerrors"
+)
+
+// ListWebhooks godoc
+// @Summary List webhooks
+// @Description List the webhooks events are delivered to, oldest first, without their secrets.
+// @Description Requires the X-Admin-Token header.
+// @Tags webhooks
+// @Accept  json
+// @Produce  json
+// @Param X-Admin-Token header string true "admin token"
+// @Success 200 {array} model.Webhook
+// @Failure 403 {object} rerrors.Error "Missing or invalid admin token"
+// @Failure 500 {object} rerrors.Error "Internal Server Error"
+// @Router /webhooks [get]
+func (h *Handler) ListWebhooks(c *gin.Context) {
+	if !h.requireAdmin(c, "list webhooks") {
+		return
+	}
+
+	webhooks, err := h.WebhookService.List(c.Request.Context())
+
+	if err != nil {
+		log.Printf("failed to list webhooks: %v\n", err.Error())
+
+		c.JSON(rerrors.Status(err), gin.H{
+			"error": err,
+		})
+
+		return
+	}
+
+	c.JSON(http.StatusOK, webhooks)
+}
+
+// GetWebhook godoc
+// @Summary Get webhook
+// @Description Get a webhook, without its secret. Requires the X-Admin-Token header.
+// @Tags webhooks
+// @Accept  json
+// @Produce  json
+// @Param id path string true "Webhook ID"
+// @Param X-Admin-Token header string true "admin token"
+// @Success 200 {object} model.Webhook
+// @Failure 400 {object} rerrors.Error "Bad Request. Invalid ID"
+// @Failure 403 {object} rerrors.Error "Missing or invalid admin token"
+// @Failure 404 {object} rerrors.Error "Webhook Not Found"
+// @Router /webhooks/{id} [get]
+func (h *Handler) GetWebhook(c *gin.Context) {
+	if !h.requireAdmin(c, "get webhook") {
+		return
+	}
+
+	w, err := h.WebhookService.GetByID(c.Request.Context(), c.Param("id"))
+
+	if err != nil {
+		log.Printf("failed to get webhook: %v\n", err.Error())
+
+		c.JSON(rerrors.Status(err), gin.H{
+			"error": err,
+		})
+
+		return
+	}
+
+	c.JSON(http.StatusOK, w)
+}
+
+// CreateWebhook godoc
+// @Summary Create webhook
+// @Description Subscribe an http or https endpoint to events: user.created, user.updated and user.deleted.
+// @Description Every delivery is POSTed with an X-Webhook-Signature header, sha256= followed by the hex encoded
+// @Description HMAC-SHA256 of the body keyed with the secret of the webhook, which is only returned here.
+// @Description Requires the X-Admin-Token header.
+// @Tags webhooks
+// @Accept  json
+// @Produce  json
+// @Param webhook body model.WebhookParams true "Add webhook"
+// @Param X-Admin-Token header string true "admin token"
+// @Success 201 {object} model.Webhook
+// @Failure 400 {object} rerrors.Error "Validation error"
+// @Failure 403 {object} rerrors.Error "Missing or invalid admin token"
+// @Failure 500 {object} rerrors.Error "Internal Server Error"
+// @Router /webhooks [post]
+func (h *Handler) CreateWebhook(c *gin.Context) {
+	if !h.requireAdmin(c, "create webhook") {
+		return
+	}
+
+	var req model.WebhookParams
+
+	if ok := bindData(c, &req); !ok {
+		log.Println("failed to bind data")
+		return
+	}
+
+	w, err := h.WebhookService.Create(c.Request.Context(), &req)
+
+	if err != nil {
+		log.Printf("failed to create webhook: %v\n", err.Error())
+
+		c.JSON(rerrors.Status(err), gin.H{
+			"error": err,
+		})
+
+		return
+	}
+
+	c.JSON(http.StatusCreated, w)
+}
+
+// UpdateWebhook godoc
+// @Summary Update webhook
+// @Description Replace the URL and events of a webhook. Set active to false to disable it, or to true to enable it
+// @Description again, which clears its failures and resumes its pending deliveries. Requires the X-Admin-Token header.
+// @Tags webhooks
+// @Accept  json
+// @Produce  json
+// @Param id path string true "Webhook ID"
+// @Param webhook body model.WebhookParams true "Update webhook"
+// @Param X-Admin-Token header string true "admin token"
+// @Success 200 {object} model.Webhook
+// @Failure 400 {object} rerrors.Error "Validation error"
+// @Failure 403 {object} rerrors.Error "Missing or invalid admin token"
+// @Failure 404 {object} rerrors.Error "Webhook Not Found"
+// @Router /webhooks/{id} [put]
+func (h *Handler) UpdateWebhook(c *gin.Context) {
+	if !h.requireAdmin(c, "update webhook") {
+		return
+	}
+
+	var req model.WebhookParams
+
+	if ok := bindData(c, &req); !ok {
+		log.Println("failed to bind data")
+		return
+	}
+
+	w, err := h.WebhookService.Update(c.Request.Context(), c.Param("id"), &req)
+
+	if err != nil {
+		log.Printf("failed to update webhook: %v\n", err.Error())
+
+		c.JSON(rerrors.Status(err), gin.H{
+			"error": err,
+		})
+
+		return
+	}
+
+	c.JSON(http.StatusOK, w)
+}
+
+// DeleteWebhook godoc
+// @Summary Delete webhook
+// @Description Remove a webhook along with its deliveries. Requires the X-Admin-Token header.
+// @Tags webhooks
+// @Accept  json
+// @Produce  json
+// @Param id path string true "Webhook ID"
+// @Param X-Admin-Token header string true "admin token"
+// @Success 204
+// @Failure 400 {object} rerrors.Error "Bad Request. Invalid ID"
+// @Failure 403 {object} rerrors.Error "Missing or invalid admin token"
+// @Failure 404 {object} rerrors.Error "Webhook Not Found"
+// @Router /webhooks/{id} [delete]
+func (h *Handler) DeleteWebhook(c *gin.Context) {
+	if !h.requireAdmin(c, "delete webhook") {
+		return
+	}
+
+	if err := h.WebhookService.Delete(c.Request.Context(), c.Param("id")); err != nil {
+		log.Printf("failed to delete webhook: %v\n", err.Error())
+
+		c.JSON(rerrors.Status(err), gin.H{
+			"error": err,
+		})
+
+		return
+	}
+
+	c.JSON(http.StatusNoContent, nil)
+}
+
+// ListWebhookDeliveries godoc
+// @Summary List webhook deliveries
+// @Description List the deliveries of events to a webhook, newest first, with the outcome of their last attempt.
+// @Description To fetch the next page, pass the created_at of the last delivery as before.
+// @Description Requires the X-Admin-Token header.
+// @Tags webhooks
+// @Accept  json
+// @Produce  json
+// @Param id path string true "Webhook ID"
+// @Param status query string false "only deliveries in this status: pending, succeeded or failed"
+// @Param before query string false "only deliveries created before this time, in RFC3339 format"
+// @Param limit query int false "page size (default 50, max 1000)"
+// @Param X-Admin-Token header string true "admin token"
+// @Success 200 {object} model.WebhookDeliveryPage
+// @Failure 400 {object} rerrors.Error "Bad Request. Invalid filter or pagination"
+// @Failure 403 {object} rerrors.Error "Missing or invalid admin token"
+// @Failure 404 {object} rerrors.Error "Webhook Not Found"
+// @Router /webhooks/{id}/deliveries [get]
+func (h *Handler) ListWebhookDeliveries(c *gin.Context) {
+	if !h.requireAdmin(c, "list webhook deliveries") {
+		return
+	}
+
+	params, err := deliveryListParams(c)
+
+	if err != nil {
+		log.Printf("failed to list webhook deliveries: %v\n", err.Error())
+
+		c.JSON(rerrors.Status(err), gin.H{
+			"error": err,
+		})
+
+		return
+	}
+
+	page, err := h.WebhookService.Deliveries(c.Request.Context(), c.Param("id"), params)
+
+	if err != nil {
+		log.Printf("failed to list webhook deliveries: %v\n", err.Error())
+
+		c.JSON(rerrors.Status(err), gin.H{
+			"error": err,
+		})
+
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+// RedeliverWebhook godoc
+// @Summary Redeliver event
+// @Description Deliver the event of a delivery to its webhook again, as a new delivery. Requires the X-Admin-Token header.
+// @Tags webhooks
+// @Accept  json
+// @Produce  json
+// @Param id path string true "Webhook ID"
+// @Param delivery_id path string true "Delivery ID"
+// @Param X-Admin-Token header string true "admin token"
+// @Success 202 {object} model.WebhookDelivery
+// @Failure 400 {object} rerrors.Error "Bad Request. Invalid ID"
+// @Failure 403 {object} rerrors.Error "Missing or invalid admin token"
+// @Failure 404 {object} rerrors.Error "Delivery Not Found"
+// @Router /webhooks/{id}/deliveries/{delivery_id}/redeliver [post]
+func (h *Handler) RedeliverWebhook(c *gin.Context) {
+	if !h.requireAdmin(c, "redeliver event") {
+		return
+	}
+
+	d, err := h.WebhookService.Redeliver(c.Request.Context(), c.Param("id"), c.Param("delivery_id"))
+
+	if err != nil {
+		log.Printf("failed to redeliver event: %v\n", err.Error())
+
+		c.JSON(rerrors.Status(err), gin.H{
+			"error": err,
+		})
+
+		return
+	}
+
+	c.JSON(http.StatusAccepted, d)
+}
+
+// requireAdmin responds with 403 Forbidden unless the request carries the
+// admin token, reporting whether it does
+func (h *Handler) requireAdmin(c *gin.Context, action string) bool {
+	if h.isAdmin(c) {
+		return true
+	}
+
+	err := rerrors.NewForbidden("webhooks require a valid admin token")
+	log.Printf("failed to %s: %v\n", action, err)
+
+	c.JSON(err.Status(), gin.H{
+		"error": err,
+	})
+
+	return false
+}
+
+// deliveryListParams reads the filters of a listing of webhook deliveries
+func deliveryListParams(c *gin.Context) (model.WebhookDeliveryListParams, error) {
+	params := model.WebhookDeliveryListParams{
+		Status: model.DeliveryStatus(c.Query("status")),
+	}
+
+	before, err := queryTime(c, "before")
+
+	if err != nil {
+		return params, err
+	}
+
+	params.Before = before
+
+	if params.Limit, err = queryInt(c, "limit"); err != nil {
+		return params, err
+	}
+
+	return params, nil
+}
@@ -0,0 +1,315 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/klasrak/users-api/mocks"
+	model "github.com/klasrak/users-api/models"
+	"github.com/klasrak/users-api/rerrors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestWebhookHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// newRouter routes requests to handlers using svc, with secret as the
+	// admin token
+	newRouter := func(svc *mocks.MockWebhookService, secret string) *MockedRouter {
+		c := &MockedContainer{
+			Handler: &Handler{
+				WebhookService: svc,
+				AdminToken:     secret,
+			},
+		}
+
+		router := &MockedRouter{}
+
+		router.Initialize(c)
+
+		return router
+	}
+
+	serve := func(router *MockedRouter, method, path string, body []byte, token string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		request, _ := http.NewRequest(method, "http://localhost:8080/api/v1"+path, bytes.NewReader(body))
+		request.Header.Set("Content-Type", "application/json")
+
+		if token != "" {
+			request.Header.Set("X-Admin-Token", token)
+		}
+
+		router.r.ServeHTTP(rr, request)
+
+		return rr
+	}
+
+	id := uuid.New()
+
+	webhook := &model.Webhook{
+		ID:     id,
+		URL:    "https://example.com/hooks",
+		Events: model.WebhookEvents{model.EventUserCreated},
+		Active: true,
+	}
+
+	t.Run("Requires admin token", func(t *testing.T) {
+		deliveryID := uuid.New()
+
+		for name, tc := range map[string]struct {
+			method string
+			path   string
+		}{
+			"list":       {http.MethodGet, "/webhooks"},
+			"get":        {http.MethodGet, fmt.Sprintf("/webhooks/%s", id)},
+			"create":     {http.MethodPost, "/webhooks"},
+			"update":     {http.MethodPut, fmt.Sprintf("/webhooks/%s", id)},
+			"delete":     {http.MethodDelete, fmt.Sprintf("/webhooks/%s", id)},
+			"deliveries": {http.MethodGet, fmt.Sprintf("/webhooks/%s/deliveries", id)},
+			"redeliver":  {http.MethodPost, fmt.Sprintf("/webhooks/%s/deliveries/%s/redeliver", id, deliveryID)},
+		} {
+			t.Run(name, func(t *testing.T) {
+				mockWebhookService := new(mocks.MockWebhookService)
+
+				rr := serve(newRouter(mockWebhookService, "secret"), tc.method, tc.path, []byte(`{}`), "guess")
+
+				assert.Equal(t, http.StatusForbidden, rr.Code)
+				assert.Empty(t, mockWebhookService.Calls)
+
+				// webhooks are disabled without an admin token
+				rr = serve(newRouter(mockWebhookService, ""), tc.method, tc.path, []byte(`{}`), "")
+
+				assert.Equal(t, http.StatusForbidden, rr.Code)
+				assert.Empty(t, mockWebhookService.Calls)
+			})
+		}
+	})
+
+	t.Run("ListWebhooks", func(t *testing.T) {
+		mockWebhookService := new(mocks.MockWebhookService)
+
+		webhooks := []model.Webhook{*webhook}
+
+		mockWebhookService.On("List", mock.Anything).Return(webhooks, nil)
+
+		rr := serve(newRouter(mockWebhookService, "secret"), http.MethodGet, "/webhooks", nil, "secret")
+
+		respBody, _ := json.Marshal(webhooks)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, respBody, rr.Body.Bytes())
+		mockWebhookService.AssertExpectations(t)
+	})
+
+	t.Run("GetWebhook", func(t *testing.T) {
+		t.Run("Success", func(t *testing.T) {
+			mockWebhookService := new(mocks.MockWebhookService)
+
+			mockWebhookService.On("GetByID", mock.Anything, id.String()).Return(webhook, nil)
+
+			rr := serve(newRouter(mockWebhookService, "secret"), http.MethodGet, fmt.Sprintf("/webhooks/%s", id), nil, "secret")
+
+			respBody, _ := json.Marshal(webhook)
+
+			assert.Equal(t, http.StatusOK, rr.Code)
+			assert.Equal(t, respBody, rr.Body.Bytes())
+			mockWebhookService.AssertExpectations(t)
+		})
+
+		t.Run("Not Found", func(t *testing.T) {
+			mockWebhookService := new(mocks.MockWebhookService)
+
+			mockWebhookService.On("GetByID", mock.Anything, id.String()).Return(nil, rerrors.NewNotFound("webhook", id.String()))
+
+			rr := serve(newRouter(mockWebhookService, "secret"), http.MethodGet, fmt.Sprintf("/webhooks/%s", id), nil, "secret")
+
+			assert.Equal(t, http.StatusNotFound, rr.Code)
+			mockWebhookService.AssertExpectations(t)
+		})
+	})
+
+	t.Run("CreateWebhook", func(t *testing.T) {
+		t.Run("Success", func(t *testing.T) {
+			mockWebhookService := new(mocks.MockWebhookService)
+
+			params := &model.WebhookParams{
+				URL:    "https://example.com/hooks",
+				Events: []model.EventType{model.EventUserCreated},
+			}
+
+			created := *webhook
+			created.Secret = "s3cr3t"
+
+			mockWebhookService.On("Create", mock.Anything, params).Return(&created, nil)
+
+			reqBody, _ := json.Marshal(params)
+
+			rr := serve(newRouter(mockWebhookService, "secret"), http.MethodPost, "/webhooks", reqBody, "secret")
+
+			respBody, _ := json.Marshal(created)
+
+			assert.Equal(t, http.StatusCreated, rr.Code)
+			assert.Equal(t, respBody, rr.Body.Bytes())
+			mockWebhookService.AssertExpectations(t)
+		})
+
+		t.Run("Bad request", func(t *testing.T) {
+			mockWebhookService := new(mocks.MockWebhookService)
+
+			rr := serve(newRouter(mockWebhookService, "secret"), http.MethodPost, "/webhooks", []byte(`{"events": ["user.created"]}`), "secret")
+
+			assert.Equal(t, http.StatusBadRequest, rr.Code)
+			mockWebhookService.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+		})
+
+		t.Run("Invalid settings", func(t *testing.T) {
+			mockWebhookService := new(mocks.MockWebhookService)
+
+			mockWebhookService.On("Create", mock.Anything, mock.Anything).Return(nil, rerrors.NewBadRequest("url must be an absolute http or https URL"))
+
+			rr := serve(newRouter(mockWebhookService, "secret"), http.MethodPost, "/webhooks", []byte(`{"url": "example.com", "events": ["user.created"]}`), "secret")
+
+			assert.Equal(t, http.StatusBadRequest, rr.Code)
+			mockWebhookService.AssertExpectations(t)
+		})
+	})
+
+	t.Run("UpdateWebhook", func(t *testing.T) {
+		mockWebhookService := new(mocks.MockWebhookService)
+
+		active := false
+
+		params := &model.WebhookParams{
+			URL:    "https://example.com/hooks",
+			Events: []model.EventType{model.EventUserCreated},
+			Active: &active,
+		}
+
+		updated := *webhook
+		updated.Active = false
+		updated.DisabledReason = "disabled"
+
+		mockWebhookService.On("Update", mock.Anything, id.String(), params).Return(&updated, nil)
+
+		reqBody, _ := json.Marshal(params)
+
+		rr := serve(newRouter(mockWebhookService, "secret"), http.MethodPut, fmt.Sprintf("/webhooks/%s", id), reqBody, "secret")
+
+		respBody, _ := json.Marshal(updated)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, respBody, rr.Body.Bytes())
+		mockWebhookService.AssertExpectations(t)
+	})
+
+	t.Run("DeleteWebhook", func(t *testing.T) {
+		t.Run("Success", func(t *testing.T) {
+			mockWebhookService := new(mocks.MockWebhookService)
+
+			mockWebhookService.On("Delete", mock.Anything, id.String()).Return(nil)
+
+			rr := serve(newRouter(mockWebhookService, "secret"), http.MethodDelete, fmt.Sprintf("/webhooks/%s", id), nil, "secret")
+
+			assert.Equal(t, http.StatusNoContent, rr.Code)
+			mockWebhookService.AssertExpectations(t)
+		})
+
+		t.Run("Not Found", func(t *testing.T) {
+			mockWebhookService := new(mocks.MockWebhookService)
+
+			mockWebhookService.On("Delete", mock.Anything, id.String()).Return(rerrors.NewNotFound("webhook", id.String()))
+
+			rr := serve(newRouter(mockWebhookService, "secret"), http.MethodDelete, fmt.Sprintf("/webhooks/%s", id), nil, "secret")
+
+			assert.Equal(t, http.StatusNotFound, rr.Code)
+			mockWebhookService.AssertExpectations(t)
+		})
+	})
+
+	t.Run("ListWebhookDeliveries", func(t *testing.T) {
+		t.Run("Success", func(t *testing.T) {
+			mockWebhookService := new(mocks.MockWebhookService)
+
+			before := time.Date(2022, 5, 1, 0, 0, 0, 0, time.UTC)
+
+			page := &model.WebhookDeliveryPage{Data: []model.WebhookDelivery{{
+				ID:        uuid.New(),
+				WebhookID: id,
+				EventID:   uuid.New(),
+				EventType: model.EventUserCreated,
+				Payload:   model.WebhookPayload(`{"type":"user.created"}`),
+				Status:    model.DeliveryFailed,
+				Attempts:  8,
+				LastError: "unexpected status 500",
+			}}}
+
+			mockWebhookService.On("Deliveries", mock.Anything, id.String(), model.WebhookDeliveryListParams{
+				Status: model.DeliveryFailed,
+				Before: before,
+				Limit:  20,
+			}).Return(page, nil)
+
+			path := fmt.Sprintf("/webhooks/%s/deliveries?status=failed&before=2022-05-01T00:00:00Z&limit=20", id)
+
+			rr := serve(newRouter(mockWebhookService, "secret"), http.MethodGet, path, nil, "secret")
+
+			respBody, _ := json.Marshal(page)
+
+			assert.Equal(t, http.StatusOK, rr.Code)
+			assert.Equal(t, respBody, rr.Body.Bytes())
+			mockWebhookService.AssertExpectations(t)
+		})
+
+		t.Run("Bad request", func(t *testing.T) {
+			for name, query := range map[string]string{
+				"invalid before": "before=2022-05-01",
+				"invalid limit":  "limit=many",
+			} {
+				t.Run(name, func(t *testing.T) {
+					mockWebhookService := new(mocks.MockWebhookService)
+
+					path := fmt.Sprintf("/webhooks/%s/deliveries?%s", id, query)
+
+					rr := serve(newRouter(mockWebhookService, "secret"), http.MethodGet, path, nil, "secret")
+
+					assert.Equal(t, http.StatusBadRequest, rr.Code)
+					assert.Empty(t, mockWebhookService.Calls)
+				})
+			}
+		})
+	})
+
+	t.Run("RedeliverWebhook", func(t *testing.T) {
+		mockWebhookService := new(mocks.MockWebhookService)
+
+		deliveryID := uuid.New()
+
+		redelivery := &model.WebhookDelivery{
+			ID:           uuid.New(),
+			WebhookID:    id,
+			RedeliveryOf: &deliveryID,
+			Payload:      model.WebhookPayload(`{}`),
+			Status:       model.DeliveryPending,
+		}
+
+		mockWebhookService.On("Redeliver", mock.Anything, id.String(), deliveryID.String()).Return(redelivery, nil)
+
+		path := fmt.Sprintf("/webhooks/%s/deliveries/%s/redeliver", id, deliveryID)
+
+		rr := serve(newRouter(mockWebhookService, "secret"), http.MethodPost, path, nil, "secret")
+
+		respBody, _ := json.Marshal(redelivery)
+
+		assert.Equal(t, http.StatusAccepted, rr.Code)
+		assert.Equal(t, respBody, rr.Body.Bytes())
+		mockWebhookService.AssertExpectations(t)
+	})
+}
@@ -1,17 +1,32 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"os"
+	"time"
 
+	"github.com/klasrak/users-api/cache"
 	"github.com/klasrak/users-api/handlers"
 	"github.com/klasrak/users-api/repository"
 	"github.com/klasrak/users-api/service"
 )
 
+// Cache of users read by id used when not set in the environment
+const (
+	defaultUserCacheSize     = 10000
+	defaultUserCacheTTL      = 30 * time.Second
+	defaultUserCacheStaleFor = 5 * time.Minute
+)
+
 // Container used for injecting dependencies
 type Container struct {
 	Handler *handlers.Handler
+	// Dispatcher relays the events of the outbox to webhooks, and Deliverer
+	// delivers them, once started by main
+	Dispatcher *service.OutboxDispatcher
+	Deliverer  *service.WebhookDeliverer
 }
 
 // Initialize implementation of service and repository layers
@@ -20,22 +35,187 @@ func (c *Container) Initialize(ds *DatabaseSources) error {
 
 	// container for initialize repositories
 	r, err := repository.CreateRepository(&repository.Options{
-		DB: ds.DB,
+		DB:            ds.DB,
+		Driver:        ds.Driver,
+		Replica:       ds.Replica,
+		ReplicaMaxLag: ds.ReplicaMaxLag,
 	})
 
 	if err != nil {
-		return fmt.Errorf("could not initialize database sources (PostgreSQL): %w", err)
+		return fmt.Errorf("could not initialize database sources (%s): %w", ds.Driver, err)
+	}
+
+	users, err := cacheUsers(r.UserRepository)
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := c.inject(users, r.AuditRepository, r.OutboxRepository, r.WebhookRepository, r.WebhookDeliveryRepository, r.Transactor); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// cacheUsers puts a cache of the users read by id in front of users, as
+// configured by USER_CACHE_SIZE (0 disables it), USER_CACHE_TTL and
+// USER_CACHE_STALE_FOR
+func cacheUsers(users service.UserRepository) (service.UserRepository, error) {
+	env := &envReader{}
+
+	size := env.int("USER_CACHE_SIZE", defaultUserCacheSize)
+	ttl := env.duration("USER_CACHE_TTL", defaultUserCacheTTL)
+	staleFor := env.duration("USER_CACHE_STALE_FOR", defaultUserCacheStaleFor)
+
+	if env.err != nil {
+		return nil, env.err
+	}
+
+	if size == 0 {
+		return users, nil
+	}
+
+	return &cache.UserRepository{
+		UserRepository: users,
+		Cache:          cache.NewLRU(size),
+		TTL:            ttl,
+		StaleFor:       staleFor,
+	}, nil
+}
+
+// InitializeInMemory implementation of service layer over repositories that
+// keep everything in memory, seeded with the given number of fake users
+func (c *Container) InitializeInMemory(seed int) error {
+	log.Println("Injecting dependencies (in-memory storage)")
+
+	r := repository.CreateMemoryRepository()
+
+	userService, err := c.inject(r.UserRepository, r.AuditRepository, r.OutboxRepository, r.WebhookRepository, r.WebhookDeliveryRepository, r.Transactor)
+
+	if err != nil {
+		return err
+	}
+
+	if err := seedUsers(context.Background(), userService, seed); err != nil {
+		return fmt.Errorf("could not seed users: %w", err)
 	}
 
+	return nil
+}
+
+// newDispatcher creates the dispatcher handing the events appended to
+// outbox over to publisher, as configured by OUTBOX_POLL_INTERVAL,
+// OUTBOX_BATCH_SIZE, OUTBOX_MIN_BACKOFF and OUTBOX_MAX_BACKOFF
+func newDispatcher(outbox service.OutboxRepository, publisher service.EventPublisher) (*service.OutboxDispatcher, error) {
+	env := &envReader{}
+
+	d := service.NewOutboxDispatcher(outbox, publisher)
+
+	d.PollInterval = env.duration("OUTBOX_POLL_INTERVAL", d.PollInterval)
+	d.BatchSize = env.int("OUTBOX_BATCH_SIZE", d.BatchSize)
+	d.MinBackoff = env.duration("OUTBOX_MIN_BACKOFF", d.MinBackoff)
+	d.MaxBackoff = env.duration("OUTBOX_MAX_BACKOFF", d.MaxBackoff)
+
+	if env.err != nil {
+		return nil, env.err
+	}
+
+	if d.PollInterval <= 0 || d.BatchSize <= 0 || d.MinBackoff <= 0 {
+		return nil, fmt.Errorf("OUTBOX_POLL_INTERVAL, OUTBOX_BATCH_SIZE and OUTBOX_MIN_BACKOFF must be positive")
+	}
+
+	return d, nil
+}
+
+// newDeliverer creates the deliverer of the events enqueued for webhooks, as
+// configured by WEBHOOK_POLL_INTERVAL, WEBHOOK_BATCH_SIZE, WEBHOOK_TIMEOUT,
+// WEBHOOK_MAX_ATTEMPTS, WEBHOOK_MIN_BACKOFF, WEBHOOK_MAX_BACKOFF,
+// WEBHOOK_MAX_FAILURES and WEBHOOK_ALLOW_PRIVATE_NETWORKS
+func newDeliverer(webhooks service.WebhookRepository, deliveries service.WebhookDeliveryRepository) (*service.WebhookDeliverer, error) {
+	env := &envReader{}
+
+	d := service.NewWebhookDeliverer(webhooks, deliveries)
+
+	d.PollInterval = env.duration("WEBHOOK_POLL_INTERVAL", d.PollInterval)
+	d.BatchSize = env.int("WEBHOOK_BATCH_SIZE", d.BatchSize)
+	d.Client.Timeout = env.duration("WEBHOOK_TIMEOUT", d.Client.Timeout)
+	d.MaxAttempts = env.int("WEBHOOK_MAX_ATTEMPTS", d.MaxAttempts)
+	d.MinBackoff = env.duration("WEBHOOK_MIN_BACKOFF", d.MinBackoff)
+	d.MaxBackoff = env.duration("WEBHOOK_MAX_BACKOFF", d.MaxBackoff)
+	d.MaxFailures = env.int("WEBHOOK_MAX_FAILURES", d.MaxFailures)
+	d.AllowPrivateNetworks = env.bool("WEBHOOK_ALLOW_PRIVATE_NETWORKS", d.AllowPrivateNetworks)
+
+	if env.err != nil {
+		return nil, env.err
+	}
+
+	if d.PollInterval <= 0 || d.BatchSize <= 0 || d.Client.Timeout <= 0 || d.MaxAttempts <= 0 || d.MinBackoff <= 0 || d.MaxFailures <= 0 {
+		return nil, fmt.Errorf("WEBHOOK_POLL_INTERVAL, WEBHOOK_BATCH_SIZE, WEBHOOK_TIMEOUT, WEBHOOK_MAX_ATTEMPTS, WEBHOOK_MIN_BACKOFF and WEBHOOK_MAX_FAILURES must be positive")
+	}
+
+	return d, nil
+}
+
+// inject creates the services, the handler, the dispatcher and the
+// deliverer over the given repositories
+func (c *Container) inject(
+	users service.UserRepository,
+	audit service.AuditRepository,
+	outbox service.OutboxRepository,
+	webhooks service.WebhookRepository,
+	deliveries service.WebhookDeliveryRepository,
+	transactor service.Transactor,
+) (*service.UserService, error) {
+	// events are handed over to the webhooks subscribed to them
+	dispatcher, err := newDispatcher(outbox, &service.WebhookPublisher{
+		WebhookRepository:  webhooks,
+		DeliveryRepository: deliveries,
+		Transactor:         transactor,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	deliverer, err := newDeliverer(webhooks, deliveries)
+
+	if err != nil {
+		return nil, err
+	}
+
+	c.Dispatcher = dispatcher
+	c.Deliverer = deliverer
+
 	// create UserService with a implementation of UserRepository
 	userService := &service.UserService{
-		UserRepository: r.UserRepository,
+		UserRepository:   users,
+		AuditRepository:  audit,
+		OutboxRepository: outbox,
+		Transactor:       transactor,
+	}
+
+	// create AuditService with a implementation of AuditRepository
+	auditService := &service.AuditService{
+		AuditRepository: audit,
+	}
+
+	// create WebhookService with implementations of WebhookRepository and
+	// WebhookDeliveryRepository
+	webhookService := &service.WebhookService{
+		WebhookRepository:  webhooks,
+		DeliveryRepository: deliveries,
+		Transactor:         transactor,
 	}
 
 	// create handler container with a implementation of UserService
 	c.Handler = &handlers.Handler{
-		UserService: userService,
+		UserService:    userService,
+		AuditService:   auditService,
+		WebhookService: webhookService,
+		AdminToken:     os.Getenv("ADMIN_TOKEN"),
+		GatewayToken:   os.Getenv("GATEWAY_TOKEN"),
 	}
 
-	return nil
+	return userService, nil
 }
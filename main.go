@@ -2,16 +2,26 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"io/fs"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/joho/godotenv"
 )
 
+// Storages users can be kept in, chosen with the --storage flag
+const (
+	storageDatabase = "database"
+	storageMemory   = "memory"
+)
+
 // @title Users API
 // @version 1.0
 // @description This is a Users crud server.
@@ -20,29 +30,57 @@ import (
 
 // @BasePath /api/v1
 func main() {
-	log.Println("Starting server...")
+	storage := flag.String("storage", storageDatabase, "where users are kept: database (chosen by DATABASE_DRIVER) or memory")
+	seed := flag.Int("seed", 0, "number of fake users to create on start, with --storage=memory")
+	autoMigrate := flag.Bool("auto-migrate", false, "apply pending migrations on start, with --storage=database")
 
-	err := godotenv.Load()
+	flag.Parse()
 
-	if err != nil {
-		log.Fatal("Error loading .env file\n")
+	// the .env file is optional: containers are usually configured through
+	// the environment itself, with secrets mounted as files (see envReader)
+	if err := godotenv.Load(); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Fatalf("Error loading .env file: %v\n", err)
 	}
 
-	// initialize database sources
-	ds := &DatabaseSources{}
+	// users-api migrate ... runs migrations instead of the server
+	if flag.Arg(0) == "migrate" {
+		if err := runMigrate(flag.Args()[1:]); err != nil {
+			log.Fatalf("unable to migrate: %v\n", err)
+		}
 
-	if err := ds.Initialize(); err != nil {
-		log.Fatalf("unable to initialize database sources: %v\n", err)
+		return
 	}
 
-	if err != nil {
-		log.Fatalf("Unable to initialize data sources: %v\n", err)
-	}
+	log.Println("Starting server...")
 
 	c := &Container{}
 
-	if err := c.Initialize(ds); err != nil {
-		log.Fatalf("unable to initialize services via dependency injection: %v\n", err)
+	// initialize database sources
+	ds := &DatabaseSources{}
+
+	switch *storage {
+	case storageDatabase:
+		if err := ds.Initialize(); err != nil {
+			log.Fatalf("unable to initialize database sources: %v\n", err)
+		}
+
+		if *autoMigrate {
+			if err := applyMigrations(ds); err != nil {
+				log.Fatalf("unable to apply migrations: %v\n", err)
+			}
+		}
+
+		if err := c.Initialize(ds); err != nil {
+			log.Fatalf("unable to initialize services via dependency injection: %v\n", err)
+		}
+
+	case storageMemory:
+		if err := c.InitializeInMemory(*seed); err != nil {
+			log.Fatalf("unable to initialize services via dependency injection: %v\n", err)
+		}
+
+	default:
+		log.Fatalf("unknown storage %q, expected %s or %s\n", *storage, storageDatabase, storageMemory)
 	}
 
 	router := Router{}
@@ -68,6 +106,21 @@ func main() {
 
 	log.Printf("Listening on port %v\n", srv.Addr)
 
+	// relay the events of the outbox and deliver them to webhooks until
+	// shutdown
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
+
+	var workers sync.WaitGroup
+
+	for _, run := range []func(ctx context.Context){c.Dispatcher.Run, c.Deliverer.Run} {
+		workers.Add(1)
+
+		go func(run func(ctx context.Context)) {
+			defer workers.Done()
+			run(workersCtx)
+		}(run)
+	}
+
 	// Wait for kill signal of channel
 	quit := make(chan os.Signal, 2)
 
@@ -81,9 +134,16 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	// stop relaying and delivering events while the database is still
+	// there to release the lease on the outbox
+	stopWorkers()
+	workers.Wait()
+
 	// shutdown database sources
-	if err := ds.Close(); err != nil {
-		log.Fatalf("A problem occurred gracefully shutting down data sources: %v\n", err)
+	if ds.DB != nil {
+		if err := ds.Close(); err != nil {
+			log.Fatalf("A problem occurred gracefully shutting down data sources: %v\n", err)
+		}
 	}
 
 	// Shutdown server
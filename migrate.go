@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/klasrak/users-api/migrations"
+)
+
+// migrateUsage describes the migrate subcommand
+const migrateUsage = `usage: users-api migrate <command>
+
+commands:
+  up [N]         apply the next N pending migrations, or all of them
+  down [N|all]   undo the last N applied migrations, 1 by default
+  status         print the version of the database and the pending migrations
+  force VERSION  mark the database clean at VERSION (-1 for none), without migrating`
+
+// runMigrate runs the migrate subcommand against the database configured in
+// the environment, with the migrations embedded in the binary
+func runMigrate(args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	ds := &DatabaseSources{}
+
+	if err := ds.Initialize(); err != nil {
+		return fmt.Errorf("unable to initialize database sources: %w", err)
+	}
+
+	defer ds.Close()
+
+	db, release, err := ds.migrationDB()
+
+	if err != nil {
+		return err
+	}
+
+	defer release()
+
+	m, err := migrations.New(db, ds.Driver)
+
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	command, args := args[0], args[1:]
+
+	switch {
+	case command == "up" && len(args) <= 1:
+		n, err := migrationCount(args, 0)
+
+		if err != nil {
+			return err
+		}
+
+		return m.Up(ctx, n)
+
+	case command == "down" && len(args) <= 1:
+		n, err := migrationCount(args, 1)
+
+		if err != nil {
+			return err
+		}
+
+		return m.Down(ctx, n)
+
+	case command == "status" && len(args) == 0:
+		return printMigrationStatus(ctx, m)
+
+	case command == "force" && len(args) == 1:
+		version, err := strconv.Atoi(args[0])
+
+		if err != nil {
+			return fmt.Errorf("invalid version %q", args[0])
+		}
+
+		return m.Force(ctx, version)
+	}
+
+	return errors.New(migrateUsage)
+}
+
+// migrationCount reads the optional number of migrations to run, which must
+// be positive. Running every one must be asked for with "all", returned as
+// 0: a mistyped 0 must not roll the whole schema back
+func migrationCount(args []string, fallback int) (int, error) {
+	if len(args) == 0 {
+		return fallback, nil
+	}
+
+	if args[0] == "all" {
+		return 0, nil
+	}
+
+	n, err := strconv.Atoi(args[0])
+
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid number of migrations %q, expected a positive number or all", args[0])
+	}
+
+	return n, nil
+}
+
+func printMigrationStatus(ctx context.Context, m *migrations.Migrator) error {
+	status, err := m.Status(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	if status.Version == migrations.NilVersion {
+		fmt.Println("version: none")
+	} else {
+		fmt.Printf("version: %d\n", status.Version)
+	}
+
+	fmt.Printf("dirty: %t\n", status.Dirty)
+
+	if len(status.Pending) == 0 {
+		fmt.Println("pending: none")
+		return nil
+	}
+
+	fmt.Println("pending:")
+
+	for _, p := range status.Pending {
+		fmt.Printf("  %d_%s\n", p.Version, p.Name)
+	}
+
+	return nil
+}
+
+// applyMigrations applies every pending migration to the database of ds.
+// Replicas starting at once wait for each other, and only the first one
+// migrates
+func applyMigrations(ds *DatabaseSources) error {
+	db, release, err := ds.migrationDB()
+
+	if err != nil {
+		return err
+	}
+
+	defer release()
+
+	m, err := migrations.New(db, ds.Driver)
+
+	if err != nil {
+		return err
+	}
+
+	return m.Up(context.Background(), 0)
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMigrationCount(t *testing.T) {
+	for name, tc := range map[string]struct {
+		args []string
+		n    int
+	}{
+		"default": {nil, 1},
+		"number":  {[]string{"3"}, 3},
+		"all":     {[]string{"all"}, 0},
+	} {
+		t.Run(name, func(t *testing.T) {
+			n, err := migrationCount(tc.args, 1)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.n, n)
+		})
+	}
+
+	// every migration must be asked for by name
+	for _, arg := range []string{"0", "-1", "two"} {
+		t.Run(arg, func(t *testing.T) {
+			_, err := migrationCount([]string{arg}, 1)
+
+			assert.Error(t, err)
+		})
+	}
+}
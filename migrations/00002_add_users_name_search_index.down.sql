@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS users_name_trgm_idx;
+DROP FUNCTION IF EXISTS immutable_unaccent(text);
+DROP EXTENSION IF EXISTS pg_trgm;
+DROP EXTENSION IF EXISTS unaccent;
@@ -0,0 +1,12 @@
+CREATE EXTENSION IF NOT EXISTS unaccent;
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- unaccent() is only STABLE, so it can't be used in an index expression.
+-- Pinning the dictionary lets us safely declare the wrapper IMMUTABLE.
+CREATE OR REPLACE FUNCTION immutable_unaccent(text)
+  RETURNS text
+  LANGUAGE sql IMMUTABLE PARALLEL SAFE STRICT
+AS $$ SELECT public.unaccent('public.unaccent'::regdictionary, $1) $$;
+
+CREATE INDEX IF NOT EXISTS users_name_trgm_idx
+  ON users USING GIN (immutable_unaccent(name) gin_trgm_ops);
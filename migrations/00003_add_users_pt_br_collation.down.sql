@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS users_birthdate_idx;
+DROP INDEX IF EXISTS users_name_pt_br_idx;
+DROP COLLATION IF EXISTS pt_br;
@@ -0,0 +1,7 @@
+-- ICU collation so accented Brazilian names sort the way users expect
+-- (e.g. "Álvaro" next to "Alvaro" instead of after "Zé")
+CREATE COLLATION IF NOT EXISTS pt_br (provider = icu, locale = 'pt-BR');
+
+-- Backs keyset pagination of listings sorted by name
+CREATE INDEX IF NOT EXISTS users_name_pt_br_idx ON users (name COLLATE pt_br, id);
+CREATE INDEX IF NOT EXISTS users_birthdate_idx ON users (birthdate, id);
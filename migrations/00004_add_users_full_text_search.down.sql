@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS users_search_idx;
+DROP FUNCTION IF EXISTS users_search_document(text, text);
+DROP TEXT SEARCH CONFIGURATION IF EXISTS portuguese_unaccent;
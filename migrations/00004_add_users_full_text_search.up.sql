@@ -0,0 +1,19 @@
+-- Portuguese stemming that also ignores accents, so "joao" matches "João"
+CREATE TEXT SEARCH CONFIGURATION portuguese_unaccent (COPY = portuguese);
+
+ALTER TEXT SEARCH CONFIGURATION portuguese_unaccent
+  ALTER MAPPING FOR hword, hword_part, word WITH unaccent, portuguese_stem;
+
+-- Searchable document of a user: the name (weight A) and the e-mail (weight B).
+-- The e-mail is also split on punctuation so its parts can be searched alone.
+CREATE OR REPLACE FUNCTION users_search_document(name text, email text)
+  RETURNS tsvector
+  LANGUAGE sql IMMUTABLE PARALLEL SAFE
+AS $$
+  SELECT setweight(to_tsvector('public.portuguese_unaccent', coalesce(name, '')), 'A') ||
+         setweight(to_tsvector('public.portuguese_unaccent',
+           coalesce(email, '') || ' ' || regexp_replace(coalesce(email, ''), '[@._+-]+', ' ', 'g')), 'B')
+$$;
+
+CREATE INDEX IF NOT EXISTS users_search_idx
+  ON users USING GIN (users_search_document(name, email));
@@ -0,0 +1,9 @@
+-- Fails while a deleted user shares an e-mail or cpf with an active one;
+-- purge or rename those users first
+DROP INDEX IF EXISTS users_cpf_key;
+DROP INDEX IF EXISTS users_email_key;
+
+ALTER TABLE users ADD CONSTRAINT users_email_key UNIQUE (email);
+ALTER TABLE users ADD CONSTRAINT users_cpf_key UNIQUE (cpf);
+
+ALTER TABLE users DROP COLUMN IF EXISTS deleted_at;
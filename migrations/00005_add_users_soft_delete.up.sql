@@ -0,0 +1,10 @@
+-- Deleted users are kept around until purged, so they can be restored
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+
+-- Only active users must be unique, so a deleted user does not block
+-- someone registering again with the same e-mail or cpf
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_email_key;
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_cpf_key;
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_key ON users (email) WHERE deleted_at IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS users_cpf_key ON users (cpf) WHERE deleted_at IS NULL;
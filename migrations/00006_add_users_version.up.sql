@@ -0,0 +1,18 @@
+-- Version of each user, used for optimistic concurrency control
+ALTER TABLE users ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
+
+-- Every change to a user bumps its version, so a client holding an older
+-- version can't overwrite it by accident, whatever query changed the row
+CREATE OR REPLACE FUNCTION users_bump_version()
+  RETURNS trigger
+  LANGUAGE plpgsql
+AS $$
+BEGIN
+  NEW.version := OLD.version + 1;
+  RETURN NEW;
+END;
+$$;
+
+CREATE TRIGGER users_bump_version
+  BEFORE UPDATE ON users
+  FOR EACH ROW EXECUTE FUNCTION users_bump_version();
@@ -0,0 +1,35 @@
+-- Append-only log of every change made to users. user_id has no foreign
+-- key on purpose: the history of a purged user must outlive the user
+CREATE TABLE IF NOT EXISTS audit_log (
+  id BIGSERIAL PRIMARY KEY,
+  user_id uuid NOT NULL,
+  actor VARCHAR NOT NULL,
+  request_id VARCHAR NOT NULL,
+  action VARCHAR NOT NULL,
+  changes JSONB NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL,
+  prev_hash CHAR(64) NOT NULL,
+  hash CHAR(64) NOT NULL UNIQUE
+);
+
+CREATE INDEX IF NOT EXISTS audit_log_user_id_idx ON audit_log (user_id, id);
+CREATE INDEX IF NOT EXISTS audit_log_actor_idx ON audit_log (actor, id);
+CREATE INDEX IF NOT EXISTS audit_log_created_at_idx ON audit_log (created_at, id);
+
+-- Entries can never be changed or removed, not even by the application
+CREATE OR REPLACE FUNCTION audit_log_immutable()
+  RETURNS trigger
+  LANGUAGE plpgsql
+AS $$
+BEGIN
+  RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$;
+
+CREATE TRIGGER audit_log_no_update_or_delete
+  BEFORE UPDATE OR DELETE ON audit_log
+  FOR EACH ROW EXECUTE FUNCTION audit_log_immutable();
+
+CREATE TRIGGER audit_log_no_truncate
+  BEFORE TRUNCATE ON audit_log
+  FOR EACH STATEMENT EXECUTE FUNCTION audit_log_immutable();
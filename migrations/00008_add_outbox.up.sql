@@ -0,0 +1,26 @@
+-- Events announcing changes of users, appended in the transaction making
+-- the change and removed once relayed. user_id has no foreign key on
+-- purpose: the events of a purged user must still be relayed
+CREATE TABLE IF NOT EXISTS outbox (
+  seq BIGSERIAL PRIMARY KEY,
+  id uuid NOT NULL UNIQUE,
+  type VARCHAR NOT NULL,
+  user_id uuid NOT NULL,
+  payload JSONB NOT NULL,
+  occurred_at TIMESTAMPTZ NOT NULL,
+  attempts INTEGER NOT NULL DEFAULT 0,
+  available_at TIMESTAMPTZ NOT NULL,
+  last_error VARCHAR
+);
+
+CREATE INDEX IF NOT EXISTS outbox_user_id_idx ON outbox (user_id, seq);
+CREATE INDEX IF NOT EXISTS outbox_available_at_idx ON outbox (available_at);
+
+-- Its single row tells which instance relays events, and until when
+CREATE TABLE IF NOT EXISTS outbox_lease (
+  name VARCHAR PRIMARY KEY,
+  holder VARCHAR NOT NULL DEFAULT '',
+  expires_at TIMESTAMPTZ NOT NULL DEFAULT '-infinity'
+);
+
+INSERT INTO outbox_lease (name) VALUES ('dispatcher') ON CONFLICT DO NOTHING;
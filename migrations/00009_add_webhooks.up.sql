@@ -0,0 +1,39 @@
+-- Endpoints of partner systems the events announcing changes of users are
+-- delivered to, signed with their secret
+CREATE TABLE IF NOT EXISTS webhooks (
+  id uuid PRIMARY KEY,
+  url VARCHAR NOT NULL,
+  -- comma separated event types
+  events VARCHAR NOT NULL,
+  secret VARCHAR NOT NULL,
+  active BOOLEAN NOT NULL,
+  disabled_reason VARCHAR NOT NULL,
+  failures INTEGER NOT NULL DEFAULT 0,
+  created_at TIMESTAMPTZ NOT NULL,
+  updated_at TIMESTAMPTZ NOT NULL
+);
+
+-- Every delivery of an event to a webhook, and the outcome of its last
+-- attempt. payload is kept byte for byte as it is signed and sent
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+  id uuid PRIMARY KEY,
+  webhook_id uuid NOT NULL REFERENCES webhooks (id) ON DELETE CASCADE,
+  event_id uuid NOT NULL,
+  event_type VARCHAR NOT NULL,
+  redelivery_of uuid,
+  payload TEXT NOT NULL,
+  status VARCHAR NOT NULL,
+  attempts INTEGER NOT NULL DEFAULT 0,
+  response_code INTEGER,
+  last_error TEXT NOT NULL,
+  next_attempt_at TIMESTAMPTZ NOT NULL,
+  claimed_until TIMESTAMPTZ,
+  created_at TIMESTAMPTZ NOT NULL,
+  delivered_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS webhook_deliveries_webhook_id_idx ON webhook_deliveries (webhook_id, created_at);
+CREATE INDEX IF NOT EXISTS webhook_deliveries_event_id_idx ON webhook_deliveries (event_id);
+-- an event is delivered once to a webhook, unless asked to again
+CREATE UNIQUE INDEX IF NOT EXISTS webhook_deliveries_first_idx ON webhook_deliveries (webhook_id, event_id) WHERE redelivery_of IS NULL;
+CREATE INDEX IF NOT EXISTS webhook_deliveries_due_idx ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
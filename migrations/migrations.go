@@ -0,0 +1,110 @@
+// Package migrations holds the schema migrations of every database users can
+// be stored in, embedded in the binary, and applies them.
+//
+// Applied versions are tracked in the schema_migrations table, as the
+// migrate CLI (github.com/golang-migrate/migrate) does, so databases
+// migrated with either one can be migrated further with the other
+package migrations
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+//go:embed *.sql sqlite/*.sql mysql/*.sql
+var files embed.FS
+
+// dirs maps the database drivers (see the repository package) to the
+// directory holding their migrations
+var dirs = map[string]string{
+	"postgres": ".",
+	"sqlite":   "sqlite",
+	"mysql":    "mysql",
+}
+
+// Migration is a numbered schema change along with the script undoing it
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// fileName matches migration files, e.g. 00001_add_users_table.up.sql
+var fileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Load returns the migrations of a database driver, oldest first. Every
+// migration must come with both of its scripts
+func Load(driver string) ([]Migration, error) {
+	dir, ok := dirs[driver]
+
+	if !ok {
+		return nil, fmt.Errorf("no migrations for database driver %q", driver)
+	}
+
+	entries, err := fs.ReadDir(files, dir)
+
+	if err != nil {
+		return nil, fmt.Errorf("error reading migrations: %w", err)
+	}
+
+	byVersion := map[int]*Migration{}
+
+	for _, e := range entries {
+		m := fileName.FindStringSubmatch(e.Name())
+
+		if e.IsDir() || m == nil {
+			continue
+		}
+
+		version, err := strconv.Atoi(m[1])
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version in %s: %w", e.Name(), err)
+		}
+
+		script, err := fs.ReadFile(files, path.Join(dir, e.Name()))
+
+		if err != nil {
+			return nil, fmt.Errorf("error reading migration %s: %w", e.Name(), err)
+		}
+
+		migration, ok := byVersion[version]
+
+		if !ok {
+			migration = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = migration
+		}
+
+		if migration.Name != m[2] {
+			return nil, fmt.Errorf("migrations %s and %s share version %d", migration.Name, m[2], version)
+		}
+
+		if m[3] == "up" {
+			migration.Up = string(script)
+		} else {
+			migration.Down = string(script)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s must have both an up and a down script", m.Version, m.Name)
+		}
+
+		migrations = append(migrations, *m)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
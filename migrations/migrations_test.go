@@ -0,0 +1,36 @@
+package migrations
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoad(t *testing.T) {
+	postgres, err := Load("postgres")
+
+	assert.NoError(t, err)
+	assert.NotEmpty(t, postgres)
+
+	for i, m := range postgres {
+		assert.Equal(t, i+1, m.Version)
+		assert.NotEmpty(t, m.Up)
+		assert.NotEmpty(t, m.Down)
+	}
+
+	// every database goes through the same versions
+	for _, driver := range []string{"sqlite", "mysql"} {
+		migrations, err := Load(driver)
+
+		assert.NoError(t, err)
+		assert.Len(t, migrations, len(postgres))
+
+		for i, m := range migrations {
+			assert.Equal(t, postgres[i].Version, m.Version, driver)
+			assert.Equal(t, postgres[i].Name, m.Name, driver)
+		}
+	}
+
+	_, err = Load("oracle")
+	assert.EqualError(t, err, `no migrations for database driver "oracle"`)
+}
@@ -0,0 +1,384 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// NilVersion is the version of a database no migration was applied to
+const NilVersion = -1
+
+// migrationLock is the Postgres advisory lock held while migrating
+const migrationLock = 7_411_002
+
+// mysqlLockTimeout is how long MySQL waits for another replica to finish
+// migrating, in seconds
+const mysqlLockTimeout = 600
+
+// DirtyError tells that a migration failed halfway through, leaving the
+// schema in an unknown state. It must be fixed by hand, and the version it
+// is left at set with Force
+type DirtyError struct {
+	Version int
+}
+
+func (e *DirtyError) Error() string {
+	return fmt.Sprintf("database is dirty at version %d: fix the schema by hand, then force the version it is at", e.Version)
+}
+
+// Status tells which migrations were applied to a database
+type Status struct {
+	// Version is the last migration applied, or NilVersion
+	Version int
+	// Dirty tells that the migration to Version failed halfway through
+	Dirty bool
+	// Pending holds the migrations still to be applied, oldest first
+	Pending []Migration
+}
+
+// dialect holds the statements that differ between databases
+type dialect struct {
+	createTable   string
+	insertVersion string
+	lock          func(ctx context.Context, conn *sqlx.Conn) error
+	unlock        func(ctx context.Context, conn *sqlx.Conn) error
+	// locksInTx tells that lock opens a transaction, which versions must
+	// be changed in as well
+	locksInTx bool
+}
+
+var dialects = map[string]*dialect{
+	"postgres": {
+		createTable:   "CREATE TABLE IF NOT EXISTS schema_migrations (version bigint NOT NULL PRIMARY KEY, dirty boolean NOT NULL);",
+		insertVersion: "INSERT INTO schema_migrations (version, dirty) VALUES ($1, $2);",
+		lock: func(ctx context.Context, conn *sqlx.Conn) error {
+			_, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1);", migrationLock)
+			return err
+		},
+		unlock: func(ctx context.Context, conn *sqlx.Conn) error {
+			_, err := conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1);", migrationLock)
+			return err
+		},
+	},
+	"mysql": {
+		createTable:   "CREATE TABLE IF NOT EXISTS schema_migrations (version bigint NOT NULL PRIMARY KEY, dirty boolean NOT NULL) ENGINE = InnoDB;",
+		insertVersion: "INSERT INTO schema_migrations (version, dirty) VALUES (?, ?);",
+		lock: func(ctx context.Context, conn *sqlx.Conn) error {
+			var locked sql.NullInt64
+
+			if err := conn.GetContext(ctx, &locked, "SELECT GET_LOCK(CONCAT('migrations:', DATABASE()), ?);", mysqlLockTimeout); err != nil {
+				return err
+			}
+
+			if locked.Int64 != 1 {
+				return errors.New("timed out waiting for another migration to finish")
+			}
+
+			return nil
+		},
+		unlock: func(ctx context.Context, conn *sqlx.Conn) error {
+			_, err := conn.ExecContext(ctx, "SELECT RELEASE_LOCK(CONCAT('migrations:', DATABASE()));")
+			return err
+		},
+	},
+	// SQLite has no advisory locks: migrations run in a single transaction
+	// holding the write lock of the database instead. Scripts failing
+	// halfway through are still committed, and leave the database dirty,
+	// as they do in the other databases
+	"sqlite": {
+		createTable:   "CREATE TABLE IF NOT EXISTS schema_migrations (version uint64, dirty bool); CREATE UNIQUE INDEX IF NOT EXISTS version_unique ON schema_migrations (version);",
+		insertVersion: "INSERT INTO schema_migrations (version, dirty) VALUES (?, ?);",
+		lock: func(ctx context.Context, conn *sqlx.Conn) error {
+			_, err := conn.ExecContext(ctx, "BEGIN IMMEDIATE;")
+			return err
+		},
+		unlock: func(ctx context.Context, conn *sqlx.Conn) error {
+			_, err := conn.ExecContext(ctx, "COMMIT;")
+			return err
+		},
+		locksInTx: true,
+	},
+}
+
+// Migrator applies the migrations of a database. Changes to the schema are
+// made holding a lock, so replicas starting at once don't race
+type Migrator struct {
+	DB         *sqlx.DB
+	dialect    *dialect
+	migrations []Migration
+}
+
+// New creates a Migrator for db, a database of the given driver
+func New(db *sqlx.DB, driver string) (*Migrator, error) {
+	d, ok := dialects[driver]
+
+	if !ok {
+		return nil, fmt.Errorf("no migrations for database driver %q", driver)
+	}
+
+	migrations, err := Load(driver)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{DB: db, dialect: d, migrations: migrations}, nil
+}
+
+// Status reads the version of the database and the migrations still to be
+// applied to it
+func (m *Migrator) Status(ctx context.Context) (*Status, error) {
+	conn, err := m.DB.Connx(ctx)
+
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to db: %w", err)
+	}
+
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, m.dialect.createTable); err != nil {
+		return nil, fmt.Errorf("error creating schema_migrations: %w", err)
+	}
+
+	status := &Status{}
+
+	status.Version, status.Dirty, err = m.version(ctx, conn)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, migration := range m.migrations {
+		if migration.Version > status.Version {
+			status.Pending = append(status.Pending, migration)
+		}
+	}
+
+	return status, nil
+}
+
+// Up applies the next n pending migrations, or all of them when n is 0
+func (m *Migrator) Up(ctx context.Context, n int) error {
+	return m.locked(ctx, func(conn *sqlx.Conn) error {
+		current, dirty, err := m.version(ctx, conn)
+
+		if err != nil {
+			return err
+		}
+
+		if dirty {
+			return &DirtyError{Version: current}
+		}
+
+		applied := 0
+
+		for _, migration := range m.migrations {
+			if migration.Version <= current {
+				continue
+			}
+
+			if n > 0 && applied == n {
+				break
+			}
+
+			if err := m.run(ctx, conn, migration, "up", migration.Up, migration.Version); err != nil {
+				return err
+			}
+
+			applied++
+		}
+
+		if applied == 0 {
+			log.Println("no migrations to apply")
+		}
+
+		return nil
+	})
+}
+
+// Down undoes the last n applied migrations, or all of them when n is 0
+func (m *Migrator) Down(ctx context.Context, n int) error {
+	return m.locked(ctx, func(conn *sqlx.Conn) error {
+		current, dirty, err := m.version(ctx, conn)
+
+		if err != nil {
+			return err
+		}
+
+		if dirty {
+			return &DirtyError{Version: current}
+		}
+
+		if current != NilVersion && m.index(current) < 0 {
+			return fmt.Errorf("database is at version %d, which no migration has", current)
+		}
+
+		undone := 0
+
+		for i := m.index(current); i >= 0; i-- {
+			if n > 0 && undone == n {
+				break
+			}
+
+			previous := NilVersion
+
+			if i > 0 {
+				previous = m.migrations[i-1].Version
+			}
+
+			if err := m.run(ctx, conn, m.migrations[i], "down", m.migrations[i].Down, previous); err != nil {
+				return err
+			}
+
+			undone++
+		}
+
+		if undone == 0 {
+			log.Println("no migrations to undo")
+		}
+
+		return nil
+	})
+}
+
+// Force sets the version of the database, and marks it clean, without
+// running any migration. It is how dirty databases are recovered once
+// their schema was fixed by hand
+func (m *Migrator) Force(ctx context.Context, version int) error {
+	if version != NilVersion && m.index(version) < 0 {
+		return fmt.Errorf("no migration has version %d", version)
+	}
+
+	return m.locked(ctx, func(conn *sqlx.Conn) error {
+		return m.setVersion(ctx, conn, version, false)
+	})
+}
+
+// locked runs fn on a single connection holding the migration lock, once
+// schema_migrations exists
+func (m *Migrator) locked(ctx context.Context, fn func(conn *sqlx.Conn) error) error {
+	conn, err := m.DB.Connx(ctx)
+
+	if err != nil {
+		return fmt.Errorf("error connecting to db: %w", err)
+	}
+
+	defer conn.Close()
+
+	if err := m.dialect.lock(ctx, conn); err != nil {
+		return fmt.Errorf("error locking migrations: %w", err)
+	}
+
+	if _, err = conn.ExecContext(ctx, m.dialect.createTable); err != nil {
+		err = fmt.Errorf("error creating schema_migrations: %w", err)
+	} else {
+		err = fn(conn)
+	}
+
+	// the lock must be released even when ctx is done
+	if unlockErr := m.dialect.unlock(context.Background(), conn); unlockErr != nil && err == nil {
+		err = fmt.Errorf("error unlocking migrations: %w", unlockErr)
+	}
+
+	return err
+}
+
+// run runs one script of a migration. The database is marked dirty at
+// version while the script runs, and clean once it succeeds
+func (m *Migrator) run(ctx context.Context, conn *sqlx.Conn, migration Migration, direction, script string, version int) error {
+	start := time.Now()
+
+	if err := m.setVersion(ctx, conn, version, true); err != nil {
+		return err
+	}
+
+	if _, err := conn.ExecContext(ctx, script); err != nil {
+		return fmt.Errorf("error running migration %d_%s (%s): %w", migration.Version, migration.Name, direction, err)
+	}
+
+	if err := m.setVersion(ctx, conn, version, false); err != nil {
+		return err
+	}
+
+	log.Printf("migrated %d_%s (%s) in %v\n", migration.Version, migration.Name, direction, time.Since(start).Round(time.Millisecond))
+
+	return nil
+}
+
+// version reads the version of the database
+func (m *Migrator) version(ctx context.Context, conn *sqlx.Conn) (int, bool, error) {
+	var row struct {
+		Version int  `db:"version"`
+		Dirty   bool `db:"dirty"`
+	}
+
+	err := conn.GetContext(ctx, &row, "SELECT version, dirty FROM schema_migrations LIMIT 1;")
+
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return NilVersion, false, nil
+	case err != nil:
+		return 0, false, fmt.Errorf("error reading schema version: %w", err)
+	}
+
+	return row.Version, row.Dirty, nil
+}
+
+// setVersion replaces the version of the database
+func (m *Migrator) setVersion(ctx context.Context, conn *sqlx.Conn, version int, dirty bool) error {
+	set := func(ex sqlx.ExecerContext) error {
+		if _, err := ex.ExecContext(ctx, "DELETE FROM schema_migrations;"); err != nil {
+			return err
+		}
+
+		if version == NilVersion {
+			return nil
+		}
+
+		_, err := ex.ExecContext(ctx, m.dialect.insertVersion, version, dirty)
+
+		return err
+	}
+
+	if m.dialect.locksInTx {
+		if err := set(conn); err != nil {
+			return fmt.Errorf("error setting schema version: %w", err)
+		}
+
+		return nil
+	}
+
+	tx, err := conn.BeginTxx(ctx, nil)
+
+	if err != nil {
+		return fmt.Errorf("error setting schema version: %w", err)
+	}
+
+	if err := set(tx); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("error setting schema version: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error setting schema version: %w", err)
+	}
+
+	return nil
+}
+
+// index returns the position of the migration with the given version, or -1
+func (m *Migrator) index(version int) int {
+	for i, migration := range m.migrations {
+		if migration.Version == version {
+			return i
+		}
+	}
+
+	return -1
+}
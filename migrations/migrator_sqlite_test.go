@@ -0,0 +1,112 @@
+//go:build cgo
+
+package migrations
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/klasrak/users-api/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newSQLiteDB(t *testing.T) *sqlx.DB {
+	db, err := sqlx.Open(repository.SQLiteDriver, repository.SQLiteDSN(filepath.Join(t.TempDir(), "users.db")))
+	require.NoError(t, err)
+
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+func TestMigrator(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Up, down and status", func(t *testing.T) {
+		m, err := New(newSQLiteDB(t), "sqlite")
+		require.NoError(t, err)
+
+		status, err := m.Status(ctx)
+
+		assert.NoError(t, err)
+		assert.Equal(t, NilVersion, status.Version)
+		assert.Len(t, status.Pending, len(m.migrations))
+
+		assert.NoError(t, m.Up(ctx, 2))
+
+		status, err = m.Status(ctx)
+
+		assert.NoError(t, err)
+		assert.Equal(t, 2, status.Version)
+
+		assert.NoError(t, m.Up(ctx, 0))
+
+		status, err = m.Status(ctx)
+
+		assert.NoError(t, err)
+		assert.Equal(t, len(m.migrations), status.Version)
+		assert.False(t, status.Dirty)
+		assert.Empty(t, status.Pending)
+
+		// the schema is usable
+		_, err = m.DB.Exec("INSERT INTO users (id, name, email, cpf, birthdate) VALUES ('1', 'João', 'joao@mail.com', '313.716.772-80', '1990-01-31');")
+		assert.NoError(t, err)
+
+		assert.NoError(t, m.Down(ctx, 1))
+
+		status, err = m.Status(ctx)
+
+		assert.NoError(t, err)
+		assert.Equal(t, len(m.migrations)-1, status.Version)
+
+		assert.NoError(t, m.Down(ctx, 0))
+
+		status, err = m.Status(ctx)
+
+		assert.NoError(t, err)
+		assert.Equal(t, NilVersion, status.Version)
+	})
+
+	t.Run("Failed migrations leave the database dirty until forced", func(t *testing.T) {
+		m := &Migrator{
+			DB:      newSQLiteDB(t),
+			dialect: dialects["sqlite"],
+			migrations: []Migration{
+				{Version: 1, Name: "add_a", Up: "CREATE TABLE a (x);", Down: "DROP TABLE a;"},
+				{Version: 2, Name: "add_b", Up: "CREATE TABLE b (x); CREATE TABLE a (x);", Down: "DROP TABLE b;"},
+			},
+		}
+
+		assert.Error(t, m.Up(ctx, 0))
+
+		status, err := m.Status(ctx)
+
+		assert.NoError(t, err)
+		assert.Equal(t, 2, status.Version)
+		assert.True(t, status.Dirty)
+
+		assert.Equal(t, &DirtyError{Version: 2}, m.Up(ctx, 0))
+		assert.Equal(t, &DirtyError{Version: 2}, m.Down(ctx, 0))
+
+		assert.EqualError(t, m.Force(ctx, 3), "no migration has version 3")
+
+		// b was created before the script failed, so the migration is done
+		assert.NoError(t, m.Force(ctx, 2))
+
+		status, err = m.Status(ctx)
+
+		assert.NoError(t, err)
+		assert.Equal(t, 2, status.Version)
+		assert.False(t, status.Dirty)
+
+		assert.NoError(t, m.Down(ctx, 0))
+
+		status, err = m.Status(ctx)
+
+		assert.NoError(t, err)
+		assert.Equal(t, NilVersion, status.Version)
+	})
+}
@@ -0,0 +1,41 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMigratorLocks(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+
+	sqlxDB := sqlx.NewDb(db, "sqlmock")
+
+	defer sqlxDB.Close()
+
+	m := &Migrator{
+		DB:         sqlxDB,
+		dialect:    dialects["postgres"],
+		migrations: []Migration{{Version: 1, Name: "add_users", Up: "CREATE TABLE users (id uuid);", Down: "DROP TABLE users;"}},
+	}
+
+	mock.ExpectExec(`SELECT pg_advisory_lock\(\$1\);`).WithArgs(migrationLock).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS schema_migrations`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT version, dirty FROM schema_migrations LIMIT 1;`).WillReturnRows(sqlmock.NewRows([]string{"version", "dirty"}))
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM schema_migrations;`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`INSERT INTO schema_migrations`).WithArgs(1, true).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectExec(`CREATE TABLE users`).WillReturnError(errors.New("permission denied"))
+	mock.ExpectExec(`SELECT pg_advisory_unlock\(\$1\);`).WithArgs(migrationLock).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err = m.Up(context.Background(), 0)
+
+	assert.EqualError(t, err, "error running migration 1_add_users (up): permission denied")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
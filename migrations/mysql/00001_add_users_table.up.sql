@@ -0,0 +1,12 @@
+-- MySQL has no uuid type, ids are stored as text and generated by the
+-- application. Text compares byte by byte unless a column says otherwise,
+-- as it does in Postgres
+CREATE TABLE IF NOT EXISTS users (
+  id CHAR(36) NOT NULL PRIMARY KEY,
+  name VARCHAR(255) NOT NULL,
+  email VARCHAR(255) NOT NULL,
+  cpf VARCHAR(255) NOT NULL,
+  birthdate DATE NOT NULL,
+  UNIQUE KEY users_email_key (email),
+  UNIQUE KEY users_cpf_key (cpf)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4 COLLATE = utf8mb4_bin;
@@ -0,0 +1,3 @@
+-- There are no trigram indexes in MySQL, and LIKE '%...%' can't use regular
+-- ones, so name searches scan the table.
+DO 0;
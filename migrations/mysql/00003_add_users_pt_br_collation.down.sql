@@ -0,0 +1,4 @@
+DROP INDEX users_birthdate_idx ON users;
+DROP INDEX users_name_idx ON users;
+
+ALTER TABLE users MODIFY name VARCHAR(255) NOT NULL COLLATE utf8mb4_bin;
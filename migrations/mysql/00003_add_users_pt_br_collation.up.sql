@@ -0,0 +1,7 @@
+-- Names compare ignoring case and accents, which is as close as MySQL and
+-- MariaDB both get to the pt_br collation. Names differing only in case or
+-- accents are equal, and sort by id.
+ALTER TABLE users MODIFY name VARCHAR(255) NOT NULL COLLATE utf8mb4_unicode_ci;
+
+CREATE INDEX users_name_idx ON users (name, id);
+CREATE INDEX users_birthdate_idx ON users (birthdate, id);
@@ -0,0 +1 @@
+DO 0;
@@ -0,0 +1,4 @@
+-- MySQL full-text indexes don't stem Portuguese nor match within e-mails.
+-- Searches match every word as a prefix of the words of names and e-mails,
+-- ignoring case and accents, and are ranked by the application.
+DO 0;
@@ -0,0 +1,10 @@
+-- Fails while a deleted user shares an e-mail or cpf with an active one;
+-- purge or rename those users first
+ALTER TABLE users
+  DROP INDEX users_email_key,
+  DROP INDEX users_cpf_key,
+  DROP COLUMN active_email,
+  DROP COLUMN active_cpf,
+  DROP COLUMN deleted_at,
+  ADD UNIQUE KEY users_email_key (email),
+  ADD UNIQUE KEY users_cpf_key (cpf);
@@ -0,0 +1,15 @@
+-- Deleted users are kept around until purged, so they can be restored.
+-- Timestamps are stored in UTC
+ALTER TABLE users ADD COLUMN deleted_at DATETIME(6) NULL;
+
+-- Only active users must be unique, so a deleted user does not block
+-- someone registering again with the same e-mail or cpf. MySQL has no
+-- partial indexes, but unique indexes allow any number of NULLs, so the
+-- indexes cover columns that are NULL for deleted users
+ALTER TABLE users
+  ADD COLUMN active_email VARCHAR(255) AS (IF(deleted_at IS NULL, email, NULL)) VIRTUAL,
+  ADD COLUMN active_cpf VARCHAR(255) AS (IF(deleted_at IS NULL, cpf, NULL)) VIRTUAL,
+  DROP INDEX users_email_key,
+  DROP INDEX users_cpf_key,
+  ADD UNIQUE KEY users_email_key (active_email),
+  ADD UNIQUE KEY users_cpf_key (active_cpf);
@@ -0,0 +1,8 @@
+-- Version of each user, used for optimistic concurrency control
+ALTER TABLE users ADD COLUMN version INT NOT NULL DEFAULT 1;
+
+-- Every change to a user bumps its version, so a client holding an older
+-- version can't overwrite it by accident, whatever query changed the row
+CREATE TRIGGER users_bump_version
+  BEFORE UPDATE ON users
+  FOR EACH ROW SET NEW.version = OLD.version + 1;
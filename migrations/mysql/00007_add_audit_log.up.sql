@@ -0,0 +1,38 @@
+-- Append-only log of every change made to users. user_id has no foreign
+-- key on purpose: the history of a purged user must outlive the user
+CREATE TABLE IF NOT EXISTS audit_log (
+  id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+  user_id CHAR(36) NOT NULL,
+  actor VARCHAR(255) NOT NULL,
+  request_id VARCHAR(255) NOT NULL,
+  action VARCHAR(16) NOT NULL,
+  -- JSON columns reject the binary strings changes are sent as
+  changes LONGTEXT NOT NULL,
+  -- stored in UTC
+  created_at DATETIME(6) NOT NULL,
+  prev_hash CHAR(64) NOT NULL,
+  hash CHAR(64) NOT NULL,
+  UNIQUE KEY audit_log_hash_key (hash),
+  KEY audit_log_user_id_idx (user_id, id),
+  KEY audit_log_actor_idx (actor, id),
+  KEY audit_log_created_at_idx (created_at, id)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4 COLLATE = utf8mb4_bin;
+
+-- Its single row is locked by writers of the audit log until their
+-- transaction ends, as the advisory lock taken in Postgres is
+CREATE TABLE IF NOT EXISTS audit_log_lock (
+  id TINYINT NOT NULL PRIMARY KEY
+) ENGINE = InnoDB;
+
+INSERT INTO audit_log_lock (id) VALUES (1);
+
+-- Entries can never be changed or removed, not even by the application.
+-- MySQL triggers can't stop TRUNCATE, so the application's database user
+-- should not be granted DROP on audit_log
+CREATE TRIGGER audit_log_no_update
+  BEFORE UPDATE ON audit_log
+  FOR EACH ROW SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'audit_log is append-only';
+
+CREATE TRIGGER audit_log_no_delete
+  BEFORE DELETE ON audit_log
+  FOR EACH ROW SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'audit_log is append-only';
@@ -0,0 +1,28 @@
+-- Events announcing changes of users, appended in the transaction making
+-- the change and removed once relayed. user_id has no foreign key on
+-- purpose: the events of a purged user must still be relayed
+CREATE TABLE IF NOT EXISTS outbox (
+  seq BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+  id CHAR(36) NOT NULL,
+  type VARCHAR(32) NOT NULL,
+  user_id CHAR(36) NOT NULL,
+  -- JSON columns reject the binary strings payloads are sent as
+  payload LONGTEXT NOT NULL,
+  -- stored in UTC
+  occurred_at DATETIME(6) NOT NULL,
+  attempts INT NOT NULL DEFAULT 0,
+  available_at DATETIME(6) NOT NULL,
+  last_error TEXT,
+  UNIQUE KEY outbox_id_key (id),
+  KEY outbox_user_id_idx (user_id, seq),
+  KEY outbox_available_at_idx (available_at)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4 COLLATE = utf8mb4_bin;
+
+-- Its single row tells which instance relays events, and until when
+CREATE TABLE IF NOT EXISTS outbox_lease (
+  name VARCHAR(32) NOT NULL PRIMARY KEY,
+  holder VARCHAR(64) NOT NULL DEFAULT '',
+  expires_at DATETIME(6) NOT NULL DEFAULT '1000-01-01 00:00:00'
+) ENGINE = InnoDB;
+
+INSERT IGNORE INTO outbox_lease (name) VALUES ('dispatcher');
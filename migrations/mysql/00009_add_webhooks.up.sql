@@ -0,0 +1,43 @@
+-- Endpoints of partner systems the events announcing changes of users are
+-- delivered to, signed with their secret
+CREATE TABLE IF NOT EXISTS webhooks (
+  id CHAR(36) NOT NULL PRIMARY KEY,
+  url VARCHAR(2048) NOT NULL,
+  -- comma separated event types
+  events VARCHAR(255) NOT NULL,
+  secret VARCHAR(255) NOT NULL,
+  active BOOLEAN NOT NULL,
+  disabled_reason VARCHAR(255) NOT NULL,
+  failures INT NOT NULL DEFAULT 0,
+  -- stored in UTC
+  created_at DATETIME(6) NOT NULL,
+  updated_at DATETIME(6) NOT NULL
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4 COLLATE = utf8mb4_bin;
+
+-- Every delivery of an event to a webhook, and the outcome of its last
+-- attempt. payload is kept byte for byte as it is signed and sent
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+  id CHAR(36) NOT NULL PRIMARY KEY,
+  webhook_id CHAR(36) NOT NULL,
+  event_id CHAR(36) NOT NULL,
+  event_type VARCHAR(32) NOT NULL,
+  redelivery_of CHAR(36),
+  payload LONGTEXT NOT NULL,
+  status VARCHAR(16) NOT NULL,
+  attempts INT NOT NULL DEFAULT 0,
+  response_code INT,
+  last_error TEXT NOT NULL,
+  next_attempt_at DATETIME(6) NOT NULL,
+  claimed_until DATETIME(6),
+  created_at DATETIME(6) NOT NULL,
+  delivered_at DATETIME(6),
+  -- the event of first deliveries only: MySQL has no partial indexes, and
+  -- unique indexes allow any number of NULLs
+  first_event_id CHAR(36) AS (CASE WHEN redelivery_of IS NULL THEN event_id END) STORED,
+  KEY webhook_deliveries_webhook_id_idx (webhook_id, created_at),
+  KEY webhook_deliveries_event_id_idx (event_id),
+  KEY webhook_deliveries_due_idx (status, next_attempt_at),
+  -- an event is delivered once to a webhook, unless asked to again
+  UNIQUE KEY webhook_deliveries_first_idx (webhook_id, first_event_id),
+  CONSTRAINT webhook_deliveries_webhook_id_fkey FOREIGN KEY (webhook_id) REFERENCES webhooks (id) ON DELETE CASCADE
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4 COLLATE = utf8mb4_bin;
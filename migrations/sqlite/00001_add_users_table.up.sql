@@ -0,0 +1,9 @@
+-- SQLite has no uuid type, ids are stored as text and generated by the application
+CREATE TABLE IF NOT EXISTS users (
+  id TEXT PRIMARY KEY,
+  name TEXT NOT NULL,
+  email TEXT NOT NULL UNIQUE,
+  cpf TEXT NOT NULL UNIQUE,
+  -- stored as YYYY-MM-DD text, so dates compare as text
+  birthdate DATE NOT NULL
+);
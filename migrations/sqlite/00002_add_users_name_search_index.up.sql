@@ -0,0 +1,4 @@
+-- Names are matched with fold(), which the application registers on every
+-- connection. There are no trigram indexes in SQLite, so name searches scan
+-- the table, which is fine at the sizes SQLite is used for.
+SELECT 1;
@@ -0,0 +1,4 @@
+-- The pt_br collation is registered by the application on every connection,
+-- so unlike in Postgres it is not used in indexes: the database must remain
+-- readable by tools that don't know it.
+CREATE INDEX IF NOT EXISTS users_birthdate_idx ON users (birthdate, id);
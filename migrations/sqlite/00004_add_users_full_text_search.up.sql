@@ -0,0 +1,4 @@
+-- SQLite has no Portuguese stemming. Searches match every word as a prefix
+-- of the words of names and e-mails, ignoring case and accents, and are
+-- ranked by the application.
+SELECT 1;
@@ -0,0 +1,18 @@
+-- Fails while a deleted user shares an e-mail or cpf with an active one;
+-- purge or rename those users first
+CREATE TABLE users_old (
+  id TEXT PRIMARY KEY,
+  name TEXT NOT NULL,
+  email TEXT NOT NULL UNIQUE,
+  cpf TEXT NOT NULL UNIQUE,
+  birthdate DATE NOT NULL
+);
+
+INSERT INTO users_old (id, name, email, cpf, birthdate)
+  SELECT id, name, email, cpf, birthdate FROM users;
+
+DROP TABLE users;
+
+ALTER TABLE users_old RENAME TO users;
+
+CREATE INDEX IF NOT EXISTS users_birthdate_idx ON users (birthdate, id);
@@ -0,0 +1,23 @@
+-- Deleted users are kept around until purged, so they can be restored.
+-- Only active users must be unique, so a deleted user does not block
+-- someone registering again with the same e-mail or cpf. SQLite can't drop
+-- constraints, so the table is rebuilt without them.
+CREATE TABLE users_new (
+  id TEXT PRIMARY KEY,
+  name TEXT NOT NULL,
+  email TEXT NOT NULL,
+  cpf TEXT NOT NULL,
+  birthdate DATE NOT NULL,
+  deleted_at TIMESTAMP
+);
+
+INSERT INTO users_new (id, name, email, cpf, birthdate)
+  SELECT id, name, email, cpf, birthdate FROM users;
+
+DROP TABLE users;
+
+ALTER TABLE users_new RENAME TO users;
+
+CREATE INDEX IF NOT EXISTS users_birthdate_idx ON users (birthdate, id);
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_key ON users (email) WHERE deleted_at IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS users_cpf_key ON users (cpf) WHERE deleted_at IS NULL;
@@ -0,0 +1,13 @@
+-- Version of each user, used for optimistic concurrency control
+ALTER TABLE users ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+
+-- Every change to a user bumps its version, so a client holding an older
+-- version can't overwrite it by accident, whatever query changed the row.
+-- RETURNING does not see changes made by triggers, so the application's
+-- queries bump the version themselves, and this only catches the rest.
+CREATE TRIGGER IF NOT EXISTS users_bump_version
+  AFTER UPDATE OF name, email, cpf, birthdate, deleted_at ON users
+  FOR EACH ROW WHEN NEW.version = OLD.version
+BEGIN
+  UPDATE users SET version = OLD.version + 1 WHERE id = NEW.id;
+END;
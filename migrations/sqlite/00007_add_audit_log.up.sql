@@ -0,0 +1,31 @@
+-- Append-only log of every change made to users. user_id has no foreign
+-- key on purpose: the history of a purged user must outlive the user
+CREATE TABLE IF NOT EXISTS audit_log (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id TEXT NOT NULL,
+  actor TEXT NOT NULL,
+  request_id TEXT NOT NULL,
+  action TEXT NOT NULL,
+  changes TEXT NOT NULL,
+  -- stored as UTC text, so timestamps compare as text
+  created_at TIMESTAMP NOT NULL,
+  prev_hash TEXT NOT NULL,
+  hash TEXT NOT NULL UNIQUE
+);
+
+CREATE INDEX IF NOT EXISTS audit_log_user_id_idx ON audit_log (user_id, id);
+CREATE INDEX IF NOT EXISTS audit_log_actor_idx ON audit_log (actor, id);
+CREATE INDEX IF NOT EXISTS audit_log_created_at_idx ON audit_log (created_at, id);
+
+-- Entries can never be changed or removed, not even by the application
+CREATE TRIGGER IF NOT EXISTS audit_log_no_update
+  BEFORE UPDATE ON audit_log
+BEGIN
+  SELECT RAISE(ABORT, 'audit_log is append-only');
+END;
+
+CREATE TRIGGER IF NOT EXISTS audit_log_no_delete
+  BEFORE DELETE ON audit_log
+BEGIN
+  SELECT RAISE(ABORT, 'audit_log is append-only');
+END;
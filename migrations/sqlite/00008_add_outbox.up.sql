@@ -0,0 +1,27 @@
+-- Events announcing changes of users, appended in the transaction making
+-- the change and removed once relayed. user_id has no foreign key on
+-- purpose: the events of a purged user must still be relayed
+CREATE TABLE IF NOT EXISTS outbox (
+  seq INTEGER PRIMARY KEY AUTOINCREMENT,
+  id TEXT NOT NULL UNIQUE,
+  type TEXT NOT NULL,
+  user_id TEXT NOT NULL,
+  payload TEXT NOT NULL,
+  -- stored as UTC text, so timestamps compare as text
+  occurred_at TIMESTAMP NOT NULL,
+  attempts INTEGER NOT NULL DEFAULT 0,
+  available_at TIMESTAMP NOT NULL,
+  last_error TEXT
+);
+
+CREATE INDEX IF NOT EXISTS outbox_user_id_idx ON outbox (user_id, seq);
+CREATE INDEX IF NOT EXISTS outbox_available_at_idx ON outbox (available_at);
+
+-- Its single row tells which instance relays events, and until when
+CREATE TABLE IF NOT EXISTS outbox_lease (
+  name TEXT PRIMARY KEY,
+  holder TEXT NOT NULL DEFAULT '',
+  expires_at TIMESTAMP NOT NULL DEFAULT ''
+);
+
+INSERT OR IGNORE INTO outbox_lease (name) VALUES ('dispatcher');
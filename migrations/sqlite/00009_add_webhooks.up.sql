@@ -0,0 +1,40 @@
+-- Endpoints of partner systems the events announcing changes of users are
+-- delivered to, signed with their secret
+CREATE TABLE IF NOT EXISTS webhooks (
+  id TEXT PRIMARY KEY,
+  url TEXT NOT NULL,
+  -- comma separated event types
+  events TEXT NOT NULL,
+  secret TEXT NOT NULL,
+  active BOOLEAN NOT NULL,
+  disabled_reason TEXT NOT NULL,
+  failures INTEGER NOT NULL DEFAULT 0,
+  -- stored as UTC text, so timestamps compare as text
+  created_at TIMESTAMP NOT NULL,
+  updated_at TIMESTAMP NOT NULL
+);
+
+-- Every delivery of an event to a webhook, and the outcome of its last
+-- attempt. payload is kept byte for byte as it is signed and sent
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+  id TEXT PRIMARY KEY,
+  webhook_id TEXT NOT NULL REFERENCES webhooks (id) ON DELETE CASCADE,
+  event_id TEXT NOT NULL,
+  event_type TEXT NOT NULL,
+  redelivery_of TEXT,
+  payload TEXT NOT NULL,
+  status TEXT NOT NULL,
+  attempts INTEGER NOT NULL DEFAULT 0,
+  response_code INTEGER,
+  last_error TEXT NOT NULL,
+  next_attempt_at TIMESTAMP NOT NULL,
+  claimed_until TIMESTAMP,
+  created_at TIMESTAMP NOT NULL,
+  delivered_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS webhook_deliveries_webhook_id_idx ON webhook_deliveries (webhook_id, created_at);
+CREATE INDEX IF NOT EXISTS webhook_deliveries_event_id_idx ON webhook_deliveries (event_id);
+-- an event is delivered once to a webhook, unless asked to again
+CREATE UNIQUE INDEX IF NOT EXISTS webhook_deliveries_first_idx ON webhook_deliveries (webhook_id, event_id) WHERE redelivery_of IS NULL;
+CREATE INDEX IF NOT EXISTS webhook_deliveries_due_idx ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
@@ -0,0 +1,58 @@
+package mocks
+
+import (
+	"context"
+
+	model "github.com/klasrak/users-api/models"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockAuditRepository is a mock type for service.AuditRepository interface
+type MockAuditRepository struct {
+	mock.Mock
+}
+
+// Append is a mock for AuditRepository Append
+func (m *MockAuditRepository) Append(ctx context.Context, e *model.AuditEntry) error {
+	ret := m.Called(ctx, e)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
+
+// AppendAll is a mock for AuditRepository AppendAll
+func (m *MockAuditRepository) AppendAll(ctx context.Context, entries []*model.AuditEntry) error {
+	ret := m.Called(ctx, entries)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
+
+// List is a mock for AuditRepository List
+func (m *MockAuditRepository) List(ctx context.Context, params model.AuditListParams) ([]model.AuditEntry, error) {
+	ret := m.Called(ctx, params)
+
+	var r0 []model.AuditEntry
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).([]model.AuditEntry)
+	}
+
+	var r1 error
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return r0, r1
+}
@@ -0,0 +1,51 @@
+package mocks
+
+import (
+	"context"
+
+	model "github.com/klasrak/users-api/models"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockAuditService is a mock type for handlers.AuditService interface
+type MockAuditService struct {
+	mock.Mock
+}
+
+// List is a mock for AuditService List
+func (m *MockAuditService) List(ctx context.Context, params model.AuditListParams) (*model.AuditPage, error) {
+	ret := m.Called(ctx, params)
+
+	var r0 *model.AuditPage
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*model.AuditPage)
+	}
+
+	var r1 error
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return r0, r1
+}
+
+// Verify is a mock for AuditService Verify
+func (m *MockAuditService) Verify(ctx context.Context) (*model.AuditVerification, error) {
+	ret := m.Called(ctx)
+
+	var r0 *model.AuditVerification
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*model.AuditVerification)
+	}
+
+	var r1 error
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return r0, r1
+}
@@ -0,0 +1,26 @@
+package mocks
+
+import (
+	"context"
+
+	model "github.com/klasrak/users-api/models"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockEventPublisher is a mock type for service.EventPublisher interface
+type MockEventPublisher struct {
+	mock.Mock
+}
+
+// Publish is a mock for EventPublisher Publish
+func (m *MockEventPublisher) Publish(ctx context.Context, e *model.Event) error {
+	ret := m.Called(ctx, e)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
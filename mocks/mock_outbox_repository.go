@@ -0,0 +1,98 @@
+package mocks
+
+import (
+	"context"
+	"time"
+
+	model "github.com/klasrak/users-api/models"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockOutboxRepository is a mock type for service.OutboxRepository interface
+type MockOutboxRepository struct {
+	mock.Mock
+}
+
+// Append is a mock for OutboxRepository Append
+func (m *MockOutboxRepository) Append(ctx context.Context, events []*model.Event) error {
+	ret := m.Called(ctx, events)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
+
+// Lease is a mock for OutboxRepository Lease
+func (m *MockOutboxRepository) Lease(ctx context.Context, holder string, now, until time.Time) (bool, error) {
+	ret := m.Called(ctx, holder, now, until)
+
+	var r1 error
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return ret.Bool(0), r1
+}
+
+// Release is a mock for OutboxRepository Release
+func (m *MockOutboxRepository) Release(ctx context.Context, holder string) error {
+	ret := m.Called(ctx, holder)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
+
+// Pending is a mock for OutboxRepository Pending
+func (m *MockOutboxRepository) Pending(ctx context.Context, now time.Time, limit int) ([]*model.Event, error) {
+	ret := m.Called(ctx, now, limit)
+
+	var r0 []*model.Event
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).([]*model.Event)
+	}
+
+	var r1 error
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return r0, r1
+}
+
+// Delivered is a mock for OutboxRepository Delivered
+func (m *MockOutboxRepository) Delivered(ctx context.Context, e *model.Event) error {
+	ret := m.Called(ctx, e)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
+
+// Retry is a mock for OutboxRepository Retry
+func (m *MockOutboxRepository) Retry(ctx context.Context, e *model.Event, at time.Time, reason string) error {
+	ret := m.Called(ctx, e, at, reason)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
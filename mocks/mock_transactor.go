@@ -0,0 +1,19 @@
+package mocks
+
+import (
+	"context"
+)
+
+// MockTransactor is a stand-in for service.Transactor interface that runs the
+// given function right away, without a transaction
+type MockTransactor struct{}
+
+// WithinTx runs fn with ctx
+func (m *MockTransactor) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+// WithinSnapshot runs fn with ctx
+func (m *MockTransactor) WithinSnapshot(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
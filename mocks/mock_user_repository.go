@@ -14,13 +14,54 @@ type MockUserRepository struct {
 }
 
 // GetAll is a mock for UserRepository GetAll
-func (m *MockUserRepository) GetAll(ctx context.Context, name string) ([]model.User, error) {
-	ret := m.Called(ctx, name)
+func (m *MockUserRepository) GetAll(ctx context.Context, params model.UserListParams) (*model.UserPage, error) {
+	ret := m.Called(ctx, params)
 
-	var r0 []model.User
+	var r0 *model.UserPage
 
 	if ret.Get(0) != nil {
-		r0 = ret.Get(0).([]model.User)
+		r0 = ret.Get(0).(*model.UserPage)
+	}
+
+	var r1 error
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return r0, r1
+}
+
+// Stream is a mock for UserRepository Stream. Users returned by the mock are
+// handed to fn before returning the error
+func (m *MockUserRepository) Stream(ctx context.Context, params model.UserListParams, fn func(u *model.User) error) error {
+	ret := m.Called(ctx, params, fn)
+
+	if users, ok := ret.Get(0).([]model.User); ok {
+		for i := range users {
+			if err := fn(&users[i]); err != nil {
+				return err
+			}
+		}
+	}
+
+	var r1 error
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return r1
+}
+
+// Search is a mock for UserRepository Search
+func (m *MockUserRepository) Search(ctx context.Context, q string, limit int) ([]model.UserSearchResult, error) {
+	ret := m.Called(ctx, q, limit)
+
+	var r0 []model.UserSearchResult
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).([]model.UserSearchResult)
 	}
 
 	var r1 error
@@ -33,7 +74,26 @@ func (m *MockUserRepository) GetAll(ctx context.Context, name string) ([]model.U
 }
 
 // GetByID is a mock for UserRepository GetByID
-func (m *MockUserRepository) GetByID(ctx context.Context, id uuid.UUID) (*model.User, error) {
+func (m *MockUserRepository) GetByID(ctx context.Context, id uuid.UUID, includeDeleted bool) (*model.User, error) {
+	ret := m.Called(ctx, id, includeDeleted)
+
+	var r0 *model.User
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*model.User)
+	}
+
+	var r1 error
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return r0, r1
+}
+
+// Lock is a mock for UserRepository Lock
+func (m *MockUserRepository) Lock(ctx context.Context, id uuid.UUID) (*model.User, error) {
 	ret := m.Called(ctx, id)
 
 	var r0 *model.User
@@ -101,3 +161,67 @@ func (m *MockUserRepository) Delete(ctx context.Context, id string) error {
 
 	return r0
 }
+
+// Restore is a mock for UserRepository Restore
+func (m *MockUserRepository) Restore(ctx context.Context, id string) (*model.User, error) {
+	ret := m.Called(ctx, id)
+
+	var r0 *model.User
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*model.User)
+	}
+
+	var r1 error
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return r0, r1
+}
+
+// Purge is a mock for UserRepository Purge
+func (m *MockUserRepository) Purge(ctx context.Context, id string) error {
+	ret := m.Called(ctx, id)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
+
+// FindTaken is a mock for UserRepository FindTaken
+func (m *MockUserRepository) FindTaken(ctx context.Context, emails, cpfs []string) ([]model.User, error) {
+	ret := m.Called(ctx, emails, cpfs)
+
+	var r0 []model.User
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).([]model.User)
+	}
+
+	var r1 error
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return r0, r1
+}
+
+// CopyIn is a mock for UserRepository CopyIn
+func (m *MockUserRepository) CopyIn(ctx context.Context, users []*model.User) error {
+	ret := m.Called(ctx, users)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
@@ -2,6 +2,7 @@ package mocks
 
 import (
 	"context"
+	"time"
 
 	model "github.com/klasrak/users-api/models"
 	"github.com/stretchr/testify/mock"
@@ -12,13 +13,54 @@ type MockUserService struct {
 }
 
 // GetAll is a mock for UserService GetAll
-func (m *MockUserService) GetAll(ctx context.Context, name string) ([]model.User, error) {
-	ret := m.Called(ctx, name)
+func (m *MockUserService) GetAll(ctx context.Context, params model.UserListParams) (*model.UserPage, error) {
+	ret := m.Called(ctx, params)
 
-	var r0 []model.User
+	var r0 *model.UserPage
 
 	if ret.Get(0) != nil {
-		r0 = ret.Get(0).([]model.User)
+		r0 = ret.Get(0).(*model.UserPage)
+	}
+
+	var r1 error
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return r0, r1
+}
+
+// Export is a mock for UserService Export. Users returned by the mock are
+// handed to fn before returning the error
+func (m *MockUserService) Export(ctx context.Context, params model.UserListParams, fn func(u *model.User) error) error {
+	ret := m.Called(ctx, params, fn)
+
+	if users, ok := ret.Get(0).([]model.User); ok {
+		for i := range users {
+			if err := fn(&users[i]); err != nil {
+				return err
+			}
+		}
+	}
+
+	var r1 error
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return r1
+}
+
+// Search is a mock for UserService Search
+func (m *MockUserService) Search(ctx context.Context, q string, limit int) ([]model.UserSearchResult, error) {
+	ret := m.Called(ctx, q, limit)
+
+	var r0 []model.UserSearchResult
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).([]model.UserSearchResult)
 	}
 
 	var r1 error
@@ -31,8 +73,8 @@ func (m *MockUserService) GetAll(ctx context.Context, name string) ([]model.User
 }
 
 // GetByID is a mock for UserService GetByID
-func (m *MockUserService) GetByID(ctx context.Context, id string) (*model.User, error) {
-	ret := m.Called(ctx, id)
+func (m *MockUserService) GetByID(ctx context.Context, id string, includeDeleted bool) (*model.User, error) {
+	ret := m.Called(ctx, id, includeDeleted)
 
 	var r0 *model.User
 
@@ -49,6 +91,44 @@ func (m *MockUserService) GetByID(ctx context.Context, id string) (*model.User,
 	return r0, r1
 }
 
+// GetAsOf is a mock for UserService GetAsOf
+func (m *MockUserService) GetAsOf(ctx context.Context, id string, at time.Time, includeDeleted bool) (*model.User, error) {
+	ret := m.Called(ctx, id, at, includeDeleted)
+
+	var r0 *model.User
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*model.User)
+	}
+
+	var r1 error
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return r0, r1
+}
+
+// History is a mock for UserService History
+func (m *MockUserService) History(ctx context.Context, id string) (*model.UserHistory, error) {
+	ret := m.Called(ctx, id)
+
+	var r0 *model.UserHistory
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*model.UserHistory)
+	}
+
+	var r1 error
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return r0, r1
+}
+
 // Create is a mock for UserService Create
 func (m *MockUserService) Create(ctx context.Context, u *model.User) (*model.User, error) {
 	ret := m.Called(ctx, u)
@@ -68,9 +148,47 @@ func (m *MockUserService) Create(ctx context.Context, u *model.User) (*model.Use
 	return r0, r1
 }
 
+// CreateBatch is a mock for UserService CreateBatch
+func (m *MockUserService) CreateBatch(ctx context.Context, users []*model.User, atomic bool) (*model.BatchResults, error) {
+	ret := m.Called(ctx, users, atomic)
+
+	var r0 *model.BatchResults
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*model.BatchResults)
+	}
+
+	var r1 error
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return r0, r1
+}
+
+// Import is a mock for UserService Import
+func (m *MockUserService) Import(ctx context.Context, rows []model.ImportRow) (*model.ImportReport, error) {
+	ret := m.Called(ctx, rows)
+
+	var r0 *model.ImportReport
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*model.ImportReport)
+	}
+
+	var r1 error
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return r0, r1
+}
+
 // Update is a mock for UserService Update
-func (m *MockUserService) Update(ctx context.Context, id string, u *model.User) (*model.User, error) {
-	ret := m.Called(ctx, id, u)
+func (m *MockUserService) Update(ctx context.Context, id string, u *model.User, version int) (*model.User, error) {
+	ret := m.Called(ctx, id, u, version)
 
 	var r0 *model.User
 
@@ -87,6 +205,44 @@ func (m *MockUserService) Update(ctx context.Context, id string, u *model.User)
 	return r0, r1
 }
 
+// Patch is a mock for UserService Patch
+func (m *MockUserService) Patch(ctx context.Context, id string, patch *model.UserPatch, version int) (*model.User, error) {
+	ret := m.Called(ctx, id, patch, version)
+
+	var r0 *model.User
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*model.User)
+	}
+
+	var r1 error
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return r0, r1
+}
+
+// UpdateBatch is a mock for UserService UpdateBatch
+func (m *MockUserService) UpdateBatch(ctx context.Context, sel model.BatchSelector, patch *model.UserPatch, dryRun bool) (*model.BatchResults, error) {
+	ret := m.Called(ctx, sel, patch, dryRun)
+
+	var r0 *model.BatchResults
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*model.BatchResults)
+	}
+
+	var r1 error
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return r0, r1
+}
+
 // Delete is a mock for UserService Delete
 func (m *MockUserService) Delete(ctx context.Context, id string) error {
 	ret := m.Called(ctx, id)
@@ -99,3 +255,54 @@ func (m *MockUserService) Delete(ctx context.Context, id string) error {
 
 	return r0
 }
+
+// DeleteBatch is a mock for UserService DeleteBatch
+func (m *MockUserService) DeleteBatch(ctx context.Context, sel model.BatchSelector, dryRun bool) (*model.BatchResults, error) {
+	ret := m.Called(ctx, sel, dryRun)
+
+	var r0 *model.BatchResults
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*model.BatchResults)
+	}
+
+	var r1 error
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return r0, r1
+}
+
+// Restore is a mock for UserService Restore
+func (m *MockUserService) Restore(ctx context.Context, id string) (*model.User, error) {
+	ret := m.Called(ctx, id)
+
+	var r0 *model.User
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*model.User)
+	}
+
+	var r1 error
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return r0, r1
+}
+
+// Purge is a mock for UserService Purge
+func (m *MockUserService) Purge(ctx context.Context, id string) error {
+	ret := m.Called(ctx, id)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
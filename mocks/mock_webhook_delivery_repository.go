@@ -0,0 +1,111 @@
+package mocks
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	model "github.com/klasrak/users-api/models"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockWebhookDeliveryRepository is a mock type for service.WebhookDeliveryRepository interface
+type MockWebhookDeliveryRepository struct {
+	mock.Mock
+}
+
+// Enqueue is a mock for WebhookDeliveryRepository Enqueue
+func (m *MockWebhookDeliveryRepository) Enqueue(ctx context.Context, deliveries []*model.WebhookDelivery) error {
+	ret := m.Called(ctx, deliveries)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
+
+// List is a mock for WebhookDeliveryRepository List
+func (m *MockWebhookDeliveryRepository) List(ctx context.Context, params model.WebhookDeliveryListParams) ([]model.WebhookDelivery, error) {
+	ret := m.Called(ctx, params)
+
+	var r0 []model.WebhookDelivery
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).([]model.WebhookDelivery)
+	}
+
+	var r1 error
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return r0, r1
+}
+
+// GetByID is a mock for WebhookDeliveryRepository GetByID
+func (m *MockWebhookDeliveryRepository) GetByID(ctx context.Context, webhookID, id uuid.UUID) (*model.WebhookDelivery, error) {
+	ret := m.Called(ctx, webhookID, id)
+
+	var r0 *model.WebhookDelivery
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*model.WebhookDelivery)
+	}
+
+	var r1 error
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return r0, r1
+}
+
+// Due is a mock for WebhookDeliveryRepository Due
+func (m *MockWebhookDeliveryRepository) Due(ctx context.Context, now time.Time, limit int) ([]*model.WebhookDelivery, error) {
+	ret := m.Called(ctx, now, limit)
+
+	var r0 []*model.WebhookDelivery
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).([]*model.WebhookDelivery)
+	}
+
+	var r1 error
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return r0, r1
+}
+
+// Claim is a mock for WebhookDeliveryRepository Claim
+func (m *MockWebhookDeliveryRepository) Claim(ctx context.Context, d *model.WebhookDelivery, now, until time.Time) (bool, error) {
+	ret := m.Called(ctx, d, now, until)
+
+	var r1 error
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return ret.Bool(0), r1
+}
+
+// Save is a mock for WebhookDeliveryRepository Save
+func (m *MockWebhookDeliveryRepository) Save(ctx context.Context, d *model.WebhookDelivery) error {
+	ret := m.Called(ctx, d)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
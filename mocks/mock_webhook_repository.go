@@ -0,0 +1,117 @@
+package mocks
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	model "github.com/klasrak/users-api/models"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockWebhookRepository is a mock type for service.WebhookRepository interface
+type MockWebhookRepository struct {
+	mock.Mock
+}
+
+// List is a mock for WebhookRepository List
+func (m *MockWebhookRepository) List(ctx context.Context) ([]model.Webhook, error) {
+	ret := m.Called(ctx)
+
+	var r0 []model.Webhook
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).([]model.Webhook)
+	}
+
+	var r1 error
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return r0, r1
+}
+
+// GetByID is a mock for WebhookRepository GetByID
+func (m *MockWebhookRepository) GetByID(ctx context.Context, id uuid.UUID) (*model.Webhook, error) {
+	ret := m.Called(ctx, id)
+
+	var r0 *model.Webhook
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*model.Webhook)
+	}
+
+	var r1 error
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return r0, r1
+}
+
+// Create is a mock for WebhookRepository Create
+func (m *MockWebhookRepository) Create(ctx context.Context, w *model.Webhook) error {
+	ret := m.Called(ctx, w)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
+
+// Update is a mock for WebhookRepository Update
+func (m *MockWebhookRepository) Update(ctx context.Context, w *model.Webhook) error {
+	ret := m.Called(ctx, w)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
+
+// Delete is a mock for WebhookRepository Delete
+func (m *MockWebhookRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	ret := m.Called(ctx, id)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
+
+// Succeeded is a mock for WebhookRepository Succeeded
+func (m *MockWebhookRepository) Succeeded(ctx context.Context, id uuid.UUID) error {
+	ret := m.Called(ctx, id)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
+
+// Failed is a mock for WebhookRepository Failed
+func (m *MockWebhookRepository) Failed(ctx context.Context, id uuid.UUID, maxFailures int, reason string) (bool, error) {
+	ret := m.Called(ctx, id, maxFailures, reason)
+
+	var r1 error
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return ret.Bool(0), r1
+}
@@ -0,0 +1,140 @@
+package mocks
+
+import (
+	"context"
+
+	model "github.com/klasrak/users-api/models"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockWebhookService is a mock type for handlers.WebhookService interface
+type MockWebhookService struct {
+	mock.Mock
+}
+
+// List is a mock for WebhookService List
+func (m *MockWebhookService) List(ctx context.Context) ([]model.Webhook, error) {
+	ret := m.Called(ctx)
+
+	var r0 []model.Webhook
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).([]model.Webhook)
+	}
+
+	var r1 error
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return r0, r1
+}
+
+// GetByID is a mock for WebhookService GetByID
+func (m *MockWebhookService) GetByID(ctx context.Context, id string) (*model.Webhook, error) {
+	ret := m.Called(ctx, id)
+
+	var r0 *model.Webhook
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*model.Webhook)
+	}
+
+	var r1 error
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return r0, r1
+}
+
+// Create is a mock for WebhookService Create
+func (m *MockWebhookService) Create(ctx context.Context, params *model.WebhookParams) (*model.Webhook, error) {
+	ret := m.Called(ctx, params)
+
+	var r0 *model.Webhook
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*model.Webhook)
+	}
+
+	var r1 error
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return r0, r1
+}
+
+// Update is a mock for WebhookService Update
+func (m *MockWebhookService) Update(ctx context.Context, id string, params *model.WebhookParams) (*model.Webhook, error) {
+	ret := m.Called(ctx, id, params)
+
+	var r0 *model.Webhook
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*model.Webhook)
+	}
+
+	var r1 error
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return r0, r1
+}
+
+// Delete is a mock for WebhookService Delete
+func (m *MockWebhookService) Delete(ctx context.Context, id string) error {
+	ret := m.Called(ctx, id)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
+
+// Deliveries is a mock for WebhookService Deliveries
+func (m *MockWebhookService) Deliveries(ctx context.Context, id string, params model.WebhookDeliveryListParams) (*model.WebhookDeliveryPage, error) {
+	ret := m.Called(ctx, id, params)
+
+	var r0 *model.WebhookDeliveryPage
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*model.WebhookDeliveryPage)
+	}
+
+	var r1 error
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return r0, r1
+}
+
+// Redeliver is a mock for WebhookService Redeliver
+func (m *MockWebhookService) Redeliver(ctx context.Context, id, deliveryID string) (*model.WebhookDelivery, error) {
+	ret := m.Called(ctx, id, deliveryID)
+
+	var r0 *model.WebhookDelivery
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*model.WebhookDelivery)
+	}
+
+	var r1 error
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return r0, r1
+}
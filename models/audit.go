@@ -0,0 +1,196 @@
+package model
+
+import (
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AuditAction names a kind of change made to a user
+type AuditAction string
+
+// Set of audited actions
+const (
+	AuditCreate  AuditAction = "create"
+	AuditUpdate  AuditAction = "update"
+	AuditDelete  AuditAction = "delete"
+	AuditRestore AuditAction = "restore"
+	AuditPurge   AuditAction = "purge"
+)
+
+// AuditGenesisHash is the previous hash of the first entry of the audit log
+var AuditGenesisHash = strings.Repeat("0", 64)
+
+// AuditEntry records a single change made to a user: who made it, within
+// which request, and the value of every changed field before and after it.
+// Entries are chained by hash, so changing or removing any of them breaks
+// the hash of every entry that follows
+type AuditEntry struct {
+	ID        int64        `db:"id" json:"id"`
+	UserID    uuid.UUID    `db:"user_id" json:"user_id"`
+	Actor     string       `db:"actor" json:"actor"`
+	RequestID string       `db:"request_id" json:"request_id"`
+	Action    AuditAction  `db:"action" json:"action"`
+	Changes   AuditChanges `db:"changes" json:"changes"`
+	CreatedAt time.Time    `db:"created_at" json:"created_at"`
+	PrevHash  string       `db:"prev_hash" json:"prev_hash"`
+	Hash      string       `db:"hash" json:"hash"`
+}
+
+// ComputeHash returns the hash of the entry, covering every field but ID and
+// Hash itself. PrevHash must already be set
+func (e *AuditEntry) ComputeHash() string {
+	// struct fields are marshaled in order and map keys sorted, so the
+	// payload of an entry is always the same
+	payload, _ := json.Marshal(struct {
+		PrevHash  string       `json:"prev_hash"`
+		UserID    uuid.UUID    `json:"user_id"`
+		Actor     string       `json:"actor"`
+		RequestID string       `json:"request_id"`
+		Action    AuditAction  `json:"action"`
+		Changes   AuditChanges `json:"changes"`
+		CreatedAt string       `json:"created_at"`
+	}{
+		PrevHash:  e.PrevHash,
+		UserID:    e.UserID,
+		Actor:     e.Actor,
+		RequestID: e.RequestID,
+		Action:    e.Action,
+		Changes:   e.Changes,
+		CreatedAt: e.CreatedAt.UTC().Format(time.RFC3339Nano),
+	})
+
+	sum := sha256.Sum256(payload)
+
+	return hex.EncodeToString(sum[:])
+}
+
+// VerifyAuditChain checks that entries, a contiguous part of the audit log in
+// order, were not tampered with. It reports the first entry that was
+func VerifyAuditChain(entries []AuditEntry) error {
+	for i := range entries {
+		e := &entries[i]
+
+		if i > 0 && e.PrevHash != entries[i-1].Hash {
+			return fmt.Errorf("audit entry %d does not follow entry %d", e.ID, entries[i-1].ID)
+		}
+
+		if e.Hash != e.ComputeHash() {
+			return fmt.Errorf("audit entry %d does not match its hash", e.ID)
+		}
+	}
+
+	return nil
+}
+
+// FieldChange holds the value of a field before and after a change. Absent
+// values (e.g. before a user was created) are null
+type FieldChange struct {
+	Before *string `json:"before"`
+	After  *string `json:"after"`
+}
+
+// AuditChanges maps each changed field to its change. It is stored as JSON
+type AuditChanges map[string]FieldChange
+
+// Value satisfies driver.Valuer
+func (c AuditChanges) Value() (driver.Value, error) {
+	return json.Marshal(c)
+}
+
+// Scan satisfies sql.Scanner
+func (c *AuditChanges) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case []byte:
+		return json.Unmarshal(v, c)
+	case string:
+		return json.Unmarshal([]byte(v), c)
+	case nil:
+		*c = nil
+		return nil
+	default:
+		return errors.New("unsupported audit changes type")
+	}
+}
+
+// DiffUsers returns the fields that differ between two states of a user.
+// before is nil for users being created and after for users being purged
+func DiffUsers(before, after *User) AuditChanges {
+	b, a := auditFields(before), auditFields(after)
+
+	changes := AuditChanges{}
+
+	for _, field := range []string{"name", "email", "cpf", "birthdate", "deleted_at"} {
+		if !equalValues(b[field], a[field]) {
+			changes[field] = FieldChange{Before: b[field], After: a[field]}
+		}
+	}
+
+	return changes
+}
+
+// auditFields returns the audited fields of a user as text
+func auditFields(u *User) map[string]*string {
+	if u == nil {
+		return map[string]*string{}
+	}
+
+	text := func(s string) *string { return &s }
+
+	fields := map[string]*string{
+		"name":      text(u.Name),
+		"email":     text(u.Email),
+		"cpf":       text(u.Cpf),
+		"birthdate": text(u.BirthDate.Format("2006-01-02")),
+	}
+
+	if u.DeletedAt != nil {
+		fields["deleted_at"] = text(u.DeletedAt.UTC().Format(time.RFC3339Nano))
+	}
+
+	return fields
+}
+
+func equalValues(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return *a == *b
+}
+
+// AuditListParams defines the filters accepted by audit log listings. Entries
+// are listed oldest first, starting after the entry with ID After
+type AuditListParams struct {
+	UserID *uuid.UUID
+	Actor  string
+	Since  time.Time
+	After  int64
+	Limit  int
+}
+
+// AuditPage is a single page of an audit log listing
+type AuditPage struct {
+	Data []AuditEntry `json:"data"`
+}
+
+// AuditVerification is the outcome of checking the whole audit log against
+// its hash chain
+type AuditVerification struct {
+	// Valid is false once an entry was found tampered with
+	Valid bool `json:"valid"`
+	// Entries is how many entries were found untouched
+	Entries int `json:"entries"`
+	// LastHash is the hash of the last entry found untouched. Kept
+	// elsewhere, it tells later whether entries were removed from the end
+	LastHash string `json:"last_hash,omitempty"`
+	// Error tells the first entry found tampered with
+	Error string `json:"error,omitempty"`
+}
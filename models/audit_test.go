@@ -0,0 +1,142 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func auditChain(n int) []AuditEntry {
+	entries := make([]AuditEntry, n)
+	prev := AuditGenesisHash
+	email := "joao@mail.com"
+
+	for i := range entries {
+		entries[i] = AuditEntry{
+			ID:        int64(i + 1),
+			UserID:    uuid.MustParse("1f6f8d3c-9a3e-4a8b-8a3e-6f1d9b8c7e5a"),
+			Actor:     "maria",
+			RequestID: "req",
+			Action:    AuditUpdate,
+			Changes:   AuditChanges{"email": {Before: &email, After: &email}},
+			CreatedAt: time.Date(2022, 5, 1, 10, i, 0, 0, time.UTC),
+			PrevHash:  prev,
+		}
+		entries[i].Hash = entries[i].ComputeHash()
+		prev = entries[i].Hash
+	}
+
+	return entries
+}
+
+func TestComputeHash(t *testing.T) {
+	e := auditChain(1)[0]
+
+	assert.Len(t, e.Hash, 64)
+
+	t.Run("Ignores ID and time zone", func(t *testing.T) {
+		other := e
+		other.ID = 42
+		other.CreatedAt = e.CreatedAt.In(time.FixedZone("BRT", -3*60*60))
+
+		assert.Equal(t, e.Hash, other.ComputeHash())
+	})
+
+	t.Run("Covers every recorded field", func(t *testing.T) {
+		for _, change := range []func(e *AuditEntry){
+			func(e *AuditEntry) { e.PrevHash = e.Hash },
+			func(e *AuditEntry) { e.UserID = uuid.New() },
+			func(e *AuditEntry) { e.Actor = "joão" },
+			func(e *AuditEntry) { e.RequestID = "other" },
+			func(e *AuditEntry) { e.Action = AuditDelete },
+			func(e *AuditEntry) { e.Changes = AuditChanges{} },
+			func(e *AuditEntry) { e.CreatedAt = e.CreatedAt.Add(time.Microsecond) },
+		} {
+			other := e
+			change(&other)
+
+			assert.NotEqual(t, e.Hash, other.ComputeHash())
+		}
+	})
+}
+
+func TestVerifyAuditChain(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		assert.NoError(t, VerifyAuditChain(auditChain(3)))
+		assert.NoError(t, VerifyAuditChain(auditChain(3)[1:]))
+		assert.NoError(t, VerifyAuditChain(nil))
+	})
+
+	t.Run("Error tampered entry", func(t *testing.T) {
+		entries := auditChain(3)
+		entries[1].Actor = "mallory"
+
+		assert.EqualError(t, VerifyAuditChain(entries), "audit entry 2 does not match its hash")
+	})
+
+	t.Run("Error removed entry", func(t *testing.T) {
+		entries := auditChain(3)
+		entries = append(entries[:1], entries[2])
+
+		assert.EqualError(t, VerifyAuditChain(entries), "audit entry 3 does not follow entry 1")
+	})
+}
+
+func TestDiffUsers(t *testing.T) {
+	text := func(s string) *string { return &s }
+	deletedAt := time.Date(2022, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	before := &User{Name: "João", Email: "joao@mail.com", Cpf: "313.716.772-80", BirthDate: time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC)}
+
+	t.Run("Created", func(t *testing.T) {
+		assert.Equal(t, AuditChanges{
+			"name":      {After: text("João")},
+			"email":     {After: text("joao@mail.com")},
+			"cpf":       {After: text("313.716.772-80")},
+			"birthdate": {After: text("1990-01-01")},
+		}, DiffUsers(nil, before))
+	})
+
+	t.Run("Updated", func(t *testing.T) {
+		after := *before
+		after.Name = "João Silva"
+		after.Version = 2
+
+		assert.Equal(t, AuditChanges{
+			"name": {Before: text("João"), After: text("João Silva")},
+		}, DiffUsers(before, &after))
+	})
+
+	t.Run("Deleted", func(t *testing.T) {
+		after := *before
+		after.DeletedAt = &deletedAt
+
+		assert.Equal(t, AuditChanges{
+			"deleted_at": {After: text("2022-05-01T10:00:00Z")},
+		}, DiffUsers(before, &after))
+	})
+
+	t.Run("Unchanged", func(t *testing.T) {
+		assert.Empty(t, DiffUsers(before, before))
+	})
+}
+
+func TestAuditChanges(t *testing.T) {
+	text := "joao@mail.com"
+	changes := AuditChanges{"email": {After: &text}}
+
+	value, err := changes.Value()
+	assert.NoError(t, err)
+
+	var scanned AuditChanges
+
+	assert.NoError(t, scanned.Scan(value))
+	assert.Equal(t, changes, scanned)
+
+	assert.NoError(t, scanned.Scan(nil))
+	assert.Nil(t, scanned)
+
+	assert.Error(t, scanned.Scan(42))
+}
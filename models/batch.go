@@ -0,0 +1,76 @@
+package model
+
+import (
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/klasrak/users-api/rerrors"
+)
+
+// BatchResult is the outcome of a single item of a batch request, with the
+// HTTP status it would have had as a request of its own. Changes lists the
+// fields changed in the user (or, in dry runs, that would be changed)
+type BatchResult struct {
+	Index   int            `json:"index"`
+	Status  int            `json:"status"`
+	ID      *uuid.UUID     `json:"id,omitempty"`
+	Changes AuditChanges   `json:"changes,omitempty"`
+	Error   *rerrors.Error `json:"error,omitempty"`
+}
+
+// Succeed records that the item, about the user with the given id, succeeded
+func (r *BatchResult) Succeed(status int, id uuid.UUID) {
+	r.Status = status
+	r.ID = &id
+	r.Error = nil
+}
+
+// Fail records that the item failed with err
+func (r *BatchResult) Fail(err error) {
+	var e *rerrors.Error
+
+	if !errors.As(err, &e) {
+		e = rerrors.NewInternal()
+	}
+
+	r.Status = e.Status()
+	r.ID = nil
+	r.Changes = nil
+	r.Error = e
+}
+
+// Failed reports whether the item failed
+func (r *BatchResult) Failed() bool {
+	return r.Error != nil
+}
+
+// BatchResults lists the outcome of every item of a batch request, in the
+// order they were sent
+type BatchResults struct {
+	DryRun    bool          `json:"dry_run,omitempty"`
+	Succeeded int           `json:"succeeded"`
+	Failed    int           `json:"failed"`
+	Data      []BatchResult `json:"data"`
+}
+
+// NewBatchResults counts the outcomes of a batch request
+func NewBatchResults(results []BatchResult) *BatchResults {
+	r := &BatchResults{Data: results}
+
+	for i := range results {
+		if results[i].Failed() {
+			r.Failed++
+		} else {
+			r.Succeeded++
+		}
+	}
+
+	return r
+}
+
+// BatchSelector picks the users a batch request is about, either by id or
+// with a filter expression, as in user listings. Only one of them is given
+type BatchSelector struct {
+	IDs    []string
+	Filter string
+}
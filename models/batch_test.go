@@ -0,0 +1,50 @@
+package model
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/klasrak/users-api/rerrors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatchResults(t *testing.T) {
+	t.Run("Succeed and Fail", func(t *testing.T) {
+		uid := uuid.New()
+
+		r := BatchResult{Index: 2}
+		r.Succeed(201, uid)
+
+		assert.False(t, r.Failed())
+		assert.Equal(t, 201, r.Status)
+		assert.Equal(t, uid, *r.ID)
+
+		r.Fail(rerrors.NewConflict("user", "created", "unique_violation_email"))
+
+		assert.True(t, r.Failed())
+		assert.Equal(t, 409, r.Status)
+		assert.Nil(t, r.ID)
+	})
+
+	t.Run("Unknown errors are internal", func(t *testing.T) {
+		r := BatchResult{}
+		r.Fail(errors.New("connection reset"))
+
+		assert.Equal(t, 500, r.Status)
+		assert.Equal(t, rerrors.Internal, r.Error.Type)
+	})
+
+	t.Run("Counts outcomes", func(t *testing.T) {
+		results := make([]BatchResult, 3)
+		results[0].Succeed(201, uuid.New())
+		results[1].Fail(rerrors.NewBadRequest("cpf invalid"))
+		results[2].Succeed(201, uuid.New())
+
+		r := NewBatchResults(results)
+
+		assert.Equal(t, 2, r.Succeeded)
+		assert.Equal(t, 1, r.Failed)
+		assert.Len(t, r.Data, 3)
+	})
+}
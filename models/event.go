@@ -0,0 +1,77 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// EventType tells which change of a user an event announces
+type EventType string
+
+// Types of the events announcing changes of users. Restoring a user is
+// announced as an update, and purging one as a deletion, unless it was
+// deleted before
+const (
+	EventUserCreated EventType = "user.created"
+	EventUserUpdated EventType = "user.updated"
+	EventUserDeleted EventType = "user.deleted"
+)
+
+// Event announces a change of a user to other systems. Events are delivered
+// at least once, so consumers must recognize repeated ones by their ID, and
+// events of the same user in the order their changes were made
+type Event struct {
+	// Seq orders the events waiting in the outbox
+	Seq    int64     `db:"seq" json:"-"`
+	ID     uuid.UUID `db:"id" json:"id"`
+	Type   EventType `db:"type" json:"type"`
+	UserID uuid.UUID `db:"user_id" json:"user_id"`
+	// User is the user as the change left it; deleted users as they were
+	// when deleted
+	User       EventUser `db:"payload" json:"user"`
+	OccurredAt time.Time `db:"occurred_at" json:"occurred_at"`
+	// Attempts counts the failed attempts to deliver the event, and
+	// AvailableAt is when it may be attempted again
+	Attempts    int       `db:"attempts" json:"-"`
+	AvailableAt time.Time `db:"available_at" json:"-"`
+}
+
+// NewEvent creates an event of the given type announcing the change that
+// left u as it is
+func NewEvent(t EventType, u *User) *Event {
+	// the database keeps microseconds
+	now := time.Now().UTC().Truncate(time.Microsecond)
+
+	return &Event{
+		ID:          uuid.New(),
+		Type:        t,
+		UserID:      u.UID,
+		User:        EventUser(*u),
+		OccurredAt:  now,
+		AvailableAt: now,
+	}
+}
+
+// EventUser is the user carried by an event, stored as JSON
+type EventUser User
+
+// Value satisfies driver.Valuer
+func (u EventUser) Value() (driver.Value, error) {
+	return json.Marshal(u)
+}
+
+// Scan satisfies sql.Scanner
+func (u *EventUser) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case []byte:
+		return json.Unmarshal(v, u)
+	case string:
+		return json.Unmarshal([]byte(v), u)
+	default:
+		return errors.New("unsupported event user type")
+	}
+}
@@ -0,0 +1,139 @@
+package model
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/klasrak/users-api/rerrors"
+)
+
+// Formats users can be exported in
+const (
+	ExportCSV    = "csv"
+	ExportNDJSON = "ndjson"
+)
+
+// UserWriter writes users one at a time in an export format
+type UserWriter interface {
+	// ContentType is the media type of the export
+	ContentType() string
+	Write(u *User) error
+	// Flush writes any buffered data to the underlying writer
+	Flush() error
+}
+
+// NewUserWriter returns a UserWriter for the given format, writing to w
+func NewUserWriter(w io.Writer, format string) (UserWriter, error) {
+	switch format {
+	case ExportCSV:
+		return &csvUserWriter{w: csv.NewWriter(w)}, nil
+	case ExportNDJSON:
+		return &ndjsonUserWriter{enc: json.NewEncoder(w)}, nil
+	default:
+		return nil, rerrors.NewBadRequest(fmt.Sprintf("format must be %s or %s", ExportCSV, ExportNDJSON))
+	}
+}
+
+// userCSVColumns lists the columns of a CSV export, in order
+var userCSVColumns = []string{"id", "name", "email", "cpf", "birthdate", "deleted_at", "version"}
+
+// csvUserWriter writes users as CSV lines, after a header line naming the
+// columns. Birthdates are written as 2006-01-02, which is what imports read.
+// Names and e-mails are written as csvCell leaves them
+type csvUserWriter struct {
+	w      *csv.Writer
+	header bool
+}
+
+func (cw *csvUserWriter) ContentType() string {
+	return "text/csv; charset=utf-8"
+}
+
+func (cw *csvUserWriter) Write(u *User) error {
+	if err := cw.writeHeader(); err != nil {
+		return err
+	}
+
+	deletedAt := ""
+
+	if u.DeletedAt != nil {
+		deletedAt = u.DeletedAt.UTC().Format(time.RFC3339Nano)
+	}
+
+	return cw.w.Write([]string{
+		u.UID.String(),
+		csvCell(u.Name),
+		csvCell(u.Email),
+		u.Cpf,
+		u.BirthDate.Format("2006-01-02"),
+		deletedAt,
+		strconv.Itoa(u.Version),
+	})
+}
+
+func (cw *csvUserWriter) Flush() error {
+	// empty exports still name their columns
+	if err := cw.writeHeader(); err != nil {
+		return err
+	}
+
+	cw.w.Flush()
+
+	return cw.w.Error()
+}
+
+func (cw *csvUserWriter) writeHeader() error {
+	if cw.header {
+		return nil
+	}
+
+	cw.header = true
+
+	return cw.w.Write(userCSVColumns)
+}
+
+// formulaStarts are the characters spreadsheets read a cell starting with
+// as a formula
+const formulaStarts = "=+-@\t\r"
+
+// csvCell prefixes text starting as a formula with a quote, so spreadsheets
+// opening an export show it instead of running it. Imports drop the quote
+// (see fromCSVCell)
+func csvCell(s string) string {
+	if s != "" && strings.IndexByte(formulaStarts, s[0]) >= 0 {
+		return "'" + s
+	}
+
+	return s
+}
+
+// fromCSVCell undoes csvCell
+func fromCSVCell(s string) string {
+	if len(s) > 1 && s[0] == '\'' && strings.IndexByte(formulaStarts, s[1]) >= 0 {
+		return s[1:]
+	}
+
+	return s
+}
+
+// ndjsonUserWriter writes users as JSON objects, one per line
+type ndjsonUserWriter struct {
+	enc *json.Encoder
+}
+
+func (nw *ndjsonUserWriter) ContentType() string {
+	return "application/x-ndjson"
+}
+
+func (nw *ndjsonUserWriter) Write(u *User) error {
+	return nw.enc.Encode(u)
+}
+
+func (nw *ndjsonUserWriter) Flush() error {
+	return nil
+}
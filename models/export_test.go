@@ -0,0 +1,109 @@
+package model
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/klasrak/users-api/rerrors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserWriter(t *testing.T) {
+	deletedAt := time.Date(2022, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	users := []User{
+		{UID: uuid.MustParse("1f6f8d3c-9a3e-4a8b-8a3e-6f1d9b8c7e5a"), Name: "João", Email: "joao@mail.com", Cpf: "313.716.772-80", BirthDate: time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC), Version: 2},
+		{UID: uuid.MustParse("653565ef-6000-4021-8804-91f3369b3190"), Name: "Silva, Maria", Email: "maria@mail.com", Cpf: "182.345.015-69", BirthDate: time.Date(1987, 6, 21, 0, 0, 0, 0, time.UTC), DeletedAt: &deletedAt, Version: 1},
+	}
+
+	t.Run("CSV", func(t *testing.T) {
+		var buf bytes.Buffer
+
+		uw, err := NewUserWriter(&buf, ExportCSV)
+		assert.NoError(t, err)
+
+		for i := range users {
+			assert.NoError(t, uw.Write(&users[i]))
+		}
+
+		assert.NoError(t, uw.Flush())
+		assert.Equal(t, "text/csv; charset=utf-8", uw.ContentType())
+		assert.Equal(t, "id,name,email,cpf,birthdate,deleted_at,version\n"+
+			"1f6f8d3c-9a3e-4a8b-8a3e-6f1d9b8c7e5a,João,joao@mail.com,313.716.772-80,1990-01-01,,2\n"+
+			"653565ef-6000-4021-8804-91f3369b3190,\"Silva, Maria\",maria@mail.com,182.345.015-69,1987-06-21,2022-05-01T10:00:00Z,1\n", buf.String())
+	})
+
+	t.Run("CSV neutralizes formulas", func(t *testing.T) {
+		var buf bytes.Buffer
+
+		uw, err := NewUserWriter(&buf, ExportCSV)
+		assert.NoError(t, err)
+
+		names := []string{"=HYPERLINK(\"http://evil.com\")", "+55 João", "-João", "@João", "Ana-Maria"}
+
+		for _, name := range names {
+			u := users[0]
+			u.Name = name
+			u.Email = "=1+1@mail.com"
+
+			assert.NoError(t, uw.Write(&u))
+		}
+
+		assert.NoError(t, uw.Flush())
+
+		export := buf.String()
+
+		assert.Contains(t, export, `,"'=HYPERLINK(""http://evil.com"")",'=1+1@mail.com,`)
+		assert.Contains(t, export, ",'+55 João,")
+		assert.Contains(t, export, ",'-João,")
+		assert.Contains(t, export, ",'@João,")
+		assert.Contains(t, export, ",Ana-Maria,")
+
+		// imports read the export back as it was
+		rows, err := ReadUserCSV(strings.NewReader(export), nil)
+
+		assert.NoError(t, err)
+
+		for i, row := range rows {
+			assert.Equal(t, names[i], row.User.Name)
+			assert.Equal(t, "=1+1@mail.com", row.User.Email)
+		}
+	})
+
+	t.Run("CSV without users", func(t *testing.T) {
+		var buf bytes.Buffer
+
+		uw, err := NewUserWriter(&buf, ExportCSV)
+		assert.NoError(t, err)
+
+		assert.NoError(t, uw.Flush())
+		assert.NoError(t, uw.Flush())
+		assert.Equal(t, "id,name,email,cpf,birthdate,deleted_at,version\n", buf.String())
+	})
+
+	t.Run("NDJSON", func(t *testing.T) {
+		var buf bytes.Buffer
+
+		uw, err := NewUserWriter(&buf, ExportNDJSON)
+		assert.NoError(t, err)
+
+		for i := range users {
+			assert.NoError(t, uw.Write(&users[i]))
+		}
+
+		assert.NoError(t, uw.Flush())
+		assert.Equal(t, "application/x-ndjson", uw.ContentType())
+		assert.Equal(t, `{"id":"1f6f8d3c-9a3e-4a8b-8a3e-6f1d9b8c7e5a","name":"João","email":"joao@mail.com","cpf":"313.716.772-80","birthdate":"1990-01-01T00:00:00Z","version":2}`+"\n"+
+			`{"id":"653565ef-6000-4021-8804-91f3369b3190","name":"Silva, Maria","email":"maria@mail.com","cpf":"182.345.015-69","birthdate":"1987-06-21T00:00:00Z","deleted_at":"2022-05-01T10:00:00Z","version":1}`+"\n", buf.String())
+	})
+
+	t.Run("Bad request unknown format", func(t *testing.T) {
+		uw, err := NewUserWriter(&bytes.Buffer{}, "xlsx")
+
+		assert.Nil(t, uw)
+		assert.Equal(t, rerrors.NewBadRequest("format must be csv or ndjson"), err)
+	})
+}
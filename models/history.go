@@ -0,0 +1,132 @@
+package model
+
+import (
+	"fmt"
+	"time"
+)
+
+// UserRevision is a version of a user along with the change that produced it
+type UserRevision struct {
+	User      *User        `json:"user"`
+	Action    AuditAction  `json:"action"`
+	Actor     string       `json:"actor"`
+	RequestID string       `json:"request_id"`
+	ChangedAt time.Time    `json:"changed_at"`
+	Changes   AuditChanges `json:"changes"`
+}
+
+// UserHistory lists the revisions of a user, newest first
+type UserHistory struct {
+	Data []UserRevision `json:"data"`
+}
+
+// RevertUser returns the state of a user before the change recorded by e,
+// given its state right after it. It returns nil when e created the user
+func RevertUser(u *User, e *AuditEntry) (*User, error) {
+	if e.Action == AuditCreate {
+		return nil, nil
+	}
+
+	before := *u
+
+	for field, change := range e.Changes {
+		if err := setAuditField(&before, field, change.Before); err != nil {
+			return nil, fmt.Errorf("audit entry %d: %w", e.ID, err)
+		}
+	}
+
+	// every change but purges bumps the version by one
+	before.Version--
+
+	return &before, nil
+}
+
+// BuildUserHistory returns the revisions of a user, newest first, given its
+// current state and the audit entries recorded for it, oldest first.
+// Changes made before the audit log existed are not known
+func BuildUserHistory(current *User, entries []AuditEntry) ([]UserRevision, error) {
+	revisions := make([]UserRevision, 0, len(entries))
+
+	state := current
+
+	for i := len(entries) - 1; i >= 0 && state != nil; i-- {
+		e := &entries[i]
+
+		revisions = append(revisions, UserRevision{
+			User:      state,
+			Action:    e.Action,
+			Actor:     e.Actor,
+			RequestID: e.RequestID,
+			ChangedAt: e.CreatedAt,
+			Changes:   e.Changes,
+		})
+
+		var err error
+
+		if state, err = RevertUser(state, e); err != nil {
+			return nil, err
+		}
+	}
+
+	return revisions, nil
+}
+
+// UserAsOf returns the state of a user at the given time, given its current
+// state and the audit entries recorded for it, oldest first. It returns nil
+// when the user did not exist yet
+func UserAsOf(current *User, entries []AuditEntry, at time.Time) (*User, error) {
+	state := current
+
+	for i := len(entries) - 1; i >= 0 && state != nil && entries[i].CreatedAt.After(at); i-- {
+		var err error
+
+		if state, err = RevertUser(state, &entries[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return state, nil
+}
+
+// setAuditField sets a field of u, named as in the audit log, from its text
+// value. nil values are only expected for deleted_at
+func setAuditField(u *User, field string, value *string) error {
+	if value == nil {
+		if field != "deleted_at" {
+			return fmt.Errorf("missing value for %s", field)
+		}
+
+		u.DeletedAt = nil
+
+		return nil
+	}
+
+	switch field {
+	case "name":
+		u.Name = *value
+	case "email":
+		u.Email = *value
+	case "cpf":
+		u.Cpf = *value
+	case "birthdate":
+		birthdate, err := time.Parse("2006-01-02", *value)
+
+		if err != nil {
+			return fmt.Errorf("invalid birthdate %q", *value)
+		}
+
+		u.BirthDate = birthdate
+	case "deleted_at":
+		deletedAt, err := time.Parse(time.RFC3339Nano, *value)
+
+		if err != nil {
+			return fmt.Errorf("invalid deleted_at %q", *value)
+		}
+
+		u.DeletedAt = &deletedAt
+	default:
+		return fmt.Errorf("unknown field %s", field)
+	}
+
+	return nil
+}
@@ -0,0 +1,129 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+// userTimeline returns a user created, renamed, deleted and restored, along
+// with the audit entries recording it
+func userTimeline() (*User, []AuditEntry) {
+	uid := uuid.New()
+	birthdate := time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC)
+	deletedAt := time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	v1 := &User{UID: uid, Name: "João", Email: "joao@mail.com", Cpf: "313.716.772-80", BirthDate: birthdate, Version: 1}
+	v2 := &User{UID: uid, Name: "João", Email: "joao@acme.com.br", Cpf: "313.716.772-80", BirthDate: birthdate, Version: 2}
+	v3 := &User{UID: uid, Name: "João", Email: "joao@acme.com.br", Cpf: "313.716.772-80", BirthDate: birthdate, DeletedAt: &deletedAt, Version: 3}
+	v4 := &User{UID: uid, Name: "João", Email: "joao@acme.com.br", Cpf: "313.716.772-80", BirthDate: birthdate, Version: 4}
+
+	entries := []AuditEntry{
+		{ID: 1, UserID: uid, Action: AuditCreate, Changes: DiffUsers(nil, v1), CreatedAt: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{ID: 5, UserID: uid, Action: AuditUpdate, Changes: DiffUsers(v1, v2), CreatedAt: time.Date(2022, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{ID: 9, UserID: uid, Action: AuditDelete, Changes: DiffUsers(v2, v3), CreatedAt: deletedAt},
+		{ID: 12, UserID: uid, Action: AuditRestore, Changes: DiffUsers(v3, v4), CreatedAt: time.Date(2022, 4, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	return v4, entries
+}
+
+func TestBuildUserHistory(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		current, entries := userTimeline()
+
+		revisions, err := BuildUserHistory(current, entries)
+
+		assert.NoError(t, err)
+		assert.Len(t, revisions, 4)
+
+		assert.Equal(t, AuditRestore, revisions[0].Action)
+		assert.Equal(t, current, revisions[0].User)
+
+		assert.Equal(t, AuditDelete, revisions[1].Action)
+		assert.Equal(t, 3, revisions[1].User.Version)
+		assert.NotNil(t, revisions[1].User.DeletedAt)
+
+		assert.Equal(t, AuditUpdate, revisions[2].Action)
+		assert.Equal(t, 2, revisions[2].User.Version)
+		assert.Nil(t, revisions[2].User.DeletedAt)
+
+		assert.Equal(t, AuditCreate, revisions[3].Action)
+		assert.Equal(t, 1, revisions[3].User.Version)
+		assert.Equal(t, "joao@mail.com", revisions[3].User.Email)
+		assert.Equal(t, entries[0].CreatedAt, revisions[3].ChangedAt)
+		assert.Equal(t, entries[0].Changes, revisions[3].Changes)
+	})
+
+	t.Run("Success created before the audit log", func(t *testing.T) {
+		current, entries := userTimeline()
+
+		revisions, err := BuildUserHistory(current, entries[1:])
+
+		assert.NoError(t, err)
+		assert.Len(t, revisions, 3)
+		assert.Equal(t, AuditUpdate, revisions[2].Action)
+	})
+
+	t.Run("Success no changes", func(t *testing.T) {
+		current, _ := userTimeline()
+
+		revisions, err := BuildUserHistory(current, nil)
+
+		assert.NoError(t, err)
+		assert.Empty(t, revisions)
+	})
+
+	t.Run("Error invalid change", func(t *testing.T) {
+		current, entries := userTimeline()
+		birthdate := "01/01/1990"
+		entries[3].Changes = AuditChanges{"birthdate": {Before: &birthdate}}
+
+		_, err := BuildUserHistory(current, entries)
+
+		assert.EqualError(t, err, `audit entry 12: invalid birthdate "01/01/1990"`)
+	})
+}
+
+func TestUserAsOf(t *testing.T) {
+	current, entries := userTimeline()
+
+	for name, tc := range map[string]struct {
+		at      time.Time
+		email   string
+		version int
+		deleted bool
+		missing bool
+	}{
+		"before creation":   {at: time.Date(2021, 12, 31, 0, 0, 0, 0, time.UTC), missing: true},
+		"at creation":       {at: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC), email: "joao@mail.com", version: 1},
+		"after update":      {at: time.Date(2022, 2, 15, 0, 0, 0, 0, time.UTC), email: "joao@acme.com.br", version: 2},
+		"while deleted":     {at: time.Date(2022, 3, 15, 0, 0, 0, 0, time.UTC), email: "joao@acme.com.br", version: 3, deleted: true},
+		"after restoration": {at: time.Date(2022, 5, 1, 0, 0, 0, 0, time.UTC), email: "joao@acme.com.br", version: 4},
+	} {
+		t.Run(name, func(t *testing.T) {
+			user, err := UserAsOf(current, entries, tc.at)
+
+			assert.NoError(t, err)
+
+			if tc.missing {
+				assert.Nil(t, user)
+				return
+			}
+
+			assert.Equal(t, tc.email, user.Email)
+			assert.Equal(t, tc.version, user.Version)
+			assert.Equal(t, tc.deleted, user.DeletedAt != nil)
+		})
+	}
+
+	t.Run("Leaves the current state untouched", func(t *testing.T) {
+		_, err := UserAsOf(current, entries, time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC))
+
+		assert.NoError(t, err)
+		assert.Equal(t, "joao@acme.com.br", current.Email)
+		assert.Equal(t, 4, current.Version)
+	})
+}
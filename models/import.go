@@ -0,0 +1,216 @@
+package model
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/klasrak/users-api/rerrors"
+)
+
+// ImportFields lists the user fields an import file must have a column for
+var ImportFields = []string{"name", "email", "cpf", "birthdate"}
+
+// importDateLayouts are the birthdate formats accepted in import files.
+// Spreadsheets exported in Brazil write dates as day/month/year
+var importDateLayouts = []string{"2006-01-02", "02/01/2006", time.RFC3339}
+
+// ImportRow is a user read from a line of an import file. Err tells why the
+// line could not be read, in which case User is nil
+type ImportRow struct {
+	Line int
+	User *User
+	Err  error
+}
+
+// ImportRejection is a line of an import file that was not imported
+type ImportRejection struct {
+	Line   int    `json:"line"`
+	Reason string `json:"reason"`
+}
+
+// ImportReport is the outcome of an import: how many users were imported
+// and which lines were rejected, in the order they appear in the file
+type ImportReport struct {
+	Imported int               `json:"imported"`
+	Rejected []ImportRejection `json:"rejected"`
+}
+
+// WriteCSV writes the rejected lines of the report as CSV
+func (r *ImportReport) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+
+	if err := cw.Write([]string{"line", "reason"}); err != nil {
+		return err
+	}
+
+	for _, rej := range r.Rejected {
+		if err := cw.Write([]string{strconv.Itoa(rej.Line), rej.Reason}); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+
+	return cw.Error()
+}
+
+// ReadUserCSV reads users from a CSV file whose first line names its
+// columns. mapping tells which user field each column holds, by column
+// name; without it columns must be named after the fields. Columns may be
+// separated by commas or semicolons. Lines that can't be read are returned
+// with the reason, so the rest of the file can still be imported
+func ReadUserCSV(r io.Reader, mapping map[string]string) ([]ImportRow, error) {
+	br := bufio.NewReader(r)
+
+	header, err := br.ReadString('\n')
+
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, rerrors.NewBadRequest("unable to read import file")
+	}
+
+	// spreadsheets often start files with a byte order mark
+	header = strings.TrimPrefix(header, "\ufeff")
+
+	cr := csv.NewReader(io.MultiReader(strings.NewReader(header), br))
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	if strings.Count(header, ";") > strings.Count(header, ",") {
+		cr.Comma = ';'
+	}
+
+	columns, err := cr.Read()
+
+	if err != nil {
+		return nil, rerrors.NewBadRequest("import file must start with a header line")
+	}
+
+	index, err := importColumns(columns, mapping)
+
+	if err != nil {
+		return nil, err
+	}
+
+	rows := []ImportRow{}
+
+	for {
+		record, err := cr.Read()
+
+		if errors.Is(err, io.EOF) {
+			return rows, nil
+		}
+
+		var parseErr *csv.ParseError
+
+		if errors.As(err, &parseErr) {
+			rows = append(rows, ImportRow{Line: parseErr.StartLine, Err: rerrors.NewBadRequest(parseErr.Err.Error())})
+			continue
+		}
+
+		if err != nil {
+			return nil, rerrors.NewBadRequest("unable to read import file")
+		}
+
+		line, _ := cr.FieldPos(0)
+
+		if len(record) == 1 && strings.TrimSpace(record[0]) == "" {
+			continue
+		}
+
+		u, err := importUser(record, index)
+
+		rows = append(rows, ImportRow{Line: line, User: u, Err: err})
+	}
+}
+
+// importColumns returns the position of the column holding each field
+func importColumns(columns []string, mapping map[string]string) (map[string]int, error) {
+	index := map[string]int{}
+
+	for i, column := range columns {
+		field := strings.ToLower(strings.TrimSpace(column))
+
+		if mapping != nil {
+			var ok bool
+
+			if field, ok = mapping[strings.TrimSpace(column)]; !ok {
+				continue
+			}
+		}
+
+		if !isImportField(field) {
+			if mapping != nil {
+				return nil, rerrors.NewBadRequest(fmt.Sprintf("column %q is mapped to unknown field %q", column, field))
+			}
+
+			continue
+		}
+
+		if _, ok := index[field]; ok {
+			return nil, rerrors.NewBadRequest(fmt.Sprintf("more than one column holds %s", field))
+		}
+
+		index[field] = i
+	}
+
+	for _, field := range ImportFields {
+		if _, ok := index[field]; !ok {
+			return nil, rerrors.NewBadRequest(fmt.Sprintf("no column holds %s", field))
+		}
+	}
+
+	return index, nil
+}
+
+// importUser reads a user from a line of an import file
+func importUser(record []string, index map[string]int) (*User, error) {
+	value := func(field string) string {
+		if i := index[field]; i < len(record) {
+			return fromCSVCell(strings.TrimSpace(record[i]))
+		}
+
+		return ""
+	}
+
+	u := &User{
+		Name:  value("name"),
+		Email: value("email"),
+		Cpf:   value("cpf"),
+	}
+
+	if birthdate := value("birthdate"); birthdate != "" {
+		var err error
+
+		if u.BirthDate, err = parseImportDate(birthdate); err != nil {
+			return nil, err
+		}
+	}
+
+	return u, nil
+}
+
+func parseImportDate(s string) (time.Time, error) {
+	for _, layout := range importDateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, rerrors.NewBadRequest(fmt.Sprintf("invalid birthdate %q", s))
+}
+
+func isImportField(field string) bool {
+	for _, f := range ImportFields {
+		if f == field {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,101 @@
+package model
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/klasrak/users-api/rerrors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadUserCSV(t *testing.T) {
+	birthdate := time.Date(1990, 1, 31, 0, 0, 0, 0, time.UTC)
+
+	t.Run("Success with field names", func(t *testing.T) {
+		file := "name,email,cpf,birthdate\n" +
+			"João,joao@mail.com,313.716.772-80,1990-01-31\n" +
+			"\n" +
+			"Maria,maria@mail.com,182.345.015-69,1990-01-31\n"
+
+		rows, err := ReadUserCSV(strings.NewReader(file), nil)
+
+		assert.NoError(t, err)
+		assert.Equal(t, []ImportRow{
+			{Line: 2, User: &User{Name: "João", Email: "joao@mail.com", Cpf: "313.716.772-80", BirthDate: birthdate}},
+			{Line: 4, User: &User{Name: "Maria", Email: "maria@mail.com", Cpf: "182.345.015-69", BirthDate: birthdate}},
+		}, rows)
+	})
+
+	t.Run("Success with mapping, semicolons and byte order mark", func(t *testing.T) {
+		file := "\ufeffNome;E-mail;CPF;Nascimento;Setor\n" +
+			"João;joao@mail.com;313.716.772-80;31/01/1990;RH\n"
+
+		mapping := map[string]string{"Nome": "name", "E-mail": "email", "CPF": "cpf", "Nascimento": "birthdate"}
+
+		rows, err := ReadUserCSV(strings.NewReader(file), mapping)
+
+		assert.NoError(t, err)
+		assert.Equal(t, []ImportRow{
+			{Line: 2, User: &User{Name: "João", Email: "joao@mail.com", Cpf: "313.716.772-80", BirthDate: birthdate}},
+		}, rows)
+	})
+
+	t.Run("Lines that can't be read are kept with the reason", func(t *testing.T) {
+		file := "name,email,cpf,birthdate\n" +
+			"João,joao@mail.com,313.716.772-80,1990-31-01\n" +
+			"Maria,\"maria@mail.com,182.345.015-69,1990-01-31\n"
+
+		rows, err := ReadUserCSV(strings.NewReader(file), nil)
+
+		assert.NoError(t, err)
+		assert.Len(t, rows, 2)
+
+		assert.Equal(t, 2, rows[0].Line)
+		assert.Nil(t, rows[0].User)
+		assert.Equal(t, rerrors.NewBadRequest(`invalid birthdate "1990-31-01"`), rows[0].Err)
+
+		assert.Equal(t, 3, rows[1].Line)
+		assert.Error(t, rows[1].Err)
+	})
+
+	t.Run("Short lines leave fields empty", func(t *testing.T) {
+		rows, err := ReadUserCSV(strings.NewReader("name,email,cpf,birthdate\nJoão,joao@mail.com\n"), nil)
+
+		assert.NoError(t, err)
+		assert.Equal(t, &User{Name: "João", Email: "joao@mail.com"}, rows[0].User)
+		assert.NoError(t, rows[0].Err)
+	})
+
+	t.Run("Bad request columns", func(t *testing.T) {
+		_, err := ReadUserCSV(strings.NewReader("name,email,cpf\n"), nil)
+		assert.Equal(t, rerrors.NewBadRequest("no column holds birthdate"), err)
+
+		_, err = ReadUserCSV(strings.NewReader("name,email,cpf,birthdate,Email\n"), nil)
+		assert.Equal(t, rerrors.NewBadRequest("more than one column holds email"), err)
+
+		_, err = ReadUserCSV(strings.NewReader("Nome,email,cpf,birthdate\n"), map[string]string{"Nome": "nome"})
+		assert.Equal(t, rerrors.NewBadRequest(`column "Nome" is mapped to unknown field "nome"`), err)
+
+		_, err = ReadUserCSV(strings.NewReader(""), nil)
+		assert.Equal(t, rerrors.NewBadRequest("import file must start with a header line"), err)
+	})
+}
+
+func TestImportReport(t *testing.T) {
+	report := &ImportReport{
+		Imported: 3,
+		Rejected: []ImportRejection{
+			{Line: 2, Reason: "Bad request. Reason: underage"},
+			{Line: 7, Reason: "Bad request. Reason: invalid birthdate \"1990-31-01\""},
+		},
+	}
+
+	var buf bytes.Buffer
+
+	assert.NoError(t, report.WriteCSV(&buf))
+	assert.Equal(t, "line,reason\n"+
+		"2,Bad request. Reason: underage\n"+
+		"7,\"Bad request. Reason: invalid birthdate \"\"1990-31-01\"\"\"\n", buf.String())
+}
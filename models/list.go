@@ -0,0 +1,49 @@
+package model
+
+// UserListParams defines the options accepted by user listings.
+// Listings are paginated by offset when Page or PerPage are given and by
+// keyset (Limit and Cursor) otherwise. Deleted users are only listed when
+// IncludeDeleted is set
+type UserListParams struct {
+	Name           string
+	Filter         string
+	Sort           Sort
+	Limit          int
+	Cursor         string
+	Page           int
+	PerPage        int
+	IncludeDeleted bool
+}
+
+// Paged reports whether offset pagination was requested
+func (p UserListParams) Paged() bool {
+	return p.Page > 0 || p.PerPage > 0
+}
+
+// UserPage is a single page of a user listing
+type UserPage struct {
+	Data       []User `json:"data"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	Page       int    `json:"page,omitempty"`
+	PerPage    int    `json:"per_page,omitempty"`
+	Total      *int   `json:"total,omitempty"`
+}
+
+// LastPage returns the number of the last page of an offset paginated
+// listing. Empty listings still have a single (empty) page
+func (p *UserPage) LastPage() int {
+	if p.Total == nil || p.PerPage <= 0 || *p.Total == 0 {
+		return 1
+	}
+
+	return (*p.Total + p.PerPage - 1) / p.PerPage
+}
+
+// UserSearchResult is a user matching a full-text search, with its relevance
+// and the matching parts of its name and e-mail highlighted with <mark> tags
+type UserSearchResult struct {
+	User
+	Rank           float64 `db:"rank" json:"rank"`
+	NameHighlight  string  `db:"name_highlight" json:"name_highlight"`
+	EmailHighlight string  `db:"email_highlight" json:"email_highlight"`
+}
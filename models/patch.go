@@ -0,0 +1,110 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	"github.com/klasrak/users-api/rerrors"
+)
+
+// Media types patches to users can be written in
+const (
+	MergePatchMediaType = "application/merge-patch+json"
+	JSONPatchMediaType  = "application/json-patch+json"
+)
+
+// UserPatch is a change to some fields of a user, written either as a JSON
+// Merge Patch (RFC 7396) or as a JSON Patch (RFC 6902). Either way it applies
+// to the user as the API represents it
+type UserPatch struct {
+	merge []byte
+	ops   jsonpatch.Patch
+}
+
+// ParseUserPatch reads a patch written in the given media type
+func ParseUserPatch(mediaType string, body []byte) (*UserPatch, error) {
+	switch mediaType {
+	case MergePatchMediaType:
+		var doc map[string]json.RawMessage
+
+		if err := json.Unmarshal(body, &doc); err != nil {
+			return nil, rerrors.NewBadRequest("merge patch must be a JSON object")
+		}
+
+		return &UserPatch{merge: body}, nil
+	case JSONPatchMediaType:
+		ops, err := jsonpatch.DecodePatch(body)
+
+		if err != nil {
+			return nil, rerrors.NewBadRequest("json patch must be an array of operations")
+		}
+
+		return &UserPatch{ops: ops}, nil
+	default:
+		return nil, rerrors.NewUnsupportedMediaType(fmt.Sprintf("patches must be sent as %s or %s", MergePatchMediaType, JSONPatchMediaType))
+	}
+}
+
+// Apply returns u with the patch applied, leaving u untouched. Failed JSON
+// Patch tests are reported as conflicts. The id and version of the user
+// can't be patched
+func (p *UserPatch) Apply(u *User) (*User, error) {
+	doc, err := json.Marshal(u)
+
+	if err != nil {
+		return nil, rerrors.NewInternal()
+	}
+
+	if p.ops != nil {
+		doc, err = p.ops.Apply(doc)
+	} else {
+		doc, err = jsonpatch.MergePatch(doc, p.merge)
+	}
+
+	if errors.Is(err, jsonpatch.ErrTestFailed) {
+		return nil, rerrors.NewConflict("user", "patched", err.Error())
+	}
+
+	if err != nil {
+		return nil, rerrors.NewBadRequest(fmt.Sprintf("unable to apply patch: %v", err))
+	}
+
+	patched := &User{}
+
+	dec := json.NewDecoder(bytes.NewReader(doc))
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(patched); err != nil {
+		var typeErr *json.UnmarshalTypeError
+
+		switch {
+		case errors.As(err, &typeErr):
+			return nil, rerrors.NewBadRequest(fmt.Sprintf("%s must be a %s", typeErr.Field, typeErr.Type))
+		case strings.HasPrefix(err.Error(), "json: unknown field"):
+			return nil, rerrors.NewBadRequest(fmt.Sprintf("patched user has %s", strings.TrimPrefix(err.Error(), "json: ")))
+		case strings.Contains(err.Error(), "parsing time"):
+			return nil, rerrors.NewBadRequest("birthdate must be in RFC3339 format")
+		default:
+			return nil, rerrors.NewBadRequest("patched user must be a JSON object")
+		}
+	}
+
+	if patched.UID != u.UID || patched.Version != u.Version || !equalTimes(patched.DeletedAt, u.DeletedAt) {
+		return nil, rerrors.NewBadRequest("id, version and deleted_at can't be patched")
+	}
+
+	return patched, nil
+}
+
+func equalTimes(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return a.Equal(*b)
+}
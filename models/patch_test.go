@@ -0,0 +1,131 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/klasrak/users-api/rerrors"
+	"github.com/stretchr/testify/assert"
+)
+
+func patchedUser() *User {
+	return &User{
+		UID:       uuid.MustParse("1f6f8d3c-9a3e-4a8b-8a3e-6f1d9b8c7e5a"),
+		Name:      "João",
+		Email:     "joao@mail.com",
+		Cpf:       "313.716.772-80",
+		BirthDate: time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC),
+		Version:   3,
+	}
+}
+
+func TestParseUserPatch(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		_, err := ParseUserPatch(MergePatchMediaType, []byte(`{"name": "João Silva"}`))
+		assert.NoError(t, err)
+
+		_, err = ParseUserPatch(JSONPatchMediaType, []byte(`[{"op": "replace", "path": "/name", "value": "João Silva"}]`))
+		assert.NoError(t, err)
+	})
+
+	t.Run("Error unsupported media type", func(t *testing.T) {
+		_, err := ParseUserPatch("application/json", []byte(`{"name": "João Silva"}`))
+
+		assert.Equal(t, rerrors.UnsupportedMediaType, err.(*rerrors.Error).Type)
+	})
+
+	t.Run("Error malformed patch", func(t *testing.T) {
+		for mediaType, body := range map[string]string{
+			MergePatchMediaType: `["name"]`,
+			JSONPatchMediaType:  `{"op": "replace"}`,
+		} {
+			_, err := ParseUserPatch(mediaType, []byte(body))
+
+			assert.Equal(t, rerrors.BadRequest, err.(*rerrors.Error).Type, mediaType)
+		}
+	})
+}
+
+func TestUserPatchApply(t *testing.T) {
+	apply := func(mediaType, body string) (*User, error) {
+		patch, err := ParseUserPatch(mediaType, []byte(body))
+
+		if err != nil {
+			return nil, err
+		}
+
+		return patch.Apply(patchedUser())
+	}
+
+	t.Run("Merge patch", func(t *testing.T) {
+		u, err := apply(MergePatchMediaType, `{"name": "João Silva", "birthdate": "1991-02-03T00:00:00Z"}`)
+
+		want := patchedUser()
+		want.Name = "João Silva"
+		want.BirthDate = time.Date(1991, 2, 3, 0, 0, 0, 0, time.UTC)
+
+		assert.NoError(t, err)
+		assert.Equal(t, want, u)
+	})
+
+	t.Run("Merge patch clears fields", func(t *testing.T) {
+		u, err := apply(MergePatchMediaType, `{"cpf": null}`)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "", u.Cpf)
+	})
+
+	t.Run("JSON patch", func(t *testing.T) {
+		u, err := apply(JSONPatchMediaType, `[
+			{"op": "test", "path": "/email", "value": "joao@mail.com"},
+			{"op": "replace", "path": "/email", "value": "joao@acme.com.br"},
+			{"op": "remove", "path": "/cpf"}
+		]`)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "joao@acme.com.br", u.Email)
+		assert.Equal(t, "", u.Cpf)
+		assert.Equal(t, "João", u.Name)
+	})
+
+	t.Run("Leaves the user untouched", func(t *testing.T) {
+		u := patchedUser()
+		patch, _ := ParseUserPatch(MergePatchMediaType, []byte(`{"name": "João Silva"}`))
+
+		_, err := patch.Apply(u)
+
+		assert.NoError(t, err)
+		assert.Equal(t, patchedUser(), u)
+	})
+
+	t.Run("Error failed test", func(t *testing.T) {
+		_, err := apply(JSONPatchMediaType, `[
+			{"op": "test", "path": "/email", "value": "joao@acme.com.br"},
+			{"op": "replace", "path": "/name", "value": "João Silva"}
+		]`)
+
+		assert.Equal(t, rerrors.Conflict, err.(*rerrors.Error).Type)
+	})
+
+	t.Run("Error bad request", func(t *testing.T) {
+		for name, tc := range map[string]struct {
+			mediaType string
+			body      string
+		}{
+			"missing path":      {JSONPatchMediaType, `[{"op": "replace", "path": "/nickname/first", "value": "Jo"}]`},
+			"unknown field":     {MergePatchMediaType, `{"nickname": "Jo"}`},
+			"wrong type":        {MergePatchMediaType, `{"name": 42}`},
+			"invalid birthdate": {MergePatchMediaType, `{"birthdate": "01/01/1990"}`},
+			"patched id":        {JSONPatchMediaType, `[{"op": "replace", "path": "/id", "value": "6b1c1a8e-0a8e-4d4b-9b8f-3a2f1e0d9c8b"}]`},
+			"patched version":   {MergePatchMediaType, `{"version": 4}`},
+			"patched deletion":  {MergePatchMediaType, `{"deleted_at": "2022-05-01T00:00:00Z"}`},
+		} {
+			t.Run(name, func(t *testing.T) {
+				_, err := apply(tc.mediaType, tc.body)
+
+				assert.Equal(t, rerrors.BadRequest, err.(*rerrors.Error).Type, err.Error())
+			})
+		}
+	})
+}
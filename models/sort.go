@@ -0,0 +1,79 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/klasrak/users-api/rerrors"
+)
+
+// UserSortableFields is the allowlist of User columns listings can be sorted by
+var UserSortableFields = []string{"id", "name", "email", "cpf", "birthdate"}
+
+// SortField is a single sort key. Fields are sorted ascending unless Desc is set
+type SortField struct {
+	Field string
+	Desc  bool
+}
+
+// Sort is an ordered list of sort keys
+type Sort []SortField
+
+// String formats the sort back into its query string representation,
+// e.g. "name,-birthdate"
+func (s Sort) String() string {
+	keys := make([]string, len(s))
+
+	for i, f := range s {
+		if f.Desc {
+			keys[i] = "-" + f.Field
+		} else {
+			keys[i] = f.Field
+		}
+	}
+
+	return strings.Join(keys, ",")
+}
+
+// ParseUserSort parses a comma separated list of User fields, each optionally
+// prefixed by "-" for descending order, e.g. "name,-birthdate,email"
+func ParseUserSort(s string) (Sort, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	var sort Sort
+	seen := map[string]bool{}
+
+	for _, key := range strings.Split(s, ",") {
+		f := SortField{Field: strings.TrimSpace(key)}
+
+		if strings.HasPrefix(f.Field, "-") {
+			f.Field = f.Field[1:]
+			f.Desc = true
+		}
+
+		if !isSortable(f.Field) {
+			return nil, rerrors.NewBadRequest(fmt.Sprintf("can't sort by %q, allowed fields are: %s", f.Field, strings.Join(UserSortableFields, ", ")))
+		}
+
+		if seen[f.Field] {
+			return nil, rerrors.NewBadRequest(fmt.Sprintf("sort field %q is repeated", f.Field))
+		}
+
+		seen[f.Field] = true
+		sort = append(sort, f)
+	}
+
+	return sort, nil
+}
+
+func isSortable(field string) bool {
+	for _, f := range UserSortableFields {
+		if f == field {
+			return true
+		}
+	}
+
+	return false
+}
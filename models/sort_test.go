@@ -0,0 +1,41 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/klasrak/users-api/rerrors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseUserSort(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		sort, err := ParseUserSort("name,-birthdate, email")
+
+		assert.NoError(t, err)
+		assert.Equal(t, Sort{{Field: "name"}, {Field: "birthdate", Desc: true}, {Field: "email"}}, sort)
+		assert.Equal(t, "name,-birthdate,email", sort.String())
+	})
+
+	t.Run("Empty", func(t *testing.T) {
+		sort, err := ParseUserSort("")
+
+		assert.NoError(t, err)
+		assert.Nil(t, sort)
+		assert.Equal(t, "", sort.String())
+	})
+
+	t.Run("Error unknown field", func(t *testing.T) {
+		_, err := ParseUserSort("name,-password")
+
+		assert.Error(t, err)
+		assert.Equal(t, rerrors.BadRequest, err.(*rerrors.Error).Type)
+		assert.Contains(t, err.Error(), `"password"`)
+	})
+
+	t.Run("Error repeated field", func(t *testing.T) {
+		_, err := ParseUserSort("name,-name")
+
+		assert.Error(t, err)
+		assert.Equal(t, rerrors.BadRequest, err.(*rerrors.Error).Type)
+	})
+}
@@ -8,9 +8,13 @@ import (
 
 // User defines domain model json and db representation
 type User struct {
-	UID       uuid.UUID `db:"id" json:"id"`
-	Name      string    `db:"name" json:"name"`
-	Email     string    `db:"email" json:"email"`
-	Cpf       string    `db:"cpf" json:"cpf"`
-	BirthDate time.Time `db:"birthdate" json:"birthdate"`
+	UID       uuid.UUID  `db:"id" json:"id"`
+	Name      string     `db:"name" json:"name"`
+	Email     string     `db:"email" json:"email"`
+	Cpf       string     `db:"cpf" json:"cpf"`
+	BirthDate time.Time  `db:"birthdate" json:"birthdate"`
+	DeletedAt *time.Time `db:"deleted_at" json:"deleted_at,omitempty"`
+	// Version is bumped on every change and guards updates against
+	// overwriting changes the caller hasn't seen
+	Version int `db:"version" json:"version"`
 }
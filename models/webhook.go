@@ -0,0 +1,183 @@
+package model
+
+import (
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// EventTypes lists every type of event webhooks can subscribe to
+var EventTypes = []EventType{EventUserCreated, EventUserUpdated, EventUserDeleted}
+
+// Valid reports whether t is one of EventTypes
+func (t EventType) Valid() bool {
+	for _, v := range EventTypes {
+		if t == v {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Webhook is an endpoint of a partner system the events it subscribed to
+// are delivered to, signed with its secret
+type Webhook struct {
+	ID     uuid.UUID     `db:"id" json:"id"`
+	URL    string        `db:"url" json:"url"`
+	Events WebhookEvents `db:"events" json:"events"`
+	// Secret is only shown when the webhook is created
+	Secret string `db:"secret" json:"secret,omitempty"`
+	// Active is false while the webhook is disabled, by hand or for failing
+	// too often, and DisabledReason tells which
+	Active         bool   `db:"active" json:"active"`
+	DisabledReason string `db:"disabled_reason" json:"disabled_reason,omitempty"`
+	// Failures counts the attempts to deliver events that failed in a row
+	Failures  int       `db:"failures" json:"failures"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+}
+
+// Subscribes reports whether the webhook subscribed to events of type t
+func (w *Webhook) Subscribes(t EventType) bool {
+	for _, e := range w.Events {
+		if e == t {
+			return true
+		}
+	}
+
+	return false
+}
+
+// WebhookEvents are the types of the events a webhook subscribed to, stored
+// as a comma separated list
+type WebhookEvents []EventType
+
+// Value satisfies driver.Valuer
+func (e WebhookEvents) Value() (driver.Value, error) {
+	types := make([]string, len(e))
+
+	for i, t := range e {
+		types[i] = string(t)
+	}
+
+	return strings.Join(types, ","), nil
+}
+
+// Scan satisfies sql.Scanner
+func (e *WebhookEvents) Scan(src interface{}) error {
+	var list string
+
+	switch v := src.(type) {
+	case []byte:
+		list = string(v)
+	case string:
+		list = v
+	default:
+		return errors.New("unsupported webhook events type")
+	}
+
+	*e = WebhookEvents{}
+
+	for _, t := range strings.Split(list, ",") {
+		if t != "" {
+			*e = append(*e, EventType(t))
+		}
+	}
+
+	return nil
+}
+
+// WebhookParams are the settings of a webhook its subscriber chooses
+type WebhookParams struct {
+	URL    string      `json:"url" binding:"required"`
+	Events []EventType `json:"events" binding:"required"`
+	// Active enables or disables the webhook, leaving it as it is when nil.
+	// Webhooks are created active
+	Active *bool `json:"active"`
+}
+
+// DeliveryStatus tells whether a delivery is still being attempted
+type DeliveryStatus string
+
+// Statuses of deliveries. Pending deliveries are attempted until they
+// succeed or run out of attempts and fail
+const (
+	DeliveryPending   DeliveryStatus = "pending"
+	DeliverySucceeded DeliveryStatus = "succeeded"
+	DeliveryFailed    DeliveryStatus = "failed"
+)
+
+// WebhookDelivery is the delivery of an event to a webhook, and the outcome
+// of the last attempt to deliver it
+type WebhookDelivery struct {
+	ID        uuid.UUID `db:"id" json:"id"`
+	WebhookID uuid.UUID `db:"webhook_id" json:"webhook_id"`
+	EventID   uuid.UUID `db:"event_id" json:"event_id"`
+	EventType EventType `db:"event_type" json:"event_type"`
+	// RedeliveryOf is the delivery this one was requested to repeat
+	RedeliveryOf *uuid.UUID     `db:"redelivery_of" json:"redelivery_of,omitempty"`
+	Payload      WebhookPayload `db:"payload" json:"payload"`
+	Status       DeliveryStatus `db:"status" json:"status"`
+	Attempts     int            `db:"attempts" json:"attempts"`
+	// ResponseCode is the HTTP status the endpoint answered the last attempt
+	// with, nil when it didn't answer
+	ResponseCode *int   `db:"response_code" json:"response_code,omitempty"`
+	LastError    string `db:"last_error" json:"last_error,omitempty"`
+	// NextAttemptAt is when a pending delivery is attempted, and
+	// ClaimedUntil until when an instance attempting it holds it
+	NextAttemptAt time.Time  `db:"next_attempt_at" json:"next_attempt_at"`
+	ClaimedUntil  *time.Time `db:"claimed_until" json:"-"`
+	CreatedAt     time.Time  `db:"created_at" json:"created_at"`
+	DeliveredAt   *time.Time `db:"delivered_at" json:"delivered_at,omitempty"`
+}
+
+// WebhookPayload is the body of a delivery, exactly as it is signed and
+// sent
+type WebhookPayload []byte
+
+// Value satisfies driver.Valuer
+func (p WebhookPayload) Value() (driver.Value, error) {
+	return string(p), nil
+}
+
+// Scan satisfies sql.Scanner
+func (p *WebhookPayload) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case []byte:
+		*p = append(WebhookPayload{}, v...)
+	case string:
+		*p = WebhookPayload(v)
+	default:
+		return errors.New("unsupported webhook payload type")
+	}
+
+	return nil
+}
+
+// MarshalJSON satisfies json.Marshaler, embedding the payload as it is
+func (p WebhookPayload) MarshalJSON() ([]byte, error) {
+	if len(p) == 0 {
+		return []byte("null"), nil
+	}
+
+	return p, nil
+}
+
+// WebhookDeliveryListParams filters and limits a listing of the deliveries
+// of a webhook, newest first
+type WebhookDeliveryListParams struct {
+	WebhookID uuid.UUID
+	Status    DeliveryStatus
+	// Before only lists deliveries created before this time, when set
+	Before time.Time
+	Limit  int
+}
+
+// WebhookDeliveryPage is a page of deliveries, newest first
+type WebhookDeliveryPage struct {
+	Data []WebhookDelivery `json:"data"`
+}
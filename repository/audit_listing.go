@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/jmoiron/sqlx"
+	model "github.com/klasrak/users-api/models"
+	"github.com/klasrak/users-api/rerrors"
+)
+
+// listAuditEntries returns the audit entries in db matching params, oldest
+// first, with the query written for the database d
+func listAuditEntries(ctx context.Context, db *sqlx.DB, d *dialect, params model.AuditListParams) ([]model.AuditEntry, error) {
+	entries := []model.AuditEntry{}
+
+	var args queryArgs
+
+	var conds []string
+
+	if params.UserID != nil {
+		conds = append(conds, "a.user_id = "+args.add(*params.UserID))
+	}
+
+	if params.Actor != "" {
+		conds = append(conds, "a.actor = "+args.add(params.Actor))
+	}
+
+	if !params.Since.IsZero() {
+		conds = append(conds, "a.created_at >= "+args.add(d.timestamp(params.Since)))
+	}
+
+	if params.After > 0 {
+		conds = append(conds, "a.id > "+args.add(params.After))
+	}
+
+	query, bound := d.rebind(fmt.Sprintf(
+		"SELECT a.id, a.user_id, a.actor, a.request_id, a.action, a.changes, a.created_at, a.prev_hash, a.hash FROM audit_log a%s ORDER BY a.id LIMIT %s;",
+		where(conds),
+		args.add(params.Limit),
+	), args)
+
+	if err := conn(ctx, db).SelectContext(ctx, &entries, query, bound...); err != nil {
+		log.Printf("unable to list audit entries: %v\n", err)
+		return entries, rerrors.NewInternal()
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"encoding/base64"
+	"encoding/json"
+
+	model "github.com/klasrak/users-api/models"
+	"github.com/klasrak/users-api/rerrors"
+)
+
+// cursor marks the position of the last row returned by a keyset paginated
+// listing: the values of its sort keys, in order. It is handed to clients as
+// an opaque base64 token and is only valid for the sort it was created with
+type cursor struct {
+	Sort   string   `json:"s,omitempty"`
+	Values []string `json:"v"`
+}
+
+// encodeCursor serializes a cursor into an opaque token
+func encodeCursor(c cursor) string {
+	b, _ := json.Marshal(c)
+
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decodeCursor parses a token created by encodeCursor
+func decodeCursor(token string) (cursor, error) {
+	var c cursor
+
+	b, err := base64.RawURLEncoding.DecodeString(token)
+
+	if err != nil {
+		return c, err
+	}
+
+	if err := json.Unmarshal(b, &c); err != nil {
+		return c, err
+	}
+
+	return c, nil
+}
+
+// readCursor parses the token of a listing sorted by sort on keys, returning
+// the values of the keys it marks. Tokens created for another sort, and
+// forged ones whose values don't fit their keys, are rejected before they
+// reach the database
+func readCursor(token string, sort model.Sort, keys []sortKey) ([]string, error) {
+	c, err := decodeCursor(token)
+
+	if err != nil || len(c.Values) != len(keys) {
+		return nil, rerrors.NewBadRequest("invalid cursor")
+	}
+
+	if c.Sort != sort.String() {
+		return nil, rerrors.NewBadRequest("cursor was created with a different sort")
+	}
+
+	for i, k := range keys {
+		if !validFieldValue(k.field, c.Values[i]) {
+			return nil, rerrors.NewBadRequest("invalid cursor")
+		}
+	}
+
+	return c.Values, nil
+}
@@ -0,0 +1,125 @@
+package repository
+
+import (
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// dialect holds the parts of user queries that differ between the databases
+// users can be stored in
+type dialect struct {
+	// filterFields maps the fields accepted by the filter language to columns
+	filterFields map[string]filterField
+	// nameMatch matches names containing a pattern, ignoring case and
+	// accents, with %s standing for the pattern placeholder
+	nameMatch string
+	// date converts a date to the value the database compares dates with
+	date func(d time.Time) interface{}
+	// timestamp converts a point in time to the value the database
+	// compares timestamps with
+	timestamp func(t time.Time) interface{}
+	// sortColumns maps the sortable fields to their SQL expressions
+	sortColumns map[string]string
+	// rebind rewrites the $N placeholders of a query, and its arguments to
+	// match, for the database
+	rebind func(query string, args []interface{}) (string, []interface{})
+	// skipDuplicates ends an INSERT so that rows clashing with the unique
+	// index described by target, its columns and predicate, are skipped
+	skipDuplicates func(target string) string
+}
+
+// onConflictDoNothing skips rows clashing with the unique index target
+func onConflictDoNothing(target string) string {
+	return "ON CONFLICT " + target + " DO NOTHING"
+}
+
+var postgresDialect = &dialect{
+	filterFields: userFilterFields,
+	// immutable_unaccent is backed by the users_name_trgm_idx trigram index
+	nameMatch:      "immutable_unaccent(u.name) ILIKE immutable_unaccent(%s)",
+	date:           func(d time.Time) interface{} { return d },
+	timestamp:      func(t time.Time) interface{} { return t },
+	sortColumns:    userSortColumns,
+	rebind:         func(query string, args []interface{}) (string, []interface{}) { return query, args },
+	skipDuplicates: onConflictDoNothing,
+}
+
+// sqliteDialect relies on the fold function and the pt_br collation that
+// come with SQLiteDriver. Dates are stored as YYYY-MM-DD text and
+// timestamps as UTC text, so both compare as text. LIKE needs to be told
+// which character escapes wildcards
+var sqliteDialect = &dialect{
+	filterFields: map[string]filterField{
+		"id": {column: "u.id", kind: uuidField},
+		"name": {
+			column: "u.name COLLATE pt_br",
+			kind:   textField,
+			match:  `fold(u.name) LIKE fold(%s) ESCAPE '\'`,
+		},
+		"email":     {column: "u.email", kind: textField, match: `u.email LIKE %s ESCAPE '\'`},
+		"cpf":       {column: "u.cpf", kind: textField, match: `u.cpf LIKE %s ESCAPE '\'`},
+		"birthdate": {column: "u.birthdate", kind: dateField},
+	},
+	nameMatch:   `fold(u.name) LIKE fold(%s) ESCAPE '\'`,
+	date:        func(d time.Time) interface{} { return d.Format("2006-01-02") },
+	timestamp:   func(t time.Time) interface{} { return t.UTC() },
+	sortColumns: userSortColumns,
+	rebind: func(query string, args []interface{}) (string, []interface{}) {
+		return sqlitePlaceholders(query), args
+	},
+	skipDuplicates: onConflictDoNothing,
+}
+
+var placeholder = regexp.MustCompile(`\$(\d+)`)
+
+// sqlitePlaceholders turns $N placeholders into ?N. SQLite reads $N as a
+// named parameter, numbered in the order it first appears in the query
+func sqlitePlaceholders(query string) string {
+	return placeholder.ReplaceAllString(query, "?$1")
+}
+
+// mysqlDialect relies on the collations the MySQL migrations give each
+// column: names compare ignoring case and accents, while e-mails and cpfs
+// compare as they are, as they do in Postgres. Dates are passed as
+// YYYY-MM-DD text and timestamps in UTC, as they are stored
+var mysqlDialect = &dialect{
+	filterFields: map[string]filterField{
+		"id":        {column: "u.id", kind: uuidField},
+		"name":      {column: "u.name", kind: textField, match: "u.name LIKE %s"},
+		"email":     {column: "u.email", kind: textField, match: "LOWER(u.email) LIKE LOWER(%s)"},
+		"cpf":       {column: "u.cpf", kind: textField, match: "u.cpf LIKE %s"},
+		"birthdate": {column: "u.birthdate", kind: dateField},
+	},
+	nameMatch: "u.name LIKE %s",
+	date:      func(d time.Time) interface{} { return d.Format("2006-01-02") },
+	timestamp: func(t time.Time) interface{} { return t.UTC() },
+	sortColumns: map[string]string{
+		"id":        "u.id",
+		"name":      "u.name",
+		"email":     "u.email",
+		"cpf":       "u.cpf",
+		"birthdate": "u.birthdate",
+	},
+	rebind: mysqlPlaceholders,
+	// unlike INSERT IGNORE, which turns most errors into warnings, only
+	// duplicate keys are skipped
+	skipDuplicates: func(string) string { return "ON DUPLICATE KEY UPDATE id = id" },
+}
+
+// mysqlPlaceholders turns $N placeholders into ?. MySQL placeholders have
+// no number, so arguments are repeated and reordered to follow the order in
+// which placeholders appear in the query
+func mysqlPlaceholders(query string, args []interface{}) (string, []interface{}) {
+	var bound []interface{}
+
+	query = placeholder.ReplaceAllStringFunc(query, func(p string) string {
+		n, _ := strconv.Atoi(p[1:])
+
+		bound = append(bound, args[n-1])
+
+		return "?"
+	})
+
+	return query, bound
+}
@@ -0,0 +1,172 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/klasrak/users-api/filter"
+)
+
+type fieldKind int
+
+const (
+	textField fieldKind = iota
+	dateField
+	uuidField
+)
+
+// filterField describes how a filterable User field is compiled to SQL
+type filterField struct {
+	column string
+	kind   fieldKind
+	// match is the expression used by contains, starts_with and ends_with,
+	// with %s standing for the pattern placeholder
+	match string
+}
+
+// userFilterFields maps the fields accepted by the filter language to
+// Postgres columns
+var userFilterFields = map[string]filterField{
+	"id": {column: "u.id", kind: uuidField},
+	"name": {
+		column: "u.name COLLATE pt_br",
+		kind:   textField,
+		match:  "immutable_unaccent(u.name) ILIKE immutable_unaccent(%s)",
+	},
+	"email":     {column: "u.email", kind: textField, match: "u.email ILIKE %s"},
+	"cpf":       {column: "u.cpf", kind: textField, match: "u.cpf LIKE %s"},
+	"birthdate": {column: "u.birthdate", kind: dateField},
+}
+
+// comparisonOperators maps filter operators to their SQL counterparts
+var comparisonOperators = map[string]string{
+	filter.Eq: "=",
+	filter.Ne: "<>",
+	filter.Gt: ">",
+	filter.Ge: ">=",
+	filter.Lt: "<",
+	filter.Le: "<=",
+}
+
+// compileFilter compiles a parsed filter into a parameterized SQL condition
+// for the database d. Values are never interpolated, they're always passed
+// as arguments
+func compileFilter(n filter.Node, d *dialect, args *queryArgs) (string, error) {
+	switch n := n.(type) {
+	case *filter.And:
+		return compileBinary(n.Left, n.Right, "AND", d, args)
+
+	case *filter.Or:
+		return compileBinary(n.Left, n.Right, "OR", d, args)
+
+	case *filter.Not:
+		expr, err := compileFilter(n.Expr, d, args)
+
+		if err != nil {
+			return "", err
+		}
+
+		return "NOT " + expr, nil
+
+	case *filter.Comparison:
+		return compileComparison(n, d, args)
+	}
+
+	return "", filter.Errorf(n.Pos(), "unsupported expression")
+}
+
+func compileBinary(left, right filter.Node, op string, d *dialect, args *queryArgs) (string, error) {
+	l, err := compileFilter(left, d, args)
+
+	if err != nil {
+		return "", err
+	}
+
+	r, err := compileFilter(right, d, args)
+
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("(%s %s %s)", l, op, r), nil
+}
+
+func compileComparison(c *filter.Comparison, d *dialect, args *queryArgs) (string, error) {
+	field, ok := d.filterFields[strings.ToLower(c.Field)]
+
+	if !ok {
+		return "", filter.Errorf(c.At, "unknown field %q", c.Field)
+	}
+
+	switch c.Op {
+	case filter.Contains, filter.StartsWith, filter.EndsWith:
+		if field.kind != textField {
+			return "", filter.Errorf(c.OpAt, "operator %q can't be used with field %q", c.Op, c.Field)
+		}
+
+		pattern := escapeLike(c.Values[0].Text)
+
+		switch c.Op {
+		case filter.Contains:
+			pattern = "%" + pattern + "%"
+		case filter.StartsWith:
+			pattern = pattern + "%"
+		case filter.EndsWith:
+			pattern = "%" + pattern
+		}
+
+		return "(" + fmt.Sprintf(field.match, args.add(pattern)) + ")", nil
+	}
+
+	values := make([]string, len(c.Values))
+
+	for i, v := range c.Values {
+		value, err := filterValue(field, v)
+
+		if err != nil {
+			return "", err
+		}
+
+		if date, ok := value.(time.Time); ok {
+			value = d.date(date)
+		}
+
+		values[i] = args.add(value)
+	}
+
+	switch c.Op {
+	case filter.Between:
+		return fmt.Sprintf("(%s BETWEEN %s AND %s)", field.column, values[0], values[1]), nil
+	case filter.In:
+		return fmt.Sprintf("(%s IN (%s))", field.column, strings.Join(values, ", ")), nil
+	default:
+		return fmt.Sprintf("(%s %s %s)", field.column, comparisonOperators[c.Op], values[0]), nil
+	}
+}
+
+// filterValue converts a literal to the type of the field it is compared with
+func filterValue(field filterField, v filter.Value) (interface{}, error) {
+	switch field.kind {
+	case dateField:
+		d, err := time.Parse("2006-01-02", v.Text)
+
+		if err != nil {
+			return nil, filter.Errorf(v.At, "invalid date %q, expected YYYY-MM-DD", v.Text)
+		}
+
+		return d, nil
+
+	case uuidField:
+		id, err := uuid.Parse(v.Text)
+
+		if err != nil {
+			return nil, filter.Errorf(v.At, "invalid id %q", v.Text)
+		}
+
+		return id, nil
+	}
+
+	return v.Text, nil
+}
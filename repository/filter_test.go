@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/klasrak/users-api/filter"
+	"github.com/klasrak/users-api/rerrors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompileFilter(t *testing.T) {
+	compile := func(expr string) (string, queryArgs, error) {
+		n, err := filter.Parse(expr)
+
+		if err != nil {
+			return "", nil, err
+		}
+
+		var args queryArgs
+
+		sql, err := compileFilter(n, postgresDialect, &args)
+
+		return sql, args, err
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		sql, args, err := compile(`email ends_with "@acme.com.br" and birthdate between 1980-01-01 and 1990-12-31`)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "((u.email ILIKE $1) AND (u.birthdate BETWEEN $2 AND $3))", sql)
+		assert.Equal(t, queryArgs{
+			"%@acme.com.br",
+			time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC),
+			time.Date(1990, 12, 31, 0, 0, 0, 0, time.UTC),
+		}, args)
+	})
+
+	t.Run("Success text matching escapes wildcards", func(t *testing.T) {
+		sql, args, err := compile(`not name contains "100%" or cpf starts_with 313_`)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "(NOT (immutable_unaccent(u.name) ILIKE immutable_unaccent($1)) OR (u.cpf LIKE $2))", sql)
+		assert.Equal(t, queryArgs{`%100\%%`, `313\_%`}, args)
+	})
+
+	t.Run("Success in and comparisons", func(t *testing.T) {
+		id := uuid.New()
+
+		sql, args, err := compile(`id in (` + id.String() + `) and name >= "M"`)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "((u.id IN ($1)) AND (u.name COLLATE pt_br >= $2))", sql)
+		assert.Equal(t, queryArgs{id, "M"}, args)
+	})
+
+	t.Run("Errors report the position of the bad token", func(t *testing.T) {
+		for expr, message := range map[string]string{
+			`password = "123"`:                 `invalid filter at position 1: unknown field "password"`,
+			`name = "Ana" or birthdate = 1990`: `invalid filter at position 29: invalid date "1990", expected YYYY-MM-DD`,
+			`birthdate contains 1990`:          `invalid filter at position 11: operator "contains" can't be used with field "birthdate"`,
+			`id = 42`:                          `invalid filter at position 6: invalid id "42"`,
+		} {
+			_, _, err := compile(expr)
+
+			assert.Error(t, err, expr)
+			assert.Equal(t, rerrors.BadRequest, err.(*rerrors.Error).Type)
+			assert.Equal(t, "Bad request. Reason: "+message, err.Error(), expr)
+		}
+	})
+}
@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"context"
+	"log"
+
+	model "github.com/klasrak/users-api/models"
+	"github.com/klasrak/users-api/rerrors"
+)
+
+// MemoryAuditRepository is an in-memory implementation of service layer
+// AuditRepository interface, keeping the audit log in a MemoryStore
+type MemoryAuditRepository struct {
+	Store *MemoryStore
+}
+
+// Append adds an entry to the end of the audit log, chaining it to the last
+// one. It must run within a transaction (see MemoryTransactor), so the entry
+// is only kept along with the change it records
+func (r *MemoryAuditRepository) Append(ctx context.Context, e *model.AuditEntry) error {
+	return r.AppendAll(ctx, []*model.AuditEntry{e})
+}
+
+// AppendAll adds several entries to the end of the audit log, in order, as
+// Append would one at a time
+func (r *MemoryAuditRepository) AppendAll(ctx context.Context, entries []*model.AuditEntry) error {
+	if _, ok := r.Store.tx(ctx); !ok {
+		log.Println("unable to append audit entry: not within a transaction")
+		return rerrors.NewInternal()
+	}
+
+	return r.Store.write(ctx, func(tx *memTx) error {
+		prev := model.AuditGenesisHash
+
+		if n := len(r.Store.audit); n > 0 {
+			prev = r.Store.audit[n-1].Hash
+		}
+
+		for _, e := range entries {
+			e.ID = int64(len(r.Store.audit) + 1)
+			e.PrevHash = prev
+			e.Hash = e.ComputeHash()
+
+			r.Store.audit = append(r.Store.audit, *e)
+
+			prev = e.Hash
+		}
+
+		return nil
+	})
+}
+
+// List returns the audit entries matching params, oldest first
+func (r *MemoryAuditRepository) List(ctx context.Context, params model.AuditListParams) ([]model.AuditEntry, error) {
+	entries := []model.AuditEntry{}
+
+	r.Store.read(ctx, func() {
+		for _, e := range r.Store.audit {
+			if len(entries) == params.Limit {
+				return
+			}
+
+			if params.UserID != nil && e.UserID != *params.UserID {
+				continue
+			}
+
+			if params.Actor != "" && e.Actor != params.Actor {
+				continue
+			}
+
+			if !params.Since.IsZero() && e.CreatedAt.Before(params.Since) {
+				continue
+			}
+
+			if e.ID <= params.After {
+				continue
+			}
+
+			entries = append(entries, e)
+		}
+	})
+
+	return entries, nil
+}
@@ -0,0 +1,136 @@
+package repository
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	model "github.com/klasrak/users-api/models"
+	"github.com/klasrak/users-api/rerrors"
+)
+
+// MemoryOutboxRepository is an in-memory implementation of service layer
+// OutboxRepository interface, keeping the outbox in a MemoryStore
+type MemoryOutboxRepository struct {
+	Store *MemoryStore
+}
+
+// Append adds events to the end of the outbox, in order. It must run within
+// a transaction (see MemoryTransactor), so the events are only kept along
+// with the changes they announce
+func (r *MemoryOutboxRepository) Append(ctx context.Context, events []*model.Event) error {
+	if _, ok := r.Store.tx(ctx); !ok {
+		log.Println("unable to append event: not within a transaction")
+		return rerrors.NewInternal()
+	}
+
+	return r.Store.write(ctx, func(tx *memTx) error {
+		for _, e := range events {
+			r.Store.outboxSeq++
+			e.Seq = r.Store.outboxSeq
+
+			r.Store.outbox = append(r.Store.outbox, *e)
+		}
+
+		return nil
+	})
+}
+
+// Lease acquires the lease on the outbox for holder until the given time,
+// or renews it when holder already holds it. It reports whether holder
+// holds the lease, which is only acquired once it expired
+func (r *MemoryOutboxRepository) Lease(ctx context.Context, holder string, now, until time.Time) (bool, error) {
+	var held bool
+
+	err := r.Store.write(ctx, func(tx *memTx) error {
+		if r.Store.leaseHolder != holder && !r.Store.leaseExpiresAt.Before(now) {
+			return nil
+		}
+
+		r.Store.leaseHolder = holder
+		r.Store.leaseExpiresAt = until
+		held = true
+
+		return nil
+	})
+
+	return held, err
+}
+
+// Release gives up the lease on the outbox, if holder holds it
+func (r *MemoryOutboxRepository) Release(ctx context.Context, holder string) error {
+	return r.Store.write(ctx, func(tx *memTx) error {
+		if r.Store.leaseHolder == holder {
+			r.Store.leaseHolder = ""
+			r.Store.leaseExpiresAt = time.Time{}
+		}
+
+		return nil
+	})
+}
+
+// Pending returns up to limit events that may be published at now, oldest
+// first. Events waiting for an earlier event of their user to be retried
+// are left out, so that the events of a user are published in order
+func (r *MemoryOutboxRepository) Pending(ctx context.Context, now time.Time, limit int) ([]*model.Event, error) {
+	events := []*model.Event{}
+
+	r.Store.read(ctx, func() {
+		// users with an event waiting to be retried
+		waiting := map[uuid.UUID]bool{}
+
+		for _, e := range r.Store.outbox {
+			if len(events) == limit {
+				return
+			}
+
+			if e.AvailableAt.After(now) {
+				waiting[e.UserID] = true
+				continue
+			}
+
+			if waiting[e.UserID] {
+				continue
+			}
+
+			e := e
+			events = append(events, &e)
+		}
+	})
+
+	return events, nil
+}
+
+// Delivered removes a published event from the outbox
+func (r *MemoryOutboxRepository) Delivered(ctx context.Context, e *model.Event) error {
+	return r.Store.write(ctx, func(tx *memTx) error {
+		for i := range r.Store.outbox {
+			if r.Store.outbox[i].Seq == e.Seq {
+				r.Store.outbox = append(r.Store.outbox[:i], r.Store.outbox[i+1:]...)
+				break
+			}
+		}
+
+		return nil
+	})
+}
+
+// Retry records a failed attempt to publish an event, so that it is
+// published again at the given time
+func (r *MemoryOutboxRepository) Retry(ctx context.Context, e *model.Event, at time.Time, reason string) error {
+	return r.Store.write(ctx, func(tx *memTx) error {
+		for i := range r.Store.outbox {
+			if r.Store.outbox[i].Seq == e.Seq {
+				r.Store.outbox[i].Attempts++
+				r.Store.outbox[i].AvailableAt = at
+				break
+			}
+		}
+
+		e.Attempts++
+		e.AvailableAt = at
+
+		return nil
+	})
+}
@@ -0,0 +1,169 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	model "github.com/klasrak/users-api/models"
+	"github.com/klasrak/users-api/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testOutboxRepository checks the behaviour every OutboxRepository shares.
+// newRepository returns an outbox over an empty database, and the
+// Transactor of that database
+func testOutboxRepository(t *testing.T, newRepository func(t *testing.T) (service.OutboxRepository, service.Transactor)) {
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Microsecond)
+
+	// appended appends an event for each user, in order, within a transaction
+	appended := func(t *testing.T, outbox service.OutboxRepository, tr service.Transactor, users ...uuid.UUID) []*model.Event {
+		events := make([]*model.Event, len(users))
+
+		for i, id := range users {
+			events[i] = model.NewEvent(model.EventUserUpdated, &model.User{UID: id, Name: "João", Version: i + 1})
+		}
+
+		require.NoError(t, tr.WithinTx(ctx, func(ctx context.Context) error {
+			return outbox.Append(ctx, events)
+		}))
+
+		return events
+	}
+
+	ids := func(events []*model.Event) []uuid.UUID {
+		list := make([]uuid.UUID, len(events))
+
+		for i, e := range events {
+			list[i] = e.ID
+		}
+
+		return list
+	}
+
+	t.Run("Pending events in order", func(t *testing.T) {
+		outbox, tr := newRepository(t)
+
+		a, b := uuid.New(), uuid.New()
+		events := appended(t, outbox, tr, a, b, a)
+
+		pending, err := outbox.Pending(ctx, time.Now(), 10)
+
+		require.NoError(t, err)
+		assert.Equal(t, ids(events), ids(pending))
+		assert.Equal(t, model.EventUserUpdated, pending[0].Type)
+		assert.Equal(t, a, pending[0].UserID)
+		assert.Equal(t, events[2].User, pending[2].User)
+		assert.True(t, events[0].OccurredAt.Equal(pending[0].OccurredAt))
+		assert.Less(t, pending[0].Seq, pending[1].Seq)
+
+		pending, err = outbox.Pending(ctx, time.Now(), 2)
+
+		require.NoError(t, err)
+		assert.Equal(t, ids(events[:2]), ids(pending))
+	})
+
+	t.Run("Events are only appended within transactions", func(t *testing.T) {
+		outbox, tr := newRepository(t)
+
+		assert.Error(t, outbox.Append(ctx, []*model.Event{model.NewEvent(model.EventUserCreated, &model.User{UID: uuid.New()})}))
+
+		err := tr.WithinTx(ctx, func(ctx context.Context) error {
+			if err := outbox.Append(ctx, []*model.Event{model.NewEvent(model.EventUserCreated, &model.User{UID: uuid.New()})}); err != nil {
+				return err
+			}
+
+			return errors.New("failed")
+		})
+
+		assert.Error(t, err)
+
+		pending, err := outbox.Pending(ctx, time.Now(), 10)
+
+		require.NoError(t, err)
+		assert.Empty(t, pending)
+	})
+
+	t.Run("Retried events hold back their user", func(t *testing.T) {
+		outbox, tr := newRepository(t)
+
+		a, b := uuid.New(), uuid.New()
+		events := appended(t, outbox, tr, a, b, a)
+
+		pending, err := outbox.Pending(ctx, time.Now(), 10)
+		require.NoError(t, err)
+
+		retryAt := now.Add(time.Hour)
+
+		require.NoError(t, outbox.Retry(ctx, pending[0], retryAt, "connection refused"))
+		assert.Equal(t, 1, pending[0].Attempts)
+
+		pending, err = outbox.Pending(ctx, time.Now(), 10)
+
+		require.NoError(t, err)
+		assert.Equal(t, ids(events[1:2]), ids(pending))
+
+		pending, err = outbox.Pending(ctx, retryAt, 10)
+
+		require.NoError(t, err)
+		assert.Equal(t, ids(events), ids(pending))
+		assert.Equal(t, 1, pending[0].Attempts)
+	})
+
+	t.Run("Delivered events are removed", func(t *testing.T) {
+		outbox, tr := newRepository(t)
+
+		events := appended(t, outbox, tr, uuid.New(), uuid.New())
+
+		pending, err := outbox.Pending(ctx, time.Now(), 10)
+		require.NoError(t, err)
+
+		require.NoError(t, outbox.Delivered(ctx, pending[0]))
+
+		pending, err = outbox.Pending(ctx, time.Now(), 10)
+
+		require.NoError(t, err)
+		assert.Equal(t, ids(events[1:]), ids(pending))
+	})
+
+	t.Run("Lease", func(t *testing.T) {
+		outbox, _ := newRepository(t)
+
+		held, err := outbox.Lease(ctx, "a", now, now.Add(time.Minute))
+		require.NoError(t, err)
+		assert.True(t, held)
+
+		// until it expires, only its holder can renew it
+		held, err = outbox.Lease(ctx, "b", now.Add(30*time.Second), now.Add(90*time.Second))
+		require.NoError(t, err)
+		assert.False(t, held)
+
+		held, err = outbox.Lease(ctx, "a", now.Add(30*time.Second), now.Add(90*time.Second))
+		require.NoError(t, err)
+		assert.True(t, held)
+
+		held, err = outbox.Lease(ctx, "b", now.Add(2*time.Minute), now.Add(3*time.Minute))
+		require.NoError(t, err)
+		assert.True(t, held)
+
+		// releasing hands it over right away
+		require.NoError(t, outbox.Release(ctx, "a"))
+		require.NoError(t, outbox.Release(ctx, "b"))
+
+		held, err = outbox.Lease(ctx, "a", now.Add(2*time.Minute), now.Add(3*time.Minute))
+		require.NoError(t, err)
+		assert.True(t, held)
+	})
+}
+
+func TestMemoryOutboxRepository(t *testing.T) {
+	testOutboxRepository(t, func(t *testing.T) (service.OutboxRepository, service.Transactor) {
+		r := CreateMemoryRepository()
+
+		return r.OutboxRepository, r.Transactor
+	})
+}
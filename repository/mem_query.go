@@ -0,0 +1,408 @@
+package repository
+
+import (
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+	"github.com/klasrak/users-api/filter"
+	model "github.com/klasrak/users-api/models"
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// memQuery selects and orders users in memory the way user listings do in
+// SQL. Names are compared with the Brazilian Portuguese collation, as with
+// the pt_br collation in Postgres
+type memQuery struct {
+	keys     []sortKey
+	match    []func(u *model.User) bool
+	collator *collate.Collator
+}
+
+// newMemQuery builds the query for a listing, failing as the SQL listing
+// would on an unknown sort or a bad filter
+func newMemQuery(params model.UserListParams) (*memQuery, error) {
+	keys, err := userSortKeys(params.Sort, userSortColumns)
+
+	if err != nil {
+		return nil, err
+	}
+
+	q := &memQuery{keys: keys, collator: collate.New(language.BrazilianPortuguese)}
+
+	if !params.IncludeDeleted {
+		q.match = append(q.match, func(u *model.User) bool { return u.DeletedAt == nil })
+	}
+
+	if params.Name != "" {
+		name := fold(params.Name)
+
+		q.match = append(q.match, func(u *model.User) bool { return strings.Contains(fold(u.Name), name) })
+	}
+
+	if params.Filter != "" {
+		n, err := filter.Parse(params.Filter)
+
+		if err != nil {
+			return nil, err
+		}
+
+		match, err := q.compileFilter(n)
+
+		if err != nil {
+			return nil, err
+		}
+
+		q.match = append(q.match, match)
+	}
+
+	return q, nil
+}
+
+// memRow is a user along with the values of its sort keys
+type memRow struct {
+	user   model.User
+	values []string
+}
+
+// run returns the users matching the query, in order. The collator is not
+// safe for concurrent use, so neither is run
+func (q *memQuery) run(users map[uuid.UUID]model.User) []memRow {
+	rows := []memRow{}
+
+	for _, u := range users {
+		u := u
+
+		if q.matches(&u) {
+			rows = append(rows, memRow{user: u, values: sortValues(q.keys, u)})
+		}
+	}
+
+	sort.Slice(rows, func(i, j int) bool {
+		return q.compareRows(rows[i].values, rows[j].values) < 0
+	})
+
+	return rows
+}
+
+func (q *memQuery) matches(u *model.User) bool {
+	for _, match := range q.match {
+		if !match(u) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// compareRows compares the sort values of two rows in the order of the keys
+func (q *memQuery) compareRows(a, b []string) int {
+	for i, k := range q.keys {
+		c := q.compare(k.field, a[i], b[i])
+
+		if k.desc {
+			c = -c
+		}
+
+		if c != 0 {
+			return c
+		}
+	}
+
+	return 0
+}
+
+// compare compares two values of a field, as given by fieldValue. Ids and
+// dates are formatted so that they sort as text
+func (q *memQuery) compare(field, a, b string) int {
+	if field == "name" {
+		if c := q.collator.CompareString(a, b); c != 0 {
+			return c
+		}
+	}
+
+	return strings.Compare(a, b)
+}
+
+// compileFilter compiles a parsed filter into a predicate, rejecting the
+// same filters compileFilter rejects with the same errors
+func (q *memQuery) compileFilter(n filter.Node) (func(u *model.User) bool, error) {
+	switch n := n.(type) {
+	case *filter.And:
+		l, r, err := q.compileBinary(n.Left, n.Right)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return func(u *model.User) bool { return l(u) && r(u) }, nil
+
+	case *filter.Or:
+		l, r, err := q.compileBinary(n.Left, n.Right)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return func(u *model.User) bool { return l(u) || r(u) }, nil
+
+	case *filter.Not:
+		expr, err := q.compileFilter(n.Expr)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return func(u *model.User) bool { return !expr(u) }, nil
+
+	case *filter.Comparison:
+		return q.compileComparison(n)
+	}
+
+	return nil, filter.Errorf(n.Pos(), "unsupported expression")
+}
+
+func (q *memQuery) compileBinary(left, right filter.Node) (func(u *model.User) bool, func(u *model.User) bool, error) {
+	l, err := q.compileFilter(left)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	r, err := q.compileFilter(right)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return l, r, nil
+}
+
+func (q *memQuery) compileComparison(c *filter.Comparison) (func(u *model.User) bool, error) {
+	name := strings.ToLower(c.Field)
+
+	field, ok := userFilterFields[name]
+
+	if !ok {
+		return nil, filter.Errorf(c.At, "unknown field %q", c.Field)
+	}
+
+	switch c.Op {
+	case filter.Contains, filter.StartsWith, filter.EndsWith:
+		if field.kind != textField {
+			return nil, filter.Errorf(c.OpAt, "operator %q can't be used with field %q", c.Op, c.Field)
+		}
+
+		// like their SQL counterparts, names ignore case and accents,
+		// e-mails ignore case and cpfs are matched as they are
+		normalize := func(s string) string { return s }
+
+		switch name {
+		case "name":
+			normalize = fold
+		case "email":
+			normalize = strings.ToLower
+		}
+
+		pattern := normalize(c.Values[0].Text)
+
+		test := strings.Contains
+
+		switch c.Op {
+		case filter.StartsWith:
+			test = strings.HasPrefix
+		case filter.EndsWith:
+			test = strings.HasSuffix
+		}
+
+		return func(u *model.User) bool { return test(normalize(fieldValue(*u, name)), pattern) }, nil
+	}
+
+	values := make([]string, len(c.Values))
+
+	for i, v := range c.Values {
+		value, err := filterValue(field, v)
+
+		if err != nil {
+			return nil, err
+		}
+
+		switch value := value.(type) {
+		case time.Time:
+			values[i] = value.Format("2006-01-02")
+		case uuid.UUID:
+			values[i] = value.String()
+		default:
+			values[i] = v.Text
+		}
+	}
+
+	cmp := func(u *model.User, v string) int { return q.compare(name, fieldValue(*u, name), v) }
+
+	switch c.Op {
+	case filter.Between:
+		return func(u *model.User) bool { return cmp(u, values[0]) >= 0 && cmp(u, values[1]) <= 0 }, nil
+
+	case filter.In:
+		return func(u *model.User) bool {
+			for _, v := range values {
+				if cmp(u, v) == 0 {
+					return true
+				}
+			}
+
+			return false
+		}, nil
+
+	case filter.Eq:
+		return func(u *model.User) bool { return cmp(u, values[0]) == 0 }, nil
+	case filter.Ne:
+		return func(u *model.User) bool { return cmp(u, values[0]) != 0 }, nil
+	case filter.Gt:
+		return func(u *model.User) bool { return cmp(u, values[0]) > 0 }, nil
+	case filter.Ge:
+		return func(u *model.User) bool { return cmp(u, values[0]) >= 0 }, nil
+	case filter.Lt:
+		return func(u *model.User) bool { return cmp(u, values[0]) < 0 }, nil
+	case filter.Le:
+		return func(u *model.User) bool { return cmp(u, values[0]) <= 0 }, nil
+	}
+
+	return nil, filter.Errorf(c.OpAt, "unsupported operator %q", c.Op)
+}
+
+// fold lowercases s and strips its accents, as ILIKE over immutable_unaccent
+// does in SQL
+func fold(s string) string {
+	t := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+
+	folded, _, err := transform.String(t, s)
+
+	if err != nil {
+		return strings.ToLower(s)
+	}
+
+	return strings.ToLower(folded)
+}
+
+// searchWords splits text into its words, folded
+func searchWords(text string) []string {
+	return strings.FieldsFunc(fold(text), isNotWordRune)
+}
+
+func isNotWordRune(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+}
+
+// Weights of matches in the name and in the e-mail, as ts_rank weighs the A
+// and B parts of the search document
+const (
+	nameWeight  = 1.0
+	emailWeight = 0.4
+)
+
+// rankSearchResults orders search results best first, breaking ties by id,
+// and keeps at most limit of them
+func rankSearchResults(results []model.UserSearchResult, limit int) []model.UserSearchResult {
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Rank != results[j].Rank {
+			return results[i].Rank > results[j].Rank
+		}
+
+		return results[i].UID.String() < results[j].UID.String()
+	})
+
+	if len(results) > limit {
+		results = results[:limit]
+	}
+
+	return results
+}
+
+// memSearch matches u against the words of a search. Every word must start
+// a word of the name or of the e-mail. Unlike the Postgres search, words
+// are not stemmed
+func memSearch(u model.User, words []string) (model.UserSearchResult, bool) {
+	name, email := searchWords(u.Name), searchWords(u.Email)
+
+	result := model.UserSearchResult{User: u}
+
+	for _, w := range words {
+		switch {
+		case startsAny(name, w):
+			result.Rank += nameWeight
+		case startsAny(email, w):
+			result.Rank += emailWeight
+		default:
+			return result, false
+		}
+	}
+
+	result.Rank /= float64(len(words))
+	result.NameHighlight = highlight(u.Name, words)
+	result.EmailHighlight = highlight(u.Email, words)
+
+	return result, true
+}
+
+// startsAny reports whether any of the words starts with prefix
+func startsAny(words []string, prefix string) bool {
+	for _, w := range words {
+		if strings.HasPrefix(w, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// highlight wraps the words of text starting with any of the search words
+// in <mark> tags, as ts_headline does with headlineOptions
+func highlight(text string, words []string) string {
+	var b strings.Builder
+
+	rs := []rune(text)
+
+	for i := 0; i < len(rs); {
+		j := i
+
+		for j < len(rs) && !isNotWordRune(rs[j]) {
+			j++
+		}
+
+		if j == i {
+			b.WriteRune(rs[i])
+			i++
+			continue
+		}
+
+		word := string(rs[i:j])
+
+		if matchesAny(fold(word), words) {
+			b.WriteString("<mark>" + word + "</mark>")
+		} else {
+			b.WriteString(word)
+		}
+
+		i = j
+	}
+
+	return b.String()
+}
+
+// matchesAny reports whether word starts with any of the search words
+func matchesAny(word string, words []string) bool {
+	for _, w := range words {
+		if strings.HasPrefix(word, w) {
+			return true
+		}
+	}
+
+	return false
+}
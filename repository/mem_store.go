@@ -0,0 +1,235 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	model "github.com/klasrak/users-api/models"
+	"github.com/klasrak/users-api/utils"
+)
+
+// MemoryStore keeps users, the audit log, the outbox and webhooks in memory.
+// Transactions hold the whole store until they end, so they never see each
+// other's changes, and whatever they changed is undone when they fail
+type MemoryStore struct {
+	mu    sync.RWMutex
+	users map[uuid.UUID]model.User
+	// emails and cpfs index the active users, which must be unique
+	emails map[string]uuid.UUID
+	cpfs   map[string]uuid.UUID
+	audit  []model.AuditEntry
+	outbox []model.Event
+	// outboxSeq is the Seq of the last event appended to the outbox
+	outboxSeq int64
+	// leaseHolder holds the lease on the outbox until leaseExpiresAt
+	leaseHolder    string
+	leaseExpiresAt time.Time
+	// webhooks and their deliveries, by id
+	webhooks   map[uuid.UUID]model.Webhook
+	deliveries map[uuid.UUID]model.WebhookDelivery
+}
+
+// NewMemoryStore returns an empty store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		users:      map[uuid.UUID]model.User{},
+		emails:     map[string]uuid.UUID{},
+		cpfs:       map[string]uuid.UUID{},
+		webhooks:   map[uuid.UUID]model.Webhook{},
+		deliveries: map[uuid.UUID]model.WebhookDelivery{},
+	}
+}
+
+type memTxKey struct{}
+
+// memTx is a transaction over a MemoryStore. It remembers how the store was
+// before the transaction changed it
+type memTx struct {
+	store *MemoryStore
+	// users holds the previous state of every changed user, nil when the
+	// user did not exist
+	users     map[uuid.UUID]*model.User
+	auditLen  int
+	outboxLen int
+	// webhooks and deliveries hold the previous state of every changed
+	// webhook and delivery, nil when it did not exist
+	webhooks   map[uuid.UUID]*model.Webhook
+	deliveries map[uuid.UUID]*model.WebhookDelivery
+}
+
+// tx returns the transaction over s carried by ctx
+func (s *MemoryStore) tx(ctx context.Context) (*memTx, bool) {
+	tx, ok := ctx.Value(memTxKey{}).(*memTx)
+
+	if !ok || tx.store != s {
+		return nil, false
+	}
+
+	return tx, true
+}
+
+// begin starts a transaction. The store must be held
+func (s *MemoryStore) begin() *memTx {
+	return &memTx{
+		store:      s,
+		users:      map[uuid.UUID]*model.User{},
+		auditLen:   len(s.audit),
+		outboxLen:  len(s.outbox),
+		webhooks:   map[uuid.UUID]*model.Webhook{},
+		deliveries: map[uuid.UUID]*model.WebhookDelivery{},
+	}
+}
+
+// rollback undoes every change made in tx. The store must be held
+func (s *MemoryStore) rollback(tx *memTx) {
+	for id, prev := range tx.users {
+		s.set(id, prev)
+	}
+
+	s.audit = s.audit[:tx.auditLen]
+	s.outbox = s.outbox[:tx.outboxLen]
+
+	for id, prev := range tx.webhooks {
+		if prev == nil {
+			delete(s.webhooks, id)
+		} else {
+			s.webhooks[id] = *prev
+		}
+	}
+
+	for id, prev := range tx.deliveries {
+		if prev == nil {
+			delete(s.deliveries, id)
+		} else {
+			s.deliveries[id] = *prev
+		}
+	}
+}
+
+// read runs fn while no one changes the store
+func (s *MemoryStore) read(ctx context.Context, fn func()) {
+	if _, ok := s.tx(ctx); ok {
+		fn()
+		return
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	fn()
+}
+
+// write runs fn holding the store, within the transaction carried by ctx or
+// a transaction of its own. Nothing fn changed is kept when it fails
+func (s *MemoryStore) write(ctx context.Context, fn func(tx *memTx) error) error {
+	if tx, ok := s.tx(ctx); ok {
+		return fn(tx)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx := s.begin()
+
+	if err := fn(tx); err != nil {
+		s.rollback(tx)
+		return err
+	}
+
+	return nil
+}
+
+// put stores u within tx
+func (s *MemoryStore) put(tx *memTx, u model.User) {
+	tx.save(u.UID)
+	s.set(u.UID, &u)
+}
+
+// remove drops the user with the given id within tx
+func (s *MemoryStore) remove(tx *memTx, id uuid.UUID) {
+	tx.save(id)
+	s.set(id, nil)
+}
+
+// save remembers the state of a user before the transaction first changes it
+func (tx *memTx) save(id uuid.UUID) {
+	if _, ok := tx.users[id]; ok {
+		return
+	}
+
+	var prev *model.User
+
+	if u, ok := tx.store.users[id]; ok {
+		prev = &u
+	}
+
+	tx.users[id] = prev
+}
+
+// set replaces the user with the given id, or drops it when u is nil,
+// keeping the indexes of active users up to date
+func (s *MemoryStore) set(id uuid.UUID, u *model.User) {
+	if old, ok := s.users[id]; ok && old.DeletedAt == nil {
+		// while a transaction is undone another user may already hold them
+		if s.emails[old.Email] == id {
+			delete(s.emails, old.Email)
+		}
+
+		if s.cpfs[old.Cpf] == id {
+			delete(s.cpfs, old.Cpf)
+		}
+	}
+
+	if u == nil {
+		delete(s.users, id)
+		return
+	}
+
+	s.users[id] = *u
+
+	if u.DeletedAt == nil {
+		s.emails[u.Email] = id
+		s.cpfs[u.Cpf] = id
+	}
+}
+
+// MemoryTransactor is the in-memory counterpart of Transactor
+type MemoryTransactor struct {
+	Store *MemoryStore
+}
+
+// WithinTx runs fn within a transaction, keeping its changes when fn
+// succeeds and undoing them otherwise. Nested calls join the outer
+// transaction, and what fn hands to utils.AfterTx runs once it ends
+func (t *MemoryTransactor) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return t.within(ctx, fn)
+}
+
+// WithinSnapshot runs fn within a transaction. Transactions hold the whole
+// store, so every read within it agrees with the others
+func (t *MemoryTransactor) WithinSnapshot(ctx context.Context, fn func(ctx context.Context) error) error {
+	return t.within(ctx, fn)
+}
+
+func (t *MemoryTransactor) within(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := t.Store.tx(ctx); ok {
+		return fn(ctx)
+	}
+
+	ctx, ended := utils.WithTxEnd(ctx)
+	defer ended()
+
+	t.Store.mu.Lock()
+	defer t.Store.mu.Unlock()
+
+	tx := t.Store.begin()
+
+	if err := fn(context.WithValue(ctx, memTxKey{}, tx)); err != nil {
+		t.Store.rollback(tx)
+		return err
+	}
+
+	return nil
+}
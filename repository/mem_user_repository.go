@@ -0,0 +1,429 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	model "github.com/klasrak/users-api/models"
+	"github.com/klasrak/users-api/rerrors"
+)
+
+// MemoryUserRepository is an in-memory implementation of service layer
+// UserRepository interface. It behaves like UserRepository, failing with
+// the same errors, but keeps users in a MemoryStore
+type MemoryUserRepository struct {
+	Store *MemoryStore
+}
+
+// GetAll returns a page of users, as UserRepository.GetAll does
+func (r *MemoryUserRepository) GetAll(ctx context.Context, params model.UserListParams) (*model.UserPage, error) {
+	page := &model.UserPage{Data: []model.User{}}
+
+	q, err := newMemQuery(params)
+
+	if err != nil {
+		return page, err
+	}
+
+	var rows []memRow
+
+	r.Store.read(ctx, func() {
+		rows = q.run(r.Store.users)
+	})
+
+	if params.Paged() {
+		page.Page = params.Page
+		page.PerPage = params.PerPage
+
+		total := len(rows)
+		page.Total = &total
+
+		rows = rows[minInt((params.Page-1)*params.PerPage, len(rows)):]
+		rows = rows[:minInt(params.PerPage, len(rows))]
+
+		page.Data = users(rows)
+
+		return page, nil
+	}
+
+	if params.Cursor != "" {
+		values, err := readCursor(params.Cursor, params.Sort, q.keys)
+
+		if err != nil {
+			return page, err
+		}
+
+		after := sort.Search(len(rows), func(i int) bool {
+			return q.compareRows(rows[i].values, values) > 0
+		})
+
+		rows = rows[after:]
+	}
+
+	if len(rows) > params.Limit {
+		rows = rows[:params.Limit]
+		page.NextCursor = encodeCursor(cursor{
+			Sort:   params.Sort.String(),
+			Values: rows[len(rows)-1].values,
+		})
+	}
+
+	page.Data = users(rows)
+
+	return page, nil
+}
+
+// users returns the users of the rows
+func users(rows []memRow) []model.User {
+	users := make([]model.User, len(rows))
+
+	for i, row := range rows {
+		users[i] = row.user
+	}
+
+	return users
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+
+	return b
+}
+
+// Stream calls fn with every user a listing with params would return, in
+// the same order. The users are picked before fn is first called, so slow
+// consumers don't hold the store
+func (r *MemoryUserRepository) Stream(ctx context.Context, params model.UserListParams, fn func(u *model.User) error) error {
+	q, err := newMemQuery(params)
+
+	if err != nil {
+		return err
+	}
+
+	var rows []memRow
+
+	r.Store.read(ctx, func() {
+		rows = q.run(r.Store.users)
+	})
+
+	for i := range rows {
+		if err := fn(&rows[i].user); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Search finds active users whose name or e-mail has words starting with
+// every word of q, ignoring case and accents. Results are ranked by where
+// the words were found, names first, and carry highlighted names and e-mails
+func (r *MemoryUserRepository) Search(ctx context.Context, q string, limit int) ([]model.UserSearchResult, error) {
+	results := []model.UserSearchResult{}
+
+	words := searchWords(q)
+
+	if len(words) == 0 {
+		return results, rerrors.NewBadRequest("search must contain at least one letter or digit")
+	}
+
+	r.Store.read(ctx, func() {
+		for _, u := range r.Store.users {
+			if u.DeletedAt != nil {
+				continue
+			}
+
+			if result, ok := memSearch(u, words); ok {
+				results = append(results, result)
+			}
+		}
+	})
+
+	return rankSearchResults(results, limit), nil
+}
+
+// GetByID fetches user by ID or return error. Deleted users are reported as
+// not found unless includeDeleted is set
+func (r *MemoryUserRepository) GetByID(ctx context.Context, id uuid.UUID, includeDeleted bool) (*model.User, error) {
+	var (
+		u  model.User
+		ok bool
+	)
+
+	r.Store.read(ctx, func() {
+		u, ok = r.Store.users[id]
+	})
+
+	if !ok || (u.DeletedAt != nil && !includeDeleted) {
+		return &model.User{}, rerrors.NewNotFound("id", id.String())
+	}
+
+	return &u, nil
+}
+
+// Lock fetches a user, deleted or not. Transactions hold the whole store, so
+// no one else can change it until the transaction ends
+func (r *MemoryUserRepository) Lock(ctx context.Context, id uuid.UUID) (*model.User, error) {
+	var (
+		u  model.User
+		ok bool
+	)
+
+	r.Store.read(ctx, func() {
+		u, ok = r.Store.users[id]
+	})
+
+	if !ok {
+		return nil, rerrors.NewNotFound("user", id.String())
+	}
+
+	return &u, nil
+}
+
+// Create a user
+func (r *MemoryUserRepository) Create(ctx context.Context, u *model.User) (*model.User, error) {
+	created := model.User{
+		UID:       uuid.New(),
+		Name:      u.Name,
+		Email:     u.Email,
+		Cpf:       u.Cpf,
+		BirthDate: u.BirthDate,
+		Version:   1,
+	}
+
+	err := r.Store.write(ctx, func(tx *memTx) error {
+		if detail := r.Store.taken(created); detail != "" {
+			log.Printf("could not create user. Reason: %v\n", detail)
+			return rerrors.NewConflict("user", "created", detail)
+		}
+
+		r.Store.put(tx, created)
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	*u = created
+
+	return u, nil
+}
+
+// taken tells which unique field of u an active user other than u already
+// holds, in the words Postgres uses for unique violations, or "" when none
+// is. The store must be held
+func (s *MemoryStore) taken(u model.User) string {
+	if id, ok := s.emails[u.Email]; ok && id != u.UID {
+		return fmt.Sprintf("Key (email)=(%s) already exists.", u.Email)
+	}
+
+	if id, ok := s.cpfs[u.Cpf]; ok && id != u.UID {
+		return fmt.Sprintf("Key (cpf)=(%s) already exists.", u.Cpf)
+	}
+
+	return ""
+}
+
+// FindTaken returns the active users holding any of the given e-mails or cpfs
+func (r *MemoryUserRepository) FindTaken(ctx context.Context, emails, cpfs []string) ([]model.User, error) {
+	taken := []model.User{}
+
+	r.Store.read(ctx, func() {
+		ids := map[uuid.UUID]bool{}
+
+		for _, email := range emails {
+			if id, ok := r.Store.emails[email]; ok {
+				ids[id] = true
+			}
+		}
+
+		for _, cpf := range cpfs {
+			if id, ok := r.Store.cpfs[cpf]; ok {
+				ids[id] = true
+			}
+		}
+
+		for id := range ids {
+			taken = append(taken, r.Store.users[id])
+		}
+	})
+
+	return taken, nil
+}
+
+// CopyIn stores many new users at once. Users must come with their ids, and
+// are stored at version 1. It must run within a transaction (see
+// MemoryTransactor); when any user is taken it fails with a conflict, and as
+// with a failed COPY, the transaction must not be kept
+func (r *MemoryUserRepository) CopyIn(ctx context.Context, users []*model.User) error {
+	if _, ok := r.Store.tx(ctx); !ok {
+		log.Println("unable to copy users: not within a transaction")
+		return rerrors.NewInternal()
+	}
+
+	return r.Store.write(ctx, func(tx *memTx) error {
+		for _, u := range users {
+			copied := model.User{UID: u.UID, Name: u.Name, Email: u.Email, Cpf: u.Cpf, BirthDate: u.BirthDate, Version: 1}
+
+			detail := r.Store.taken(copied)
+
+			if _, ok := r.Store.users[u.UID]; ok {
+				detail = fmt.Sprintf("Key (id)=(%s) already exists.", u.UID)
+			}
+
+			if detail != "" {
+				log.Printf("could not copy users. Reason: %v\n", detail)
+				return rerrors.NewConflict("users", "imported", detail)
+			}
+
+			r.Store.put(tx, copied)
+		}
+
+		return nil
+	})
+}
+
+// Update replaces every field of a user, as UserRepository.Update does
+func (r *MemoryUserRepository) Update(ctx context.Context, u *model.User) (*model.User, error) {
+	var updated model.User
+
+	err := r.Store.write(ctx, func(tx *memTx) error {
+		current, ok := r.Store.users[u.UID]
+
+		if !ok || current.DeletedAt != nil {
+			return rerrors.NewNotFound("user", u.UID.String())
+		}
+
+		if current.Version != u.Version {
+			return rerrors.NewPreconditionFailed(fmt.Sprintf("user is at version %d, not %d", current.Version, u.Version))
+		}
+
+		updated = current
+		updated.Name = u.Name
+		updated.Email = u.Email
+		updated.Cpf = u.Cpf
+		updated.BirthDate = u.BirthDate
+		updated.Version++
+
+		if detail := r.Store.taken(updated); detail != "" {
+			log.Printf("could not update user. Reason: %v\n", detail)
+			return rerrors.NewConflict("user", "updated", detail)
+		}
+
+		r.Store.put(tx, updated)
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &updated, nil
+}
+
+// Delete marks a user as deleted. The user is kept so it can be restored
+func (r *MemoryUserRepository) Delete(ctx context.Context, id string) error {
+	uid, err := parseMemID(id)
+
+	if err != nil {
+		return err
+	}
+
+	return r.Store.write(ctx, func(tx *memTx) error {
+		u, ok := r.Store.users[uid]
+
+		if !ok || u.DeletedAt != nil {
+			return rerrors.NewNotFound("user", id)
+		}
+
+		now := time.Now()
+
+		u.DeletedAt = &now
+		u.Version++
+
+		r.Store.put(tx, u)
+
+		return nil
+	})
+}
+
+// Restore undoes the deletion of a user. Restoring fails with a conflict when
+// another active user took the e-mail or cpf in the meantime
+func (r *MemoryUserRepository) Restore(ctx context.Context, id string) (*model.User, error) {
+	uid, err := parseMemID(id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var restored model.User
+
+	err = r.Store.write(ctx, func(tx *memTx) error {
+		u, ok := r.Store.users[uid]
+
+		if !ok || u.DeletedAt == nil {
+			return rerrors.NewNotFound("deleted user", id)
+		}
+
+		if detail := r.Store.taken(u); detail != "" {
+			log.Printf("could not restore user. Reason: %v\n", detail)
+			return rerrors.NewConflict("user", "restored", detail)
+		}
+
+		u.DeletedAt = nil
+		u.Version++
+
+		r.Store.put(tx, u)
+
+		restored = u
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &restored, nil
+}
+
+// Purge removes a user for good, whether it was deleted before or not
+func (r *MemoryUserRepository) Purge(ctx context.Context, id string) error {
+	uid, err := parseMemID(id)
+
+	if err != nil {
+		return err
+	}
+
+	return r.Store.write(ctx, func(tx *memTx) error {
+		if _, ok := r.Store.users[uid]; !ok {
+			return rerrors.NewNotFound("user", id)
+		}
+
+		r.Store.remove(tx, uid)
+
+		return nil
+	})
+}
+
+// parseMemID parses the id of a user. Postgres fails on malformed ids, which
+// surfaces as an internal error, and so does this
+func parseMemID(id string) (uuid.UUID, error) {
+	uid, err := uuid.Parse(id)
+
+	if err != nil {
+		log.Printf("invalid user id %q: %v\n", id, err)
+		return uid, rerrors.NewInternal()
+	}
+
+	return uid, nil
+}
@@ -0,0 +1,392 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	model "github.com/klasrak/users-api/models"
+	"github.com/klasrak/users-api/rerrors"
+	"github.com/stretchr/testify/assert"
+)
+
+func newMemUser(name, email, cpf string) *model.User {
+	return &model.User{Name: name, Email: email, Cpf: cpf, BirthDate: time.Date(1990, 1, 31, 0, 0, 0, 0, time.UTC)}
+}
+
+// seedMemUsers creates a user for each name, with made up e-mails and cpfs
+func seedMemUsers(t *testing.T, r *MemoryUserRepository, names ...string) []*model.User {
+	users := make([]*model.User, len(names))
+
+	for i, name := range names {
+		u, err := r.Create(context.Background(), newMemUser(name, uuid.NewString()+"@mail.com", uuid.NewString()))
+
+		assert.NoError(t, err)
+
+		users[i] = u
+	}
+
+	return users
+}
+
+func names(users []model.User) []string {
+	names := make([]string, len(users))
+
+	for i, u := range users {
+		names[i] = u.Name
+	}
+
+	return names
+}
+
+func TestMemoryUserRepository(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Create and get", func(t *testing.T) {
+		r := CreateMemoryRepository().UserRepository
+
+		created, err := r.Create(ctx, newMemUser("João", "joao@mail.com", "313.716.772-80"))
+
+		assert.NoError(t, err)
+		assert.NotEqual(t, uuid.Nil, created.UID)
+		assert.Equal(t, 1, created.Version)
+
+		u, err := r.GetByID(ctx, created.UID, false)
+
+		assert.NoError(t, err)
+		assert.Equal(t, created, u)
+
+		id := uuid.New()
+
+		_, err = r.GetByID(ctx, id, false)
+		assert.Equal(t, rerrors.NewNotFound("id", id.String()), err)
+	})
+
+	t.Run("Active users must be unique", func(t *testing.T) {
+		r := CreateMemoryRepository().UserRepository
+
+		joao, err := r.Create(ctx, newMemUser("João", "joao@mail.com", "313.716.772-80"))
+		assert.NoError(t, err)
+
+		_, err = r.Create(ctx, newMemUser("Outro João", "joao@mail.com", "648.173.761-39"))
+		assert.Equal(t, rerrors.NewConflict("user", "created", "Key (email)=(joao@mail.com) already exists."), err)
+
+		_, err = r.Create(ctx, newMemUser("Outro João", "outro@mail.com", "313.716.772-80"))
+		assert.Equal(t, rerrors.NewConflict("user", "created", "Key (cpf)=(313.716.772-80) already exists."), err)
+
+		// deleted users don't hold their e-mail and cpf
+		assert.NoError(t, r.Delete(ctx, joao.UID.String()))
+
+		again, err := r.Create(ctx, newMemUser("João", "joao@mail.com", "313.716.772-80"))
+		assert.NoError(t, err)
+
+		_, err = r.Restore(ctx, joao.UID.String())
+		assert.Equal(t, rerrors.NewConflict("user", "restored", "Key (email)=(joao@mail.com) already exists."), err)
+
+		assert.NoError(t, r.Purge(ctx, again.UID.String()))
+
+		restored, err := r.Restore(ctx, joao.UID.String())
+		assert.NoError(t, err)
+		assert.Nil(t, restored.DeletedAt)
+		assert.Equal(t, 3, restored.Version)
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		r := CreateMemoryRepository().UserRepository
+
+		users := seedMemUsers(t, r, "João", "Maria")
+
+		u := *users[0]
+		u.Name = "João Silva"
+
+		updated, err := r.Update(ctx, &u)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "João Silva", updated.Name)
+		assert.Equal(t, 2, updated.Version)
+
+		_, err = r.Update(ctx, &u)
+		assert.Equal(t, rerrors.NewPreconditionFailed("user is at version 2, not 1"), err)
+
+		u.Version = 2
+		u.Email = users[1].Email
+
+		_, err = r.Update(ctx, &u)
+		assert.Equal(t, rerrors.NewConflict("user", "updated", "Key (email)=("+users[1].Email+") already exists."), err)
+
+		u.UID = uuid.New()
+
+		_, err = r.Update(ctx, &u)
+		assert.Equal(t, rerrors.NewNotFound("user", u.UID.String()), err)
+	})
+
+	t.Run("Delete, restore and purge", func(t *testing.T) {
+		r := CreateMemoryRepository().UserRepository
+
+		u := seedMemUsers(t, r, "João")[0]
+		id := u.UID.String()
+
+		_, err := r.Restore(ctx, id)
+		assert.Equal(t, rerrors.NewNotFound("deleted user", id), err)
+
+		assert.NoError(t, r.Delete(ctx, id))
+		assert.Equal(t, rerrors.NewNotFound("user", id), r.Delete(ctx, id))
+
+		_, err = r.GetByID(ctx, u.UID, false)
+		assert.Error(t, err)
+
+		deleted, err := r.GetByID(ctx, u.UID, true)
+		assert.NoError(t, err)
+		assert.NotNil(t, deleted.DeletedAt)
+
+		assert.NoError(t, r.Purge(ctx, id))
+		assert.Equal(t, rerrors.NewNotFound("user", id), r.Purge(ctx, id))
+
+		assert.Equal(t, rerrors.NewInternal(), r.Delete(ctx, "not an id"))
+	})
+
+	t.Run("GetAll sorts, filters and paginates", func(t *testing.T) {
+		r := CreateMemoryRepository().UserRepository
+
+		users := seedMemUsers(t, r, "Zé", "álvaro", "Alvaro", "Bruna", "João", "Joana")
+
+		assert.NoError(t, r.Delete(ctx, users[3].UID.String()))
+
+		page, err := r.GetAll(ctx, model.UserListParams{Sort: model.Sort{{Field: "name"}}, Limit: 2})
+
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"Alvaro", "álvaro"}, names(page.Data))
+		assert.NotEmpty(t, page.NextCursor)
+
+		page, err = r.GetAll(ctx, model.UserListParams{Sort: model.Sort{{Field: "name"}}, Limit: 10, Cursor: page.NextCursor})
+
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"Joana", "João", "Zé"}, names(page.Data))
+		assert.Empty(t, page.NextCursor)
+
+		page, err = r.GetAll(ctx, model.UserListParams{Sort: model.Sort{{Field: "name", Desc: true}}, Page: 2, PerPage: 2, IncludeDeleted: true})
+
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"Joana", "Bruna"}, names(page.Data))
+		assert.Equal(t, 6, *page.Total)
+
+		page, err = r.GetAll(ctx, model.UserListParams{Name: "ALV", Limit: 10})
+
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, []string{"Alvaro", "álvaro"}, names(page.Data))
+
+		page, err = r.GetAll(ctx, model.UserListParams{Filter: `name starts_with "jo" and not name = 'Joana'`, Limit: 10})
+
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"João"}, names(page.Data))
+
+		page, err = r.GetAll(ctx, model.UserListParams{Filter: "birthdate between 1990-01-01 and 1990-12-31 and id in (" + users[0].UID.String() + ")", Limit: 10})
+
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"Zé"}, names(page.Data))
+	})
+
+	t.Run("GetAll fails as the SQL listing does", func(t *testing.T) {
+		r := CreateMemoryRepository().UserRepository
+
+		_, err := r.GetAll(ctx, model.UserListParams{Filter: "age > 18", Limit: 10})
+		assert.EqualError(t, err, `Bad request. Reason: invalid filter at position 1: unknown field "age"`)
+
+		_, err = r.GetAll(ctx, model.UserListParams{Filter: "birthdate contains 1990", Limit: 10})
+		assert.EqualError(t, err, `Bad request. Reason: invalid filter at position 11: operator "contains" can't be used with field "birthdate"`)
+
+		_, err = r.GetAll(ctx, model.UserListParams{Cursor: "nope", Limit: 10})
+		assert.Equal(t, rerrors.NewBadRequest("invalid cursor"), err)
+
+		_, err = r.GetAll(ctx, model.UserListParams{Cursor: encodeCursor(cursor{Sort: "name", Values: []string{"a"}}), Limit: 10})
+		assert.Equal(t, rerrors.NewBadRequest("cursor was created with a different sort"), err)
+	})
+
+	t.Run("Stream", func(t *testing.T) {
+		r := CreateMemoryRepository().UserRepository
+
+		seedMemUsers(t, r, "Bruna", "Ana", "Carla")
+
+		var streamed []model.User
+
+		err := r.Stream(ctx, model.UserListParams{Sort: model.Sort{{Field: "name"}}}, func(u *model.User) error {
+			streamed = append(streamed, *u)
+
+			if len(streamed) == 2 {
+				return errors.New("enough")
+			}
+
+			return nil
+		})
+
+		assert.EqualError(t, err, "enough")
+		assert.Equal(t, []string{"Ana", "Bruna"}, names(streamed))
+	})
+
+	t.Run("Search", func(t *testing.T) {
+		r := CreateMemoryRepository().UserRepository
+
+		_, err := r.Create(ctx, newMemUser("João da Silva", "jsilva@acme.com.br", "313.716.772-80"))
+		assert.NoError(t, err)
+
+		_, err = r.Create(ctx, newMemUser("Maria Souza", "maria.silvana@mail.com", "648.173.761-39"))
+		assert.NoError(t, err)
+
+		results, err := r.Search(ctx, "joao sil", 10)
+
+		assert.NoError(t, err)
+		assert.Len(t, results, 1)
+		assert.Equal(t, "<mark>João</mark> da <mark>Silva</mark>", results[0].NameHighlight)
+
+		results, err = r.Search(ctx, "silv", 10)
+
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"João da Silva", "Maria Souza"}, []string{results[0].Name, results[1].Name})
+		assert.Greater(t, results[0].Rank, results[1].Rank)
+		assert.Equal(t, "maria.<mark>silvana</mark>@mail.com", results[1].EmailHighlight)
+
+		_, err = r.Search(ctx, "!!", 10)
+		assert.Equal(t, rerrors.NewBadRequest("search must contain at least one letter or digit"), err)
+	})
+
+	t.Run("FindTaken and CopyIn", func(t *testing.T) {
+		repo := CreateMemoryRepository()
+		r := repo.UserRepository
+
+		joao := seedMemUsers(t, r, "João")[0]
+
+		taken, err := r.FindTaken(ctx, []string{joao.Email, "nobody@mail.com"}, []string{joao.Cpf})
+
+		assert.NoError(t, err)
+		assert.Equal(t, []model.User{*joao}, taken)
+
+		users := []*model.User{newMemUser("Ana", "ana@mail.com", "313.716.772-80"), newMemUser("Bia", "bia@mail.com", "648.173.761-39")}
+		users[0].UID, users[1].UID = uuid.New(), uuid.New()
+
+		assert.Equal(t, rerrors.NewInternal(), r.CopyIn(ctx, users))
+
+		err = repo.Transactor.WithinTx(ctx, func(ctx context.Context) error {
+			return r.CopyIn(ctx, users)
+		})
+
+		assert.NoError(t, err)
+
+		ana, err := r.GetByID(ctx, users[0].UID, false)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, ana.Version)
+
+		err = repo.Transactor.WithinTx(ctx, func(ctx context.Context) error {
+			return r.CopyIn(ctx, []*model.User{{UID: uuid.New(), Email: "ana@mail.com"}})
+		})
+
+		assert.Equal(t, rerrors.NewConflict("users", "imported", "Key (email)=(ana@mail.com) already exists."), err)
+	})
+}
+
+func TestMemoryTransactor(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Changes are undone when the transaction fails", func(t *testing.T) {
+		repo := CreateMemoryRepository()
+		r := repo.UserRepository
+
+		users := seedMemUsers(t, r, "João", "Maria")
+
+		err := repo.Transactor.WithinTx(ctx, func(ctx context.Context) error {
+			// the two users swap e-mails
+			a, b := *users[0], *users[1]
+			a.Email, b.Email = b.Email, "swap@mail.com"
+
+			if _, err := r.Update(ctx, &b); err != nil {
+				return err
+			}
+
+			if _, err := r.Update(ctx, &a); err != nil {
+				return err
+			}
+
+			if err := r.Purge(ctx, users[0].UID.String()); err != nil {
+				return err
+			}
+
+			if _, err := r.Create(ctx, newMemUser("Ana", "ana@mail.com", "313.716.772-80")); err != nil {
+				return err
+			}
+
+			return repo.AuditRepository.Append(ctx, &model.AuditEntry{UserID: users[0].UID, Action: model.AuditPurge})
+		})
+
+		assert.NoError(t, err)
+
+		err = repo.Transactor.WithinTx(ctx, func(ctx context.Context) error {
+			assert.NoError(t, r.Delete(ctx, users[1].UID.String()))
+
+			_, err := r.Create(ctx, newMemUser("Ana", "ana@mail.com", "648.173.761-39"))
+
+			return err
+		})
+
+		assert.Error(t, err)
+
+		maria, err := r.GetByID(ctx, users[1].UID, false)
+		assert.NoError(t, err)
+		assert.Equal(t, "swap@mail.com", maria.Email)
+
+		// the e-mail Maria held before is still taken by no one else
+		_, err = r.Create(ctx, newMemUser("Outra Maria", users[1].Email, "417.653.125-82"))
+		assert.NoError(t, err)
+
+		_, err = r.Create(ctx, newMemUser("Outra Maria", "swap@mail.com", "656.387.324-38"))
+		assert.Error(t, err)
+	})
+
+	t.Run("Audit entries are only kept along with their transaction", func(t *testing.T) {
+		repo := CreateMemoryRepository()
+		a := repo.AuditRepository
+
+		assert.Equal(t, rerrors.NewInternal(), a.Append(ctx, &model.AuditEntry{}))
+
+		user := uuid.New()
+
+		err := repo.Transactor.WithinTx(ctx, func(ctx context.Context) error {
+			return a.AppendAll(ctx, []*model.AuditEntry{
+				{UserID: user, Actor: "ana", Action: model.AuditCreate},
+				{UserID: uuid.New(), Actor: "bia", Action: model.AuditCreate},
+			})
+		})
+
+		assert.NoError(t, err)
+
+		err = repo.Transactor.WithinTx(ctx, func(ctx context.Context) error {
+			if err := a.Append(ctx, &model.AuditEntry{UserID: user, Action: model.AuditDelete}); err != nil {
+				return err
+			}
+
+			return errors.New("rolled back")
+		})
+
+		assert.Error(t, err)
+
+		entries, err := a.List(ctx, model.AuditListParams{Limit: 10})
+
+		assert.NoError(t, err)
+		assert.Len(t, entries, 2)
+		assert.Equal(t, model.AuditGenesisHash, entries[0].PrevHash)
+		assert.Equal(t, entries[0].Hash, entries[1].PrevHash)
+		assert.Equal(t, entries[1].ComputeHash(), entries[1].Hash)
+
+		entries, err = a.List(ctx, model.AuditListParams{UserID: &user, Limit: 10})
+
+		assert.NoError(t, err)
+		assert.Len(t, entries, 1)
+		assert.Equal(t, "ana", entries[0].Actor)
+
+		entries, err = a.List(ctx, model.AuditListParams{After: 1, Limit: 10})
+
+		assert.NoError(t, err)
+		assert.Len(t, entries, 1)
+		assert.Equal(t, int64(2), entries[0].ID)
+	})
+}
@@ -0,0 +1,417 @@
+package repository
+
+import (
+	"context"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	model "github.com/klasrak/users-api/models"
+	"github.com/klasrak/users-api/rerrors"
+)
+
+// MemoryWebhookRepository is an in-memory implementation of service layer
+// WebhookRepository interface, keeping webhooks in a MemoryStore
+type MemoryWebhookRepository struct {
+	Store *MemoryStore
+}
+
+// List returns every webhook, oldest first
+func (r *MemoryWebhookRepository) List(ctx context.Context) ([]model.Webhook, error) {
+	webhooks := []model.Webhook{}
+
+	r.Store.read(ctx, func() {
+		for _, w := range r.Store.webhooks {
+			webhooks = append(webhooks, copyWebhook(w))
+		}
+	})
+
+	sort.Slice(webhooks, func(i, j int) bool {
+		if !webhooks[i].CreatedAt.Equal(webhooks[j].CreatedAt) {
+			return webhooks[i].CreatedAt.Before(webhooks[j].CreatedAt)
+		}
+
+		return webhooks[i].ID.String() < webhooks[j].ID.String()
+	})
+
+	return webhooks, nil
+}
+
+// GetByID fetches a webhook by id or returns an error
+func (r *MemoryWebhookRepository) GetByID(ctx context.Context, id uuid.UUID) (*model.Webhook, error) {
+	var (
+		w  model.Webhook
+		ok bool
+	)
+
+	r.Store.read(ctx, func() {
+		w, ok = r.Store.webhooks[id]
+	})
+
+	if !ok {
+		return nil, rerrors.NewNotFound("webhook", id.String())
+	}
+
+	w = copyWebhook(w)
+
+	return &w, nil
+}
+
+// Create a webhook
+func (r *MemoryWebhookRepository) Create(ctx context.Context, w *model.Webhook) error {
+	return r.Store.write(ctx, func(tx *memTx) error {
+		r.Store.putWebhook(tx, copyWebhook(*w))
+
+		return nil
+	})
+}
+
+// Update replaces the settings of a webhook
+func (r *MemoryWebhookRepository) Update(ctx context.Context, w *model.Webhook) error {
+	return r.Store.write(ctx, func(tx *memTx) error {
+		if _, ok := r.Store.webhooks[w.ID]; !ok {
+			return rerrors.NewNotFound("webhook", w.ID.String())
+		}
+
+		r.Store.putWebhook(tx, copyWebhook(*w))
+
+		return nil
+	})
+}
+
+// Delete removes a webhook along with its deliveries. It must run within a
+// transaction (see MemoryTransactor)
+func (r *MemoryWebhookRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	if _, ok := r.Store.tx(ctx); !ok {
+		log.Println("unable to delete webhook: not within a transaction")
+		return rerrors.NewInternal()
+	}
+
+	return r.Store.write(ctx, func(tx *memTx) error {
+		if _, ok := r.Store.webhooks[id]; !ok {
+			return rerrors.NewNotFound("webhook", id.String())
+		}
+
+		for did, d := range r.Store.deliveries {
+			if d.WebhookID == id {
+				r.Store.removeDelivery(tx, did)
+			}
+		}
+
+		r.Store.removeWebhook(tx, id)
+
+		return nil
+	})
+}
+
+// Succeeded records a successful delivery to a webhook, clearing its
+// failures
+func (r *MemoryWebhookRepository) Succeeded(ctx context.Context, id uuid.UUID) error {
+	return r.Store.write(ctx, func(tx *memTx) error {
+		if w, ok := r.Store.webhooks[id]; ok && w.Failures > 0 {
+			w.Failures = 0
+			r.Store.putWebhook(tx, w)
+		}
+
+		return nil
+	})
+}
+
+// Failed records a failed attempt to deliver to a webhook, disabling it for
+// reason once maxFailures attempts failed in a row. It reports whether this
+// attempt disabled the webhook
+func (r *MemoryWebhookRepository) Failed(ctx context.Context, id uuid.UUID, maxFailures int, reason string) (bool, error) {
+	var disabled bool
+
+	err := r.Store.write(ctx, func(tx *memTx) error {
+		w, ok := r.Store.webhooks[id]
+
+		if !ok {
+			return nil
+		}
+
+		w.Failures++
+
+		if w.Active && w.Failures >= maxFailures {
+			w.Active = false
+			w.DisabledReason = reason
+			disabled = true
+		}
+
+		r.Store.putWebhook(tx, w)
+
+		return nil
+	})
+
+	return disabled, err
+}
+
+// MemoryWebhookDeliveryRepository is an in-memory implementation of service
+// layer WebhookDeliveryRepository interface, keeping deliveries in a
+// MemoryStore
+type MemoryWebhookDeliveryRepository struct {
+	Store *MemoryStore
+}
+
+// Enqueue adds deliveries to be attempted. Deliveries of an event to a
+// webhook it was already delivered to are skipped, unless they are
+// redeliveries. It must run within a transaction (see MemoryTransactor)
+func (r *MemoryWebhookDeliveryRepository) Enqueue(ctx context.Context, deliveries []*model.WebhookDelivery) error {
+	if _, ok := r.Store.tx(ctx); !ok {
+		log.Println("unable to enqueue webhook delivery: not within a transaction")
+		return rerrors.NewInternal()
+	}
+
+	return r.Store.write(ctx, func(tx *memTx) error {
+		for _, delivery := range deliveries {
+			if delivery.RedeliveryOf == nil && r.delivered(delivery.WebhookID, delivery.EventID) {
+				continue
+			}
+
+			r.Store.putDelivery(tx, copyDelivery(*delivery))
+		}
+
+		return nil
+	})
+}
+
+// delivered reports whether an event was already delivered to a webhook,
+// not counting redeliveries. The store must be held
+func (r *MemoryWebhookDeliveryRepository) delivered(webhookID, eventID uuid.UUID) bool {
+	for _, d := range r.Store.deliveries {
+		if d.WebhookID == webhookID && d.EventID == eventID && d.RedeliveryOf == nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// List returns the deliveries of a webhook, newest first
+func (r *MemoryWebhookDeliveryRepository) List(ctx context.Context, params model.WebhookDeliveryListParams) ([]model.WebhookDelivery, error) {
+	deliveries := []model.WebhookDelivery{}
+
+	r.Store.read(ctx, func() {
+		for _, d := range r.Store.deliveries {
+			if d.WebhookID != params.WebhookID {
+				continue
+			}
+
+			if params.Status != "" && d.Status != params.Status {
+				continue
+			}
+
+			if !params.Before.IsZero() && !d.CreatedAt.Before(params.Before) {
+				continue
+			}
+
+			deliveries = append(deliveries, copyDelivery(d))
+		}
+	})
+
+	sort.Slice(deliveries, func(i, j int) bool {
+		if !deliveries[i].CreatedAt.Equal(deliveries[j].CreatedAt) {
+			return deliveries[i].CreatedAt.After(deliveries[j].CreatedAt)
+		}
+
+		return deliveries[i].ID.String() > deliveries[j].ID.String()
+	})
+
+	if len(deliveries) > params.Limit {
+		deliveries = deliveries[:params.Limit]
+	}
+
+	return deliveries, nil
+}
+
+// GetByID fetches a delivery of a webhook by id or returns an error
+func (r *MemoryWebhookDeliveryRepository) GetByID(ctx context.Context, webhookID, id uuid.UUID) (*model.WebhookDelivery, error) {
+	var (
+		d  model.WebhookDelivery
+		ok bool
+	)
+
+	r.Store.read(ctx, func() {
+		d, ok = r.Store.deliveries[id]
+	})
+
+	if !ok || d.WebhookID != webhookID {
+		return nil, rerrors.NewNotFound("delivery", id.String())
+	}
+
+	d = copyDelivery(d)
+
+	return &d, nil
+}
+
+// Due returns up to limit pending deliveries to active webhooks that are
+// due at now and claimed by no one, oldest first
+func (r *MemoryWebhookDeliveryRepository) Due(ctx context.Context, now time.Time, limit int) ([]*model.WebhookDelivery, error) {
+	due := []*model.WebhookDelivery{}
+
+	r.Store.read(ctx, func() {
+		for _, d := range r.Store.deliveries {
+			if w, ok := r.Store.webhooks[d.WebhookID]; !ok || !w.Active {
+				continue
+			}
+
+			if d.Status != model.DeliveryPending || d.NextAttemptAt.After(now) || claimed(&d, now) {
+				continue
+			}
+
+			d := copyDelivery(d)
+			due = append(due, &d)
+		}
+	})
+
+	sort.Slice(due, func(i, j int) bool {
+		if !due[i].NextAttemptAt.Equal(due[j].NextAttemptAt) {
+			return due[i].NextAttemptAt.Before(due[j].NextAttemptAt)
+		}
+
+		return due[i].ID.String() < due[j].ID.String()
+	})
+
+	if len(due) > limit {
+		due = due[:limit]
+	}
+
+	return due, nil
+}
+
+// Claim holds a pending delivery until the given time, unless someone else
+// holds it at now. It reports whether the delivery was claimed
+func (r *MemoryWebhookDeliveryRepository) Claim(ctx context.Context, delivery *model.WebhookDelivery, now, until time.Time) (bool, error) {
+	var ok bool
+
+	err := r.Store.write(ctx, func(tx *memTx) error {
+		d, found := r.Store.deliveries[delivery.ID]
+
+		if !found || d.Status != model.DeliveryPending || claimed(&d, now) {
+			return nil
+		}
+
+		d.ClaimedUntil = &until
+		r.Store.putDelivery(tx, d)
+		ok = true
+
+		return nil
+	})
+
+	if ok {
+		delivery.ClaimedUntil = &until
+	}
+
+	return ok, err
+}
+
+// Save records the outcome of an attempt to deliver
+func (r *MemoryWebhookDeliveryRepository) Save(ctx context.Context, delivery *model.WebhookDelivery) error {
+	return r.Store.write(ctx, func(tx *memTx) error {
+		if _, ok := r.Store.deliveries[delivery.ID]; ok {
+			r.Store.putDelivery(tx, copyDelivery(*delivery))
+		}
+
+		return nil
+	})
+}
+
+// claimed reports whether someone holds a delivery at now
+func claimed(d *model.WebhookDelivery, now time.Time) bool {
+	return d.ClaimedUntil != nil && !d.ClaimedUntil.Before(now)
+}
+
+// putWebhook stores w within tx
+func (s *MemoryStore) putWebhook(tx *memTx, w model.Webhook) {
+	if _, ok := tx.webhooks[w.ID]; !ok {
+		tx.webhooks[w.ID] = s.webhook(w.ID)
+	}
+
+	s.webhooks[w.ID] = w
+}
+
+// removeWebhook drops the webhook with the given id within tx
+func (s *MemoryStore) removeWebhook(tx *memTx, id uuid.UUID) {
+	if _, ok := tx.webhooks[id]; !ok {
+		tx.webhooks[id] = s.webhook(id)
+	}
+
+	delete(s.webhooks, id)
+}
+
+// webhook returns a copy of the webhook with the given id, nil when there
+// is none
+func (s *MemoryStore) webhook(id uuid.UUID) *model.Webhook {
+	w, ok := s.webhooks[id]
+
+	if !ok {
+		return nil
+	}
+
+	return &w
+}
+
+// putDelivery stores d within tx
+func (s *MemoryStore) putDelivery(tx *memTx, d model.WebhookDelivery) {
+	if _, ok := tx.deliveries[d.ID]; !ok {
+		tx.deliveries[d.ID] = s.delivery(d.ID)
+	}
+
+	s.deliveries[d.ID] = d
+}
+
+// removeDelivery drops the delivery with the given id within tx
+func (s *MemoryStore) removeDelivery(tx *memTx, id uuid.UUID) {
+	if _, ok := tx.deliveries[id]; !ok {
+		tx.deliveries[id] = s.delivery(id)
+	}
+
+	delete(s.deliveries, id)
+}
+
+// delivery returns a copy of the delivery with the given id, nil when there
+// is none
+func (s *MemoryStore) delivery(id uuid.UUID) *model.WebhookDelivery {
+	d, ok := s.deliveries[id]
+
+	if !ok {
+		return nil
+	}
+
+	return &d
+}
+
+// copyWebhook copies w, so that it shares nothing with the store
+func copyWebhook(w model.Webhook) model.Webhook {
+	w.Events = append(model.WebhookEvents{}, w.Events...)
+
+	return w
+}
+
+// copyDelivery copies d, so that it shares nothing with the store
+func copyDelivery(d model.WebhookDelivery) model.WebhookDelivery {
+	d.Payload = append(model.WebhookPayload{}, d.Payload...)
+
+	if d.RedeliveryOf != nil {
+		id := *d.RedeliveryOf
+		d.RedeliveryOf = &id
+	}
+
+	if d.ResponseCode != nil {
+		code := *d.ResponseCode
+		d.ResponseCode = &code
+	}
+
+	if d.ClaimedUntil != nil {
+		t := *d.ClaimedUntil
+		d.ClaimedUntil = &t
+	}
+
+	if d.DeliveredAt != nil {
+		t := *d.DeliveredAt
+		d.DeliveredAt = &t
+	}
+
+	return d
+}
@@ -0,0 +1,290 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	model "github.com/klasrak/users-api/models"
+	"github.com/klasrak/users-api/rerrors"
+	"github.com/klasrak/users-api/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testWebhookRepository checks the behaviour every WebhookRepository and
+// WebhookDeliveryRepository share. newRepository returns both over an empty
+// database, and the Transactor of that database
+func testWebhookRepository(t *testing.T, newRepository func(t *testing.T) (service.WebhookRepository, service.WebhookDeliveryRepository, service.Transactor)) {
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Microsecond)
+
+	created := func(t *testing.T, webhooks service.WebhookRepository, at time.Time) *model.Webhook {
+		w := &model.Webhook{
+			ID:        uuid.New(),
+			URL:       "https://example.com/hooks",
+			Events:    model.WebhookEvents{model.EventUserCreated, model.EventUserDeleted},
+			Secret:    "secret",
+			Active:    true,
+			CreatedAt: at,
+			UpdatedAt: at,
+		}
+
+		require.NoError(t, webhooks.Create(ctx, w))
+
+		return w
+	}
+
+	delivery := func(w *model.Webhook, at time.Time) *model.WebhookDelivery {
+		return &model.WebhookDelivery{
+			ID:            uuid.New(),
+			WebhookID:     w.ID,
+			EventID:       uuid.New(),
+			EventType:     model.EventUserCreated,
+			Payload:       model.WebhookPayload(`{"type":"user.created"}`),
+			Status:        model.DeliveryPending,
+			NextAttemptAt: at,
+			CreatedAt:     at,
+		}
+	}
+
+	enqueued := func(t *testing.T, deliveries service.WebhookDeliveryRepository, tr service.Transactor, list ...*model.WebhookDelivery) {
+		require.NoError(t, tr.WithinTx(ctx, func(ctx context.Context) error {
+			return deliveries.Enqueue(ctx, list)
+		}))
+	}
+
+	ids := func(list []model.WebhookDelivery) []uuid.UUID {
+		out := make([]uuid.UUID, len(list))
+
+		for i, d := range list {
+			out[i] = d.ID
+		}
+
+		return out
+	}
+
+	t.Run("Webhooks", func(t *testing.T) {
+		webhooks, _, tr := newRepository(t)
+
+		a := created(t, webhooks, now)
+		b := created(t, webhooks, now.Add(time.Second))
+
+		got, err := webhooks.GetByID(ctx, a.ID)
+		require.NoError(t, err)
+		assert.Equal(t, a.URL, got.URL)
+		assert.Equal(t, a.Events, got.Events)
+		assert.Equal(t, "secret", got.Secret)
+		assert.True(t, got.Active)
+		assert.True(t, a.CreatedAt.Equal(got.CreatedAt))
+
+		list, err := webhooks.List(ctx)
+		require.NoError(t, err)
+		require.Len(t, list, 2)
+		assert.Equal(t, []uuid.UUID{a.ID, b.ID}, []uuid.UUID{list[0].ID, list[1].ID})
+
+		a.URL = "https://example.com/other"
+		a.Events = model.WebhookEvents{model.EventUserUpdated}
+		a.Active = false
+		a.DisabledReason = "disabled"
+		a.UpdatedAt = now.Add(time.Minute)
+		require.NoError(t, webhooks.Update(ctx, a))
+
+		got, err = webhooks.GetByID(ctx, a.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "https://example.com/other", got.URL)
+		assert.Equal(t, model.WebhookEvents{model.EventUserUpdated}, got.Events)
+		assert.False(t, got.Active)
+		assert.Equal(t, "disabled", got.DisabledReason)
+
+		missing := uuid.New()
+
+		_, err = webhooks.GetByID(ctx, missing)
+		assert.Equal(t, rerrors.NewNotFound("webhook", missing.String()), err)
+
+		assert.Equal(t, rerrors.NewNotFound("webhook", missing.String()), webhooks.Update(ctx, &model.Webhook{ID: missing}))
+
+		// webhooks are only deleted within transactions
+		assert.Error(t, webhooks.Delete(ctx, b.ID))
+
+		require.NoError(t, tr.WithinTx(ctx, func(ctx context.Context) error {
+			return webhooks.Delete(ctx, b.ID)
+		}))
+
+		_, err = webhooks.GetByID(ctx, b.ID)
+		assert.Error(t, err)
+
+		err = tr.WithinTx(ctx, func(ctx context.Context) error {
+			return webhooks.Delete(ctx, b.ID)
+		})
+		assert.Equal(t, rerrors.NewNotFound("webhook", b.ID.String()), err)
+	})
+
+	t.Run("Failures disable webhooks", func(t *testing.T) {
+		webhooks, _, _ := newRepository(t)
+
+		w := created(t, webhooks, now)
+
+		disabled, err := webhooks.Failed(ctx, w.ID, 2, "failing")
+		require.NoError(t, err)
+		assert.False(t, disabled)
+
+		// a success clears the failures
+		require.NoError(t, webhooks.Succeeded(ctx, w.ID))
+
+		disabled, err = webhooks.Failed(ctx, w.ID, 2, "failing")
+		require.NoError(t, err)
+		assert.False(t, disabled)
+
+		disabled, err = webhooks.Failed(ctx, w.ID, 2, "failing")
+		require.NoError(t, err)
+		assert.True(t, disabled)
+
+		// only the failure reaching the limit disables it
+		disabled, err = webhooks.Failed(ctx, w.ID, 2, "failing")
+		require.NoError(t, err)
+		assert.False(t, disabled)
+
+		got, err := webhooks.GetByID(ctx, w.ID)
+		require.NoError(t, err)
+		assert.False(t, got.Active)
+		assert.Equal(t, "failing", got.DisabledReason)
+		assert.Equal(t, 3, got.Failures)
+	})
+
+	t.Run("Deliveries", func(t *testing.T) {
+		webhooks, deliveries, tr := newRepository(t)
+
+		w := created(t, webhooks, now)
+		other := created(t, webhooks, now)
+
+		first := delivery(w, now)
+		second := delivery(w, now.Add(time.Second))
+		elsewhere := delivery(other, now)
+
+		enqueued(t, deliveries, tr, first, second, elsewhere)
+
+		// deliveries are only enqueued within transactions
+		assert.Error(t, deliveries.Enqueue(ctx, []*model.WebhookDelivery{delivery(w, now)}))
+
+		// an event is only delivered once to the same webhook, unless asked to
+		again := delivery(w, now.Add(2*time.Second))
+		again.EventID = first.EventID
+
+		redelivery := delivery(w, now.Add(3*time.Second))
+		redelivery.EventID = first.EventID
+		redelivery.RedeliveryOf = &first.ID
+
+		enqueued(t, deliveries, tr, again, redelivery)
+
+		list, err := deliveries.List(ctx, model.WebhookDeliveryListParams{WebhookID: w.ID, Limit: 10})
+		require.NoError(t, err)
+		assert.Equal(t, []uuid.UUID{redelivery.ID, second.ID, first.ID}, ids(list))
+		assert.Equal(t, first.ID, *list[0].RedeliveryOf)
+		assert.Equal(t, `{"type":"user.created"}`, string(list[0].Payload))
+		assert.True(t, first.CreatedAt.Equal(list[2].CreatedAt))
+
+		list, err = deliveries.List(ctx, model.WebhookDeliveryListParams{WebhookID: w.ID, Before: second.CreatedAt, Limit: 10})
+		require.NoError(t, err)
+		assert.Equal(t, []uuid.UUID{first.ID}, ids(list))
+
+		list, err = deliveries.List(ctx, model.WebhookDeliveryListParams{WebhookID: w.ID, Limit: 1})
+		require.NoError(t, err)
+		assert.Equal(t, []uuid.UUID{redelivery.ID}, ids(list))
+
+		list, err = deliveries.List(ctx, model.WebhookDeliveryListParams{WebhookID: w.ID, Status: model.DeliveryFailed, Limit: 10})
+		require.NoError(t, err)
+		assert.Empty(t, list)
+
+		got, err := deliveries.GetByID(ctx, w.ID, second.ID)
+		require.NoError(t, err)
+		assert.Equal(t, second.EventID, got.EventID)
+		assert.Nil(t, got.RedeliveryOf)
+
+		_, err = deliveries.GetByID(ctx, other.ID, second.ID)
+		assert.Equal(t, rerrors.NewNotFound("delivery", second.ID.String()), err)
+
+		// deleting a webhook deletes its deliveries
+		require.NoError(t, tr.WithinTx(ctx, func(ctx context.Context) error {
+			return webhooks.Delete(ctx, other.ID)
+		}))
+
+		_, err = deliveries.GetByID(ctx, other.ID, elsewhere.ID)
+		assert.Error(t, err)
+	})
+
+	t.Run("Due deliveries are claimed and saved", func(t *testing.T) {
+		webhooks, deliveries, tr := newRepository(t)
+
+		w := created(t, webhooks, now)
+		disabled := created(t, webhooks, now)
+
+		disabled.Active = false
+		require.NoError(t, webhooks.Update(ctx, disabled))
+
+		due := delivery(w, now)
+		later := delivery(w, now.Add(time.Hour))
+
+		enqueued(t, deliveries, tr, due, later, delivery(disabled, now))
+
+		list, err := deliveries.Due(ctx, now.Add(time.Second), 10)
+		require.NoError(t, err)
+		require.Len(t, list, 1)
+		assert.Equal(t, due.ID, list[0].ID)
+
+		claimed, err := deliveries.Claim(ctx, list[0], now, now.Add(time.Minute))
+		require.NoError(t, err)
+		assert.True(t, claimed)
+		assert.NotNil(t, list[0].ClaimedUntil)
+
+		// no one else attempts it until the claim expires
+		list, err = deliveries.Due(ctx, now.Add(time.Second), 10)
+		require.NoError(t, err)
+		assert.Empty(t, list)
+
+		claimed, err = deliveries.Claim(ctx, due, now.Add(time.Second), now.Add(time.Minute))
+		require.NoError(t, err)
+		assert.False(t, claimed)
+
+		claimed, err = deliveries.Claim(ctx, due, now.Add(2*time.Minute), now.Add(3*time.Minute))
+		require.NoError(t, err)
+		assert.True(t, claimed)
+
+		code := 200
+		deliveredAt := now.Add(2 * time.Minute)
+
+		due.Status = model.DeliverySucceeded
+		due.Attempts = 1
+		due.ResponseCode = &code
+		due.ClaimedUntil = nil
+		due.DeliveredAt = &deliveredAt
+		require.NoError(t, deliveries.Save(ctx, due))
+
+		got, err := deliveries.GetByID(ctx, w.ID, due.ID)
+		require.NoError(t, err)
+		assert.Equal(t, model.DeliverySucceeded, got.Status)
+		assert.Equal(t, 1, got.Attempts)
+		assert.Equal(t, 200, *got.ResponseCode)
+		assert.Nil(t, got.ClaimedUntil)
+		assert.True(t, deliveredAt.Equal(*got.DeliveredAt))
+
+		// delivered ones are no longer due, nor claimed
+		list, err = deliveries.Due(ctx, now.Add(2*time.Hour), 10)
+		require.NoError(t, err)
+		require.Len(t, list, 1)
+		assert.Equal(t, later.ID, list[0].ID)
+
+		claimed, err = deliveries.Claim(ctx, due, now.Add(2*time.Hour), now.Add(3*time.Hour))
+		require.NoError(t, err)
+		assert.False(t, claimed)
+	})
+}
+
+func TestMemoryWebhookRepository(t *testing.T) {
+	testWebhookRepository(t, func(t *testing.T) (service.WebhookRepository, service.WebhookDeliveryRepository, service.Transactor) {
+		r := CreateMemoryRepository()
+
+		return r.WebhookRepository, r.WebhookDeliveryRepository, r.Transactor
+	})
+}
@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	model "github.com/klasrak/users-api/models"
+)
+
+// Numbers of the MySQL errors repositories handle
+const (
+	mysqlDuplicateKey = 1062
+	mysqlDeadlock     = 1213
+)
+
+// MySQLDSN returns the data source name of the MySQL database cfg points
+// to, along with the settings repositories rely on. Dates and timestamps are
+// read as time.Time, and the session runs in UTC, the time zone timestamps
+// are stored in. Statements hold a single query
+func MySQLDSN(cfg *mysql.Config) string {
+	return mysqlConfig(cfg, false).FormatDSN()
+}
+
+// MySQLMigrationDSN returns the data source name MySQLDSN does, except that
+// statements may hold several queries, as migrations do. It is only meant
+// for the migrator: the API's own connections leave that off, so a query
+// built by mistake out of user input can't smuggle in others
+func MySQLMigrationDSN(cfg *mysql.Config) string {
+	return mysqlConfig(cfg, true).FormatDSN()
+}
+
+// mysqlConfig returns a copy of cfg with the settings repositories rely on
+func mysqlConfig(cfg *mysql.Config, multiStatements bool) *mysql.Config {
+	cfg = cfg.Clone()
+
+	cfg.ParseTime = true
+	cfg.MultiStatements = multiStatements
+	cfg.Loc = time.UTC
+
+	if cfg.Params == nil {
+		cfg.Params = map[string]string{}
+	}
+
+	cfg.Params["time_zone"] = "'+00:00'"
+
+	return cfg
+}
+
+// mysqlDuplicateKeyName matches the key named in MySQL duplicate key errors,
+// e.g. "Duplicate entry 'a@mail.com' for key 'users.users_email_key'".
+// Older servers and MariaDB leave the table name out
+var mysqlDuplicateKeyName = regexp.MustCompile(`for key '(?:users\.)?(\w+)'$`)
+
+// mysqlTaken tells which field of u made err a duplicate key error, in the
+// words Postgres uses for unique violations, or "" when err is something else
+func mysqlTaken(err error, u *model.User) string {
+	var myErr *mysql.MySQLError
+
+	if !errors.As(err, &myErr) || myErr.Number != mysqlDuplicateKey {
+		return ""
+	}
+
+	field, value := "id", u.UID.String()
+
+	if m := mysqlDuplicateKeyName.FindStringSubmatch(myErr.Message); m != nil {
+		switch m[1] {
+		case "users_email_key":
+			field, value = "email", u.Email
+		case "users_cpf_key":
+			field, value = "cpf", u.Cpf
+		}
+	}
+
+	return fmt.Sprintf("Key (%s)=(%s) already exists.", field, value)
+}
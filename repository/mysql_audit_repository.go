@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+
+	"github.com/jmoiron/sqlx"
+	model "github.com/klasrak/users-api/models"
+	"github.com/klasrak/users-api/rerrors"
+)
+
+// MySQLAuditRepository is a MySQL (or MariaDB) implementation of service
+// layer AuditRepository interface. db must be opened with a MySQLDSN
+type MySQLAuditRepository struct {
+	DB *sqlx.DB
+}
+
+// Append adds an entry to the end of the audit log, chaining it to the last
+// one. It must run within a transaction (see Transactor), so the entry is
+// only kept along with the change it records
+func (r *MySQLAuditRepository) Append(ctx context.Context, e *model.AuditEntry) error {
+	return r.AppendAll(ctx, []*model.AuditEntry{e})
+}
+
+// AppendAll adds several entries to the end of the audit log, in order, as
+// Append would one at a time
+func (r *MySQLAuditRepository) AppendAll(ctx context.Context, entries []*model.AuditEntry) error {
+	if !inTx(ctx) {
+		log.Println("unable to append audit entry: not within a transaction")
+		return rerrors.NewInternal()
+	}
+
+	db := conn(ctx, r.DB)
+
+	// held until the transaction ends, so no one else can chain onto the
+	// same entry in the meantime
+	if _, err := db.ExecContext(ctx, "SELECT l.id FROM audit_log_lock l WHERE l.id = 1 FOR UPDATE;"); err != nil {
+		log.Printf("unable to lock audit log: %v\n", err)
+		return rerrors.NewInternal()
+	}
+
+	var prev string
+
+	// a locking read sees the last committed entry. A plain one would read
+	// the snapshot taken by the first read of the transaction, which may
+	// predate entries appended while waiting for the lock, and fork the chain
+	err := db.GetContext(ctx, &prev, "SELECT a.hash FROM audit_log a ORDER BY a.id DESC LIMIT 1 FOR UPDATE;")
+
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		prev = model.AuditGenesisHash
+	case err != nil:
+		log.Printf("unable to read last audit entry: %v\n", err)
+		return rerrors.NewInternal()
+	}
+
+	query := `
+	INSERT INTO audit_log (user_id, actor, request_id, action, changes, created_at, prev_hash, hash)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?);
+	`
+
+	for _, e := range entries {
+		e.PrevHash = prev
+		e.Hash = e.ComputeHash()
+
+		res, err := db.ExecContext(ctx, query, e.UserID, e.Actor, e.RequestID, e.Action, e.Changes, e.CreatedAt.UTC(), e.PrevHash, e.Hash)
+
+		if err == nil {
+			e.ID, err = res.LastInsertId()
+		}
+
+		if err != nil {
+			log.Printf("unable to append audit entry: %v\n", err)
+			return rerrors.NewInternal()
+		}
+
+		prev = e.Hash
+	}
+
+	return nil
+}
+
+// List returns the audit entries matching params, oldest first
+func (r *MySQLAuditRepository) List(ctx context.Context, params model.AuditListParams) ([]model.AuditEntry, error) {
+	return listAuditEntries(ctx, r.DB, mysqlDialect, params)
+}
@@ -0,0 +1,324 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	model "github.com/klasrak/users-api/models"
+	"github.com/klasrak/users-api/rerrors"
+)
+
+// MySQLUserRepository is a MySQL (or MariaDB) implementation of service
+// layer UserRepository interface. db must be opened with a MySQLDSN
+type MySQLUserRepository struct {
+	DB *sqlx.DB
+}
+
+// GetAll returns a page of users, as UserRepository.GetAll does
+func (r *MySQLUserRepository) GetAll(ctx context.Context, params model.UserListParams) (*model.UserPage, error) {
+	return listUsers(ctx, r.DB, mysqlDialect, params)
+}
+
+// Stream calls fn with every user a listing with params would return, in
+// the same order, as UserRepository.Stream does
+func (r *MySQLUserRepository) Stream(ctx context.Context, params model.UserListParams, fn func(u *model.User) error) error {
+	return streamUsers(ctx, r.DB, mysqlDialect, params, fn)
+}
+
+// Search finds active users whose name or e-mail has words starting with
+// every word of q, ignoring case and accents. MySQL does not stem
+// Portuguese, so unlike the Postgres search words are only matched as
+// prefixes. Results are ranked and highlighted as MemoryUserRepository.Search
+// does, ranking them in SQL first so only the best ones are read
+func (r *MySQLUserRepository) Search(ctx context.Context, q string, limit int) ([]model.UserSearchResult, error) {
+	results := []model.UserSearchResult{}
+
+	words := searchWords(q)
+
+	if len(words) == 0 {
+		return results, rerrors.NewBadRequest("search must contain at least one letter or digit")
+	}
+
+	query, args := wordSearchQuery(words, limit, "u.name", "LOWER(u.email)", func(text string) string {
+		return "CONCAT(' ', " + text + ")"
+	}, "%s LIKE %s")
+
+	query, bound := mysqlPlaceholders(query, args)
+
+	users, err := selectUsers(ctx, conn(ctx, r.DB), query, bound...)
+
+	if err != nil {
+		return results, err
+	}
+
+	for _, u := range users {
+		if result, ok := memSearch(u, words); ok {
+			results = append(results, result)
+		}
+	}
+
+	return rankSearchResults(results, limit), nil
+}
+
+// GetByID fetches user by ID or return error. Deleted users are reported as
+// not found unless includeDeleted is set
+func (r *MySQLUserRepository) GetByID(ctx context.Context, id uuid.UUID, includeDeleted bool) (*model.User, error) {
+	user := &model.User{}
+
+	query := "SELECT " + userColumns + " FROM users u WHERE u.id = ? AND u.deleted_at IS NULL;"
+
+	if includeDeleted {
+		query = "SELECT " + userColumns + " FROM users u WHERE u.id = ?;"
+	}
+
+	if err := conn(ctx, r.DB).GetContext(ctx, user, query, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return user, rerrors.NewNotFound("id", id.String())
+		}
+
+		log.Printf("unable to get user: %v\n", err)
+		return user, rerrors.NewInternal()
+	}
+
+	return user, nil
+}
+
+// Lock fetches a user, deleted or not, and locks it until the transaction
+// ctx carries ends. Outside of a transaction the lock is released right away
+func (r *MySQLUserRepository) Lock(ctx context.Context, id uuid.UUID) (*model.User, error) {
+	user := &model.User{}
+
+	query := "SELECT " + userColumns + " FROM users u WHERE u.id = ? FOR UPDATE;"
+
+	if err := conn(ctx, r.DB).GetContext(ctx, user, query, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, rerrors.NewNotFound("user", id.String())
+		}
+
+		log.Printf("unable to lock user: %v\n", err)
+		return nil, rerrors.NewInternal()
+	}
+
+	return user, nil
+}
+
+// Create a user
+func (r *MySQLUserRepository) Create(ctx context.Context, u *model.User) (*model.User, error) {
+	u.UID = uuid.New()
+
+	query := "INSERT INTO users (id, name, email, cpf, birthdate) VALUES (?, ?, ?, ?, ?);"
+
+	if _, err := conn(ctx, r.DB).ExecContext(ctx, query, u.UID, u.Name, u.Email, u.Cpf, mysqlDate(u.BirthDate)); err != nil {
+		if detail := mysqlTaken(err, u); detail != "" {
+			log.Printf("could not create user. Reason: %v\n", err)
+			return nil, rerrors.NewConflict("user", "created", detail)
+		}
+
+		log.Printf("failed to create user. Reason: %v\n", err)
+		return nil, rerrors.NewInternal()
+	}
+
+	return r.reload(ctx, u.UID)
+}
+
+// mysqlDate formats a date the way MySQL reads them
+func mysqlDate(d time.Time) string {
+	return d.Format("2006-01-02")
+}
+
+// reload reads a user back after changing it, as MySQL can't return the
+// rows a statement changed
+func (r *MySQLUserRepository) reload(ctx context.Context, id uuid.UUID) (*model.User, error) {
+	user := &model.User{}
+
+	query := "SELECT " + userColumns + " FROM users u WHERE u.id = ?;"
+
+	if err := conn(ctx, r.DB).GetContext(ctx, user, query, id); err != nil {
+		log.Printf("unable to read changed user: %v\n", err)
+		return nil, rerrors.NewInternal()
+	}
+
+	return user, nil
+}
+
+// FindTaken returns the active users holding any of the given e-mails or cpfs
+func (r *MySQLUserRepository) FindTaken(ctx context.Context, emails, cpfs []string) ([]model.User, error) {
+	if len(emails) == 0 && len(cpfs) == 0 {
+		return []model.User{}, nil
+	}
+
+	var args queryArgs
+
+	var alternatives []string
+
+	if len(emails) > 0 {
+		alternatives = append(alternatives, "u.email IN ("+inList(emails, &args)+")")
+	}
+
+	if len(cpfs) > 0 {
+		alternatives = append(alternatives, "u.cpf IN ("+inList(cpfs, &args)+")")
+	}
+
+	query, bound := mysqlPlaceholders("SELECT "+userColumns+" FROM users u WHERE u.deleted_at IS NULL AND ("+strings.Join(alternatives, " OR ")+");", args)
+
+	return selectUsers(ctx, conn(ctx, r.DB), query, bound...)
+}
+
+// CopyIn stores many new users at once, reusing a single prepared insert.
+// Users must come with their ids, and are stored at version 1. It must run
+// within a transaction (see Transactor); when any user is taken it fails
+// with a conflict, and the transaction must not be kept
+func (r *MySQLUserRepository) CopyIn(ctx context.Context, users []*model.User) error {
+	tx, ok := txFrom(ctx)
+
+	if !ok {
+		log.Println("unable to copy users: not within a transaction")
+		return rerrors.NewInternal()
+	}
+
+	stmt, err := tx.PrepareContext(ctx, "INSERT INTO users (id, name, email, cpf, birthdate) VALUES (?, ?, ?, ?, ?);")
+
+	if err != nil {
+		log.Printf("unable to start copying users: %v\n", err)
+		return rerrors.NewInternal()
+	}
+
+	defer stmt.Close()
+
+	for _, u := range users {
+		if _, err := stmt.ExecContext(ctx, u.UID, u.Name, u.Email, u.Cpf, mysqlDate(u.BirthDate)); err != nil {
+			if detail := mysqlTaken(err, u); detail != "" {
+				log.Printf("could not copy users. Reason: %v\n", err)
+				return rerrors.NewConflict("users", "imported", detail)
+			}
+
+			log.Printf("unable to copy users: %v\n", tx.note(err))
+			return rerrors.NewInternal()
+		}
+	}
+
+	return nil
+}
+
+// Update replaces every field of a user, as UserRepository.Update does. The
+// version is bumped by the users_bump_version trigger
+func (r *MySQLUserRepository) Update(ctx context.Context, u *model.User) (*model.User, error) {
+	query := `
+	UPDATE users SET name = ?, email = ?, cpf = ?, birthdate = ?
+	WHERE id = ? AND deleted_at IS NULL AND version = ?;`
+
+	res, err := conn(ctx, r.DB).ExecContext(ctx, query, u.Name, u.Email, u.Cpf, mysqlDate(u.BirthDate), u.UID, u.Version)
+
+	if err != nil {
+		if detail := mysqlTaken(err, u); detail != "" {
+			log.Printf("could not update user. Reason: %v\n", err)
+			return nil, rerrors.NewConflict("user", "updated", detail)
+		}
+
+		log.Printf("unable to update user: %v\n", err)
+		return nil, rerrors.NewInternal()
+	}
+
+	// the version always changes, so matched rows are always reported
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return nil, r.versionMismatch(ctx, u.UID, u.Version)
+	}
+
+	return r.reload(ctx, u.UID)
+}
+
+// versionMismatch explains why a versioned update matched no rows: either
+// the user does not exist (or is deleted) or it has moved past version
+func (r *MySQLUserRepository) versionMismatch(ctx context.Context, id uuid.UUID, version int) error {
+	var current int
+
+	query := "SELECT u.version FROM users u WHERE u.id = ? AND u.deleted_at IS NULL;"
+
+	if err := conn(ctx, r.DB).GetContext(ctx, &current, query, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return rerrors.NewNotFound("user", id.String())
+		}
+
+		log.Printf("unable to read user version: %v\n", err)
+		return rerrors.NewInternal()
+	}
+
+	return rerrors.NewPreconditionFailed(fmt.Sprintf("user is at version %d, not %d", current, version))
+}
+
+// Delete marks a user as deleted. The row is kept so the user can be restored
+func (r *MySQLUserRepository) Delete(ctx context.Context, id string) error {
+	query := "UPDATE users SET deleted_at = ? WHERE id = ? AND deleted_at IS NULL;"
+
+	res, err := conn(ctx, r.DB).ExecContext(ctx, query, time.Now().UTC(), id)
+
+	if err != nil {
+		log.Printf("failed to delete user. Reason: %v\n", err)
+		return rerrors.NewInternal()
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return rerrors.NewNotFound("user", id)
+	}
+
+	return nil
+}
+
+// Restore undoes the deletion of a user. Restoring fails with a conflict when
+// another active user took the e-mail or cpf in the meantime
+func (r *MySQLUserRepository) Restore(ctx context.Context, id string) (*model.User, error) {
+	uid, err := uuid.Parse(id)
+
+	if err != nil {
+		log.Printf("invalid user id %q: %v\n", id, err)
+		return nil, rerrors.NewInternal()
+	}
+
+	query := "UPDATE users SET deleted_at = NULL WHERE id = ? AND deleted_at IS NOT NULL;"
+
+	res, err := conn(ctx, r.DB).ExecContext(ctx, query, uid)
+
+	if err != nil {
+		// the values that clash aren't known before reading the user
+		deleted, _ := r.GetByID(ctx, uid, true)
+
+		if detail := mysqlTaken(err, deleted); detail != "" {
+			log.Printf("could not restore user. Reason: %v\n", err)
+			return nil, rerrors.NewConflict("user", "restored", detail)
+		}
+
+		log.Printf("failed to restore user. Reason: %v\n", err)
+		return nil, rerrors.NewInternal()
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return nil, rerrors.NewNotFound("deleted user", id)
+	}
+
+	return r.reload(ctx, uid)
+}
+
+// Purge removes a user for good, whether it was deleted before or not
+func (r *MySQLUserRepository) Purge(ctx context.Context, id string) error {
+	query := "DELETE FROM users WHERE id = ?;"
+
+	res, err := conn(ctx, r.DB).ExecContext(ctx, query, id)
+
+	if err != nil {
+		log.Printf("failed to purge user. Reason: %v\n", err)
+		return rerrors.NewInternal()
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return rerrors.NewNotFound("user", id)
+	}
+
+	return nil
+}
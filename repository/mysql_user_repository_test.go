@@ -0,0 +1,339 @@
+package repository
+
+import (
+	"context"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/klasrak/users-api/migrations"
+	model "github.com/klasrak/users-api/models"
+	"github.com/klasrak/users-api/rerrors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var mysqlUserColumns = []string{"id", "name", "email", "cpf", "birthdate", "deleted_at", "version"}
+
+func TestMySQLUserRepository(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("GetAll repeats cursor values for every ? placeholder", func(t *testing.T) {
+		db, mock := NewMock()
+
+		sqlxDB := sqlx.NewDb(db, "sqlmock")
+
+		defer sqlxDB.Close()
+
+		id := uuid.New()
+
+		query := `SELECT u.id, u.name, u.email, u.cpf, u.birthdate, u.deleted_at, u.version FROM users u ` +
+			`WHERE u.deleted_at IS NULL AND u.name LIKE \? AND \(\(u.name > \?\) OR \(u.name = \? AND u.id > \?\)\) ` +
+			`ORDER BY u.name, u.id LIMIT \?;`
+
+		mock.ExpectQuery(query).
+			WithArgs("%jo%", "João", "João", id.String(), 11).
+			WillReturnRows(sqlmock.NewRows(mysqlUserColumns))
+
+		r := &MySQLUserRepository{DB: sqlxDB}
+
+		page, err := r.GetAll(ctx, model.UserListParams{
+			Name:   "jo",
+			Sort:   model.Sort{{Field: "name"}},
+			Cursor: encodeCursor(cursor{Sort: "name", Values: []string{"João", id.String()}}),
+			Limit:  10,
+		})
+
+		assert.NoError(t, err)
+		assert.Empty(t, page.Data)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Create reads the created user back", func(t *testing.T) {
+		db, mock := NewMock()
+
+		sqlxDB := sqlx.NewDb(db, "sqlmock")
+
+		defer sqlxDB.Close()
+
+		u := newMemUser("João", "joao@mail.com", "313.716.772-80")
+
+		mock.ExpectExec(`INSERT INTO users \(id, name, email, cpf, birthdate\) VALUES \(\?, \?, \?, \?, \?\);`).
+			WithArgs(sqlmock.AnyArg(), "João", "joao@mail.com", "313.716.772-80", "1990-01-31").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		mock.ExpectQuery(`SELECT .* FROM users u WHERE u.id = \?;`).
+			WillReturnRows(sqlmock.NewRows(mysqlUserColumns).AddRow(uuid.New().String(), "João", "joao@mail.com", "313.716.772-80", u.BirthDate, nil, 1))
+
+		r := &MySQLUserRepository{DB: sqlxDB}
+
+		created, err := r.Create(ctx, u)
+
+		assert.NoError(t, err)
+		assert.Equal(t, 1, created.Version)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Duplicate keys are conflicts", func(t *testing.T) {
+		tests := []struct {
+			message string
+			detail  string
+		}{
+			{"Duplicate entry 'joao@mail.com' for key 'users.users_email_key'", "Key (email)=(joao@mail.com) already exists."},
+			// MariaDB and older MySQL servers
+			{"Duplicate entry '313.716.772-80' for key 'users_cpf_key'", "Key (cpf)=(313.716.772-80) already exists."},
+		}
+
+		for _, tt := range tests {
+			db, mock := NewMock()
+
+			sqlxDB := sqlx.NewDb(db, "sqlmock")
+
+			mock.ExpectExec(`INSERT INTO users`).WillReturnError(&mysql.MySQLError{Number: mysqlDuplicateKey, Message: tt.message})
+
+			r := &MySQLUserRepository{DB: sqlxDB}
+
+			_, err := r.Create(ctx, newMemUser("João", "joao@mail.com", "313.716.772-80"))
+
+			assert.Equal(t, rerrors.NewConflict("user", "created", tt.detail), err)
+			assert.NoError(t, mock.ExpectationsWereMet())
+
+			sqlxDB.Close()
+		}
+	})
+
+	t.Run("Search ranks and limits users in SQL", func(t *testing.T) {
+		db, mock := NewMock()
+
+		sqlxDB := sqlx.NewDb(db, "sqlmock")
+
+		defer sqlxDB.Close()
+
+		joao := newMemUser("João da Silva", "jsilva@acme.com.br", "313.716.772-80")
+		maria := newMemUser("Maria Souza", "maria.silvana@mail.com", "648.173.761-39")
+
+		query := `SELECT .* FROM users u WHERE u.deleted_at IS NULL ` +
+			`AND \(CONCAT\(' ', REPLACE\(.*u.name.*\)\) LIKE \? OR CONCAT\(' ', REPLACE\(.*LOWER\(u.email\).*\)\) LIKE \?\) ` +
+			`ORDER BY CASE WHEN CONCAT\(' ', .*\) LIKE \? THEN 1 ELSE 0.4 END DESC, u.id LIMIT \?;`
+
+		mock.ExpectQuery(query).
+			WithArgs("% silv%", "% silv%", "% silv%", 2).
+			WillReturnRows(sqlmock.NewRows(mysqlUserColumns).
+				AddRow(joao.UID.String(), joao.Name, joao.Email, joao.Cpf, joao.BirthDate, nil, 1).
+				AddRow(maria.UID.String(), maria.Name, maria.Email, maria.Cpf, maria.BirthDate, nil, 1))
+
+		r := &MySQLUserRepository{DB: sqlxDB}
+
+		results, err := r.Search(ctx, "silv", 2)
+
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"João da Silva", "Maria Souza"}, []string{results[0].Name, results[1].Name})
+		assert.Equal(t, "maria.<mark>silvana</mark>@mail.com", results[1].EmailHighlight)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Update of an older version is a precondition failure", func(t *testing.T) {
+		db, mock := NewMock()
+
+		sqlxDB := sqlx.NewDb(db, "sqlmock")
+
+		defer sqlxDB.Close()
+
+		u := newMemUser("João", "joao@mail.com", "313.716.772-80")
+		u.UID = uuid.New()
+		u.Version = 1
+
+		mock.ExpectExec(`UPDATE users SET name = \?, email = \?, cpf = \?, birthdate = \? WHERE id = \? AND deleted_at IS NULL AND version = \?;`).
+			WithArgs("João", "joao@mail.com", "313.716.772-80", "1990-01-31", u.UID, 1).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+
+		mock.ExpectQuery(`SELECT u.version FROM users u WHERE u.id = \? AND u.deleted_at IS NULL;`).
+			WithArgs(u.UID).
+			WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(3))
+
+		r := &MySQLUserRepository{DB: sqlxDB}
+
+		_, err := r.Update(ctx, u)
+
+		assert.Equal(t, rerrors.NewPreconditionFailed("user is at version 3, not 1"), err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Restore reports the values taken in the meantime", func(t *testing.T) {
+		db, mock := NewMock()
+
+		sqlxDB := sqlx.NewDb(db, "sqlmock")
+
+		defer sqlxDB.Close()
+
+		id := uuid.New()
+		deletedAt := time.Now()
+
+		mock.ExpectExec(`UPDATE users SET deleted_at = NULL WHERE id = \? AND deleted_at IS NOT NULL;`).
+			WithArgs(id).
+			WillReturnError(&mysql.MySQLError{Number: mysqlDuplicateKey, Message: "Duplicate entry 'joao@mail.com' for key 'users.users_email_key'"})
+
+		mock.ExpectQuery(`SELECT .* FROM users u WHERE u.id = \?;`).
+			WithArgs(id).
+			WillReturnRows(sqlmock.NewRows(mysqlUserColumns).AddRow(id.String(), "João", "joao@mail.com", "313.716.772-80", time.Now(), deletedAt, 2))
+
+		r := &MySQLUserRepository{DB: sqlxDB}
+
+		_, err := r.Restore(ctx, id.String())
+
+		assert.Equal(t, rerrors.NewConflict("user", "restored", "Key (email)=(joao@mail.com) already exists."), err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestMySQLAuditRepository(t *testing.T) {
+	db, mock := NewMock()
+
+	sqlxDB := sqlx.NewDb(db, "sqlmock")
+
+	defer sqlxDB.Close()
+
+	repo := &MySQLAuditRepository{DB: sqlxDB}
+	transactor := &Transactor{DB: sqlxDB}
+
+	e := &model.AuditEntry{UserID: uuid.New(), Actor: "ana", Action: model.AuditCreate, Changes: model.AuditChanges{}, CreatedAt: time.Now()}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`SELECT l.id FROM audit_log_lock l WHERE l.id = 1 FOR UPDATE;`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT a.hash FROM audit_log a ORDER BY a.id DESC LIMIT 1 FOR UPDATE;`).WillReturnRows(sqlmock.NewRows([]string{"hash"}))
+	mock.ExpectExec(`INSERT INTO audit_log`).WillReturnResult(sqlmock.NewResult(7, 1))
+	mock.ExpectCommit()
+
+	err := transactor.WithinTx(context.Background(), func(ctx context.Context) error {
+		return repo.Append(ctx, e)
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(7), e.ID)
+	assert.Equal(t, model.AuditGenesisHash, e.PrevHash)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMySQLDSN(t *testing.T) {
+	cfg, err := mysql.ParseDSN("app:secret@tcp(db:3306)/users?multiStatements=true")
+	assert.NoError(t, err)
+
+	api, err := mysql.ParseDSN(MySQLDSN(cfg))
+	assert.NoError(t, err)
+	assert.False(t, api.MultiStatements)
+	assert.True(t, api.ParseTime)
+	assert.Equal(t, time.UTC, api.Loc)
+
+	migrations, err := mysql.ParseDSN(MySQLMigrationDSN(cfg))
+	assert.NoError(t, err)
+	assert.True(t, migrations.MultiStatements)
+	assert.True(t, migrations.ParseTime)
+
+	// the settings are not left on cfg
+	assert.False(t, cfg.ParseTime)
+}
+
+// TestMySQLAuditRepositoryConcurrentAppends appends to the audit log of a
+// real MySQL database from several transactions at once. It runs when
+// MYSQL_TEST_DSN holds the data source name of a database it may migrate
+// and write to, e.g. root:secret@tcp(localhost:3306)/users_test
+func TestMySQLAuditRepositoryConcurrentAppends(t *testing.T) {
+	dsn := os.Getenv("MYSQL_TEST_DSN")
+
+	if dsn == "" {
+		t.Skip("MYSQL_TEST_DSN is not set")
+	}
+
+	ctx := context.Background()
+
+	cfg, err := mysql.ParseDSN(dsn)
+	require.NoError(t, err)
+
+	migrationDB, err := sqlx.Open("mysql", MySQLMigrationDSN(cfg))
+	require.NoError(t, err)
+
+	defer migrationDB.Close()
+
+	m, err := migrations.New(migrationDB, DriverMySQL)
+	require.NoError(t, err)
+	require.NoError(t, m.Up(ctx, 0))
+
+	db, err := sqlx.Open("mysql", MySQLDSN(cfg))
+	require.NoError(t, err)
+
+	defer db.Close()
+
+	r, err := CreateRepository(&Options{DB: db, Driver: DriverMySQL})
+	require.NoError(t, err)
+
+	const writers = 8
+
+	var (
+		ready sync.WaitGroup
+		done  sync.WaitGroup
+	)
+
+	start := make(chan struct{})
+
+	ready.Add(writers)
+	done.Add(writers)
+
+	for i := 0; i < writers; i++ {
+		go func() {
+			defer done.Done()
+
+			var once sync.Once
+
+			err := r.Transactor.WithinTx(ctx, func(ctx context.Context) error {
+				// read before appending, as services do, so the
+				// transaction's snapshot predates the other appends
+				var n int
+
+				if err := conn(ctx, db).GetContext(ctx, &n, "SELECT COUNT(*) FROM users;"); err != nil {
+					return err
+				}
+
+				once.Do(ready.Done)
+				<-start
+
+				return r.AuditRepository.Append(ctx, &model.AuditEntry{
+					UserID:    uuid.New(),
+					Actor:     "ana",
+					Action:    model.AuditCreate,
+					Changes:   model.AuditChanges{},
+					CreatedAt: time.Now(),
+				})
+			})
+
+			assert.NoError(t, err)
+		}()
+	}
+
+	ready.Wait()
+	close(start)
+	done.Wait()
+
+	// the whole log, including what earlier runs left there, is one chain
+	var entries []model.AuditEntry
+
+	for after := int64(0); ; {
+		page, err := r.AuditRepository.List(ctx, model.AuditListParams{After: after, Limit: 1000})
+		require.NoError(t, err)
+
+		if len(page) == 0 {
+			break
+		}
+
+		entries = append(entries, page...)
+		after = page[len(page)-1].ID
+	}
+
+	require.GreaterOrEqual(t, len(entries), writers)
+	assert.Equal(t, model.AuditGenesisHash, entries[0].PrevHash)
+	assert.NoError(t, model.VerifyAuditChain(entries))
+}
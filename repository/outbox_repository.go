@@ -0,0 +1,157 @@
+package repository
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	model "github.com/klasrak/users-api/models"
+	"github.com/klasrak/users-api/rerrors"
+)
+
+// OutboxRepository is a repository implementation of service layer
+// OutboxRepository interface, for every database users can be stored in
+type OutboxRepository struct {
+	DB *sqlx.DB
+
+	// dialect of DB, Postgres when nil
+	dialect *dialect
+}
+
+// outboxLeaseReleased is when a released lease expired, which is before any
+// lease is asked for
+var outboxLeaseReleased = time.Unix(0, 0).UTC()
+
+// Append adds events to the end of the outbox, in order. It must run within
+// a transaction (see Transactor), so the events are only kept along with the
+// changes they announce
+func (r *OutboxRepository) Append(ctx context.Context, events []*model.Event) error {
+	if !inTx(ctx) {
+		log.Println("unable to append event: not within a transaction")
+		return rerrors.NewInternal()
+	}
+
+	d := r.d()
+	db := conn(ctx, r.DB)
+
+	query := `
+	INSERT INTO outbox (id, type, user_id, payload, occurred_at, available_at)
+	VALUES ($1, $2, $3, $4, $5, $6);
+	`
+
+	for _, e := range events {
+		q, args := d.rebind(query, []interface{}{e.ID, e.Type, e.UserID, e.User, d.timestamp(e.OccurredAt), d.timestamp(e.AvailableAt)})
+
+		if _, err := db.ExecContext(ctx, q, args...); err != nil {
+			log.Printf("unable to append event: %v\n", err)
+			return rerrors.NewInternal()
+		}
+	}
+
+	return nil
+}
+
+// Lease acquires the lease on the outbox for holder until the given time,
+// or renews it when holder already holds it. It reports whether holder
+// holds the lease, which is only acquired once it expired
+func (r *OutboxRepository) Lease(ctx context.Context, holder string, now, until time.Time) (bool, error) {
+	d := r.d()
+
+	query, args := d.rebind(`
+	UPDATE outbox_lease SET holder = $1, expires_at = $2
+	WHERE name = 'dispatcher' AND (holder = $1 OR expires_at < $3);
+	`, []interface{}{holder, d.timestamp(until), d.timestamp(now)})
+
+	res, err := conn(ctx, r.DB).ExecContext(ctx, query, args...)
+
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+
+	if err != nil {
+		return false, err
+	}
+
+	return n == 1, nil
+}
+
+// Release gives up the lease on the outbox, if holder holds it
+func (r *OutboxRepository) Release(ctx context.Context, holder string) error {
+	d := r.d()
+
+	query, args := d.rebind(`
+	UPDATE outbox_lease SET holder = '', expires_at = $2
+	WHERE name = 'dispatcher' AND holder = $1;
+	`, []interface{}{holder, d.timestamp(outboxLeaseReleased)})
+
+	_, err := conn(ctx, r.DB).ExecContext(ctx, query, args...)
+
+	return err
+}
+
+// Pending returns up to limit events that may be published at now, oldest
+// first. Events waiting for an earlier event of their user to be retried
+// are left out, so that the events of a user are published in order
+func (r *OutboxRepository) Pending(ctx context.Context, now time.Time, limit int) ([]*model.Event, error) {
+	d := r.d()
+
+	query, args := d.rebind(`
+	SELECT o.seq, o.id, o.type, o.user_id, o.payload, o.occurred_at, o.attempts, o.available_at
+	FROM outbox o
+	WHERE o.available_at <= $1
+	AND NOT EXISTS (
+		SELECT 1 FROM outbox p
+		WHERE p.user_id = o.user_id AND p.seq < o.seq AND p.available_at > $1
+	)
+	ORDER BY o.seq
+	LIMIT $2;
+	`, []interface{}{d.timestamp(now), limit})
+
+	events := []*model.Event{}
+
+	if err := conn(ctx, r.DB).SelectContext(ctx, &events, query, args...); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// Delivered removes a published event from the outbox
+func (r *OutboxRepository) Delivered(ctx context.Context, e *model.Event) error {
+	query, args := r.d().rebind("DELETE FROM outbox WHERE seq = $1;", []interface{}{e.Seq})
+
+	_, err := conn(ctx, r.DB).ExecContext(ctx, query, args...)
+
+	return err
+}
+
+// Retry records a failed attempt to publish an event, and why, so that it
+// is published again at the given time
+func (r *OutboxRepository) Retry(ctx context.Context, e *model.Event, at time.Time, reason string) error {
+	d := r.d()
+
+	query, args := d.rebind(`
+	UPDATE outbox SET attempts = attempts + 1, available_at = $2, last_error = $3
+	WHERE seq = $1;
+	`, []interface{}{e.Seq, d.timestamp(at), reason})
+
+	if _, err := conn(ctx, r.DB).ExecContext(ctx, query, args...); err != nil {
+		return err
+	}
+
+	e.Attempts++
+	e.AvailableAt = at
+
+	return nil
+}
+
+func (r *OutboxRepository) d() *dialect {
+	if r.dialect == nil {
+		return postgresDialect
+	}
+
+	return r.dialect
+}
@@ -0,0 +1,17 @@
+//go:build cgo
+
+package repository
+
+import (
+	"testing"
+
+	"github.com/klasrak/users-api/service"
+)
+
+func TestSQLiteOutboxRepository(t *testing.T) {
+	testOutboxRepository(t, func(t *testing.T) (service.OutboxRepository, service.Transactor) {
+		r, _ := newSQLiteRepository(t)
+
+		return r.OutboxRepository, r.Transactor
+	})
+}
@@ -0,0 +1,211 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	model "github.com/klasrak/users-api/models"
+	"github.com/klasrak/users-api/rerrors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuditRepository(t *testing.T) {
+	t.Run("Append", func(t *testing.T) {
+		newEntry := func() *model.AuditEntry {
+			return &model.AuditEntry{
+				UserID:    uuid.New(),
+				Actor:     "maria",
+				RequestID: "req-1",
+				Action:    model.AuditDelete,
+				Changes:   model.AuditChanges{},
+				CreatedAt: time.Date(2022, 5, 1, 10, 0, 0, 0, time.UTC),
+			}
+		}
+
+		t.Run("Success chained to the last entry", func(t *testing.T) {
+			db, mock := NewMock()
+
+			sqlxDB := sqlx.NewDb(db, "sqlmock")
+
+			defer sqlxDB.Close()
+
+			last := "ab12" + model.AuditGenesisHash[4:]
+			e := newEntry()
+
+			mock.ExpectBegin()
+			mock.ExpectExec(`SELECT pg_advisory_xact_lock\(\$1\);`).WithArgs(auditChainLock).WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectQuery(`SELECT a.hash FROM audit_log a ORDER BY a.id DESC LIMIT 1;`).WillReturnRows(sqlmock.NewRows([]string{"hash"}).AddRow(last))
+			mock.ExpectQuery(`INSERT INTO audit_log (.+) RETURNING id;`).
+				WithArgs(e.UserID, e.Actor, e.RequestID, e.Action, sqlmock.AnyArg(), e.CreatedAt, last, sqlmock.AnyArg()).
+				WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+			mock.ExpectCommit()
+
+			auditRepository := &AuditRepository{DB: sqlxDB}
+			transactor := &Transactor{DB: sqlxDB}
+
+			err := transactor.WithinTx(context.Background(), func(ctx context.Context) error {
+				return auditRepository.Append(ctx, e)
+			})
+
+			assert.NoError(t, err)
+			assert.Equal(t, int64(7), e.ID)
+			assert.Equal(t, last, e.PrevHash)
+			assert.Equal(t, e.ComputeHash(), e.Hash)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+
+		t.Run("Success first entry", func(t *testing.T) {
+			db, mock := NewMock()
+
+			sqlxDB := sqlx.NewDb(db, "sqlmock")
+
+			defer sqlxDB.Close()
+
+			e := newEntry()
+
+			mock.ExpectBegin()
+			mock.ExpectExec(`SELECT pg_advisory_xact_lock\(\$1\);`).WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectQuery(`SELECT a.hash FROM audit_log a`).WillReturnRows(sqlmock.NewRows([]string{"hash"}))
+			mock.ExpectQuery(`INSERT INTO audit_log (.+) RETURNING id;`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+			mock.ExpectCommit()
+
+			auditRepository := &AuditRepository{DB: sqlxDB}
+			transactor := &Transactor{DB: sqlxDB}
+
+			err := transactor.WithinTx(context.Background(), func(ctx context.Context) error {
+				return auditRepository.Append(ctx, e)
+			})
+
+			assert.NoError(t, err)
+			assert.Equal(t, model.AuditGenesisHash, e.PrevHash)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+
+		t.Run("Success appending several entries in a chain", func(t *testing.T) {
+			db, mock := NewMock()
+
+			sqlxDB := sqlx.NewDb(db, "sqlmock")
+
+			defer sqlxDB.Close()
+
+			entries := []*model.AuditEntry{newEntry(), newEntry()}
+
+			mock.ExpectBegin()
+			mock.ExpectExec(`SELECT pg_advisory_xact_lock\(\$1\);`).WithArgs(auditChainLock).WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectQuery(`SELECT a.hash FROM audit_log a`).WillReturnRows(sqlmock.NewRows([]string{"hash"}))
+			mock.ExpectQuery(`INSERT INTO audit_log (.+) RETURNING id;`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+			mock.ExpectQuery(`INSERT INTO audit_log (.+) RETURNING id;`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+			mock.ExpectCommit()
+
+			auditRepository := &AuditRepository{DB: sqlxDB}
+			transactor := &Transactor{DB: sqlxDB}
+
+			err := transactor.WithinTx(context.Background(), func(ctx context.Context) error {
+				return auditRepository.AppendAll(ctx, entries)
+			})
+
+			assert.NoError(t, err)
+			assert.Equal(t, model.AuditGenesisHash, entries[0].PrevHash)
+			assert.Equal(t, entries[0].Hash, entries[1].PrevHash)
+			assert.Equal(t, int64(2), entries[1].ID)
+			assert.NoError(t, model.VerifyAuditChain([]model.AuditEntry{*entries[0], *entries[1]}))
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+
+		t.Run("Error outside a transaction", func(t *testing.T) {
+			db, mock := NewMock()
+
+			sqlxDB := sqlx.NewDb(db, "sqlmock")
+
+			defer sqlxDB.Close()
+
+			auditRepository := &AuditRepository{DB: sqlxDB}
+
+			err := auditRepository.Append(context.Background(), newEntry())
+
+			assert.Equal(t, rerrors.NewInternal(), err)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+
+		t.Run("Error rolls back the transaction", func(t *testing.T) {
+			db, mock := NewMock()
+
+			sqlxDB := sqlx.NewDb(db, "sqlmock")
+
+			defer sqlxDB.Close()
+
+			mock.ExpectBegin()
+			mock.ExpectExec(`SELECT pg_advisory_xact_lock\(\$1\);`).WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectQuery(`SELECT a.hash FROM audit_log a`).WillReturnError(errors.New("connection reset"))
+			mock.ExpectRollback()
+
+			auditRepository := &AuditRepository{DB: sqlxDB}
+			transactor := &Transactor{DB: sqlxDB}
+
+			err := transactor.WithinTx(context.Background(), func(ctx context.Context) error {
+				return auditRepository.Append(ctx, newEntry())
+			})
+
+			assert.Equal(t, rerrors.NewInternal(), err)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	})
+
+	t.Run("List", func(t *testing.T) {
+		t.Run("Success with filters", func(t *testing.T) {
+			db, mock := NewMock()
+
+			sqlxDB := sqlx.NewDb(db, "sqlmock")
+
+			defer sqlxDB.Close()
+
+			uid := uuid.New()
+			since := time.Date(2022, 5, 1, 0, 0, 0, 0, time.UTC)
+
+			query := `SELECT a.id, a.user_id, a.actor, a.request_id, a.action, a.changes, a.created_at, a.prev_hash, a.hash FROM audit_log a WHERE a.user_id = \$1 AND a.actor = \$2 AND a.created_at >= \$3 AND a.id > \$4 ORDER BY a.id LIMIT \$5;`
+
+			rows := sqlmock.NewRows([]string{"id", "user_id", "actor", "request_id", "action", "changes", "created_at", "prev_hash", "hash"}).
+				AddRow(11, uid, "maria", "req-1", "update", []byte(`{"name":{"before":"João","after":"João Silva"}}`), since, model.AuditGenesisHash, "ab12")
+
+			mock.ExpectQuery(query).WithArgs(uid, "maria", since, int64(10), 50).WillReturnRows(rows)
+
+			auditRepository := &AuditRepository{DB: sqlxDB}
+
+			entries, err := auditRepository.List(context.Background(), model.AuditListParams{
+				UserID: &uid,
+				Actor:  "maria",
+				Since:  since,
+				After:  10,
+				Limit:  50,
+			})
+
+			assert.NoError(t, err)
+			assert.Len(t, entries, 1)
+			assert.Equal(t, int64(11), entries[0].ID)
+			assert.Equal(t, model.AuditUpdate, entries[0].Action)
+			assert.Equal(t, "João Silva", *entries[0].Changes["name"].After)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+
+		t.Run("Error", func(t *testing.T) {
+			db, mock := NewMock()
+
+			sqlxDB := sqlx.NewDb(db, "sqlmock")
+
+			defer sqlxDB.Close()
+
+			mock.ExpectQuery(`SELECT (.+) FROM audit_log a ORDER BY a.id LIMIT \$1;`).WillReturnError(errors.New("connection reset"))
+
+			auditRepository := &AuditRepository{DB: sqlxDB}
+
+			_, err := auditRepository.List(context.Background(), model.AuditListParams{Limit: 100})
+
+			assert.Equal(t, rerrors.NewInternal(), err)
+		})
+	})
+}
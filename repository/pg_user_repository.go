@@ -2,65 +2,137 @@ package repository
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"fmt"
 	"log"
 	"strings"
+	"unicode"
 
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
 	model "github.com/klasrak/users-api/models"
 	"github.com/klasrak/users-api/rerrors"
-	"github.com/klasrak/users-api/utils"
 	"github.com/lib/pq"
 )
 
-// UserRepository is a repository implementation of service layer UserRepository interface
+// UserRepository is a repository implementation of service layer UserRepository interface.
+// Listings, searches and reads by id are sent to Replica, when there is one
+// and it is healthy; everything else runs on DB, the primary
 type UserRepository struct {
-	DB *sqlx.DB
+	DB      *sqlx.DB
+	Replica *Replica
 }
 
-// GetAll returns all users or error
-func (r *UserRepository) GetAll(ctx context.Context, name string) ([]model.User, error) {
-	users := []model.User{}
+// userColumns lists the columns of a user in the order selectUsers scans them
+const userColumns = "u.id, u.name, u.email, u.cpf, u.birthdate, u.deleted_at, u.version"
 
-	query := "SELECT * FROM users u;"
+// GetAll returns a page of users in the requested order (by id when none is
+// given). When params.Name is given, only users whose name contains it (case
+// and accent insensitive) are returned. Deleted users are left out unless
+// params.IncludeDeleted is set. Keyset pages always end on a unique key,
+// which keeps them stable while rows are inserted
+func (r *UserRepository) GetAll(ctx context.Context, params model.UserListParams) (*model.UserPage, error) {
+	return listUsers(ctx, r.Replica.reader(ctx, r.DB), postgresDialect, params)
+}
 
-	rows, err := r.DB.QueryContext(ctx, query)
+// Stream calls fn with every user a listing with params would return, in
+// the same order, without paginating. Rows are read from the database as
+// fn consumes them, so only one user is held in memory at a time. Streaming
+// stops at the first error returned by fn
+func (r *UserRepository) Stream(ctx context.Context, params model.UserListParams, fn func(u *model.User) error) error {
+	return streamUsers(ctx, r.Replica.reader(ctx, r.DB), postgresDialect, params, fn)
+}
 
-	if err != nil {
-		return users, rerrors.NewInternal()
+// Search runs a full-text search over user names and e-mails using the
+// portuguese_unaccent configuration. Every word of q is matched as a prefix,
+// so partial names match, with or without accents. Results are ranked by
+// relevance and carry highlighted snippets of the matching name and e-mail.
+// Deleted users are never found
+func (r *UserRepository) Search(ctx context.Context, q string, limit int) ([]model.UserSearchResult, error) {
+	results := []model.UserSearchResult{}
+
+	tsquery := searchQuery(q)
+
+	if tsquery == "" {
+		return results, rerrors.NewBadRequest("search must contain at least one letter or digit")
 	}
 
-	defer rows.Close()
+	query := `
+	SELECT u.id, u.name, u.email, u.cpf, u.birthdate, u.version,
+		ts_rank(users_search_document(u.name, u.email), q) AS rank,
+		ts_headline('public.portuguese_unaccent', u.name, q, $3) AS name_highlight,
+		ts_headline('public.portuguese_unaccent', u.email, q, $3) AS email_highlight
+	FROM users u, to_tsquery('public.portuguese_unaccent', $1) q
+	WHERE users_search_document(u.name, u.email) @@ q AND u.deleted_at IS NULL
+	ORDER BY rank DESC, u.id
+	LIMIT $2;
+	`
+
+	if err := conn(ctx, r.Replica.reader(ctx, r.DB)).SelectContext(ctx, &results, query, tsquery, limit, headlineOptions); err != nil {
+		log.Printf("unable to search users: %v\n", err)
+		return results, rerrors.NewInternal()
+	}
 
-	for rows.Next() {
-		user := model.User{}
+	return results, nil
+}
 
-		if err := rows.Scan(&user.UID, &user.Name, &user.Email, &user.Cpf, &user.BirthDate); err != nil {
-			return users, rerrors.NewInternal()
-		}
+// headlineOptions wraps every matching term of a search highlight in <mark> tags
+const headlineOptions = "StartSel=<mark>, StopSel=</mark>, HighlightAll=true"
 
-		if name != "" && !strings.Contains(user.Name, name) {
-			continue
-		} else {
-			users = append(users, user)
-		}
+// searchQuery turns free text into a tsquery matching every word as a prefix,
+// e.g. "joão  sil" becomes "joão:* & sil:*". Anything but letters and digits
+// is dropped, so user input can never inject tsquery operators
+func searchQuery(q string) string {
+	words := strings.FieldsFunc(q, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	for i, w := range words {
+		words[i] = w + ":*"
 	}
 
-	if err := rows.Err(); err != nil {
-		return users, rerrors.NewInternal()
+	return strings.Join(words, " & ")
+}
+
+// GetByID fetches user by ID or return error. Deleted users are reported as
+// not found unless includeDeleted is set
+func (r *UserRepository) GetByID(ctx context.Context, id uuid.UUID, includeDeleted bool) (*model.User, error) {
+	user := &model.User{}
+
+	query := "SELECT " + userColumns + " FROM users u WHERE u.id = $1 AND u.deleted_at IS NULL;"
+
+	if includeDeleted {
+		query = "SELECT " + userColumns + " FROM users u WHERE u.id = $1;"
 	}
 
-	return users, nil
+	if err := conn(ctx, r.Replica.reader(ctx, r.DB)).GetContext(ctx, user, query, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return user, rerrors.NewNotFound("id", id.String())
+		}
+
+		log.Printf("unable to get user: %v\n", err)
+		return user, rerrors.NewInternal()
+	}
+
+	return user, nil
 }
 
-// GetByID fetches user by ID or return error
-func (r *UserRepository) GetByID(ctx context.Context, id uuid.UUID) (*model.User, error) {
+// Lock fetches a user, deleted or not, and locks it until the end of the
+// transaction, so no one else can change it in the meantime. It must run
+// within a transaction (see Transactor)
+func (r *UserRepository) Lock(ctx context.Context, id uuid.UUID) (*model.User, error) {
 	user := &model.User{}
 
-	query := "SELECT * FROM users WHERE id=$1;"
+	query := "SELECT " + userColumns + " FROM users u WHERE u.id = $1 FOR UPDATE;"
 
-	if err := r.DB.GetContext(ctx, user, query, id); err != nil {
-		return user, rerrors.NewNotFound("id", id.String())
+	if err := conn(ctx, r.DB).GetContext(ctx, user, query, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, rerrors.NewNotFound("user", id.String())
+		}
+
+		log.Printf("unable to lock user: %v\n", err)
+		return nil, rerrors.NewInternal()
 	}
 
 	return user, nil
@@ -70,7 +142,7 @@ func (r *UserRepository) GetByID(ctx context.Context, id uuid.UUID) (*model.User
 func (r *UserRepository) Create(ctx context.Context, u *model.User) (*model.User, error) {
 	query := "INSERT INTO users (name, email, cpf, birthdate) VALUES ($1, $2, $3, $4) RETURNING *;"
 
-	if err := r.DB.GetContext(ctx, u, query, u.Name, u.Email, u.Cpf, u.BirthDate); err != nil {
+	if err := conn(ctx, r.DB).GetContext(ctx, u, query, u.Name, u.Email, u.Cpf, u.BirthDate); err != nil {
 		if err, ok := err.(*pq.Error); ok && err.Code.Name() == "unique_violation" {
 			log.Printf("could not create user. Reason: %v\n", err.Error())
 			return nil, rerrors.NewConflict("user", "created", err.Detail)
@@ -83,62 +155,164 @@ func (r *UserRepository) Create(ctx context.Context, u *model.User) (*model.User
 	return u, nil
 }
 
-// Update a user
-func (r *UserRepository) Update(ctx context.Context, u *model.User) (*model.User, error) {
+// FindTaken returns the active users holding any of the given e-mails or cpfs
+func (r *UserRepository) FindTaken(ctx context.Context, emails, cpfs []string) ([]model.User, error) {
+	query := "SELECT " + userColumns + " FROM users u WHERE u.deleted_at IS NULL AND (u.email = ANY($1) OR u.cpf = ANY($2));"
 
-	query := `
-	UPDATE users u SET
-		name = COALESCE(:name, u."name"),
-		email = COALESCE(:email, u.email),
-		cpf = COALESCE(:cpf, u.cpf),
-		birthdate = COALESCE(:birthdate, u.birthdate)
-	WHERE u.id = :id
-	RETURNING *;
-	`
+	return selectUsers(ctx, conn(ctx, r.DB), query, pq.Array(emails), pq.Array(cpfs))
+}
 
-	user, err := utils.SanitizeUpdateParams(u)
+// CopyIn loads many new users at once with COPY, which is much faster than
+// inserting them one by one. Users must come with their ids, and are stored
+// at version 1. It must run within a transaction (see Transactor); when any
+// user is taken the whole copy fails with a conflict
+func (r *UserRepository) CopyIn(ctx context.Context, users []*model.User) error {
+	tx, ok := txFrom(ctx)
 
-	if err != nil {
-		return nil, err
+	if !ok {
+		log.Println("unable to copy users: not within a transaction")
+		return rerrors.NewInternal()
 	}
 
-	nstmt, err := r.DB.PrepareNamedContext(ctx, query)
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn("users", "id", "name", "email", "cpf", "birthdate"))
 
 	if err != nil {
-		log.Printf("unable to prepare user update query: %v\n", err)
-		return nil, rerrors.NewInternal()
+		log.Printf("unable to start copying users: %v\n", err)
+		return rerrors.NewInternal()
+	}
+
+	defer stmt.Close()
+
+	for _, u := range users {
+		if _, err := stmt.ExecContext(ctx, u.UID, u.Name, u.Email, u.Cpf, u.BirthDate); err != nil {
+			return copyError(tx.note(err))
+		}
+	}
+
+	// flushes the rows still buffered
+	if _, err := stmt.ExecContext(ctx); err != nil {
+		return copyError(tx.note(err))
+	}
+
+	return nil
+}
+
+// copyError reports why copying users failed. The server may reject the
+// copy while rows are still being sent, so any of them may fail
+func copyError(err error) error {
+	if err, ok := err.(*pq.Error); ok && err.Code.Name() == "unique_violation" {
+		log.Printf("could not copy users. Reason: %v\n", err.Error())
+		return rerrors.NewConflict("users", "imported", err.Detail)
 	}
 
-	if err := nstmt.GetContext(ctx, u, user); err != nil {
-		if err, ok := err.(*pq.Error); ok && err.Code.Name() != "unique_violation" {
+	log.Printf("unable to copy users: %v\n", err)
+	return rerrors.NewInternal()
+}
+
+// Update replaces every field of a user. Deleted users can't be updated
+// until they are restored. u.Version must hold the version the caller last
+// read: when the user has changed since then the update is rejected with a
+// precondition failure
+func (r *UserRepository) Update(ctx context.Context, u *model.User) (*model.User, error) {
+	query := `
+	UPDATE users u SET name = $1, email = $2, cpf = $3, birthdate = $4
+	WHERE u.id = $5 AND u.deleted_at IS NULL AND u.version = $6
+	RETURNING ` + userColumns + ";"
+
+	updated := &model.User{}
+
+	if err := conn(ctx, r.DB).GetContext(ctx, updated, query, u.Name, u.Email, u.Cpf, u.BirthDate, u.UID, u.Version); err != nil {
+		if err, ok := err.(*pq.Error); ok && err.Code.Name() == "unique_violation" {
 			log.Printf("could not update user. Reason: %v\n", err.Error())
 			return nil, rerrors.NewConflict("user", "updated", err.Detail)
 		}
 
-		if strings.Contains(err.Error(), "no rows") {
-			return nil, rerrors.NewNotFound("user", u.UID.String())
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, r.versionMismatch(ctx, u.UID, u.Version)
 		}
 
+		log.Printf("unable to update user: %v\n", err)
 		return nil, rerrors.NewInternal()
 	}
 
-	return u, err
+	return updated, nil
 }
 
-// Delete a user
+// versionMismatch explains why a versioned update matched no rows: either
+// the user does not exist (or is deleted) or it has moved past version
+func (r *UserRepository) versionMismatch(ctx context.Context, id uuid.UUID, version int) error {
+	var current int
+
+	query := "SELECT u.version FROM users u WHERE u.id = $1 AND u.deleted_at IS NULL;"
+
+	if err := conn(ctx, r.DB).GetContext(ctx, &current, query, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return rerrors.NewNotFound("user", id.String())
+		}
+
+		log.Printf("unable to read user version: %v\n", err)
+		return rerrors.NewInternal()
+	}
+
+	return rerrors.NewPreconditionFailed(fmt.Sprintf("user is at version %d, not %d", current, version))
+}
+
+// Delete marks a user as deleted. The row is kept so the user can be restored
 func (r *UserRepository) Delete(ctx context.Context, id string) error {
-	query := "DELETE FROM users u WHERE u.id = $1;"
+	query := "UPDATE users u SET deleted_at = now() WHERE u.id = $1 AND u.deleted_at IS NULL;"
 
-	_, err := r.DB.ExecContext(ctx, query, id)
+	res, err := conn(ctx, r.DB).ExecContext(ctx, query, id)
 
 	if err != nil {
-		if strings.Contains(err.Error(), "no rows") {
-			return rerrors.NewNotFound("user", id)
+		log.Printf("failed to delete user. Reason: %v\n", err)
+		return rerrors.NewInternal()
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return rerrors.NewNotFound("user", id)
+	}
+
+	return nil
+}
+
+// Restore undoes the deletion of a user. Restoring fails with a conflict when
+// another active user took the e-mail or cpf in the meantime
+func (r *UserRepository) Restore(ctx context.Context, id string) (*model.User, error) {
+	user := &model.User{}
+
+	query := "UPDATE users u SET deleted_at = NULL WHERE u.id = $1 AND u.deleted_at IS NOT NULL RETURNING " + userColumns + ";"
+
+	if err := conn(ctx, r.DB).GetContext(ctx, user, query, id); err != nil {
+		if err, ok := err.(*pq.Error); ok && err.Code.Name() == "unique_violation" {
+			log.Printf("could not restore user. Reason: %v\n", err.Error())
+			return nil, rerrors.NewConflict("user", "restored", err.Detail)
 		}
 
-		log.Printf("failed to delete user. Reason: %v\n", err)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, rerrors.NewNotFound("deleted user", id)
+		}
+
+		log.Printf("failed to restore user. Reason: %v\n", err)
+		return nil, rerrors.NewInternal()
+	}
+
+	return user, nil
+}
+
+// Purge removes a user for good, whether it was deleted before or not
+func (r *UserRepository) Purge(ctx context.Context, id string) error {
+	query := "DELETE FROM users u WHERE u.id = $1;"
+
+	res, err := conn(ctx, r.DB).ExecContext(ctx, query, id)
+
+	if err != nil {
+		log.Printf("failed to purge user. Reason: %v\n", err)
 		return rerrors.NewInternal()
 	}
 
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return rerrors.NewNotFound("user", id)
+	}
+
 	return nil
 }
@@ -44,22 +44,49 @@ func TestUserRepository(t *testing.T) {
 
 			defer sqlxDB.Close()
 
-			query := `SELECT \* FROM users u;`
+			query := `SELECT u.id, u.name, u.email, u.cpf, u.birthdate, u.deleted_at, u.version FROM users u WHERE u.deleted_at IS NULL ORDER BY u.id LIMIT \$1;`
 
 			userRepository := &UserRepository{DB: sqlxDB}
 
-			rows := sqlmock.NewRows([]string{"id", "name", "email", "cpf", "birthdate"}).AddRow(u.UID, u.Name, u.Email, u.Cpf, u.BirthDate)
+			rows := sqlmock.NewRows([]string{"id", "name", "email", "cpf", "birthdate", "deleted_at", "version"}).AddRow(u.UID, u.Name, u.Email, u.Cpf, u.BirthDate, nil, u.Version)
 
-			mock.ExpectQuery(query).WillReturnRows(rows)
+			mock.ExpectQuery(query).WithArgs(11).WillReturnRows(rows)
 
 			ctx := context.Background()
 
-			users, err := userRepository.GetAll(ctx, "")
+			page, err := userRepository.GetAll(ctx, model.UserListParams{Limit: 10})
 
-			assert.NotNil(t, users)
 			assert.NoError(t, err)
-			assert.IsType(t, []model.User{}, users)
-			assert.Len(t, users, 1)
+			assert.NotNil(t, page)
+			assert.Len(t, page.Data, 1)
+			assert.Empty(t, page.NextCursor)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+
+		t.Run("Success including deleted", func(t *testing.T) {
+			deletedAt := time.Date(2022, 5, 1, 10, 0, 0, 0, time.UTC)
+
+			db, mock := NewMock()
+
+			sqlxDB := sqlx.NewDb(db, "sqlmock")
+
+			defer sqlxDB.Close()
+
+			query := `SELECT u.id, u.name, u.email, u.cpf, u.birthdate, u.deleted_at, u.version FROM users u ORDER BY u.id LIMIT \$1;`
+
+			userRepository := &UserRepository{DB: sqlxDB}
+
+			rows := sqlmock.NewRows([]string{"id", "name", "email", "cpf", "birthdate", "deleted_at", "version"}).
+				AddRow(uuid.New(), faker.Name(), faker.Email(), "313.716.772-80", time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC), deletedAt, 1)
+
+			mock.ExpectQuery(query).WithArgs(11).WillReturnRows(rows)
+
+			page, err := userRepository.GetAll(context.Background(), model.UserListParams{Limit: 10, IncludeDeleted: true})
+
+			assert.NoError(t, err)
+			assert.Len(t, page.Data, 1)
+			assert.Equal(t, &deletedAt, page.Data[0].DeletedAt)
+			assert.NoError(t, mock.ExpectationsWereMet())
 		})
 
 		t.Run("Success with name filter", func(t *testing.T) {
@@ -77,33 +104,49 @@ func TestUserRepository(t *testing.T) {
 
 			defer sqlxDB.Close()
 
-			query := `SELECT \* FROM users u;`
+			query := `SELECT u.id, u.name, u.email, u.cpf, u.birthdate, u.deleted_at, u.version FROM users u WHERE u.deleted_at IS NULL AND immutable_unaccent\(u.name\) ILIKE immutable_unaccent\(\$1\) ORDER BY u.id LIMIT \$2;`
 
 			userRepository := &UserRepository{DB: sqlxDB}
 
-			rows := sqlmock.NewRows([]string{"id", "name", "email", "cpf", "birthdate"}).AddRow(u.UID, u.Name, u.Email, u.Cpf, u.BirthDate)
+			rows := sqlmock.NewRows([]string{"id", "name", "email", "cpf", "birthdate", "deleted_at", "version"}).AddRow(u.UID, u.Name, u.Email, u.Cpf, u.BirthDate, nil, u.Version)
 
-			mock.ExpectQuery(query).WillReturnRows(rows)
+			mock.ExpectQuery(query).WithArgs("%"+u.Name+"%", 11).WillReturnRows(rows)
 
 			ctx := context.Background()
 
-			users, err := userRepository.GetAll(ctx, u.Name)
+			page, err := userRepository.GetAll(ctx, model.UserListParams{Name: u.Name, Limit: 10})
 
-			assert.NotNil(t, users)
 			assert.NoError(t, err)
-			assert.IsType(t, []model.User{}, users)
-			assert.Len(t, users, 1)
+			assert.NotNil(t, page)
+			assert.Len(t, page.Data, 1)
+			assert.NoError(t, mock.ExpectationsWereMet())
 		})
 
-		t.Run("Error", func(t *testing.T) {
-			uid, _ := uuid.NewRandom()
-			u := &model.User{
-				UID:       uid,
-				Name:      faker.Name(),
-				Email:     faker.Email(),
-				Cpf:       "313.716.772-80",
-				BirthDate: time.Date(1990, 1, 1, 1, 1, 1, 1, time.UTC),
-			}
+		t.Run("Escapes wildcards in name filter", func(t *testing.T) {
+			db, mock := NewMock()
+
+			sqlxDB := sqlx.NewDb(db, "sqlmock")
+
+			defer sqlxDB.Close()
+
+			query := `SELECT u.id, u.name, u.email, u.cpf, u.birthdate, u.deleted_at, u.version FROM users u WHERE u.deleted_at IS NULL AND immutable_unaccent\(u.name\) ILIKE immutable_unaccent\(\$1\) ORDER BY u.id LIMIT \$2;`
+
+			userRepository := &UserRepository{DB: sqlxDB}
+
+			rows := sqlmock.NewRows([]string{"id", "name", "email", "cpf", "birthdate", "deleted_at", "version"})
+
+			mock.ExpectQuery(query).WithArgs(`%50\% o\_k\\%`, 11).WillReturnRows(rows)
+
+			page, err := userRepository.GetAll(context.Background(), model.UserListParams{Name: `50% o_k\`, Limit: 10})
+
+			assert.NoError(t, err)
+			assert.Len(t, page.Data, 0)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+
+		t.Run("Returns next cursor when there are more rows", func(t *testing.T) {
+			first, second := uuid.New(), uuid.New()
+			birthdate := time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC)
 
 			db, mock := NewMock()
 
@@ -111,224 +154,364 @@ func TestUserRepository(t *testing.T) {
 
 			defer sqlxDB.Close()
 
-			query := `SELECT \* FROM users u;`
+			query := `SELECT u.id, u.name, u.email, u.cpf, u.birthdate, u.deleted_at, u.version FROM users u WHERE u.deleted_at IS NULL ORDER BY u.id LIMIT \$1;`
 
 			userRepository := &UserRepository{DB: sqlxDB}
 
-			// rows := sqlmock.NewRows([]string{"id", "name", "email", "cpf", "birthdate"}).AddRow(u.UID, u.Name, u.Email, u.Cpf, u.BirthDate)
+			rows := sqlmock.NewRows([]string{"id", "name", "email", "cpf", "birthdate", "deleted_at", "version"}).
+				AddRow(first, faker.Name(), faker.Email(), "313.716.772-80", birthdate, nil, 1).
+				AddRow(second, faker.Name(), faker.Email(), "182.345.015-69", birthdate, nil, 1)
 
-			mock.ExpectQuery(query).WillReturnError(sql.ErrConnDone)
+			mock.ExpectQuery(query).WithArgs(2).WillReturnRows(rows)
 
-			ctx := context.Background()
+			page, err := userRepository.GetAll(context.Background(), model.UserListParams{Limit: 1})
 
-			users, err := userRepository.GetAll(ctx, u.Name)
+			assert.NoError(t, err)
+			assert.Len(t, page.Data, 1)
+			assert.Equal(t, first, page.Data[0].UID)
+			assert.NotEmpty(t, page.NextCursor)
 
-			assert.NotNil(t, users)
-			assert.Error(t, err)
-			assert.Equal(t, rerrors.NewInternal(), err)
-			assert.IsType(t, []model.User{}, users)
-			assert.Len(t, users, 0)
+			c, err := decodeCursor(page.NextCursor)
+
+			assert.NoError(t, err)
+			assert.Equal(t, []string{first.String()}, c.Values)
+			assert.NoError(t, mock.ExpectationsWereMet())
 		})
-	})
 
-	t.Run("GetByID", func(t *testing.T) {
-		t.Run("Success", func(t *testing.T) {
-			uid, _ := uuid.NewRandom()
-			u := &model.User{
-				UID:       uid,
-				Name:      faker.Name(),
-				Email:     faker.Email(),
-				Cpf:       "313.716.772-80",
-				BirthDate: time.Date(1990, 1, 1, 1, 1, 1, 1, time.UTC),
-			}
+		t.Run("Success with cursor", func(t *testing.T) {
+			last := uuid.New()
+
 			db, mock := NewMock()
 
 			sqlxDB := sqlx.NewDb(db, "sqlmock")
 
 			defer sqlxDB.Close()
 
-			query := `SELECT \* FROM users WHERE id\=\$1;`
+			query := `SELECT u.id, u.name, u.email, u.cpf, u.birthdate, u.deleted_at, u.version FROM users u WHERE u.deleted_at IS NULL AND \(\(u.id > \$1\)\) ORDER BY u.id LIMIT \$2;`
 
 			userRepository := &UserRepository{DB: sqlxDB}
 
-			rows := sqlmock.NewRows([]string{"id", "name", "email", "cpf", "birthdate"}).AddRow(u.UID, u.Name, u.Email, u.Cpf, u.BirthDate)
-
-			mock.ExpectQuery(query).WithArgs(u.UID).WillReturnRows(rows)
+			rows := sqlmock.NewRows([]string{"id", "name", "email", "cpf", "birthdate", "deleted_at", "version"})
 
-			ctx := context.Background()
+			mock.ExpectQuery(query).WithArgs(last.String(), 11).WillReturnRows(rows)
 
-			user, err := userRepository.GetByID(ctx, uid)
+			page, err := userRepository.GetAll(context.Background(), model.UserListParams{
+				Cursor: encodeCursor(cursor{Values: []string{last.String()}}),
+				Limit:  10,
+			})
 
 			assert.NoError(t, err)
-			assert.NotNil(t, user)
-			assert.Equal(t, u, user)
+			assert.Len(t, page.Data, 0)
+			assert.Empty(t, page.NextCursor)
+			assert.NoError(t, mock.ExpectationsWereMet())
 		})
 
-		t.Run("Error", func(t *testing.T) {
+		t.Run("Success with page", func(t *testing.T) {
 			uid, _ := uuid.NewRandom()
-			u := &model.User{}
+			name := faker.Name()
+
 			db, mock := NewMock()
 
 			sqlxDB := sqlx.NewDb(db, "sqlmock")
 
 			defer sqlxDB.Close()
 
-			query := `SELECT \* FROM users WHERE id\=\$1;`
+			countQuery := `SELECT COUNT\(\*\) FROM users u WHERE u.deleted_at IS NULL AND immutable_unaccent\(u.name\) ILIKE immutable_unaccent\(\$1\);`
+			query := `SELECT u.id, u.name, u.email, u.cpf, u.birthdate, u.deleted_at, u.version FROM users u WHERE u.deleted_at IS NULL AND immutable_unaccent\(u.name\) ILIKE immutable_unaccent\(\$1\) ORDER BY u.name COLLATE pt_br DESC, u.id LIMIT \$2 OFFSET \$3;`
 
 			userRepository := &UserRepository{DB: sqlxDB}
 
-			mock.ExpectQuery(query).WithArgs(uid).WillReturnError(sql.ErrNoRows)
+			rows := sqlmock.NewRows([]string{"id", "name", "email", "cpf", "birthdate", "deleted_at", "version"}).
+				AddRow(uid, name, faker.Email(), "313.716.772-80", time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC), nil, 1)
 
-			ctx := context.Background()
+			mock.ExpectBegin()
+			mock.ExpectQuery(countQuery).WithArgs("%" + name + "%").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(21))
+			mock.ExpectQuery(query).WithArgs("%"+name+"%", 10, 20).WillReturnRows(rows)
+			mock.ExpectRollback()
 
-			user, err := userRepository.GetByID(ctx, uid)
+			page, err := userRepository.GetAll(context.Background(), model.UserListParams{
+				Name:    name,
+				Sort:    model.Sort{{Field: "name", Desc: true}},
+				Page:    3,
+				PerPage: 10,
+			})
 
-			assert.Error(t, err)
-			assert.NotNil(t, user)
-			assert.Equal(t, rerrors.NewNotFound("id", uid.String()), err)
-			assert.Equal(t, u, user)
+			assert.NoError(t, err)
+			assert.Len(t, page.Data, 1)
+			assert.Equal(t, 3, page.Page)
+			assert.Equal(t, 10, page.PerPage)
+			assert.Equal(t, 21, *page.Total)
+			assert.Equal(t, 3, page.LastPage())
+			assert.NoError(t, mock.ExpectationsWereMet())
 		})
 
-	})
+		t.Run("Success with empty page", func(t *testing.T) {
+			db, mock := NewMock()
 
-	t.Run("Create", func(t *testing.T) {
-		t.Run("Success", func(t *testing.T) {
-			uid, _ := uuid.NewRandom()
+			sqlxDB := sqlx.NewDb(db, "sqlmock")
 
-			u := &model.User{
-				Name:      faker.Name(),
-				Email:     faker.Email(),
-				Cpf:       "313.716.772-80",
-				BirthDate: time.Date(1990, 1, 1, 1, 1, 1, 1, time.UTC),
-			}
+			defer sqlxDB.Close()
+
+			countQuery := `SELECT COUNT\(\*\) FROM users u WHERE u.deleted_at IS NULL;`
+			query := `SELECT u.id, u.name, u.email, u.cpf, u.birthdate, u.deleted_at, u.version FROM users u WHERE u.deleted_at IS NULL ORDER BY u.id LIMIT \$1 OFFSET \$2;`
+
+			userRepository := &UserRepository{DB: sqlxDB}
+
+			mock.ExpectBegin()
+			mock.ExpectQuery(countQuery).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+			mock.ExpectQuery(query).WithArgs(50, 0).WillReturnRows(sqlmock.NewRows([]string{"id", "name", "email", "cpf", "birthdate", "deleted_at", "version"}))
+			mock.ExpectRollback()
+
+			page, err := userRepository.GetAll(context.Background(), model.UserListParams{Page: 1, PerPage: 50})
+
+			assert.NoError(t, err)
+			assert.NotNil(t, page.Data)
+			assert.Len(t, page.Data, 0)
+			assert.Equal(t, 0, *page.Total)
+			assert.Equal(t, 1, page.LastPage())
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
 
+		t.Run("Error counting page", func(t *testing.T) {
 			db, mock := NewMock()
 
 			sqlxDB := sqlx.NewDb(db, "sqlmock")
 
 			defer sqlxDB.Close()
 
-			query := `INSERT INTO users \(name, email, cpf, birthdate\) VALUES \(\$1, \$2, \$3, \$4\) RETURNING \*;`
+			userRepository := &UserRepository{DB: sqlxDB}
+
+			mock.ExpectBegin()
+			mock.ExpectQuery(`SELECT COUNT\(\*\) FROM users u WHERE u.deleted_at IS NULL;`).WillReturnError(sql.ErrConnDone)
+			mock.ExpectRollback()
+
+			_, err := userRepository.GetAll(context.Background(), model.UserListParams{Page: 1, PerPage: 50})
+
+			assert.Error(t, err)
+			assert.Equal(t, rerrors.NewInternal(), err)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+
+		t.Run("Success sorted with cursor", func(t *testing.T) {
+			last := uuid.New()
+			next := uuid.New()
+			birthdate := time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC)
+
+			db, mock := NewMock()
+
+			sqlxDB := sqlx.NewDb(db, "sqlmock")
+
+			defer sqlxDB.Close()
+
+			query := `SELECT u.id, u.name, u.email, u.cpf, u.birthdate, u.deleted_at, u.version FROM users u WHERE u.deleted_at IS NULL AND ` +
+				`\(\(u.name COLLATE pt_br > \$1\) OR ` +
+				`\(u.name COLLATE pt_br = \$1 AND u.birthdate < \$2\) OR ` +
+				`\(u.name COLLATE pt_br = \$1 AND u.birthdate = \$2 AND u.id > \$3\)\) ` +
+				`ORDER BY u.name COLLATE pt_br, u.birthdate DESC, u.id LIMIT \$4;`
 
 			userRepository := &UserRepository{DB: sqlxDB}
 
-			rows := sqlmock.NewRows([]string{"id", "name", "email", "cpf", "birthdate"}).AddRow(uid, u.Name, u.Email, u.Cpf, u.BirthDate)
+			rows := sqlmock.NewRows([]string{"id", "name", "email", "cpf", "birthdate", "deleted_at", "version"}).
+				AddRow(next, "Álvaro", faker.Email(), "313.716.772-80", birthdate, nil, 1).
+				AddRow(uuid.New(), "Bruna", faker.Email(), "182.345.015-69", birthdate, nil, 1)
 
-			mock.ExpectQuery(query).WithArgs(u.Name, u.Email, u.Cpf, u.BirthDate).WillReturnRows(rows)
+			mock.ExpectQuery(query).WithArgs("Alvaro", "1990-01-01", last.String(), 2).WillReturnRows(rows)
 
-			ctx := context.Background()
+			sort := model.Sort{{Field: "name"}, {Field: "birthdate", Desc: true}}
 
-			user, err := userRepository.Create(ctx, u)
+			page, err := userRepository.GetAll(context.Background(), model.UserListParams{
+				Sort:   sort,
+				Cursor: encodeCursor(cursor{Sort: "name,-birthdate", Values: []string{"Alvaro", "1990-01-01", last.String()}}),
+				Limit:  1,
+			})
 
-			u.UID = uid
+			assert.NoError(t, err)
+			assert.Len(t, page.Data, 1)
+
+			c, err := decodeCursor(page.NextCursor)
 
 			assert.NoError(t, err)
-			assert.NotNil(t, user)
-			assert.Equal(t, u, user)
+			assert.Equal(t, cursor{Sort: "name,-birthdate", Values: []string{"Álvaro", "1990-01-01", next.String()}}, c)
+			assert.NoError(t, mock.ExpectationsWereMet())
 		})
 
-		t.Run("Error unique validation", func(t *testing.T) {
-			u := &model.User{
-				Name:      faker.Name(),
-				Email:     faker.Email(),
-				Cpf:       "313.716.772-80",
-				BirthDate: time.Date(1990, 1, 1, 1, 1, 1, 1, time.UTC),
-			}
-
+		t.Run("Success sorted by id does not repeat the tie breaker", func(t *testing.T) {
 			db, mock := NewMock()
 
 			sqlxDB := sqlx.NewDb(db, "sqlmock")
 
 			defer sqlxDB.Close()
 
-			query := `INSERT INTO users \(name, email, cpf, birthdate\) VALUES \(\$1, \$2, \$3, \$4\) RETURNING \*;`
+			query := `SELECT u.id, u.name, u.email, u.cpf, u.birthdate, u.deleted_at, u.version FROM users u WHERE u.deleted_at IS NULL ORDER BY u.email DESC, u.id DESC LIMIT \$1;`
 
 			userRepository := &UserRepository{DB: sqlxDB}
 
-			mock.ExpectQuery(query).WithArgs(u.Name, u.Email, u.Cpf, u.BirthDate).WillReturnError(&pq.Error{Code: "23505", Detail: "error detail"})
+			mock.ExpectQuery(query).WithArgs(11).WillReturnRows(sqlmock.NewRows([]string{"id", "name", "email", "cpf", "birthdate", "deleted_at", "version"}))
 
-			ctx := context.Background()
+			_, err := userRepository.GetAll(context.Background(), model.UserListParams{
+				Sort:  model.Sort{{Field: "email", Desc: true}, {Field: "id", Desc: true}, {Field: "name"}},
+				Limit: 10,
+			})
 
-			user, err := userRepository.Create(ctx, u)
+			assert.NoError(t, err)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+
+		t.Run("Error cursor from another sort", func(t *testing.T) {
+			db, _ := NewMock()
+
+			sqlxDB := sqlx.NewDb(db, "sqlmock")
+
+			defer sqlxDB.Close()
+
+			userRepository := &UserRepository{DB: sqlxDB}
+
+			_, err := userRepository.GetAll(context.Background(), model.UserListParams{
+				Sort:   model.Sort{{Field: "email"}},
+				Cursor: encodeCursor(cursor{Sort: "cpf", Values: []string{"313.716.772-80", uuid.NewString()}}),
+				Limit:  10,
+			})
 
 			assert.Error(t, err)
-			assert.Nil(t, user)
-			assert.Equal(t, rerrors.NewConflict("user", "created", "error detail"), err)
+			assert.Equal(t, rerrors.NewBadRequest("cursor was created with a different sort"), err)
 		})
 
-		t.Run("Internal Server Error", func(t *testing.T) {
-			u := &model.User{
-				Name:      faker.Name(),
-				Email:     faker.Email(),
-				Cpf:       "313.716.772-80",
-				BirthDate: time.Date(1990, 1, 1, 1, 1, 1, 1, time.UTC),
-			}
+		t.Run("Error unknown sort field", func(t *testing.T) {
+			db, _ := NewMock()
+
+			sqlxDB := sqlx.NewDb(db, "sqlmock")
 
+			defer sqlxDB.Close()
+
+			userRepository := &UserRepository{DB: sqlxDB}
+
+			_, err := userRepository.GetAll(context.Background(), model.UserListParams{
+				Sort:  model.Sort{{Field: "password"}},
+				Limit: 10,
+			})
+
+			assert.Error(t, err)
+			assert.Equal(t, rerrors.BadRequest, err.(*rerrors.Error).Type)
+		})
+
+		t.Run("Success with filter", func(t *testing.T) {
 			db, mock := NewMock()
 
 			sqlxDB := sqlx.NewDb(db, "sqlmock")
 
 			defer sqlxDB.Close()
 
-			query := `INSERT INTO users \(name, email, cpf, birthdate\) VALUES \(\$1, \$2, \$3, \$4\) RETURNING \*;`
+			countQuery := `SELECT COUNT\(\*\) FROM users u WHERE u.deleted_at IS NULL AND \(u.email ILIKE \$1\);`
+			query := `SELECT u.id, u.name, u.email, u.cpf, u.birthdate, u.deleted_at, u.version FROM users u WHERE u.deleted_at IS NULL AND \(u.email ILIKE \$1\) ORDER BY u.id LIMIT \$2 OFFSET \$3;`
 
 			userRepository := &UserRepository{DB: sqlxDB}
 
-			mock.ExpectQuery(query).WithArgs(u.Name, u.Email, u.Cpf, u.BirthDate).WillReturnError(errors.New("error"))
+			mock.ExpectBegin()
+			mock.ExpectQuery(countQuery).WithArgs("%@acme.com.br").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+			mock.ExpectQuery(query).WithArgs("%@acme.com.br", 10, 0).WillReturnRows(sqlmock.NewRows([]string{"id", "name", "email", "cpf", "birthdate", "deleted_at", "version"}))
+			mock.ExpectRollback()
 
-			ctx := context.Background()
+			_, err := userRepository.GetAll(context.Background(), model.UserListParams{
+				Filter:  `email ends_with "@acme.com.br"`,
+				Page:    1,
+				PerPage: 10,
+			})
 
-			user, err := userRepository.Create(ctx, u)
+			assert.NoError(t, err)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+
+		t.Run("Error invalid filter", func(t *testing.T) {
+			db, mock := NewMock()
+
+			sqlxDB := sqlx.NewDb(db, "sqlmock")
+
+			defer sqlxDB.Close()
+
+			userRepository := &UserRepository{DB: sqlxDB}
+
+			_, err := userRepository.GetAll(context.Background(), model.UserListParams{
+				Filter: `salary gt 1000`,
+				Limit:  10,
+			})
 
 			assert.Error(t, err)
-			assert.Nil(t, user)
-			assert.Equal(t, rerrors.NewInternal(), err)
+			assert.Equal(t, rerrors.NewBadRequest(`invalid filter at position 1: unknown field "salary"`), err)
+			assert.NoError(t, mock.ExpectationsWereMet())
 		})
-	})
 
-	t.Run("Update", func(t *testing.T) {
-		t.Run("Success", func(t *testing.T) {
-			t.Skip() // Could not make it work with this query
-			uid, _ := uuid.NewRandom()
-			oldCpf := "313.716.772-80"
-			oldBirthdate := time.Date(1990, 1, 1, 1, 1, 1, 1, time.UTC)
+		t.Run("Error invalid cursor", func(t *testing.T) {
+			db, _ := NewMock()
 
-			u := &model.User{
-				UID:       uid,
-				Name:      faker.Name(),
-				Email:     faker.Email(),
-				Cpf:       "313.716.772-80",
-				BirthDate: time.Date(1990, 1, 1, 1, 1, 1, 1, time.UTC),
+			sqlxDB := sqlx.NewDb(db, "sqlmock")
+
+			defer sqlxDB.Close()
+
+			userRepository := &UserRepository{DB: sqlxDB}
+
+			_, err := userRepository.GetAll(context.Background(), model.UserListParams{Cursor: "not a cursor", Limit: 10})
+
+			assert.Error(t, err)
+			assert.Equal(t, rerrors.NewBadRequest("invalid cursor"), err)
+		})
+
+		t.Run("Error forged cursor", func(t *testing.T) {
+			db, mock := NewMock()
+
+			sqlxDB := sqlx.NewDb(db, "sqlmock")
+
+			defer sqlxDB.Close()
+
+			userRepository := &UserRepository{DB: sqlxDB}
+
+			for name, values := range map[string][]string{
+				"id":        {"x"},
+				"birthdate": {"yesterday", uuid.NewString()},
+				"name":      {"Jo\x00ão", uuid.NewString()},
+			} {
+				sort := model.Sort{{Field: name}}
+
+				_, err := userRepository.GetAll(context.Background(), model.UserListParams{
+					Sort:   sort,
+					Cursor: encodeCursor(cursor{Sort: sort.String(), Values: values}),
+					Limit:  10,
+				})
+
+				assert.Equal(t, rerrors.NewBadRequest("invalid cursor"), err, name)
 			}
 
+			// nothing reaches the database
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+
+		t.Run("Error", func(t *testing.T) {
 			db, mock := NewMock()
 
 			sqlxDB := sqlx.NewDb(db, "sqlmock")
 
 			defer sqlxDB.Close()
 
-			query := `UPDATE users u SET name \\= COALESCE\\(\\:name, u\\."name"\\), email \\= COALESCE\\(\\:email, u\\.email\\), cpf \\= COALESCE\\(\\:cpf, u\\.cpf\\), birthdate \\= COALESCE\\(\\:birthdate, u\\.birthdate\\) WHERE u\\.id \\= \\:id RETURNING \\*;`
+			query := `SELECT u.id, u.name, u.email, u.cpf, u.birthdate, u.deleted_at, u.version FROM users u WHERE u.deleted_at IS NULL AND immutable_unaccent\(u.name\) ILIKE immutable_unaccent\(\$1\) ORDER BY u.id LIMIT \$2;`
 
 			userRepository := &UserRepository{DB: sqlxDB}
 
-			u.BirthDate = oldBirthdate
-			u.Cpf = oldCpf
-
-			prep := mock.ExpectPrepare(query)
-			prep.ExpectExec().WithArgs(u.UID, u.Name, u.Email, u.Cpf, u.BirthDate).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectQuery(query).WillReturnError(sql.ErrConnDone)
 
 			ctx := context.Background()
 
-			_, err := userRepository.Update(ctx, u)
-
-			assert.NoError(t, err)
+			page, err := userRepository.GetAll(ctx, model.UserListParams{Name: faker.Name(), Limit: 10})
 
+			assert.NotNil(t, page)
+			assert.Error(t, err)
+			assert.Equal(t, rerrors.NewInternal(), err)
+			assert.Len(t, page.Data, 0)
 		})
 	})
 
-	t.Run("Delete", func(t *testing.T) {
+	t.Run("Search", func(t *testing.T) {
 		t.Run("Success", func(t *testing.T) {
-			uid, _ := uuid.NewRandom()
+			uid := uuid.New()
+			birthdate := time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC)
 
 			db, mock := NewMock()
 
@@ -336,22 +519,28 @@ func TestUserRepository(t *testing.T) {
 
 			defer sqlxDB.Close()
 
-			userRepository := &UserRepository{DB: sqlxDB}
+			query := `SELECT u.id, u.name, u.email, u.cpf, u.birthdate, .+ FROM users u, to_tsquery\('public.portuguese_unaccent', \$1\) q WHERE users_search_document\(u.name, u.email\) @@ q AND u.deleted_at IS NULL ORDER BY rank DESC, u.id LIMIT \$2;`
 
-			query := `DELETE FROM users u WHERE u.id = \$1;`
+			userRepository := &UserRepository{DB: sqlxDB}
 
-			mock.ExpectExec(query).WithArgs(uid.String()).WillReturnResult(sqlmock.NewResult(0, 1))
+			rows := sqlmock.NewRows([]string{"id", "name", "email", "cpf", "birthdate", "rank", "name_highlight", "email_highlight"}).
+				AddRow(uid, "João da Silva", "joao@mail.com", "313.716.772-80", birthdate, 0.6, "<mark>João</mark> da Silva", "joao@mail.com")
 
-			ctx := context.Background()
+			mock.ExpectQuery(query).WithArgs("joao:* & sil:*", 20, headlineOptions).WillReturnRows(rows)
 
-			err := userRepository.Delete(ctx, uid.String())
+			results, err := userRepository.Search(context.Background(), "joao  sil", 20)
 
 			assert.NoError(t, err)
+			assert.Equal(t, []model.UserSearchResult{{
+				User:           model.User{UID: uid, Name: "João da Silva", Email: "joao@mail.com", Cpf: "313.716.772-80", BirthDate: birthdate},
+				Rank:           0.6,
+				NameHighlight:  "<mark>João</mark> da Silva",
+				EmailHighlight: "joao@mail.com",
+			}}, results)
+			assert.NoError(t, mock.ExpectationsWereMet())
 		})
 
-		t.Run("Error not found", func(t *testing.T) {
-			uid, _ := uuid.NewRandom()
-
+		t.Run("Error no search terms", func(t *testing.T) {
 			db, mock := NewMock()
 
 			sqlxDB := sqlx.NewDb(db, "sqlmock")
@@ -360,21 +549,14 @@ func TestUserRepository(t *testing.T) {
 
 			userRepository := &UserRepository{DB: sqlxDB}
 
-			query := `DELETE FROM users u WHERE u.id = \$1;`
-
-			mock.ExpectExec(query).WithArgs(uid.String()).WillReturnError(sql.ErrNoRows)
-
-			ctx := context.Background()
-
-			err := userRepository.Delete(ctx, uid.String())
+			_, err := userRepository.Search(context.Background(), " & | !:* ", 20)
 
 			assert.Error(t, err)
-			assert.Equal(t, rerrors.NewNotFound("user", uid.String()), err)
+			assert.Equal(t, rerrors.BadRequest, err.(*rerrors.Error).Type)
+			assert.NoError(t, mock.ExpectationsWereMet())
 		})
 
 		t.Run("Internal Server Error", func(t *testing.T) {
-			uid, _ := uuid.NewRandom()
-
 			db, mock := NewMock()
 
 			sqlxDB := sqlx.NewDb(db, "sqlmock")
@@ -383,17 +565,817 @@ func TestUserRepository(t *testing.T) {
 
 			userRepository := &UserRepository{DB: sqlxDB}
 
-			query := `DELETE FROM users u WHERE u.id = \$1;`
-
-			mock.ExpectExec(query).WithArgs(uid.String()).WillReturnError(errors.New("error"))
-
-			ctx := context.Background()
+			mock.ExpectQuery(`SELECT u.id`).WillReturnError(sql.ErrConnDone)
 
-			err := userRepository.Delete(ctx, uid.String())
+			results, err := userRepository.Search(context.Background(), "ana", 20)
 
 			assert.Error(t, err)
 			assert.Equal(t, rerrors.NewInternal(), err)
+			assert.Len(t, results, 0)
+		})
+
+		t.Run("Search query drops tsquery operators", func(t *testing.T) {
+			assert.Equal(t, "Maria:* & João:* & 42:*", searchQuery("  Maria & (João) | !42:*"))
+			assert.Equal(t, "", searchQuery("&|!():*"))
 		})
 	})
 
+	t.Run("GetByID", func(t *testing.T) {
+		t.Run("Success", func(t *testing.T) {
+			uid, _ := uuid.NewRandom()
+			u := &model.User{
+				UID:       uid,
+				Name:      faker.Name(),
+				Email:     faker.Email(),
+				Cpf:       "313.716.772-80",
+				BirthDate: time.Date(1990, 1, 1, 1, 1, 1, 1, time.UTC),
+			}
+			db, mock := NewMock()
+
+			sqlxDB := sqlx.NewDb(db, "sqlmock")
+
+			defer sqlxDB.Close()
+
+			query := `SELECT u.id, u.name, u.email, u.cpf, u.birthdate, u.deleted_at, u.version FROM users u WHERE u.id = \$1 AND u.deleted_at IS NULL;`
+
+			userRepository := &UserRepository{DB: sqlxDB}
+
+			rows := sqlmock.NewRows([]string{"id", "name", "email", "cpf", "birthdate"}).AddRow(u.UID, u.Name, u.Email, u.Cpf, u.BirthDate)
+
+			mock.ExpectQuery(query).WithArgs(u.UID).WillReturnRows(rows)
+
+			ctx := context.Background()
+
+			user, err := userRepository.GetByID(ctx, uid, false)
+
+			assert.NoError(t, err)
+			assert.NotNil(t, user)
+			assert.Equal(t, u, user)
+		})
+
+		t.Run("Success including deleted", func(t *testing.T) {
+			deletedAt := time.Date(2022, 5, 1, 10, 0, 0, 0, time.UTC)
+			u := &model.User{
+				UID:       uuid.New(),
+				Name:      faker.Name(),
+				Email:     faker.Email(),
+				Cpf:       "313.716.772-80",
+				BirthDate: time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC),
+				DeletedAt: &deletedAt,
+			}
+			db, mock := NewMock()
+
+			sqlxDB := sqlx.NewDb(db, "sqlmock")
+
+			defer sqlxDB.Close()
+
+			query := `SELECT u.id, u.name, u.email, u.cpf, u.birthdate, u.deleted_at, u.version FROM users u WHERE u.id = \$1;`
+
+			userRepository := &UserRepository{DB: sqlxDB}
+
+			rows := sqlmock.NewRows([]string{"id", "name", "email", "cpf", "birthdate", "deleted_at", "version"}).AddRow(u.UID, u.Name, u.Email, u.Cpf, u.BirthDate, deletedAt, u.Version)
+
+			mock.ExpectQuery(query).WithArgs(u.UID).WillReturnRows(rows)
+
+			user, err := userRepository.GetByID(context.Background(), u.UID, true)
+
+			assert.NoError(t, err)
+			assert.Equal(t, u, user)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+
+		t.Run("Error", func(t *testing.T) {
+			uid, _ := uuid.NewRandom()
+			u := &model.User{}
+			db, mock := NewMock()
+
+			sqlxDB := sqlx.NewDb(db, "sqlmock")
+
+			defer sqlxDB.Close()
+
+			query := `SELECT u.id, u.name, u.email, u.cpf, u.birthdate, u.deleted_at, u.version FROM users u WHERE u.id = \$1 AND u.deleted_at IS NULL;`
+
+			userRepository := &UserRepository{DB: sqlxDB}
+
+			mock.ExpectQuery(query).WithArgs(uid).WillReturnError(sql.ErrNoRows)
+
+			ctx := context.Background()
+
+			user, err := userRepository.GetByID(ctx, uid, false)
+
+			assert.Error(t, err)
+			assert.NotNil(t, user)
+			assert.Equal(t, rerrors.NewNotFound("id", uid.String()), err)
+			assert.Equal(t, u, user)
+		})
+
+		t.Run("Database failure", func(t *testing.T) {
+			uid, _ := uuid.NewRandom()
+			db, mock := NewMock()
+
+			sqlxDB := sqlx.NewDb(db, "sqlmock")
+
+			defer sqlxDB.Close()
+
+			userRepository := &UserRepository{DB: sqlxDB}
+
+			mock.ExpectQuery(`SELECT .* FROM users u WHERE u.id = \$1`).WithArgs(uid).WillReturnError(errors.New("connection refused"))
+
+			_, err := userRepository.GetByID(context.Background(), uid, false)
+
+			assert.Equal(t, rerrors.NewInternal(), err)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	})
+
+	t.Run("Create", func(t *testing.T) {
+		t.Run("Success", func(t *testing.T) {
+			uid, _ := uuid.NewRandom()
+
+			u := &model.User{
+				Name:      faker.Name(),
+				Email:     faker.Email(),
+				Cpf:       "313.716.772-80",
+				BirthDate: time.Date(1990, 1, 1, 1, 1, 1, 1, time.UTC),
+			}
+
+			db, mock := NewMock()
+
+			sqlxDB := sqlx.NewDb(db, "sqlmock")
+
+			defer sqlxDB.Close()
+
+			query := `INSERT INTO users \(name, email, cpf, birthdate\) VALUES \(\$1, \$2, \$3, \$4\) RETURNING \*;`
+
+			userRepository := &UserRepository{DB: sqlxDB}
+
+			rows := sqlmock.NewRows([]string{"id", "name", "email", "cpf", "birthdate"}).AddRow(uid, u.Name, u.Email, u.Cpf, u.BirthDate)
+
+			mock.ExpectQuery(query).WithArgs(u.Name, u.Email, u.Cpf, u.BirthDate).WillReturnRows(rows)
+
+			ctx := context.Background()
+
+			user, err := userRepository.Create(ctx, u)
+
+			u.UID = uid
+
+			assert.NoError(t, err)
+			assert.NotNil(t, user)
+			assert.Equal(t, u, user)
+		})
+
+		t.Run("Error unique validation", func(t *testing.T) {
+			u := &model.User{
+				Name:      faker.Name(),
+				Email:     faker.Email(),
+				Cpf:       "313.716.772-80",
+				BirthDate: time.Date(1990, 1, 1, 1, 1, 1, 1, time.UTC),
+			}
+
+			db, mock := NewMock()
+
+			sqlxDB := sqlx.NewDb(db, "sqlmock")
+
+			defer sqlxDB.Close()
+
+			query := `INSERT INTO users \(name, email, cpf, birthdate\) VALUES \(\$1, \$2, \$3, \$4\) RETURNING \*;`
+
+			userRepository := &UserRepository{DB: sqlxDB}
+
+			mock.ExpectQuery(query).WithArgs(u.Name, u.Email, u.Cpf, u.BirthDate).WillReturnError(&pq.Error{Code: "23505", Detail: "error detail"})
+
+			ctx := context.Background()
+
+			user, err := userRepository.Create(ctx, u)
+
+			assert.Error(t, err)
+			assert.Nil(t, user)
+			assert.Equal(t, rerrors.NewConflict("user", "created", "error detail"), err)
+		})
+
+		t.Run("Internal Server Error", func(t *testing.T) {
+			u := &model.User{
+				Name:      faker.Name(),
+				Email:     faker.Email(),
+				Cpf:       "313.716.772-80",
+				BirthDate: time.Date(1990, 1, 1, 1, 1, 1, 1, time.UTC),
+			}
+
+			db, mock := NewMock()
+
+			sqlxDB := sqlx.NewDb(db, "sqlmock")
+
+			defer sqlxDB.Close()
+
+			query := `INSERT INTO users \(name, email, cpf, birthdate\) VALUES \(\$1, \$2, \$3, \$4\) RETURNING \*;`
+
+			userRepository := &UserRepository{DB: sqlxDB}
+
+			mock.ExpectQuery(query).WithArgs(u.Name, u.Email, u.Cpf, u.BirthDate).WillReturnError(errors.New("error"))
+
+			ctx := context.Background()
+
+			user, err := userRepository.Create(ctx, u)
+
+			assert.Error(t, err)
+			assert.Nil(t, user)
+			assert.Equal(t, rerrors.NewInternal(), err)
+		})
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		query := `UPDATE users u SET name = \$1, email = \$2, cpf = \$3, birthdate = \$4 WHERE u.id = \$5 AND u.deleted_at IS NULL AND u.version = \$6 RETURNING u.id, u.name, u.email, u.cpf, u.birthdate, u.deleted_at, u.version;`
+
+		t.Run("Success", func(t *testing.T) {
+			u := &model.User{
+				UID:       uuid.New(),
+				Name:      faker.Name(),
+				Email:     faker.Email(),
+				Cpf:       "313.716.772-80",
+				BirthDate: time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC),
+				Version:   2,
+			}
+
+			db, mock := NewMock()
+
+			sqlxDB := sqlx.NewDb(db, "sqlmock")
+
+			defer sqlxDB.Close()
+
+			userRepository := &UserRepository{DB: sqlxDB}
+
+			rows := sqlmock.NewRows([]string{"id", "name", "email", "cpf", "birthdate", "deleted_at", "version"}).
+				AddRow(u.UID, u.Name, u.Email, u.Cpf, u.BirthDate, nil, 3)
+
+			mock.ExpectQuery(query).WithArgs(u.Name, u.Email, u.Cpf, u.BirthDate, u.UID, 2).WillReturnRows(rows)
+
+			user, err := userRepository.Update(context.Background(), u)
+
+			assert.NoError(t, err)
+			assert.Equal(t, u.Name, user.Name)
+			assert.Equal(t, 3, user.Version)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+
+		t.Run("Error conflict", func(t *testing.T) {
+			u := &model.User{UID: uuid.New(), Name: faker.Name(), Email: "taken@mail.com", Version: 2}
+
+			db, mock := NewMock()
+
+			sqlxDB := sqlx.NewDb(db, "sqlmock")
+
+			defer sqlxDB.Close()
+
+			userRepository := &UserRepository{DB: sqlxDB}
+
+			mock.ExpectQuery(query).WillReturnError(&pq.Error{Code: "23505", Detail: "Key (email)=(taken@mail.com) already exists."})
+
+			user, err := userRepository.Update(context.Background(), u)
+
+			assert.Nil(t, user)
+			assert.Equal(t, rerrors.NewConflict("user", "updated", "Key (email)=(taken@mail.com) already exists."), err)
+		})
+
+		t.Run("Internal Server Error", func(t *testing.T) {
+			u := &model.User{UID: uuid.New(), Name: faker.Name(), Version: 2}
+
+			db, mock := NewMock()
+
+			sqlxDB := sqlx.NewDb(db, "sqlmock")
+
+			defer sqlxDB.Close()
+
+			userRepository := &UserRepository{DB: sqlxDB}
+
+			mock.ExpectQuery(query).WillReturnError(errors.New("connection reset"))
+
+			user, err := userRepository.Update(context.Background(), u)
+
+			assert.Nil(t, user)
+			assert.Equal(t, rerrors.NewInternal(), err)
+		})
+	})
+
+	t.Run("Update version check", func(t *testing.T) {
+		updateQuery := `UPDATE users u SET .+ WHERE u.id = \$5 AND u.deleted_at IS NULL AND u.version = \$6 RETURNING .+;`
+		versionQuery := `SELECT u.version FROM users u WHERE u.id = \$1 AND u.deleted_at IS NULL;`
+
+		t.Run("Error version mismatch", func(t *testing.T) {
+			u := &model.User{UID: uuid.New(), Name: faker.Name(), Version: 2}
+
+			db, mock := NewMock()
+
+			sqlxDB := sqlx.NewDb(db, "sqlmock")
+
+			defer sqlxDB.Close()
+
+			userRepository := &UserRepository{DB: sqlxDB}
+
+			mock.ExpectQuery(updateQuery).WillReturnError(sql.ErrNoRows)
+			mock.ExpectQuery(versionQuery).WithArgs(u.UID).WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(3))
+
+			user, err := userRepository.Update(context.Background(), u)
+
+			assert.Nil(t, user)
+			assert.Equal(t, rerrors.NewPreconditionFailed("user is at version 3, not 2"), err)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+
+		t.Run("Error not found", func(t *testing.T) {
+			u := &model.User{UID: uuid.New(), Name: faker.Name(), Version: 2}
+
+			db, mock := NewMock()
+
+			sqlxDB := sqlx.NewDb(db, "sqlmock")
+
+			defer sqlxDB.Close()
+
+			userRepository := &UserRepository{DB: sqlxDB}
+
+			mock.ExpectQuery(updateQuery).WillReturnError(sql.ErrNoRows)
+			mock.ExpectQuery(versionQuery).WithArgs(u.UID).WillReturnError(sql.ErrNoRows)
+
+			user, err := userRepository.Update(context.Background(), u)
+
+			assert.Nil(t, user)
+			assert.Equal(t, rerrors.NewNotFound("user", u.UID.String()), err)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		t.Run("Success", func(t *testing.T) {
+			uid, _ := uuid.NewRandom()
+
+			db, mock := NewMock()
+
+			sqlxDB := sqlx.NewDb(db, "sqlmock")
+
+			defer sqlxDB.Close()
+
+			userRepository := &UserRepository{DB: sqlxDB}
+
+			query := `UPDATE users u SET deleted_at = now\(\) WHERE u.id = \$1 AND u.deleted_at IS NULL;`
+
+			mock.ExpectExec(query).WithArgs(uid.String()).WillReturnResult(sqlmock.NewResult(0, 1))
+
+			ctx := context.Background()
+
+			err := userRepository.Delete(ctx, uid.String())
+
+			assert.NoError(t, err)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+
+		t.Run("Error not found", func(t *testing.T) {
+			uid, _ := uuid.NewRandom()
+
+			db, mock := NewMock()
+
+			sqlxDB := sqlx.NewDb(db, "sqlmock")
+
+			defer sqlxDB.Close()
+
+			userRepository := &UserRepository{DB: sqlxDB}
+
+			query := `UPDATE users u SET deleted_at = now\(\) WHERE u.id = \$1 AND u.deleted_at IS NULL;`
+
+			mock.ExpectExec(query).WithArgs(uid.String()).WillReturnResult(sqlmock.NewResult(0, 0))
+
+			ctx := context.Background()
+
+			err := userRepository.Delete(ctx, uid.String())
+
+			assert.Error(t, err)
+			assert.Equal(t, rerrors.NewNotFound("user", uid.String()), err)
+		})
+
+		t.Run("Internal Server Error", func(t *testing.T) {
+			uid, _ := uuid.NewRandom()
+
+			db, mock := NewMock()
+
+			sqlxDB := sqlx.NewDb(db, "sqlmock")
+
+			defer sqlxDB.Close()
+
+			userRepository := &UserRepository{DB: sqlxDB}
+
+			query := `UPDATE users u SET deleted_at = now\(\) WHERE u.id = \$1 AND u.deleted_at IS NULL;`
+
+			mock.ExpectExec(query).WithArgs(uid.String()).WillReturnError(errors.New("error"))
+
+			ctx := context.Background()
+
+			err := userRepository.Delete(ctx, uid.String())
+
+			assert.Error(t, err)
+			assert.Equal(t, rerrors.NewInternal(), err)
+		})
+	})
+
+	t.Run("Restore", func(t *testing.T) {
+		query := `UPDATE users u SET deleted_at = NULL WHERE u.id = \$1 AND u.deleted_at IS NOT NULL RETURNING u.id, u.name, u.email, u.cpf, u.birthdate, u.deleted_at, u.version;`
+
+		t.Run("Success", func(t *testing.T) {
+			u := &model.User{
+				UID:       uuid.New(),
+				Name:      faker.Name(),
+				Email:     faker.Email(),
+				Cpf:       "313.716.772-80",
+				BirthDate: time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC),
+			}
+
+			db, mock := NewMock()
+
+			sqlxDB := sqlx.NewDb(db, "sqlmock")
+
+			defer sqlxDB.Close()
+
+			userRepository := &UserRepository{DB: sqlxDB}
+
+			rows := sqlmock.NewRows([]string{"id", "name", "email", "cpf", "birthdate", "deleted_at", "version"}).AddRow(u.UID, u.Name, u.Email, u.Cpf, u.BirthDate, nil, u.Version)
+
+			mock.ExpectQuery(query).WithArgs(u.UID.String()).WillReturnRows(rows)
+
+			user, err := userRepository.Restore(context.Background(), u.UID.String())
+
+			assert.NoError(t, err)
+			assert.Equal(t, u, user)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+
+		t.Run("Error not found", func(t *testing.T) {
+			uid := uuid.New()
+
+			db, mock := NewMock()
+
+			sqlxDB := sqlx.NewDb(db, "sqlmock")
+
+			defer sqlxDB.Close()
+
+			userRepository := &UserRepository{DB: sqlxDB}
+
+			mock.ExpectQuery(query).WithArgs(uid.String()).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+			user, err := userRepository.Restore(context.Background(), uid.String())
+
+			assert.Nil(t, user)
+			assert.Equal(t, rerrors.NewNotFound("deleted user", uid.String()), err)
+		})
+
+		t.Run("Error unique violation", func(t *testing.T) {
+			uid := uuid.New()
+
+			db, mock := NewMock()
+
+			sqlxDB := sqlx.NewDb(db, "sqlmock")
+
+			defer sqlxDB.Close()
+
+			userRepository := &UserRepository{DB: sqlxDB}
+
+			mock.ExpectQuery(query).WithArgs(uid.String()).WillReturnError(&pq.Error{Code: "23505", Detail: "error detail"})
+
+			user, err := userRepository.Restore(context.Background(), uid.String())
+
+			assert.Nil(t, user)
+			assert.Equal(t, rerrors.NewConflict("user", "restored", "error detail"), err)
+		})
+	})
+
+	t.Run("Purge", func(t *testing.T) {
+		query := `DELETE FROM users u WHERE u.id = \$1;`
+
+		t.Run("Success", func(t *testing.T) {
+			uid := uuid.New()
+
+			db, mock := NewMock()
+
+			sqlxDB := sqlx.NewDb(db, "sqlmock")
+
+			defer sqlxDB.Close()
+
+			userRepository := &UserRepository{DB: sqlxDB}
+
+			mock.ExpectExec(query).WithArgs(uid.String()).WillReturnResult(sqlmock.NewResult(0, 1))
+
+			err := userRepository.Purge(context.Background(), uid.String())
+
+			assert.NoError(t, err)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+
+		t.Run("Error not found", func(t *testing.T) {
+			uid := uuid.New()
+
+			db, mock := NewMock()
+
+			sqlxDB := sqlx.NewDb(db, "sqlmock")
+
+			defer sqlxDB.Close()
+
+			userRepository := &UserRepository{DB: sqlxDB}
+
+			mock.ExpectExec(query).WithArgs(uid.String()).WillReturnResult(sqlmock.NewResult(0, 0))
+
+			err := userRepository.Purge(context.Background(), uid.String())
+
+			assert.Equal(t, rerrors.NewNotFound("user", uid.String()), err)
+		})
+
+		t.Run("Internal Server Error", func(t *testing.T) {
+			uid := uuid.New()
+
+			db, mock := NewMock()
+
+			sqlxDB := sqlx.NewDb(db, "sqlmock")
+
+			defer sqlxDB.Close()
+
+			userRepository := &UserRepository{DB: sqlxDB}
+
+			mock.ExpectExec(query).WithArgs(uid.String()).WillReturnError(errors.New("error"))
+
+			err := userRepository.Purge(context.Background(), uid.String())
+
+			assert.Equal(t, rerrors.NewInternal(), err)
+		})
+	})
+
+	t.Run("Lock", func(t *testing.T) {
+		query := `SELECT u.id, u.name, u.email, u.cpf, u.birthdate, u.deleted_at, u.version FROM users u WHERE u.id = \$1 FOR UPDATE;`
+
+		t.Run("Success within a transaction", func(t *testing.T) {
+			uid := uuid.New()
+
+			db, mock := NewMock()
+
+			sqlxDB := sqlx.NewDb(db, "sqlmock")
+
+			defer sqlxDB.Close()
+
+			rows := sqlmock.NewRows([]string{"id", "name", "email", "cpf", "birthdate", "deleted_at", "version"}).
+				AddRow(uid, "João", "joao@mail.com", "313.716.772-80", time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC), nil, 3)
+
+			mock.ExpectBegin()
+			mock.ExpectQuery(query).WithArgs(uid).WillReturnRows(rows)
+			mock.ExpectCommit()
+
+			userRepository := &UserRepository{DB: sqlxDB}
+			transactor := &Transactor{DB: sqlxDB}
+
+			var user *model.User
+
+			err := transactor.WithinTx(context.Background(), func(ctx context.Context) error {
+				var err error
+				user, err = userRepository.Lock(ctx, uid)
+				return err
+			})
+
+			assert.NoError(t, err)
+			assert.Equal(t, uid, user.UID)
+			assert.Equal(t, 3, user.Version)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+
+		t.Run("Error not found", func(t *testing.T) {
+			uid := uuid.New()
+
+			db, mock := NewMock()
+
+			sqlxDB := sqlx.NewDb(db, "sqlmock")
+
+			defer sqlxDB.Close()
+
+			mock.ExpectQuery(query).WithArgs(uid).WillReturnError(sql.ErrNoRows)
+
+			userRepository := &UserRepository{DB: sqlxDB}
+
+			user, err := userRepository.Lock(context.Background(), uid)
+
+			assert.Nil(t, user)
+			assert.Equal(t, rerrors.NewNotFound("user", uid.String()), err)
+		})
+	})
+
+	t.Run("FindTaken", func(t *testing.T) {
+		query := `SELECT u.id, u.name, u.email, u.cpf, u.birthdate, u.deleted_at, u.version FROM users u WHERE u.deleted_at IS NULL AND \(u.email = ANY\(\$1\) OR u.cpf = ANY\(\$2\)\);`
+
+		t.Run("Success", func(t *testing.T) {
+			uid := uuid.New()
+			emails := []string{"joao@mail.com", "maria@mail.com"}
+			cpfs := []string{"313.716.772-80", "182.345.015-69"}
+
+			db, mock := NewMock()
+
+			sqlxDB := sqlx.NewDb(db, "sqlmock")
+
+			defer sqlxDB.Close()
+
+			rows := sqlmock.NewRows([]string{"id", "name", "email", "cpf", "birthdate", "deleted_at", "version"}).
+				AddRow(uid, "João", "joao@mail.com", "313.716.772-80", time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC), nil, 3)
+
+			mock.ExpectQuery(query).WithArgs(pq.Array(emails), pq.Array(cpfs)).WillReturnRows(rows)
+
+			userRepository := &UserRepository{DB: sqlxDB}
+
+			users, err := userRepository.FindTaken(context.Background(), emails, cpfs)
+
+			assert.NoError(t, err)
+			assert.Len(t, users, 1)
+			assert.Equal(t, uid, users[0].UID)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+
+		t.Run("Internal Server Error", func(t *testing.T) {
+			db, mock := NewMock()
+
+			sqlxDB := sqlx.NewDb(db, "sqlmock")
+
+			defer sqlxDB.Close()
+
+			mock.ExpectQuery(query).WillReturnError(errors.New("connection reset"))
+
+			userRepository := &UserRepository{DB: sqlxDB}
+
+			_, err := userRepository.FindTaken(context.Background(), []string{"joao@mail.com"}, []string{"313.716.772-80"})
+
+			assert.Equal(t, rerrors.NewInternal(), err)
+		})
+	})
+
+	t.Run("CopyIn", func(t *testing.T) {
+		copyQuery := `COPY "users" \("id", "name", "email", "cpf", "birthdate"\) FROM STDIN`
+
+		birthdate := time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC)
+
+		users := []*model.User{
+			{UID: uuid.New(), Name: "João", Email: "joao@mail.com", Cpf: "313.716.772-80", BirthDate: birthdate},
+			{UID: uuid.New(), Name: "Maria", Email: "maria@mail.com", Cpf: "182.345.015-69", BirthDate: birthdate},
+		}
+
+		t.Run("Success within a transaction", func(t *testing.T) {
+			db, mock := NewMock()
+
+			sqlxDB := sqlx.NewDb(db, "sqlmock")
+
+			defer sqlxDB.Close()
+
+			mock.ExpectBegin()
+			prep := mock.ExpectPrepare(copyQuery)
+
+			for _, u := range users {
+				prep.ExpectExec().WithArgs(u.UID, u.Name, u.Email, u.Cpf, u.BirthDate).WillReturnResult(sqlmock.NewResult(0, 0))
+			}
+
+			prep.ExpectExec().WithArgs().WillReturnResult(sqlmock.NewResult(0, 2))
+			mock.ExpectCommit()
+
+			userRepository := &UserRepository{DB: sqlxDB}
+			transactor := &Transactor{DB: sqlxDB}
+
+			err := transactor.WithinTx(context.Background(), func(ctx context.Context) error {
+				return userRepository.CopyIn(ctx, users)
+			})
+
+			assert.NoError(t, err)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+
+		t.Run("Error unique violation", func(t *testing.T) {
+			db, mock := NewMock()
+
+			sqlxDB := sqlx.NewDb(db, "sqlmock")
+
+			defer sqlxDB.Close()
+
+			mock.ExpectBegin()
+			prep := mock.ExpectPrepare(copyQuery)
+			prep.ExpectExec().WillReturnResult(sqlmock.NewResult(0, 0))
+			prep.ExpectExec().WillReturnResult(sqlmock.NewResult(0, 0))
+			prep.ExpectExec().WillReturnError(&pq.Error{Code: "23505", Detail: "Key (cpf)=(182.345.015-69) already exists."})
+			mock.ExpectRollback()
+
+			userRepository := &UserRepository{DB: sqlxDB}
+			transactor := &Transactor{DB: sqlxDB}
+
+			err := transactor.WithinTx(context.Background(), func(ctx context.Context) error {
+				return userRepository.CopyIn(ctx, users)
+			})
+
+			assert.Equal(t, rerrors.NewConflict("users", "imported", "Key (cpf)=(182.345.015-69) already exists."), err)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+
+		t.Run("Error outside a transaction", func(t *testing.T) {
+			db, mock := NewMock()
+
+			sqlxDB := sqlx.NewDb(db, "sqlmock")
+
+			defer sqlxDB.Close()
+
+			userRepository := &UserRepository{DB: sqlxDB}
+
+			err := userRepository.CopyIn(context.Background(), users)
+
+			assert.Equal(t, rerrors.NewInternal(), err)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	})
+
+	t.Run("Stream", func(t *testing.T) {
+		columns := []string{"id", "name", "email", "cpf", "birthdate", "deleted_at", "version"}
+		query := `SELECT u.id, u.name, u.email, u.cpf, u.birthdate, u.deleted_at, u.version FROM users u WHERE u.deleted_at IS NULL AND \(u.email ILIKE \$1\) ORDER BY u.id;`
+
+		t.Run("Success", func(t *testing.T) {
+			db, mock := NewMock()
+
+			sqlxDB := sqlx.NewDb(db, "sqlmock")
+
+			defer sqlxDB.Close()
+
+			rows := sqlmock.NewRows(columns).
+				AddRow(uuid.New(), "João", "joao@acme.com.br", "313.716.772-80", time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC), nil, 1).
+				AddRow(uuid.New(), "Maria", "maria@acme.com.br", "182.345.015-69", time.Date(1987, 6, 21, 0, 0, 0, 0, time.UTC), nil, 4)
+
+			mock.ExpectQuery(query).WithArgs("%@acme.com.br").WillReturnRows(rows)
+
+			userRepository := &UserRepository{DB: sqlxDB}
+
+			var names []string
+
+			err := userRepository.Stream(context.Background(), model.UserListParams{Filter: `email ends_with "@acme.com.br"`}, func(u *model.User) error {
+				names = append(names, u.Name)
+				return nil
+			})
+
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"João", "Maria"}, names)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+
+		t.Run("Stops at the first error of fn", func(t *testing.T) {
+			db, mock := NewMock()
+
+			sqlxDB := sqlx.NewDb(db, "sqlmock")
+
+			defer sqlxDB.Close()
+
+			rows := sqlmock.NewRows(columns).
+				AddRow(uuid.New(), "João", "joao@acme.com.br", "313.716.772-80", time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC), nil, 1).
+				AddRow(uuid.New(), "Maria", "maria@acme.com.br", "182.345.015-69", time.Date(1987, 6, 21, 0, 0, 0, 0, time.UTC), nil, 4)
+
+			mock.ExpectQuery(query).WillReturnRows(rows)
+
+			userRepository := &UserRepository{DB: sqlxDB}
+
+			calls := 0
+			writeErr := errors.New("broken pipe")
+
+			err := userRepository.Stream(context.Background(), model.UserListParams{Filter: `email ends_with "@acme.com.br"`}, func(u *model.User) error {
+				calls++
+				return writeErr
+			})
+
+			assert.Equal(t, writeErr, err)
+			assert.Equal(t, 1, calls)
+		})
+
+		t.Run("Error invalid filter", func(t *testing.T) {
+			db, mock := NewMock()
+
+			sqlxDB := sqlx.NewDb(db, "sqlmock")
+
+			defer sqlxDB.Close()
+
+			userRepository := &UserRepository{DB: sqlxDB}
+
+			err := userRepository.Stream(context.Background(), model.UserListParams{Filter: `salary gt 1000`}, func(u *model.User) error {
+				return nil
+			})
+
+			assert.Equal(t, rerrors.NewBadRequest(`invalid filter at position 1: unknown field "salary"`), err)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+
+		t.Run("Internal Server Error", func(t *testing.T) {
+			db, mock := NewMock()
+
+			sqlxDB := sqlx.NewDb(db, "sqlmock")
+
+			defer sqlxDB.Close()
+
+			mock.ExpectQuery(`SELECT (.+) FROM users u ORDER BY u.name COLLATE pt_br DESC, u.id;`).WillReturnError(errors.New("connection reset"))
+
+			userRepository := &UserRepository{DB: sqlxDB}
+
+			err := userRepository.Stream(context.Background(), model.UserListParams{Sort: model.Sort{{Field: "name", Desc: true}}, IncludeDeleted: true}, func(u *model.User) error {
+				return nil
+			})
+
+			assert.Equal(t, rerrors.NewInternal(), err)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	})
 }
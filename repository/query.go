@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+)
+
+// queryArgs collects positional arguments while a query is being built
+type queryArgs []interface{}
+
+// add appends v to the argument list and returns its placeholder
+func (a *queryArgs) add(v interface{}) string {
+	*a = append(*a, v)
+
+	return fmt.Sprintf("$%d", len(*a))
+}
+
+// where joins conditions into a WHERE clause, or nothing when there are none
+func where(conds []string) string {
+	if len(conds) == 0 {
+		return ""
+	}
+
+	return " WHERE " + strings.Join(conds, " AND ")
+}
+
+// likeEscaper escapes LIKE/ILIKE wildcards so user input is matched literally
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
+
+// searchSeparators are the characters, besides spaces, that SQL searches
+// split names and e-mails into words at. memSearch splits at any character
+// that is neither a letter nor a digit; these are the ones names and
+// e-mails hold
+var searchSeparators = []string{".", "@", "_", "-", "+", "'"}
+
+// wordSearchQuery builds the query finding active users whose name or e-mail
+// has words starting with every word of a search, ranked as memSearch ranks
+// them and at most limit of them, so only those are read.
+//
+// name and email are the SQL expressions of the folded name and e-mail,
+// prefixed returns an expression of its argument with a space before it,
+// and like is the LIKE condition, with %s standing for the text and the
+// pattern
+func wordSearchQuery(words []string, limit int, name, email string, prefixed func(text string) string, like string) (string, queryArgs) {
+	var args queryArgs
+
+	name, email = prefixed(spaced(name)), prefixed(spaced(email))
+
+	conds := []string{"u.deleted_at IS NULL"}
+	ranks := make([]string, len(words))
+
+	for i, w := range words {
+		// after a space, which is where every word starts once
+		// separators are replaced
+		pattern := args.add("% " + escapeLike(w) + "%")
+
+		inName, inEmail := fmt.Sprintf(like, name, pattern), fmt.Sprintf(like, email, pattern)
+
+		conds = append(conds, fmt.Sprintf("(%s OR %s)", inName, inEmail))
+		ranks[i] = fmt.Sprintf("CASE WHEN %s THEN %v ELSE %v END", inName, nameWeight, emailWeight)
+	}
+
+	query := "SELECT " + userColumns + " FROM users u" + where(conds) +
+		" ORDER BY " + strings.Join(ranks, " + ") + " DESC, u.id LIMIT " + args.add(limit) + ";"
+
+	return query, args
+}
+
+// spaced returns the SQL expression of text with every search separator
+// replaced by a space
+func spaced(text string) string {
+	for _, sep := range searchSeparators {
+		text = fmt.Sprintf("REPLACE(%s, '%s', ' ')", text, strings.ReplaceAll(sep, "'", "''"))
+	}
+
+	return text
+}
@@ -0,0 +1,119 @@
+package repository
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/klasrak/users-api/utils"
+)
+
+// DefaultReplicaMaxLag is how far behind the primary a replica may fall
+// before reads stop being sent to it, unless told otherwise
+const DefaultReplicaMaxLag = 10 * time.Second
+
+// replicaCheckInterval is how often the health of a replica is checked
+var replicaCheckInterval = 5 * time.Second
+
+// replicaCheckTimeout bounds each health check, so a replica that hangs is
+// found unhealthy as well
+const replicaCheckTimeout = 2 * time.Second
+
+// replicaLag reads how far behind the primary a Postgres replica is, in
+// seconds. A replica that replayed everything it received is not behind,
+// however long ago the primary last wrote; a database not in recovery is
+// the primary itself
+const replicaLag = `
+SELECT CASE
+	WHEN NOT pg_is_in_recovery() OR pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+	ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)
+END;
+`
+
+// Replica is a read-only copy of the primary database, kept up to date by
+// streaming replication. Reads that may lag behind writes are sent to it
+// while it is healthy: reachable and no more than MaxLag behind the primary.
+//
+// Its health is checked in the background, at most every
+// replicaCheckInterval, by the reads themselves. Until the first check
+// succeeds, and whenever the last one failed, reads go to the primary
+type Replica struct {
+	DB     *sqlx.DB
+	MaxLag time.Duration
+
+	mu        sync.Mutex
+	healthy   bool
+	checking  bool
+	checkedAt time.Time
+}
+
+// NewReplica creates a Replica over db allowed to lag maxLag behind the
+// primary (DefaultReplicaMaxLag when 0). It returns nil when db is nil, so
+// that reads always go to the primary
+func NewReplica(db *sqlx.DB, maxLag time.Duration) *Replica {
+	if db == nil {
+		return nil
+	}
+
+	if maxLag == 0 {
+		maxLag = DefaultReplicaMaxLag
+	}
+
+	return &Replica{DB: db, MaxLag: maxLag}
+}
+
+// reader returns the database reads made with ctx are sent to: the replica
+// while it is healthy, or primary when there is no replica, when it is
+// unhealthy, within transactions and when ctx asks to read its own writes
+// (see utils.WithReadYourWrites)
+func (r *Replica) reader(ctx context.Context, primary *sqlx.DB) *sqlx.DB {
+	if r == nil || inTx(ctx) || utils.ReadYourWrites(ctx) || !r.usable() {
+		return primary
+	}
+
+	return r.DB
+}
+
+// usable reports whether the replica was healthy when last checked,
+// starting a new check when that was too long ago
+func (r *Replica) usable() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.checking && time.Since(r.checkedAt) >= replicaCheckInterval {
+		r.checking = true
+		go r.check()
+	}
+
+	return r.healthy
+}
+
+// check finds out whether the replica is healthy, logging every change
+func (r *Replica) check() {
+	ctx, cancel := context.WithTimeout(context.Background(), replicaCheckTimeout)
+	defer cancel()
+
+	var lag float64
+
+	err := r.DB.GetContext(ctx, &lag, replicaLag)
+
+	healthy := err == nil && time.Duration(lag*float64(time.Second)) <= r.MaxLag
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch {
+	case healthy && !r.healthy:
+		log.Println("replica is healthy, sending reads to it")
+	case !healthy && r.healthy && err != nil:
+		log.Printf("replica is unhealthy, sending reads to the primary: %v\n", err)
+	case !healthy && r.healthy:
+		log.Printf("replica is %.1fs behind the primary, sending reads to the primary\n", lag)
+	}
+
+	r.healthy = healthy
+	r.checking = false
+	r.checkedAt = time.Now()
+}
@@ -0,0 +1,118 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/klasrak/users-api/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplica(t *testing.T) {
+	userRows := func(id uuid.UUID) *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"id", "name", "email", "cpf", "birthdate", "deleted_at", "version"}).
+			AddRow(id, "João", "joao@mail.com", "313.716.772-80", time.Now(), nil, 1)
+	}
+
+	t.Run("Reads go to the primary until the replica is found healthy", func(t *testing.T) {
+		primaryDB, primary := NewMock()
+		replicaDB, replica := NewMock()
+
+		defer primaryDB.Close()
+		defer replicaDB.Close()
+
+		id := uuid.New()
+
+		primary.ExpectQuery(`SELECT .* FROM users u WHERE u.id = \$1`).WithArgs(id).WillReturnRows(userRows(id))
+		replica.ExpectQuery(`SELECT CASE`).WillReturnRows(sqlmock.NewRows([]string{"lag"}).AddRow(0.5))
+		replica.ExpectQuery(`SELECT .* FROM users u WHERE u.id = \$1`).WithArgs(id).WillReturnRows(userRows(id))
+
+		r := &UserRepository{
+			DB:      sqlx.NewDb(primaryDB, "sqlmock"),
+			Replica: NewReplica(sqlx.NewDb(replicaDB, "sqlmock"), 0),
+		}
+
+		_, err := r.GetByID(context.Background(), id, false)
+
+		assert.NoError(t, err)
+
+		assert.Eventually(t, func() bool {
+			r.Replica.mu.Lock()
+			defer r.Replica.mu.Unlock()
+
+			return r.Replica.healthy
+		}, time.Second, time.Millisecond)
+
+		_, err = r.GetByID(context.Background(), id, false)
+
+		assert.NoError(t, err)
+		assert.NoError(t, primary.ExpectationsWereMet())
+		assert.NoError(t, replica.ExpectationsWereMet())
+	})
+
+	t.Run("Health", func(t *testing.T) {
+		tests := []struct {
+			name    string
+			lag     float64
+			err     error
+			healthy bool
+		}{
+			{name: "Caught up", lag: 0, healthy: true},
+			{name: "Within max lag", lag: 9.5, healthy: true},
+			{name: "Lagging", lag: 30, healthy: false},
+			{name: "Unreachable", err: errors.New("connection refused"), healthy: false},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				db, mock := NewMock()
+
+				defer db.Close()
+
+				expectation := mock.ExpectQuery(`SELECT CASE`)
+
+				if tt.err != nil {
+					expectation.WillReturnError(tt.err)
+				} else {
+					expectation.WillReturnRows(sqlmock.NewRows([]string{"lag"}).AddRow(tt.lag))
+				}
+
+				r := NewReplica(sqlx.NewDb(db, "sqlmock"), 0)
+				r.healthy = !tt.healthy
+
+				r.check()
+
+				assert.Equal(t, tt.healthy, r.healthy)
+				assert.False(t, r.checking)
+				assert.NoError(t, mock.ExpectationsWereMet())
+			})
+		}
+	})
+
+	t.Run("Reader", func(t *testing.T) {
+		primary := &sqlx.DB{}
+		replica := &sqlx.DB{}
+
+		healthy := &Replica{DB: replica, MaxLag: DefaultReplicaMaxLag, healthy: true, checkedAt: time.Now()}
+		unhealthy := &Replica{DB: replica, MaxLag: DefaultReplicaMaxLag, checkedAt: time.Now()}
+
+		ctx := context.Background()
+
+		assert.Same(t, replica, healthy.reader(ctx, primary))
+		assert.Same(t, primary, healthy.reader(utils.WithReadYourWrites(ctx), primary))
+		assert.Same(t, primary, healthy.reader(context.WithValue(ctx, txKey{}, &txConn{}), primary))
+		assert.Same(t, primary, unhealthy.reader(ctx, primary))
+		assert.Same(t, primary, (*Replica)(nil).reader(ctx, primary))
+	})
+
+	t.Run("Only Postgres supports replicas", func(t *testing.T) {
+		_, err := CreateRepository(&Options{Driver: DriverSQLite, Replica: &sqlx.DB{}})
+
+		assert.Error(t, err)
+	})
+}
@@ -1,25 +1,153 @@
 package repository
 
 import (
+	"fmt"
+	"time"
+
 	"github.com/jmoiron/sqlx"
+	"github.com/klasrak/users-api/service"
 	_ "github.com/lib/pq"
 )
 
+// Database drivers repositories can be created for
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+	DriverMySQL    = "mysql"
+)
+
 // Repository combines all repositories
 type Repository struct {
-	UserRepository *UserRepository
+	UserRepository            service.UserRepository
+	AuditRepository           service.AuditRepository
+	OutboxRepository          service.OutboxRepository
+	WebhookRepository         service.WebhookRepository
+	WebhookDeliveryRepository service.WebhookDeliveryRepository
+	Transactor                service.Transactor
 }
 
-// CreateRepository create a implementation of repository with all injected dependencies
+// CreateRepository create a implementation of repository with all injected
+// dependencies, for the database driver of options (Postgres by default)
 func CreateRepository(options *Options) (*Repository, error) {
-	return &Repository{
-		UserRepository: &UserRepository{
-			DB: options.DB,
-		},
-	}, nil
+	if options.Replica != nil && options.Driver != DriverPostgres && options.Driver != "" {
+		return nil, fmt.Errorf("read replicas are not supported with database driver %q", options.Driver)
+	}
+
+	switch options.Driver {
+	case DriverPostgres, "":
+		return &Repository{
+			UserRepository: &UserRepository{
+				DB:      options.DB,
+				Replica: NewReplica(options.Replica, options.ReplicaMaxLag),
+			},
+			AuditRepository: &AuditRepository{
+				DB: options.DB,
+			},
+			OutboxRepository: &OutboxRepository{
+				DB:      options.DB,
+				dialect: postgresDialect,
+			},
+			WebhookRepository: &WebhookRepository{
+				DB:      options.DB,
+				dialect: postgresDialect,
+			},
+			WebhookDeliveryRepository: &WebhookDeliveryRepository{
+				DB:      options.DB,
+				dialect: postgresDialect,
+			},
+			Transactor: &Transactor{
+				DB: options.DB,
+			},
+		}, nil
+
+	case DriverSQLite:
+		return &Repository{
+			UserRepository: &SQLiteUserRepository{
+				DB: options.DB,
+			},
+			AuditRepository: &SQLiteAuditRepository{
+				DB: options.DB,
+			},
+			OutboxRepository: &OutboxRepository{
+				DB:      options.DB,
+				dialect: sqliteDialect,
+			},
+			WebhookRepository: &WebhookRepository{
+				DB:      options.DB,
+				dialect: sqliteDialect,
+			},
+			WebhookDeliveryRepository: &WebhookDeliveryRepository{
+				DB:      options.DB,
+				dialect: sqliteDialect,
+			},
+			Transactor: &Transactor{
+				DB: options.DB,
+			},
+		}, nil
+
+	case DriverMySQL:
+		return &Repository{
+			UserRepository: &MySQLUserRepository{
+				DB: options.DB,
+			},
+			AuditRepository: &MySQLAuditRepository{
+				DB: options.DB,
+			},
+			OutboxRepository: &OutboxRepository{
+				DB:      options.DB,
+				dialect: mysqlDialect,
+			},
+			WebhookRepository: &WebhookRepository{
+				DB:      options.DB,
+				dialect: mysqlDialect,
+			},
+			WebhookDeliveryRepository: &WebhookDeliveryRepository{
+				DB:      options.DB,
+				dialect: mysqlDialect,
+			},
+			Transactor: &Transactor{
+				DB: options.DB,
+			},
+		}, nil
+
+	default:
+		return nil, fmt.Errorf("unknown database driver %q", options.Driver)
+	}
+}
+
+// MemoryRepository combines the in-memory repositories, which share a
+// single MemoryStore
+type MemoryRepository struct {
+	UserRepository            *MemoryUserRepository
+	AuditRepository           *MemoryAuditRepository
+	OutboxRepository          *MemoryOutboxRepository
+	WebhookRepository         *MemoryWebhookRepository
+	WebhookDeliveryRepository *MemoryWebhookDeliveryRepository
+	Transactor                *MemoryTransactor
+}
+
+// CreateMemoryRepository creates repositories keeping everything in memory,
+// starting out empty
+func CreateMemoryRepository() *MemoryRepository {
+	store := NewMemoryStore()
+
+	return &MemoryRepository{
+		UserRepository:            &MemoryUserRepository{Store: store},
+		AuditRepository:           &MemoryAuditRepository{Store: store},
+		OutboxRepository:          &MemoryOutboxRepository{Store: store},
+		WebhookRepository:         &MemoryWebhookRepository{Store: store},
+		WebhookDeliveryRepository: &MemoryWebhookDeliveryRepository{Store: store},
+		Transactor:                &MemoryTransactor{Store: store},
+	}
 }
 
 // Options is a utility to define all dependencies and parameters to inject
 type Options struct {
-	DB *sqlx.DB
+	DB     *sqlx.DB
+	Driver string
+	// Replica is an optional read replica of DB, only supported by Postgres
+	Replica *sqlx.DB
+	// ReplicaMaxLag is how far behind DB Replica may fall before reads stop
+	// being sent to it (DefaultReplicaMaxLag when 0)
+	ReplicaMaxLag time.Duration
 }
@@ -0,0 +1,144 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	model "github.com/klasrak/users-api/models"
+	"github.com/klasrak/users-api/rerrors"
+)
+
+// userSortColumns maps the sortable User fields to their SQL expressions.
+// Names use the pt_br ICU collation so accented names sort as expected
+var userSortColumns = map[string]string{
+	"id":        "u.id",
+	"name":      "u.name COLLATE pt_br",
+	"email":     "u.email",
+	"cpf":       "u.cpf",
+	"birthdate": "u.birthdate",
+}
+
+// sortKey is a sort field resolved to its SQL expression
+type sortKey struct {
+	field  string
+	column string
+	desc   bool
+}
+
+// userSortKeys resolves the requested sort to the given columns. The primary
+// key is always the last key, so that the order is total and keyset
+// pagination never skips or repeats rows sharing the same sort values
+func userSortKeys(sort model.Sort, columns map[string]string) ([]sortKey, error) {
+	keys := make([]sortKey, 0, len(sort)+1)
+
+	for _, f := range sort {
+		column, ok := columns[f.Field]
+
+		if !ok {
+			return nil, rerrors.NewBadRequest(fmt.Sprintf("can't sort by %q", f.Field))
+		}
+
+		keys = append(keys, sortKey{field: f.Field, column: column, desc: f.Desc})
+
+		if f.Field == "id" {
+			return keys, nil
+		}
+	}
+
+	return append(keys, sortKey{field: "id", column: columns["id"]}), nil
+}
+
+// orderBy builds the ORDER BY clause for the given keys
+func orderBy(keys []sortKey) string {
+	terms := make([]string, len(keys))
+
+	for i, k := range keys {
+		terms[i] = k.column
+
+		if k.desc {
+			terms[i] += " DESC"
+		}
+	}
+
+	return " ORDER BY " + strings.Join(terms, ", ")
+}
+
+// keysetCondition builds the condition selecting the rows that come after
+// values in the order defined by keys, i.e. for keys (a, b):
+// a > $1 OR (a = $1 AND b > $2)
+func keysetCondition(keys []sortKey, values []string, args *queryArgs) string {
+	placeholders := make([]string, len(keys))
+
+	for i, v := range values {
+		placeholders[i] = args.add(v)
+	}
+
+	alternatives := make([]string, len(keys))
+
+	for i, k := range keys {
+		var terms []string
+
+		for j := 0; j < i; j++ {
+			terms = append(terms, fmt.Sprintf("%s = %s", keys[j].column, placeholders[j]))
+		}
+
+		op := ">"
+
+		if k.desc {
+			op = "<"
+		}
+
+		terms = append(terms, fmt.Sprintf("%s %s %s", k.column, op, placeholders[i]))
+
+		alternatives[i] = "(" + strings.Join(terms, " AND ") + ")"
+	}
+
+	return "(" + strings.Join(alternatives, " OR ") + ")"
+}
+
+// sortValues extracts the values of the sort keys from u, to be stored in a cursor
+func sortValues(keys []sortKey, u model.User) []string {
+	values := make([]string, len(keys))
+
+	for i, k := range keys {
+		values[i] = fieldValue(u, k.field)
+	}
+
+	return values
+}
+
+// fieldValue returns the value of a sortable field of u as text
+func fieldValue(u model.User, field string) string {
+	switch field {
+	case "id":
+		return u.UID.String()
+	case "name":
+		return u.Name
+	case "email":
+		return u.Email
+	case "cpf":
+		return u.Cpf
+	case "birthdate":
+		return u.BirthDate.Format("2006-01-02")
+	}
+
+	return ""
+}
+
+// validFieldValue reports whether v is the text fieldValue returns for a
+// value of a sortable field
+func validFieldValue(field, v string) bool {
+	switch field {
+	case "id":
+		id, err := uuid.Parse(v)
+		return err == nil && id.String() == v
+	case "birthdate":
+		d, err := time.Parse("2006-01-02", v)
+		return err == nil && d.Format("2006-01-02") == v
+	}
+
+	// text, which databases refuse to hold NUL characters in
+	return !strings.ContainsRune(v, 0)
+}
@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/mattn/go-sqlite3"
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+)
+
+// SQLiteDriver is the database/sql driver for SQLite databases holding
+// users. It is the sqlite3 driver (which needs cgo) along with the fold
+// function and the pt_br collation user queries rely on
+const SQLiteDriver = "sqlite3_users"
+
+func init() {
+	sql.Register(SQLiteDriver, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			if err := conn.RegisterFunc("fold", fold, true); err != nil {
+				return err
+			}
+
+			return conn.RegisterCollation("pt_br", comparePtBr)
+		},
+	})
+}
+
+// SQLiteDSN returns the data source name of the SQLite database at path.
+// Transactions take the write lock as soon as they begin, which SQLite needs
+// for them to read and then write without failing, and writers wait for
+// each other instead of failing right away
+func SQLiteDSN(path string) string {
+	params := url.Values{}
+
+	params.Set("_txlock", "immediate")
+	params.Set("_busy_timeout", "5000")
+	params.Set("_journal_mode", "WAL")
+	params.Set("_foreign_keys", "on")
+
+	return fmt.Sprintf("file:%s?%s", path, params.Encode())
+}
+
+// ptBrCollators keeps collators for comparePtBr, which SQLite may call from
+// several connections at once
+var ptBrCollators = sync.Pool{
+	New: func() interface{} { return collate.New(language.BrazilianPortuguese) },
+}
+
+// comparePtBr orders text as the pt_br ICU collation does in Postgres.
+// Texts that only differ in ways the collation ignores are told apart by
+// their bytes, as Postgres does with deterministic collations
+func comparePtBr(a, b string) int {
+	c := ptBrCollators.Get().(*collate.Collator)
+	defer ptBrCollators.Put(c)
+
+	if r := c.CompareString(a, b); r != 0 {
+		return r
+	}
+
+	return strings.Compare(a, b)
+}
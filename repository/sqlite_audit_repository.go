@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+
+	"github.com/jmoiron/sqlx"
+	model "github.com/klasrak/users-api/models"
+	"github.com/klasrak/users-api/rerrors"
+)
+
+// SQLiteAuditRepository is a SQLite implementation of service layer
+// AuditRepository interface. db must be opened with SQLiteDriver
+type SQLiteAuditRepository struct {
+	DB *sqlx.DB
+}
+
+// Append adds an entry to the end of the audit log, chaining it to the last
+// one. It must run within a transaction (see Transactor), so the entry is
+// only kept along with the change it records
+func (r *SQLiteAuditRepository) Append(ctx context.Context, e *model.AuditEntry) error {
+	return r.AppendAll(ctx, []*model.AuditEntry{e})
+}
+
+// AppendAll adds several entries to the end of the audit log, in order, as
+// Append would one at a time. The transaction holds the write lock of the
+// database, so no one else can chain onto the same entry in the meantime
+func (r *SQLiteAuditRepository) AppendAll(ctx context.Context, entries []*model.AuditEntry) error {
+	if !inTx(ctx) {
+		log.Println("unable to append audit entry: not within a transaction")
+		return rerrors.NewInternal()
+	}
+
+	db := conn(ctx, r.DB)
+
+	var prev string
+
+	err := db.GetContext(ctx, &prev, "SELECT a.hash FROM audit_log a ORDER BY a.id DESC LIMIT 1;")
+
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		prev = model.AuditGenesisHash
+	case err != nil:
+		log.Printf("unable to read last audit entry: %v\n", err)
+		return rerrors.NewInternal()
+	}
+
+	query := `
+	INSERT INTO audit_log (user_id, actor, request_id, action, changes, created_at, prev_hash, hash)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	RETURNING id;
+	`
+
+	for _, e := range entries {
+		e.PrevHash = prev
+		e.Hash = e.ComputeHash()
+
+		if err := db.GetContext(ctx, &e.ID, query, e.UserID, e.Actor, e.RequestID, e.Action, e.Changes, e.CreatedAt.UTC(), e.PrevHash, e.Hash); err != nil {
+			log.Printf("unable to append audit entry: %v\n", err)
+			return rerrors.NewInternal()
+		}
+
+		prev = e.Hash
+	}
+
+	return nil
+}
+
+// List returns the audit entries matching params, oldest first
+func (r *SQLiteAuditRepository) List(ctx context.Context, params model.AuditListParams) ([]model.AuditEntry, error) {
+	return listAuditEntries(ctx, r.DB, sqliteDialect, params)
+}
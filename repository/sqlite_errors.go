@@ -0,0 +1,56 @@
+//go:build cgo
+
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	model "github.com/klasrak/users-api/models"
+	"github.com/mattn/go-sqlite3"
+)
+
+// sqliteTaken tells which field of u made err a unique violation, in the
+// words Postgres uses, or "" when err is something else
+func sqliteTaken(err error, u *model.User) string {
+	var sqliteErr sqlite3.Error
+
+	if !errors.As(err, &sqliteErr) || sqliteErr.ExtendedCode != sqlite3.ErrConstraintUnique {
+		return ""
+	}
+
+	column := sqliteUniqueColumn(sqliteErr.Error())
+	value := u.Email
+
+	switch column {
+	case "cpf":
+		value = u.Cpf
+	case "id":
+		value = u.UID.String()
+	}
+
+	return fmt.Sprintf("Key (%s)=(%s) already exists.", column, value)
+}
+
+// isSQLiteUnique reports whether err is a unique constraint failure
+func isSQLiteUnique(err error) bool {
+	var sqliteErr sqlite3.Error
+
+	return errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique
+}
+
+// sqliteUniqueColumn returns the first column named by the message of a
+// unique constraint failure, e.g. "UNIQUE constraint failed: users.email"
+// or, for indexes on expressions, "UNIQUE constraint failed: index
+// 'users_email_key'"
+func sqliteUniqueColumn(msg string) string {
+	columns := msg[strings.LastIndex(msg, ": ")+1:]
+	column := strings.TrimSpace(strings.Split(columns, ",")[0])
+
+	if strings.HasPrefix(column, "index '") {
+		return strings.TrimSuffix(strings.TrimPrefix(column, "index 'users_"), "_key'")
+	}
+
+	return strings.TrimPrefix(column, "users.")
+}
@@ -0,0 +1,17 @@
+//go:build !cgo
+
+package repository
+
+import model "github.com/klasrak/users-api/models"
+
+// sqliteTaken tells which field of u made err a unique violation. SQLite
+// databases can't be opened without cgo, so err never comes from one
+func sqliteTaken(err error, u *model.User) string {
+	return ""
+}
+
+// isSQLiteUnique reports whether err is a unique constraint failure, which
+// it never is without cgo
+func isSQLiteUnique(err error) bool {
+	return false
+}
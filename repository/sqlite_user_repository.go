@@ -0,0 +1,316 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	model "github.com/klasrak/users-api/models"
+	"github.com/klasrak/users-api/rerrors"
+)
+
+// SQLiteUserRepository is a SQLite implementation of service layer
+// UserRepository interface. db must be opened with SQLiteDriver
+type SQLiteUserRepository struct {
+	DB *sqlx.DB
+}
+
+// GetAll returns a page of users, as UserRepository.GetAll does
+func (r *SQLiteUserRepository) GetAll(ctx context.Context, params model.UserListParams) (*model.UserPage, error) {
+	return listUsers(ctx, r.DB, sqliteDialect, params)
+}
+
+// Stream calls fn with every user a listing with params would return, in
+// the same order, as UserRepository.Stream does
+func (r *SQLiteUserRepository) Stream(ctx context.Context, params model.UserListParams, fn func(u *model.User) error) error {
+	return streamUsers(ctx, r.DB, sqliteDialect, params, fn)
+}
+
+// Search finds active users whose name or e-mail has words starting with
+// every word of q, ignoring case and accents. SQLite has no stemming, so
+// unlike the Postgres search words are only matched as prefixes. Results are
+// ranked and highlighted as MemoryUserRepository.Search does, ranking them in
+// SQL first so only the best ones are read
+func (r *SQLiteUserRepository) Search(ctx context.Context, q string, limit int) ([]model.UserSearchResult, error) {
+	results := []model.UserSearchResult{}
+
+	words := searchWords(q)
+
+	if len(words) == 0 {
+		return results, rerrors.NewBadRequest("search must contain at least one letter or digit")
+	}
+
+	query, args := wordSearchQuery(words, limit, "fold(u.name)", "fold(u.email)", func(text string) string {
+		return "(' ' || " + text + ")"
+	}, `%s LIKE %s ESCAPE '\'`)
+
+	users, err := selectUsers(ctx, conn(ctx, r.DB), sqlitePlaceholders(query), args...)
+
+	if err != nil {
+		return results, err
+	}
+
+	for _, u := range users {
+		if result, ok := memSearch(u, words); ok {
+			results = append(results, result)
+		}
+	}
+
+	return rankSearchResults(results, limit), nil
+}
+
+// GetByID fetches user by ID or return error. Deleted users are reported as
+// not found unless includeDeleted is set
+func (r *SQLiteUserRepository) GetByID(ctx context.Context, id uuid.UUID, includeDeleted bool) (*model.User, error) {
+	user := &model.User{}
+
+	query := "SELECT " + userColumns + " FROM users u WHERE u.id = ? AND u.deleted_at IS NULL;"
+
+	if includeDeleted {
+		query = "SELECT " + userColumns + " FROM users u WHERE u.id = ?;"
+	}
+
+	if err := conn(ctx, r.DB).GetContext(ctx, user, query, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return user, rerrors.NewNotFound("id", id.String())
+		}
+
+		log.Printf("unable to get user: %v\n", err)
+		return user, rerrors.NewInternal()
+	}
+
+	return user, nil
+}
+
+// Lock fetches a user, deleted or not. SQLite transactions hold the write
+// lock of the whole database from the start (see SQLiteDSN), so no one else
+// can change the user until the transaction ends
+func (r *SQLiteUserRepository) Lock(ctx context.Context, id uuid.UUID) (*model.User, error) {
+	user := &model.User{}
+
+	query := "SELECT " + userColumns + " FROM users u WHERE u.id = ?;"
+
+	if err := conn(ctx, r.DB).GetContext(ctx, user, query, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, rerrors.NewNotFound("user", id.String())
+		}
+
+		log.Printf("unable to lock user: %v\n", err)
+		return nil, rerrors.NewInternal()
+	}
+
+	return user, nil
+}
+
+// Create a user
+func (r *SQLiteUserRepository) Create(ctx context.Context, u *model.User) (*model.User, error) {
+	u.UID = uuid.New()
+
+	query := "INSERT INTO users (id, name, email, cpf, birthdate) VALUES (?, ?, ?, ?, ?) RETURNING id, name, email, cpf, birthdate, deleted_at, version;"
+
+	if err := conn(ctx, r.DB).GetContext(ctx, u, query, u.UID, u.Name, u.Email, u.Cpf, sqliteDate(u.BirthDate)); err != nil {
+		if detail := sqliteTaken(err, u); detail != "" {
+			log.Printf("could not create user. Reason: %v\n", err)
+			return nil, rerrors.NewConflict("user", "created", detail)
+		}
+
+		log.Printf("failed to create user. Reason: %v\n", err)
+		return nil, rerrors.NewInternal()
+	}
+
+	return u, nil
+}
+
+// sqliteDate formats a date the way SQLite stores them
+func sqliteDate(d time.Time) string {
+	return d.Format("2006-01-02")
+}
+
+// FindTaken returns the active users holding any of the given e-mails or cpfs
+func (r *SQLiteUserRepository) FindTaken(ctx context.Context, emails, cpfs []string) ([]model.User, error) {
+	if len(emails) == 0 && len(cpfs) == 0 {
+		return []model.User{}, nil
+	}
+
+	var args queryArgs
+
+	var alternatives []string
+
+	if len(emails) > 0 {
+		alternatives = append(alternatives, "u.email IN ("+inList(emails, &args)+")")
+	}
+
+	if len(cpfs) > 0 {
+		alternatives = append(alternatives, "u.cpf IN ("+inList(cpfs, &args)+")")
+	}
+
+	query := "SELECT " + userColumns + " FROM users u WHERE u.deleted_at IS NULL AND (" + strings.Join(alternatives, " OR ") + ");"
+
+	return selectUsers(ctx, conn(ctx, r.DB), sqlitePlaceholders(query), args...)
+}
+
+// inList adds values to args and returns their placeholders, separated by commas
+func inList(values []string, args *queryArgs) string {
+	placeholders := make([]string, len(values))
+
+	for i, v := range values {
+		placeholders[i] = args.add(v)
+	}
+
+	return strings.Join(placeholders, ", ")
+}
+
+// CopyIn stores many new users at once, reusing a single prepared insert.
+// Users must come with their ids, and are stored at version 1. It must run
+// within a transaction (see Transactor); when any user is taken it fails
+// with a conflict, and the transaction must not be kept
+func (r *SQLiteUserRepository) CopyIn(ctx context.Context, users []*model.User) error {
+	tx, ok := txFrom(ctx)
+
+	if !ok {
+		log.Println("unable to copy users: not within a transaction")
+		return rerrors.NewInternal()
+	}
+
+	stmt, err := tx.PrepareContext(ctx, "INSERT INTO users (id, name, email, cpf, birthdate) VALUES (?, ?, ?, ?, ?);")
+
+	if err != nil {
+		log.Printf("unable to start copying users: %v\n", err)
+		return rerrors.NewInternal()
+	}
+
+	defer stmt.Close()
+
+	for _, u := range users {
+		if _, err := stmt.ExecContext(ctx, u.UID, u.Name, u.Email, u.Cpf, sqliteDate(u.BirthDate)); err != nil {
+			if detail := sqliteTaken(err, u); detail != "" {
+				log.Printf("could not copy users. Reason: %v\n", err)
+				return rerrors.NewConflict("users", "imported", detail)
+			}
+
+			log.Printf("unable to copy users: %v\n", err)
+			return rerrors.NewInternal()
+		}
+	}
+
+	return nil
+}
+
+// Update replaces every field of a user, as UserRepository.Update does
+func (r *SQLiteUserRepository) Update(ctx context.Context, u *model.User) (*model.User, error) {
+	query := `
+	UPDATE users SET name = ?, email = ?, cpf = ?, birthdate = ?, version = version + 1
+	WHERE id = ? AND deleted_at IS NULL AND version = ?
+	RETURNING id, name, email, cpf, birthdate, deleted_at, version;`
+
+	updated := &model.User{}
+
+	if err := conn(ctx, r.DB).GetContext(ctx, updated, query, u.Name, u.Email, u.Cpf, sqliteDate(u.BirthDate), u.UID, u.Version); err != nil {
+		if detail := sqliteTaken(err, u); detail != "" {
+			log.Printf("could not update user. Reason: %v\n", err)
+			return nil, rerrors.NewConflict("user", "updated", detail)
+		}
+
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, r.versionMismatch(ctx, u.UID, u.Version)
+		}
+
+		log.Printf("unable to update user: %v\n", err)
+		return nil, rerrors.NewInternal()
+	}
+
+	return updated, nil
+}
+
+// versionMismatch explains why a versioned update matched no rows: either
+// the user does not exist (or is deleted) or it has moved past version
+func (r *SQLiteUserRepository) versionMismatch(ctx context.Context, id uuid.UUID, version int) error {
+	var current int
+
+	query := "SELECT u.version FROM users u WHERE u.id = ? AND u.deleted_at IS NULL;"
+
+	if err := conn(ctx, r.DB).GetContext(ctx, &current, query, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return rerrors.NewNotFound("user", id.String())
+		}
+
+		log.Printf("unable to read user version: %v\n", err)
+		return rerrors.NewInternal()
+	}
+
+	return rerrors.NewPreconditionFailed(fmt.Sprintf("user is at version %d, not %d", current, version))
+}
+
+// Delete marks a user as deleted. The row is kept so the user can be restored
+func (r *SQLiteUserRepository) Delete(ctx context.Context, id string) error {
+	query := "UPDATE users SET deleted_at = ?, version = version + 1 WHERE id = ? AND deleted_at IS NULL;"
+
+	res, err := conn(ctx, r.DB).ExecContext(ctx, query, time.Now().UTC(), id)
+
+	if err != nil {
+		log.Printf("failed to delete user. Reason: %v\n", err)
+		return rerrors.NewInternal()
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return rerrors.NewNotFound("user", id)
+	}
+
+	return nil
+}
+
+// Restore undoes the deletion of a user. Restoring fails with a conflict when
+// another active user took the e-mail or cpf in the meantime
+func (r *SQLiteUserRepository) Restore(ctx context.Context, id string) (*model.User, error) {
+	user := &model.User{}
+
+	query := `
+	UPDATE users SET deleted_at = NULL, version = version + 1
+	WHERE id = ? AND deleted_at IS NOT NULL
+	RETURNING id, name, email, cpf, birthdate, deleted_at, version;`
+
+	if err := conn(ctx, r.DB).GetContext(ctx, user, query, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, rerrors.NewNotFound("deleted user", id)
+		}
+
+		// the values that clash aren't known before reading the user
+		if isSQLiteUnique(err) {
+			deleted, _ := r.Lock(ctx, uuid.MustParse(id))
+
+			if deleted != nil {
+				log.Printf("could not restore user. Reason: %v\n", err)
+				return nil, rerrors.NewConflict("user", "restored", sqliteTaken(err, deleted))
+			}
+		}
+
+		log.Printf("failed to restore user. Reason: %v\n", err)
+		return nil, rerrors.NewInternal()
+	}
+
+	return user, nil
+}
+
+// Purge removes a user for good, whether it was deleted before or not
+func (r *SQLiteUserRepository) Purge(ctx context.Context, id string) error {
+	query := "DELETE FROM users WHERE id = ?;"
+
+	res, err := conn(ctx, r.DB).ExecContext(ctx, query, id)
+
+	if err != nil {
+		log.Printf("failed to purge user. Reason: %v\n", err)
+		return rerrors.NewInternal()
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return rerrors.NewNotFound("user", id)
+	}
+
+	return nil
+}
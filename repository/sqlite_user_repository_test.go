@@ -0,0 +1,389 @@
+//go:build cgo
+
+package repository
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	model "github.com/klasrak/users-api/models"
+	"github.com/klasrak/users-api/rerrors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newSQLiteRepository creates repositories over a new SQLite database, in a
+// temporary file, with every migration applied
+func newSQLiteRepository(t *testing.T) (*Repository, *sqlx.DB) {
+	db, err := sqlx.Open(SQLiteDriver, SQLiteDSN(filepath.Join(t.TempDir(), "users.db")))
+	require.NoError(t, err)
+
+	t.Cleanup(func() { db.Close() })
+
+	migrations, err := filepath.Glob("../migrations/sqlite/*.up.sql")
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+
+	sort.Strings(migrations)
+
+	for _, m := range migrations {
+		script, err := os.ReadFile(m)
+		require.NoError(t, err)
+
+		_, err = db.Exec(string(script))
+		require.NoError(t, err, m)
+	}
+
+	r, err := CreateRepository(&Options{DB: db, Driver: DriverSQLite})
+	require.NoError(t, err)
+
+	return r, db
+}
+
+// seedSQLiteUsers creates a user for each name, with made up e-mails and cpfs
+func seedSQLiteUsers(t *testing.T, r *Repository, names ...string) []*model.User {
+	users := make([]*model.User, len(names))
+
+	for i, name := range names {
+		u, err := r.UserRepository.Create(context.Background(), newMemUser(name, uuid.NewString()+"@mail.com", uuid.NewString()))
+
+		require.NoError(t, err)
+
+		users[i] = u
+	}
+
+	return users
+}
+
+func TestSQLiteUserRepository(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Create and get", func(t *testing.T) {
+		repo, _ := newSQLiteRepository(t)
+		r := repo.UserRepository
+
+		created, err := r.Create(ctx, newMemUser("João", "joao@mail.com", "313.716.772-80"))
+
+		assert.NoError(t, err)
+		assert.NotEqual(t, uuid.Nil, created.UID)
+		assert.Equal(t, 1, created.Version)
+
+		u, err := r.GetByID(ctx, created.UID, false)
+
+		assert.NoError(t, err)
+		assert.Equal(t, created.UID, u.UID)
+		assert.Equal(t, "João", u.Name)
+		assert.True(t, created.BirthDate.Equal(u.BirthDate))
+
+		id := uuid.New()
+
+		_, err = r.GetByID(ctx, id, false)
+		assert.Equal(t, rerrors.NewNotFound("id", id.String()), err)
+	})
+
+	t.Run("Active users must be unique", func(t *testing.T) {
+		repo, _ := newSQLiteRepository(t)
+		r := repo.UserRepository
+
+		joao, err := r.Create(ctx, newMemUser("João", "joao@mail.com", "313.716.772-80"))
+		require.NoError(t, err)
+
+		_, err = r.Create(ctx, newMemUser("Outro João", "joao@mail.com", "648.173.761-39"))
+		assert.Equal(t, rerrors.NewConflict("user", "created", "Key (email)=(joao@mail.com) already exists."), err)
+
+		_, err = r.Create(ctx, newMemUser("Outro João", "outro@mail.com", "313.716.772-80"))
+		assert.Equal(t, rerrors.NewConflict("user", "created", "Key (cpf)=(313.716.772-80) already exists."), err)
+
+		// deleted users don't hold their e-mail and cpf
+		assert.NoError(t, r.Delete(ctx, joao.UID.String()))
+
+		_, err = r.Create(ctx, newMemUser("Outro João", "joao@mail.com", "648.173.761-39"))
+		assert.NoError(t, err)
+
+		_, err = r.Restore(ctx, joao.UID.String())
+		assert.Equal(t, rerrors.NewConflict("user", "restored", "Key (email)=(joao@mail.com) already exists."), err)
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		repo, db := newSQLiteRepository(t)
+		r := repo.UserRepository
+
+		users := seedSQLiteUsers(t, repo, "João", "Maria")
+
+		u := *users[0]
+		u.Name = "João Silva"
+
+		updated, err := r.Update(ctx, &u)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "João Silva", updated.Name)
+		assert.Equal(t, 2, updated.Version)
+
+		_, err = r.Update(ctx, &u)
+		assert.Equal(t, rerrors.NewPreconditionFailed("user is at version 2, not 1"), err)
+
+		u.Version = 2
+		u.Email = users[1].Email
+
+		_, err = r.Update(ctx, &u)
+		assert.Equal(t, rerrors.NewConflict("user", "updated", "Key (email)=("+users[1].Email+") already exists."), err)
+
+		u.UID = uuid.New()
+
+		_, err = r.Update(ctx, &u)
+		assert.Equal(t, rerrors.NewNotFound("user", u.UID.String()), err)
+
+		// the version moves on even for changes made outside the repository
+		_, err = db.Exec("UPDATE users SET name = 'Maria Souza' WHERE id = ?;", users[1].UID)
+		require.NoError(t, err)
+
+		maria, err := r.GetByID(ctx, users[1].UID, false)
+
+		assert.NoError(t, err)
+		assert.Equal(t, 2, maria.Version)
+	})
+
+	t.Run("Delete, restore and purge", func(t *testing.T) {
+		repo, _ := newSQLiteRepository(t)
+		r := repo.UserRepository
+
+		u := seedSQLiteUsers(t, repo, "João")[0]
+		id := u.UID.String()
+
+		_, err := r.Restore(ctx, id)
+		assert.Equal(t, rerrors.NewNotFound("deleted user", id), err)
+
+		assert.NoError(t, r.Delete(ctx, id))
+		assert.Equal(t, rerrors.NewNotFound("user", id), r.Delete(ctx, id))
+
+		_, err = r.GetByID(ctx, u.UID, false)
+		assert.Error(t, err)
+
+		deleted, err := r.GetByID(ctx, u.UID, true)
+		assert.NoError(t, err)
+		assert.NotNil(t, deleted.DeletedAt)
+		assert.Equal(t, 2, deleted.Version)
+
+		restored, err := r.Restore(ctx, id)
+		assert.NoError(t, err)
+		assert.Nil(t, restored.DeletedAt)
+		assert.Equal(t, 3, restored.Version)
+
+		assert.NoError(t, r.Purge(ctx, id))
+		assert.Equal(t, rerrors.NewNotFound("user", id), r.Purge(ctx, id))
+	})
+
+	t.Run("GetAll sorts, filters and paginates", func(t *testing.T) {
+		repo, _ := newSQLiteRepository(t)
+		r := repo.UserRepository
+
+		users := seedSQLiteUsers(t, repo, "Zé", "álvaro", "Alvaro", "Bruna", "João", "Joana")
+
+		assert.NoError(t, r.Delete(ctx, users[3].UID.String()))
+
+		page, err := r.GetAll(ctx, model.UserListParams{Sort: model.Sort{{Field: "name"}}, Limit: 2})
+
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"Alvaro", "álvaro"}, names(page.Data))
+		assert.NotEmpty(t, page.NextCursor)
+
+		page, err = r.GetAll(ctx, model.UserListParams{Sort: model.Sort{{Field: "name"}}, Limit: 10, Cursor: page.NextCursor})
+
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"Joana", "João", "Zé"}, names(page.Data))
+		assert.Empty(t, page.NextCursor)
+
+		page, err = r.GetAll(ctx, model.UserListParams{Sort: model.Sort{{Field: "name", Desc: true}}, Page: 2, PerPage: 2, IncludeDeleted: true})
+
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"Joana", "Bruna"}, names(page.Data))
+		assert.Equal(t, 6, *page.Total)
+
+		page, err = r.GetAll(ctx, model.UserListParams{Name: "ALV", Limit: 10})
+
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, []string{"Alvaro", "álvaro"}, names(page.Data))
+
+		page, err = r.GetAll(ctx, model.UserListParams{Filter: `name starts_with "jo" and not name = 'Joana'`, Limit: 10})
+
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"João"}, names(page.Data))
+
+		page, err = r.GetAll(ctx, model.UserListParams{Filter: "birthdate between 1990-01-01 and 1990-12-31 and id in (" + users[0].UID.String() + ")", Limit: 10})
+
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"Zé"}, names(page.Data))
+
+		_, err = r.GetAll(ctx, model.UserListParams{Filter: "age > 18", Limit: 10})
+		assert.EqualError(t, err, `Bad request. Reason: invalid filter at position 1: unknown field "age"`)
+	})
+
+	t.Run("Stream", func(t *testing.T) {
+		repo, _ := newSQLiteRepository(t)
+
+		seedSQLiteUsers(t, repo, "Bruna", "Ana", "Carla")
+
+		var streamed []model.User
+
+		err := repo.UserRepository.Stream(ctx, model.UserListParams{Sort: model.Sort{{Field: "name"}}}, func(u *model.User) error {
+			streamed = append(streamed, *u)
+
+			if len(streamed) == 2 {
+				return errors.New("enough")
+			}
+
+			return nil
+		})
+
+		assert.EqualError(t, err, "enough")
+		assert.Equal(t, []string{"Ana", "Bruna"}, names(streamed))
+	})
+
+	t.Run("Search", func(t *testing.T) {
+		repo, _ := newSQLiteRepository(t)
+		r := repo.UserRepository
+
+		_, err := r.Create(ctx, newMemUser("João da Silva", "jsilva@acme.com.br", "313.716.772-80"))
+		require.NoError(t, err)
+
+		_, err = r.Create(ctx, newMemUser("Maria Souza", "maria.silvana@mail.com", "648.173.761-39"))
+		require.NoError(t, err)
+
+		results, err := r.Search(ctx, "joao sil", 10)
+
+		assert.NoError(t, err)
+		assert.Len(t, results, 1)
+		assert.Equal(t, "<mark>João</mark> da <mark>Silva</mark>", results[0].NameHighlight)
+
+		results, err = r.Search(ctx, "silv", 1)
+
+		assert.NoError(t, err)
+		assert.Len(t, results, 1)
+		assert.Equal(t, "João da Silva", results[0].Name)
+
+		_, err = r.Create(ctx, newMemUser("Mariana D'Ávila", "mariana@mail.com", "248.438.034-80"))
+		require.NoError(t, err)
+
+		_, err = r.Create(ctx, newMemUser("Ana Lima", "alima@mail.com", "101.862.157-55"))
+		require.NoError(t, err)
+
+		// words only match where words start, after any separator
+		results, err = r.Search(ctx, "avila", 10)
+
+		assert.NoError(t, err)
+		assert.Len(t, results, 1)
+		assert.Equal(t, "Mariana D'<mark>Ávila</mark>", results[0].NameHighlight)
+
+		results, err = r.Search(ctx, "ana", 10)
+
+		assert.NoError(t, err)
+		assert.Len(t, results, 1)
+		assert.Equal(t, "Ana Lima", results[0].Name)
+
+		// the best matches make it into the limit, names before e-mails
+		results, err = r.Search(ctx, "ma", 2)
+
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, []string{"Maria Souza", "Mariana D'Ávila"}, []string{results[0].Name, results[1].Name})
+
+		_, err = r.Search(ctx, "!!", 10)
+		assert.Equal(t, rerrors.NewBadRequest("search must contain at least one letter or digit"), err)
+	})
+
+	t.Run("FindTaken and CopyIn", func(t *testing.T) {
+		repo, _ := newSQLiteRepository(t)
+		r := repo.UserRepository
+
+		joao := seedSQLiteUsers(t, repo, "João")[0]
+
+		taken, err := r.FindTaken(ctx, []string{joao.Email, "nobody@mail.com"}, []string{joao.Cpf})
+
+		assert.NoError(t, err)
+		assert.Len(t, taken, 1)
+		assert.Equal(t, joao.UID, taken[0].UID)
+
+		users := []*model.User{newMemUser("Ana", "ana@mail.com", "313.716.772-80"), newMemUser("Bia", "bia@mail.com", "648.173.761-39")}
+		users[0].UID, users[1].UID = uuid.New(), uuid.New()
+
+		assert.Equal(t, rerrors.NewInternal(), r.CopyIn(ctx, users))
+
+		err = repo.Transactor.WithinTx(ctx, func(ctx context.Context) error {
+			return r.CopyIn(ctx, users)
+		})
+
+		assert.NoError(t, err)
+
+		ana, err := r.GetByID(ctx, users[0].UID, false)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, ana.Version)
+
+		err = repo.Transactor.WithinTx(ctx, func(ctx context.Context) error {
+			return r.CopyIn(ctx, []*model.User{{UID: uuid.New(), Email: "ana@mail.com", Cpf: "1"}})
+		})
+
+		assert.Equal(t, rerrors.NewConflict("users", "imported", "Key (email)=(ana@mail.com) already exists."), err)
+	})
+}
+
+func TestSQLiteAuditRepository(t *testing.T) {
+	ctx := context.Background()
+
+	repo, db := newSQLiteRepository(t)
+	a := repo.AuditRepository
+
+	assert.Equal(t, rerrors.NewInternal(), a.Append(ctx, &model.AuditEntry{}))
+
+	user := uuid.New()
+	before := "João"
+
+	err := repo.Transactor.WithinTx(ctx, func(ctx context.Context) error {
+		return a.AppendAll(ctx, []*model.AuditEntry{
+			{UserID: user, Actor: "ana", Action: model.AuditCreate, CreatedAt: time.Now(), Changes: model.AuditChanges{"name": {Before: &before}}},
+			{UserID: uuid.New(), Actor: "bia", Action: model.AuditCreate, CreatedAt: time.Now()},
+		})
+	})
+
+	require.NoError(t, err)
+
+	err = repo.Transactor.WithinTx(ctx, func(ctx context.Context) error {
+		if err := a.Append(ctx, &model.AuditEntry{UserID: user, Action: model.AuditDelete, CreatedAt: time.Now()}); err != nil {
+			return err
+		}
+
+		return errors.New("rolled back")
+	})
+
+	assert.Error(t, err)
+
+	entries, err := a.List(ctx, model.AuditListParams{Limit: 10})
+
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+	assert.Equal(t, model.AuditGenesisHash, entries[0].PrevHash)
+	assert.NoError(t, model.VerifyAuditChain(entries))
+	assert.Equal(t, "João", *entries[0].Changes["name"].Before)
+
+	entries, err = a.List(ctx, model.AuditListParams{UserID: &user, Since: time.Now().Add(-time.Minute), Limit: 10})
+
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "ana", entries[0].Actor)
+
+	entries, err = a.List(ctx, model.AuditListParams{After: entries[0].ID, Limit: 10})
+
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "bia", entries[0].Actor)
+
+	// the log is append-only
+	_, err = db.Exec("DELETE FROM audit_log;")
+	assert.True(t, err != nil && strings.Contains(err.Error(), "append-only"))
+}
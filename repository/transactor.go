@@ -0,0 +1,190 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+	"github.com/klasrak/users-api/rerrors"
+	"github.com/klasrak/users-api/utils"
+	"github.com/lib/pq"
+)
+
+type txKey struct{}
+
+// maxTxAttempts is how many times a transaction is run before giving up when
+// it keeps losing races with other transactions
+const maxTxAttempts = 3
+
+// txRetryDelay is how long to wait before running a transaction again, times
+// the attempts made so far
+var txRetryDelay = 20 * time.Millisecond
+
+// Transactor runs functions within a database transaction. The transaction
+// travels in the context, so every repository called with that context
+// takes part in it
+type Transactor struct {
+	DB *sqlx.DB
+}
+
+// WithinTx runs fn within a transaction, committing it when fn succeeds and
+// rolling it back otherwise. Nested calls join the outer transaction.
+//
+// When the transaction fails with a serialization failure or a deadlock it
+// is rolled back and fn runs again in a new one, up to maxTxAttempts times,
+// so fn must not keep state from a previous run
+func (t *Transactor) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return t.within(ctx, nil, fn)
+}
+
+// WithinSnapshot runs fn within a read-only transaction in which every query
+// sees the database as it was when the first one ran, so reads spread over
+// several queries agree with each other. Nested calls join the outer
+// transaction
+func (t *Transactor) WithinSnapshot(ctx context.Context, fn func(ctx context.Context) error) error {
+	return t.within(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true}, fn)
+}
+
+func (t *Transactor) within(ctx context.Context, opts *sql.TxOptions, fn func(ctx context.Context) error) error {
+	if inTx(ctx) {
+		return fn(ctx)
+	}
+
+	for attempt := 1; ; attempt++ {
+		retry, err := t.run(ctx, opts, fn)
+
+		if !retry || attempt == maxTxAttempts {
+			return err
+		}
+
+		log.Printf("transaction lost a race with another one, retrying (attempt %d of %d)\n", attempt+1, maxTxAttempts)
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(time.Duration(attempt) * txRetryDelay):
+		}
+	}
+}
+
+// run runs fn within a single transaction, reporting whether it failed
+// because the transaction lost a race with another one and may succeed if
+// run again. What fn hands to utils.AfterTx runs once the transaction ends
+func (t *Transactor) run(ctx context.Context, opts *sql.TxOptions, fn func(ctx context.Context) error) (bool, error) {
+	ctx, ended := utils.WithTxEnd(ctx)
+	defer ended()
+
+	tx, err := t.DB.BeginTxx(ctx, opts)
+
+	if err != nil {
+		log.Printf("unable to start transaction: %v\n", err)
+		return false, rerrors.NewInternal()
+	}
+
+	defer tx.Rollback()
+
+	c := &txConn{Tx: tx}
+
+	if err := fn(context.WithValue(ctx, txKey{}, c)); err != nil {
+		return c.lost, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("unable to commit transaction: %v\n", err)
+		return isRetryable(err), rerrors.NewInternal()
+	}
+
+	return false, nil
+}
+
+// isRetryable reports whether err tells that a transaction was aborted for
+// conflicting with another one, either by a serialization failure or by a
+// deadlock. Running it again usually succeeds
+func isRetryable(err error) bool {
+	var pqErr *pq.Error
+
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "40001" || pqErr.Code == "40P01"
+	}
+
+	var myErr *mysql.MySQLError
+
+	if errors.As(err, &myErr) {
+		return myErr.Number == mysqlDeadlock
+	}
+
+	return false
+}
+
+// txConn is the transaction carried by a context. Repositories report
+// database failures as internal errors, so it watches the statements run in
+// it to tell whether the transaction lost a race with another one
+type txConn struct {
+	*sqlx.Tx
+	lost bool
+}
+
+// note records whether err tells that the transaction lost a race
+func (c *txConn) note(err error) error {
+	if isRetryable(err) {
+		c.lost = true
+	}
+
+	return err
+}
+
+func (c *txConn) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	res, err := c.Tx.ExecContext(ctx, query, args...)
+	return res, c.note(err)
+}
+
+func (c *txConn) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	rows, err := c.Tx.QueryContext(ctx, query, args...)
+	return rows, c.note(err)
+}
+
+func (c *txConn) QueryxContext(ctx context.Context, query string, args ...interface{}) (*sqlx.Rows, error) {
+	rows, err := c.Tx.QueryxContext(ctx, query, args...)
+	return rows, c.note(err)
+}
+
+func (c *txConn) GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return c.note(c.Tx.GetContext(ctx, dest, query, args...))
+}
+
+func (c *txConn) SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return c.note(c.Tx.SelectContext(ctx, dest, query, args...))
+}
+
+// dbConn is what repositories need from either a database or a transaction
+type dbConn interface {
+	sqlx.ExtContext
+	GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	PrepareNamedContext(ctx context.Context, query string) (*sqlx.NamedStmt, error)
+}
+
+// conn returns the transaction carried by ctx, or db when there is none
+func conn(ctx context.Context, db *sqlx.DB) dbConn {
+	if tx, ok := txFrom(ctx); ok {
+		return tx
+	}
+
+	return db
+}
+
+// txFrom returns the transaction carried by ctx
+func txFrom(ctx context.Context) (*txConn, bool) {
+	tx, ok := ctx.Value(txKey{}).(*txConn)
+	return tx, ok
+}
+
+// inTx reports whether ctx carries a transaction
+func inTx(ctx context.Context) bool {
+	_, ok := txFrom(ctx)
+	return ok
+}
@@ -0,0 +1,291 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+	"github.com/klasrak/users-api/rerrors"
+	"github.com/klasrak/users-api/utils"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransactor(t *testing.T) {
+	t.Run("WithinTx commits", func(t *testing.T) {
+		db, mock := NewMock()
+
+		sqlxDB := sqlx.NewDb(db, "sqlmock")
+
+		defer sqlxDB.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectCommit()
+
+		transactor := &Transactor{DB: sqlxDB}
+
+		err := transactor.WithinTx(context.Background(), func(ctx context.Context) error {
+			assert.True(t, inTx(ctx))
+			return nil
+		})
+
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("WithinTx rolls back on error", func(t *testing.T) {
+		db, mock := NewMock()
+
+		sqlxDB := sqlx.NewDb(db, "sqlmock")
+
+		defer sqlxDB.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectRollback()
+
+		transactor := &Transactor{DB: sqlxDB}
+
+		err := transactor.WithinTx(context.Background(), func(ctx context.Context) error {
+			return rerrors.NewNotFound("user", "1")
+		})
+
+		assert.Equal(t, rerrors.NewNotFound("user", "1"), err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Nested calls join the outer transaction", func(t *testing.T) {
+		db, mock := NewMock()
+
+		sqlxDB := sqlx.NewDb(db, "sqlmock")
+
+		defer sqlxDB.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectCommit()
+
+		transactor := &Transactor{DB: sqlxDB}
+
+		err := transactor.WithinTx(context.Background(), func(ctx context.Context) error {
+			return transactor.WithinSnapshot(ctx, func(inner context.Context) error {
+				assert.Equal(t, conn(ctx, sqlxDB), conn(inner, sqlxDB))
+				return nil
+			})
+		})
+
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Runs what waits for the transaction once it ends", func(t *testing.T) {
+		db, mock := NewMock()
+
+		sqlxDB := sqlx.NewDb(db, "sqlmock")
+
+		defer sqlxDB.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectCommit()
+		mock.ExpectBegin()
+		mock.ExpectRollback()
+
+		transactor := &Transactor{DB: sqlxDB}
+
+		ran := 0
+
+		err := transactor.WithinTx(context.Background(), func(ctx context.Context) error {
+			utils.AfterTx(ctx, func() { ran++ })
+
+			// not before it is committed
+			assert.Equal(t, 0, ran)
+
+			return nil
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, 1, ran)
+
+		// nor only when it is
+		err = transactor.WithinTx(context.Background(), func(ctx context.Context) error {
+			utils.AfterTx(ctx, func() { ran++ })
+			return rerrors.NewInternal()
+		})
+
+		assert.Error(t, err)
+		assert.Equal(t, 2, ran)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Error begin", func(t *testing.T) {
+		db, mock := NewMock()
+
+		sqlxDB := sqlx.NewDb(db, "sqlmock")
+
+		defer sqlxDB.Close()
+
+		mock.ExpectBegin().WillReturnError(errors.New("too many connections"))
+
+		transactor := &Transactor{DB: sqlxDB}
+
+		called := false
+
+		err := transactor.WithinSnapshot(context.Background(), func(ctx context.Context) error {
+			called = true
+			return nil
+		})
+
+		assert.Equal(t, rerrors.NewInternal(), err)
+		assert.False(t, called)
+	})
+
+	t.Run("Retries transactions that lose a race", func(t *testing.T) {
+		db, mock := NewMock()
+
+		sqlxDB := sqlx.NewDb(db, "sqlmock")
+
+		defer sqlxDB.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE users").WillReturnError(&pq.Error{Code: "40001"})
+		mock.ExpectRollback()
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE users").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		transactor := &Transactor{DB: sqlxDB}
+
+		runs := 0
+
+		err := transactor.WithinTx(context.Background(), func(ctx context.Context) error {
+			runs++
+
+			if _, err := conn(ctx, sqlxDB).ExecContext(ctx, "UPDATE users SET name = 'João'"); err != nil {
+				// repositories hide the reason from callers
+				return rerrors.NewInternal()
+			}
+
+			return nil
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, 2, runs)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Retries transactions that fail to commit after a deadlock", func(t *testing.T) {
+		db, mock := NewMock()
+
+		sqlxDB := sqlx.NewDb(db, "sqlmock")
+
+		defer sqlxDB.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectCommit().WillReturnError(&pq.Error{Code: "40P01"})
+		mock.ExpectBegin()
+		mock.ExpectCommit()
+
+		transactor := &Transactor{DB: sqlxDB}
+
+		runs := 0
+
+		err := transactor.WithinTx(context.Background(), func(ctx context.Context) error {
+			runs++
+			return nil
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, 2, runs)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Retries transactions chosen as a MySQL deadlock victim", func(t *testing.T) {
+		db, mock := NewMock()
+
+		sqlxDB := sqlx.NewDb(db, "sqlmock")
+
+		defer sqlxDB.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE users").WillReturnError(&mysql.MySQLError{Number: mysqlDeadlock})
+		mock.ExpectRollback()
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE users").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		transactor := &Transactor{DB: sqlxDB}
+
+		runs := 0
+
+		err := transactor.WithinTx(context.Background(), func(ctx context.Context) error {
+			runs++
+
+			if _, err := conn(ctx, sqlxDB).ExecContext(ctx, "UPDATE users SET name = 'João'"); err != nil {
+				return rerrors.NewInternal()
+			}
+
+			return nil
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, 2, runs)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Gives up after the last attempt", func(t *testing.T) {
+		db, mock := NewMock()
+
+		sqlxDB := sqlx.NewDb(db, "sqlmock")
+
+		defer sqlxDB.Close()
+
+		for i := 0; i < maxTxAttempts; i++ {
+			mock.ExpectBegin()
+			mock.ExpectCommit().WillReturnError(&pq.Error{Code: "40001"})
+		}
+
+		transactor := &Transactor{DB: sqlxDB}
+
+		runs := 0
+
+		err := transactor.WithinTx(context.Background(), func(ctx context.Context) error {
+			runs++
+			return nil
+		})
+
+		assert.Equal(t, rerrors.NewInternal(), err)
+		assert.Equal(t, maxTxAttempts, runs)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Other failures are not retried", func(t *testing.T) {
+		db, mock := NewMock()
+
+		sqlxDB := sqlx.NewDb(db, "sqlmock")
+
+		defer sqlxDB.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE users").WillReturnError(&pq.Error{Code: "23505"})
+		mock.ExpectRollback()
+
+		transactor := &Transactor{DB: sqlxDB}
+
+		runs := 0
+
+		err := transactor.WithinTx(context.Background(), func(ctx context.Context) error {
+			runs++
+
+			if _, err := conn(ctx, sqlxDB).ExecContext(ctx, "UPDATE users SET name = 'João'"); err != nil {
+				return rerrors.NewInternal()
+			}
+
+			return nil
+		})
+
+		assert.Equal(t, rerrors.NewInternal(), err)
+		assert.Equal(t, 1, runs)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
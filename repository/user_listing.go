@@ -0,0 +1,248 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/klasrak/users-api/filter"
+	model "github.com/klasrak/users-api/models"
+	"github.com/klasrak/users-api/rerrors"
+)
+
+// listUsers returns a page of users from db, as UserRepository.GetAll
+// describes, with queries written for the database d
+func listUsers(ctx context.Context, db *sqlx.DB, d *dialect, params model.UserListParams) (*model.UserPage, error) {
+	if params.Paged() {
+		return listUserPage(ctx, db, d, params)
+	}
+
+	page := &model.UserPage{Data: []model.User{}}
+
+	keys, err := userSortKeys(params.Sort, d.sortColumns)
+
+	if err != nil {
+		return page, err
+	}
+
+	var args queryArgs
+
+	conds, err := userListFilter(params, d, &args)
+
+	if err != nil {
+		return page, err
+	}
+
+	if params.Cursor != "" {
+		values, err := readCursor(params.Cursor, params.Sort, keys)
+
+		if err != nil {
+			return page, err
+		}
+
+		conds = append(conds, keysetCondition(keys, values, &args))
+	}
+
+	// fetch one extra row to find out whether there is a next page
+	query, bound := d.rebind(fmt.Sprintf("SELECT %s FROM users u%s%s LIMIT %s;", userColumns, where(conds), orderBy(keys), args.add(params.Limit+1)), args)
+
+	users, err := selectUsers(ctx, conn(ctx, db), query, bound...)
+
+	if err != nil {
+		return page, err
+	}
+
+	page.Data = users
+
+	if len(page.Data) > params.Limit {
+		page.Data = page.Data[:params.Limit]
+		page.NextCursor = encodeCursor(cursor{
+			Sort:   params.Sort.String(),
+			Values: sortValues(keys, page.Data[len(page.Data)-1]),
+		})
+	}
+
+	return page, nil
+}
+
+// listUserPage returns an offset paginated page of users along with the
+// total number of users matching the filter. Both queries run in the same
+// read-only snapshot, so the total always agrees with the page
+func listUserPage(ctx context.Context, db *sqlx.DB, d *dialect, params model.UserListParams) (*model.UserPage, error) {
+	page := &model.UserPage{
+		Data:    []model.User{},
+		Page:    params.Page,
+		PerPage: params.PerPage,
+	}
+
+	keys, err := userSortKeys(params.Sort, d.sortColumns)
+
+	if err != nil {
+		return page, err
+	}
+
+	var args queryArgs
+
+	conds, err := userListFilter(params, d, &args)
+
+	if err != nil {
+		return page, err
+	}
+
+	tx, err := db.BeginTxx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+
+	if err != nil {
+		log.Printf("unable to start user listing transaction: %v\n", err)
+		return page, rerrors.NewInternal()
+	}
+
+	defer tx.Rollback()
+
+	var total int
+
+	count, bound := d.rebind("SELECT COUNT(*) FROM users u"+where(conds)+";", args)
+
+	if err := tx.GetContext(ctx, &total, count, bound...); err != nil {
+		log.Printf("unable to count users: %v\n", err)
+		return page, rerrors.NewInternal()
+	}
+
+	page.Total = &total
+
+	query, bound := d.rebind(fmt.Sprintf(
+		"SELECT %s FROM users u%s%s LIMIT %s OFFSET %s;",
+		userColumns,
+		where(conds),
+		orderBy(keys),
+		args.add(params.PerPage),
+		args.add((params.Page-1)*params.PerPage),
+	), args)
+
+	users, err := selectUsers(ctx, tx, query, bound...)
+
+	if err != nil {
+		return page, err
+	}
+
+	page.Data = users
+
+	return page, nil
+}
+
+// userListFilter builds the conditions shared by every user listing and its
+// count, so that both always describe the same set of rows
+func userListFilter(params model.UserListParams, d *dialect, args *queryArgs) ([]string, error) {
+	var conds []string
+
+	if !params.IncludeDeleted {
+		conds = append(conds, "u.deleted_at IS NULL")
+	}
+
+	if params.Name != "" {
+		conds = append(conds, fmt.Sprintf(d.nameMatch, args.add("%"+escapeLike(params.Name)+"%")))
+	}
+
+	if params.Filter != "" {
+		n, err := filter.Parse(params.Filter)
+
+		if err != nil {
+			return nil, err
+		}
+
+		cond, err := compileFilter(n, d, args)
+
+		if err != nil {
+			return nil, err
+		}
+
+		conds = append(conds, cond)
+	}
+
+	return conds, nil
+}
+
+// selectUsers runs a listing query and scans the resulting users
+func selectUsers(ctx context.Context, q sqlx.QueryerContext, query string, args ...interface{}) ([]model.User, error) {
+	users := []model.User{}
+
+	rows, err := q.QueryContext(ctx, query, args...)
+
+	if err != nil {
+		log.Printf("unable to list users: %v\n", err)
+		return users, rerrors.NewInternal()
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		user := model.User{}
+
+		if err := scanUser(rows, &user); err != nil {
+			return users, rerrors.NewInternal()
+		}
+
+		users = append(users, user)
+	}
+
+	if err := rows.Err(); err != nil {
+		return users, rerrors.NewInternal()
+	}
+
+	return users, nil
+}
+
+// scanUser reads a user selected with userColumns
+func scanUser(rows *sql.Rows, u *model.User) error {
+	return rows.Scan(&u.UID, &u.Name, &u.Email, &u.Cpf, &u.BirthDate, &u.DeletedAt, &u.Version)
+}
+
+// streamUsers calls fn with every user of a listing from db, as
+// UserRepository.Stream describes, with queries written for the database d
+func streamUsers(ctx context.Context, db *sqlx.DB, d *dialect, params model.UserListParams, fn func(u *model.User) error) error {
+	keys, err := userSortKeys(params.Sort, d.sortColumns)
+
+	if err != nil {
+		return err
+	}
+
+	var args queryArgs
+
+	conds, err := userListFilter(params, d, &args)
+
+	if err != nil {
+		return err
+	}
+
+	query, bound := d.rebind(fmt.Sprintf("SELECT %s FROM users u%s%s;", userColumns, where(conds), orderBy(keys)), args)
+
+	rows, err := conn(ctx, db).QueryContext(ctx, query, bound...)
+
+	if err != nil {
+		log.Printf("unable to stream users: %v\n", err)
+		return rerrors.NewInternal()
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		user := model.User{}
+
+		if err := scanUser(rows, &user); err != nil {
+			log.Printf("unable to read streamed user: %v\n", err)
+			return rerrors.NewInternal()
+		}
+
+		if err := fn(&user); err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("unable to stream users: %v\n", err)
+		return rerrors.NewInternal()
+	}
+
+	return nil
+}
@@ -0,0 +1,376 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	model "github.com/klasrak/users-api/models"
+	"github.com/klasrak/users-api/rerrors"
+)
+
+// WebhookRepository is a repository implementation of service layer
+// WebhookRepository interface, for every database users can be stored in
+type WebhookRepository struct {
+	DB *sqlx.DB
+
+	// dialect of DB, Postgres when nil
+	dialect *dialect
+}
+
+// webhookColumns lists the columns of a webhook
+const webhookColumns = "w.id, w.url, w.events, w.secret, w.active, w.disabled_reason, w.failures, w.created_at, w.updated_at"
+
+// List returns every webhook, oldest first
+func (r *WebhookRepository) List(ctx context.Context) ([]model.Webhook, error) {
+	webhooks := []model.Webhook{}
+
+	query := "SELECT " + webhookColumns + " FROM webhooks w ORDER BY w.created_at, w.id;"
+
+	if err := conn(ctx, r.DB).SelectContext(ctx, &webhooks, query); err != nil {
+		log.Printf("unable to list webhooks: %v\n", err)
+		return nil, rerrors.NewInternal()
+	}
+
+	return webhooks, nil
+}
+
+// GetByID fetches a webhook by id or returns an error
+func (r *WebhookRepository) GetByID(ctx context.Context, id uuid.UUID) (*model.Webhook, error) {
+	w := &model.Webhook{}
+
+	query, args := r.d().rebind("SELECT "+webhookColumns+" FROM webhooks w WHERE w.id = $1;", []interface{}{id})
+
+	if err := conn(ctx, r.DB).GetContext(ctx, w, query, args...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, rerrors.NewNotFound("webhook", id.String())
+		}
+
+		log.Printf("unable to get webhook: %v\n", err)
+		return nil, rerrors.NewInternal()
+	}
+
+	return w, nil
+}
+
+// Create a webhook
+func (r *WebhookRepository) Create(ctx context.Context, w *model.Webhook) error {
+	d := r.d()
+
+	query, args := d.rebind(`
+	INSERT INTO webhooks (id, url, events, secret, active, disabled_reason, failures, created_at, updated_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9);
+	`, []interface{}{w.ID, w.URL, w.Events, w.Secret, w.Active, w.DisabledReason, w.Failures, d.timestamp(w.CreatedAt), d.timestamp(w.UpdatedAt)})
+
+	if _, err := conn(ctx, r.DB).ExecContext(ctx, query, args...); err != nil {
+		log.Printf("unable to create webhook: %v\n", err)
+		return rerrors.NewInternal()
+	}
+
+	return nil
+}
+
+// Update replaces the settings of a webhook
+func (r *WebhookRepository) Update(ctx context.Context, w *model.Webhook) error {
+	d := r.d()
+
+	query, args := d.rebind(`
+	UPDATE webhooks SET url = $2, events = $3, active = $4, disabled_reason = $5, failures = $6, updated_at = $7
+	WHERE id = $1;
+	`, []interface{}{w.ID, w.URL, w.Events, w.Active, w.DisabledReason, w.Failures, d.timestamp(w.UpdatedAt)})
+
+	res, err := conn(ctx, r.DB).ExecContext(ctx, query, args...)
+
+	if err != nil {
+		log.Printf("unable to update webhook: %v\n", err)
+		return rerrors.NewInternal()
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return rerrors.NewNotFound("webhook", w.ID.String())
+	}
+
+	return nil
+}
+
+// Delete removes a webhook along with its deliveries. It must run within a
+// transaction (see Transactor)
+func (r *WebhookRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	if !inTx(ctx) {
+		log.Println("unable to delete webhook: not within a transaction")
+		return rerrors.NewInternal()
+	}
+
+	d := r.d()
+	db := conn(ctx, r.DB)
+
+	query, args := d.rebind("DELETE FROM webhook_deliveries WHERE webhook_id = $1;", []interface{}{id})
+
+	if _, err := db.ExecContext(ctx, query, args...); err != nil {
+		log.Printf("unable to delete webhook deliveries: %v\n", err)
+		return rerrors.NewInternal()
+	}
+
+	query, args = d.rebind("DELETE FROM webhooks WHERE id = $1;", []interface{}{id})
+
+	res, err := db.ExecContext(ctx, query, args...)
+
+	if err != nil {
+		log.Printf("unable to delete webhook: %v\n", err)
+		return rerrors.NewInternal()
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return rerrors.NewNotFound("webhook", id.String())
+	}
+
+	return nil
+}
+
+// Succeeded records a successful delivery to a webhook, clearing its
+// failures
+func (r *WebhookRepository) Succeeded(ctx context.Context, id uuid.UUID) error {
+	query, args := r.d().rebind("UPDATE webhooks SET failures = 0 WHERE id = $1 AND failures > 0;", []interface{}{id})
+
+	_, err := conn(ctx, r.DB).ExecContext(ctx, query, args...)
+
+	return err
+}
+
+// Failed records a failed attempt to deliver to a webhook, disabling it for
+// reason once maxFailures attempts failed in a row. It reports whether this
+// attempt disabled the webhook
+func (r *WebhookRepository) Failed(ctx context.Context, id uuid.UUID, maxFailures int, reason string) (bool, error) {
+	d := r.d()
+	db := conn(ctx, r.DB)
+
+	query, args := d.rebind("UPDATE webhooks SET failures = failures + 1 WHERE id = $1;", []interface{}{id})
+
+	if _, err := db.ExecContext(ctx, query, args...); err != nil {
+		return false, err
+	}
+
+	query, args = d.rebind(`
+	UPDATE webhooks SET active = $3, disabled_reason = $4
+	WHERE id = $1 AND active AND failures >= $2;
+	`, []interface{}{id, maxFailures, false, reason})
+
+	res, err := db.ExecContext(ctx, query, args...)
+
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+
+	if err != nil {
+		return false, err
+	}
+
+	return n == 1, nil
+}
+
+func (r *WebhookRepository) d() *dialect {
+	if r.dialect == nil {
+		return postgresDialect
+	}
+
+	return r.dialect
+}
+
+// WebhookDeliveryRepository is a repository implementation of service layer
+// WebhookDeliveryRepository interface, for every database users can be
+// stored in
+type WebhookDeliveryRepository struct {
+	DB *sqlx.DB
+
+	// dialect of DB, Postgres when nil
+	dialect *dialect
+}
+
+// deliveryColumns lists the columns of a delivery
+const deliveryColumns = `d.id, d.webhook_id, d.event_id, d.event_type, d.redelivery_of, d.payload, d.status,
+	d.attempts, d.response_code, d.last_error, d.next_attempt_at, d.claimed_until, d.created_at, d.delivered_at`
+
+// Enqueue adds deliveries to be attempted. Deliveries of an event to a
+// webhook it was already delivered to are skipped, unless they are
+// redeliveries. It must run within a transaction (see Transactor)
+func (r *WebhookDeliveryRepository) Enqueue(ctx context.Context, deliveries []*model.WebhookDelivery) error {
+	if !inTx(ctx) {
+		log.Println("unable to enqueue webhook delivery: not within a transaction")
+		return rerrors.NewInternal()
+	}
+
+	d := r.d()
+	db := conn(ctx, r.DB)
+
+	// the first delivery of an event to a webhook is unique, see the
+	// webhook_deliveries_first_idx index
+	insert := `
+	INSERT INTO webhook_deliveries (id, webhook_id, event_id, event_type, redelivery_of, payload, status,
+		attempts, response_code, last_error, next_attempt_at, claimed_until, created_at, delivered_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+	` + d.skipDuplicates("(webhook_id, event_id) WHERE redelivery_of IS NULL") + ";"
+
+	for _, delivery := range deliveries {
+		q, args := d.rebind(insert, []interface{}{
+			delivery.ID, delivery.WebhookID, delivery.EventID, delivery.EventType, delivery.RedeliveryOf, delivery.Payload, delivery.Status,
+			delivery.Attempts, delivery.ResponseCode, delivery.LastError, d.timestamp(delivery.NextAttemptAt), nullTimestamp(d, delivery.ClaimedUntil),
+			d.timestamp(delivery.CreatedAt), nullTimestamp(d, delivery.DeliveredAt),
+		})
+
+		if _, err := db.ExecContext(ctx, q, args...); err != nil {
+			log.Printf("unable to enqueue webhook delivery: %v\n", err)
+			return rerrors.NewInternal()
+		}
+	}
+
+	return nil
+}
+
+// List returns the deliveries of a webhook, newest first
+func (r *WebhookDeliveryRepository) List(ctx context.Context, params model.WebhookDeliveryListParams) ([]model.WebhookDelivery, error) {
+	d := r.d()
+
+	var args queryArgs
+
+	conds := []string{"d.webhook_id = " + args.add(params.WebhookID)}
+
+	if params.Status != "" {
+		conds = append(conds, "d.status = "+args.add(params.Status))
+	}
+
+	if !params.Before.IsZero() {
+		conds = append(conds, "d.created_at < "+args.add(d.timestamp(params.Before)))
+	}
+
+	query := "SELECT " + deliveryColumns + " FROM webhook_deliveries d" + where(conds) +
+		" ORDER BY d.created_at DESC, d.id DESC LIMIT " + args.add(params.Limit) + ";"
+
+	q, bound := d.rebind(query, args)
+
+	deliveries := []model.WebhookDelivery{}
+
+	if err := conn(ctx, r.DB).SelectContext(ctx, &deliveries, q, bound...); err != nil {
+		log.Printf("unable to list webhook deliveries: %v\n", err)
+		return nil, rerrors.NewInternal()
+	}
+
+	return deliveries, nil
+}
+
+// GetByID fetches a delivery of a webhook by id or returns an error
+func (r *WebhookDeliveryRepository) GetByID(ctx context.Context, webhookID, id uuid.UUID) (*model.WebhookDelivery, error) {
+	delivery := &model.WebhookDelivery{}
+
+	query, args := r.d().rebind(
+		"SELECT "+deliveryColumns+" FROM webhook_deliveries d WHERE d.id = $1 AND d.webhook_id = $2;",
+		[]interface{}{id, webhookID},
+	)
+
+	if err := conn(ctx, r.DB).GetContext(ctx, delivery, query, args...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, rerrors.NewNotFound("delivery", id.String())
+		}
+
+		log.Printf("unable to get webhook delivery: %v\n", err)
+		return nil, rerrors.NewInternal()
+	}
+
+	return delivery, nil
+}
+
+// Due returns up to limit pending deliveries to active webhooks that are
+// due at now and claimed by no one, oldest first
+func (r *WebhookDeliveryRepository) Due(ctx context.Context, now time.Time, limit int) ([]*model.WebhookDelivery, error) {
+	d := r.d()
+
+	query, args := d.rebind(`
+	SELECT `+deliveryColumns+`
+	FROM webhook_deliveries d
+	JOIN webhooks w ON w.id = d.webhook_id
+	WHERE w.active AND d.status = 'pending' AND d.next_attempt_at <= $1
+	AND (d.claimed_until IS NULL OR d.claimed_until < $1)
+	ORDER BY d.next_attempt_at, d.id
+	LIMIT $2;
+	`, []interface{}{d.timestamp(now), limit})
+
+	deliveries := []*model.WebhookDelivery{}
+
+	if err := conn(ctx, r.DB).SelectContext(ctx, &deliveries, query, args...); err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// Claim holds a pending delivery until the given time, unless someone else
+// holds it at now. It reports whether the delivery was claimed
+func (r *WebhookDeliveryRepository) Claim(ctx context.Context, delivery *model.WebhookDelivery, now, until time.Time) (bool, error) {
+	d := r.d()
+
+	query, args := d.rebind(`
+	UPDATE webhook_deliveries SET claimed_until = $2
+	WHERE id = $1 AND status = 'pending' AND (claimed_until IS NULL OR claimed_until < $3);
+	`, []interface{}{delivery.ID, d.timestamp(until), d.timestamp(now)})
+
+	res, err := conn(ctx, r.DB).ExecContext(ctx, query, args...)
+
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+
+	if err != nil {
+		return false, err
+	}
+
+	if n != 1 {
+		return false, nil
+	}
+
+	delivery.ClaimedUntil = &until
+
+	return true, nil
+}
+
+// Save records the outcome of an attempt to deliver
+func (r *WebhookDeliveryRepository) Save(ctx context.Context, delivery *model.WebhookDelivery) error {
+	d := r.d()
+
+	query, args := d.rebind(`
+	UPDATE webhook_deliveries SET status = $2, attempts = $3, response_code = $4, last_error = $5,
+		next_attempt_at = $6, claimed_until = $7, delivered_at = $8
+	WHERE id = $1;
+	`, []interface{}{
+		delivery.ID, delivery.Status, delivery.Attempts, delivery.ResponseCode, delivery.LastError,
+		d.timestamp(delivery.NextAttemptAt), nullTimestamp(d, delivery.ClaimedUntil), nullTimestamp(d, delivery.DeliveredAt),
+	})
+
+	_, err := conn(ctx, r.DB).ExecContext(ctx, query, args...)
+
+	return err
+}
+
+func (r *WebhookDeliveryRepository) d() *dialect {
+	if r.dialect == nil {
+		return postgresDialect
+	}
+
+	return r.dialect
+}
+
+// nullTimestamp converts an optional point in time as d.timestamp does,
+// passing NULL when it is nil
+func nullTimestamp(d *dialect, t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+
+	return d.timestamp(*t)
+}
@@ -0,0 +1,17 @@
+//go:build cgo
+
+package repository
+
+import (
+	"testing"
+
+	"github.com/klasrak/users-api/service"
+)
+
+func TestSQLiteWebhookRepository(t *testing.T) {
+	testWebhookRepository(t, func(t *testing.T) (service.WebhookRepository, service.WebhookDeliveryRepository, service.Transactor) {
+		r, _ := newSQLiteRepository(t)
+
+		return r.WebhookRepository, r.WebhookDeliveryRepository, r.Transactor
+	})
+}
@@ -20,6 +20,11 @@ const (
 	NotFound   Type = "NOTFOUND"   // For not finding resource
 	Forbidden  Type = "FORBIDDEN"  // The client has no access rights to the content so the server is refusing to respond
 	Conflict   Type = "CONFLICT"   // Already exists - 409
+
+	PreconditionFailed   Type = "PRECONDITIONFAILED"   // Resource changed since the client last read it - 412
+	PreconditionRequired Type = "PRECONDITIONREQUIRED" // Request must say which version it expects - 428
+	UnsupportedMediaType Type = "UNSUPPORTEDMEDIATYPE" // Request body is in a format we don't accept - 415
+	FailedDependency     Type = "FAILEDDEPENDENCY"     // Not done because another part of the same request failed - 424
 )
 
 // Error holds a custom error for the application
@@ -52,6 +57,14 @@ func (e *Error) Status() int {
 		return http.StatusForbidden
 	case Conflict:
 		return http.StatusConflict
+	case PreconditionFailed:
+		return http.StatusPreconditionFailed
+	case PreconditionRequired:
+		return http.StatusPreconditionRequired
+	case UnsupportedMediaType:
+		return http.StatusUnsupportedMediaType
+	case FailedDependency:
+		return http.StatusFailedDependency
 	default:
 		return http.StatusInternalServerError
 	}
@@ -119,3 +132,35 @@ func NewConflict(resource, operation, value string) *Error {
 		Message: fmt.Sprintf("resource: %s not %s: %v", resource, operation, value),
 	}
 }
+
+// NewPreconditionFailed to create 412 errors
+func NewPreconditionFailed(reason string) *Error {
+	return &Error{
+		Type:    PreconditionFailed,
+		Message: fmt.Sprintf("Precondition failed. Reason: %v", reason),
+	}
+}
+
+// NewPreconditionRequired to create 428 errors
+func NewPreconditionRequired(reason string) *Error {
+	return &Error{
+		Type:    PreconditionRequired,
+		Message: fmt.Sprintf("Precondition required. Reason: %v", reason),
+	}
+}
+
+// NewUnsupportedMediaType to create 415 errors
+func NewUnsupportedMediaType(reason string) *Error {
+	return &Error{
+		Type:    UnsupportedMediaType,
+		Message: fmt.Sprintf("Unsupported media type. Reason: %v", reason),
+	}
+}
+
+// NewFailedDependency to create 424 errors
+func NewFailedDependency(reason string) *Error {
+	return &Error{
+		Type:    FailedDependency,
+		Message: fmt.Sprintf("Failed dependency. Reason: %v", reason),
+	}
+}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"github.com/klasrak/users-api/handlers"
 
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
@@ -26,8 +27,16 @@ func (router *Router) Initialize(c *Container) {
 	r := gin.Default()
 
 	// ####### MIDDLEWARES #######
-	// CORS
-	r.Use(cors.Default())
+	// CORS, letting browsers send If-Match and read the headers of our
+	// responses. X-Actor is left out: only the gateway may send it
+	corsConfig := cors.DefaultConfig()
+	corsConfig.AllowAllOrigins = true
+	corsConfig.AddAllowHeaders("If-Match", "X-Request-ID", "X-Read-Your-Writes")
+	corsConfig.AddExposeHeaders("ETag", "Link", "X-Total-Count", "X-Request-ID", "Content-Disposition", "X-Imported-Count", "X-Rejected-Count", "X-Export-Error")
+	r.Use(cors.New(corsConfig))
+
+	// Actor and request ID, recorded in the audit log
+	r.Use(handlers.RequestContext(h.GatewayToken))
 
 	// ####### API V1 #######
 	v1Group := r.Group("/api/v1")
@@ -37,17 +46,41 @@ func (router *Router) Initialize(c *Container) {
 
 	// ## GET ##
 	usersGroup.GET("", h.GetAll)
+	usersGroup.GET("/search", h.Search)
+	usersGroup.GET("/export", h.Export)
 	usersGroup.GET("/:id", h.GetByID)
+	usersGroup.GET("/:id/history", h.History)
 
 	// ## POST ##
 	usersGroup.POST("", h.Create)
+	usersGroup.POST("/import", h.Import)
+	usersGroup.POST("/:id/restore", h.Restore)
+	v1Group.POST("/users:method", h.UsersMethod) // /users:batch, /users:batchUpdate, /users:batchDelete
 
 	// ## PUT ##
 	usersGroup.PUT("/:id", h.Update)
 
+	// ## PATCH ##
+	usersGroup.PATCH("/:id", h.Patch)
+
 	// ## DELETE ##
 	usersGroup.DELETE("/:id", h.Delete)
 
+	// ---- AUDIT RESOURCES /audit ----
+	v1Group.GET("/audit", h.ListAudit)
+	v1Group.GET("/audit/verify", h.VerifyAudit)
+
+	// ---- WEBHOOK RESOURCES /webhooks ----
+	webhooksGroup := v1Group.Group("/webhooks")
+
+	webhooksGroup.GET("", h.ListWebhooks)
+	webhooksGroup.GET("/:id", h.GetWebhook)
+	webhooksGroup.GET("/:id/deliveries", h.ListWebhookDeliveries)
+	webhooksGroup.POST("", h.CreateWebhook)
+	webhooksGroup.POST("/:id/deliveries/:delivery_id/redeliver", h.RedeliverWebhook)
+	webhooksGroup.PUT("/:id", h.UpdateWebhook)
+	webhooksGroup.DELETE("/:id", h.DeleteWebhook)
+
 	// ####### inject implementation of gin engine #######
 	router.r = r
 }
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/rand"
+	"time"
+
+	"github.com/bxcodec/faker/v3"
+	model "github.com/klasrak/users-api/models"
+	"github.com/klasrak/users-api/rerrors"
+	"github.com/klasrak/users-api/service"
+	"github.com/klasrak/users-api/utils"
+)
+
+// seedActor is who the audit log says created the seeded users
+const seedActor = "seed"
+
+// maxSeedConflicts is how many fake users in a row may be taken before
+// seeding gives up
+const maxSeedConflicts = 100
+
+// seedUsers creates n fake users with valid data. They're created through
+// the service, so they're validated and audited like any other user
+func seedUsers(ctx context.Context, s *service.UserService, n int) error {
+	ctx = utils.WithActor(ctx, seedActor)
+
+	conflicts := 0
+
+	for created := 0; created < n; {
+		u := &model.User{
+			Name:      faker.Name(),
+			Email:     faker.Email(),
+			Cpf:       utils.RandomBrazilianCPF(),
+			BirthDate: randomBirthdate(),
+		}
+
+		if _, err := s.Create(ctx, u); err != nil {
+			// faker may come up with an e-mail that is already taken
+			var e *rerrors.Error
+
+			if errors.As(err, &e) && e.Type == rerrors.Conflict && conflicts < maxSeedConflicts {
+				conflicts++
+				continue
+			}
+
+			return err
+		}
+
+		created++
+		conflicts = 0
+	}
+
+	if n > 0 {
+		log.Printf("Seeded %d fake users\n", n)
+	}
+
+	return nil
+}
+
+// randomBirthdate returns the birthdate of an adult aged between 18 and 80
+func randomBirthdate() time.Time {
+	d := time.Now().AddDate(-18-rand.Intn(62), 0, -rand.Intn(365))
+
+	return time.Date(d.Year(), d.Month(), d.Day(), 0, 0, 0, 0, time.UTC)
+}
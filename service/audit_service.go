@@ -0,0 +1,97 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	model "github.com/klasrak/users-api/models"
+	"github.com/klasrak/users-api/rerrors"
+)
+
+// AuditService is a struct to inject a implementation of AuditRepository
+type AuditService struct {
+	AuditRepository AuditRepository
+}
+
+// Page size limits applied to audit log listings
+const (
+	DefaultAuditPageSize = 100
+	MaxAuditPageSize     = 1000
+)
+
+// List validates the listing parameters, calls repository List and returns
+func (s *AuditService) List(ctx context.Context, params model.AuditListParams) (*model.AuditPage, error) {
+	if params.Limit < 0 || params.After < 0 {
+		return nil, rerrors.NewBadRequest("pagination parameters must be positive numbers")
+	}
+
+	if params.Limit == 0 {
+		params.Limit = DefaultAuditPageSize
+	}
+
+	if params.Limit > MaxAuditPageSize {
+		return nil, rerrors.NewBadRequest(fmt.Sprintf("limit must not be greater than %d", MaxAuditPageSize))
+	}
+
+	entries, err := s.AuditRepository.List(ctx, params)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.AuditPage{Data: entries}, nil
+}
+
+// Verify reads the whole audit log, a page at a time, checking that no entry
+// was changed, removed or inserted since it was appended (see
+// model.VerifyAuditChain). A log found tampered with is not an error: the
+// verification reports the first entry that was
+func (s *AuditService) Verify(ctx context.Context) (*model.AuditVerification, error) {
+	v := &model.AuditVerification{Valid: true}
+
+	params := model.AuditListParams{Limit: MaxAuditPageSize}
+
+	// the last entry checked, which the next page must follow
+	var last *model.AuditEntry
+
+	for {
+		entries, err := s.AuditRepository.List(ctx, params)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if len(entries) == 0 {
+			return v, nil
+		}
+
+		chain := entries
+
+		if last != nil {
+			chain = append([]model.AuditEntry{*last}, entries...)
+		} else if entries[0].PrevHash != model.AuditGenesisHash {
+			v.Valid = false
+			v.Error = fmt.Sprintf("audit entry %d does not start the chain", entries[0].ID)
+
+			return v, nil
+		}
+
+		if err := model.VerifyAuditChain(chain); err != nil {
+			v.Valid = false
+			v.Error = err.Error()
+
+			return v, nil
+		}
+
+		v.Entries += len(entries)
+
+		last = &entries[len(entries)-1]
+		v.LastHash = last.Hash
+
+		if len(entries) < params.Limit {
+			return v, nil
+		}
+
+		params.After = last.ID
+	}
+}
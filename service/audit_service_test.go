@@ -0,0 +1,165 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/klasrak/users-api/mocks"
+	model "github.com/klasrak/users-api/models"
+	"github.com/klasrak/users-api/rerrors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestAuditService(t *testing.T) {
+	t.Run("List", func(t *testing.T) {
+		t.Run("Success with default limit", func(t *testing.T) {
+			uid := uuid.New()
+			entries := []model.AuditEntry{{ID: 1, UserID: uid, Action: model.AuditCreate}}
+
+			mockAuditRepository := new(mocks.MockAuditRepository)
+			mockAuditRepository.On("List", mock.Anything, model.AuditListParams{UserID: &uid, Limit: DefaultAuditPageSize}).Return(entries, nil)
+
+			auditService := &AuditService{
+				AuditRepository: mockAuditRepository,
+			}
+
+			page, err := auditService.List(context.Background(), model.AuditListParams{UserID: &uid})
+
+			assert.NoError(t, err)
+			assert.Equal(t, &model.AuditPage{Data: entries}, page)
+			mockAuditRepository.AssertExpectations(t)
+		})
+
+		t.Run("Bad request", func(t *testing.T) {
+			mockAuditRepository := new(mocks.MockAuditRepository)
+
+			auditService := &AuditService{
+				AuditRepository: mockAuditRepository,
+			}
+
+			for _, params := range []model.AuditListParams{
+				{Limit: -1},
+				{After: -1},
+				{Limit: MaxAuditPageSize + 1},
+			} {
+				page, err := auditService.List(context.Background(), params)
+
+				assert.Nil(t, page)
+				assert.Equal(t, rerrors.BadRequest, err.(*rerrors.Error).Type)
+			}
+
+			mockAuditRepository.AssertNotCalled(t, "List", mock.Anything, mock.Anything)
+		})
+
+		t.Run("Error", func(t *testing.T) {
+			mockAuditRepository := new(mocks.MockAuditRepository)
+			mockAuditRepository.On("List", mock.Anything, mock.Anything).Return(nil, rerrors.NewInternal())
+
+			auditService := &AuditService{
+				AuditRepository: mockAuditRepository,
+			}
+
+			page, err := auditService.List(context.Background(), model.AuditListParams{})
+
+			assert.Nil(t, page)
+			assert.Equal(t, rerrors.NewInternal(), err)
+		})
+	})
+
+	t.Run("Verify", func(t *testing.T) {
+		// chain returns n entries appended one after the other
+		chain := func(n int) []model.AuditEntry {
+			entries := make([]model.AuditEntry, n)
+			prev := model.AuditGenesisHash
+
+			for i := range entries {
+				e := &entries[i]
+				e.ID = int64(i + 1)
+				e.UserID = uuid.New()
+				e.Action = model.AuditCreate
+				e.PrevHash = prev
+				e.Hash = e.ComputeHash()
+
+				prev = e.Hash
+			}
+
+			return entries
+		}
+
+		t.Run("Reads the whole log", func(t *testing.T) {
+			entries := chain(MaxAuditPageSize + 2)
+
+			mockAuditRepository := new(mocks.MockAuditRepository)
+			mockAuditRepository.On("List", mock.Anything, model.AuditListParams{Limit: MaxAuditPageSize}).Return(entries[:MaxAuditPageSize], nil)
+			mockAuditRepository.On("List", mock.Anything, model.AuditListParams{After: MaxAuditPageSize, Limit: MaxAuditPageSize}).Return(entries[MaxAuditPageSize:], nil)
+
+			auditService := &AuditService{
+				AuditRepository: mockAuditRepository,
+			}
+
+			v, err := auditService.Verify(context.Background())
+
+			assert.NoError(t, err)
+			assert.Equal(t, &model.AuditVerification{Valid: true, Entries: MaxAuditPageSize + 2, LastHash: entries[len(entries)-1].Hash}, v)
+			mockAuditRepository.AssertExpectations(t)
+		})
+
+		t.Run("Finds tampering", func(t *testing.T) {
+			for name, tc := range map[string]struct {
+				tamper func(entries []model.AuditEntry) []model.AuditEntry
+				err    string
+			}{
+				"changed": {
+					tamper: func(entries []model.AuditEntry) []model.AuditEntry {
+						entries[1].Actor = "mallory"
+						return entries
+					},
+					err: "audit entry 2 does not match its hash",
+				},
+				"removed": {
+					tamper: func(entries []model.AuditEntry) []model.AuditEntry {
+						return append(entries[:1], entries[2:]...)
+					},
+					err: "audit entry 3 does not follow entry 1",
+				},
+				"removed first": {
+					tamper: func(entries []model.AuditEntry) []model.AuditEntry {
+						return entries[1:]
+					},
+					err: "audit entry 2 does not start the chain",
+				},
+			} {
+				t.Run(name, func(t *testing.T) {
+					mockAuditRepository := new(mocks.MockAuditRepository)
+					mockAuditRepository.On("List", mock.Anything, mock.Anything).Return(tc.tamper(chain(3)), nil).Once()
+
+					auditService := &AuditService{
+						AuditRepository: mockAuditRepository,
+					}
+
+					v, err := auditService.Verify(context.Background())
+
+					assert.NoError(t, err)
+					assert.False(t, v.Valid)
+					assert.Equal(t, tc.err, v.Error)
+				})
+			}
+		})
+
+		t.Run("Error", func(t *testing.T) {
+			mockAuditRepository := new(mocks.MockAuditRepository)
+			mockAuditRepository.On("List", mock.Anything, mock.Anything).Return(nil, rerrors.NewInternal())
+
+			auditService := &AuditService{
+				AuditRepository: mockAuditRepository,
+			}
+
+			v, err := auditService.Verify(context.Background())
+
+			assert.Nil(t, v)
+			assert.Equal(t, rerrors.NewInternal(), err)
+		})
+	})
+}
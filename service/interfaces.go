@@ -2,6 +2,7 @@ package service
 
 import (
 	"context"
+	"time"
 
 	"github.com/google/uuid"
 	model "github.com/klasrak/users-api/models"
@@ -9,9 +10,69 @@ import (
 
 // UserRepository representes the user repository implementation
 type UserRepository interface {
-	GetAll(ctx context.Context, name string) ([]model.User, error)
-	GetByID(ctx context.Context, id uuid.UUID) (*model.User, error)
+	GetAll(ctx context.Context, params model.UserListParams) (*model.UserPage, error)
+	Stream(ctx context.Context, params model.UserListParams, fn func(u *model.User) error) error
+	Search(ctx context.Context, q string, limit int) ([]model.UserSearchResult, error)
+	GetByID(ctx context.Context, id uuid.UUID, includeDeleted bool) (*model.User, error)
+	Lock(ctx context.Context, id uuid.UUID) (*model.User, error)
 	Create(ctx context.Context, u *model.User) (*model.User, error)
+	FindTaken(ctx context.Context, emails, cpfs []string) ([]model.User, error)
+	CopyIn(ctx context.Context, users []*model.User) error
 	Update(ctx context.Context, u *model.User) (*model.User, error)
 	Delete(ctx context.Context, id string) error
+	Restore(ctx context.Context, id string) (*model.User, error)
+	Purge(ctx context.Context, id string) error
+}
+
+// AuditRepository represents the audit log repository implementation
+type AuditRepository interface {
+	Append(ctx context.Context, e *model.AuditEntry) error
+	AppendAll(ctx context.Context, entries []*model.AuditEntry) error
+	List(ctx context.Context, params model.AuditListParams) ([]model.AuditEntry, error)
+}
+
+// OutboxRepository represents the outbox repository implementation. Events
+// are appended within the transaction changing the users they announce, and
+// relayed by an OutboxDispatcher holding the lease on the outbox
+type OutboxRepository interface {
+	Append(ctx context.Context, events []*model.Event) error
+	Lease(ctx context.Context, holder string, now, until time.Time) (bool, error)
+	Release(ctx context.Context, holder string) error
+	Pending(ctx context.Context, now time.Time, limit int) ([]*model.Event, error)
+	Delivered(ctx context.Context, e *model.Event) error
+	Retry(ctx context.Context, e *model.Event, at time.Time, reason string) error
+}
+
+// EventPublisher represents where the events relayed from the outbox go
+type EventPublisher interface {
+	Publish(ctx context.Context, e *model.Event) error
+}
+
+// WebhookRepository represents the webhook repository implementation
+type WebhookRepository interface {
+	List(ctx context.Context) ([]model.Webhook, error)
+	GetByID(ctx context.Context, id uuid.UUID) (*model.Webhook, error)
+	Create(ctx context.Context, w *model.Webhook) error
+	Update(ctx context.Context, w *model.Webhook) error
+	Delete(ctx context.Context, id uuid.UUID) error
+	Succeeded(ctx context.Context, id uuid.UUID) error
+	Failed(ctx context.Context, id uuid.UUID, maxFailures int, reason string) (bool, error)
+}
+
+// WebhookDeliveryRepository represents the webhook delivery repository
+// implementation
+type WebhookDeliveryRepository interface {
+	Enqueue(ctx context.Context, deliveries []*model.WebhookDelivery) error
+	List(ctx context.Context, params model.WebhookDeliveryListParams) ([]model.WebhookDelivery, error)
+	GetByID(ctx context.Context, webhookID, id uuid.UUID) (*model.WebhookDelivery, error)
+	Due(ctx context.Context, now time.Time, limit int) ([]*model.WebhookDelivery, error)
+	Claim(ctx context.Context, d *model.WebhookDelivery, now, until time.Time) (bool, error)
+	Save(ctx context.Context, d *model.WebhookDelivery) error
+}
+
+// Transactor runs functions within a transaction shared by every repository
+// called with the context it hands over
+type Transactor interface {
+	WithinTx(ctx context.Context, fn func(ctx context.Context) error) error
+	WithinSnapshot(ctx context.Context, fn func(ctx context.Context) error) error
 }
@@ -0,0 +1,229 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	model "github.com/klasrak/users-api/models"
+)
+
+// Defaults of the settings of an OutboxDispatcher
+const (
+	DefaultOutboxPollInterval = time.Second
+	DefaultOutboxBatchSize    = 100
+	DefaultOutboxMinBackoff   = time.Second
+	DefaultOutboxMaxBackoff   = 5 * time.Minute
+	DefaultOutboxLeaseFor     = 30 * time.Second
+)
+
+// outboxReleaseTimeout bounds how long releasing the lease may take once
+// the dispatcher is stopped
+const outboxReleaseTimeout = 5 * time.Second
+
+// OutboxDispatcher relays the events appended to the outbox to Publisher.
+// Events are only deleted once published, so each one is published at
+// least once, and those of the same user in the order they were appended:
+// once publishing an event fails, the following events of its user wait
+// until it is published. Failed events are retried after a backoff growing
+// from MinBackoff up to MaxBackoff.
+//
+// Every instance of the API runs a dispatcher, but only the one holding the
+// lease on the outbox relays events, renewing it for LeaseFor each batch,
+// and again halfway through it while relaying a long one, so that the
+// others take over when it stops, and never while it relays
+type OutboxDispatcher struct {
+	OutboxRepository OutboxRepository
+	Publisher        EventPublisher
+	PollInterval     time.Duration
+	BatchSize        int
+	MinBackoff       time.Duration
+	MaxBackoff       time.Duration
+	LeaseFor         time.Duration
+
+	holder string
+	held   bool
+	// renewAt is when the lease is renewed while relaying a batch
+	renewAt time.Time
+}
+
+// NewOutboxDispatcher creates an OutboxDispatcher with the default settings
+func NewOutboxDispatcher(outbox OutboxRepository, publisher EventPublisher) *OutboxDispatcher {
+	return &OutboxDispatcher{
+		OutboxRepository: outbox,
+		Publisher:        publisher,
+		PollInterval:     DefaultOutboxPollInterval,
+		BatchSize:        DefaultOutboxBatchSize,
+		MinBackoff:       DefaultOutboxMinBackoff,
+		MaxBackoff:       DefaultOutboxMaxBackoff,
+		LeaseFor:         DefaultOutboxLeaseFor,
+		holder:           uuid.New().String(),
+	}
+}
+
+// Run relays events every PollInterval until ctx is done, then releases the
+// lease on the outbox, if held. Events being published when ctx is done are
+// published again later
+func (d *OutboxDispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.PollInterval)
+	defer ticker.Stop()
+
+	defer d.release()
+
+	for {
+		d.dispatch(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// dispatch relays the pending events, a batch at a time, while it holds the
+// lease on the outbox
+func (d *OutboxDispatcher) dispatch(ctx context.Context) {
+	for ctx.Err() == nil && d.lease(ctx) {
+		events, err := d.OutboxRepository.Pending(ctx, time.Now(), d.BatchSize)
+
+		if err != nil {
+			log.Printf("unable to read pending events from the outbox: %v\n", err)
+			return
+		}
+
+		// users whose events wait for a failed one
+		failed := map[uuid.UUID]bool{}
+
+		for _, e := range events {
+			if failed[e.UserID] {
+				continue
+			}
+
+			// another instance relays once the lease expires
+			if time.Now().After(d.renewAt) && !d.lease(ctx) {
+				return
+			}
+
+			if err := d.Publisher.Publish(ctx, e); err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+
+				failed[e.UserID] = true
+
+				if !d.retry(ctx, e, err) {
+					return
+				}
+
+				continue
+			}
+
+			if err := d.OutboxRepository.Delivered(ctx, e); err != nil {
+				log.Printf("unable to remove event %s from the outbox: %v\n", e.ID, err)
+				return
+			}
+		}
+
+		// failed events wait for their backoff and are left out of the next
+		// batch, as are the events of their users
+		if len(events) < d.BatchSize {
+			return
+		}
+	}
+}
+
+// retry reschedules an event that could not be published, reporting whether
+// it was rescheduled
+func (d *OutboxDispatcher) retry(ctx context.Context, e *model.Event, cause error) bool {
+	backoff := d.backoff(e.Attempts + 1)
+
+	log.Printf("unable to publish event %s, retrying in %s: %v\n", e.ID, backoff, cause)
+
+	if err := d.OutboxRepository.Retry(ctx, e, time.Now().Add(backoff), cause.Error()); err != nil {
+		log.Printf("unable to reschedule event %s: %v\n", e.ID, err)
+		return false
+	}
+
+	return true
+}
+
+// backoff returns how long to wait before publishing an event again, after
+// the given number of failed attempts
+func (d *OutboxDispatcher) backoff(attempts int) time.Duration {
+	return exponentialBackoff(d.MinBackoff, d.MaxBackoff, attempts)
+}
+
+// exponentialBackoff returns how long to wait before trying again after the
+// given number of failed attempts: first after the first one, doubling
+// after each of the others, up to limit
+func exponentialBackoff(first, limit time.Duration, attempts int) time.Duration {
+	backoff := first
+
+	for i := 1; i < attempts && backoff < limit; i++ {
+		backoff *= 2
+	}
+
+	if backoff > limit {
+		backoff = limit
+	}
+
+	return backoff
+}
+
+// lease acquires or renews the lease on the outbox, reporting whether it is
+// held
+func (d *OutboxDispatcher) lease(ctx context.Context) bool {
+	now := time.Now()
+
+	held, err := d.OutboxRepository.Lease(ctx, d.holder, now, now.Add(d.LeaseFor))
+
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("unable to lease the outbox: %v\n", err)
+		}
+
+		return false
+	}
+
+	d.held = held
+	d.renewAt = now.Add(d.LeaseFor / 2)
+
+	return held
+}
+
+// release hands over the lease on the outbox, if held, so that another
+// instance takes over without waiting for it to expire
+func (d *OutboxDispatcher) release() {
+	if !d.held {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), outboxReleaseTimeout)
+	defer cancel()
+
+	if err := d.OutboxRepository.Release(ctx, d.holder); err != nil {
+		log.Printf("unable to release the outbox: %v\n", err)
+	}
+
+	d.held = false
+}
+
+// LogEventPublisher is an EventPublisher writing events to the log, for
+// when there is nowhere else to publish them
+type LogEventPublisher struct{}
+
+// Publish writes e to the log
+func (LogEventPublisher) Publish(ctx context.Context, e *model.Event) error {
+	data, err := json.Marshal(e)
+
+	if err != nil {
+		return err
+	}
+
+	log.Printf("event %s\n", data)
+
+	return nil
+}
@@ -0,0 +1,186 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/klasrak/users-api/mocks"
+	model "github.com/klasrak/users-api/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestOutboxDispatcher(t *testing.T) {
+	ctx := context.Background()
+
+	newEvent := func(seq int64, userID uuid.UUID) *model.Event {
+		e := model.NewEvent(model.EventUserUpdated, &model.User{UID: userID})
+		e.Seq = seq
+
+		return e
+	}
+
+	newDispatcher := func(outbox *mocks.MockOutboxRepository, publisher *mocks.MockEventPublisher) *OutboxDispatcher {
+		d := NewOutboxDispatcher(outbox, publisher)
+		d.BatchSize = 10
+
+		return d
+	}
+
+	t.Run("Publishes pending events in order", func(t *testing.T) {
+		a, b := uuid.New(), uuid.New()
+		events := []*model.Event{newEvent(1, a), newEvent(2, b), newEvent(3, a)}
+
+		var published []int64
+
+		outbox := new(mocks.MockOutboxRepository)
+		outbox.On("Lease", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(true, nil)
+		outbox.On("Pending", mock.Anything, mock.Anything, 10).Return(events, nil).Once()
+		outbox.On("Delivered", mock.Anything, mock.Anything).Return(nil)
+
+		publisher := new(mocks.MockEventPublisher)
+		publisher.On("Publish", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			published = append(published, args.Get(1).(*model.Event).Seq)
+		}).Return(nil)
+
+		newDispatcher(outbox, publisher).dispatch(ctx)
+
+		assert.Equal(t, []int64{1, 2, 3}, published)
+		outbox.AssertNumberOfCalls(t, "Delivered", 3)
+	})
+
+	t.Run("Reads batches until the outbox is drained", func(t *testing.T) {
+		batch := make([]*model.Event, 10)
+
+		for i := range batch {
+			batch[i] = newEvent(int64(i+1), uuid.New())
+		}
+
+		outbox := new(mocks.MockOutboxRepository)
+		outbox.On("Lease", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(true, nil)
+		outbox.On("Pending", mock.Anything, mock.Anything, 10).Return(batch, nil).Once()
+		outbox.On("Pending", mock.Anything, mock.Anything, 10).Return([]*model.Event{newEvent(11, uuid.New())}, nil).Once()
+		outbox.On("Delivered", mock.Anything, mock.Anything).Return(nil)
+
+		publisher := new(mocks.MockEventPublisher)
+		publisher.On("Publish", mock.Anything, mock.Anything).Return(nil)
+
+		newDispatcher(outbox, publisher).dispatch(ctx)
+
+		publisher.AssertNumberOfCalls(t, "Publish", 11)
+		// the lease is renewed for every batch
+		outbox.AssertNumberOfCalls(t, "Lease", 2)
+	})
+
+	t.Run("Failed events hold back their user only", func(t *testing.T) {
+		a, b := uuid.New(), uuid.New()
+		failing := newEvent(1, a)
+		failing.Attempts = 2
+		events := []*model.Event{failing, newEvent(2, b), newEvent(3, a)}
+
+		outbox := new(mocks.MockOutboxRepository)
+		outbox.On("Lease", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(true, nil)
+		outbox.On("Pending", mock.Anything, mock.Anything, 10).Return(events, nil).Once()
+		outbox.On("Delivered", mock.Anything, events[1]).Return(nil).Once()
+
+		var retryAt time.Time
+
+		outbox.On("Retry", mock.Anything, failing, mock.Anything, "connection refused").Run(func(args mock.Arguments) {
+			retryAt = args.Get(2).(time.Time)
+		}).Return(nil).Once()
+
+		publisher := new(mocks.MockEventPublisher)
+		publisher.On("Publish", mock.Anything, failing).Return(errors.New("connection refused"))
+		publisher.On("Publish", mock.Anything, events[1]).Return(nil)
+
+		d := newDispatcher(outbox, publisher)
+		d.dispatch(ctx)
+
+		outbox.AssertExpectations(t)
+		publisher.AssertNotCalled(t, "Publish", mock.Anything, events[2])
+
+		// the third attempt failed
+		assert.WithinDuration(t, time.Now().Add(4*d.MinBackoff), retryAt, time.Second)
+	})
+
+	t.Run("Renews the lease while relaying long batches", func(t *testing.T) {
+		events := []*model.Event{newEvent(1, uuid.New()), newEvent(2, uuid.New()), newEvent(3, uuid.New())}
+
+		outbox := new(mocks.MockOutboxRepository)
+		outbox.On("Lease", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(true, nil).Twice()
+		outbox.On("Lease", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(false, nil)
+		outbox.On("Pending", mock.Anything, mock.Anything, 10).Return(events, nil).Once()
+		outbox.On("Delivered", mock.Anything, mock.Anything).Return(nil)
+
+		publisher := new(mocks.MockEventPublisher)
+		publisher.On("Publish", mock.Anything, mock.Anything).Run(func(mock.Arguments) {
+			time.Sleep(5 * time.Millisecond)
+		}).Return(nil)
+
+		d := newDispatcher(outbox, publisher)
+		d.LeaseFor = 4 * time.Millisecond
+
+		d.dispatch(ctx)
+
+		// once taken over, nothing else is relayed
+		publisher.AssertNumberOfCalls(t, "Publish", 2)
+		outbox.AssertNumberOfCalls(t, "Lease", 3)
+	})
+
+	t.Run("Waits for the lease", func(t *testing.T) {
+		outbox := new(mocks.MockOutboxRepository)
+		outbox.On("Lease", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(false, nil)
+
+		publisher := new(mocks.MockEventPublisher)
+
+		newDispatcher(outbox, publisher).dispatch(ctx)
+
+		outbox.AssertNotCalled(t, "Pending", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Stops without failing events", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(ctx)
+
+		e := newEvent(1, uuid.New())
+
+		outbox := new(mocks.MockOutboxRepository)
+		outbox.On("Lease", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(true, nil)
+		outbox.On("Pending", mock.Anything, mock.Anything, 10).Return([]*model.Event{e}, nil)
+		outbox.On("Release", mock.Anything, mock.Anything).Return(nil).Once()
+
+		publisher := new(mocks.MockEventPublisher)
+		publisher.On("Publish", mock.Anything, e).Run(func(mock.Arguments) { cancel() }).Return(context.Canceled)
+
+		d := newDispatcher(outbox, publisher)
+
+		done := make(chan struct{})
+
+		go func() {
+			d.Run(ctx)
+			close(done)
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("dispatcher didn't stop")
+		}
+
+		outbox.AssertNotCalled(t, "Retry", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+		outbox.AssertNotCalled(t, "Delivered", mock.Anything, mock.Anything)
+		outbox.AssertExpectations(t)
+	})
+
+	t.Run("Backoff", func(t *testing.T) {
+		d := &OutboxDispatcher{MinBackoff: time.Second, MaxBackoff: time.Minute}
+
+		assert.Equal(t, time.Second, d.backoff(1))
+		assert.Equal(t, 2*time.Second, d.backoff(2))
+		assert.Equal(t, 32*time.Second, d.backoff(6))
+		assert.Equal(t, time.Minute, d.backoff(7))
+		assert.Equal(t, time.Minute, d.backoff(1000))
+	})
+}
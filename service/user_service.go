@@ -2,7 +2,14 @@ package service
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
 	"net/mail"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	model "github.com/klasrak/users-api/models"
@@ -10,77 +17,966 @@ import (
 	"github.com/klasrak/users-api/utils"
 )
 
-// UserService is a struct to inject a implementation of UserRepository
+// UserService is a struct to inject a implementation of UserRepository.
+// Every change to a user is recorded through AuditRepository, and announced
+// through OutboxRepository, within a transaction started by Transactor
 type UserService struct {
-	UserRepository UserRepository
+	UserRepository   UserRepository
+	AuditRepository  AuditRepository
+	OutboxRepository OutboxRepository
+	Transactor       Transactor
 }
 
-// GetAll calls repository GetAll and returns
-func (s *UserService) GetAll(ctx context.Context, name string) ([]model.User, error) {
-	return s.UserRepository.GetAll(ctx, name)
+// Page size limits applied to user listings
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 1000
+)
+
+// GetAll validates the pagination parameters, calls repository GetAll and returns
+func (s *UserService) GetAll(ctx context.Context, params model.UserListParams) (*model.UserPage, error) {
+	if params.Limit < 0 || params.Page < 0 || params.PerPage < 0 {
+		return nil, rerrors.NewBadRequest("pagination parameters must be positive numbers")
+	}
+
+	if params.Paged() {
+		if params.Cursor != "" || params.Limit != 0 {
+			return nil, rerrors.NewBadRequest("page and per_page can't be combined with limit and cursor")
+		}
+
+		if params.Page == 0 {
+			params.Page = 1
+		}
+
+		if params.PerPage == 0 {
+			params.PerPage = DefaultPageSize
+		}
+
+		if params.PerPage > MaxPageSize {
+			return nil, rerrors.NewBadRequest(fmt.Sprintf("per_page must not be greater than %d", MaxPageSize))
+		}
+
+		return s.UserRepository.GetAll(ctx, params)
+	}
+
+	if params.Limit == 0 {
+		params.Limit = DefaultPageSize
+	}
+
+	if params.Limit > MaxPageSize {
+		return nil, rerrors.NewBadRequest(fmt.Sprintf("limit must not be greater than %d", MaxPageSize))
+	}
+
+	return s.UserRepository.GetAll(ctx, params)
+}
+
+// Export calls fn with every user a listing with params would return, in
+// the same order. Unlike GetAll, users aren't paginated but streamed from
+// the repository one at a time, so exports of any size take little memory
+func (s *UserService) Export(ctx context.Context, params model.UserListParams, fn func(u *model.User) error) error {
+	if params.Paged() || params.Limit != 0 || params.Cursor != "" {
+		return rerrors.NewBadRequest("exports are not paginated")
+	}
+
+	return s.UserRepository.Stream(ctx, params, fn)
+}
+
+// Search result limits
+const (
+	DefaultSearchSize = 20
+	MaxSearchSize     = 100
+)
+
+// Search validates the search parameters, calls repository Search and returns
+func (s *UserService) Search(ctx context.Context, q string, limit int) ([]model.UserSearchResult, error) {
+	if strings.TrimSpace(q) == "" {
+		return nil, rerrors.NewBadRequest("search query is required")
+	}
+
+	if limit < 0 || limit > MaxSearchSize {
+		return nil, rerrors.NewBadRequest(fmt.Sprintf("limit must be between 1 and %d", MaxSearchSize))
+	}
+
+	if limit == 0 {
+		limit = DefaultSearchSize
+	}
+
+	return s.UserRepository.Search(ctx, q, limit)
 }
 
 // GetByID call repository GetById and returns
-func (s *UserService) GetByID(ctx context.Context, id string) (*model.User, error) {
+func (s *UserService) GetByID(ctx context.Context, id string, includeDeleted bool) (*model.User, error) {
 	uid, err := uuid.Parse(id)
 
 	if err != nil {
 		return nil, rerrors.NewBadRequest("invalid id")
 	}
 
-	return s.UserRepository.GetByID(ctx, uid)
+	return s.UserRepository.GetByID(ctx, uid, includeDeleted)
 }
 
-// Create call repository Create and returns
-func (s *UserService) Create(ctx context.Context, u *model.User) (*model.User, error) {
+// GetAsOf returns a user as it was at the given time, rebuilt from its
+// current state and the audit log. Users deleted at that time are only
+// returned when includeDeleted is set
+func (s *UserService) GetAsOf(ctx context.Context, id string, at time.Time, includeDeleted bool) (*model.User, error) {
+	uid, err := uuid.Parse(id)
 
-	if utils.IsUnderage(u.BirthDate) {
-		return nil, rerrors.NewBadRequest("underage")
+	if err != nil {
+		return nil, rerrors.NewBadRequest("invalid id")
 	}
 
-	if !utils.IsBrazilianCPFValid(u.Cpf) {
-		return nil, rerrors.NewBadRequest("cpf invalid")
+	current, entries, err := s.userAndAudit(ctx, uid)
+
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := model.UserAsOf(current, entries, at)
+
+	if err != nil {
+		log.Printf("unable to rebuild user %s: %v\n", id, err)
+		return nil, rerrors.NewInternal()
+	}
+
+	if user == nil || (user.DeletedAt != nil && !includeDeleted) {
+		return nil, rerrors.NewNotFound("user", id)
+	}
+
+	return user, nil
+}
+
+// History returns every version of a user recorded by the audit log, newest
+// first, along with the change that produced it
+func (s *UserService) History(ctx context.Context, id string) (*model.UserHistory, error) {
+	uid, err := uuid.Parse(id)
+
+	if err != nil {
+		return nil, rerrors.NewBadRequest("invalid id")
+	}
+
+	current, entries, err := s.userAndAudit(ctx, uid)
+
+	if err != nil {
+		return nil, err
 	}
 
-	return s.UserRepository.Create(ctx, u)
+	revisions, err := model.BuildUserHistory(current, entries)
+
+	if err != nil {
+		log.Printf("unable to rebuild history of user %s: %v\n", id, err)
+		return nil, rerrors.NewInternal()
+	}
+
+	return &model.UserHistory{Data: revisions}, nil
 }
 
-// Update call repository Update and returns
-func (s *UserService) Update(ctx context.Context, id string, u *model.User) (*model.User, error) {
+// userAndAudit returns the current state of a user, deleted or not, and
+// every audit entry recorded for it, oldest first. Both are read from the
+// same snapshot, so no change can slip in between
+func (s *UserService) userAndAudit(ctx context.Context, uid uuid.UUID) (*model.User, []model.AuditEntry, error) {
+	var current *model.User
+
+	var entries []model.AuditEntry
+
+	err := s.Transactor.WithinSnapshot(ctx, func(ctx context.Context) error {
+		var err error
 
-	if !u.BirthDate.IsZero() {
-		if utils.IsUnderage(u.BirthDate) {
-			return nil, rerrors.NewBadRequest("underage")
+		if current, err = s.UserRepository.GetByID(ctx, uid, true); err != nil {
+			return err
 		}
+
+		params := model.AuditListParams{UserID: &uid, Limit: MaxAuditPageSize}
+
+		for {
+			page, err := s.AuditRepository.List(ctx, params)
+
+			if err != nil {
+				return err
+			}
+
+			entries = append(entries, page...)
+
+			if len(page) < params.Limit {
+				return nil
+			}
+
+			params.After = page[len(page)-1].ID
+		}
+	})
+
+	if err != nil {
+		return nil, nil, err
 	}
 
-	if u.Cpf != "" {
-		if !utils.IsBrazilianCPFValid(u.Cpf) {
-			return nil, rerrors.NewBadRequest("cpf invalid")
+	return current, entries, nil
+}
+
+// Create call repository Create and returns. The creation is recorded in
+// the audit log within the same transaction
+func (s *UserService) Create(ctx context.Context, u *model.User) (*model.User, error) {
+	if err := validate(u); err != nil {
+		return nil, err
+	}
+
+	var created *model.User
+
+	err := s.Transactor.WithinTx(ctx, func(ctx context.Context) error {
+		var err error
+
+		created, err = s.create(ctx, u)
+
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return created, nil
+}
+
+// MaxBatchSize bounds the number of users in a batch request
+const MaxBatchSize = 1000
+
+// CreateBatch creates several users at once, reporting the outcome of each
+// of them. Users are validated as in Create. In atomic mode either every
+// user is created or none is, and users that were not created because of
+// another one fail as a failed dependency. Otherwise each user is created
+// on its own, and failures don't affect the rest
+func (s *UserService) CreateBatch(ctx context.Context, users []*model.User, atomic bool) (*model.BatchResults, error) {
+	if len(users) == 0 {
+		return nil, rerrors.NewBadRequest("batch must have at least one user")
+	}
+
+	if len(users) > MaxBatchSize {
+		return nil, rerrors.NewBadRequest(fmt.Sprintf("batch must not have more than %d users", MaxBatchSize))
+	}
+
+	results := make([]model.BatchResult, len(users))
+
+	invalid := false
+
+	for i, u := range users {
+		results[i].Index = i
+
+		if err := validate(u); err != nil {
+			results[i].Fail(err)
+			invalid = true
 		}
 	}
 
-	if u.Email != "" {
-		_, err := mail.ParseAddress(u.Email)
+	if !atomic {
+		for i, u := range users {
+			if results[i].Failed() {
+				continue
+			}
+
+			err := s.Transactor.WithinTx(ctx, func(ctx context.Context) error {
+				created, err := s.create(ctx, u)
+
+				if err != nil {
+					return err
+				}
+
+				results[i].Succeed(http.StatusCreated, created.UID)
+
+				return nil
+			})
+
+			if err != nil {
+				results[i].Fail(err)
+			}
+		}
+
+		return model.NewBatchResults(results), nil
+	}
+
+	if invalid {
+		abortBatch(results, "another user in the batch is invalid")
+		return model.NewBatchResults(results), nil
+	}
+
+	failed := -1
+
+	err := s.Transactor.WithinTx(ctx, func(ctx context.Context) error {
+		failed = -1
+
+		for i, u := range users {
+			created, err := s.create(ctx, u)
+
+			if err != nil {
+				failed = i
+				return err
+			}
+
+			results[i].Succeed(http.StatusCreated, created.UID)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		if failed < 0 {
+			return nil, err
+		}
+
+		results[failed].Fail(err)
+		abortBatch(results, fmt.Sprintf("user %d could not be created", failed))
+	}
+
+	return model.NewBatchResults(results), nil
+}
+
+// MaxImportRows bounds the number of users in an import file
+const MaxImportRows = 50000
+
+// Import creates the users read from an import file. Lines that can't be
+// read, that hold an invalid user, or whose e-mail or cpf is taken, by an
+// active user or by an earlier line, are rejected and reported. The rest
+// are loaded at once and recorded in the audit log, in a single transaction
+func (s *UserService) Import(ctx context.Context, rows []model.ImportRow) (*model.ImportReport, error) {
+	if len(rows) == 0 {
+		return nil, rerrors.NewBadRequest("import file has no users")
+	}
+
+	if len(rows) > MaxImportRows {
+		return nil, rerrors.NewBadRequest(fmt.Sprintf("import file must not have more than %d users", MaxImportRows))
+	}
+
+	report := &model.ImportReport{Rejected: []model.ImportRejection{}}
+
+	var valid []model.ImportRow
+
+	emails, cpfs := map[string]int{}, map[string]int{}
+
+	for _, row := range rows {
+		err := row.Err
+
+		if err == nil {
+			err = validate(row.User)
+		}
+
+		if err == nil {
+			if line, ok := emails[row.User.Email]; ok {
+				err = rerrors.NewConflict("user", "imported", fmt.Sprintf("e-mail %s is already in line %d", row.User.Email, line))
+			} else if line, ok := cpfs[row.User.Cpf]; ok {
+				err = rerrors.NewConflict("user", "imported", fmt.Sprintf("cpf %s is already in line %d", row.User.Cpf, line))
+			}
+		}
 
 		if err != nil {
-			return nil, rerrors.NewBadRequest("invalid e-mail")
+			report.Rejected = append(report.Rejected, importRejection(row.Line, err))
+			continue
 		}
 
+		emails[row.User.Email] = row.Line
+		cpfs[row.User.Cpf] = row.Line
+		valid = append(valid, row)
 	}
 
+	var taken []model.ImportRejection
+
+	var imported int
+
+	err := s.Transactor.WithinTx(ctx, func(ctx context.Context) error {
+		taken, imported = nil, 0
+
+		if len(valid) == 0 {
+			return nil
+		}
+
+		keys := func(m map[string]int) []string {
+			list := make([]string, 0, len(m))
+
+			for k := range m {
+				list = append(list, k)
+			}
+
+			return list
+		}
+
+		existing, err := s.UserRepository.FindTaken(ctx, keys(emails), keys(cpfs))
+
+		if err != nil {
+			return err
+		}
+
+		takenEmails, takenCpfs := map[string]bool{}, map[string]bool{}
+
+		for _, u := range existing {
+			takenEmails[u.Email] = true
+			takenCpfs[u.Cpf] = true
+		}
+
+		var users []*model.User
+
+		var entries []*model.AuditEntry
+
+		var events []*model.Event
+
+		for _, row := range valid {
+			u := *row.User
+
+			switch {
+			case takenEmails[u.Email]:
+				taken = append(taken, importRejection(row.Line, rerrors.NewConflict("user", "imported", fmt.Sprintf("Key (email)=(%s) already exists.", u.Email))))
+				continue
+			case takenCpfs[u.Cpf]:
+				taken = append(taken, importRejection(row.Line, rerrors.NewConflict("user", "imported", fmt.Sprintf("Key (cpf)=(%s) already exists.", u.Cpf))))
+				continue
+			}
+
+			u.UID = uuid.New()
+			u.Version = 1
+
+			users = append(users, &u)
+			entries = append(entries, auditEntry(ctx, model.AuditCreate, u.UID, nil, &u))
+			events = append(events, model.NewEvent(model.EventUserCreated, &u))
+		}
+
+		if len(users) == 0 {
+			return nil
+		}
+
+		if err := s.UserRepository.CopyIn(ctx, users); err != nil {
+			return err
+		}
+
+		imported = len(users)
+
+		if err := s.AuditRepository.AppendAll(ctx, entries); err != nil {
+			return err
+		}
+
+		return s.OutboxRepository.Append(ctx, events)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	report.Imported = imported
+	report.Rejected = append(report.Rejected, taken...)
+
+	sort.SliceStable(report.Rejected, func(i, j int) bool {
+		return report.Rejected[i].Line < report.Rejected[j].Line
+	})
+
+	return report, nil
+}
+
+// importRejection reports why a line of an import file was rejected
+func importRejection(line int, err error) model.ImportRejection {
+	var e *rerrors.Error
+
+	if !errors.As(err, &e) {
+		e = rerrors.NewInternal()
+	}
+
+	return model.ImportRejection{Line: line, Reason: e.Message}
+}
+
+// create creates a user and records it in the audit log. It must run
+// within a transaction
+func (s *UserService) create(ctx context.Context, u *model.User) (*model.User, error) {
+	created, err := s.UserRepository.Create(ctx, u)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.audit(ctx, model.AuditCreate, created.UID, nil, created); err != nil {
+		return nil, err
+	}
+
+	return created, nil
+}
+
+// abortBatch fails every item of an atomic batch that hasn't failed on its
+// own, since none of them was kept
+func abortBatch(results []model.BatchResult, reason string) {
+	for i := range results {
+		if !results[i].Failed() {
+			results[i] = model.BatchResult{Index: i}
+			results[i].Fail(rerrors.NewFailedDependency(reason))
+		}
+	}
+}
+
+// Update replaces every field of a user and returns it. version is the
+// version of the user the caller last read; the update is rejected when it
+// is missing or the user has changed since. The update is recorded in the
+// audit log within the same transaction
+func (s *UserService) Update(ctx context.Context, id string, u *model.User, version int) (*model.User, error) {
 	uid, err := uuid.Parse(id)
 
 	if err != nil {
 		return nil, rerrors.NewBadRequest("invalid id")
 	}
 
+	if version <= 0 {
+		return nil, rerrors.NewPreconditionRequired("updates must state the version of the user they are based on")
+	}
+
+	if err := validate(u); err != nil {
+		return nil, err
+	}
+
 	u.UID = uid
+	u.Version = version
+
+	var updated *model.User
+
+	err = s.Transactor.WithinTx(ctx, func(ctx context.Context) error {
+		before, err := s.UserRepository.Lock(ctx, uid)
+
+		if err != nil {
+			return err
+		}
+
+		if updated, err = s.UserRepository.Update(ctx, u); err != nil {
+			return err
+		}
+
+		return s.audit(ctx, model.AuditUpdate, uid, before, updated)
+	})
+
+	if err != nil {
+		return nil, err
+	}
 
-	return s.UserRepository.Update(ctx, u)
+	return updated, nil
 }
 
-// Delete call repository Delete and returns
+// Patch applies a patch to the current state of a user, validates the
+// result as a whole and stores it. Like Update, it must be based on the
+// current version of the user, and is recorded in the audit log within the
+// same transaction
+func (s *UserService) Patch(ctx context.Context, id string, patch *model.UserPatch, version int) (*model.User, error) {
+	uid, err := uuid.Parse(id)
+
+	if err != nil {
+		return nil, rerrors.NewBadRequest("invalid id")
+	}
+
+	if version <= 0 {
+		return nil, rerrors.NewPreconditionRequired("updates must state the version of the user they are based on")
+	}
+
+	var patched *model.User
+
+	err = s.Transactor.WithinTx(ctx, func(ctx context.Context) error {
+		before, err := s.UserRepository.Lock(ctx, uid)
+
+		if err != nil {
+			return err
+		}
+
+		if before.DeletedAt != nil {
+			return rerrors.NewNotFound("user", id)
+		}
+
+		// checked before patching, so tests in the patch are never run
+		// against a version the caller hasn't seen
+		if before.Version != version {
+			return rerrors.NewPreconditionFailed(fmt.Sprintf("user is at version %d, not %d", before.Version, version))
+		}
+
+		patched, err = s.applyPatch(ctx, before, patch, false)
+
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return patched, nil
+}
+
+// applyPatch patches a locked user, validates the result as a whole and
+// stores it, recording the change in the audit log. With dryRun set nothing
+// is written, and the user as it would be stored is returned
+func (s *UserService) applyPatch(ctx context.Context, before *model.User, patch *model.UserPatch, dryRun bool) (*model.User, error) {
+	after, err := patch.Apply(before)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validate(after); err != nil {
+		return nil, err
+	}
+
+	if dryRun {
+		if err := s.checkTaken(ctx, after); err != nil {
+			return nil, err
+		}
+
+		after.Version++
+
+		return after, nil
+	}
+
+	patched, err := s.UserRepository.Update(ctx, after)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.audit(ctx, model.AuditUpdate, before.UID, before, patched); err != nil {
+		return nil, err
+	}
+
+	return patched, nil
+}
+
+// checkTaken fails with a conflict, as storing u would, when another active
+// user holds its e-mail or cpf
+func (s *UserService) checkTaken(ctx context.Context, u *model.User) error {
+	taken, err := s.UserRepository.FindTaken(ctx, []string{u.Email}, []string{u.Cpf})
+
+	if err != nil {
+		return err
+	}
+
+	for _, other := range taken {
+		switch {
+		case other.UID == u.UID:
+			continue
+		case other.Email == u.Email:
+			return rerrors.NewConflict("user", "updated", fmt.Sprintf("Key (email)=(%s) already exists.", u.Email))
+		default:
+			return rerrors.NewConflict("user", "updated", fmt.Sprintf("Key (cpf)=(%s) already exists.", u.Cpf))
+		}
+	}
+
+	return nil
+}
+
+// UpdateBatch applies the same patch to several users, reporting the outcome
+// for each of them. Each user is patched on its own, exactly like in Patch
+// but without checking its version. With dryRun set, nothing is written and
+// what would have changed is reported
+func (s *UserService) UpdateBatch(ctx context.Context, sel model.BatchSelector, patch *model.UserPatch, dryRun bool) (*model.BatchResults, error) {
+	return s.eachUser(ctx, sel, dryRun, func(ctx context.Context, uid uuid.UUID, r *model.BatchResult) error {
+		before, err := s.UserRepository.Lock(ctx, uid)
+
+		if err != nil {
+			return err
+		}
+
+		if before.DeletedAt != nil {
+			return rerrors.NewNotFound("user", uid.String())
+		}
+
+		patched, err := s.applyPatch(ctx, before, patch, dryRun)
+
+		if err != nil {
+			return err
+		}
+
+		r.Succeed(http.StatusOK, uid)
+		r.Changes = model.DiffUsers(before, patched)
+
+		return nil
+	})
+}
+
+// DeleteBatch deletes several users, reporting the outcome for each of them.
+// Each user is deleted on its own, exactly like in Delete. With dryRun set,
+// nothing is written and the deletions that would have been made are
+// reported
+func (s *UserService) DeleteBatch(ctx context.Context, sel model.BatchSelector, dryRun bool) (*model.BatchResults, error) {
+	return s.eachUser(ctx, sel, dryRun, func(ctx context.Context, uid uuid.UUID, r *model.BatchResult) error {
+		changes, err := s.delete(ctx, uid, dryRun)
+
+		if err != nil {
+			return err
+		}
+
+		r.Succeed(http.StatusNoContent, uid)
+		r.Changes = changes
+
+		return nil
+	})
+}
+
+// eachUser runs fn for every user picked by sel, each within a transaction
+// of its own. fn records its success in the given result, and its error is
+// recorded as the failure of the user
+func (s *UserService) eachUser(ctx context.Context, sel model.BatchSelector, dryRun bool, fn func(ctx context.Context, uid uuid.UUID, r *model.BatchResult) error) (*model.BatchResults, error) {
+	ids, err := s.selectUsers(ctx, sel)
+
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]model.BatchResult, len(ids))
+
+	for i, id := range ids {
+		results[i].Index = i
+
+		uid, err := uuid.Parse(id)
+
+		if err != nil {
+			results[i].Fail(rerrors.NewBadRequest(fmt.Sprintf("invalid id %q", id)))
+			continue
+		}
+
+		err = s.Transactor.WithinTx(ctx, func(ctx context.Context) error {
+			return fn(ctx, uid, &results[i])
+		})
+
+		if err != nil {
+			results[i].Fail(err)
+		}
+	}
+
+	batch := model.NewBatchResults(results)
+	batch.DryRun = dryRun
+
+	return batch, nil
+}
+
+// selectUsers returns the ids of the users picked by sel. Filters pick
+// users that aren't deleted, in the order they are listed by default, as
+// the primary database has them: a lagging replica would leave out users
+// created moments before
+func (s *UserService) selectUsers(ctx context.Context, sel model.BatchSelector) ([]string, error) {
+	if (len(sel.IDs) == 0) == (sel.Filter == "") {
+		return nil, rerrors.NewBadRequest("either ids or filter must be given")
+	}
+
+	if len(sel.IDs) > 0 {
+		if len(sel.IDs) > MaxBatchSize {
+			return nil, rerrors.NewBadRequest(fmt.Sprintf("batch must not have more than %d users", MaxBatchSize))
+		}
+
+		return sel.IDs, nil
+	}
+
+	var ids []string
+
+	ctx = utils.WithReadYourWrites(ctx)
+
+	params := model.UserListParams{Filter: sel.Filter, Limit: MaxPageSize}
+
+	for {
+		page, err := s.UserRepository.GetAll(ctx, params)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, u := range page.Data {
+			ids = append(ids, u.UID.String())
+		}
+
+		if len(ids) > MaxBatchSize {
+			return nil, rerrors.NewBadRequest(fmt.Sprintf("filter matches more than %d users", MaxBatchSize))
+		}
+
+		if page.NextCursor == "" {
+			return ids, nil
+		}
+
+		params.Cursor = page.NextCursor
+	}
+}
+
+// Delete call repository Delete and returns. The deletion is recorded in
+// the audit log within the same transaction
 func (s *UserService) Delete(ctx context.Context, id string) error {
-	return s.UserRepository.Delete(ctx, id)
+	uid, err := uuid.Parse(id)
+
+	if err != nil {
+		return rerrors.NewBadRequest("invalid id")
+	}
+
+	return s.Transactor.WithinTx(ctx, func(ctx context.Context) error {
+		_, err := s.delete(ctx, uid, false)
+
+		return err
+	})
+}
+
+// delete marks a user as deleted and returns the changes made to it,
+// recording them in the audit log. With dryRun set nothing is written, and
+// the changes that would have been made are returned. It must run within a
+// transaction
+func (s *UserService) delete(ctx context.Context, uid uuid.UUID, dryRun bool) (model.AuditChanges, error) {
+	before, err := s.UserRepository.Lock(ctx, uid)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if dryRun {
+		if before.DeletedAt != nil {
+			return nil, rerrors.NewNotFound("user", uid.String())
+		}
+
+		now := time.Now()
+
+		after := *before
+		after.DeletedAt = &now
+
+		return model.DiffUsers(before, &after), nil
+	}
+
+	if err := s.UserRepository.Delete(ctx, uid.String()); err != nil {
+		return nil, err
+	}
+
+	after, err := s.UserRepository.GetByID(ctx, uid, true)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.audit(ctx, model.AuditDelete, uid, before, after); err != nil {
+		return nil, err
+	}
+
+	return model.DiffUsers(before, after), nil
+}
+
+// Restore call repository Restore and returns. The restoration is recorded
+// in the audit log within the same transaction
+func (s *UserService) Restore(ctx context.Context, id string) (*model.User, error) {
+	uid, err := uuid.Parse(id)
+
+	if err != nil {
+		return nil, rerrors.NewBadRequest("invalid id")
+	}
+
+	var restored *model.User
+
+	err = s.Transactor.WithinTx(ctx, func(ctx context.Context) error {
+		before, err := s.UserRepository.Lock(ctx, uid)
+
+		if err != nil {
+			return err
+		}
+
+		if restored, err = s.UserRepository.Restore(ctx, id); err != nil {
+			return err
+		}
+
+		return s.audit(ctx, model.AuditRestore, uid, before, restored)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return restored, nil
+}
+
+// Purge call repository Purge and returns. The purge is recorded in the
+// audit log within the same transaction, which is all that is left of the
+// user afterwards
+func (s *UserService) Purge(ctx context.Context, id string) error {
+	uid, err := uuid.Parse(id)
+
+	if err != nil {
+		return rerrors.NewBadRequest("invalid id")
+	}
+
+	return s.Transactor.WithinTx(ctx, func(ctx context.Context) error {
+		before, err := s.UserRepository.Lock(ctx, uid)
+
+		if err != nil {
+			return err
+		}
+
+		if err := s.UserRepository.Purge(ctx, id); err != nil {
+			return err
+		}
+
+		return s.audit(ctx, model.AuditPurge, uid, before, nil)
+	})
+}
+
+// audit appends a change of a user to the audit log (see auditEntry), and
+// the event announcing it to the outbox (see changeEvent)
+func (s *UserService) audit(ctx context.Context, action model.AuditAction, id uuid.UUID, before, after *model.User) error {
+	if err := s.AuditRepository.Append(ctx, auditEntry(ctx, action, id, before, after)); err != nil {
+		return err
+	}
+
+	e := changeEvent(action, before, after)
+
+	if e == nil {
+		return nil
+	}
+
+	return s.OutboxRepository.Append(ctx, []*model.Event{e})
+}
+
+// changeEvent returns the event announcing a change of a user. Restoring a
+// user announces it as updated, and purging one as deleted, unless it was
+// deleted before, which was announced already
+func changeEvent(action model.AuditAction, before, after *model.User) *model.Event {
+	switch action {
+	case model.AuditCreate:
+		return model.NewEvent(model.EventUserCreated, after)
+	case model.AuditUpdate, model.AuditRestore:
+		return model.NewEvent(model.EventUserUpdated, after)
+	case model.AuditDelete:
+		return model.NewEvent(model.EventUserDeleted, after)
+	case model.AuditPurge:
+		if before.DeletedAt == nil {
+			return model.NewEvent(model.EventUserDeleted, before)
+		}
+	}
+
+	return nil
+}
+
+// auditEntry describes a change of a user, made on behalf of the actor and
+// request carried by ctx. Changes made outside of a request are attributed
+// to the system
+func auditEntry(ctx context.Context, action model.AuditAction, id uuid.UUID, before, after *model.User) *model.AuditEntry {
+	actor := utils.Actor(ctx)
+
+	if actor == "" {
+		actor = "system"
+	}
+
+	return &model.AuditEntry{
+		UserID:    id,
+		Actor:     actor,
+		RequestID: utils.RequestID(ctx),
+		Action:    action,
+		Changes:   model.DiffUsers(before, after),
+		// the database keeps microseconds, and the hash must match what is stored
+		CreatedAt: time.Now().UTC().Truncate(time.Microsecond),
+	}
+}
+
+// validate checks the rules every stored user follows
+func validate(u *model.User) error {
+	if strings.TrimSpace(u.Name) == "" {
+		return rerrors.NewBadRequest("name is required")
+	}
+
+	if addr, err := mail.ParseAddress(u.Email); err != nil || addr.Address != u.Email {
+		return rerrors.NewBadRequest("invalid e-mail")
+	}
+
+	if !utils.IsBrazilianCPFValid(u.Cpf) {
+		return rerrors.NewBadRequest("cpf invalid")
+	}
+
+	if u.BirthDate.IsZero() {
+		return rerrors.NewBadRequest("birthdate is required")
+	}
+
+	if utils.IsUnderage(u.BirthDate) {
+		return rerrors.NewBadRequest("underage")
+	}
+
+	return nil
 }
@@ -11,6 +11,7 @@ import (
 	"github.com/klasrak/users-api/mocks"
 	model "github.com/klasrak/users-api/models"
 	"github.com/klasrak/users-api/rerrors"
+	"github.com/klasrak/users-api/utils"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -18,6 +19,14 @@ import (
 func TestUserService(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
+	// outbox accepts every event appended to it
+	outbox := func() *mocks.MockOutboxRepository {
+		m := new(mocks.MockOutboxRepository)
+		m.On("Append", mock.Anything, mock.Anything).Return(nil).Maybe()
+
+		return m
+	}
+
 	t.Run("GetAll", func(t *testing.T) {
 		t.Run("Success without name filter", func(t *testing.T) {
 			var users []model.User
@@ -26,8 +35,11 @@ func TestUserService(t *testing.T) {
 
 			assert.NoError(t, err)
 
+			page := &model.UserPage{Data: users}
+			params := model.UserListParams{Limit: DefaultPageSize}
+
 			mockUserRepository := new(mocks.MockUserRepository)
-			mockUserRepository.On("GetAll", mock.AnythingOfType("*context.emptyCtx"), "").Return(users, nil)
+			mockUserRepository.On("GetAll", mock.Anything, params).Return(page, nil)
 
 			userService := &UserService{
 				UserRepository: mockUserRepository,
@@ -35,13 +47,13 @@ func TestUserService(t *testing.T) {
 
 			ctx := context.Background()
 
-			us, err := userService.GetAll(ctx, "")
+			p, err := userService.GetAll(ctx, model.UserListParams{})
 
 			mockUserRepository.AssertNumberOfCalls(t, "GetAll", 1)
-			mockUserRepository.AssertCalled(t, "GetAll", mock.AnythingOfType("*context.emptyCtx"), "")
+			mockUserRepository.AssertCalled(t, "GetAll", mock.Anything, params)
 
 			assert.NoError(t, err)
-			assert.Equal(t, users, us)
+			assert.Equal(t, page, p)
 
 			mockUserRepository.AssertExpectations(t)
 		})
@@ -59,8 +71,11 @@ func TestUserService(t *testing.T) {
 
 			users = append(users, user)
 
+			page := &model.UserPage{Data: users}
+			params := model.UserListParams{Name: "John", Limit: 10, Cursor: "cursor"}
+
 			mockUserRepository := new(mocks.MockUserRepository)
-			mockUserRepository.On("GetAll", mock.AnythingOfType("*context.emptyCtx"), "John").Return(users, nil)
+			mockUserRepository.On("GetAll", mock.Anything, params).Return(page, nil)
 
 			userService := &UserService{
 				UserRepository: mockUserRepository,
@@ -68,23 +83,88 @@ func TestUserService(t *testing.T) {
 
 			ctx := context.Background()
 
-			us, err := userService.GetAll(ctx, "John")
+			p, err := userService.GetAll(ctx, params)
 
 			mockUserRepository.AssertNumberOfCalls(t, "GetAll", 1)
-			mockUserRepository.AssertCalled(t, "GetAll", mock.AnythingOfType("*context.emptyCtx"), "John")
+			mockUserRepository.AssertCalled(t, "GetAll", mock.Anything, params)
 
 			assert.NoError(t, err)
-			assert.Equal(t, users, us)
+			assert.Equal(t, page, p)
 
 			mockUserRepository.AssertExpectations(t)
 		})
 
-		t.Run("Internal Server Error", func(t *testing.T) {
+		t.Run("Success with page defaults", func(t *testing.T) {
+			total := 0
+			page := &model.UserPage{Data: []model.User{}, Page: 2, PerPage: DefaultPageSize, Total: &total}
+			params := model.UserListParams{Page: 2, PerPage: DefaultPageSize}
 
-			var users []model.User
+			mockUserRepository := new(mocks.MockUserRepository)
+			mockUserRepository.On("GetAll", mock.Anything, params).Return(page, nil)
+			mockUserRepository.On("GetAll", mock.Anything, model.UserListParams{Page: 1, PerPage: DefaultPageSize}).Return(page, nil)
+
+			userService := &UserService{
+				UserRepository: mockUserRepository,
+			}
+
+			p, err := userService.GetAll(context.Background(), model.UserListParams{Page: 2})
+
+			assert.NoError(t, err)
+			assert.Equal(t, page, p)
+
+			_, err = userService.GetAll(context.Background(), model.UserListParams{PerPage: DefaultPageSize})
+
+			assert.NoError(t, err)
+			mockUserRepository.AssertCalled(t, "GetAll", mock.Anything, model.UserListParams{Page: 1, PerPage: DefaultPageSize})
+		})
+
+		t.Run("Bad request mixed pagination", func(t *testing.T) {
+			mockUserRepository := new(mocks.MockUserRepository)
+
+			userService := &UserService{
+				UserRepository: mockUserRepository,
+			}
+
+			for _, params := range []model.UserListParams{
+				{Page: 1, Cursor: "abc"},
+				{PerPage: 10, Limit: 10},
+				{Page: -1},
+				{Page: 1, PerPage: MaxPageSize + 1},
+			} {
+				_, err := userService.GetAll(context.Background(), params)
+
+				assert.Error(t, err)
+				assert.Equal(t, rerrors.BadRequest, err.(*rerrors.Error).Type)
+			}
+
+			mockUserRepository.AssertNotCalled(t, "GetAll", mock.Anything, mock.Anything)
+		})
+
+		t.Run("Bad request invalid limit", func(t *testing.T) {
+			mockUserRepository := new(mocks.MockUserRepository)
+
+			userService := &UserService{
+				UserRepository: mockUserRepository,
+			}
+
+			ctx := context.Background()
+
+			_, err := userService.GetAll(ctx, model.UserListParams{Limit: -1})
+
+			assert.Error(t, err)
+			assert.Equal(t, rerrors.BadRequest, err.(*rerrors.Error).Type)
 
+			_, err = userService.GetAll(ctx, model.UserListParams{Limit: MaxPageSize + 1})
+
+			assert.Error(t, err)
+			assert.Equal(t, rerrors.BadRequest, err.(*rerrors.Error).Type)
+
+			mockUserRepository.AssertNotCalled(t, "GetAll", mock.Anything, mock.Anything)
+		})
+
+		t.Run("Internal Server Error", func(t *testing.T) {
 			mockUserRepository := new(mocks.MockUserRepository)
-			mockUserRepository.On("GetAll", mock.Anything, mock.Anything).Return(users, rerrors.NewInternal())
+			mockUserRepository.On("GetAll", mock.Anything, mock.Anything).Return(nil, rerrors.NewInternal())
 
 			userService := &UserService{
 				UserRepository: mockUserRepository,
@@ -92,17 +172,88 @@ func TestUserService(t *testing.T) {
 
 			ctx := context.Background()
 
-			us, err := userService.GetAll(ctx, "")
+			p, err := userService.GetAll(ctx, model.UserListParams{})
 
 			mockUserRepository.AssertNumberOfCalls(t, "GetAll", 1)
-			mockUserRepository.AssertCalled(t, "GetAll", mock.AnythingOfType("*context.emptyCtx"), mock.AnythingOfType("string"))
+			mockUserRepository.AssertCalled(t, "GetAll", mock.Anything, mock.AnythingOfType("model.UserListParams"))
 
 			assert.Error(t, err)
 			assert.Equal(t, rerrors.NewInternal(), err)
-			assert.Equal(t, users, us)
+			assert.Nil(t, p)
+
+			mockUserRepository.AssertExpectations(t)
+		})
+	})
+
+	t.Run("Export", func(t *testing.T) {
+		t.Run("Success", func(t *testing.T) {
+			params := model.UserListParams{Filter: `email ends_with "@acme.com.br"`, IncludeDeleted: true}
+			users := []model.User{{UID: uuid.New(), Name: "João"}, {UID: uuid.New(), Name: "Maria"}}
+
+			mockUserRepository := new(mocks.MockUserRepository)
+			mockUserRepository.On("Stream", mock.Anything, params, mock.Anything).Return(users, nil)
+
+			userService := &UserService{UserRepository: mockUserRepository}
+
+			var exported []string
+
+			err := userService.Export(context.Background(), params, func(u *model.User) error {
+				exported = append(exported, u.Name)
+				return nil
+			})
+
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"João", "Maria"}, exported)
+			mockUserRepository.AssertExpectations(t)
+		})
+
+		t.Run("Bad request paginated", func(t *testing.T) {
+			userService := &UserService{}
+
+			for _, params := range []model.UserListParams{{Limit: 10}, {Cursor: "abc"}, {Page: 2}, {PerPage: 10}} {
+				err := userService.Export(context.Background(), params, func(u *model.User) error { return nil })
+
+				assert.Equal(t, 400, rerrors.Status(err))
+			}
+		})
+	})
+
+	t.Run("Search", func(t *testing.T) {
+		t.Run("Success", func(t *testing.T) {
+			results := []model.UserSearchResult{{User: model.User{UID: uuid.New(), Name: "João"}, Rank: 0.5}}
+
+			mockUserRepository := new(mocks.MockUserRepository)
+			mockUserRepository.On("Search", mock.Anything, "joao", DefaultSearchSize).Return(results, nil)
+
+			userService := &UserService{
+				UserRepository: mockUserRepository,
+			}
+
+			r, err := userService.Search(context.Background(), "joao", 0)
 
+			assert.NoError(t, err)
+			assert.Equal(t, results, r)
 			mockUserRepository.AssertExpectations(t)
 		})
+
+		t.Run("Bad request", func(t *testing.T) {
+			mockUserRepository := new(mocks.MockUserRepository)
+
+			userService := &UserService{
+				UserRepository: mockUserRepository,
+			}
+
+			_, err := userService.Search(context.Background(), "  ", 0)
+
+			assert.Equal(t, rerrors.NewBadRequest("search query is required"), err)
+
+			_, err = userService.Search(context.Background(), "ana", MaxSearchSize+1)
+
+			assert.Error(t, err)
+			assert.Equal(t, rerrors.BadRequest, err.(*rerrors.Error).Type)
+
+			mockUserRepository.AssertNotCalled(t, "Search", mock.Anything, mock.Anything, mock.Anything)
+		})
 	})
 
 	t.Run("GetByID", func(t *testing.T) {
@@ -118,7 +269,7 @@ func TestUserService(t *testing.T) {
 			}
 
 			mockUserRepository := new(mocks.MockUserRepository)
-			mockUserRepository.On("GetByID", mock.AnythingOfType("*context.emptyCtx"), uid).Return(user, nil)
+			mockUserRepository.On("GetByID", mock.Anything, uid, false).Return(user, nil)
 
 			userService := &UserService{
 				UserRepository: mockUserRepository,
@@ -126,10 +277,10 @@ func TestUserService(t *testing.T) {
 
 			ctx := context.Background()
 
-			us, err := userService.GetByID(ctx, uid.String())
+			us, err := userService.GetByID(ctx, uid.String(), false)
 
 			mockUserRepository.AssertNumberOfCalls(t, "GetByID", 1)
-			mockUserRepository.AssertCalled(t, "GetByID", mock.AnythingOfType("*context.emptyCtx"), uid)
+			mockUserRepository.AssertCalled(t, "GetByID", mock.Anything, uid, false)
 
 			assert.NoError(t, err)
 			assert.Equal(t, user, us)
@@ -144,7 +295,7 @@ func TestUserService(t *testing.T) {
 
 			ctx := context.Background()
 
-			us, err := userService.GetByID(ctx, "invalid_id")
+			us, err := userService.GetByID(ctx, "invalid_id", false)
 
 			mockUserRepository.AssertNotCalled(t, "GetByID")
 
@@ -162,7 +313,7 @@ func TestUserService(t *testing.T) {
 
 			mockErrorResponse := rerrors.NewNotFound("id", uid.String())
 			mockUserRepository := new(mocks.MockUserRepository)
-			mockUserRepository.On("GetByID", mock.AnythingOfType("*context.emptyCtx"), uid).Return(user, mockErrorResponse)
+			mockUserRepository.On("GetByID", mock.Anything, uid, false).Return(user, mockErrorResponse)
 
 			userService := &UserService{
 				UserRepository: mockUserRepository,
@@ -170,10 +321,10 @@ func TestUserService(t *testing.T) {
 
 			ctx := context.Background()
 
-			us, err := userService.GetByID(ctx, uid.String())
+			us, err := userService.GetByID(ctx, uid.String(), false)
 
 			mockUserRepository.AssertNumberOfCalls(t, "GetByID", 1)
-			mockUserRepository.AssertCalled(t, "GetByID", mock.AnythingOfType("*context.emptyCtx"), uid)
+			mockUserRepository.AssertCalled(t, "GetByID", mock.Anything, uid, false)
 
 			assert.Error(t, err)
 			assert.Equal(t, mockErrorResponse, err)
@@ -181,6 +332,188 @@ func TestUserService(t *testing.T) {
 		})
 	})
 
+	t.Run("GetAsOf", func(t *testing.T) {
+		uid := uuid.New()
+		birthdate := time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC)
+		deletedAt := time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)
+
+		v1 := &model.User{UID: uid, Name: "João", Email: "joao@mail.com", Cpf: "313.716.772-80", BirthDate: birthdate, Version: 1}
+		v2 := &model.User{UID: uid, Name: "João", Email: "joao@acme.com.br", Cpf: "313.716.772-80", BirthDate: birthdate, Version: 2}
+		v3 := &model.User{UID: uid, Name: "João", Email: "joao@acme.com.br", Cpf: "313.716.772-80", BirthDate: birthdate, DeletedAt: &deletedAt, Version: 3}
+
+		entries := []model.AuditEntry{
+			{ID: 1, UserID: uid, Action: model.AuditCreate, Changes: model.DiffUsers(nil, v1), CreatedAt: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)},
+			{ID: 2, UserID: uid, Action: model.AuditUpdate, Changes: model.DiffUsers(v1, v2), CreatedAt: time.Date(2022, 2, 1, 0, 0, 0, 0, time.UTC)},
+			{ID: 3, UserID: uid, Action: model.AuditDelete, Changes: model.DiffUsers(v2, v3), CreatedAt: deletedAt},
+		}
+
+		newService := func() *UserService {
+			mockUserRepository := new(mocks.MockUserRepository)
+			mockUserRepository.On("GetByID", mock.Anything, uid, true).Return(v3, nil)
+
+			mockAuditRepository := new(mocks.MockAuditRepository)
+			mockAuditRepository.On("List", mock.Anything, model.AuditListParams{UserID: &uid, Limit: MaxAuditPageSize}).Return(entries, nil)
+
+			return &UserService{
+				UserRepository:   mockUserRepository,
+				AuditRepository:  mockAuditRepository,
+				OutboxRepository: outbox(),
+				Transactor:       &mocks.MockTransactor{},
+			}
+		}
+
+		t.Run("Success", func(t *testing.T) {
+			us, err := newService().GetAsOf(context.Background(), uid.String(), time.Date(2022, 1, 15, 0, 0, 0, 0, time.UTC), false)
+
+			assert.NoError(t, err)
+			assert.Equal(t, v1, us)
+		})
+
+		t.Run("Deleted at that time", func(t *testing.T) {
+			at := time.Date(2022, 3, 15, 0, 0, 0, 0, time.UTC)
+
+			us, err := newService().GetAsOf(context.Background(), uid.String(), at, false)
+
+			assert.Nil(t, us)
+			assert.Equal(t, rerrors.NewNotFound("user", uid.String()), err)
+
+			us, err = newService().GetAsOf(context.Background(), uid.String(), at, true)
+
+			assert.NoError(t, err)
+			assert.Equal(t, v3, us)
+		})
+
+		t.Run("Not created yet", func(t *testing.T) {
+			us, err := newService().GetAsOf(context.Background(), uid.String(), time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC), true)
+
+			assert.Nil(t, us)
+			assert.Equal(t, rerrors.NewNotFound("user", uid.String()), err)
+		})
+
+		t.Run("Reads every page of the audit log", func(t *testing.T) {
+			page := make([]model.AuditEntry, MaxAuditPageSize)
+
+			for i := range page {
+				page[i] = model.AuditEntry{ID: int64(i + 1), UserID: uid, Action: model.AuditUpdate, Changes: model.AuditChanges{}, CreatedAt: time.Date(2022, 1, 2, 0, 0, 0, 0, time.UTC)}
+			}
+
+			current := &model.User{UID: uid, Name: "João", Version: MaxAuditPageSize + 2}
+
+			mockUserRepository := new(mocks.MockUserRepository)
+			mockUserRepository.On("GetByID", mock.Anything, uid, true).Return(current, nil)
+
+			mockAuditRepository := new(mocks.MockAuditRepository)
+			mockAuditRepository.On("List", mock.Anything, model.AuditListParams{UserID: &uid, Limit: MaxAuditPageSize}).Return(page, nil)
+			mockAuditRepository.On("List", mock.Anything, model.AuditListParams{UserID: &uid, After: MaxAuditPageSize, Limit: MaxAuditPageSize}).Return([]model.AuditEntry{
+				{ID: MaxAuditPageSize + 1, UserID: uid, Action: model.AuditUpdate, Changes: model.AuditChanges{}, CreatedAt: time.Date(2022, 1, 3, 0, 0, 0, 0, time.UTC)},
+			}, nil)
+
+			userService := &UserService{
+				UserRepository:   mockUserRepository,
+				AuditRepository:  mockAuditRepository,
+				OutboxRepository: outbox(),
+				Transactor:       &mocks.MockTransactor{},
+			}
+
+			us, err := userService.GetAsOf(context.Background(), uid.String(), time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC), false)
+
+			assert.NoError(t, err)
+			assert.Equal(t, 1, us.Version)
+			mockAuditRepository.AssertNumberOfCalls(t, "List", 2)
+		})
+
+		t.Run("Error not found", func(t *testing.T) {
+			mockUserRepository := new(mocks.MockUserRepository)
+			mockUserRepository.On("GetByID", mock.Anything, uid, true).Return(nil, rerrors.NewNotFound("user", uid.String()))
+
+			mockAuditRepository := new(mocks.MockAuditRepository)
+
+			userService := &UserService{
+				UserRepository:   mockUserRepository,
+				AuditRepository:  mockAuditRepository,
+				OutboxRepository: outbox(),
+				Transactor:       &mocks.MockTransactor{},
+			}
+
+			us, err := userService.GetAsOf(context.Background(), uid.String(), time.Now(), false)
+
+			assert.Nil(t, us)
+			assert.Equal(t, rerrors.NewNotFound("user", uid.String()), err)
+			mockAuditRepository.AssertNotCalled(t, "List", mock.Anything, mock.Anything)
+		})
+
+		t.Run("Error invalid id", func(t *testing.T) {
+			us, err := (&UserService{}).GetAsOf(context.Background(), "invalid_id", time.Now(), false)
+
+			assert.Nil(t, us)
+			assert.Equal(t, rerrors.NewBadRequest("invalid id"), err)
+		})
+	})
+
+	t.Run("History", func(t *testing.T) {
+		t.Run("Success", func(t *testing.T) {
+			uid := uuid.New()
+			v1 := &model.User{UID: uid, Name: "João", Email: "joao@mail.com", Cpf: "313.716.772-80", Version: 1}
+			v2 := &model.User{UID: uid, Name: "João Silva", Email: "joao@mail.com", Cpf: "313.716.772-80", Version: 2}
+
+			entries := []model.AuditEntry{
+				{ID: 1, UserID: uid, Actor: "maria", Action: model.AuditCreate, Changes: model.DiffUsers(nil, v1), CreatedAt: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)},
+				{ID: 2, UserID: uid, Actor: "ana", Action: model.AuditUpdate, Changes: model.DiffUsers(v1, v2), CreatedAt: time.Date(2022, 2, 1, 0, 0, 0, 0, time.UTC)},
+			}
+
+			mockUserRepository := new(mocks.MockUserRepository)
+			mockUserRepository.On("GetByID", mock.Anything, uid, true).Return(v2, nil)
+
+			mockAuditRepository := new(mocks.MockAuditRepository)
+			mockAuditRepository.On("List", mock.Anything, model.AuditListParams{UserID: &uid, Limit: MaxAuditPageSize}).Return(entries, nil)
+
+			userService := &UserService{
+				UserRepository:   mockUserRepository,
+				AuditRepository:  mockAuditRepository,
+				OutboxRepository: outbox(),
+				Transactor:       &mocks.MockTransactor{},
+			}
+
+			history, err := userService.History(context.Background(), uid.String())
+
+			assert.NoError(t, err)
+			assert.Len(t, history.Data, 2)
+			assert.Equal(t, v2, history.Data[0].User)
+			assert.Equal(t, "ana", history.Data[0].Actor)
+			assert.Equal(t, v1, history.Data[1].User)
+			assert.Equal(t, model.AuditCreate, history.Data[1].Action)
+		})
+
+		t.Run("Error", func(t *testing.T) {
+			uid := uuid.New()
+
+			mockUserRepository := new(mocks.MockUserRepository)
+			mockUserRepository.On("GetByID", mock.Anything, uid, true).Return(&model.User{UID: uid}, nil)
+
+			mockAuditRepository := new(mocks.MockAuditRepository)
+			mockAuditRepository.On("List", mock.Anything, mock.Anything).Return(nil, rerrors.NewInternal())
+
+			userService := &UserService{
+				UserRepository:   mockUserRepository,
+				AuditRepository:  mockAuditRepository,
+				OutboxRepository: outbox(),
+				Transactor:       &mocks.MockTransactor{},
+			}
+
+			history, err := userService.History(context.Background(), uid.String())
+
+			assert.Nil(t, history)
+			assert.Equal(t, rerrors.NewInternal(), err)
+		})
+
+		t.Run("Error invalid id", func(t *testing.T) {
+			history, err := (&UserService{}).History(context.Background(), "invalid_id")
+
+			assert.Nil(t, history)
+			assert.Equal(t, rerrors.NewBadRequest("invalid id"), err)
+		})
+	})
+
 	t.Run("Create", func(t *testing.T) {
 		t.Run("Success", func(t *testing.T) {
 			user := &model.User{
@@ -195,17 +528,22 @@ func TestUserService(t *testing.T) {
 			userMockResponse.UID = uid
 
 			mockUserRepository := new(mocks.MockUserRepository)
-			mockUserRepository.On("Create", mock.AnythingOfType("*context.emptyCtx"), user).Return(userMockResponse, nil)
+			mockAuditRepository := new(mocks.MockAuditRepository)
+			mockAuditRepository.On("Append", mock.Anything, mock.Anything).Return(nil)
+			mockUserRepository.On("Create", mock.Anything, user).Return(userMockResponse, nil)
 
 			userService := &UserService{
-				UserRepository: mockUserRepository,
+				UserRepository:   mockUserRepository,
+				AuditRepository:  mockAuditRepository,
+				OutboxRepository: outbox(),
+				Transactor:       &mocks.MockTransactor{},
 			}
 
 			ctx := context.Background()
 
 			us, err := userService.Create(ctx, user)
 
-			mockUserRepository.AssertCalled(t, "Create", mock.AnythingOfType("*context.emptyCtx"), user)
+			mockUserRepository.AssertCalled(t, "Create", mock.Anything, user)
 			mockUserRepository.AssertNumberOfCalls(t, "Create", 1)
 
 			assert.NoError(t, err)
@@ -225,17 +563,22 @@ func TestUserService(t *testing.T) {
 			mockErrorResponse := rerrors.NewConflict("user", "created", "unique_violation_email")
 
 			mockUserRepository := new(mocks.MockUserRepository)
-			mockUserRepository.On("Create", mock.AnythingOfType("*context.emptyCtx"), user).Return(nil, mockErrorResponse)
+			mockAuditRepository := new(mocks.MockAuditRepository)
+			mockAuditRepository.On("Append", mock.Anything, mock.Anything).Return(nil)
+			mockUserRepository.On("Create", mock.Anything, user).Return(nil, mockErrorResponse)
 
 			userService := &UserService{
-				UserRepository: mockUserRepository,
+				UserRepository:   mockUserRepository,
+				AuditRepository:  mockAuditRepository,
+				OutboxRepository: outbox(),
+				Transactor:       &mocks.MockTransactor{},
 			}
 
 			ctx := context.Background()
 
 			us, err := userService.Create(ctx, user)
 
-			mockUserRepository.AssertCalled(t, "Create", mock.AnythingOfType("*context.emptyCtx"), user)
+			mockUserRepository.AssertCalled(t, "Create", mock.Anything, user)
 			mockUserRepository.AssertNumberOfCalls(t, "Create", 1)
 
 			assert.Error(t, err)
@@ -256,17 +599,22 @@ func TestUserService(t *testing.T) {
 			mockErrorResponse := rerrors.NewConflict("user", "created", "unique_violation_cpf")
 
 			mockUserRepository := new(mocks.MockUserRepository)
-			mockUserRepository.On("Create", mock.AnythingOfType("*context.emptyCtx"), user).Return(nil, mockErrorResponse)
+			mockAuditRepository := new(mocks.MockAuditRepository)
+			mockAuditRepository.On("Append", mock.Anything, mock.Anything).Return(nil)
+			mockUserRepository.On("Create", mock.Anything, user).Return(nil, mockErrorResponse)
 
 			userService := &UserService{
-				UserRepository: mockUserRepository,
+				UserRepository:   mockUserRepository,
+				AuditRepository:  mockAuditRepository,
+				OutboxRepository: outbox(),
+				Transactor:       &mocks.MockTransactor{},
 			}
 
 			ctx := context.Background()
 
 			us, err := userService.Create(ctx, user)
 
-			mockUserRepository.AssertCalled(t, "Create", mock.AnythingOfType("*context.emptyCtx"), user)
+			mockUserRepository.AssertCalled(t, "Create", mock.Anything, user)
 			mockUserRepository.AssertNumberOfCalls(t, "Create", 1)
 
 			assert.Error(t, err)
@@ -287,17 +635,22 @@ func TestUserService(t *testing.T) {
 			mockErrorResponse := rerrors.NewInternal()
 
 			mockUserRepository := new(mocks.MockUserRepository)
-			mockUserRepository.On("Create", mock.AnythingOfType("*context.emptyCtx"), user).Return(nil, mockErrorResponse)
+			mockAuditRepository := new(mocks.MockAuditRepository)
+			mockAuditRepository.On("Append", mock.Anything, mock.Anything).Return(nil)
+			mockUserRepository.On("Create", mock.Anything, user).Return(nil, mockErrorResponse)
 
 			userService := &UserService{
-				UserRepository: mockUserRepository,
+				UserRepository:   mockUserRepository,
+				AuditRepository:  mockAuditRepository,
+				OutboxRepository: outbox(),
+				Transactor:       &mocks.MockTransactor{},
 			}
 
 			ctx := context.Background()
 
 			us, err := userService.Create(ctx, user)
 
-			mockUserRepository.AssertCalled(t, "Create", mock.AnythingOfType("*context.emptyCtx"), user)
+			mockUserRepository.AssertCalled(t, "Create", mock.Anything, user)
 			mockUserRepository.AssertNumberOfCalls(t, "Create", 1)
 
 			assert.Error(t, err)
@@ -318,9 +671,14 @@ func TestUserService(t *testing.T) {
 			mockErrorResponse := rerrors.NewBadRequest("underage")
 
 			mockUserRepository := new(mocks.MockUserRepository)
+			mockAuditRepository := new(mocks.MockAuditRepository)
+			mockAuditRepository.On("Append", mock.Anything, mock.Anything).Return(nil)
 
 			userService := &UserService{
-				UserRepository: mockUserRepository,
+				UserRepository:   mockUserRepository,
+				AuditRepository:  mockAuditRepository,
+				OutboxRepository: outbox(),
+				Transactor:       &mocks.MockTransactor{},
 			}
 
 			ctx := context.Background()
@@ -347,9 +705,14 @@ func TestUserService(t *testing.T) {
 			mockErrorResponse := rerrors.NewBadRequest("cpf invalid")
 
 			mockUserRepository := new(mocks.MockUserRepository)
+			mockAuditRepository := new(mocks.MockAuditRepository)
+			mockAuditRepository.On("Append", mock.Anything, mock.Anything).Return(nil)
 
 			userService := &UserService{
-				UserRepository: mockUserRepository,
+				UserRepository:   mockUserRepository,
+				AuditRepository:  mockAuditRepository,
+				OutboxRepository: outbox(),
+				Transactor:       &mocks.MockTransactor{},
 			}
 
 			ctx := context.Background()
@@ -366,136 +729,540 @@ func TestUserService(t *testing.T) {
 		})
 	})
 
-	t.Run("Update", func(t *testing.T) {
-		t.Run("Success", func(t *testing.T) {
-			uid, _ := uuid.NewRandom()
-			oldCpf := "313.716.772-80"
-			oldBirthdate := time.Date(1990, 1, 1, 1, 1, 1, 0, time.UTC)
+	t.Run("CreateBatch", func(t *testing.T) {
+		birthdate := time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC)
 
-			userUpdateParams := &model.User{
-				UID:       uid,
-				Name:      faker.Name(),
-				Email:     faker.Email(),
-				Cpf:       "",
-				BirthDate: time.Time{},
+		newUsers := func() []*model.User {
+			return []*model.User{
+				{Name: "João", Email: "joao@mail.com", Cpf: "313.716.772-80", BirthDate: birthdate},
+				{Name: "Maria", Email: "maria@mail.com", Cpf: "313.716.772-80", BirthDate: birthdate},
+				{Name: "José", Email: "jose@mail.com", Cpf: "313.716.772-80", BirthDate: birthdate},
 			}
+		}
 
-			userResponse := &model.User{
-				UID:       uid,
-				Name:      userUpdateParams.Name,
-				Email:     userUpdateParams.Email,
-				Cpf:       oldCpf,
-				BirthDate: oldBirthdate,
-			}
+		byEmail := func(email string) interface{} {
+			return mock.MatchedBy(func(u *model.User) bool { return u.Email == email })
+		}
+
+		t.Run("Success", func(t *testing.T) {
+			users := newUsers()
+			uids := []uuid.UUID{uuid.New(), uuid.New(), uuid.New()}
 
 			mockUserRepository := new(mocks.MockUserRepository)
-			mockUserRepository.On("Update", mock.AnythingOfType("*context.emptyCtx"), userUpdateParams).Return(userResponse, nil)
+			mockAuditRepository := new(mocks.MockAuditRepository)
+			mockAuditRepository.On("Append", mock.Anything, mock.Anything).Return(nil)
+
+			for i, u := range users {
+				mockUserRepository.On("Create", mock.Anything, u).Return(&model.User{UID: uids[i], Version: 1}, nil)
+			}
 
 			userService := &UserService{
-				UserRepository: mockUserRepository,
+				UserRepository:   mockUserRepository,
+				AuditRepository:  mockAuditRepository,
+				OutboxRepository: outbox(),
+				Transactor:       &mocks.MockTransactor{},
 			}
 
-			ctx := context.Background()
+			for _, atomic := range []bool{true, false} {
+				results, err := userService.CreateBatch(context.Background(), users, atomic)
 
-			us, err := userService.Update(ctx, uid.String(), userUpdateParams)
+				assert.NoError(t, err)
+				assert.Equal(t, 3, results.Succeeded)
+				assert.Equal(t, 0, results.Failed)
 
-			mockUserRepository.AssertCalled(t, "Update", mock.AnythingOfType("*context.emptyCtx"), userUpdateParams)
-			mockUserRepository.AssertNumberOfCalls(t, "Update", 1)
+				for i, r := range results.Data {
+					assert.Equal(t, i, r.Index)
+					assert.Equal(t, 201, r.Status)
+					assert.Equal(t, uids[i], *r.ID)
+					assert.Nil(t, r.Error)
+				}
+			}
 
-			assert.NoError(t, err)
-			assert.Equal(t, userResponse, us)
+			mockUserRepository.AssertNumberOfCalls(t, "Create", 6)
+			mockAuditRepository.AssertNumberOfCalls(t, "Append", 6)
 		})
 
-		t.Run("Error unique violation email", func(t *testing.T) {
-			uid, _ := uuid.NewRandom()
-			user := &model.User{
-				UID:       uid,
-				Name:      faker.Name(),
-				Email:     faker.Email(),
-				Cpf:       "313.716.772-80",
-				BirthDate: time.Date(1990, 1, 1, 1, 1, 1, 0, time.UTC),
-			}
-
-			mockErrorResponse := rerrors.NewConflict("user", "updated", "unique_violation_email")
+		t.Run("Best effort keeps valid users", func(t *testing.T) {
+			users := newUsers()
+			users[0].BirthDate = time.Now().AddDate(-10, 0, 0)
+			uid := uuid.New()
+			conflict := rerrors.NewConflict("user", "created", "unique_violation_email")
 
 			mockUserRepository := new(mocks.MockUserRepository)
-			mockUserRepository.On("Update", mock.AnythingOfType("*context.emptyCtx"), user).Return(nil, mockErrorResponse)
+			mockAuditRepository := new(mocks.MockAuditRepository)
+			mockAuditRepository.On("Append", mock.Anything, mock.Anything).Return(nil)
+			mockUserRepository.On("Create", mock.Anything, byEmail("maria@mail.com")).Return(nil, conflict)
+			mockUserRepository.On("Create", mock.Anything, byEmail("jose@mail.com")).Return(&model.User{UID: uid, Version: 1}, nil)
 
 			userService := &UserService{
-				UserRepository: mockUserRepository,
+				UserRepository:   mockUserRepository,
+				AuditRepository:  mockAuditRepository,
+				OutboxRepository: outbox(),
+				Transactor:       &mocks.MockTransactor{},
 			}
 
-			ctx := context.Background()
+			results, err := userService.CreateBatch(context.Background(), users, false)
 
-			us, err := userService.Update(ctx, uid.String(), user)
+			assert.NoError(t, err)
+			assert.Equal(t, 1, results.Succeeded)
+			assert.Equal(t, 2, results.Failed)
 
-			mockUserRepository.AssertCalled(t, "Update", mock.AnythingOfType("*context.emptyCtx"), user)
-			mockUserRepository.AssertNumberOfCalls(t, "Update", 1)
+			assert.Equal(t, 400, results.Data[0].Status)
+			assert.Equal(t, rerrors.BadRequest, results.Data[0].Error.Type)
+			assert.Nil(t, results.Data[0].ID)
 
-			assert.Error(t, err)
-			assert.Equal(t, mockErrorResponse, err)
-			assert.Nil(t, us)
+			assert.Equal(t, 409, results.Data[1].Status)
+			assert.Equal(t, conflict, results.Data[1].Error)
 
-			mockUserRepository.AssertExpectations(t)
-		})
+			assert.Equal(t, 201, results.Data[2].Status)
+			assert.Equal(t, uid, *results.Data[2].ID)
 
-		t.Run("Error unique violation cpf", func(t *testing.T) {
-			uid, _ := uuid.NewRandom()
-			user := &model.User{
-				UID:       uid,
-				Name:      faker.Name(),
-				Email:     faker.Email(),
-				Cpf:       "313.716.772-80",
-				BirthDate: time.Date(1990, 1, 1, 1, 1, 1, 0, time.UTC),
-			}
+			mockUserRepository.AssertNumberOfCalls(t, "Create", 2)
+		})
 
-			mockErrorResponse := rerrors.NewConflict("user", "updated", "unique_violation_cpf")
+		t.Run("Atomic with an invalid user creates none", func(t *testing.T) {
+			users := newUsers()
+			users[1].Cpf = "111.111.111-11"
 
 			mockUserRepository := new(mocks.MockUserRepository)
-			mockUserRepository.On("Update", mock.AnythingOfType("*context.emptyCtx"), user).Return(nil, mockErrorResponse)
 
 			userService := &UserService{
 				UserRepository: mockUserRepository,
+				Transactor:     &mocks.MockTransactor{},
 			}
 
-			ctx := context.Background()
-
-			us, err := userService.Update(ctx, uid.String(), user)
+			results, err := userService.CreateBatch(context.Background(), users, true)
 
-			mockUserRepository.AssertCalled(t, "Update", mock.AnythingOfType("*context.emptyCtx"), user)
-			mockUserRepository.AssertNumberOfCalls(t, "Update", 1)
+			assert.NoError(t, err)
+			assert.Equal(t, 0, results.Succeeded)
+			assert.Equal(t, 3, results.Failed)
 
-			assert.Error(t, err)
-			assert.Equal(t, mockErrorResponse, err)
-			assert.Nil(t, us)
+			assert.Equal(t, 424, results.Data[0].Status)
+			assert.Equal(t, rerrors.FailedDependency, results.Data[0].Error.Type)
+			assert.Equal(t, 400, results.Data[1].Status)
+			assert.Equal(t, 424, results.Data[2].Status)
 
-			mockUserRepository.AssertExpectations(t)
+			mockUserRepository.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
 		})
 
-		t.Run("Internal Server Error", func(t *testing.T) {
-			uid, _ := uuid.NewRandom()
-			user := &model.User{
-				UID:       uid,
-				Name:      faker.Name(),
-				Email:     faker.Email(),
-				Cpf:       "313.716.772-80",
-				BirthDate: time.Date(1990, 1, 1, 1, 1, 1, 0, time.UTC),
-			}
-
-			mockErrorResponse := rerrors.NewInternal()
+		t.Run("Atomic stops at the first failure", func(t *testing.T) {
+			users := newUsers()
+			conflict := rerrors.NewConflict("user", "created", "unique_violation_cpf")
 
 			mockUserRepository := new(mocks.MockUserRepository)
-			mockUserRepository.On("Update", mock.AnythingOfType("*context.emptyCtx"), user).Return(nil, mockErrorResponse)
+			mockAuditRepository := new(mocks.MockAuditRepository)
+			mockAuditRepository.On("Append", mock.Anything, mock.Anything).Return(nil)
+			mockUserRepository.On("Create", mock.Anything, byEmail("joao@mail.com")).Return(&model.User{UID: uuid.New(), Version: 1}, nil)
+			mockUserRepository.On("Create", mock.Anything, byEmail("maria@mail.com")).Return(nil, conflict)
 
 			userService := &UserService{
-				UserRepository: mockUserRepository,
+				UserRepository:   mockUserRepository,
+				AuditRepository:  mockAuditRepository,
+				OutboxRepository: outbox(),
+				Transactor:       &mocks.MockTransactor{},
 			}
 
-			ctx := context.Background()
+			results, err := userService.CreateBatch(context.Background(), users, true)
 
-			us, err := userService.Update(ctx, uid.String(), user)
+			assert.NoError(t, err)
+			assert.Equal(t, 0, results.Succeeded)
+			assert.Equal(t, 3, results.Failed)
+
+			assert.Equal(t, 424, results.Data[0].Status)
+			assert.Nil(t, results.Data[0].ID)
+			assert.Equal(t, conflict, results.Data[1].Error)
+			assert.Equal(t, 424, results.Data[2].Status)
+
+			mockUserRepository.AssertNumberOfCalls(t, "Create", 2)
+		})
+
+		t.Run("Atomic retried failing to commit blames no user", func(t *testing.T) {
+			users := newUsers()
+			deadlock := rerrors.NewInternal()
+			commitErr := rerrors.NewInternal()
+
+			mockUserRepository := new(mocks.MockUserRepository)
+			mockAuditRepository := new(mocks.MockAuditRepository)
+			mockAuditRepository.On("Append", mock.Anything, mock.Anything).Return(nil)
+			mockUserRepository.On("Create", mock.Anything, byEmail("maria@mail.com")).Return(nil, deadlock).Once()
+			mockUserRepository.On("Create", mock.Anything, mock.Anything).Return(&model.User{UID: uuid.New(), Version: 1}, nil)
+
+			userService := &UserService{
+				UserRepository:   mockUserRepository,
+				AuditRepository:  mockAuditRepository,
+				OutboxRepository: outbox(),
+				Transactor:       &retriedTransactor{commitErr: commitErr},
+			}
+
+			results, err := userService.CreateBatch(context.Background(), users, true)
+
+			assert.Nil(t, results)
+			assert.Equal(t, commitErr, err)
+		})
+
+		t.Run("Bad request empty batch", func(t *testing.T) {
+			userService := &UserService{}
+
+			results, err := userService.CreateBatch(context.Background(), nil, false)
+
+			assert.Nil(t, results)
+			assert.Equal(t, 400, rerrors.Status(err))
+		})
+
+		t.Run("Bad request batch too large", func(t *testing.T) {
+			userService := &UserService{}
+
+			results, err := userService.CreateBatch(context.Background(), make([]*model.User, MaxBatchSize+1), false)
+
+			assert.Nil(t, results)
+			assert.Equal(t, 400, rerrors.Status(err))
+		})
+	})
+
+	t.Run("Import", func(t *testing.T) {
+		birthdate := time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC)
+
+		row := func(line int, name, email, cpf string) model.ImportRow {
+			return model.ImportRow{Line: line, User: &model.User{Name: name, Email: email, Cpf: cpf, BirthDate: birthdate}}
+		}
+
+		t.Run("Success rejecting invalid and taken users", func(t *testing.T) {
+			rows := []model.ImportRow{
+				row(2, "João", "joao@mail.com", "313.716.772-80"),
+				{Line: 3, Err: rerrors.NewBadRequest(`invalid birthdate "1990-31-01"`)},
+				row(4, "Maria", "maria@mail.com", "111.111.111-11"),
+				row(5, "João Silva", "joao@mail.com", "182.345.015-69"),
+				row(6, "José", "jose@mail.com", "774.186.357-61"),
+			}
+
+			mockUserRepository := new(mocks.MockUserRepository)
+			mockUserRepository.On("FindTaken", mock.Anything, mock.Anything, mock.Anything).
+				Return([]model.User{{UID: uuid.New(), Email: "someone@mail.com", Cpf: "774.186.357-61"}}, nil)
+
+			var copied []*model.User
+
+			mockUserRepository.On("CopyIn", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+				copied = args.Get(1).([]*model.User)
+			}).Return(nil)
+
+			var entries []*model.AuditEntry
+
+			mockAuditRepository := new(mocks.MockAuditRepository)
+			mockAuditRepository.On("AppendAll", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+				entries = args.Get(1).([]*model.AuditEntry)
+			}).Return(nil)
+
+			userService := &UserService{
+				UserRepository:   mockUserRepository,
+				AuditRepository:  mockAuditRepository,
+				OutboxRepository: outbox(),
+				Transactor:       &mocks.MockTransactor{},
+			}
+
+			ctx := utils.WithActor(context.Background(), "rh")
+
+			report, err := userService.Import(ctx, rows)
+
+			assert.NoError(t, err)
+			assert.Equal(t, 1, report.Imported)
+			assert.Equal(t, []model.ImportRejection{
+				{Line: 3, Reason: `Bad request. Reason: invalid birthdate "1990-31-01"`},
+				{Line: 4, Reason: "Bad request. Reason: cpf invalid"},
+				{Line: 5, Reason: "resource: user not imported: e-mail joao@mail.com is already in line 2"},
+				{Line: 6, Reason: "resource: user not imported: Key (cpf)=(774.186.357-61) already exists."},
+			}, report.Rejected)
+
+			emails := mockUserRepository.Calls[0].Arguments.Get(1).([]string)
+			assert.ElementsMatch(t, []string{"joao@mail.com", "jose@mail.com"}, emails)
+
+			assert.Len(t, copied, 1)
+			assert.Equal(t, "joao@mail.com", copied[0].Email)
+			assert.NotEqual(t, uuid.Nil, copied[0].UID)
+			assert.Equal(t, 1, copied[0].Version)
+
+			assert.Len(t, entries, 1)
+			assert.Equal(t, copied[0].UID, entries[0].UserID)
+			assert.Equal(t, model.AuditCreate, entries[0].Action)
+			assert.Equal(t, "rh", entries[0].Actor)
+
+			assert.Equal(t, "João", rows[0].User.Name)
+			assert.Equal(t, uuid.Nil, rows[0].User.UID)
+		})
+
+		t.Run("Nothing to load", func(t *testing.T) {
+			mockUserRepository := new(mocks.MockUserRepository)
+			mockUserRepository.On("FindTaken", mock.Anything, mock.Anything, mock.Anything).
+				Return([]model.User{{Email: "joao@mail.com"}}, nil)
+
+			userService := &UserService{
+				UserRepository: mockUserRepository,
+				Transactor:     &mocks.MockTransactor{},
+			}
+
+			report, err := userService.Import(context.Background(), []model.ImportRow{row(2, "João", "joao@mail.com", "313.716.772-80")})
+
+			assert.NoError(t, err)
+			assert.Equal(t, 0, report.Imported)
+			assert.Len(t, report.Rejected, 1)
+			mockUserRepository.AssertNotCalled(t, "CopyIn", mock.Anything, mock.Anything)
+		})
+
+		t.Run("Error copying", func(t *testing.T) {
+			conflict := rerrors.NewConflict("users", "imported", "Key (email)=(joao@mail.com) already exists.")
+
+			mockUserRepository := new(mocks.MockUserRepository)
+			mockUserRepository.On("FindTaken", mock.Anything, mock.Anything, mock.Anything).Return([]model.User{}, nil)
+			mockUserRepository.On("CopyIn", mock.Anything, mock.Anything).Return(conflict)
+
+			userService := &UserService{
+				UserRepository: mockUserRepository,
+				Transactor:     &mocks.MockTransactor{},
+			}
+
+			report, err := userService.Import(context.Background(), []model.ImportRow{row(2, "João", "joao@mail.com", "313.716.772-80")})
+
+			assert.Nil(t, report)
+			assert.Equal(t, conflict, err)
+		})
+
+		t.Run("Bad request empty or too large file", func(t *testing.T) {
+			userService := &UserService{}
+
+			report, err := userService.Import(context.Background(), nil)
+
+			assert.Nil(t, report)
+			assert.Equal(t, 400, rerrors.Status(err))
+
+			report, err = userService.Import(context.Background(), make([]model.ImportRow, MaxImportRows+1))
+
+			assert.Nil(t, report)
+			assert.Equal(t, 400, rerrors.Status(err))
+		})
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		t.Run("Success", func(t *testing.T) {
+			uid, _ := uuid.NewRandom()
+
+			userUpdateParams := &model.User{
+				UID:       uid,
+				Name:      faker.Name(),
+				Email:     faker.Email(),
+				Cpf:       "313.716.772-80",
+				BirthDate: time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC),
+			}
+
+			userResponse := &model.User{
+				UID:       uid,
+				Name:      userUpdateParams.Name,
+				Email:     userUpdateParams.Email,
+				Cpf:       userUpdateParams.Cpf,
+				BirthDate: userUpdateParams.BirthDate,
+				Version:   2,
+			}
+
+			mockUserRepository := new(mocks.MockUserRepository)
+			mockAuditRepository := new(mocks.MockAuditRepository)
+			mockAuditRepository.On("Append", mock.Anything, mock.Anything).Return(nil)
+			mockUserRepository.On("Lock", mock.Anything, uid).Return(&model.User{UID: uid}, nil)
+			mockUserRepository.On("Update", mock.Anything, userUpdateParams).Return(userResponse, nil)
+
+			userService := &UserService{
+				UserRepository:   mockUserRepository,
+				AuditRepository:  mockAuditRepository,
+				OutboxRepository: outbox(),
+				Transactor:       &mocks.MockTransactor{},
+			}
+
+			ctx := context.Background()
+
+			us, err := userService.Update(ctx, uid.String(), userUpdateParams, 1)
+
+			mockUserRepository.AssertCalled(t, "Update", mock.Anything, userUpdateParams)
+			mockUserRepository.AssertNumberOfCalls(t, "Update", 1)
+
+			assert.NoError(t, err)
+			assert.Equal(t, userResponse, us)
+			assert.Equal(t, 1, userUpdateParams.Version)
+		})
+
+		t.Run("Bad request partial user", func(t *testing.T) {
+			for reason, user := range map[string]*model.User{
+				"name is required":      {Email: "joao@mail.com", Cpf: "313.716.772-80", BirthDate: time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC)},
+				"invalid e-mail":        {Name: "João", Cpf: "313.716.772-80", BirthDate: time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC)},
+				"cpf invalid":           {Name: "João", Email: "joao@mail.com", BirthDate: time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC)},
+				"birthdate is required": {Name: "João", Email: "joao@mail.com", Cpf: "313.716.772-80"},
+			} {
+				mockUserRepository := new(mocks.MockUserRepository)
+
+				userService := &UserService{
+					UserRepository: mockUserRepository,
+					Transactor:     &mocks.MockTransactor{},
+				}
+
+				us, err := userService.Update(context.Background(), uuid.New().String(), user, 1)
+
+				assert.Nil(t, us)
+				assert.Equal(t, rerrors.NewBadRequest(reason), err)
+				mockUserRepository.AssertNotCalled(t, "Update", mock.Anything, mock.Anything)
+			}
+		})
+
+		t.Run("Error missing version", func(t *testing.T) {
+			mockUserRepository := new(mocks.MockUserRepository)
+			mockAuditRepository := new(mocks.MockAuditRepository)
+			mockAuditRepository.On("Append", mock.Anything, mock.Anything).Return(nil)
+
+			userService := &UserService{
+				UserRepository:   mockUserRepository,
+				AuditRepository:  mockAuditRepository,
+				OutboxRepository: outbox(),
+				Transactor:       &mocks.MockTransactor{},
+			}
+
+			us, err := userService.Update(context.Background(), uuid.New().String(), &model.User{Name: faker.Name()}, 0)
+
+			assert.Nil(t, us)
+			assert.Error(t, err)
+			assert.Equal(t, rerrors.PreconditionRequired, err.(*rerrors.Error).Type)
+			mockUserRepository.AssertNotCalled(t, "Update", mock.Anything, mock.Anything)
+		})
+
+		t.Run("Error version mismatch", func(t *testing.T) {
+			uid := uuid.New()
+			user := &model.User{Name: faker.Name(), Email: faker.Email(), Cpf: "313.716.772-80", BirthDate: time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC)}
+
+			mockErrorResponse := rerrors.NewPreconditionFailed("user is at version 3, not 2")
+
+			mockUserRepository := new(mocks.MockUserRepository)
+			mockAuditRepository := new(mocks.MockAuditRepository)
+			mockAuditRepository.On("Append", mock.Anything, mock.Anything).Return(nil)
+			mockUserRepository.On("Lock", mock.Anything, uid).Return(&model.User{UID: uid}, nil)
+			mockUserRepository.On("Update", mock.Anything, user).Return(nil, mockErrorResponse)
+
+			userService := &UserService{
+				UserRepository:   mockUserRepository,
+				AuditRepository:  mockAuditRepository,
+				OutboxRepository: outbox(),
+				Transactor:       &mocks.MockTransactor{},
+			}
+
+			us, err := userService.Update(context.Background(), uid.String(), user, 2)
+
+			assert.Nil(t, us)
+			assert.Equal(t, mockErrorResponse, err)
+			assert.Equal(t, 2, user.Version)
+			mockUserRepository.AssertExpectations(t)
+		})
+
+		t.Run("Error unique violation email", func(t *testing.T) {
+			uid, _ := uuid.NewRandom()
+			user := &model.User{
+				UID:       uid,
+				Name:      faker.Name(),
+				Email:     faker.Email(),
+				Cpf:       "313.716.772-80",
+				BirthDate: time.Date(1990, 1, 1, 1, 1, 1, 0, time.UTC),
+			}
+
+			mockErrorResponse := rerrors.NewConflict("user", "updated", "unique_violation_email")
+
+			mockUserRepository := new(mocks.MockUserRepository)
+			mockAuditRepository := new(mocks.MockAuditRepository)
+			mockAuditRepository.On("Append", mock.Anything, mock.Anything).Return(nil)
+			mockUserRepository.On("Lock", mock.Anything, uid).Return(&model.User{UID: uid}, nil)
+			mockUserRepository.On("Update", mock.Anything, user).Return(nil, mockErrorResponse)
+
+			userService := &UserService{
+				UserRepository:   mockUserRepository,
+				AuditRepository:  mockAuditRepository,
+				OutboxRepository: outbox(),
+				Transactor:       &mocks.MockTransactor{},
+			}
+
+			ctx := context.Background()
+
+			us, err := userService.Update(ctx, uid.String(), user, 1)
+
+			mockUserRepository.AssertCalled(t, "Update", mock.Anything, user)
+			mockUserRepository.AssertNumberOfCalls(t, "Update", 1)
+
+			assert.Error(t, err)
+			assert.Equal(t, mockErrorResponse, err)
+			assert.Nil(t, us)
+
+			mockUserRepository.AssertExpectations(t)
+		})
+
+		t.Run("Error unique violation cpf", func(t *testing.T) {
+			uid, _ := uuid.NewRandom()
+			user := &model.User{
+				UID:       uid,
+				Name:      faker.Name(),
+				Email:     faker.Email(),
+				Cpf:       "313.716.772-80",
+				BirthDate: time.Date(1990, 1, 1, 1, 1, 1, 0, time.UTC),
+			}
+
+			mockErrorResponse := rerrors.NewConflict("user", "updated", "unique_violation_cpf")
+
+			mockUserRepository := new(mocks.MockUserRepository)
+			mockAuditRepository := new(mocks.MockAuditRepository)
+			mockAuditRepository.On("Append", mock.Anything, mock.Anything).Return(nil)
+			mockUserRepository.On("Lock", mock.Anything, uid).Return(&model.User{UID: uid}, nil)
+			mockUserRepository.On("Update", mock.Anything, user).Return(nil, mockErrorResponse)
+
+			userService := &UserService{
+				UserRepository:   mockUserRepository,
+				AuditRepository:  mockAuditRepository,
+				OutboxRepository: outbox(),
+				Transactor:       &mocks.MockTransactor{},
+			}
+
+			ctx := context.Background()
+
+			us, err := userService.Update(ctx, uid.String(), user, 1)
+
+			mockUserRepository.AssertCalled(t, "Update", mock.Anything, user)
+			mockUserRepository.AssertNumberOfCalls(t, "Update", 1)
+
+			assert.Error(t, err)
+			assert.Equal(t, mockErrorResponse, err)
+			assert.Nil(t, us)
+
+			mockUserRepository.AssertExpectations(t)
+		})
+
+		t.Run("Internal Server Error", func(t *testing.T) {
+			uid, _ := uuid.NewRandom()
+			user := &model.User{
+				UID:       uid,
+				Name:      faker.Name(),
+				Email:     faker.Email(),
+				Cpf:       "313.716.772-80",
+				BirthDate: time.Date(1990, 1, 1, 1, 1, 1, 0, time.UTC),
+			}
 
-			mockUserRepository.AssertCalled(t, "Update", mock.AnythingOfType("*context.emptyCtx"), user)
+			mockErrorResponse := rerrors.NewInternal()
+
+			mockUserRepository := new(mocks.MockUserRepository)
+			mockAuditRepository := new(mocks.MockAuditRepository)
+			mockAuditRepository.On("Append", mock.Anything, mock.Anything).Return(nil)
+			mockUserRepository.On("Lock", mock.Anything, uid).Return(&model.User{UID: uid}, nil)
+			mockUserRepository.On("Update", mock.Anything, user).Return(nil, mockErrorResponse)
+
+			userService := &UserService{
+				UserRepository:   mockUserRepository,
+				AuditRepository:  mockAuditRepository,
+				OutboxRepository: outbox(),
+				Transactor:       &mocks.MockTransactor{},
+			}
+
+			ctx := context.Background()
+
+			us, err := userService.Update(ctx, uid.String(), user, 1)
+
+			mockUserRepository.AssertCalled(t, "Update", mock.Anything, user)
 			mockUserRepository.AssertNumberOfCalls(t, "Update", 1)
 
 			assert.Error(t, err)
@@ -517,18 +1284,24 @@ func TestUserService(t *testing.T) {
 
 			mockErrorResponse := rerrors.NewNotFound("user", uid.String())
 			mockUserRepository := new(mocks.MockUserRepository)
-			mockUserRepository.On("Update", mock.AnythingOfType("*context.emptyCtx"), user).Return(nil, mockErrorResponse)
+			mockAuditRepository := new(mocks.MockAuditRepository)
+			mockAuditRepository.On("Append", mock.Anything, mock.Anything).Return(nil)
+			mockUserRepository.On("Lock", mock.Anything, uid).Return(&model.User{UID: uid}, nil)
+			mockUserRepository.On("Update", mock.Anything, user).Return(nil, mockErrorResponse)
 
 			userService := &UserService{
-				UserRepository: mockUserRepository,
+				UserRepository:   mockUserRepository,
+				AuditRepository:  mockAuditRepository,
+				OutboxRepository: outbox(),
+				Transactor:       &mocks.MockTransactor{},
 			}
 
 			ctx := context.Background()
 
-			us, err := userService.Update(ctx, uid.String(), user)
+			us, err := userService.Update(ctx, uid.String(), user, 1)
 
 			mockUserRepository.AssertNumberOfCalls(t, "Update", 1)
-			mockUserRepository.AssertCalled(t, "Update", mock.AnythingOfType("*context.emptyCtx"), user)
+			mockUserRepository.AssertCalled(t, "Update", mock.Anything, user)
 
 			assert.Error(t, err)
 			assert.Equal(t, mockErrorResponse, err)
@@ -548,14 +1321,19 @@ func TestUserService(t *testing.T) {
 			mockErrorResponse := rerrors.NewBadRequest("underage")
 
 			mockUserRepository := new(mocks.MockUserRepository)
+			mockAuditRepository := new(mocks.MockAuditRepository)
+			mockAuditRepository.On("Append", mock.Anything, mock.Anything).Return(nil)
 
 			userService := &UserService{
-				UserRepository: mockUserRepository,
+				UserRepository:   mockUserRepository,
+				AuditRepository:  mockAuditRepository,
+				OutboxRepository: outbox(),
+				Transactor:       &mocks.MockTransactor{},
 			}
 
 			ctx := context.Background()
 
-			us, err := userService.Update(ctx, uid.String(), user)
+			us, err := userService.Update(ctx, uid.String(), user, 1)
 
 			mockUserRepository.AssertNotCalled(t, "Update")
 
@@ -579,14 +1357,19 @@ func TestUserService(t *testing.T) {
 			mockErrorResponse := rerrors.NewBadRequest("cpf invalid")
 
 			mockUserRepository := new(mocks.MockUserRepository)
+			mockAuditRepository := new(mocks.MockAuditRepository)
+			mockAuditRepository.On("Append", mock.Anything, mock.Anything).Return(nil)
 
 			userService := &UserService{
-				UserRepository: mockUserRepository,
+				UserRepository:   mockUserRepository,
+				AuditRepository:  mockAuditRepository,
+				OutboxRepository: outbox(),
+				Transactor:       &mocks.MockTransactor{},
 			}
 
 			ctx := context.Background()
 
-			us, err := userService.Update(ctx, uid.String(), user)
+			us, err := userService.Update(ctx, uid.String(), user, 1)
 
 			mockUserRepository.AssertNotCalled(t, "Update")
 
@@ -610,14 +1393,19 @@ func TestUserService(t *testing.T) {
 			mockErrorResponse := rerrors.NewBadRequest("invalid e-mail")
 
 			mockUserRepository := new(mocks.MockUserRepository)
+			mockAuditRepository := new(mocks.MockAuditRepository)
+			mockAuditRepository.On("Append", mock.Anything, mock.Anything).Return(nil)
 
 			userService := &UserService{
-				UserRepository: mockUserRepository,
+				UserRepository:   mockUserRepository,
+				AuditRepository:  mockAuditRepository,
+				OutboxRepository: outbox(),
+				Transactor:       &mocks.MockTransactor{},
 			}
 
 			ctx := context.Background()
 
-			us, err := userService.Update(ctx, uid.String(), user)
+			us, err := userService.Update(ctx, uid.String(), user, 1)
 
 			mockUserRepository.AssertNotCalled(t, "Update")
 
@@ -629,74 +1417,942 @@ func TestUserService(t *testing.T) {
 		})
 	})
 
-	t.Run("Delete", func(t *testing.T) {
+	t.Run("Patch", func(t *testing.T) {
+		uid := uuid.New()
+
+		current := func() *model.User {
+			return &model.User{UID: uid, Name: "João", Email: "joao@mail.com", Cpf: "313.716.772-80", BirthDate: time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC), Version: 2}
+		}
+
+		mergePatch := func(body string) *model.UserPatch {
+			patch, err := model.ParseUserPatch(model.MergePatchMediaType, []byte(body))
+			assert.NoError(t, err)
+			return patch
+		}
+
 		t.Run("Success", func(t *testing.T) {
-			uid, _ := uuid.NewRandom()
+			patched := current()
+			patched.Email = "joao@acme.com.br"
+
+			updated := current()
+			updated.Email = "joao@acme.com.br"
+			updated.Version = 3
 
 			mockUserRepository := new(mocks.MockUserRepository)
-			mockUserRepository.On("Delete", mock.AnythingOfType("*context.emptyCtx"), uid.String()).Return(nil)
+			mockUserRepository.On("Lock", mock.Anything, uid).Return(current(), nil)
+			mockUserRepository.On("Update", mock.Anything, patched).Return(updated, nil)
+
+			mockAuditRepository := new(mocks.MockAuditRepository)
+			mockAuditRepository.On("Append", mock.Anything, mock.MatchedBy(func(e *model.AuditEntry) bool {
+				return e.Action == model.AuditUpdate && len(e.Changes) == 1 && *e.Changes["email"].After == "joao@acme.com.br"
+			})).Return(nil)
 
 			userService := &UserService{
-				UserRepository: mockUserRepository,
+				UserRepository:   mockUserRepository,
+				AuditRepository:  mockAuditRepository,
+				OutboxRepository: outbox(),
+				Transactor:       &mocks.MockTransactor{},
 			}
 
-			ctx := context.Background()
-
-			err := userService.Delete(ctx, uid.String())
-
-			mockUserRepository.AssertCalled(t, "Delete", mock.AnythingOfType("*context.emptyCtx"), uid.String())
-			mockUserRepository.AssertNumberOfCalls(t, "Delete", 1)
+			us, err := userService.Patch(context.Background(), uid.String(), mergePatch(`{"email": "joao@acme.com.br"}`), 2)
 
 			assert.NoError(t, err)
+			assert.Equal(t, updated, us)
 			mockUserRepository.AssertExpectations(t)
+			mockAuditRepository.AssertExpectations(t)
 		})
 
-		t.Run("Error not found", func(t *testing.T) {
-			uid, _ := uuid.NewRandom()
+		t.Run("Bad request patched user is invalid", func(t *testing.T) {
+			mockUserRepository := new(mocks.MockUserRepository)
+			mockUserRepository.On("Lock", mock.Anything, uid).Return(current(), nil)
 
-			mockErrorResponse := rerrors.NewNotFound("user", uid.String())
+			userService := &UserService{
+				UserRepository: mockUserRepository,
+				Transactor:     &mocks.MockTransactor{},
+			}
+
+			us, err := userService.Patch(context.Background(), uid.String(), mergePatch(`{"cpf": null}`), 2)
 
+			assert.Nil(t, us)
+			assert.Equal(t, rerrors.NewBadRequest("cpf invalid"), err)
+			mockUserRepository.AssertNotCalled(t, "Update", mock.Anything, mock.Anything)
+		})
+
+		t.Run("Error version mismatch", func(t *testing.T) {
 			mockUserRepository := new(mocks.MockUserRepository)
-			mockUserRepository.On("Delete", mock.AnythingOfType("*context.emptyCtx"), uid.String()).Return(mockErrorResponse)
+			mockUserRepository.On("Lock", mock.Anything, uid).Return(current(), nil)
 
 			userService := &UserService{
 				UserRepository: mockUserRepository,
+				Transactor:     &mocks.MockTransactor{},
 			}
 
-			ctx := context.Background()
+			us, err := userService.Patch(context.Background(), uid.String(), mergePatch(`{"name": "João Silva"}`), 1)
 
-			err := userService.Delete(ctx, uid.String())
+			assert.Nil(t, us)
+			assert.Equal(t, rerrors.NewPreconditionFailed("user is at version 2, not 1"), err)
+			mockUserRepository.AssertNotCalled(t, "Update", mock.Anything, mock.Anything)
+		})
 
-			mockUserRepository.AssertCalled(t, "Delete", mock.AnythingOfType("*context.emptyCtx"), uid.String())
-			mockUserRepository.AssertNumberOfCalls(t, "Delete", 1)
+		t.Run("Error missing version", func(t *testing.T) {
+			mockUserRepository := new(mocks.MockUserRepository)
 
-			assert.Error(t, err)
-			assert.Equal(t, mockErrorResponse, err)
-			mockUserRepository.AssertExpectations(t)
-		})
+			userService := &UserService{
+				UserRepository: mockUserRepository,
+				Transactor:     &mocks.MockTransactor{},
+			}
 
-		t.Run("Internal Server Error", func(t *testing.T) {
-			uid, _ := uuid.NewRandom()
+			us, err := userService.Patch(context.Background(), uid.String(), mergePatch(`{"name": "João Silva"}`), 0)
 
-			mockErrorResponse := rerrors.NewInternal()
+			assert.Nil(t, us)
+			assert.Equal(t, rerrors.PreconditionRequired, err.(*rerrors.Error).Type)
+			mockUserRepository.AssertNotCalled(t, "Lock", mock.Anything, mock.Anything)
+		})
+
+		t.Run("Error deleted user", func(t *testing.T) {
+			deleted := current()
+			deletedAt := time.Now()
+			deleted.DeletedAt = &deletedAt
 
 			mockUserRepository := new(mocks.MockUserRepository)
-			mockUserRepository.On("Delete", mock.AnythingOfType("*context.emptyCtx"), uid.String()).Return(mockErrorResponse)
+			mockUserRepository.On("Lock", mock.Anything, uid).Return(deleted, nil)
 
 			userService := &UserService{
 				UserRepository: mockUserRepository,
+				Transactor:     &mocks.MockTransactor{},
 			}
 
-			ctx := context.Background()
+			us, err := userService.Patch(context.Background(), uid.String(), mergePatch(`{"name": "João Silva"}`), 2)
 
-			err := userService.Delete(ctx, uid.String())
+			assert.Nil(t, us)
+			assert.Equal(t, rerrors.NewNotFound("user", uid.String()), err)
+		})
 
-			mockUserRepository.AssertCalled(t, "Delete", mock.AnythingOfType("*context.emptyCtx"), uid.String())
-			mockUserRepository.AssertNumberOfCalls(t, "Delete", 1)
+		t.Run("Error invalid id", func(t *testing.T) {
+			us, err := (&UserService{}).Patch(context.Background(), "invalid_id", mergePatch(`{}`), 1)
+
+			assert.Nil(t, us)
+			assert.Equal(t, rerrors.NewBadRequest("invalid id"), err)
+		})
+	})
+
+	t.Run("UpdateBatch", func(t *testing.T) {
+		birthdate := time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC)
+
+		user := func(uid uuid.UUID) *model.User {
+			return &model.User{UID: uid, Name: "João", Email: "joao@mail.com", Cpf: "313.716.772-80", BirthDate: birthdate, Version: 2}
+		}
+
+		renamed := func(uid uuid.UUID, version int) *model.User {
+			u := user(uid)
+			u.Name = "João Silva"
+			u.Version = version
+			return u
+		}
+
+		patch, err := model.ParseUserPatch(model.MergePatchMediaType, []byte(`{"name": "João Silva"}`))
+		assert.NoError(t, err)
+
+		t.Run("Success by ids", func(t *testing.T) {
+			uid, missing := uuid.New(), uuid.New()
+
+			mockUserRepository := new(mocks.MockUserRepository)
+			mockUserRepository.On("Lock", mock.Anything, uid).Return(user(uid), nil)
+			mockUserRepository.On("Lock", mock.Anything, missing).Return(nil, rerrors.NewNotFound("user", missing.String()))
+			mockUserRepository.On("Update", mock.Anything, renamed(uid, 2)).Return(renamed(uid, 3), nil)
+
+			mockAuditRepository := new(mocks.MockAuditRepository)
+			mockAuditRepository.On("Append", mock.Anything, mock.Anything).Return(nil)
+
+			userService := &UserService{
+				UserRepository:   mockUserRepository,
+				AuditRepository:  mockAuditRepository,
+				OutboxRepository: outbox(),
+				Transactor:       &mocks.MockTransactor{},
+			}
+
+			sel := model.BatchSelector{IDs: []string{uid.String(), "not-an-id", missing.String()}}
+
+			results, err := userService.UpdateBatch(context.Background(), sel, patch, false)
+
+			assert.NoError(t, err)
+			assert.False(t, results.DryRun)
+			assert.Equal(t, 1, results.Succeeded)
+			assert.Equal(t, 2, results.Failed)
+
+			assert.Equal(t, 200, results.Data[0].Status)
+			assert.Equal(t, uid, *results.Data[0].ID)
+			assert.Equal(t, "João Silva", *results.Data[0].Changes["name"].After)
+			assert.Len(t, results.Data[0].Changes, 1)
+
+			assert.Equal(t, 400, results.Data[1].Status)
+			assert.Equal(t, 404, results.Data[2].Status)
+
+			mockUserRepository.AssertExpectations(t)
+			mockAuditRepository.AssertNumberOfCalls(t, "Append", 1)
+		})
+
+		t.Run("Dry run writes nothing", func(t *testing.T) {
+			uid := uuid.New()
+
+			mockUserRepository := new(mocks.MockUserRepository)
+			mockUserRepository.On("Lock", mock.Anything, uid).Return(user(uid), nil)
+			mockUserRepository.On("FindTaken", mock.Anything, []string{user(uid).Email}, []string{user(uid).Cpf}).Return([]model.User{*user(uid)}, nil)
+
+			mockAuditRepository := new(mocks.MockAuditRepository)
+
+			userService := &UserService{
+				UserRepository:   mockUserRepository,
+				AuditRepository:  mockAuditRepository,
+				OutboxRepository: outbox(),
+				Transactor:       &mocks.MockTransactor{},
+			}
+
+			results, err := userService.UpdateBatch(context.Background(), model.BatchSelector{IDs: []string{uid.String()}}, patch, true)
+
+			assert.NoError(t, err)
+			assert.True(t, results.DryRun)
+			assert.Equal(t, 1, results.Succeeded)
+			assert.Equal(t, 200, results.Data[0].Status)
+			assert.Equal(t, "João Silva", *results.Data[0].Changes["name"].After)
+
+			mockUserRepository.AssertNotCalled(t, "Update", mock.Anything, mock.Anything)
+			mockAuditRepository.AssertNotCalled(t, "Append", mock.Anything, mock.Anything)
+		})
+
+		t.Run("Dry run reports conflicts", func(t *testing.T) {
+			uid := uuid.New()
+
+			other := user(uuid.New())
+			other.Cpf = "529.982.247-25"
+
+			mockUserRepository := new(mocks.MockUserRepository)
+			mockUserRepository.On("Lock", mock.Anything, uid).Return(user(uid), nil)
+			mockUserRepository.On("FindTaken", mock.Anything, mock.Anything, mock.Anything).Return([]model.User{*other}, nil)
+
+			userService := &UserService{
+				UserRepository:   mockUserRepository,
+				AuditRepository:  new(mocks.MockAuditRepository),
+				OutboxRepository: outbox(),
+				Transactor:       &mocks.MockTransactor{},
+			}
+
+			results, err := userService.UpdateBatch(context.Background(), model.BatchSelector{IDs: []string{uid.String()}}, patch, true)
+
+			assert.NoError(t, err)
+			assert.Equal(t, 1, results.Failed)
+			assert.Equal(t, 409, results.Data[0].Status)
+			mockUserRepository.AssertNotCalled(t, "Update", mock.Anything, mock.Anything)
+		})
+
+		t.Run("Success by filter", func(t *testing.T) {
+			first, second := uuid.New(), uuid.New()
+
+			mockUserRepository := new(mocks.MockUserRepository)
+			mockUserRepository.On("GetAll", mock.Anything, model.UserListParams{Filter: "email ends_with '@mail.com'", Limit: MaxPageSize}).
+				Return(&model.UserPage{Data: []model.User{*user(first)}, NextCursor: "next"}, nil)
+			mockUserRepository.On("GetAll", mock.Anything, model.UserListParams{Filter: "email ends_with '@mail.com'", Limit: MaxPageSize, Cursor: "next"}).
+				Return(&model.UserPage{Data: []model.User{*user(second)}}, nil)
+
+			for _, uid := range []uuid.UUID{first, second} {
+				mockUserRepository.On("Lock", mock.Anything, uid).Return(user(uid), nil)
+				mockUserRepository.On("Update", mock.Anything, renamed(uid, 2)).Return(renamed(uid, 3), nil)
+			}
+
+			mockAuditRepository := new(mocks.MockAuditRepository)
+			mockAuditRepository.On("Append", mock.Anything, mock.Anything).Return(nil)
+
+			userService := &UserService{
+				UserRepository:   mockUserRepository,
+				AuditRepository:  mockAuditRepository,
+				OutboxRepository: outbox(),
+				Transactor:       &mocks.MockTransactor{},
+			}
+
+			results, err := userService.UpdateBatch(context.Background(), model.BatchSelector{Filter: "email ends_with '@mail.com'"}, patch, false)
+
+			assert.NoError(t, err)
+			assert.Equal(t, 2, results.Succeeded)
+			assert.Equal(t, first, *results.Data[0].ID)
+			assert.Equal(t, second, *results.Data[1].ID)
+			mockUserRepository.AssertExpectations(t)
+		})
+
+		t.Run("Patched user is validated", func(t *testing.T) {
+			uid := uuid.New()
+
+			invalid, err := model.ParseUserPatch(model.MergePatchMediaType, []byte(`{"cpf": "111.111.111-11"}`))
+			assert.NoError(t, err)
+
+			mockUserRepository := new(mocks.MockUserRepository)
+			mockUserRepository.On("Lock", mock.Anything, uid).Return(user(uid), nil)
+
+			userService := &UserService{
+				UserRepository: mockUserRepository,
+				Transactor:     &mocks.MockTransactor{},
+			}
+
+			results, err := userService.UpdateBatch(context.Background(), model.BatchSelector{IDs: []string{uid.String()}}, invalid, false)
+
+			assert.NoError(t, err)
+			assert.Equal(t, 400, results.Data[0].Status)
+			mockUserRepository.AssertNotCalled(t, "Update", mock.Anything, mock.Anything)
+		})
+
+		t.Run("Deleted users are not found", func(t *testing.T) {
+			uid := uuid.New()
+			deleted := user(uid)
+			deleted.DeletedAt = &birthdate
+
+			mockUserRepository := new(mocks.MockUserRepository)
+			mockUserRepository.On("Lock", mock.Anything, uid).Return(deleted, nil)
+
+			userService := &UserService{
+				UserRepository: mockUserRepository,
+				Transactor:     &mocks.MockTransactor{},
+			}
+
+			results, err := userService.UpdateBatch(context.Background(), model.BatchSelector{IDs: []string{uid.String()}}, patch, false)
+
+			assert.NoError(t, err)
+			assert.Equal(t, 404, results.Data[0].Status)
+		})
+
+		t.Run("Bad request selector", func(t *testing.T) {
+			userService := &UserService{}
+
+			for _, sel := range []model.BatchSelector{
+				{},
+				{IDs: []string{uuid.New().String()}, Filter: "name = 'João'"},
+				{IDs: make([]string, MaxBatchSize+1)},
+			} {
+				results, err := userService.UpdateBatch(context.Background(), sel, patch, false)
+
+				assert.Nil(t, results)
+				assert.Equal(t, 400, rerrors.Status(err))
+			}
+		})
+
+		t.Run("Bad request filter matches too many users", func(t *testing.T) {
+			mockUserRepository := new(mocks.MockUserRepository)
+			mockUserRepository.On("GetAll", mock.Anything, mock.Anything).
+				Return(&model.UserPage{Data: make([]model.User, MaxPageSize), NextCursor: "next"}, nil)
+
+			userService := &UserService{UserRepository: mockUserRepository}
+
+			results, err := userService.UpdateBatch(context.Background(), model.BatchSelector{Filter: "name != ''"}, patch, false)
+
+			assert.Nil(t, results)
+			assert.Equal(t, 400, rerrors.Status(err))
+			mockUserRepository.AssertNumberOfCalls(t, "GetAll", 2)
+		})
+
+		t.Run("Error invalid filter", func(t *testing.T) {
+			mockUserRepository := new(mocks.MockUserRepository)
+			mockUserRepository.On("GetAll", mock.Anything, mock.Anything).Return(nil, rerrors.NewBadRequest("unknown field age"))
+
+			userService := &UserService{UserRepository: mockUserRepository}
+
+			results, err := userService.UpdateBatch(context.Background(), model.BatchSelector{Filter: "age > 18"}, patch, false)
+
+			assert.Nil(t, results)
+			assert.Equal(t, 400, rerrors.Status(err))
+		})
+	})
+
+	t.Run("DeleteBatch", func(t *testing.T) {
+		deletedAt := time.Date(2022, 5, 1, 10, 0, 0, 0, time.UTC)
+
+		t.Run("Success", func(t *testing.T) {
+			uid, missing := uuid.New(), uuid.New()
+
+			mockUserRepository := new(mocks.MockUserRepository)
+			mockUserRepository.On("Lock", mock.Anything, uid).Return(&model.User{UID: uid}, nil)
+			mockUserRepository.On("Lock", mock.Anything, missing).Return(&model.User{UID: missing}, nil)
+			mockUserRepository.On("Delete", mock.Anything, uid.String()).Return(nil)
+			mockUserRepository.On("Delete", mock.Anything, missing.String()).Return(rerrors.NewNotFound("user", missing.String()))
+			mockUserRepository.On("GetByID", mock.Anything, uid, true).Return(&model.User{UID: uid, DeletedAt: &deletedAt}, nil)
+
+			mockAuditRepository := new(mocks.MockAuditRepository)
+			mockAuditRepository.On("Append", mock.Anything, mock.Anything).Return(nil)
+
+			userService := &UserService{
+				UserRepository:   mockUserRepository,
+				AuditRepository:  mockAuditRepository,
+				OutboxRepository: outbox(),
+				Transactor:       &mocks.MockTransactor{},
+			}
+
+			results, err := userService.DeleteBatch(context.Background(), model.BatchSelector{IDs: []string{uid.String(), missing.String()}}, false)
+
+			assert.NoError(t, err)
+			assert.Equal(t, 1, results.Succeeded)
+			assert.Equal(t, 1, results.Failed)
+
+			assert.Equal(t, 204, results.Data[0].Status)
+			assert.Equal(t, "2022-05-01T10:00:00Z", *results.Data[0].Changes["deleted_at"].After)
+			assert.Equal(t, 404, results.Data[1].Status)
+
+			mockUserRepository.AssertExpectations(t)
+			mockAuditRepository.AssertNumberOfCalls(t, "Append", 1)
+		})
+
+		t.Run("Dry run writes nothing", func(t *testing.T) {
+			uid := uuid.New()
+
+			mockUserRepository := new(mocks.MockUserRepository)
+			mockUserRepository.On("Lock", mock.Anything, uid).Return(&model.User{UID: uid}, nil)
+
+			mockAuditRepository := new(mocks.MockAuditRepository)
+
+			userService := &UserService{
+				UserRepository:   mockUserRepository,
+				AuditRepository:  mockAuditRepository,
+				OutboxRepository: outbox(),
+				Transactor:       &mocks.MockTransactor{},
+			}
+
+			results, err := userService.DeleteBatch(context.Background(), model.BatchSelector{IDs: []string{uid.String()}}, true)
+
+			assert.NoError(t, err)
+			assert.True(t, results.DryRun)
+			assert.Equal(t, 204, results.Data[0].Status)
+			assert.NotNil(t, results.Data[0].Changes["deleted_at"].After)
+			mockUserRepository.AssertNotCalled(t, "Delete", mock.Anything, mock.Anything)
+			mockAuditRepository.AssertNotCalled(t, "Append", mock.Anything, mock.Anything)
+		})
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		t.Run("Success", func(t *testing.T) {
+			uid, _ := uuid.NewRandom()
+
+			mockUserRepository := new(mocks.MockUserRepository)
+			mockAuditRepository := new(mocks.MockAuditRepository)
+			mockAuditRepository.On("Append", mock.Anything, mock.Anything).Return(nil)
+			mockUserRepository.On("Lock", mock.Anything, uid).Return(&model.User{UID: uid}, nil)
+			mockUserRepository.On("Delete", mock.Anything, uid.String()).Return(nil)
+			mockUserRepository.On("GetByID", mock.Anything, uid, true).Return(&model.User{UID: uid}, nil)
+
+			userService := &UserService{
+				UserRepository:   mockUserRepository,
+				AuditRepository:  mockAuditRepository,
+				OutboxRepository: outbox(),
+				Transactor:       &mocks.MockTransactor{},
+			}
+
+			ctx := context.Background()
+
+			err := userService.Delete(ctx, uid.String())
+
+			mockUserRepository.AssertCalled(t, "Delete", mock.Anything, uid.String())
+			mockUserRepository.AssertNumberOfCalls(t, "Delete", 1)
+
+			assert.NoError(t, err)
+			mockUserRepository.AssertExpectations(t)
+		})
+
+		t.Run("Error not found", func(t *testing.T) {
+			uid, _ := uuid.NewRandom()
+
+			mockErrorResponse := rerrors.NewNotFound("user", uid.String())
+
+			mockUserRepository := new(mocks.MockUserRepository)
+			mockAuditRepository := new(mocks.MockAuditRepository)
+			mockAuditRepository.On("Append", mock.Anything, mock.Anything).Return(nil)
+			mockUserRepository.On("Lock", mock.Anything, uid).Return(&model.User{UID: uid}, nil)
+			mockUserRepository.On("Delete", mock.Anything, uid.String()).Return(mockErrorResponse)
+
+			userService := &UserService{
+				UserRepository:   mockUserRepository,
+				AuditRepository:  mockAuditRepository,
+				OutboxRepository: outbox(),
+				Transactor:       &mocks.MockTransactor{},
+			}
+
+			ctx := context.Background()
+
+			err := userService.Delete(ctx, uid.String())
+
+			mockUserRepository.AssertCalled(t, "Delete", mock.Anything, uid.String())
+			mockUserRepository.AssertNumberOfCalls(t, "Delete", 1)
+
+			assert.Error(t, err)
+			assert.Equal(t, mockErrorResponse, err)
+			mockUserRepository.AssertExpectations(t)
+		})
+
+		t.Run("Internal Server Error", func(t *testing.T) {
+			uid, _ := uuid.NewRandom()
+
+			mockErrorResponse := rerrors.NewInternal()
+
+			mockUserRepository := new(mocks.MockUserRepository)
+			mockAuditRepository := new(mocks.MockAuditRepository)
+			mockAuditRepository.On("Append", mock.Anything, mock.Anything).Return(nil)
+			mockUserRepository.On("Lock", mock.Anything, uid).Return(&model.User{UID: uid}, nil)
+			mockUserRepository.On("Delete", mock.Anything, uid.String()).Return(mockErrorResponse)
+
+			userService := &UserService{
+				UserRepository:   mockUserRepository,
+				AuditRepository:  mockAuditRepository,
+				OutboxRepository: outbox(),
+				Transactor:       &mocks.MockTransactor{},
+			}
+
+			ctx := context.Background()
+
+			err := userService.Delete(ctx, uid.String())
+
+			mockUserRepository.AssertCalled(t, "Delete", mock.Anything, uid.String())
+			mockUserRepository.AssertNumberOfCalls(t, "Delete", 1)
 
 			assert.Error(t, err)
 			assert.Equal(t, mockErrorResponse, err)
 			mockUserRepository.AssertExpectations(t)
 		})
 	})
+
+	t.Run("Delete invalid id", func(t *testing.T) {
+		mockUserRepository := new(mocks.MockUserRepository)
+		mockAuditRepository := new(mocks.MockAuditRepository)
+		mockAuditRepository.On("Append", mock.Anything, mock.Anything).Return(nil)
+
+		userService := &UserService{
+			UserRepository:   mockUserRepository,
+			AuditRepository:  mockAuditRepository,
+			OutboxRepository: outbox(),
+			Transactor:       &mocks.MockTransactor{},
+		}
+
+		err := userService.Delete(context.Background(), "invalid_id")
+
+		assert.Equal(t, rerrors.NewBadRequest("invalid id"), err)
+		mockUserRepository.AssertNotCalled(t, "Delete", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Restore", func(t *testing.T) {
+		t.Run("Success", func(t *testing.T) {
+			uid := uuid.New()
+			user := &model.User{UID: uid, Name: faker.Name()}
+
+			mockUserRepository := new(mocks.MockUserRepository)
+			mockAuditRepository := new(mocks.MockAuditRepository)
+			mockAuditRepository.On("Append", mock.Anything, mock.Anything).Return(nil)
+			mockUserRepository.On("Lock", mock.Anything, uid).Return(&model.User{UID: uid}, nil)
+			mockUserRepository.On("Restore", mock.Anything, uid.String()).Return(user, nil)
+
+			userService := &UserService{
+				UserRepository:   mockUserRepository,
+				AuditRepository:  mockAuditRepository,
+				OutboxRepository: outbox(),
+				Transactor:       &mocks.MockTransactor{},
+			}
+
+			us, err := userService.Restore(context.Background(), uid.String())
+
+			assert.NoError(t, err)
+			assert.Equal(t, user, us)
+			mockUserRepository.AssertExpectations(t)
+		})
+
+		t.Run("Error invalid id", func(t *testing.T) {
+			mockUserRepository := new(mocks.MockUserRepository)
+			mockAuditRepository := new(mocks.MockAuditRepository)
+			mockAuditRepository.On("Append", mock.Anything, mock.Anything).Return(nil)
+
+			userService := &UserService{
+				UserRepository:   mockUserRepository,
+				AuditRepository:  mockAuditRepository,
+				OutboxRepository: outbox(),
+				Transactor:       &mocks.MockTransactor{},
+			}
+
+			us, err := userService.Restore(context.Background(), "invalid_id")
+
+			assert.Nil(t, us)
+			assert.Equal(t, rerrors.NewBadRequest("invalid id"), err)
+			mockUserRepository.AssertNotCalled(t, "Restore", mock.Anything, mock.Anything)
+		})
+	})
+
+	t.Run("Purge", func(t *testing.T) {
+		t.Run("Success", func(t *testing.T) {
+			uid := uuid.New()
+
+			mockUserRepository := new(mocks.MockUserRepository)
+			mockAuditRepository := new(mocks.MockAuditRepository)
+			mockAuditRepository.On("Append", mock.Anything, mock.Anything).Return(nil)
+			mockUserRepository.On("Lock", mock.Anything, uid).Return(&model.User{UID: uid}, nil)
+			mockUserRepository.On("Purge", mock.Anything, uid.String()).Return(nil)
+
+			userService := &UserService{
+				UserRepository:   mockUserRepository,
+				AuditRepository:  mockAuditRepository,
+				OutboxRepository: outbox(),
+				Transactor:       &mocks.MockTransactor{},
+			}
+
+			err := userService.Purge(context.Background(), uid.String())
+
+			assert.NoError(t, err)
+			mockUserRepository.AssertExpectations(t)
+		})
+
+		t.Run("Error invalid id", func(t *testing.T) {
+			mockUserRepository := new(mocks.MockUserRepository)
+			mockAuditRepository := new(mocks.MockAuditRepository)
+			mockAuditRepository.On("Append", mock.Anything, mock.Anything).Return(nil)
+
+			userService := &UserService{
+				UserRepository:   mockUserRepository,
+				AuditRepository:  mockAuditRepository,
+				OutboxRepository: outbox(),
+				Transactor:       &mocks.MockTransactor{},
+			}
+
+			err := userService.Purge(context.Background(), "invalid_id")
+
+			assert.Equal(t, rerrors.NewBadRequest("invalid id"), err)
+			mockUserRepository.AssertNotCalled(t, "Purge", mock.Anything, mock.Anything)
+		})
+	})
+
+	t.Run("Audit", func(t *testing.T) {
+		birthdate := time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC)
+
+		text := func(s string) *string { return &s }
+
+		t.Run("Create records actor, request and every field", func(t *testing.T) {
+			uid := uuid.New()
+			user := &model.User{Name: "João", Email: "joao@mail.com", Cpf: "313.716.772-80", BirthDate: birthdate}
+			created := &model.User{UID: uid, Name: user.Name, Email: user.Email, Cpf: user.Cpf, BirthDate: birthdate, Version: 1}
+
+			mockUserRepository := new(mocks.MockUserRepository)
+			mockUserRepository.On("Create", mock.Anything, user).Return(created, nil)
+
+			var entry *model.AuditEntry
+
+			mockAuditRepository := new(mocks.MockAuditRepository)
+			mockAuditRepository.On("Append", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+				entry = args.Get(1).(*model.AuditEntry)
+			}).Return(nil)
+
+			userService := &UserService{
+				UserRepository:   mockUserRepository,
+				AuditRepository:  mockAuditRepository,
+				OutboxRepository: outbox(),
+				Transactor:       &mocks.MockTransactor{},
+			}
+
+			ctx := utils.WithRequestID(utils.WithActor(context.Background(), "maria"), "req-1")
+
+			us, err := userService.Create(ctx, user)
+
+			assert.NoError(t, err)
+			assert.Equal(t, created, us)
+			assert.Equal(t, uid, entry.UserID)
+			assert.Equal(t, "maria", entry.Actor)
+			assert.Equal(t, "req-1", entry.RequestID)
+			assert.Equal(t, model.AuditCreate, entry.Action)
+			assert.Equal(t, model.AuditChanges{
+				"name":      {After: text("João")},
+				"email":     {After: text("joao@mail.com")},
+				"cpf":       {After: text("313.716.772-80")},
+				"birthdate": {After: text("1990-01-01")},
+			}, entry.Changes)
+			assert.False(t, entry.CreatedAt.IsZero())
+		})
+
+		t.Run("Update records changed fields only", func(t *testing.T) {
+			uid := uuid.New()
+			before := &model.User{UID: uid, Name: "João", Email: "joao@mail.com", Cpf: "313.716.772-80", BirthDate: birthdate, Version: 1}
+			after := &model.User{UID: uid, Name: "João", Email: "joao@acme.com.br", Cpf: "313.716.772-80", BirthDate: birthdate, Version: 2}
+			params := &model.User{Name: "João", Email: "joao@acme.com.br", Cpf: "313.716.772-80", BirthDate: birthdate}
+
+			mockUserRepository := new(mocks.MockUserRepository)
+			mockUserRepository.On("Lock", mock.Anything, uid).Return(before, nil)
+			mockUserRepository.On("Update", mock.Anything, params).Return(after, nil)
+
+			mockAuditRepository := new(mocks.MockAuditRepository)
+			mockAuditRepository.On("Append", mock.Anything, mock.MatchedBy(func(e *model.AuditEntry) bool {
+				return e.Action == model.AuditUpdate && e.Actor == "system" && assert.ObjectsAreEqual(model.AuditChanges{
+					"email": {Before: text("joao@mail.com"), After: text("joao@acme.com.br")},
+				}, e.Changes)
+			})).Return(nil)
+
+			userService := &UserService{
+				UserRepository:   mockUserRepository,
+				AuditRepository:  mockAuditRepository,
+				OutboxRepository: outbox(),
+				Transactor:       &mocks.MockTransactor{},
+			}
+
+			us, err := userService.Update(context.Background(), uid.String(), params, 1)
+
+			assert.NoError(t, err)
+			assert.Equal(t, after, us)
+			mockUserRepository.AssertExpectations(t)
+			mockAuditRepository.AssertExpectations(t)
+		})
+
+		t.Run("Delete records the deletion date", func(t *testing.T) {
+			uid := uuid.New()
+			deletedAt := time.Date(2022, 5, 1, 10, 0, 0, 0, time.UTC)
+			before := &model.User{UID: uid, Name: "João", BirthDate: birthdate}
+			after := &model.User{UID: uid, Name: "João", BirthDate: birthdate, DeletedAt: &deletedAt}
+
+			mockUserRepository := new(mocks.MockUserRepository)
+			mockUserRepository.On("Lock", mock.Anything, uid).Return(before, nil)
+			mockUserRepository.On("Delete", mock.Anything, uid.String()).Return(nil)
+			mockUserRepository.On("GetByID", mock.Anything, uid, true).Return(after, nil)
+
+			mockAuditRepository := new(mocks.MockAuditRepository)
+			mockAuditRepository.On("Append", mock.Anything, mock.MatchedBy(func(e *model.AuditEntry) bool {
+				return e.Action == model.AuditDelete && assert.ObjectsAreEqual(model.AuditChanges{
+					"deleted_at": {After: text("2022-05-01T10:00:00Z")},
+				}, e.Changes)
+			})).Return(nil)
+
+			userService := &UserService{
+				UserRepository:   mockUserRepository,
+				AuditRepository:  mockAuditRepository,
+				OutboxRepository: outbox(),
+				Transactor:       &mocks.MockTransactor{},
+			}
+
+			err := userService.Delete(context.Background(), uid.String())
+
+			assert.NoError(t, err)
+			mockAuditRepository.AssertExpectations(t)
+		})
+
+		t.Run("Purge records every field as removed", func(t *testing.T) {
+			uid := uuid.New()
+			before := &model.User{UID: uid, Name: "João", Email: "joao@mail.com", Cpf: "313.716.772-80", BirthDate: birthdate}
+
+			mockUserRepository := new(mocks.MockUserRepository)
+			mockUserRepository.On("Lock", mock.Anything, uid).Return(before, nil)
+			mockUserRepository.On("Purge", mock.Anything, uid.String()).Return(nil)
+
+			mockAuditRepository := new(mocks.MockAuditRepository)
+			mockAuditRepository.On("Append", mock.Anything, mock.MatchedBy(func(e *model.AuditEntry) bool {
+				return e.Action == model.AuditPurge && e.UserID == uid && len(e.Changes) == 4 && e.Changes["cpf"].After == nil
+			})).Return(nil)
+
+			userService := &UserService{
+				UserRepository:   mockUserRepository,
+				AuditRepository:  mockAuditRepository,
+				OutboxRepository: outbox(),
+				Transactor:       &mocks.MockTransactor{},
+			}
+
+			err := userService.Purge(context.Background(), uid.String())
+
+			assert.NoError(t, err)
+			mockAuditRepository.AssertExpectations(t)
+		})
+
+		t.Run("Change fails when it can't be audited", func(t *testing.T) {
+			user := &model.User{Name: "João", Email: "joao@mail.com", Cpf: "313.716.772-80", BirthDate: birthdate}
+
+			mockUserRepository := new(mocks.MockUserRepository)
+			mockUserRepository.On("Create", mock.Anything, user).Return(&model.User{UID: uuid.New()}, nil)
+
+			mockAuditRepository := new(mocks.MockAuditRepository)
+			mockAuditRepository.On("Append", mock.Anything, mock.Anything).Return(rerrors.NewInternal())
+
+			userService := &UserService{
+				UserRepository:   mockUserRepository,
+				AuditRepository:  mockAuditRepository,
+				OutboxRepository: outbox(),
+				Transactor:       &mocks.MockTransactor{},
+			}
+
+			us, err := userService.Create(context.Background(), user)
+
+			assert.Nil(t, us)
+			assert.Equal(t, rerrors.NewInternal(), err)
+		})
+
+		t.Run("Missing user is not audited", func(t *testing.T) {
+			uid := uuid.New()
+
+			mockUserRepository := new(mocks.MockUserRepository)
+			mockUserRepository.On("Lock", mock.Anything, uid).Return(nil, rerrors.NewNotFound("user", uid.String()))
+
+			mockAuditRepository := new(mocks.MockAuditRepository)
+
+			userService := &UserService{
+				UserRepository:   mockUserRepository,
+				AuditRepository:  mockAuditRepository,
+				OutboxRepository: outbox(),
+				Transactor:       &mocks.MockTransactor{},
+			}
+
+			err := userService.Delete(context.Background(), uid.String())
+
+			assert.Equal(t, rerrors.NewNotFound("user", uid.String()), err)
+			mockUserRepository.AssertNotCalled(t, "Delete", mock.Anything, mock.Anything)
+			mockAuditRepository.AssertNotCalled(t, "Append", mock.Anything, mock.Anything)
+		})
+	})
+
+	t.Run("Events", func(t *testing.T) {
+		birthdate := time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC)
+		deletedAt := time.Date(2022, 5, 1, 10, 0, 0, 0, time.UTC)
+
+		// newService returns a service appending the events to *events
+		newService := func(users *mocks.MockUserRepository, events *[]*model.Event) *UserService {
+			mockAuditRepository := new(mocks.MockAuditRepository)
+			mockAuditRepository.On("Append", mock.Anything, mock.Anything).Return(nil)
+
+			mockOutboxRepository := new(mocks.MockOutboxRepository)
+			mockOutboxRepository.On("Append", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+				*events = append(*events, args.Get(1).([]*model.Event)...)
+			}).Return(nil)
+
+			return &UserService{
+				UserRepository:   users,
+				AuditRepository:  mockAuditRepository,
+				OutboxRepository: mockOutboxRepository,
+				Transactor:       &mocks.MockTransactor{},
+			}
+		}
+
+		t.Run("Create announces the created user", func(t *testing.T) {
+			user := &model.User{Name: "João", Email: "joao@mail.com", Cpf: "313.716.772-80", BirthDate: birthdate}
+			created := &model.User{UID: uuid.New(), Name: user.Name, Email: user.Email, Cpf: user.Cpf, BirthDate: birthdate, Version: 1}
+
+			mockUserRepository := new(mocks.MockUserRepository)
+			mockUserRepository.On("Create", mock.Anything, user).Return(created, nil)
+
+			var events []*model.Event
+
+			_, err := newService(mockUserRepository, &events).Create(context.Background(), user)
+
+			assert.NoError(t, err)
+			assert.Len(t, events, 1)
+			assert.Equal(t, model.EventUserCreated, events[0].Type)
+			assert.Equal(t, created.UID, events[0].UserID)
+			assert.Equal(t, model.EventUser(*created), events[0].User)
+			assert.NotEqual(t, uuid.Nil, events[0].ID)
+		})
+
+		t.Run("Restore announces an update", func(t *testing.T) {
+			uid := uuid.New()
+			before := &model.User{UID: uid, Name: "João", BirthDate: birthdate, DeletedAt: &deletedAt, Version: 2}
+			restored := &model.User{UID: uid, Name: "João", BirthDate: birthdate, Version: 3}
+
+			mockUserRepository := new(mocks.MockUserRepository)
+			mockUserRepository.On("Lock", mock.Anything, uid).Return(before, nil)
+			mockUserRepository.On("Restore", mock.Anything, uid.String()).Return(restored, nil)
+
+			var events []*model.Event
+
+			_, err := newService(mockUserRepository, &events).Restore(context.Background(), uid.String())
+
+			assert.NoError(t, err)
+			assert.Len(t, events, 1)
+			assert.Equal(t, model.EventUserUpdated, events[0].Type)
+			assert.Equal(t, model.EventUser(*restored), events[0].User)
+		})
+
+		t.Run("Delete announces the deleted user", func(t *testing.T) {
+			uid := uuid.New()
+			before := &model.User{UID: uid, Name: "João", BirthDate: birthdate}
+			after := &model.User{UID: uid, Name: "João", BirthDate: birthdate, DeletedAt: &deletedAt}
+
+			mockUserRepository := new(mocks.MockUserRepository)
+			mockUserRepository.On("Lock", mock.Anything, uid).Return(before, nil)
+			mockUserRepository.On("Delete", mock.Anything, uid.String()).Return(nil)
+			mockUserRepository.On("GetByID", mock.Anything, uid, true).Return(after, nil)
+
+			var events []*model.Event
+
+			err := newService(mockUserRepository, &events).Delete(context.Background(), uid.String())
+
+			assert.NoError(t, err)
+			assert.Len(t, events, 1)
+			assert.Equal(t, model.EventUserDeleted, events[0].Type)
+			assert.Equal(t, model.EventUser(*after), events[0].User)
+		})
+
+		t.Run("Purge announces users that weren't deleted yet", func(t *testing.T) {
+			uid := uuid.New()
+			before := &model.User{UID: uid, Name: "João", BirthDate: birthdate}
+
+			mockUserRepository := new(mocks.MockUserRepository)
+			mockUserRepository.On("Lock", mock.Anything, uid).Return(before, nil)
+			mockUserRepository.On("Purge", mock.Anything, uid.String()).Return(nil)
+
+			var events []*model.Event
+
+			err := newService(mockUserRepository, &events).Purge(context.Background(), uid.String())
+
+			assert.NoError(t, err)
+			assert.Len(t, events, 1)
+			assert.Equal(t, model.EventUserDeleted, events[0].Type)
+			assert.Equal(t, model.EventUser(*before), events[0].User)
+
+			// the deletion was announced already
+			uid = uuid.New()
+			before = &model.User{UID: uid, Name: "João", BirthDate: birthdate, DeletedAt: &deletedAt}
+
+			mockUserRepository.On("Lock", mock.Anything, uid).Return(before, nil)
+			mockUserRepository.On("Purge", mock.Anything, uid.String()).Return(nil)
+
+			events = nil
+
+			err = newService(mockUserRepository, &events).Purge(context.Background(), uid.String())
+
+			assert.NoError(t, err)
+			assert.Empty(t, events)
+		})
+
+		t.Run("Change fails when it can't be announced", func(t *testing.T) {
+			user := &model.User{Name: "João", Email: "joao@mail.com", Cpf: "313.716.772-80", BirthDate: birthdate}
+
+			mockUserRepository := new(mocks.MockUserRepository)
+			mockUserRepository.On("Create", mock.Anything, user).Return(&model.User{UID: uuid.New()}, nil)
+
+			mockAuditRepository := new(mocks.MockAuditRepository)
+			mockAuditRepository.On("Append", mock.Anything, mock.Anything).Return(nil)
+
+			mockOutboxRepository := new(mocks.MockOutboxRepository)
+			mockOutboxRepository.On("Append", mock.Anything, mock.Anything).Return(rerrors.NewInternal())
+
+			userService := &UserService{
+				UserRepository:   mockUserRepository,
+				AuditRepository:  mockAuditRepository,
+				OutboxRepository: mockOutboxRepository,
+				Transactor:       &mocks.MockTransactor{},
+			}
+
+			us, err := userService.Create(context.Background(), user)
+
+			assert.Nil(t, us)
+			assert.Equal(t, rerrors.NewInternal(), err)
+		})
+	})
+}
+
+// retriedTransactor runs fn again when it fails, as Transactor does after a
+// deadlock, and then fails to commit with commitErr
+type retriedTransactor struct {
+	mocks.MockTransactor
+
+	commitErr error
+}
+
+func (tr *retriedTransactor) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if err := fn(ctx); err == nil {
+		return nil
+	}
+
+	if err := fn(ctx); err != nil {
+		return err
+	}
+
+	return tr.commitErr
 }
@@ -0,0 +1,384 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+	model "github.com/klasrak/users-api/models"
+	"github.com/klasrak/users-api/rerrors"
+)
+
+// Defaults of the settings of a WebhookDeliverer
+const (
+	DefaultWebhookPollInterval = time.Second
+	DefaultWebhookBatchSize    = 100
+	DefaultWebhookTimeout      = 10 * time.Second
+	DefaultWebhookMaxAttempts  = 8
+	DefaultWebhookMinBackoff   = 10 * time.Second
+	DefaultWebhookMaxBackoff   = time.Hour
+	DefaultWebhookMaxFailures  = 20
+)
+
+// Headers sent along with every delivery
+const (
+	WebhookEventHeader     = "X-Webhook-Event"
+	WebhookDeliveryHeader  = "X-Webhook-Delivery"
+	WebhookSignatureHeader = "X-Webhook-Signature"
+)
+
+// webhookClaimMargin is how much longer than the timeout of a request a
+// delivery is claimed for, so that no one else attempts it meanwhile
+const webhookClaimMargin = 30 * time.Second
+
+// webhookResponseLimit bounds how much of a response is read, to reuse the
+// connection
+const webhookResponseLimit = 64 << 10
+
+// WebhookPublisher is an EventPublisher handing events over to the active
+// webhooks subscribed to them, enqueueing a delivery for each of them,
+// which a WebhookDeliverer attempts. Events published again are not
+// delivered twice to the same webhook
+type WebhookPublisher struct {
+	WebhookRepository  WebhookRepository
+	DeliveryRepository WebhookDeliveryRepository
+	Transactor         Transactor
+}
+
+// Publish enqueues the deliveries of e, all of them or none
+func (p *WebhookPublisher) Publish(ctx context.Context, e *model.Event) error {
+	webhooks, err := p.WebhookRepository.List(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	var payload []byte
+
+	var deliveries []*model.WebhookDelivery
+
+	now := time.Now().UTC().Truncate(time.Microsecond)
+
+	for _, w := range webhooks {
+		if !w.Active || !w.Subscribes(e.Type) {
+			continue
+		}
+
+		if payload == nil {
+			if payload, err = json.Marshal(e); err != nil {
+				return err
+			}
+		}
+
+		deliveries = append(deliveries, &model.WebhookDelivery{
+			ID:            uuid.New(),
+			WebhookID:     w.ID,
+			EventID:       e.ID,
+			EventType:     e.Type,
+			Payload:       payload,
+			Status:        model.DeliveryPending,
+			NextAttemptAt: now,
+			CreatedAt:     now,
+		})
+	}
+
+	if len(deliveries) == 0 {
+		return nil
+	}
+
+	return p.Transactor.WithinTx(ctx, func(ctx context.Context) error {
+		return p.DeliveryRepository.Enqueue(ctx, deliveries)
+	})
+}
+
+// WebhookDeliverer attempts the pending deliveries every PollInterval,
+// POSTing their payload to their webhook, signed with its secret (see
+// WebhookSignature). Endpoints must answer with a 2xx status within the
+// timeout of Client, or the delivery is attempted again after a backoff
+// growing from MinBackoff up to MaxBackoff, up to MaxAttempts times.
+//
+// Webhooks are disabled once MaxFailures attempts to deliver to them failed
+// in a row, and their pending deliveries wait until they are enabled again.
+// Every instance of the API runs a deliverer; each delivery is claimed by
+// the one attempting it.
+//
+// Unless AllowPrivateNetworks is set, deliveries to loopback, link-local or
+// private addresses fail, so webhooks can't reach the services next to the
+// API, like the metadata endpoint of a cloud provider. Addresses are checked
+// when connecting, as names may resolve to other ones by then
+type WebhookDeliverer struct {
+	WebhookRepository  WebhookRepository
+	DeliveryRepository WebhookDeliveryRepository
+	Client             *http.Client
+	PollInterval       time.Duration
+	BatchSize          int
+	MaxAttempts        int
+	MinBackoff         time.Duration
+	MaxBackoff         time.Duration
+	MaxFailures        int
+
+	AllowPrivateNetworks bool
+}
+
+// NewWebhookDeliverer creates a WebhookDeliverer with the default settings.
+// Its client doesn't follow redirects, which count as failures, nor goes
+// through proxies, whose address would be checked instead of the endpoint's
+func NewWebhookDeliverer(webhooks WebhookRepository, deliveries WebhookDeliveryRepository) *WebhookDeliverer {
+	d := &WebhookDeliverer{
+		WebhookRepository:  webhooks,
+		DeliveryRepository: deliveries,
+		PollInterval:       DefaultWebhookPollInterval,
+		BatchSize:          DefaultWebhookBatchSize,
+		MaxAttempts:        DefaultWebhookMaxAttempts,
+		MinBackoff:         DefaultWebhookMinBackoff,
+		MaxBackoff:         DefaultWebhookMaxBackoff,
+		MaxFailures:        DefaultWebhookMaxFailures,
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control: func(network, address string, c syscall.RawConn) error {
+			if d.AllowPrivateNetworks {
+				return nil
+			}
+
+			return checkPublic(address)
+		},
+	}
+
+	d.Client = &http.Client{
+		Timeout: DefaultWebhookTimeout,
+		Transport: &http.Transport{
+			DialContext:           dialer.DialContext,
+			ForceAttemptHTTP2:     true,
+			MaxIdleConns:          100,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	return d
+}
+
+// checkPublic fails unless address, an IP and a port about to be connected
+// to, is a public unicast address
+func checkPublic(address string) error {
+	host, _, err := net.SplitHostPort(address)
+
+	if err != nil {
+		return err
+	}
+
+	ip := net.ParseIP(host)
+
+	switch {
+	case ip == nil:
+		return fmt.Errorf("invalid address %s", address)
+	case ip.IsLoopback(), ip.IsPrivate(), ip.IsLinkLocalUnicast(), ip.IsUnspecified(),
+		ip.IsMulticast(), ip.IsInterfaceLocalMulticast(), ip.IsLinkLocalMulticast():
+		return fmt.Errorf("%s is not a public address, deliveries to private networks are not allowed", ip)
+	}
+
+	return nil
+}
+
+// Run attempts the pending deliveries every PollInterval until ctx is done.
+// Deliveries being attempted when ctx is done are attempted again later
+func (d *WebhookDeliverer) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		d.deliverDue(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// deliverDue attempts the deliveries that are due, a batch at a time
+func (d *WebhookDeliverer) deliverDue(ctx context.Context) {
+	for ctx.Err() == nil {
+		due, err := d.DeliveryRepository.Due(ctx, time.Now(), d.BatchSize)
+
+		if err != nil {
+			log.Printf("unable to read due webhook deliveries: %v\n", err)
+			return
+		}
+
+		// webhooks read for this batch, nil when gone
+		webhooks := map[uuid.UUID]*model.Webhook{}
+
+		for _, delivery := range due {
+			if ctx.Err() != nil {
+				return
+			}
+
+			w, ok := webhooks[delivery.WebhookID]
+
+			if !ok {
+				if w, err = d.webhook(ctx, delivery.WebhookID); err != nil {
+					return
+				}
+
+				webhooks[delivery.WebhookID] = w
+			}
+
+			// disabled by a failure earlier in the batch
+			if w == nil || !w.Active {
+				continue
+			}
+
+			if err := d.deliver(ctx, w, delivery); err != nil {
+				log.Printf("unable to record webhook delivery %s: %v\n", delivery.ID, err)
+				return
+			}
+		}
+
+		if len(due) < d.BatchSize {
+			return
+		}
+	}
+}
+
+// webhook reads the webhook with the given id, returning nil when it is gone
+func (d *WebhookDeliverer) webhook(ctx context.Context, id uuid.UUID) (*model.Webhook, error) {
+	w, err := d.WebhookRepository.GetByID(ctx, id)
+
+	switch {
+	case rerrors.Status(err) == http.StatusNotFound:
+		return nil, nil
+	case err != nil:
+		log.Printf("unable to read webhook %s: %v\n", id, err)
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// deliver attempts a delivery to w, unless someone else claimed it, and
+// records the outcome
+func (d *WebhookDeliverer) deliver(ctx context.Context, w *model.Webhook, delivery *model.WebhookDelivery) error {
+	now := time.Now()
+
+	claimed, err := d.DeliveryRepository.Claim(ctx, delivery, now, now.Add(d.Client.Timeout+webhookClaimMargin))
+
+	if err != nil || !claimed {
+		return err
+	}
+
+	code, err := d.send(ctx, w, delivery)
+
+	// left claimed, to be attempted again once the claim expires
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	now = time.Now().UTC().Truncate(time.Microsecond)
+
+	delivery.Attempts++
+	delivery.ResponseCode = code
+	delivery.ClaimedUntil = nil
+
+	if err == nil {
+		delivery.Status = model.DeliverySucceeded
+		delivery.LastError = ""
+		delivery.DeliveredAt = &now
+
+		if err := d.DeliveryRepository.Save(ctx, delivery); err != nil {
+			return err
+		}
+
+		return d.WebhookRepository.Succeeded(ctx, w.ID)
+	}
+
+	delivery.LastError = err.Error()
+
+	if delivery.Attempts >= d.MaxAttempts {
+		delivery.Status = model.DeliveryFailed
+		log.Printf("giving up on webhook delivery %s after %d attempts: %v\n", delivery.ID, delivery.Attempts, err)
+	} else {
+		delivery.NextAttemptAt = now.Add(exponentialBackoff(d.MinBackoff, d.MaxBackoff, delivery.Attempts))
+	}
+
+	if err := d.DeliveryRepository.Save(ctx, delivery); err != nil {
+		return err
+	}
+
+	disabled, err := d.WebhookRepository.Failed(ctx, w.ID, d.MaxFailures, webhookDisabledByFailures)
+
+	if err != nil {
+		return err
+	}
+
+	if disabled {
+		log.Printf("disabled webhook %s after %d failed deliveries in a row\n", w.ID, d.MaxFailures)
+		w.Active = false
+	}
+
+	return nil
+}
+
+// send POSTs the payload of a delivery to w, returning the status of the
+// response, if any, and an error unless it is a 2xx
+func (d *WebhookDeliverer) send(ctx context.Context, w *model.Webhook, delivery *model.WebhookDelivery) (*int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(delivery.Payload))
+
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "users-api-webhooks")
+	req.Header.Set(WebhookEventHeader, string(delivery.EventType))
+	req.Header.Set(WebhookDeliveryHeader, delivery.ID.String())
+	req.Header.Set(WebhookSignatureHeader, WebhookSignature(w.Secret, delivery.Payload))
+
+	res, err := d.Client.Do(req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer res.Body.Close()
+
+	io.Copy(io.Discard, io.LimitReader(res.Body, webhookResponseLimit))
+
+	code := res.StatusCode
+
+	if code < 200 || code > 299 {
+		return &code, fmt.Errorf("unexpected status %d", code)
+	}
+
+	return &code, nil
+}
+
+// WebhookSignature signs the body of a delivery with the secret of its
+// webhook, as sent in the X-Webhook-Signature header: sha256= followed by
+// the hex encoded HMAC-SHA256 of body. Receivers compute it over the body
+// they got and compare both in constant time
+func WebhookSignature(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
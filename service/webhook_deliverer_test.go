@@ -0,0 +1,286 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/klasrak/users-api/mocks"
+	model "github.com/klasrak/users-api/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookPublisher(t *testing.T) {
+	ctx := context.Background()
+
+	e := model.NewEvent(model.EventUserCreated, &model.User{UID: uuid.New(), Name: "João"})
+
+	t.Run("Enqueues a delivery to every subscribed active webhook", func(t *testing.T) {
+		subscribed := model.Webhook{ID: uuid.New(), Events: model.WebhookEvents{model.EventUserCreated}, Active: true}
+		disabled := model.Webhook{ID: uuid.New(), Events: model.WebhookEvents{model.EventUserCreated}}
+		other := model.Webhook{ID: uuid.New(), Events: model.WebhookEvents{model.EventUserDeleted}, Active: true}
+
+		webhooks := new(mocks.MockWebhookRepository)
+		webhooks.On("List", mock.Anything).Return([]model.Webhook{subscribed, disabled, other}, nil)
+
+		var enqueued []*model.WebhookDelivery
+
+		deliveries := new(mocks.MockWebhookDeliveryRepository)
+		deliveries.On("Enqueue", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			enqueued = args.Get(1).([]*model.WebhookDelivery)
+		}).Return(nil)
+
+		p := &WebhookPublisher{WebhookRepository: webhooks, DeliveryRepository: deliveries, Transactor: &mocks.MockTransactor{}}
+
+		require.NoError(t, p.Publish(ctx, e))
+
+		require.Len(t, enqueued, 1)
+		assert.Equal(t, subscribed.ID, enqueued[0].WebhookID)
+		assert.Equal(t, e.ID, enqueued[0].EventID)
+		assert.Equal(t, model.EventUserCreated, enqueued[0].EventType)
+		assert.Equal(t, model.DeliveryPending, enqueued[0].Status)
+
+		payload, _ := json.Marshal(e)
+		assert.Equal(t, model.WebhookPayload(payload), enqueued[0].Payload)
+	})
+
+	t.Run("Nothing to enqueue", func(t *testing.T) {
+		webhooks := new(mocks.MockWebhookRepository)
+		webhooks.On("List", mock.Anything).Return([]model.Webhook{}, nil)
+
+		deliveries := new(mocks.MockWebhookDeliveryRepository)
+
+		p := &WebhookPublisher{WebhookRepository: webhooks, DeliveryRepository: deliveries, Transactor: &mocks.MockTransactor{}}
+
+		require.NoError(t, p.Publish(ctx, e))
+		deliveries.AssertNotCalled(t, "Enqueue", mock.Anything, mock.Anything)
+	})
+}
+
+func TestWebhookDeliverer(t *testing.T) {
+	ctx := context.Background()
+
+	// endpoint answers deliveries with status, recording the requests it got
+	endpoint := func(t *testing.T, status int) (*httptest.Server, *[]*http.Request, *[][]byte) {
+		var (
+			requests []*http.Request
+			bodies   [][]byte
+		)
+
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+
+			requests = append(requests, r)
+			bodies = append(bodies, body)
+
+			w.WriteHeader(status)
+		}))
+
+		t.Cleanup(srv.Close)
+
+		return srv, &requests, &bodies
+	}
+
+	newWebhook := func(url string) *model.Webhook {
+		return &model.Webhook{ID: uuid.New(), URL: url, Secret: "secret", Active: true}
+	}
+
+	newDelivery := func(w *model.Webhook, attempts int) *model.WebhookDelivery {
+		return &model.WebhookDelivery{
+			ID:        uuid.New(),
+			WebhookID: w.ID,
+			EventID:   uuid.New(),
+			EventType: model.EventUserUpdated,
+			Payload:   model.WebhookPayload(`{"type":"user.updated"}`),
+			Status:    model.DeliveryPending,
+			Attempts:  attempts,
+		}
+	}
+
+	newDeliverer := func(webhooks *mocks.MockWebhookRepository, deliveries *mocks.MockWebhookDeliveryRepository) *WebhookDeliverer {
+		d := NewWebhookDeliverer(webhooks, deliveries)
+		d.BatchSize = 10
+		d.MaxAttempts = 3
+		d.MaxFailures = 5
+		// endpoints listen on the loopback interface
+		d.AllowPrivateNetworks = true
+
+		return d
+	}
+
+	t.Run("Signs and delivers", func(t *testing.T) {
+		srv, requests, bodies := endpoint(t, http.StatusNoContent)
+
+		w := newWebhook(srv.URL)
+		delivery := newDelivery(w, 0)
+
+		webhooks := new(mocks.MockWebhookRepository)
+		webhooks.On("GetByID", mock.Anything, w.ID).Return(w, nil)
+		webhooks.On("Succeeded", mock.Anything, w.ID).Return(nil)
+
+		deliveries := new(mocks.MockWebhookDeliveryRepository)
+		deliveries.On("Due", mock.Anything, mock.Anything, 10).Return([]*model.WebhookDelivery{delivery}, nil).Once()
+		deliveries.On("Claim", mock.Anything, delivery, mock.Anything, mock.Anything).Return(true, nil)
+		deliveries.On("Save", mock.Anything, delivery).Return(nil)
+
+		newDeliverer(webhooks, deliveries).deliverDue(ctx)
+
+		require.Len(t, *requests, 1)
+
+		r := (*requests)[0]
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.Equal(t, "user.updated", r.Header.Get(WebhookEventHeader))
+		assert.Equal(t, delivery.ID.String(), r.Header.Get(WebhookDeliveryHeader))
+		assert.Equal(t, WebhookSignature("secret", (*bodies)[0]), r.Header.Get(WebhookSignatureHeader))
+		assert.Equal(t, `{"type":"user.updated"}`, string((*bodies)[0]))
+
+		assert.Equal(t, model.DeliverySucceeded, delivery.Status)
+		assert.Equal(t, 1, delivery.Attempts)
+		assert.Equal(t, http.StatusNoContent, *delivery.ResponseCode)
+		assert.NotNil(t, delivery.DeliveredAt)
+		assert.Nil(t, delivery.ClaimedUntil)
+		webhooks.AssertExpectations(t)
+	})
+
+	t.Run("Retries failed deliveries after a backoff", func(t *testing.T) {
+		srv, _, _ := endpoint(t, http.StatusInternalServerError)
+
+		w := newWebhook(srv.URL)
+		delivery := newDelivery(w, 1)
+
+		webhooks := new(mocks.MockWebhookRepository)
+		webhooks.On("GetByID", mock.Anything, w.ID).Return(w, nil)
+		webhooks.On("Failed", mock.Anything, w.ID, 5, webhookDisabledByFailures).Return(false, nil)
+
+		deliveries := new(mocks.MockWebhookDeliveryRepository)
+		deliveries.On("Due", mock.Anything, mock.Anything, 10).Return([]*model.WebhookDelivery{delivery}, nil).Once()
+		deliveries.On("Claim", mock.Anything, delivery, mock.Anything, mock.Anything).Return(true, nil)
+		deliveries.On("Save", mock.Anything, delivery).Return(nil)
+
+		d := newDeliverer(webhooks, deliveries)
+
+		before := time.Now()
+
+		d.deliverDue(ctx)
+
+		assert.Equal(t, model.DeliveryPending, delivery.Status)
+		assert.Equal(t, 2, delivery.Attempts)
+		assert.Equal(t, http.StatusInternalServerError, *delivery.ResponseCode)
+		assert.Equal(t, "unexpected status 500", delivery.LastError)
+		// the backoff doubles after each failed attempt
+		assert.False(t, delivery.NextAttemptAt.Before(before.Add(2*d.MinBackoff)))
+		assert.Nil(t, delivery.DeliveredAt)
+		webhooks.AssertExpectations(t)
+	})
+
+	t.Run("Gives up after MaxAttempts", func(t *testing.T) {
+		w := newWebhook("http://127.0.0.1:1")
+		delivery := newDelivery(w, 2)
+
+		webhooks := new(mocks.MockWebhookRepository)
+		webhooks.On("GetByID", mock.Anything, w.ID).Return(w, nil)
+		webhooks.On("Failed", mock.Anything, w.ID, 5, webhookDisabledByFailures).Return(false, nil)
+
+		deliveries := new(mocks.MockWebhookDeliveryRepository)
+		deliveries.On("Due", mock.Anything, mock.Anything, 10).Return([]*model.WebhookDelivery{delivery}, nil).Once()
+		deliveries.On("Claim", mock.Anything, delivery, mock.Anything, mock.Anything).Return(true, nil)
+		deliveries.On("Save", mock.Anything, delivery).Return(nil)
+
+		newDeliverer(webhooks, deliveries).deliverDue(ctx)
+
+		assert.Equal(t, model.DeliveryFailed, delivery.Status)
+		assert.Equal(t, 3, delivery.Attempts)
+		// the endpoint never answered
+		assert.Nil(t, delivery.ResponseCode)
+		assert.NotEmpty(t, delivery.LastError)
+	})
+
+	t.Run("Disabled webhooks get nothing else", func(t *testing.T) {
+		srv, requests, _ := endpoint(t, http.StatusBadGateway)
+
+		w := newWebhook(srv.URL)
+		first, second := newDelivery(w, 0), newDelivery(w, 0)
+
+		webhooks := new(mocks.MockWebhookRepository)
+		webhooks.On("GetByID", mock.Anything, w.ID).Return(w, nil).Once()
+		webhooks.On("Failed", mock.Anything, w.ID, 5, webhookDisabledByFailures).Return(true, nil)
+
+		deliveries := new(mocks.MockWebhookDeliveryRepository)
+		deliveries.On("Due", mock.Anything, mock.Anything, 10).Return([]*model.WebhookDelivery{first, second}, nil).Once()
+		deliveries.On("Claim", mock.Anything, first, mock.Anything, mock.Anything).Return(true, nil)
+		deliveries.On("Save", mock.Anything, first).Return(nil)
+
+		newDeliverer(webhooks, deliveries).deliverDue(ctx)
+
+		assert.Len(t, *requests, 1)
+		assert.False(t, w.Active)
+		deliveries.AssertNotCalled(t, "Claim", mock.Anything, second, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Skips deliveries claimed by someone else", func(t *testing.T) {
+		srv, requests, _ := endpoint(t, http.StatusOK)
+
+		w := newWebhook(srv.URL)
+		delivery := newDelivery(w, 0)
+
+		webhooks := new(mocks.MockWebhookRepository)
+		webhooks.On("GetByID", mock.Anything, w.ID).Return(w, nil)
+
+		deliveries := new(mocks.MockWebhookDeliveryRepository)
+		deliveries.On("Due", mock.Anything, mock.Anything, 10).Return([]*model.WebhookDelivery{delivery}, nil).Once()
+		deliveries.On("Claim", mock.Anything, delivery, mock.Anything, mock.Anything).Return(false, nil)
+
+		newDeliverer(webhooks, deliveries).deliverDue(ctx)
+
+		assert.Empty(t, *requests)
+		deliveries.AssertNotCalled(t, "Save", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Redirects are failures", func(t *testing.T) {
+		srv := httptest.NewServer(http.RedirectHandler("https://example.com", http.StatusFound))
+		t.Cleanup(srv.Close)
+
+		w := newWebhook(srv.URL)
+		delivery := newDelivery(w, 0)
+
+		code, err := newDeliverer(nil, nil).send(ctx, w, delivery)
+
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusFound, *code)
+	})
+
+	t.Run("Private networks are not delivered to", func(t *testing.T) {
+		srv, requests, _ := endpoint(t, http.StatusOK)
+
+		d := NewWebhookDeliverer(nil, nil)
+
+		for _, url := range []string{srv.URL, "http://169.254.169.254/latest/meta-data", "http://10.0.0.1", "http://[::1]:8080"} {
+			w := newWebhook(url)
+
+			code, err := d.send(ctx, w, newDelivery(w, 0))
+
+			assert.Error(t, err, url)
+			assert.Contains(t, err.Error(), "deliveries to private networks are not allowed", url)
+			assert.Nil(t, code)
+		}
+
+		assert.Empty(t, *requests)
+		assert.NoError(t, checkPublic("93.184.216.34:443"))
+	})
+}
+
+func TestWebhookSignature(t *testing.T) {
+	// HMAC-SHA256 test case 2 of RFC 4231
+	assert.Equal(t,
+		"sha256=5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843",
+		WebhookSignature("Jefe", []byte("what do ya want for nothing?")),
+	)
+}
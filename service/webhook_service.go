@@ -0,0 +1,311 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+	model "github.com/klasrak/users-api/models"
+	"github.com/klasrak/users-api/rerrors"
+)
+
+// WebhookService is a struct to inject the implementations of
+// WebhookRepository and WebhookDeliveryRepository
+type WebhookService struct {
+	WebhookRepository  WebhookRepository
+	DeliveryRepository WebhookDeliveryRepository
+	Transactor         Transactor
+}
+
+// Page size limits applied to delivery listings
+const (
+	DefaultDeliveryPageSize = 50
+	MaxDeliveryPageSize     = 1000
+)
+
+// Reasons webhooks are disabled for
+const (
+	webhookDisabledByHand     = "disabled"
+	webhookDisabledByFailures = "too many failed deliveries in a row"
+)
+
+// List returns every webhook, without their secrets
+func (s *WebhookService) List(ctx context.Context) ([]model.Webhook, error) {
+	webhooks, err := s.WebhookRepository.List(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range webhooks {
+		webhooks[i].Secret = ""
+	}
+
+	return webhooks, nil
+}
+
+// GetByID validates the id and returns the webhook, without its secret
+func (s *WebhookService) GetByID(ctx context.Context, id string) (*model.Webhook, error) {
+	uid, err := uuid.Parse(id)
+
+	if err != nil {
+		return nil, rerrors.NewBadRequest("invalid id")
+	}
+
+	w, err := s.WebhookRepository.GetByID(ctx, uid)
+
+	if err != nil {
+		return nil, err
+	}
+
+	w.Secret = ""
+
+	return w, nil
+}
+
+// Create validates params and creates an active webhook, with a new secret
+// to sign its deliveries. The secret is only ever returned here
+func (s *WebhookService) Create(ctx context.Context, params *model.WebhookParams) (*model.Webhook, error) {
+	events, err := validateWebhook(params)
+
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := newWebhookSecret()
+
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC().Truncate(time.Microsecond)
+
+	w := &model.Webhook{
+		ID:        uuid.New(),
+		URL:       params.URL,
+		Events:    events,
+		Secret:    secret,
+		Active:    params.Active == nil || *params.Active,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	if !w.Active {
+		w.DisabledReason = webhookDisabledByHand
+	}
+
+	if err := s.WebhookRepository.Create(ctx, w); err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// Update validates params and replaces the URL and events of a webhook,
+// enabling or disabling it when asked to. Enabling a webhook clears its
+// failures, and resumes its pending deliveries
+func (s *WebhookService) Update(ctx context.Context, id string, params *model.WebhookParams) (*model.Webhook, error) {
+	uid, err := uuid.Parse(id)
+
+	if err != nil {
+		return nil, rerrors.NewBadRequest("invalid id")
+	}
+
+	events, err := validateWebhook(params)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var updated *model.Webhook
+
+	err = s.Transactor.WithinTx(ctx, func(ctx context.Context) error {
+		w, err := s.WebhookRepository.GetByID(ctx, uid)
+
+		if err != nil {
+			return err
+		}
+
+		w.URL = params.URL
+		w.Events = events
+		w.UpdatedAt = time.Now().UTC().Truncate(time.Microsecond)
+
+		switch {
+		case params.Active == nil || *params.Active == w.Active:
+		case *params.Active:
+			w.Active = true
+			w.DisabledReason = ""
+			w.Failures = 0
+		default:
+			w.Active = false
+			w.DisabledReason = webhookDisabledByHand
+		}
+
+		if err := s.WebhookRepository.Update(ctx, w); err != nil {
+			return err
+		}
+
+		updated = w
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	updated.Secret = ""
+
+	return updated, nil
+}
+
+// Delete validates the id and removes a webhook, along with its deliveries
+func (s *WebhookService) Delete(ctx context.Context, id string) error {
+	uid, err := uuid.Parse(id)
+
+	if err != nil {
+		return rerrors.NewBadRequest("invalid id")
+	}
+
+	return s.Transactor.WithinTx(ctx, func(ctx context.Context) error {
+		return s.WebhookRepository.Delete(ctx, uid)
+	})
+}
+
+// Deliveries validates the listing parameters and returns the deliveries
+// of a webhook, newest first
+func (s *WebhookService) Deliveries(ctx context.Context, id string, params model.WebhookDeliveryListParams) (*model.WebhookDeliveryPage, error) {
+	uid, err := uuid.Parse(id)
+
+	if err != nil {
+		return nil, rerrors.NewBadRequest("invalid id")
+	}
+
+	switch params.Status {
+	case "", model.DeliveryPending, model.DeliverySucceeded, model.DeliveryFailed:
+	default:
+		return nil, rerrors.NewBadRequest("status must be pending, succeeded or failed")
+	}
+
+	if params.Limit < 0 {
+		return nil, rerrors.NewBadRequest("pagination parameters must be positive numbers")
+	}
+
+	if params.Limit == 0 {
+		params.Limit = DefaultDeliveryPageSize
+	}
+
+	if params.Limit > MaxDeliveryPageSize {
+		return nil, rerrors.NewBadRequest(fmt.Sprintf("limit must not be greater than %d", MaxDeliveryPageSize))
+	}
+
+	// the webhook must exist, even when it has no deliveries
+	if _, err := s.WebhookRepository.GetByID(ctx, uid); err != nil {
+		return nil, err
+	}
+
+	params.WebhookID = uid
+
+	deliveries, err := s.DeliveryRepository.List(ctx, params)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.WebhookDeliveryPage{Data: deliveries}, nil
+}
+
+// Redeliver delivers the event of a delivery again, as a new delivery
+// attempted right away, or once the webhook is enabled again
+func (s *WebhookService) Redeliver(ctx context.Context, id, deliveryID string) (*model.WebhookDelivery, error) {
+	uid, err := uuid.Parse(id)
+
+	if err != nil {
+		return nil, rerrors.NewBadRequest("invalid id")
+	}
+
+	did, err := uuid.Parse(deliveryID)
+
+	if err != nil {
+		return nil, rerrors.NewBadRequest("invalid delivery id")
+	}
+
+	var redelivery *model.WebhookDelivery
+
+	err = s.Transactor.WithinTx(ctx, func(ctx context.Context) error {
+		d, err := s.DeliveryRepository.GetByID(ctx, uid, did)
+
+		if err != nil {
+			return err
+		}
+
+		now := time.Now().UTC().Truncate(time.Microsecond)
+
+		redelivery = &model.WebhookDelivery{
+			ID:            uuid.New(),
+			WebhookID:     d.WebhookID,
+			EventID:       d.EventID,
+			EventType:     d.EventType,
+			RedeliveryOf:  &d.ID,
+			Payload:       d.Payload,
+			Status:        model.DeliveryPending,
+			NextAttemptAt: now,
+			CreatedAt:     now,
+		}
+
+		return s.DeliveryRepository.Enqueue(ctx, []*model.WebhookDelivery{redelivery})
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return redelivery, nil
+}
+
+// validateWebhook checks the settings of a webhook, returning the event
+// types it subscribes to without repetitions
+func validateWebhook(params *model.WebhookParams) (model.WebhookEvents, error) {
+	u, err := url.Parse(params.URL)
+
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, rerrors.NewBadRequest("url must be an absolute http or https URL")
+	}
+
+	if len(params.Events) == 0 {
+		return nil, rerrors.NewBadRequest("events must list at least one event type")
+	}
+
+	events := model.WebhookEvents{}
+	seen := map[model.EventType]bool{}
+
+	for _, t := range params.Events {
+		if !t.Valid() {
+			return nil, rerrors.NewBadRequest(fmt.Sprintf("unknown event type %q", t))
+		}
+
+		if !seen[t] {
+			seen[t] = true
+			events = append(events, t)
+		}
+	}
+
+	return events, nil
+}
+
+// newWebhookSecret returns a random secret to sign deliveries with
+func newWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+
+	if _, err := rand.Read(b); err != nil {
+		log.Printf("unable to generate webhook secret: %v\n", err)
+		return "", rerrors.NewInternal()
+	}
+
+	return hex.EncodeToString(b), nil
+}
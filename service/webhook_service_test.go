@@ -0,0 +1,275 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/klasrak/users-api/mocks"
+	model "github.com/klasrak/users-api/models"
+	"github.com/klasrak/users-api/rerrors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookService(t *testing.T) {
+	ctx := context.Background()
+
+	newService := func(webhooks *mocks.MockWebhookRepository, deliveries *mocks.MockWebhookDeliveryRepository) *WebhookService {
+		return &WebhookService{
+			WebhookRepository:  webhooks,
+			DeliveryRepository: deliveries,
+			Transactor:         &mocks.MockTransactor{},
+		}
+	}
+
+	stored := func() *model.Webhook {
+		return &model.Webhook{
+			ID:       uuid.New(),
+			URL:      "https://example.com/hooks",
+			Events:   model.WebhookEvents{model.EventUserCreated},
+			Secret:   "secret",
+			Active:   true,
+			Failures: 3,
+		}
+	}
+
+	t.Run("List and GetByID hide secrets", func(t *testing.T) {
+		w := stored()
+
+		webhooks := new(mocks.MockWebhookRepository)
+		webhooks.On("List", mock.Anything).Return([]model.Webhook{*w}, nil)
+		webhooks.On("GetByID", mock.Anything, w.ID).Return(w, nil)
+
+		s := newService(webhooks, nil)
+
+		list, err := s.List(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, "", list[0].Secret)
+
+		got, err := s.GetByID(ctx, w.ID.String())
+		require.NoError(t, err)
+		assert.Equal(t, "", got.Secret)
+
+		_, err = s.GetByID(ctx, "42")
+		assert.Equal(t, rerrors.NewBadRequest("invalid id"), err)
+	})
+
+	t.Run("Create", func(t *testing.T) {
+		t.Run("Success", func(t *testing.T) {
+			webhooks := new(mocks.MockWebhookRepository)
+			webhooks.On("Create", mock.Anything, mock.Anything).Return(nil)
+
+			w, err := newService(webhooks, nil).Create(ctx, &model.WebhookParams{
+				URL:    "https://example.com/hooks",
+				Events: []model.EventType{model.EventUserCreated, model.EventUserDeleted, model.EventUserCreated},
+			})
+
+			require.NoError(t, err)
+			assert.True(t, w.Active)
+			assert.Equal(t, model.WebhookEvents{model.EventUserCreated, model.EventUserDeleted}, w.Events)
+			// the secret is returned once, on creation
+			assert.Len(t, w.Secret, 64)
+			webhooks.AssertCalled(t, "Create", mock.Anything, w)
+		})
+
+		t.Run("Created disabled", func(t *testing.T) {
+			webhooks := new(mocks.MockWebhookRepository)
+			webhooks.On("Create", mock.Anything, mock.Anything).Return(nil)
+
+			active := false
+
+			w, err := newService(webhooks, nil).Create(ctx, &model.WebhookParams{
+				URL:    "http://example.com/hooks",
+				Events: []model.EventType{model.EventUserUpdated},
+				Active: &active,
+			})
+
+			require.NoError(t, err)
+			assert.False(t, w.Active)
+			assert.Equal(t, webhookDisabledByHand, w.DisabledReason)
+		})
+
+		t.Run("Invalid settings", func(t *testing.T) {
+			for name, params := range map[string]*model.WebhookParams{
+				"relative url":   {URL: "/hooks", Events: []model.EventType{model.EventUserCreated}},
+				"other scheme":   {URL: "ftp://example.com/hooks", Events: []model.EventType{model.EventUserCreated}},
+				"no events":      {URL: "https://example.com/hooks", Events: []model.EventType{}},
+				"unknown events": {URL: "https://example.com/hooks", Events: []model.EventType{"user.renamed"}},
+			} {
+				t.Run(name, func(t *testing.T) {
+					webhooks := new(mocks.MockWebhookRepository)
+
+					_, err := newService(webhooks, nil).Create(ctx, params)
+
+					assert.Equal(t, 400, rerrors.Status(err))
+					webhooks.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+				})
+			}
+		})
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		params := func(active *bool) *model.WebhookParams {
+			return &model.WebhookParams{
+				URL:    "https://example.com/other",
+				Events: []model.EventType{model.EventUserUpdated},
+				Active: active,
+			}
+		}
+
+		yes, no := true, false
+
+		t.Run("Keeps the webhook as it is", func(t *testing.T) {
+			w := stored()
+
+			webhooks := new(mocks.MockWebhookRepository)
+			webhooks.On("GetByID", mock.Anything, w.ID).Return(w, nil)
+			webhooks.On("Update", mock.Anything, mock.Anything).Return(nil)
+
+			updated, err := newService(webhooks, nil).Update(ctx, w.ID.String(), params(nil))
+
+			require.NoError(t, err)
+			assert.Equal(t, "https://example.com/other", updated.URL)
+			assert.Equal(t, model.WebhookEvents{model.EventUserUpdated}, updated.Events)
+			assert.True(t, updated.Active)
+			assert.Equal(t, 3, updated.Failures)
+			assert.Equal(t, "", updated.Secret)
+		})
+
+		t.Run("Disables", func(t *testing.T) {
+			w := stored()
+
+			webhooks := new(mocks.MockWebhookRepository)
+			webhooks.On("GetByID", mock.Anything, w.ID).Return(w, nil)
+			webhooks.On("Update", mock.Anything, mock.Anything).Return(nil)
+
+			updated, err := newService(webhooks, nil).Update(ctx, w.ID.String(), params(&no))
+
+			require.NoError(t, err)
+			assert.False(t, updated.Active)
+			assert.Equal(t, webhookDisabledByHand, updated.DisabledReason)
+		})
+
+		t.Run("Enabling clears failures", func(t *testing.T) {
+			w := stored()
+			w.Active = false
+			w.DisabledReason = webhookDisabledByFailures
+			w.Failures = 20
+
+			webhooks := new(mocks.MockWebhookRepository)
+			webhooks.On("GetByID", mock.Anything, w.ID).Return(w, nil)
+			webhooks.On("Update", mock.Anything, mock.Anything).Return(nil)
+
+			updated, err := newService(webhooks, nil).Update(ctx, w.ID.String(), params(&yes))
+
+			require.NoError(t, err)
+			assert.True(t, updated.Active)
+			assert.Equal(t, "", updated.DisabledReason)
+			assert.Equal(t, 0, updated.Failures)
+		})
+
+		t.Run("Not Found", func(t *testing.T) {
+			id := uuid.New()
+
+			webhooks := new(mocks.MockWebhookRepository)
+			webhooks.On("GetByID", mock.Anything, id).Return(nil, rerrors.NewNotFound("webhook", id.String()))
+
+			_, err := newService(webhooks, nil).Update(ctx, id.String(), params(nil))
+
+			assert.Equal(t, rerrors.NewNotFound("webhook", id.String()), err)
+			webhooks.AssertNotCalled(t, "Update", mock.Anything, mock.Anything)
+		})
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		id := uuid.New()
+
+		webhooks := new(mocks.MockWebhookRepository)
+		webhooks.On("Delete", mock.Anything, id).Return(nil)
+
+		s := newService(webhooks, nil)
+
+		assert.NoError(t, s.Delete(ctx, id.String()))
+		assert.Equal(t, rerrors.NewBadRequest("invalid id"), s.Delete(ctx, "42"))
+		webhooks.AssertNumberOfCalls(t, "Delete", 1)
+	})
+
+	t.Run("Deliveries", func(t *testing.T) {
+		t.Run("Default page size", func(t *testing.T) {
+			w := stored()
+			list := []model.WebhookDelivery{{ID: uuid.New(), WebhookID: w.ID}}
+
+			webhooks := new(mocks.MockWebhookRepository)
+			webhooks.On("GetByID", mock.Anything, w.ID).Return(w, nil)
+
+			deliveries := new(mocks.MockWebhookDeliveryRepository)
+			deliveries.On("List", mock.Anything, model.WebhookDeliveryListParams{
+				WebhookID: w.ID,
+				Status:    model.DeliveryPending,
+				Limit:     DefaultDeliveryPageSize,
+			}).Return(list, nil)
+
+			page, err := newService(webhooks, deliveries).Deliveries(ctx, w.ID.String(), model.WebhookDeliveryListParams{Status: model.DeliveryPending})
+
+			require.NoError(t, err)
+			assert.Equal(t, list, page.Data)
+		})
+
+		t.Run("Bad request", func(t *testing.T) {
+			for name, params := range map[string]model.WebhookDeliveryListParams{
+				"unknown status": {Status: "lost"},
+				"negative limit": {Limit: -1},
+				"limit too big":  {Limit: MaxDeliveryPageSize + 1},
+			} {
+				t.Run(name, func(t *testing.T) {
+					deliveries := new(mocks.MockWebhookDeliveryRepository)
+
+					_, err := newService(new(mocks.MockWebhookRepository), deliveries).Deliveries(ctx, uuid.New().String(), params)
+
+					assert.Equal(t, 400, rerrors.Status(err))
+					deliveries.AssertNotCalled(t, "List", mock.Anything, mock.Anything)
+				})
+			}
+		})
+
+		t.Run("Unknown webhook", func(t *testing.T) {
+			id := uuid.New()
+
+			webhooks := new(mocks.MockWebhookRepository)
+			webhooks.On("GetByID", mock.Anything, id).Return(nil, rerrors.NewNotFound("webhook", id.String()))
+
+			_, err := newService(webhooks, new(mocks.MockWebhookDeliveryRepository)).Deliveries(ctx, id.String(), model.WebhookDeliveryListParams{})
+
+			assert.Equal(t, rerrors.NewNotFound("webhook", id.String()), err)
+		})
+	})
+
+	t.Run("Redeliver", func(t *testing.T) {
+		original := &model.WebhookDelivery{
+			ID:        uuid.New(),
+			WebhookID: uuid.New(),
+			EventID:   uuid.New(),
+			EventType: model.EventUserDeleted,
+			Payload:   model.WebhookPayload(`{"type":"user.deleted"}`),
+			Status:    model.DeliveryFailed,
+			Attempts:  8,
+		}
+
+		deliveries := new(mocks.MockWebhookDeliveryRepository)
+		deliveries.On("GetByID", mock.Anything, original.WebhookID, original.ID).Return(original, nil)
+		deliveries.On("Enqueue", mock.Anything, mock.Anything).Return(nil)
+
+		redelivery, err := newService(nil, deliveries).Redeliver(ctx, original.WebhookID.String(), original.ID.String())
+
+		require.NoError(t, err)
+		assert.NotEqual(t, original.ID, redelivery.ID)
+		assert.Equal(t, original.ID, *redelivery.RedeliveryOf)
+		assert.Equal(t, original.EventID, redelivery.EventID)
+		assert.Equal(t, original.Payload, redelivery.Payload)
+		assert.Equal(t, model.DeliveryPending, redelivery.Status)
+		assert.Equal(t, 0, redelivery.Attempts)
+		deliveries.AssertCalled(t, "Enqueue", mock.Anything, []*model.WebhookDelivery{redelivery})
+	})
+}
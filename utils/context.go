@@ -0,0 +1,89 @@
+package utils
+
+import (
+	"context"
+	"sync"
+)
+
+type contextKey int
+
+const (
+	actorKey contextKey = iota
+	requestIDKey
+	readYourWritesKey
+	txEndKey
+)
+
+// WithActor returns a copy of ctx carrying who is making the request
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey, actor)
+}
+
+// Actor returns who is making the request, or "" when unknown
+func Actor(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey).(string)
+	return actor
+}
+
+// WithRequestID returns a copy of ctx carrying the ID of the request
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestID returns the ID of the request, or "" when unknown
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// WithReadYourWrites returns a copy of ctx whose reads must see every write
+// made before them, so they are never served by a lagging replica
+func WithReadYourWrites(ctx context.Context) context.Context {
+	return context.WithValue(ctx, readYourWritesKey, true)
+}
+
+// ReadYourWrites reports whether reads made with ctx must see every write
+// made before them
+func ReadYourWrites(ctx context.Context) bool {
+	ryw, _ := ctx.Value(readYourWritesKey).(bool)
+	return ryw
+}
+
+// txEnd is what to run once a transaction ends
+type txEnd struct {
+	mu  sync.Mutex
+	fns []func()
+}
+
+// WithTxEnd returns a copy of ctx for a transaction to run with, and a
+// function running what AfterTx was given within it. Transactors call it
+// once the transaction ends, whether it was committed or rolled back
+func WithTxEnd(ctx context.Context) (context.Context, func()) {
+	end := &txEnd{}
+
+	return context.WithValue(ctx, txEndKey, end), func() {
+		end.mu.Lock()
+		fns := end.fns
+		end.fns = nil
+		end.mu.Unlock()
+
+		for _, fn := range fns {
+			fn()
+		}
+	}
+}
+
+// AfterTx runs fn once the transaction ctx runs within ends, committed or
+// rolled back, or right away when it runs within none
+func AfterTx(ctx context.Context, fn func()) {
+	end, ok := ctx.Value(txEndKey).(*txEnd)
+
+	if !ok {
+		fn()
+		return
+	}
+
+	end.mu.Lock()
+	end.fns = append(end.fns, fn)
+	end.mu.Unlock()
+}
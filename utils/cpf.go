@@ -1,6 +1,8 @@
 package utils
 
 import (
+	"fmt"
+	"math/rand"
 	"regexp"
 	"strconv"
 	"strings"
@@ -45,6 +47,27 @@ func IsBrazilianCPFValid(n string) bool {
 	return checksum(ds[:9]) == ds[9] && checksum(ds[:10]) == ds[10]
 }
 
+// RandomBrazilianCPF returns a random valid CPF, formatted as 000.000.000-00
+func RandomBrazilianCPF() string {
+	ds := make([]int64, 11)
+
+	for {
+		for i := 0; i < 9; i++ {
+			ds[i] = rand.Int63n(10)
+		}
+
+		ds[9] = checksum(ds[:9])
+		ds[10] = checksum(ds[:10])
+
+		cpf := fmt.Sprintf("%d%d%d.%d%d%d.%d%d%d-%d%d", ds[0], ds[1], ds[2], ds[3], ds[4], ds[5], ds[6], ds[7], ds[8], ds[9], ds[10])
+
+		// a CPF made of a single repeated digit is never valid
+		if IsBrazilianCPFValid(cpf) {
+			return cpf
+		}
+	}
+}
+
 //removeNonDigits removes any non-digit from brazilian CPF number
 func removeNonDigits(n string) string {
 	return regexp.MustCompile(`\D`).ReplaceAllString(n, "")
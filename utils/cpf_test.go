@@ -47,3 +47,12 @@ func TestIsBrazilianCPFValid(t *testing.T) {
 		assert.False(IsBrazilianCPFValid("65638732499"), "unmasked invalid cpf, should be false")
 	})
 }
+
+func TestRandomBrazilianCPF(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		cpf := RandomBrazilianCPF()
+
+		assert.Regexp(t, `^\d{3}\.\d{3}\.\d{3}-\d{2}$`, cpf)
+		assert.True(t, IsBrazilianCPFValid(cpf), cpf)
+	}
+}
@@ -26,7 +26,7 @@ func TestTimeBetween(t *testing.T) {
 
 func TestIsUnderage(t *testing.T) {
 	t.Run("True", func(t *testing.T) {
-		birthdate := time.Date(2006, 1, 1, 1, 1, 1, 1, time.UTC)
+		birthdate := time.Now().AddDate(-17, 0, 0)
 
 		isUnderage := IsUnderage(birthdate)
 